@@ -0,0 +1,237 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/semaphore"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/retry"
+)
+
+// ErrSkipped is the error of the changes Apply does not try because a change
+// they depend on failed, such as adding a user to a group that could not be
+// created.
+var ErrSkipped = errors.New("provisioning: skipped because a change it depends on failed")
+
+// A Result is the result of applying a change.
+type Result struct {
+	Change *Change
+
+	// Err is the last error of applying the change, or nil if it was
+	// applied.
+	Err error
+}
+
+// Apply applies the changes of plan and returns their results, in the order
+// of plan.Changes. Changes are applied in the order of their actions, and
+// the changes with the same action, except organizational units, are
+// applied concurrently.
+//
+// Apply returns an error only if ctx is done before all changes are tried.
+// The results of the changes not tried then have the error of ctx.
+func (p *Provisioner) Apply(ctx context.Context, plan *Plan) ([]*Result, error) {
+	results := make([]*Result, len(plan.Changes))
+	for i, c := range plan.Changes {
+		results[i] = &Result{Change: c}
+	}
+	// Group the changes that may be applied at the same time.
+	var phases [][]*Result
+	for _, r := range results {
+		ph := phase(r.Change.Action)
+		for len(phases) <= ph {
+			phases = append(phases, nil)
+		}
+		phases[ph] = append(phases[ph], r)
+	}
+	n := p.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	lim := &limiter{interval: interval}
+	f := &failures{keys: make(map[string]bool)}
+	for i, ph := range phases {
+		w := int64(n)
+		if i == 0 {
+			// Parent organizational units come before their children.
+			w = 1
+		}
+		sem := semaphore.NewWeighted(w)
+		var wg sync.WaitGroup
+		for j, r := range ph {
+			err := ctx.Err()
+			if err == nil {
+				err = sem.Acquire(ctx, 1)
+			}
+			if err != nil {
+				wg.Wait()
+				for _, r := range ph[j:] {
+					r.Err = err
+				}
+				for _, ph := range phases[i+1:] {
+					for _, r := range ph {
+						r.Err = err
+					}
+				}
+				return results, err
+			}
+			wg.Add(1)
+			go func(r *Result) {
+				defer wg.Done()
+				defer sem.Release(1)
+				r.Err = p.applyOne(ctx, r.Change, lim, f)
+			}(r)
+		}
+		wg.Wait()
+	}
+	return results, nil
+}
+
+// phase returns the index of the group of changes that a change with
+// action a is applied in.
+func phase(a Action) int {
+	switch a {
+	case CreateOrgUnit:
+		return 0
+	case AddMember, RemoveMember:
+		return 2
+	case DeleteUser:
+		return 3
+	}
+	return 1
+}
+
+// failures records the keys of the changes that failed.
+type failures struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// applyOne applies c, unless a change it depends on failed.
+func (p *Provisioner) applyOne(ctx context.Context, c *Change, lim *limiter, f *failures) error {
+	var deps []string
+	switch c.Action {
+	case CreateOrgUnit:
+		deps = []string{c.orgUnit.ParentOrgUnitPath}
+	case CreateUser, UpdateUser, SuspendUser:
+		deps = []string{c.user.OrgUnitPath}
+	case AddMember:
+		deps = []string{c.Key, c.Member}
+	}
+	f.mu.Lock()
+	for _, d := range deps {
+		if f.keys[d] {
+			f.keys[c.Key] = true
+			f.mu.Unlock()
+			return ErrSkipped
+		}
+	}
+	f.mu.Unlock()
+	err := p.do(ctx, c, lim)
+	if err != nil {
+		switch c.Action {
+		case CreateOrgUnit, CreateGroup, CreateUser:
+			f.mu.Lock()
+			f.keys[c.Key] = true
+			f.mu.Unlock()
+		}
+	}
+	return err
+}
+
+// do applies c, retrying retryable errors.
+func (p *Provisioner) do(ctx context.Context, c *Change, lim *limiter) error {
+	attempt := 0
+	return retry.Do(ctx, p.Backoff, p.MaxAttempts, func() error {
+		attempt++
+		if err := lim.wait(ctx); err != nil {
+			return err
+		}
+		err := p.call(ctx, c)
+		if err != nil && alreadyApplied(c, err, attempt) {
+			return nil
+		}
+		return err
+	})
+}
+
+// call makes the request that applies c.
+func (p *Provisioner) call(ctx context.Context, c *Change) error {
+	var err error
+	switch c.Action {
+	case CreateOrgUnit:
+		_, err = p.svc.Orgunits.Insert(p.customer(), c.orgUnit).Context(ctx).Do()
+	case CreateGroup:
+		_, err = p.svc.Groups.Insert(c.group).Context(ctx).Do()
+	case UpdateGroup:
+		_, err = p.svc.Groups.Patch(c.Key, c.group).Context(ctx).Do()
+	case CreateUser:
+		_, err = p.svc.Users.Insert(c.user).Context(ctx).Do()
+	case UpdateUser, SuspendUser:
+		_, err = p.svc.Users.Patch(c.Key, c.user).Context(ctx).Do()
+	case AddMember:
+		_, err = p.svc.Members.Insert(c.Key, &admin.Member{Email: c.Member, Role: "MEMBER"}).Context(ctx).Do()
+	case RemoveMember:
+		err = p.svc.Members.Delete(c.Key, c.Member).Context(ctx).Do()
+	case DeleteUser:
+		err = p.svc.Users.Delete(c.Key).Context(ctx).Do()
+	default:
+		err = errors.New("provisioning: unknown action " + c.Action.String())
+	}
+	return err
+}
+
+// alreadyApplied reports whether err means that c needs no applying,
+// because the state it leads to already holds, or because an earlier
+// attempt that seemed to fail succeeded.
+func alreadyApplied(c *Change, err error, attempt int) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	switch c.Action {
+	case AddMember:
+		return e.Code == 409
+	case RemoveMember, DeleteUser:
+		return e.Code == 404
+	case CreateOrgUnit, CreateGroup, CreateUser:
+		return e.Code == 409 && attempt > 1
+	}
+	return false
+}
+
+// A limiter spaces out the starts of requests.
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait waits until a request may start, or ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	t := l.next
+	if t.Before(now) {
+		t = now
+	}
+	l.next = t.Add(l.interval)
+	l.mu.Unlock()
+	return gax.Sleep(ctx, t.Sub(now))
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/internal/testserver"
+)
+
+func TestApply(t *testing.T) {
+	f := newFakeDirectory()
+	svc, done := testserver.NewService(t, f, admin.NewService)
+	defer done()
+	p := New(svc.(*admin.Service))
+	p.Missing = Suspended
+	p.Interval = time.Millisecond
+	ctx := context.Background()
+
+	plan, err := p.Plan(ctx, testState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := p.Apply(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(plan.Changes) {
+		t.Fatalf("got %d results, want %d", len(results), len(plan.Changes))
+	}
+	for i, r := range results {
+		if r.Change != plan.Changes[i] || r.Err != nil {
+			t.Errorf("%v: got %v, %v", plan.Changes[i], r.Change, r.Err)
+		}
+	}
+
+	if u := f.users["erin@example.com"]; u == nil || u.OrgUnitPath != "/Eng/Backend" || u.HashFunction != "crypt" {
+		t.Errorf("got new user %+v", u)
+	}
+	if u := f.users["bob@example.com"]; !u.Suspended || u.Name.FamilyName != "Johnson" {
+		t.Errorf("got bob %+v, want suspended Bob Johnson", u)
+	}
+	if u := f.users["carol@example.com"]; !u.Suspended {
+		t.Error("carol is not suspended")
+	}
+	if u := f.users["root@example.com"]; u.Suspended {
+		t.Error("the administrator is suspended")
+	}
+	if f.users["dave@example.com"] != nil {
+		t.Error("dave is not deleted")
+	}
+	want := map[string]bool{"alice@example.com": true, "ci@example.com": true, "erin@example.com": true}
+	if diff := cmp.Diff(want, f.members["eng@example.com"]); diff != "" {
+		t.Errorf("eng members mismatch (-want +got):\n%s", diff)
+	}
+
+	// The account is now in line with the desired state.
+	plan, err = p.Plan(ctx, testState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("got changes %v after Apply, want none", plan.Changes)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	f := newFakeDirectory()
+	// Creating a user is rate limited once, and creating the organizational
+	// unit and the group fails.
+	f.errs["POST /users"] = []int{403}
+	f.errs["POST /customer/my_customer/orgunits"] = []int{400}
+	f.errs["POST /groups"] = []int{400}
+	svc, done := testserver.NewService(t, f, admin.NewService)
+	defer done()
+	p := New(svc.(*admin.Service))
+	p.Interval = -1
+	p.Backoff = gax.Backoff{Initial: time.Millisecond}
+	ctx := context.Background()
+
+	st := &State{Users: []*User{
+		{Email: "erin@example.com", GivenName: "Erin", FamilyName: "Lee", Groups: []string{"new@example.com", "all@example.com"}},
+		{Email: "alice@example.com", OrgUnit: "/Eng/Backend"},
+	}}
+	plan, err := p.Plan(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := p.Apply(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, r := range results {
+		switch {
+		case r.Err == ErrSkipped:
+			got[r.Change.String()] = "skipped"
+		case r.Err != nil:
+			got[r.Change.String()] = "failed"
+		default:
+			got[r.Change.String()] = "ok"
+		}
+	}
+	want := map[string]string{
+		"create org unit /Eng/Backend":                    "failed",
+		"create group new@example.com":                    "failed",
+		"create user erin@example.com [row 1]":            "ok",
+		"update user alice@example.com (orgUnit) [row 2]": "skipped",
+		"add erin@example.com to new@example.com":         "skipped",
+		"add erin@example.com to all@example.com":         "ok",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// A canceled context stops Apply.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	results, err = p.Apply(cctx, plan)
+	if err != context.Canceled {
+		t.Errorf("canceled Apply: got %v, want %v", err, context.Canceled)
+	}
+	for _, r := range results {
+		if r.Err != context.Canceled {
+			t.Errorf("%v: got %v, want %v", r.Change, r.Err, context.Canceled)
+		}
+	}
+}
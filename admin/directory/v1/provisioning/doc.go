@@ -0,0 +1,47 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package provisioning brings the users, groups and organizational units
+// of a G Suite account in line with a desired state, with the Directory
+// API (google.golang.org/api/admin/directory/v1).
+//
+// The desired state is read from a CSV file of users, with ParseCSV, or
+// from a JSON file of users, groups and organizational units, with
+// ParseJSON. A Provisioner compares it with the account and returns a
+// Plan, which can be reviewed before it is applied:
+//
+//	f, err := os.Open("users.csv")
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	defer f.Close()
+//	st, err := provisioning.ParseCSV(f)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	p := provisioning.New(svc)
+//	p.Missing = provisioning.Suspended // suspend users not in the file
+//	plan, err := p.Plan(ctx, st)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	plan.Write(os.Stdout)
+//	results, err := p.Apply(ctx, plan)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	for _, r := range results {
+//		if r.Err != nil {
+//			fmt.Printf("%v: %v\n", r.Change, r.Err)
+//		}
+//	}
+//
+// Passwords in the desired state are hashed with a salted SHA-512 crypt
+// before they leave the process, and never appear in a Plan.
+//
+// The provision command in the subdirectory of the same name wraps the
+// package for use from the shell.
+//
+// This package is experimental and subject to change without notice.
+package provisioning
@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"strconv"
+)
+
+// The lengths the Directory API accepts for plain text passwords.
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 100
+)
+
+// cryptRounds is the number of rounds of SHA-512 crypt, the default of the
+// algorithm.
+const cryptRounds = 5000
+
+// cryptAlphabet is the alphabet of crypt salts and hashes.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// hashPassword returns the password of u, hashed if it is in plain text,
+// and the name of its hash function. Users with no password get a random
+// one.
+func hashPassword(u *User) (hash, function string, err error) {
+	if u.HashFunction != "" {
+		return u.Password, u.HashFunction, nil
+	}
+	pw := u.Password
+	if pw == "" {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			return "", "", err
+		}
+		pw = base64.RawURLEncoding.EncodeToString(b)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", "", err
+	}
+	for i, c := range salt {
+		salt[i] = cryptAlphabet[c&0x3f]
+	}
+	return sha512Crypt([]byte(pw), salt, cryptRounds), "crypt", nil
+}
+
+// sha512Crypt returns the SHA-512 crypt hash of key with salt, as described
+// in https://www.akkadia.org/drepper/SHA-crypt.txt. salt is truncated to 16
+// bytes.
+func sha512Crypt(key, salt []byte, rounds int) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	b := sha512.New()
+	b.Write(key)
+	b.Write(salt)
+	b.Write(key)
+	sumB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(key)
+	a.Write(salt)
+	n := len(key)
+	for ; n > 64; n -= 64 {
+		a.Write(sumB)
+	}
+	a.Write(sumB[:n])
+	for n := len(key); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(key)
+		}
+	}
+	sumA := a.Sum(nil)
+
+	dp := sha512.New()
+	for i := 0; i < len(key); i++ {
+		dp.Write(key)
+	}
+	p := repeat(dp.Sum(nil), len(key))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(sumA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeat(ds.Sum(nil), len(salt))
+
+	sum := sumA
+	for i := 0; i < rounds; i++ {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(s)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(p)
+		}
+		sum = c.Sum(nil)
+	}
+
+	out := []byte("$6$")
+	if rounds != cryptRounds {
+		out = append(out, "rounds="+strconv.Itoa(rounds)+"$"...)
+	}
+	out = append(out, salt...)
+	out = append(out, '$')
+	for _, t := range cryptOrder {
+		out = appendCrypt64(out, uint(sum[t[0]])<<16|uint(sum[t[1]])<<8|uint(sum[t[2]]), 4)
+	}
+	return string(appendCrypt64(out, uint(sum[63]), 2))
+}
+
+// cryptOrder is the order in which SHA-512 crypt encodes the bytes of the
+// hash, three at a time. The last byte is encoded alone.
+var cryptOrder = [...][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+	{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+	{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+	{62, 20, 41},
+}
+
+// appendCrypt64 appends the n low 6-bit groups of w to b, least significant
+// first.
+func appendCrypt64(b []byte, w uint, n int) []byte {
+	for ; n > 0; n-- {
+		b = append(b, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return b
+}
+
+// repeat returns b repeated to n bytes.
+func repeat(b []byte, n int) []byte {
+	r := make([]byte, 0, n)
+	for len(r) < n {
+		m := n - len(r)
+		if m > len(b) {
+			m = len(b)
+		}
+		r = append(r, b[:m]...)
+	}
+	return r
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// From https://www.akkadia.org/drepper/SHA-crypt.txt.
+	for _, test := range []struct {
+		key, salt string
+		rounds    int
+		want      string
+	}{
+		{
+			"Hello world!", "saltstring", 5000,
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			"Hello world!", "saltstringsaltstring", 10000,
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			"a very much longer text to encrypt.  This one even stretches over morethan one line.", "anotherlongsaltstring", 1400,
+			"$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+		},
+	} {
+		if got := sha512Crypt([]byte(test.key), []byte(test.salt), test.rounds); got != test.want {
+			t.Errorf("sha512Crypt(%q, %q, %d) = %q, want %q", test.key, test.salt, test.rounds, got, test.want)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, fn, err := hashPassword(&User{Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn != "crypt" || !strings.HasPrefix(hash, "$6$") || len(hash) != 3+16+1+86 {
+		t.Errorf("got %q hash %q, want a crypt hash", fn, hash)
+	}
+	hash2, _, err := hashPassword(&User{Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash2 == hash {
+		t.Error("two hashes of the same password are equal, want different salts")
+	}
+
+	hash, fn, err = hashPassword(&User{Password: "abc", HashFunction: "MD5"})
+	if err != nil || hash != "abc" || fn != "MD5" {
+		t.Errorf("hashed password: got %q, %q, %v, want it unchanged", hash, fn, err)
+	}
+
+	if hash, _, err = hashPassword(&User{}); err != nil || !strings.HasPrefix(hash, "$6$") {
+		t.Errorf("no password: got %q, %v, want a random crypt hash", hash, err)
+	}
+}
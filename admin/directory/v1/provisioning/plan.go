@@ -0,0 +1,558 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/internal/retry"
+)
+
+const (
+	// DefaultCustomer is the customer of the account the credentials belong
+	// to.
+	DefaultCustomer = "my_customer"
+
+	// DefaultConcurrency is the default number of changes a Provisioner
+	// applies at the same time.
+	DefaultConcurrency = 10
+
+	// DefaultInterval is the default minimum time between the starts of two
+	// requests of a Provisioner applying a plan.
+	DefaultInterval = 50 * time.Millisecond
+
+	// DefaultMaxAttempts is the default number of times a Provisioner tries
+	// a change that fails with a retryable error.
+	DefaultMaxAttempts = retry.DefaultMaxAttempts
+)
+
+// An Action is a kind of change.
+type Action int
+
+// The actions, in the order they are applied.
+const (
+	CreateOrgUnit Action = iota
+	CreateGroup
+	UpdateGroup
+	CreateUser
+	UpdateUser
+	SuspendUser
+	AddMember
+	RemoveMember
+	DeleteUser
+)
+
+func (a Action) String() string {
+	switch a {
+	case CreateOrgUnit:
+		return "create org unit"
+	case CreateGroup:
+		return "create group"
+	case UpdateGroup:
+		return "update group"
+	case CreateUser:
+		return "create user"
+	case UpdateUser:
+		return "update user"
+	case SuspendUser:
+		return "suspend user"
+	case AddMember:
+		return "add member"
+	case RemoveMember:
+		return "remove member"
+	case DeleteUser:
+		return "delete user"
+	}
+	return "Action(" + strconv.Itoa(int(a)) + ")"
+}
+
+// A Change is a change to an account.
+type Change struct {
+	Action Action
+
+	// Key is the path of an organizational unit, or the email address of a
+	// user or a group. For AddMember and RemoveMember, it is the group.
+	Key string
+
+	// Member is the email address of the member of AddMember and
+	// RemoveMember.
+	Member string
+
+	// Fields are the JSON names of the fields of User or Group that
+	// UpdateUser, SuspendUser and UpdateGroup change.
+	Fields []string
+
+	// Row is the row of the user in the desired state the change comes
+	// from, as described in State.Validate, or 0 if it does not come from a
+	// user.
+	Row int
+
+	orgUnit *admin.OrgUnit
+	user    *admin.User
+	group   *admin.Group
+}
+
+// String describes c on one line. It never includes a password.
+func (c *Change) String() string {
+	var s string
+	switch c.Action {
+	case AddMember:
+		s = fmt.Sprintf("add %s to %s", c.Member, c.Key)
+	case RemoveMember:
+		s = fmt.Sprintf("remove %s from %s", c.Member, c.Key)
+	default:
+		s = c.Action.String() + " " + c.Key
+	}
+	var fields []string
+	for _, f := range c.Fields {
+		if !(c.Action == SuspendUser && f == "suspended") {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) > 0 {
+		s += " (" + strings.Join(fields, ", ") + ")"
+	}
+	if c.Row > 0 {
+		s += " [row " + strconv.Itoa(c.Row) + "]"
+	}
+	return s
+}
+
+// A Plan is a list of changes that bring an account in line with a desired
+// state.
+type Plan struct {
+	Changes []*Change
+}
+
+// Write writes the changes of p to w, one per line.
+func (p *Plan) Write(w io.Writer) error {
+	for _, c := range p.Changes {
+		if _, err := fmt.Fprintln(w, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A Provisioner plans and applies the changes that bring the users, groups
+// and organizational units of an account in line with a desired state.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Plan.
+type Provisioner struct {
+	// Customer is the ID of the customer of the account. The default is
+	// DefaultCustomer.
+	Customer string
+
+	// Domain, if set, limits the users and groups that are compared with
+	// the desired state to those of the domain.
+	Domain string
+
+	// Missing is the status given to the users that are not in the desired
+	// state: Suspended, Deleted, or the empty status to leave them as they
+	// are. Administrators are always left as they are.
+	Missing Status
+
+	// ResetPasswords makes the passwords in the desired state replace those
+	// of existing users.
+	ResetPasswords bool
+
+	// Concurrency is the maximum number of requests in flight. The default
+	// is DefaultConcurrency.
+	Concurrency int
+
+	// Interval is the minimum time between the starts of two requests
+	// applying a plan, which keeps Apply under the rate limits of the API.
+	// The default is DefaultInterval; a negative interval sets no limit.
+	Interval time.Duration
+
+	// MaxAttempts is the number of times a change that fails with a
+	// retryable error is tried before giving up. The default is
+	// DefaultMaxAttempts.
+	MaxAttempts int
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	svc *admin.Service
+}
+
+// New returns a Provisioner that uses svc.
+func New(svc *admin.Service) *Provisioner {
+	return &Provisioner{
+		Customer:    DefaultCustomer,
+		Concurrency: DefaultConcurrency,
+		Interval:    DefaultInterval,
+		MaxAttempts: DefaultMaxAttempts,
+		svc:         svc,
+	}
+}
+
+// Plan validates st and compares it with the account, and returns the
+// changes that bring the account in line with it. Organizational units are
+// never deleted, and members are removed only from the groups in
+// st.Groups.
+func (p *Provisioner) Plan(ctx context.Context, st *State) (*Plan, error) {
+	if err := st.Validate(); err != nil {
+		return nil, err
+	}
+	switch p.Missing {
+	case "", Suspended, Deleted:
+	default:
+		return nil, fmt.Errorf("provisioning: bad status %q for missing users", p.Missing)
+	}
+	users, err := p.listUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := p.listGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	if err := p.planOrgUnits(ctx, plan, st); err != nil {
+		return nil, err
+	}
+	if err := p.planUsers(plan, st, users); err != nil {
+		return nil, err
+	}
+	if err := p.planGroups(ctx, plan, st, groups); err != nil {
+		return nil, err
+	}
+	// Keep the order of rows and names within each action, and apply the
+	// actions in order.
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].Action < plan.Changes[j].Action
+	})
+	return plan, nil
+}
+
+func (p *Provisioner) planOrgUnits(ctx context.Context, plan *Plan, st *State) error {
+	want := make(map[string]bool)
+	desc := make(map[string]string)
+	for _, ou := range st.OrgUnits {
+		want[ou.Path] = true
+		desc[ou.Path] = ou.Description
+	}
+	for _, u := range st.Users {
+		if u.OrgUnit != "" && u.Status != Deleted {
+			want[u.OrgUnit] = true
+		}
+	}
+	for ou := range want {
+		for d := path.Dir(ou); d != "/"; d = path.Dir(d) {
+			want[d] = true
+		}
+	}
+	delete(want, "/")
+	if len(want) == 0 {
+		return nil
+	}
+	res, err := p.svc.Orgunits.List(p.customer()).Type("all").Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, ou := range res.OrganizationUnits {
+		have[ou.OrgUnitPath] = true
+	}
+	for _, ou := range sortedKeys(want) {
+		if have[ou] {
+			continue
+		}
+		plan.Changes = append(plan.Changes, &Change{
+			Action: CreateOrgUnit,
+			Key:    ou,
+			orgUnit: &admin.OrgUnit{
+				Name:              path.Base(ou),
+				ParentOrgUnitPath: path.Dir(ou),
+				Description:       desc[ou],
+			},
+		})
+	}
+	return nil
+}
+
+func (p *Provisioner) planUsers(plan *Plan, st *State, users map[string]*admin.User) error {
+	listed := make(map[string]bool)
+	for i, u := range st.Users {
+		listed[u.Email] = true
+		cur := users[u.Email]
+		if u.Status == Deleted {
+			if cur != nil {
+				plan.Changes = append(plan.Changes, &Change{Action: DeleteUser, Key: u.Email, Row: i + 1})
+			}
+			continue
+		}
+		var c *Change
+		var err error
+		if cur == nil {
+			c, err = p.createUser(u)
+		} else {
+			c, err = p.updateUser(u, cur)
+		}
+		if err != nil {
+			return fmt.Errorf("provisioning: row %d: %v", i+1, err)
+		}
+		if c != nil {
+			c.Row = i + 1
+			plan.Changes = append(plan.Changes, c)
+		}
+	}
+	if p.Missing == "" {
+		return nil
+	}
+	var missing []string
+	for email, u := range users {
+		if !listed[email] && !u.IsAdmin {
+			missing = append(missing, email)
+		}
+	}
+	sort.Strings(missing)
+	for _, email := range missing {
+		switch {
+		case p.Missing == Deleted:
+			plan.Changes = append(plan.Changes, &Change{Action: DeleteUser, Key: email})
+		case !users[email].Suspended:
+			plan.Changes = append(plan.Changes, &Change{
+				Action: SuspendUser,
+				Key:    email,
+				Fields: []string{"suspended"},
+				user:   &admin.User{Suspended: true},
+			})
+		}
+	}
+	return nil
+}
+
+func (p *Provisioner) createUser(u *User) (*Change, error) {
+	if u.GivenName == "" || u.FamilyName == "" {
+		return nil, fmt.Errorf("user %s needs a given and a family name to be created", u.Email)
+	}
+	hash, fn, err := hashPassword(u)
+	if err != nil {
+		return nil, err
+	}
+	return &Change{
+		Action: CreateUser,
+		Key:    u.Email,
+		user: &admin.User{
+			PrimaryEmail:              u.Email,
+			Name:                      &admin.UserName{GivenName: u.GivenName, FamilyName: u.FamilyName},
+			OrgUnitPath:               u.OrgUnit,
+			Password:                  hash,
+			HashFunction:              fn,
+			ChangePasswordAtNextLogin: u.ChangePasswordAtNextLogin,
+			Suspended:                 u.Status == Suspended,
+		},
+	}, nil
+}
+
+// updateUser returns the change that brings cur in line with u, or nil if
+// they agree.
+func (p *Provisioner) updateUser(u *User, cur *admin.User) (*Change, error) {
+	c := &Change{Action: UpdateUser, Key: u.Email, user: &admin.User{}}
+	name := admin.UserName{}
+	if cur.Name != nil {
+		name.GivenName, name.FamilyName = cur.Name.GivenName, cur.Name.FamilyName
+	}
+	if u.GivenName != "" && u.GivenName != name.GivenName {
+		c.Fields = append(c.Fields, "givenName")
+		name.GivenName = u.GivenName
+	}
+	if u.FamilyName != "" && u.FamilyName != name.FamilyName {
+		c.Fields = append(c.Fields, "familyName")
+		name.FamilyName = u.FamilyName
+	}
+	if len(c.Fields) > 0 {
+		// The name is patched as a whole.
+		c.user.Name = &name
+	}
+	if u.OrgUnit != "" && u.OrgUnit != cur.OrgUnitPath {
+		c.Fields = append(c.Fields, "orgUnit")
+		c.user.OrgUnitPath = u.OrgUnit
+	}
+	if suspended := u.Status == Suspended; suspended != cur.Suspended {
+		c.Fields = append(c.Fields, "suspended")
+		c.user.Suspended = suspended
+		c.user.ForceSendFields = append(c.user.ForceSendFields, "Suspended")
+		if suspended {
+			c.Action = SuspendUser
+		}
+	}
+	if p.ResetPasswords && u.Password != "" {
+		hash, fn, err := hashPassword(u)
+		if err != nil {
+			return nil, err
+		}
+		c.Fields = append(c.Fields, "password")
+		c.user.Password, c.user.HashFunction = hash, fn
+		c.user.ChangePasswordAtNextLogin = u.ChangePasswordAtNextLogin
+	}
+	if len(c.Fields) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func (p *Provisioner) planGroups(ctx context.Context, plan *Plan, st *State, groups map[string]*admin.Group) error {
+	managed := make(map[string]*Group)
+	want := make(map[string]map[string]bool) // group to members
+	var emails []string
+	member := func(g, m string) {
+		if want[g] == nil {
+			want[g] = make(map[string]bool)
+			emails = append(emails, g)
+		}
+		if m != "" {
+			want[g][m] = true
+		}
+	}
+	for _, g := range st.Groups {
+		managed[g.Email] = g
+		member(g.Email, "")
+		for _, m := range g.Members {
+			member(g.Email, m)
+		}
+	}
+	for _, u := range st.Users {
+		if u.Status == Deleted {
+			continue
+		}
+		for _, g := range u.Groups {
+			member(g, u.Email)
+		}
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		g, cur := managed[email], groups[email]
+		have := make(map[string]bool)
+		switch {
+		case cur == nil:
+			ag := &admin.Group{Email: email}
+			if g != nil {
+				ag.Name, ag.Description = g.Name, g.Description
+			}
+			plan.Changes = append(plan.Changes, &Change{Action: CreateGroup, Key: email, group: ag})
+		default:
+			if g != nil {
+				if c := updateGroup(g, cur); c != nil {
+					plan.Changes = append(plan.Changes, c)
+				}
+			}
+			var err error
+			if have, err = p.listMembers(ctx, email); err != nil {
+				return err
+			}
+		}
+		for _, m := range sortedKeys(want[email]) {
+			if !have[m] {
+				plan.Changes = append(plan.Changes, &Change{Action: AddMember, Key: email, Member: m})
+			}
+		}
+		if g == nil {
+			continue
+		}
+		for _, m := range sortedKeys(have) {
+			if !want[email][m] {
+				plan.Changes = append(plan.Changes, &Change{Action: RemoveMember, Key: email, Member: m})
+			}
+		}
+	}
+	return nil
+}
+
+// updateGroup returns the change that brings cur in line with g, or nil if
+// they agree.
+func updateGroup(g *Group, cur *admin.Group) *Change {
+	c := &Change{Action: UpdateGroup, Key: g.Email, group: &admin.Group{}}
+	if g.Name != "" && g.Name != cur.Name {
+		c.Fields = append(c.Fields, "name")
+		c.group.Name = g.Name
+	}
+	if g.Description != "" && g.Description != cur.Description {
+		c.Fields = append(c.Fields, "description")
+		c.group.Description = g.Description
+	}
+	if len(c.Fields) == 0 {
+		return nil
+	}
+	return c
+}
+
+func (p *Provisioner) customer() string {
+	if p.Customer == "" {
+		return DefaultCustomer
+	}
+	return p.Customer
+}
+
+// listUsers returns the users of the account by primary email address.
+func (p *Provisioner) listUsers(ctx context.Context) (map[string]*admin.User, error) {
+	call := p.svc.Users.List().MaxResults(500)
+	if p.Domain != "" {
+		call.Domain(p.Domain)
+	} else {
+		call.Customer(p.customer())
+	}
+	users := make(map[string]*admin.User)
+	err := call.Pages(ctx, func(res *admin.Users) error {
+		for _, u := range res.Users {
+			users[strings.ToLower(u.PrimaryEmail)] = u
+		}
+		return nil
+	})
+	return users, err
+}
+
+// listGroups returns the groups of the account by email address.
+func (p *Provisioner) listGroups(ctx context.Context) (map[string]*admin.Group, error) {
+	call := p.svc.Groups.List().MaxResults(200)
+	if p.Domain != "" {
+		call.Domain(p.Domain)
+	} else {
+		call.Customer(p.customer())
+	}
+	groups := make(map[string]*admin.Group)
+	err := call.Pages(ctx, func(res *admin.Groups) error {
+		for _, g := range res.Groups {
+			groups[strings.ToLower(g.Email)] = g
+		}
+		return nil
+	})
+	return groups, err
+}
+
+// listMembers returns the email addresses of the direct members of a group.
+func (p *Provisioner) listMembers(ctx context.Context, group string) (map[string]bool, error) {
+	members := make(map[string]bool)
+	err := p.svc.Members.List(group).MaxResults(200).Pages(ctx, func(res *admin.Members) error {
+		for _, m := range res.Members {
+			if m.Email != "" {
+				members[strings.ToLower(m.Email)] = true
+			}
+		}
+		return nil
+	})
+	return members, err
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
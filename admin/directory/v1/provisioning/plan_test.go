@@ -0,0 +1,345 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeDirectory serves the users, groups and organizational units of
+// customer "my_customer". Requests whose method and path are in errs fail
+// with the listed status codes, in turn, before they succeed.
+type fakeDirectory struct {
+	mu       sync.Mutex
+	users    map[string]*admin.User
+	groups   map[string]*admin.Group
+	members  map[string]map[string]bool
+	orgUnits map[string]bool
+	errs     map[string][]int
+}
+
+func newFakeDirectory() *fakeDirectory {
+	f := &fakeDirectory{
+		users:    make(map[string]*admin.User),
+		groups:   make(map[string]*admin.Group),
+		members:  make(map[string]map[string]bool),
+		orgUnits: map[string]bool{"/": true, "/Eng": true, "/Sales": true},
+		errs:     make(map[string][]int),
+	}
+	for _, u := range []*admin.User{
+		{PrimaryEmail: "alice@example.com", Name: &admin.UserName{GivenName: "Alice", FamilyName: "Smith"}, OrgUnitPath: "/Eng"},
+		{PrimaryEmail: "bob@example.com", Name: &admin.UserName{GivenName: "Bob", FamilyName: "Jones"}, OrgUnitPath: "/Sales"},
+		{PrimaryEmail: "carol@example.com", Name: &admin.UserName{GivenName: "Carol", FamilyName: "White"}, OrgUnitPath: "/"},
+		{PrimaryEmail: "dave@example.com", Name: &admin.UserName{GivenName: "Dave", FamilyName: "Brown"}, OrgUnitPath: "/"},
+		{PrimaryEmail: "root@example.com", Name: &admin.UserName{GivenName: "Root", FamilyName: "Admin"}, OrgUnitPath: "/", IsAdmin: true},
+	} {
+		f.users[u.PrimaryEmail] = u
+	}
+	f.groups["eng@example.com"] = &admin.Group{Email: "eng@example.com", Name: "eng"}
+	f.groups["all@example.com"] = &admin.Group{Email: "all@example.com", Name: "All"}
+	f.members["eng@example.com"] = map[string]bool{"alice@example.com": true, "old@example.com": true}
+	f.members["all@example.com"] = map[string]bool{"bob@example.com": true}
+	return f
+}
+
+func (f *fakeDirectory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req := r.Method + " " + r.URL.Path
+	if codes := f.errs[req]; len(codes) > 0 {
+		f.errs[req] = codes[1:]
+		reason := "invalid"
+		if codes[0] == http.StatusForbidden {
+			reason = "userRateLimitExceeded"
+		}
+		writeError(w, codes[0], reason)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var resp interface{}
+	switch {
+	case req == "GET /users":
+		if r.URL.Query().Get("customer") != "my_customer" {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		res := &admin.Users{}
+		for _, k := range fakeKeys(f.users) {
+			res.Users = append(res.Users, f.users[k])
+		}
+		resp = res
+	case req == "POST /users":
+		var u admin.User
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		if f.users[u.PrimaryEmail] != nil {
+			writeError(w, http.StatusConflict, "duplicate")
+			return
+		}
+		if !f.orgUnits[orgUnitOrRoot(u.OrgUnitPath)] {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		f.users[u.PrimaryEmail] = &u
+		resp = &u
+	case r.Method == "PATCH" && len(parts) == 2 && parts[0] == "users":
+		u := f.users[parts[1]]
+		if u == nil {
+			writeError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		var patch struct {
+			Name         *admin.UserName
+			OrgUnitPath  string
+			Suspended    *bool
+			Password     string
+			HashFunction string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		if patch.Name != nil {
+			u.Name = patch.Name
+		}
+		if patch.OrgUnitPath != "" {
+			u.OrgUnitPath = patch.OrgUnitPath
+		}
+		if patch.Suspended != nil {
+			u.Suspended = *patch.Suspended
+		}
+		if patch.Password != "" {
+			u.Password, u.HashFunction = patch.Password, patch.HashFunction
+		}
+		resp = u
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "users":
+		if f.users[parts[1]] == nil {
+			writeError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		delete(f.users, parts[1])
+		for _, m := range f.members {
+			delete(m, parts[1])
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case req == "GET /groups":
+		res := &admin.Groups{}
+		for _, k := range fakeKeys(f.groups) {
+			res.Groups = append(res.Groups, f.groups[k])
+		}
+		resp = res
+	case req == "POST /groups":
+		var g admin.Group
+		if err := json.NewDecoder(r.Body).Decode(&g); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		f.groups[g.Email] = &g
+		f.members[g.Email] = make(map[string]bool)
+		resp = &g
+	case r.Method == "PATCH" && len(parts) == 2 && parts[0] == "groups":
+		g := f.groups[parts[1]]
+		if g == nil {
+			writeError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		var patch admin.Group
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		if patch.Name != "" {
+			g.Name = patch.Name
+		}
+		if patch.Description != "" {
+			g.Description = patch.Description
+		}
+		resp = g
+	case len(parts) >= 3 && parts[0] == "groups" && parts[2] == "members":
+		members := f.members[parts[1]]
+		if members == nil {
+			writeError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		switch {
+		case r.Method == "GET" && len(parts) == 3:
+			res := &admin.Members{}
+			for _, k := range fakeKeys(members) {
+				res.Members = append(res.Members, &admin.Member{Email: k, Role: "MEMBER"})
+			}
+			resp = res
+		case r.Method == "POST" && len(parts) == 3:
+			var m admin.Member
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid")
+				return
+			}
+			if members[m.Email] {
+				writeError(w, http.StatusConflict, "duplicate")
+				return
+			}
+			members[m.Email] = true
+			resp = &m
+		case r.Method == "DELETE" && len(parts) == 4:
+			if !members[parts[3]] {
+				writeError(w, http.StatusNotFound, "notFound")
+				return
+			}
+			delete(members, parts[3])
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			writeError(w, http.StatusNotFound, "notFound")
+			return
+		}
+	case req == "GET /customer/my_customer/orgunits":
+		res := &admin.OrgUnits{}
+		for _, k := range fakeKeys(f.orgUnits) {
+			if k != "/" {
+				res.OrganizationUnits = append(res.OrganizationUnits, &admin.OrgUnit{OrgUnitPath: k})
+			}
+		}
+		resp = res
+	case req == "POST /customer/my_customer/orgunits":
+		var ou admin.OrgUnit
+		if err := json.NewDecoder(r.Body).Decode(&ou); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		if !f.orgUnits[ou.ParentOrgUnitPath] {
+			writeError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		ou.OrgUnitPath = strings.TrimSuffix(ou.ParentOrgUnitPath, "/") + "/" + ou.Name
+		f.orgUnits[ou.OrgUnitPath] = true
+		resp = &ou
+	default:
+		writeError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeError(w http.ResponseWriter, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": reason,
+			"errors":  []map[string]string{{"reason": reason, "message": reason}},
+		},
+	})
+}
+
+func orgUnitOrRoot(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// fakeKeys returns the keys of the maps of fakeDirectory in order.
+func fakeKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*admin.User:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*admin.Group:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]bool:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func testState() *State {
+	return &State{
+		OrgUnits: []*OrgUnit{{Path: "/Eng/Backend/", Description: "Backend"}},
+		Users: []*User{
+			{Email: "alice@example.com", GivenName: "Alice", FamilyName: "Smith", OrgUnit: "/Eng/Backend", Groups: []string{"eng@example.com", "all@example.com"}},
+			{Email: "Bob@example.com", GivenName: "Bob", FamilyName: "Johnson", Status: Suspended},
+			{Email: "erin@example.com", GivenName: "Erin", FamilyName: "Lee", OrgUnit: "/Eng/Backend", Password: "correct horse", Groups: []string{"eng@example.com", "new@example.com"}},
+			{Email: "dave@example.com", Status: Deleted},
+		},
+		Groups: []*Group{{Email: "eng@example.com", Name: "Engineering", Members: []string{"ci@example.com"}}},
+	}
+}
+
+const testPlan = `create org unit /Eng/Backend
+create group new@example.com
+update group eng@example.com (name)
+create user erin@example.com [row 3]
+update user alice@example.com (orgUnit) [row 1]
+suspend user bob@example.com (familyName) [row 2]
+suspend user carol@example.com
+add alice@example.com to all@example.com
+add ci@example.com to eng@example.com
+add erin@example.com to eng@example.com
+add erin@example.com to new@example.com
+remove old@example.com from eng@example.com
+delete user dave@example.com [row 4]
+`
+
+func TestPlan(t *testing.T) {
+	svc, done := testserver.NewService(t, newFakeDirectory(), admin.NewService)
+	defer done()
+	p := New(svc.(*admin.Service))
+	p.Missing = Suspended
+	plan, err := p.Plan(context.Background(), testState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := plan.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(testPlan, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	for _, c := range plan.Changes {
+		if c.Action != CreateUser {
+			continue
+		}
+		if u := c.user; u.HashFunction != "crypt" || !strings.HasPrefix(u.Password, "$6$") || u.OrgUnitPath != "/Eng/Backend" {
+			t.Errorf("got new user %+v, want a crypt password in /Eng/Backend", u)
+		}
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	svc, done := testserver.NewService(t, newFakeDirectory(), admin.NewService)
+	defer done()
+	p := New(svc.(*admin.Service))
+	ctx := context.Background()
+	st := &State{Users: []*User{{Email: "new@example.com", GivenName: "New"}}}
+	if _, err := p.Plan(ctx, st); err == nil || !strings.Contains(err.Error(), "row 1") {
+		t.Errorf("new user with no family name: got %v, want an error about row 1", err)
+	}
+	p.Missing = Active
+	if _, err := p.Plan(ctx, &State{}); err == nil {
+		t.Error("active missing users: got nil error")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Provision brings the users, groups and organizational units of a G Suite
+// account in line with a CSV or JSON desired-state file, as described in
+// package google.golang.org/api/admin/directory/v1/provisioning.
+//
+// Usage:
+//
+//	provision [flags] users.csv
+//
+// Provision prints the plan of changes, and applies it only with -apply.
+// With -apply, it prints the result of each change and exits with status 1
+// if any change failed.
+//
+// A service account key given with -credentials must have domain-wide
+// delegation, and -subject must name an administrator to act as. Without
+// -credentials, the application default credentials are used.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/admin/directory/v1/provisioning"
+	"google.golang.org/api/option"
+)
+
+// Flags
+var (
+	format         = flag.String("format", "", "format of the desired-state file, csv or json; the default comes from its extension")
+	customer       = flag.String("customer", provisioning.DefaultCustomer, "ID of the customer of the account")
+	domain         = flag.String("domain", "", "compare only the users and groups of this domain")
+	missing        = flag.String("missing", "", "what to do with users not in the file: suspend, delete, or nothing if empty")
+	resetPasswords = flag.Bool("reset-passwords", false, "set the passwords in the file on existing users")
+	apply          = flag.Bool("apply", false, "apply the plan instead of only printing it")
+	concurrency    = flag.Int("concurrency", provisioning.DefaultConcurrency, "maximum number of requests in flight")
+	interval       = flag.Duration("interval", provisioning.DefaultInterval, "minimum time between the starts of two requests")
+	credentials    = flag.String("credentials", "", "service account key file")
+	subject        = flag.String("subject", "", "email address of the administrator the service account acts as")
+)
+
+var scopes = []string{
+	admin.AdminDirectoryUserScope,
+	admin.AdminDirectoryGroupScope,
+	admin.AdminDirectoryOrgunitScope,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: provision [flags] <desired-state file>\n\nFlags:\n\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("provision: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+
+	st, err := readState(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	svc, err := newService(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := provisioning.New(svc)
+	p.Customer = *customer
+	p.Domain = *domain
+	p.ResetPasswords = *resetPasswords
+	p.Concurrency = *concurrency
+	p.Interval = *interval
+	switch *missing {
+	case "":
+	case "suspend":
+		p.Missing = provisioning.Suspended
+	case "delete":
+		p.Missing = provisioning.Deleted
+	default:
+		log.Fatalf("bad -missing %q: want suspend or delete", *missing)
+	}
+
+	plan, err := p.Plan(ctx, st)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+	if err := plan.Write(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if !*apply {
+		return
+	}
+
+	fmt.Println()
+	results, err := p.Apply(ctx, plan)
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("FAIL %v: %v\n", r.Change, r.Err)
+		} else {
+			fmt.Printf("ok   %v\n", r.Change)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d changes failed", failed, len(results))
+	}
+}
+
+// readState reads the desired state from the file with the given name.
+func readState(name string) (*provisioning.State, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ft := *format
+	if ft == "" {
+		ft = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	}
+	switch ft {
+	case "csv":
+		return provisioning.ParseCSV(f)
+	case "json":
+		return provisioning.ParseJSON(f)
+	}
+	return nil, fmt.Errorf("unknown format of %s; use -format", name)
+}
+
+// newService returns a Directory API service authorized by the flags.
+func newService(ctx context.Context) (*admin.Service, error) {
+	if *credentials == "" {
+		if *subject != "" {
+			return nil, fmt.Errorf("-subject needs -credentials")
+		}
+		return admin.NewService(ctx, option.WithScopes(scopes...))
+	}
+	data, err := ioutil.ReadFile(*credentials)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := google.JWTConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	conf.Subject = *subject
+	return admin.NewService(ctx, option.WithTokenSource(conf.TokenSource(ctx)))
+}
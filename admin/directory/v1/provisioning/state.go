@@ -0,0 +1,312 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A Status is the desired status of a user.
+type Status string
+
+const (
+	// Active users can sign in. It is the status of users with no status.
+	Active Status = "active"
+
+	// Suspended users exist but cannot sign in.
+	Suspended Status = "suspended"
+
+	// Deleted users are deleted if they exist.
+	Deleted Status = "deleted"
+)
+
+// State is the desired state of an account.
+type State struct {
+	// OrgUnits are the organizational units to create if they do not
+	// exist. The organizational units of Users are created too, so they
+	// need not be listed.
+	OrgUnits []*OrgUnit `json:"orgUnits,omitempty"`
+
+	// Users are the users to create, update, suspend or delete.
+	Users []*User `json:"users,omitempty"`
+
+	// Groups are the groups whose membership is managed. A managed group
+	// has as members exactly its Members and the users that list it in
+	// their Groups; other members are removed. Groups that are listed only
+	// in the Groups of users are created if they do not exist, but their
+	// other members are kept.
+	Groups []*Group `json:"groups,omitempty"`
+}
+
+// An OrgUnit is an organizational unit.
+type OrgUnit struct {
+	// Path is the full path of the organizational unit, as in
+	// "/Engineering/Backend".
+	Path string `json:"path"`
+
+	// Description is the description of a new organizational unit.
+	Description string `json:"description,omitempty"`
+}
+
+// A User is the desired state of a user. Empty fields of existing users
+// are left as they are.
+type User struct {
+	// Email is the primary email address of the user. It is required.
+	Email string `json:"email"`
+
+	// GivenName and FamilyName are the names of the user. They are required
+	// to create a user.
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+
+	// OrgUnit is the path of the organizational unit of the user. New users
+	// with no organizational unit go in the root one.
+	OrgUnit string `json:"orgUnit,omitempty"`
+
+	// Password is the password of a new user, in plain text unless
+	// HashFunction is set. It is set on existing users only if the
+	// Provisioner's ResetPasswords is set. New users with no password get a
+	// random one, which suits accounts that sign in with SSO.
+	Password string `json:"password,omitempty"`
+
+	// HashFunction is the function Password is already hashed with: "SHA-1",
+	// "MD5" or "crypt". If it is empty, the password is hashed before it is
+	// sent.
+	HashFunction string `json:"hashFunction,omitempty"`
+
+	// ChangePasswordAtNextLogin makes the user change a password that is
+	// set.
+	ChangePasswordAtNextLogin bool `json:"changePasswordAtNextLogin,omitempty"`
+
+	// Status is the desired status of the user. The default is Active.
+	Status Status `json:"status,omitempty"`
+
+	// Groups are the email addresses of the groups the user is a member of.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// A Group is a group whose membership is managed.
+type Group struct {
+	// Email is the email address of the group. It is required.
+	Email string `json:"email"`
+
+	// Name and Description are set on the group if they are not empty.
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Members are the email addresses of the members of the group, in
+	// addition to the users that list it in their Groups. They may be other
+	// groups or addresses outside the account.
+	Members []string `json:"members,omitempty"`
+}
+
+// csvColumns are the columns of a CSV file, in lower case.
+var csvColumns = map[string]bool{
+	"email":                     true,
+	"givenname":                 true,
+	"familyname":                true,
+	"orgunit":                   true,
+	"password":                  true,
+	"hashfunction":              true,
+	"changepasswordatnextlogin": true,
+	"status":                    true,
+	"groups":                    true,
+}
+
+// ParseCSV reads the users of a State from a CSV file. The first record
+// names the columns, which are the JSON names of the fields of User, in
+// any case and any order. Only the email column is required. The groups
+// column holds email addresses separated by semicolons.
+func ParseCSV(r io.Reader) (*State, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("provisioning: empty CSV file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("provisioning: %v", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if !csvColumns[h] {
+			return nil, fmt.Errorf("provisioning: unknown CSV column %q", header[i])
+		}
+		if _, ok := cols[h]; ok {
+			return nil, fmt.Errorf("provisioning: duplicate CSV column %q", header[i])
+		}
+		cols[h] = i
+	}
+	if _, ok := cols["email"]; !ok {
+		return nil, errors.New("provisioning: CSV file has no email column")
+	}
+	st := &State{}
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("provisioning: %v", err)
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		u := &User{
+			Email:        field("email"),
+			GivenName:    field("givenname"),
+			FamilyName:   field("familyname"),
+			OrgUnit:      field("orgunit"),
+			Password:     field("password"),
+			HashFunction: field("hashfunction"),
+			Status:       Status(strings.ToLower(field("status"))),
+		}
+		if v := field("changepasswordatnextlogin"); v != "" {
+			if u.ChangePasswordAtNextLogin, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("provisioning: row %d: bad changePasswordAtNextLogin %q", row, v)
+			}
+		}
+		for _, g := range strings.Split(field("groups"), ";") {
+			if g = strings.TrimSpace(g); g != "" {
+				u.Groups = append(u.Groups, g)
+			}
+		}
+		st.Users = append(st.Users, u)
+	}
+	if err := st.Validate(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// ParseJSON reads a State from a JSON file.
+func ParseJSON(r io.Reader) (*State, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	st := &State{}
+	if err := dec.Decode(st); err != nil {
+		return nil, fmt.Errorf("provisioning: %v", err)
+	}
+	if err := st.Validate(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Validate checks that st is a valid desired state, and puts its email
+// addresses in lower case and its paths in canonical form. Errors about
+// users give their row, the 1-based index of the user in Users, which is
+// also the line of the user in a CSV file without line breaks in fields,
+// not counting the header.
+func (st *State) Validate() error {
+	ous := make(map[string]bool)
+	for _, ou := range st.OrgUnits {
+		p, err := cleanPath(ou.Path)
+		if err != nil {
+			return fmt.Errorf("provisioning: %v", err)
+		}
+		if ous[p] {
+			return fmt.Errorf("provisioning: duplicate organizational unit %q", p)
+		}
+		ous[p] = true
+		ou.Path = p
+	}
+	users := make(map[string]bool)
+	for i, u := range st.Users {
+		if err := u.validate(); err != nil {
+			return fmt.Errorf("provisioning: row %d: %v", i+1, err)
+		}
+		if users[u.Email] {
+			return fmt.Errorf("provisioning: row %d: duplicate user %s", i+1, u.Email)
+		}
+		users[u.Email] = true
+	}
+	groups := make(map[string]bool)
+	for _, g := range st.Groups {
+		email, err := cleanEmail(g.Email)
+		if err != nil {
+			return fmt.Errorf("provisioning: group: %v", err)
+		}
+		if groups[email] {
+			return fmt.Errorf("provisioning: duplicate group %s", email)
+		}
+		groups[email] = true
+		g.Email = email
+		for j, m := range g.Members {
+			if g.Members[j], err = cleanEmail(m); err != nil {
+				return fmt.Errorf("provisioning: group %s: member: %v", email, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (u *User) validate() error {
+	var err error
+	if u.Email, err = cleanEmail(u.Email); err != nil {
+		return err
+	}
+	if u.OrgUnit != "" {
+		if u.OrgUnit, err = cleanPath(u.OrgUnit); err != nil {
+			return err
+		}
+	}
+	switch u.Status {
+	case "":
+		u.Status = Active
+	case Active, Suspended, Deleted:
+	default:
+		return fmt.Errorf("bad status %q", u.Status)
+	}
+	switch u.HashFunction {
+	case "":
+		if u.Password != "" && (len(u.Password) < minPasswordLen || len(u.Password) > maxPasswordLen) {
+			return fmt.Errorf("password of %s must have %d to %d characters", u.Email, minPasswordLen, maxPasswordLen)
+		}
+	case "SHA-1", "MD5", "crypt":
+		if u.Password == "" {
+			return fmt.Errorf("hash function %s with no password", u.HashFunction)
+		}
+	default:
+		return fmt.Errorf("bad hash function %q", u.HashFunction)
+	}
+	for i, g := range u.Groups {
+		if u.Groups[i], err = cleanEmail(g); err != nil {
+			return fmt.Errorf("group: %v", err)
+		}
+	}
+	return nil
+}
+
+// cleanEmail returns email in lower case, or an error if it is not an email
+// address.
+func cleanEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if i := strings.Index(email, "@"); i <= 0 || i == len(email)-1 || strings.ContainsAny(email, " \t,;") {
+		return "", fmt.Errorf("bad email address %q", email)
+	}
+	return email, nil
+}
+
+// cleanPath returns p in canonical form, or an error if it is not the path
+// of an organizational unit.
+func cleanPath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("organizational unit %q is not a full path", p)
+	}
+	return path.Clean(p), nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCSV(t *testing.T) {
+	const in = `Email, GivenName, FamilyName, OrgUnit, Password, ChangePasswordAtNextLogin, Status, Groups
+Alice@Example.com, Alice, Smith, /Eng/, correct horse, true, , eng@example.com; All@example.com
+bob@example.com, Bob, Jones, , , , SUSPENDED,
+`
+	got, err := ParseCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &State{Users: []*User{
+		{
+			Email:                     "alice@example.com",
+			GivenName:                 "Alice",
+			FamilyName:                "Smith",
+			OrgUnit:                   "/Eng",
+			Password:                  "correct horse",
+			ChangePasswordAtNextLogin: true,
+			Status:                    Active,
+			Groups:                    []string{"eng@example.com", "all@example.com"},
+		},
+		{Email: "bob@example.com", GivenName: "Bob", FamilyName: "Jones", Status: Suspended},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	const in = `{
+  "orgUnits": [{"path": "/Eng/Backend", "description": "Backend"}],
+  "users": [{"email": "alice@example.com", "hashFunction": "SHA-1", "password": "0a4d55a8d778e5022fab701977c5d840bbc486d0", "status": "deleted"}],
+  "groups": [{"email": "Eng@example.com", "name": "Engineering", "members": ["CI@example.com"]}]
+}`
+	got, err := ParseJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &State{
+		OrgUnits: []*OrgUnit{{Path: "/Eng/Backend", Description: "Backend"}},
+		Users:    []*User{{Email: "alice@example.com", HashFunction: "SHA-1", Password: "0a4d55a8d778e5022fab701977c5d840bbc486d0", Status: Deleted}},
+		Groups:   []*Group{{Email: "eng@example.com", Name: "Engineering", Members: []string{"ci@example.com"}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"name\nalice\n",
+		"email,email\na@example.com,a@example.com\n",
+		"givenName\nAlice\n",
+		"email\nalice\n",
+		"email\na@example.com\nA@example.com\n",
+		"email,status\na@example.com,gone\n",
+		"email,orgUnit\na@example.com,Eng\n",
+		"email,password\na@example.com,short\n",
+		"email,hashFunction\na@example.com,SHA-1\n",
+		"email,password,hashFunction\na@example.com,x,bcrypt\n",
+		"email,changePasswordAtNextLogin\na@example.com,maybe\n",
+		"email,groups\na@example.com,eng\n",
+	} {
+		if _, err := ParseCSV(strings.NewReader(in)); err == nil {
+			t.Errorf("CSV %q: got nil error", in)
+		}
+	}
+	for _, in := range []string{
+		`{"users": [{"email": "a@example.com", "name": "A"}]}`,
+		`{"orgUnits": [{"path": "/Eng"}, {"path": "/Eng/"}]}`,
+		`{"groups": [{"email": "g@example.com", "members": ["x"]}]}`,
+	} {
+		if _, err := ParseJSON(strings.NewReader(in)); err == nil {
+			t.Errorf("JSON %q: got nil error", in)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+// Canonical layouts of the civil types.
+const (
+	dateLayout     = "2006-01-02"
+	timeLayout     = "15:04:05.999999"
+	dateTimeLayout = "2006-01-02T15:04:05.999999"
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	ratType   = reflect.TypeOf(big.Rat{})
+	bytesType = reflect.TypeOf([]byte(nil))
+	mapType   = reflect.TypeOf(map[string]interface{}(nil))
+)
+
+// Decode stores rows, which have the given schema, in dst.
+//
+// dst must be a pointer to a slice whose elements are structs, pointers to
+// structs, or map[string]interface{}. The slice is replaced by one element
+// per row.
+//
+// Values are converted according to the column type. In maps and
+// interface{} fields, the values are
+//
+//	INT64                     int64
+//	FLOAT64                   float64
+//	NUMERIC, BIGNUMERIC       *big.Rat
+//	BOOL                      bool
+//	STRING, GEOGRAPHY         string
+//	BYTES                     []byte
+//	TIMESTAMP                 time.Time, in UTC
+//	DATE, TIME, DATETIME      string, in canonical form such as "2006-01-02",
+//	                          "15:04:05.999999" or "2006-01-02T15:04:05.999999"
+//	STRUCT (RECORD)           map[string]interface{}
+//	REPEATED                  []interface{}
+//	NULL                      nil
+//
+// Struct fields may be of those types or of compatible ones: any integer or
+// floating-point type for numbers (integers must fit), float64 for NUMERIC,
+// time.Time for DATE and DATETIME (interpreted in UTC), a string for any
+// non-struct type (timestamps are formatted with time.RFC3339Nano), a nested
+// struct or map for STRUCT, and a slice for REPEATED. Pointer fields are set
+// to nil for NULL; other fields are left at their zero value.
+func Decode(schema *bigquery.TableSchema, rows []*bigquery.TableRow, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("bigqueryutil: Decode needs a non-nil pointer to a slice, got %T", dst)
+	}
+	slice := rv.Elem()
+	et := slice.Type().Elem()
+	if !(et == mapType || et.Kind() == reflect.Struct || (et.Kind() == reflect.Ptr && et.Elem().Kind() == reflect.Struct)) {
+		return fmt.Errorf("bigqueryutil: cannot decode rows into elements of type %v", et)
+	}
+	out := reflect.MakeSlice(slice.Type(), len(rows), len(rows))
+	for i, row := range rows {
+		ev := out.Index(i)
+		if et.Kind() == reflect.Ptr {
+			ev.Set(reflect.New(et.Elem()))
+			ev = ev.Elem()
+		}
+		if err := decodeRow(schema.Fields, row, ev); err != nil {
+			return fmt.Errorf("bigqueryutil: row %d: %v", i, err)
+		}
+	}
+	slice.Set(out)
+	return nil
+}
+
+// DecodeRow stores row, which has the given schema, in dst, which must be a
+// pointer to a struct or a non-nil map[string]interface{}. See Decode for how
+// values are converted.
+func DecodeRow(schema *bigquery.TableSchema, row *bigquery.TableRow, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type() == mapType && !rv.IsNil():
+	case rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct:
+		rv = rv.Elem()
+	default:
+		return fmt.Errorf("bigqueryutil: DecodeRow needs a pointer to a struct or a map[string]interface{}, got %T", dst)
+	}
+	if err := decodeRow(schema.Fields, row, rv); err != nil {
+		return fmt.Errorf("bigqueryutil: %v", err)
+	}
+	return nil
+}
+
+func decodeRow(schema []*bigquery.TableFieldSchema, row *bigquery.TableRow, dst reflect.Value) error {
+	cells := make([]interface{}, len(row.F))
+	for i, c := range row.F {
+		if c != nil {
+			cells[i] = c.V
+		}
+	}
+	return decodeRecord(schema, cells, dst)
+}
+
+// decodeRecord decodes the cell values of a row or STRUCT into dst, which is
+// a struct or a map[string]interface{}.
+func decodeRecord(schema []*bigquery.TableFieldSchema, cells []interface{}, dst reflect.Value) error {
+	if len(cells) > len(schema) {
+		return fmt.Errorf("got %d values for %d columns", len(cells), len(schema))
+	}
+	if dst.Kind() == reflect.Map {
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		m := dst.Interface().(map[string]interface{})
+		for i, f := range schema {
+			var cell interface{}
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			v, err := naturalField(f, cell)
+			if err != nil {
+				return err
+			}
+			m[f.Name] = v
+		}
+		return nil
+	}
+	fields := structFields(dst.Type())
+	for i, cell := range cells {
+		f := fieldByName(fields, schema[i].Name)
+		if f == nil {
+			continue
+		}
+		if err := decodeField(dst.Field(f.index), schema[i], cell); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeField decodes cell, the value of column f, into dst.
+func decodeField(dst reflect.Value, f *bigquery.TableFieldSchema, cell interface{}) error {
+	if cell == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if f.Mode != "REPEATED" {
+		if err := decodeValue(dst, f, cell); err != nil {
+			return fmt.Errorf("column %q: %v", f.Name, err)
+		}
+		return nil
+	}
+	if isEmptyInterface(dst) {
+		v, err := naturalField(f, cell)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	elems, ok := cell.([]interface{})
+	if !ok {
+		return fmt.Errorf("column %q: repeated value is %T, not a list", f.Name, cell)
+	}
+	if dst.Kind() != reflect.Slice || dst.Type() == bytesType {
+		return fmt.Errorf("column %q: cannot store a repeated value in %v", f.Name, dst.Type())
+	}
+	s := reflect.MakeSlice(dst.Type(), len(elems), len(elems))
+	for i, e := range elems {
+		if err := decodeValue(s.Index(i), f, listValue(e)); err != nil {
+			return fmt.Errorf("column %q, element %d: %v", f.Name, i, err)
+		}
+	}
+	dst.Set(s)
+	return nil
+}
+
+// decodeValue decodes cell, a single (non-repeated) value of column f, into
+// dst.
+func decodeValue(dst reflect.Value, f *bigquery.TableFieldSchema, cell interface{}) error {
+	if cell == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if isEmptyInterface(dst) {
+		v, err := naturalValue(f, cell)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		p := reflect.New(dst.Type().Elem())
+		if err := decodeValue(p.Elem(), f, cell); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	}
+	typ := normalizeType(f.Type)
+	if typ == typeStruct {
+		if dst.Kind() != reflect.Struct && dst.Type() != mapType {
+			return fmt.Errorf("cannot store a STRUCT in %v", dst.Type())
+		}
+		cells, err := recordCells(cell)
+		if err != nil {
+			return err
+		}
+		return decodeRecord(f.Fields, cells, dst)
+	}
+	s, ok := cell.(string)
+	if !ok {
+		return fmt.Errorf("%s value is %T, not a string", typ, cell)
+	}
+	cannot := func() error { return fmt.Errorf("cannot store %s %q in %v", typ, s, dst.Type()) }
+
+	switch typ {
+	case typeInt64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(n) {
+				return cannot()
+			}
+			dst.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n < 0 || dst.OverflowUint(uint64(n)) {
+				return cannot()
+			}
+			dst.SetUint(uint64(n))
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(n))
+		case reflect.String:
+			dst.SetString(s)
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeFloat64:
+		x, err := parseFloat(s)
+		if err != nil {
+			return err
+		}
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(x)
+		case reflect.String:
+			dst.SetString(s)
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeNumeric, typeBigNumeric:
+		switch {
+		case dst.Type() == ratType:
+			r, ok := new(big.Rat).SetString(s)
+			if !ok {
+				return cannot()
+			}
+			dst.Set(reflect.ValueOf(*r))
+		case dst.Kind() == reflect.Float32 || dst.Kind() == reflect.Float64:
+			x, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return err
+			}
+			dst.SetFloat(x)
+		case dst.Kind() == reflect.String:
+			dst.SetString(s)
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		switch dst.Kind() {
+		case reflect.Bool:
+			dst.SetBool(b)
+		case reflect.String:
+			dst.SetString(s)
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeBytes:
+		switch {
+		case dst.Type() == bytesType || (dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8):
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			dst.SetBytes(b)
+		case dst.Kind() == reflect.String:
+			dst.SetString(s)
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeTimestamp:
+		t, err := parseTimestamp(s)
+		if err != nil {
+			return err
+		}
+		switch {
+		case dst.Type() == timeType:
+			dst.Set(reflect.ValueOf(t))
+		case dst.Kind() == reflect.String:
+			dst.SetString(t.Format(time.RFC3339Nano))
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeDate, typeDateTime:
+		switch {
+		case dst.Type() == timeType:
+			t, err := parseCivil(typ, s)
+			if err != nil {
+				return err
+			}
+			dst.Set(reflect.ValueOf(t))
+		case dst.Kind() == reflect.String:
+			dst.SetString(s)
+		default:
+			return cannot()
+		}
+		return nil
+
+	case typeString, typeTime, typeGeography:
+		if dst.Kind() != reflect.String {
+			return cannot()
+		}
+		dst.SetString(s)
+		return nil
+	}
+	return fmt.Errorf("unsupported column type %q", f.Type)
+}
+
+// naturalField returns the Go value for cell, the value of column f,
+// honoring its mode.
+func naturalField(f *bigquery.TableFieldSchema, cell interface{}) (interface{}, error) {
+	if cell == nil {
+		return nil, nil
+	}
+	if f.Mode != "REPEATED" {
+		v, err := naturalValue(f, cell)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %v", f.Name, err)
+		}
+		return v, nil
+	}
+	elems, ok := cell.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("column %q: repeated value is %T, not a list", f.Name, cell)
+	}
+	vs := make([]interface{}, len(elems))
+	for i, e := range elems {
+		v, err := naturalValue(f, listValue(e))
+		if err != nil {
+			return nil, fmt.Errorf("column %q, element %d: %v", f.Name, i, err)
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
+
+// naturalValue returns the Go value for cell, a single value of column f, as
+// documented for Decode.
+func naturalValue(f *bigquery.TableFieldSchema, cell interface{}) (interface{}, error) {
+	if cell == nil {
+		return nil, nil
+	}
+	typ := normalizeType(f.Type)
+	if typ == typeStruct {
+		cells, err := recordCells(cell)
+		if err != nil {
+			return nil, err
+		}
+		m := map[string]interface{}{}
+		if err := decodeRecord(f.Fields, cells, reflect.ValueOf(m)); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	s, ok := cell.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s value is %T, not a string", typ, cell)
+	}
+	switch typ {
+	case typeInt64:
+		return strconv.ParseInt(s, 10, 64)
+	case typeFloat64:
+		return parseFloat(s)
+	case typeNumeric, typeBigNumeric:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %q", typ, s)
+		}
+		return r, nil
+	case typeBool:
+		return strconv.ParseBool(s)
+	case typeBytes:
+		return base64.StdEncoding.DecodeString(s)
+	case typeTimestamp:
+		return parseTimestamp(s)
+	case typeString, typeDate, typeTime, typeDateTime, typeGeography:
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported column type %q", f.Type)
+}
+
+// recordCells returns the cell values of a STRUCT value, which has the form
+// {"f": [{"v": ...}, ...]}.
+func recordCells(cell interface{}) ([]interface{}, error) {
+	m, ok := cell.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("STRUCT value is %T, not an object", cell)
+	}
+	fs, ok := m["f"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("STRUCT value has no field list")
+	}
+	cells := make([]interface{}, len(fs))
+	for i, c := range fs {
+		cells[i] = listValue(c)
+	}
+	return cells, nil
+}
+
+// listValue unwraps a {"v": ...} object, the form of elements of repeated
+// values and of the fields of STRUCT values.
+func listValue(e interface{}) interface{} {
+	if m, ok := e.(map[string]interface{}); ok {
+		if v, ok := m["v"]; ok && len(m) == 1 {
+			return v
+		}
+	}
+	return e
+}
+
+func isEmptyInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.NumMethod() == 0
+}
+
+func parseFloat(s string) (float64, error) {
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseTimestamp parses a TIMESTAMP value, which is the number of seconds
+// since the Unix epoch as a decimal or in exponent notation ("1.5E9"). The
+// value is parsed exactly and rounded to the microsecond, the precision of
+// BigQuery timestamps.
+func parseTimestamp(s string) (time.Time, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid TIMESTAMP value %q", s)
+	}
+	us := new(big.Rat).Mul(r, big.NewRat(1e6, 1))
+	// Round half away from zero.
+	n := new(big.Int).Quo(us.Num(), us.Denom())
+	rem := new(big.Rat).Sub(us, new(big.Rat).SetInt(n))
+	if rem.Cmp(big.NewRat(1, 2)) >= 0 {
+		n.Add(n, big.NewInt(1))
+	} else if rem.Cmp(big.NewRat(-1, 2)) <= 0 {
+		n.Sub(n, big.NewInt(1))
+	}
+	if !n.IsInt64() {
+		return time.Time{}, fmt.Errorf("TIMESTAMP value %q out of range", s)
+	}
+	micros := n.Int64()
+	secs, frac := micros/1e6, micros%1e6
+	if frac < 0 {
+		secs--
+		frac += 1e6
+	}
+	return time.Unix(secs, frac*1e3).UTC(), nil
+}
+
+func parseCivil(typ, s string) (time.Time, error) {
+	if typ == typeDate {
+		return time.Parse(dateLayout, s)
+	}
+	// DATETIME values are written with a "T" in query results, but a space
+	// is also valid.
+	if len(s) > 10 && s[10] == ' ' {
+		s = s[:10] + "T" + s[11:]
+	}
+	return time.Parse(dateTimeLayout, s)
+}
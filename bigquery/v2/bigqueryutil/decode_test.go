@@ -0,0 +1,255 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+var testSchema = &bigquery.TableSchema{
+	Fields: []*bigquery.TableFieldSchema{
+		{Name: "name", Type: "STRING"},
+		{Name: "count", Type: "INTEGER"},
+		{Name: "score", Type: "FLOAT"},
+		{Name: "price", Type: "NUMERIC"},
+		{Name: "ok", Type: "BOOLEAN"},
+		{Name: "created", Type: "TIMESTAMP"},
+		{Name: "day", Type: "DATE"},
+		{Name: "at", Type: "TIME"},
+		{Name: "when", Type: "DATETIME"},
+		{Name: "blob", Type: "BYTES"},
+		{Name: "place", Type: "GEOGRAPHY"},
+		{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+		{Name: "owner", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{
+			{Name: "id", Type: "INT64"},
+			{Name: "emails", Type: "STRING", Mode: "REPEATED"},
+		}},
+		{Name: "history", Type: "STRUCT", Mode: "REPEATED", Fields: []*bigquery.TableFieldSchema{
+			{Name: "version", Type: "INT64"},
+		}},
+		{Name: "missing", Type: "STRING"},
+	},
+}
+
+// testRows is the response of Tabledata.List for testSchema, as sent by the
+// server.
+const testRows = `[
+	{"f": [
+		{"v": "widget"},
+		{"v": "42"},
+		{"v": "1.5"},
+		{"v": "12.345"},
+		{"v": "true"},
+		{"v": "1.5843806400123E9"},
+		{"v": "2020-03-16"},
+		{"v": "17:30:00.5"},
+		{"v": "2020-03-16T17:30:00"},
+		{"v": "aGVsbG8="},
+		{"v": "POINT(1 2)"},
+		{"v": [{"v": "a"}, {"v": "b"}]},
+		{"v": {"f": [{"v": "7"}, {"v": [{"v": "x@example.com"}]}]}},
+		{"v": [{"v": {"f": [{"v": "1"}]}}, {"v": {"f": [{"v": "2"}]}}]},
+		{"v": null}
+	]},
+	{"f": [
+		{"v": "gadget"},
+		{"v": null},
+		{"v": "NaN"},
+		{"v": null},
+		{"v": "false"},
+		{"v": "-1.5"},
+		{"v": null},
+		{"v": null},
+		{"v": null},
+		{"v": null},
+		{"v": null},
+		{"v": []},
+		{"v": null},
+		{"v": []},
+		{"v": null}
+	]}
+]`
+
+func testTableRows(t *testing.T) []*bigquery.TableRow {
+	var rows []*bigquery.TableRow
+	if err := json.Unmarshal([]byte(testRows), &rows); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+type owner struct {
+	ID     int `bigquery:"id"`
+	Emails []string
+}
+
+type item struct {
+	Name    string
+	Count   *int64
+	Score   float64
+	Price   *big.Rat
+	OK      bool `bigquery:"ok"`
+	Created time.Time
+	Day     time.Time
+	At      string
+	When    string
+	Blob    []byte
+	Place   string
+	Tags    []string
+	Owner   *owner
+	History []struct{ Version int }
+	Ignored string `bigquery:"-"`
+}
+
+func TestDecodeStructs(t *testing.T) {
+	var got []item
+	if err := Decode(testSchema, testTableRows(t), &got); err != nil {
+		t.Fatal(err)
+	}
+	n := int64(42)
+	want := []item{
+		{
+			Name:    "widget",
+			Count:   &n,
+			Score:   1.5,
+			Price:   big.NewRat(12345, 1000),
+			OK:      true,
+			Created: time.Date(2020, 3, 16, 17, 44, 0, 12300000, time.UTC),
+			Day:     time.Date(2020, 3, 16, 0, 0, 0, 0, time.UTC),
+			At:      "17:30:00.5",
+			When:    "2020-03-16T17:30:00",
+			Blob:    []byte("hello"),
+			Place:   "POINT(1 2)",
+			Tags:    []string{"a", "b"},
+			Owner:   &owner{ID: 7, Emails: []string{"x@example.com"}},
+			History: []struct{ Version int }{{1}, {2}},
+		},
+		{
+			Name:    "gadget",
+			Created: time.Date(1969, 12, 31, 23, 59, 58, 500000000, time.UTC),
+			Tags:    []string{},
+			History: []struct{ Version int }{},
+		},
+	}
+	// NaN != NaN, so check it separately.
+	if s := got[1].Score; s == s {
+		t.Errorf("got score %v, want NaN", s)
+	}
+	got[1].Score = 0
+	if diff := cmp.Diff(got, want, cmp.Comparer(func(a, b *big.Rat) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && a.Cmp(b) == 0)
+	})); diff != "" {
+		t.Errorf("-got +want\n%s", diff)
+	}
+}
+
+func TestDecodeMaps(t *testing.T) {
+	var got []map[string]interface{}
+	if err := Decode(testSchema, testTableRows(t)[:1], &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{
+		"name":    "widget",
+		"count":   int64(42),
+		"score":   1.5,
+		"price":   big.NewRat(12345, 1000),
+		"ok":      true,
+		"created": time.Date(2020, 3, 16, 17, 44, 0, 12300000, time.UTC),
+		"day":     "2020-03-16",
+		"at":      "17:30:00.5",
+		"when":    "2020-03-16T17:30:00",
+		"blob":    []byte("hello"),
+		"place":   "POINT(1 2)",
+		"tags":    []interface{}{"a", "b"},
+		"owner": map[string]interface{}{
+			"id":     int64(7),
+			"emails": []interface{}{"x@example.com"},
+		},
+		"history": []interface{}{
+			map[string]interface{}{"version": int64(1)},
+			map[string]interface{}{"version": int64(2)},
+		},
+		"missing": nil,
+	}}
+	if diff := cmp.Diff(got, want, cmp.Comparer(func(a, b *big.Rat) bool { return a.Cmp(b) == 0 })); diff != "" {
+		t.Errorf("-got +want\n%s", diff)
+	}
+}
+
+func TestDecodeRow(t *testing.T) {
+	rows := testTableRows(t)
+	var it item
+	if err := DecodeRow(testSchema, rows[0], &it); err != nil {
+		t.Fatal(err)
+	}
+	if it.Name != "widget" || it.Owner == nil || it.Owner.ID != 7 {
+		t.Errorf("got %+v", it)
+	}
+	m := map[string]interface{}{}
+	if err := DecodeRow(testSchema, rows[1], m); err != nil {
+		t.Fatal(err)
+	}
+	if m["name"] != "gadget" || m["count"] != nil {
+		t.Errorf("got %v", m)
+	}
+	if err := DecodeRow(testSchema, rows[0], it); err == nil {
+		t.Error("DecodeRow into non-pointer: got nil, want error")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	schema := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{{Name: "n", Type: "INTEGER"}}}
+	row := func(v interface{}) []*bigquery.TableRow {
+		return []*bigquery.TableRow{{F: []*bigquery.TableCell{{V: v}}}}
+	}
+	for _, test := range []struct {
+		desc string
+		rows []*bigquery.TableRow
+		dst  interface{}
+	}{
+		{"not a number", row("x"), &[]struct{ N int }{}},
+		{"overflow", row("300"), &[]struct{ N int8 }{}},
+		{"negative unsigned", row("-1"), &[]struct{ N uint }{}},
+		{"wrong type", row("1"), &[]struct{ N bool }{}},
+		{"not a string", row(1.0), &[]struct{ N int }{}},
+		{"too many cells", []*bigquery.TableRow{{F: []*bigquery.TableCell{{V: "1"}, {V: "2"}}}}, &[]struct{ N int }{}},
+		{"bad element type", row("1"), &[]int{}},
+		{"not a pointer", row("1"), []struct{ N int }{}},
+	} {
+		if err := Decode(schema, test.rows, test.dst); err == nil {
+			t.Errorf("%s: got nil, want error", test.desc)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"0", time.Unix(0, 0)},
+		{"1.5843806400123E9", time.Date(2020, 3, 16, 17, 44, 0, 12300000, time.UTC)},
+		{"1584380640.0000005", time.Date(2020, 3, 16, 17, 44, 0, 1000, time.UTC)},
+		{"-0.0000015", time.Unix(0, -2000)},
+	} {
+		got, err := parseTimestamp(test.in)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.in, got, test.want)
+		}
+	}
+	if _, err := parseTimestamp("yesterday"); err == nil {
+		t.Error("got nil, want error")
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bigqueryutil provides helpers for working with rows and schemas of
+// the BigQuery API (google.golang.org/api/bigquery/v2).
+//
+// Decode converts the rows returned by Jobs.GetQueryResults, Jobs.Query and
+// Tabledata.List, whose cells are strings or nested f/v objects, into Go
+// structs or maps using the table schema. EncodeParameter does the reverse
+// for query parameters.
+//
+// InferSchema derives a TableSchema from a Go struct type, for creating
+// tables with Tables.Insert, and CompareSchemas computes the Tables.Patch
+// that lets an existing table accept rows of a changed struct.
+//
+// An Inserter streams rows into a table with Tabledata.InsertAll, batching
+// them into requests and retrying rows that fail for transient reasons.
+//
+// Struct fields are matched to columns by name, ignoring case. The name can
+// be changed with a "bigquery" struct tag, and a field tagged "-" is
+// ignored:
+//
+//	type Item struct {
+//		Name     string    `bigquery:"item_name"`
+//		Price    float64
+//		Added    time.Time `bigquery:"added_at"`
+//		Internal string    `bigquery:"-"`
+//	}
+//
+// This package is experimental and subject to change without notice.
+package bigqueryutil
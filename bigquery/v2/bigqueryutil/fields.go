@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A field is an exported struct field that maps to a BigQuery column.
+type field struct {
+	name        string // column name
+	index       int    // index of the field in its struct
+	typ         reflect.Type
+	nullable    bool   // "nullable" tag option
+	required    bool   // "required" tag option
+	colType     string // "type=" tag option
+	description string // "description" tag
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the fields of struct type t that map to columns.
+func structFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		tag := sf.Tag.Get("bigquery")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := field{
+			name:        opts[0],
+			index:       i,
+			typ:         sf.Type,
+			description: sf.Tag.Get("description"),
+		}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, o := range opts[1:] {
+			switch {
+			case o == "nullable":
+				f.nullable = true
+			case o == "required":
+				f.required = true
+			case strings.HasPrefix(o, "type="):
+				f.colType = normalizeType(strings.TrimPrefix(o, "type="))
+			}
+		}
+		fields = append(fields, f)
+	}
+	fs, _ := fieldCache.LoadOrStore(t, fields)
+	return fs.([]field)
+}
+
+// fieldByName returns the field named name, ignoring case as BigQuery does,
+// or nil.
+func fieldByName(fields []field, name string) *field {
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// Standard SQL and legacy SQL use different names for some types. These
+// are the names used by this package; normalizeType maps the others onto
+// them.
+const (
+	typeInt64      = "INT64"
+	typeFloat64    = "FLOAT64"
+	typeNumeric    = "NUMERIC"
+	typeBigNumeric = "BIGNUMERIC"
+	typeBool       = "BOOL"
+	typeString     = "STRING"
+	typeBytes      = "BYTES"
+	typeTimestamp  = "TIMESTAMP"
+	typeDate       = "DATE"
+	typeTime       = "TIME"
+	typeDateTime   = "DATETIME"
+	typeGeography  = "GEOGRAPHY"
+	typeStruct     = "STRUCT"
+	typeArray      = "ARRAY"
+)
+
+func normalizeType(t string) string {
+	switch t = strings.ToUpper(t); t {
+	case "INTEGER":
+		return typeInt64
+	case "FLOAT":
+		return typeFloat64
+	case "BOOLEAN":
+		return typeBool
+	case "RECORD":
+		return typeStruct
+	case "BIGDECIMAL":
+		return typeBigNumeric
+	case "DECIMAL":
+		return typeNumeric
+	}
+	return t
+}
+
+// Table schemas returned by the API use the legacy names for some types.
+// legacyType maps the names used by this package back onto them.
+func legacyType(t string) string {
+	switch t {
+	case typeInt64:
+		return "INTEGER"
+	case typeFloat64:
+		return "FLOAT"
+	case typeBool:
+		return "BOOLEAN"
+	case typeStruct:
+		return "RECORD"
+	}
+	return t
+}
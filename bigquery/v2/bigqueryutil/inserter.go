@@ -0,0 +1,461 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/internal/retry"
+	"google.golang.org/api/support/bundler"
+)
+
+const (
+	// DefaultInsertCountThreshold is the default number of rows sent in one
+	// InsertAll request. It is the maximum recommended by BigQuery.
+	DefaultInsertCountThreshold = 500
+
+	// DefaultInsertByteLimit is the default maximum size of the rows sent
+	// in one InsertAll request. BigQuery rejects requests larger than 10MB.
+	DefaultInsertByteLimit = 9e6
+
+	// DefaultInsertRetryDeadline is the default time an Inserter keeps
+	// retrying the rows of a request.
+	DefaultInsertRetryDeadline = time.Minute
+)
+
+var errInserterClosed = errors.New("bigqueryutil: Inserter is closed")
+
+// A Row is a row with an explicit insert ID. Pass a Row or *Row to
+// Inserter.Put to choose the ID that BigQuery uses to de-duplicate retried
+// inserts, instead of having one generated.
+type Row struct {
+	InsertID string
+	Value    interface{}
+}
+
+// A RowError describes a row that could not be inserted.
+type RowError struct {
+	// Row is the value passed to Put.
+	Row interface{}
+
+	// InsertID is the insert ID of the row.
+	InsertID string
+
+	// Errors holds the errors BigQuery reported for the row, if any.
+	Errors []*bigquery.ErrorProto
+
+	// Err is the error of the InsertAll request, if the whole request
+	// failed.
+	Err error
+}
+
+func (e *RowError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("bigqueryutil: row %s: %v", e.InsertID, e.Err)
+	}
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("bigqueryutil: row %s: %s (%s)", e.InsertID, e.Errors[0].Message, e.Errors[0].Reason)
+	}
+	return fmt.Sprintf("bigqueryutil: row %s not inserted", e.InsertID)
+}
+
+// An Inserter streams rows into a table with Tabledata.InsertAll. It batches
+// the rows passed to Put into requests that stay within the API's limits,
+// retries requests that fail with transient errors, and re-sends only the
+// rows of a request that BigQuery did not insert because of transient
+// problems. Rows that cannot be inserted are reported to OnError.
+//
+// The exported fields are only safe to modify prior to the first call to Put.
+type Inserter struct {
+	// Once a request has this many rows, send it. The default is
+	// DefaultInsertCountThreshold.
+	BundleCountThreshold int
+
+	// The maximum size of a request, in bytes of encoded rows. The default
+	// is DefaultInsertByteLimit.
+	BundleByteLimit int
+
+	// Starting from the time that the first row is added to a request, once
+	// this delay has passed, send the request. The default is
+	// bundler.DefaultDelayThreshold.
+	DelayThreshold time.Duration
+
+	// The maximum number of bytes of rows that the Inserter will keep in
+	// memory before Put blocks. The default is
+	// bundler.DefaultBufferedByteLimit.
+	BufferedByteLimit int
+
+	// The maximum number of InsertAll requests in flight. The default is 1.
+	HandlerLimit int
+
+	// SkipInvalidRows, IgnoreUnknownValues and TemplateSuffix are set on
+	// each TableDataInsertAllRequest.
+	SkipInvalidRows     bool
+	IgnoreUnknownValues bool
+	TemplateSuffix      string
+
+	// How long to keep retrying the rows of a request before reporting them
+	// as failed. The default is DefaultInsertRetryDeadline.
+	RetryDeadline time.Duration
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	// OnError, if non-nil, is called with each row that could not be
+	// inserted, for example to log it or write it to a dead-letter table.
+	// It is called from the goroutine sending requests, so it should not
+	// block for long. If OnError is nil, Close reports failed rows instead.
+	OnError func(*RowError)
+
+	ctx                         context.Context
+	svc                         *bigquery.Service
+	projectID, datasetID, table string
+
+	initOnce sync.Once
+	bundler  *bundler.Bundler
+	idPrefix string
+
+	mu       sync.Mutex
+	closed   bool
+	idCount  uint64
+	failures int
+	firstErr *RowError
+}
+
+// NewInserter returns an Inserter that inserts rows into the given table
+// using svc. ctx is used for all InsertAll requests; once it is done, rows
+// that have not been sent are reported as failed.
+func NewInserter(ctx context.Context, svc *bigquery.Service, projectID, datasetID, tableID string) *Inserter {
+	return &Inserter{
+		BundleCountThreshold: DefaultInsertCountThreshold,
+		BundleByteLimit:      DefaultInsertByteLimit,
+		DelayThreshold:       bundler.DefaultDelayThreshold,
+		BufferedByteLimit:    bundler.DefaultBufferedByteLimit,
+		HandlerLimit:         1,
+		RetryDeadline:        DefaultInsertRetryDeadline,
+
+		ctx:       ctx,
+		svc:       svc,
+		projectID: projectID,
+		datasetID: datasetID,
+		table:     tableID,
+	}
+}
+
+// A pendingRow is a row waiting to be inserted.
+type pendingRow struct {
+	value interface{}
+	row   *bigquery.TableDataInsertAllRequestRows
+}
+
+func (ins *Inserter) init() {
+	ins.initOnce.Do(func() {
+		b := bundler.NewBundler(&pendingRow{}, func(items interface{}) {
+			ins.insert(items.([]*pendingRow))
+		})
+		b.BundleCountThreshold = ins.BundleCountThreshold
+		b.BundleByteThreshold = ins.BundleByteLimit
+		b.BundleByteLimit = ins.BundleByteLimit
+		b.DelayThreshold = ins.DelayThreshold
+		b.BufferedByteLimit = ins.BufferedByteLimit
+		b.HandlerLimit = ins.HandlerLimit
+		ins.bundler = b
+
+		var buf [12]byte
+		if _, err := rand.Read(buf[:]); err == nil {
+			ins.idPrefix = base64.RawURLEncoding.EncodeToString(buf[:])
+		} else {
+			// Insert IDs only need to be unique for a few minutes, so the
+			// clock will do.
+			ins.idPrefix = strconv.FormatInt(time.Now().UnixNano(), 36)
+		}
+	})
+}
+
+// Put adds a row to be inserted. The row is a struct or pointer to a struct,
+// whose fields are converted to JSON as described for InferSchema; a
+// map[string]bigquery.JsonValue, which is sent as is; or a Row or *Row
+// holding one of those with an explicit insert ID.
+//
+// Put blocks while BufferedByteLimit bytes of rows are waiting to be sent,
+// until ctx is done. It returns an error if the row cannot be encoded, is
+// larger than BundleByteLimit, or the Inserter is closed. Errors inserting
+// the row are reported later, to OnError or by Close.
+func (ins *Inserter) Put(ctx context.Context, row interface{}) error {
+	ins.init()
+	ins.mu.Lock()
+	closed := ins.closed
+	ins.idCount++
+	n := ins.idCount
+	ins.mu.Unlock()
+	if closed {
+		return errInserterClosed
+	}
+	var id string
+	value := row
+	switch r := row.(type) {
+	case Row:
+		id, value = r.InsertID, r.Value
+	case *Row:
+		id, value = r.InsertID, r.Value
+	}
+	if id == "" {
+		id = ins.idPrefix + "-" + strconv.FormatUint(n, 36)
+	}
+	m, err := encodeRow(value)
+	if err != nil {
+		return err
+	}
+	p := &pendingRow{
+		value: row,
+		row:   &bigquery.TableDataInsertAllRequestRows{InsertId: id, Json: m},
+	}
+	b, err := json.Marshal(p.row)
+	if err != nil {
+		return fmt.Errorf("bigqueryutil: %v", err)
+	}
+	if err := ins.bundler.AddWait(ctx, p, len(b)); err != nil {
+		if err == bundler.ErrOversizedItem {
+			return fmt.Errorf("bigqueryutil: row of %d bytes exceeds BundleByteLimit", len(b))
+		}
+		return err
+	}
+	return nil
+}
+
+// Flush waits until all rows passed to Put so far have been inserted or
+// reported as failed.
+func (ins *Inserter) Flush() {
+	ins.init()
+	ins.bundler.Flush()
+}
+
+// Close flushes the Inserter and stops it from accepting more rows. If
+// OnError is nil and some rows could not be inserted, Close returns an error
+// describing the first of them.
+func (ins *Inserter) Close() error {
+	ins.mu.Lock()
+	ins.closed = true
+	ins.mu.Unlock()
+	ins.Flush()
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	if ins.failures == 0 {
+		return nil
+	}
+	if ins.failures == 1 {
+		return ins.firstErr
+	}
+	return fmt.Errorf("%v (and %d more failed rows)", ins.firstErr, ins.failures-1)
+}
+
+// insert sends rows, retrying until they are all inserted, permanently
+// rejected, or the retry deadline passes.
+func (ins *Inserter) insert(rows []*pendingRow) {
+	bo := ins.Backoff
+	deadline := time.Now().Add(ins.RetryDeadline)
+	for len(rows) > 0 {
+		pending, err := ins.insertOnce(rows)
+		if err == nil && len(pending) == 0 {
+			return
+		}
+		if err != nil && !retry.Transient(err) {
+			ins.fail(rows, nil, err)
+			return
+		}
+		if err == nil {
+			rows = pending
+		}
+		pause := bo.Pause()
+		if time.Now().Add(pause).After(deadline) {
+			if err == nil {
+				err = errors.New("retry deadline exceeded")
+			}
+			ins.fail(rows, nil, err)
+			return
+		}
+		if err := gax.Sleep(ins.ctx, pause); err != nil {
+			ins.fail(rows, nil, err)
+			return
+		}
+	}
+}
+
+// insertOnce sends one InsertAll request for rows. It returns the rows that
+// should be sent again, or the error of the request. Rows rejected
+// permanently are reported.
+func (ins *Inserter) insertOnce(rows []*pendingRow) ([]*pendingRow, error) {
+	req := &bigquery.TableDataInsertAllRequest{
+		SkipInvalidRows:     ins.SkipInvalidRows,
+		IgnoreUnknownValues: ins.IgnoreUnknownValues,
+		TemplateSuffix:      ins.TemplateSuffix,
+	}
+	for _, r := range rows {
+		req.Rows = append(req.Rows, r.row)
+	}
+	resp, err := ins.svc.Tabledata.InsertAll(ins.projectID, ins.datasetID, ins.table, req).Context(ins.ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	var retry []*pendingRow
+	for _, ie := range resp.InsertErrors {
+		if ie.Index < 0 || int(ie.Index) >= len(rows) {
+			continue
+		}
+		r := rows[ie.Index]
+		if retryableRow(ie.Errors) {
+			retry = append(retry, r)
+		} else {
+			ins.fail([]*pendingRow{r}, ie.Errors, nil)
+		}
+	}
+	return retry, nil
+}
+
+func (ins *Inserter) fail(rows []*pendingRow, errs []*bigquery.ErrorProto, err error) {
+	for _, r := range rows {
+		re := &RowError{Row: r.value, InsertID: r.row.InsertId, Errors: errs, Err: err}
+		if ins.OnError != nil {
+			ins.OnError(re)
+			continue
+		}
+		ins.mu.Lock()
+		if ins.failures == 0 {
+			ins.firstErr = re
+		}
+		ins.failures++
+		ins.mu.Unlock()
+	}
+}
+
+// retryableRow reports whether a row that BigQuery did not insert, with the
+// given errors, may succeed if sent again. Rows are not inserted with reason
+// "stopped" when another row of the request was invalid.
+func retryableRow(errs []*bigquery.ErrorProto) bool {
+	if len(errs) == 0 {
+		return true
+	}
+	for _, e := range errs {
+		switch e.Reason {
+		case "stopped", "timeout", "backendError", "internalError", "rateLimitExceeded":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// encodeRow converts a row passed to Put into the JSON object sent to
+// InsertAll.
+func encodeRow(v interface{}) (map[string]bigquery.JsonValue, error) {
+	if m, ok := v.(map[string]bigquery.JsonValue); ok {
+		return m, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || rv.Type() == timeType {
+		return nil, fmt.Errorf("bigqueryutil: cannot insert row of type %T", v)
+	}
+	m, err := encodeStruct(rv)
+	if err != nil {
+		return nil, fmt.Errorf("bigqueryutil: %v", err)
+	}
+	return m, nil
+}
+
+func encodeStruct(v reflect.Value) (map[string]bigquery.JsonValue, error) {
+	m := map[string]bigquery.JsonValue{}
+	for _, f := range structFields(v.Type()) {
+		x, err := encodeValue(v.Field(f.index), f.colType)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", f.name, err)
+		}
+		if x != nil {
+			m[f.name] = x
+		}
+	}
+	return m, nil
+}
+
+// encodeValue returns the JSON value of v for a column of type colType, or
+// of the inferred type if colType is empty. It returns nil for NULL.
+func encodeValue(v reflect.Value, colType string) (interface{}, error) {
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type() == ratPtrType {
+			return formatNumeric(v.Interface().(*big.Rat)), nil
+		}
+		return encodeValue(v.Elem(), colType)
+	}
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		switch colType {
+		case typeDate:
+			return t.Format(dateLayout), nil
+		case typeDateTime:
+			return t.Format(dateTimeLayout), nil
+		}
+		return t.Format(timestampLayout), nil
+	case ratType:
+		r := v.Interface().(big.Rat)
+		return formatNumeric(&r), nil
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice && v.IsNil() {
+				return nil, nil
+			}
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+		vs := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			x, err := encodeValue(v.Index(i), colType)
+			if err != nil {
+				return nil, err
+			}
+			if x == nil {
+				return nil, fmt.Errorf("element %d: repeated values cannot be NULL", i)
+			}
+			vs = append(vs, x)
+		}
+		return vs, nil
+	case reflect.Struct:
+		return encodeStruct(v)
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			// JSON has no NaN or infinities; BigQuery accepts them as
+			// strings.
+			return formatFloat(f), nil
+		}
+		return f, nil
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
+}
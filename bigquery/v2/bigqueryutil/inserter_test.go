@@ -0,0 +1,236 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeInsertAll is an InsertAll handler. respond returns the status code
+// and response for each request, given the number of earlier requests.
+type fakeInsertAll struct {
+	mu       sync.Mutex
+	requests []*bigquery.TableDataInsertAllRequest
+	respond  func(n int, req *bigquery.TableDataInsertAllRequest) (int, *bigquery.TableDataInsertAllResponse)
+}
+
+func (f *fakeInsertAll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if want := "/projects/p/datasets/d/tables/t/insertAll"; r.URL.Path != want {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req bigquery.TableDataInsertAllRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	n := len(f.requests)
+	f.requests = append(f.requests, &req)
+	f.mu.Unlock()
+	code, resp := http.StatusOK, &bigquery.TableDataInsertAllResponse{}
+	if f.respond != nil {
+		code, resp = f.respond(n, &req)
+	}
+	if code != http.StatusOK {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+type event struct {
+	Name  string    `bigquery:"name"`
+	Count *int      `bigquery:"count"`
+	At    time.Time `bigquery:"at"`
+	Day   time.Time `bigquery:"day,type=DATE"`
+	Data  []byte
+	Price *big.Rat
+	Tags  []string
+	Home  *address
+}
+
+func TestEncodeRow(t *testing.T) {
+	at := time.Date(2020, 3, 16, 17, 44, 0, 123456000, time.UTC)
+	got, err := encodeRow(&event{
+		Name:  "e",
+		At:    at,
+		Day:   at,
+		Data:  []byte("hi"),
+		Price: big.NewRat(3, 2),
+		Tags:  []string{"a", "b"},
+		Home:  &address{Street: "Main"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bigquery.JsonValue{
+		"name":  "e",
+		"at":    "2020-03-16 17:44:00.123456+00:00",
+		"day":   "2020-03-16",
+		"Data":  "aGk=",
+		"Price": "1.5",
+		"Tags":  []interface{}{"a", "b"},
+		"Home":  map[string]bigquery.JsonValue{"Street": "Main"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("-got +want\n%s", diff)
+	}
+
+	for _, v := range []interface{}{nil, 3, at, struct{ C chan int }{}} {
+		if _, err := encodeRow(v); err == nil {
+			t.Errorf("%T: got nil, want error", v)
+		}
+	}
+}
+
+func TestInserter(t *testing.T) {
+	f := &fakeInsertAll{}
+	svc, done := testserver.NewService(t, f, bigquery.NewService)
+	defer done()
+	ctx := context.Background()
+	ins := NewInserter(ctx, svc.(*bigquery.Service), "p", "d", "t")
+	ins.BundleCountThreshold = 2
+	ins.SkipInvalidRows = true
+	for _, r := range []interface{}{
+		event{Name: "a"},
+		&Row{InsertID: "id-b", Value: event{Name: "b"}},
+		map[string]bigquery.JsonValue{"name": "c"},
+	} {
+		if err := ins.Put(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ins.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ins.Put(ctx, event{}); err == nil {
+		t.Error("Put after Close: got nil, want error")
+	}
+
+	var names []string
+	ids := map[string]bool{}
+	for _, req := range f.requests {
+		if !req.SkipInvalidRows {
+			t.Error("SkipInvalidRows not set")
+		}
+		if len(req.Rows) > 2 {
+			t.Errorf("got %d rows in a request, want at most 2", len(req.Rows))
+		}
+		for _, r := range req.Rows {
+			names = append(names, r.Json["name"].(string))
+			if r.InsertId == "" || ids[r.InsertId] {
+				t.Errorf("bad insert ID %q", r.InsertId)
+			}
+			ids[r.InsertId] = true
+		}
+	}
+	if want := []string{"a", "b", "c"}; !cmp.Equal(names, want) {
+		t.Errorf("got rows %v, want %v", names, want)
+	}
+	if !ids["id-b"] {
+		t.Errorf("explicit insert ID not used: %v", ids)
+	}
+}
+
+func TestInserterRetries(t *testing.T) {
+	f := &fakeInsertAll{
+		respond: func(n int, req *bigquery.TableDataInsertAllRequest) (int, *bigquery.TableDataInsertAllResponse) {
+			switch n {
+			case 0:
+				return http.StatusServiceUnavailable, nil
+			case 1:
+				// Row 0 is invalid, so row 1 is stopped and must be retried.
+				return http.StatusOK, &bigquery.TableDataInsertAllResponse{
+					InsertErrors: []*bigquery.TableDataInsertAllResponseInsertErrors{
+						{Index: 0, Errors: []*bigquery.ErrorProto{{Reason: "invalid", Message: "no such field"}}},
+						{Index: 1, Errors: []*bigquery.ErrorProto{{Reason: "stopped"}}},
+					},
+				}
+			}
+			return http.StatusOK, &bigquery.TableDataInsertAllResponse{}
+		},
+	}
+	svc, done := testserver.NewService(t, f, bigquery.NewService)
+	defer done()
+	ctx := context.Background()
+	ins := NewInserter(ctx, svc.(*bigquery.Service), "p", "d", "t")
+	ins.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	ins.RetryDeadline = time.Second
+	var failed []*RowError
+	ins.OnError = func(e *RowError) { failed = append(failed, e) }
+	for _, name := range []string{"bad", "good"} {
+		if err := ins.Put(ctx, event{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ins.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(f.requests))
+	}
+	if got := len(f.requests[1].Rows); got != 2 {
+		t.Errorf("retried request has %d rows, want 2", got)
+	}
+	last := f.requests[2].Rows
+	if len(last) != 1 || last[0].Json["name"] != "good" {
+		t.Errorf("last request: got %+v, want only the stopped row", last)
+	}
+	if last[0].InsertId != f.requests[0].Rows[1].InsertId {
+		t.Error("insert ID changed between retries")
+	}
+	if len(failed) != 1 || failed[0].Row.(event).Name != "bad" || failed[0].Errors[0].Reason != "invalid" {
+		t.Errorf("got failed rows %+v, want the invalid row", failed)
+	}
+}
+
+func TestInserterPermanentFailure(t *testing.T) {
+	f := &fakeInsertAll{
+		respond: func(int, *bigquery.TableDataInsertAllRequest) (int, *bigquery.TableDataInsertAllResponse) {
+			return http.StatusForbidden, nil
+		},
+	}
+	svc, done := testserver.NewService(t, f, bigquery.NewService)
+	defer done()
+	ctx := context.Background()
+	ins := NewInserter(ctx, svc.(*bigquery.Service), "p", "d", "t")
+	for _, name := range []string{"a", "b"} {
+		if err := ins.Put(ctx, event{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ins.Close()
+	if err == nil || !strings.Contains(err.Error(), "1 more") {
+		t.Errorf("got %v, want error for both rows", err)
+	}
+	if len(f.requests) != 1 {
+		t.Errorf("got %d requests, want 1", len(f.requests))
+	}
+}
+
+func TestInserterOversizedRow(t *testing.T) {
+	svc, done := testserver.NewService(t, &fakeInsertAll{}, bigquery.NewService)
+	defer done()
+	ctx := context.Background()
+	ins := NewInserter(ctx, svc.(*bigquery.Service), "p", "d", "t")
+	ins.BundleByteLimit = 10
+	if err := ins.Put(ctx, event{Name: "too long"}); err == nil {
+		t.Error("got nil, want error")
+	}
+}
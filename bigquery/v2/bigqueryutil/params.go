@@ -0,0 +1,270 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+// timestampLayout is the layout of TIMESTAMP query parameter values.
+const timestampLayout = "2006-01-02 15:04:05.999999-07:00"
+
+// A TypedValue is a query parameter value with an explicit BigQuery type. Use
+// it for types that cannot be inferred from a Go value, such as DATE, TIME,
+// DATETIME and GEOGRAPHY, or for typed NULLs.
+//
+// Value may be nil for NULL, a string holding the value in canonical form,
+// or, for DATE, TIME and DATETIME, a time.Time whose date or time of day in
+// its own location is used.
+type TypedValue struct {
+	Type  string
+	Value interface{}
+}
+
+// EncodeParameter returns a query parameter with the given name and value,
+// for use in QueryRequest.QueryParameters or JobConfigurationQuery. Use an
+// empty name for positional parameters.
+//
+// The parameter type is inferred from the Go type of v:
+//
+//	bool                                       BOOL
+//	signed and unsigned integers               INT64
+//	float32, float64                           FLOAT64
+//	big.Rat, *big.Rat                          NUMERIC
+//	string                                     STRING
+//	[]byte                                     BYTES
+//	time.Time                                  TIMESTAMP
+//	slices and arrays                          ARRAY
+//	structs                                    STRUCT
+//	TypedValue                                 the given type
+//
+// Struct field names follow the same rules as for Decode. A nil pointer is
+// encoded as a NULL of the pointed-to type.
+func EncodeParameter(name string, v interface{}) (*bigquery.QueryParameter, error) {
+	pt, err := paramType(reflect.ValueOf(v))
+	if err != nil {
+		return nil, fmt.Errorf("bigqueryutil: parameter %q: %v", name, err)
+	}
+	pv, err := paramValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, fmt.Errorf("bigqueryutil: parameter %q: %v", name, err)
+	}
+	return &bigquery.QueryParameter{Name: name, ParameterType: pt, ParameterValue: pv}, nil
+}
+
+// EncodeParameters returns positional query parameters for vs, in order.
+func EncodeParameters(vs ...interface{}) ([]*bigquery.QueryParameter, error) {
+	ps := make([]*bigquery.QueryParameter, len(vs))
+	for i, v := range vs {
+		p, err := EncodeParameter("", v)
+		if err != nil {
+			return nil, err
+		}
+		ps[i] = p
+	}
+	return ps, nil
+}
+
+var (
+	ratPtrType     = reflect.TypeOf((*big.Rat)(nil))
+	typedValueType = reflect.TypeOf(TypedValue{})
+)
+
+func paramType(v reflect.Value) (*bigquery.QueryParameterType, error) {
+	if !v.IsValid() {
+		return nil, errors.New("untyped nil value; use a TypedValue")
+	}
+	return paramTypeOf(v.Type(), v)
+}
+
+// paramTypeOf returns the parameter type for Go type t. The value v, which
+// may be invalid, is only needed for TypedValue.
+func paramTypeOf(t reflect.Type, v reflect.Value) (*bigquery.QueryParameterType, error) {
+	switch t {
+	case typedValueType:
+		if !v.IsValid() {
+			return nil, errors.New("TypedValue is not allowed inside arrays and structs")
+		}
+		return &bigquery.QueryParameterType{Type: normalizeType(v.Interface().(TypedValue).Type)}, nil
+	case timeType:
+		return &bigquery.QueryParameterType{Type: typeTimestamp}, nil
+	case ratPtrType, ratType:
+		return &bigquery.QueryParameterType{Type: typeNumeric}, nil
+	case bytesType:
+		return &bigquery.QueryParameterType{Type: typeBytes}, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &bigquery.QueryParameterType{Type: typeBool}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &bigquery.QueryParameterType{Type: typeInt64}, nil
+	case reflect.Float32, reflect.Float64:
+		return &bigquery.QueryParameterType{Type: typeFloat64}, nil
+	case reflect.String:
+		return &bigquery.QueryParameterType{Type: typeString}, nil
+	case reflect.Ptr:
+		return paramTypeOf(t.Elem(), reflect.Value{})
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Slice && t.Elem() != bytesType {
+			return nil, errors.New("nested arrays are not supported")
+		}
+		et, err := paramTypeOf(t.Elem(), reflect.Value{})
+		if err != nil {
+			return nil, err
+		}
+		return &bigquery.QueryParameterType{Type: typeArray, ArrayType: et}, nil
+	case reflect.Struct:
+		st := &bigquery.QueryParameterType{Type: typeStruct}
+		for _, f := range structFields(t) {
+			ft, err := paramTypeOf(f.typ, reflect.Value{})
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.name, err)
+			}
+			st.StructTypes = append(st.StructTypes, &bigquery.QueryParameterTypeStructTypes{Name: f.name, Type: ft})
+		}
+		return st, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
+
+func paramValue(v reflect.Value) (*bigquery.QueryParameterValue, error) {
+	if v.Type() == typedValueType {
+		return typedParamValue(v.Interface().(TypedValue))
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nullParamValue(), nil
+		}
+		if v.Type() != ratPtrType {
+			v = v.Elem()
+		}
+	}
+	switch {
+	case v.Type() == timeType:
+		return &bigquery.QueryParameterValue{Value: v.Interface().(time.Time).Format(timestampLayout)}, nil
+	case v.Type() == ratPtrType:
+		return &bigquery.QueryParameterValue{Value: formatNumeric(v.Interface().(*big.Rat))}, nil
+	case v.Type() == ratType:
+		r := v.Interface().(big.Rat)
+		return &bigquery.QueryParameterValue{Value: formatNumeric(&r)}, nil
+	case v.Type() == bytesType:
+		if v.IsNil() {
+			return nullParamValue(), nil
+		}
+		return &bigquery.QueryParameterValue{Value: base64.StdEncoding.EncodeToString(v.Bytes())}, nil
+	}
+	var s string
+	switch v.Kind() {
+	case reflect.Bool:
+		s = strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d overflows INT64", v.Uint())
+		}
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		s = formatFloat(v.Float())
+	case reflect.String:
+		s = v.String()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nullParamValue(), nil
+		}
+		pv := &bigquery.QueryParameterValue{ArrayValues: []*bigquery.QueryParameterValue{}}
+		for i := 0; i < v.Len(); i++ {
+			ev, err := paramValue(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+			pv.ArrayValues = append(pv.ArrayValues, ev)
+		}
+		if len(pv.ArrayValues) == 0 {
+			pv.ForceSendFields = []string{"ArrayValues"}
+		}
+		return pv, nil
+	case reflect.Struct:
+		pv := &bigquery.QueryParameterValue{StructValues: map[string]bigquery.QueryParameterValue{}}
+		for _, f := range structFields(v.Type()) {
+			fv, err := paramValue(v.Field(f.index))
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.name, err)
+			}
+			pv.StructValues[f.name] = *fv
+		}
+		return pv, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return &bigquery.QueryParameterValue{Value: s}, nil
+}
+
+func typedParamValue(tv TypedValue) (*bigquery.QueryParameterValue, error) {
+	switch x := tv.Value.(type) {
+	case nil:
+		return nullParamValue(), nil
+	case string:
+		return &bigquery.QueryParameterValue{Value: x}, nil
+	case time.Time:
+		switch typ := normalizeType(tv.Type); typ {
+		case typeDate:
+			return &bigquery.QueryParameterValue{Value: x.Format(dateLayout)}, nil
+		case typeTime:
+			return &bigquery.QueryParameterValue{Value: x.Format(timeLayout)}, nil
+		case typeDateTime:
+			return &bigquery.QueryParameterValue{Value: x.Format(dateTimeLayout)}, nil
+		case typeTimestamp:
+			return &bigquery.QueryParameterValue{Value: x.Format(timestampLayout)}, nil
+		default:
+			return nil, fmt.Errorf("cannot use a time.Time as %s", typ)
+		}
+	}
+	return nil, fmt.Errorf("TypedValue has value of type %T; want a string or time.Time", tv.Value)
+}
+
+// nullParamValue returns the value of a NULL parameter, which is a value
+// with a JSON null in place of the scalar value.
+func nullParamValue() *bigquery.QueryParameterValue {
+	return &bigquery.QueryParameterValue{NullFields: []string{"Value"}}
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// numericScale is the number of digits after the decimal point in a NUMERIC
+// value.
+const numericScale = 9
+
+// formatNumeric formats r as a NUMERIC value, trimming trailing zeros.
+func formatNumeric(r *big.Rat) string {
+	s := r.FloatString(numericScale)
+	for s[len(s)-1] == '0' {
+		s = s[:len(s)-1]
+	}
+	if s[len(s)-1] == '.' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+func TestEncodeParameter(t *testing.T) {
+	ts := time.Date(2020, 3, 16, 17, 30, 0, 500000000, time.FixedZone("", -7*3600))
+	var nilInt *int
+	type point struct {
+		X    float64 `bigquery:"x"`
+		Y    float64 `bigquery:"y"`
+		Skip bool    `bigquery:"-"`
+	}
+	for _, test := range []struct {
+		v    interface{}
+		want string // JSON of the type and value
+	}{
+		{true, `{"name":"p","parameterType":{"type":"BOOL"},"parameterValue":{"value":"true"}}`},
+		{int8(-3), `{"name":"p","parameterType":{"type":"INT64"},"parameterValue":{"value":"-3"}}`},
+		{uint32(7), `{"name":"p","parameterType":{"type":"INT64"},"parameterValue":{"value":"7"}}`},
+		{1.25, `{"name":"p","parameterType":{"type":"FLOAT64"},"parameterValue":{"value":"1.25"}}`},
+		{math.Inf(-1), `{"name":"p","parameterType":{"type":"FLOAT64"},"parameterValue":{"value":"-Infinity"}}`},
+		{big.NewRat(1, 8), `{"name":"p","parameterType":{"type":"NUMERIC"},"parameterValue":{"value":"0.125"}}`},
+		{"hi", `{"name":"p","parameterType":{"type":"STRING"},"parameterValue":{"value":"hi"}}`},
+		{[]byte("hello"), `{"name":"p","parameterType":{"type":"BYTES"},"parameterValue":{"value":"aGVsbG8="}}`},
+		{ts, `{"name":"p","parameterType":{"type":"TIMESTAMP"},"parameterValue":{"value":"2020-03-16 17:30:00.5-07:00"}}`},
+		{nilInt, `{"name":"p","parameterType":{"type":"INT64"},"parameterValue":{"value":null}}`},
+		{[]int{1, 2}, `{"name":"p","parameterType":{"arrayType":{"type":"INT64"},"type":"ARRAY"},"parameterValue":{"arrayValues":[{"value":"1"},{"value":"2"}]}}`},
+		{[]string{}, `{"name":"p","parameterType":{"arrayType":{"type":"STRING"},"type":"ARRAY"},"parameterValue":{"arrayValues":[]}}`},
+		{point{X: 1, Y: 2}, `{"name":"p","parameterType":{"structTypes":[{"name":"x","type":{"type":"FLOAT64"}},{"name":"y","type":{"type":"FLOAT64"}}],"type":"STRUCT"},"parameterValue":{"structValues":{"x":{"value":"1"},"y":{"value":"2"}}}}`},
+		{TypedValue{Type: "DATE", Value: ts}, `{"name":"p","parameterType":{"type":"DATE"},"parameterValue":{"value":"2020-03-16"}}`},
+		{TypedValue{Type: "DATETIME", Value: ts}, `{"name":"p","parameterType":{"type":"DATETIME"},"parameterValue":{"value":"2020-03-16T17:30:00.5"}}`},
+		{TypedValue{Type: "time", Value: ts}, `{"name":"p","parameterType":{"type":"TIME"},"parameterValue":{"value":"17:30:00.5"}}`},
+		{TypedValue{Type: "GEOGRAPHY", Value: "POINT(1 2)"}, `{"name":"p","parameterType":{"type":"GEOGRAPHY"},"parameterValue":{"value":"POINT(1 2)"}}`},
+		{TypedValue{Type: "DATE"}, `{"name":"p","parameterType":{"type":"DATE"},"parameterValue":{"value":null}}`},
+	} {
+		p, err := EncodeParameter("p", test.v)
+		if err != nil {
+			t.Errorf("%#v: %v", test.v, err)
+			continue
+		}
+		got, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%#v:\ngot  %s\nwant %s", test.v, got, test.want)
+		}
+	}
+}
+
+func TestEncodeParameterErrors(t *testing.T) {
+	for _, v := range []interface{}{
+		nil,
+		uint64(math.MaxUint64),
+		map[string]int{},
+		[][]int{{1}},
+		[]TypedValue{{Type: "DATE", Value: "2020-01-01"}},
+		TypedValue{Type: "GEOGRAPHY", Value: time.Now()},
+		TypedValue{Type: "DATE", Value: 3},
+	} {
+		if _, err := EncodeParameter("p", v); err == nil {
+			t.Errorf("%#v: got nil, want error", v)
+		}
+	}
+}
+
+func TestEncodeParameters(t *testing.T) {
+	ps, err := EncodeParameters("a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 || ps[0].Name != "" || ps[1].ParameterType.Type != "INT64" {
+		t.Errorf("got %+v", ps)
+	}
+}
+
+// Decoding a row with the value of an encoded parameter gives back the
+// original value.
+func TestEncodeDecode(t *testing.T) {
+	type rec struct {
+		When  time.Time
+		Price *big.Rat
+		Data  []byte
+	}
+	in := rec{When: time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC), Price: big.NewRat(3, 2), Data: []byte{0, 1}}
+	p, err := EncodeParameter("r", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Query results carry timestamps as seconds since the epoch.
+	sv := p.ParameterValue.StructValues
+	when := float64(in.When.UnixNano()) / 1e9
+	schema := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "When", Type: "TIMESTAMP"},
+		{Name: "Price", Type: "NUMERIC"},
+		{Name: "Data", Type: "BYTES"},
+	}}
+	row := &bigquery.TableRow{F: []*bigquery.TableCell{
+		{V: big.NewFloat(when).Text('f', 6)},
+		{V: sv["Price"].Value},
+		{V: sv["Data"].Value},
+	}}
+	var out rec
+	if err := DecodeRow(schema, row, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.When.Equal(in.When) || out.Price.Cmp(in.Price) != 0 || string(out.Data) != string(in.Data) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+// Column modes.
+const (
+	modeNullable = "NULLABLE"
+	modeRequired = "REQUIRED"
+	modeRepeated = "REPEATED"
+)
+
+// InferSchema returns the schema of a table whose rows have the type of st,
+// which must be a struct or a pointer to one. The result can be used to
+// create the table with Tables.Insert.
+//
+// Each field becomes a column named as described in the package
+// documentation. Column types follow from the field types:
+//
+//	bool                                       BOOLEAN
+//	signed and unsigned integers               INTEGER
+//	float32, float64                           FLOAT
+//	big.Rat, *big.Rat                          NUMERIC
+//	string                                     STRING
+//	[]byte                                     BYTES
+//	time.Time                                  TIMESTAMP
+//	structs                                    RECORD
+//
+// A slice or array field (other than []byte) becomes a REPEATED column of
+// its element type. A pointer field becomes a NULLABLE column; other fields
+// become REQUIRED columns. The mode can be changed with the "nullable" and
+// "required" tag options, and the type with the "type=" option, which is
+// useful for DATE, TIME, DATETIME and GEOGRAPHY columns held in strings or
+// times. The column description is taken from a "description" tag:
+//
+//	type Visit struct {
+//		Page   string    `bigquery:"page" description:"Path of the page"`
+//		Day    time.Time `bigquery:"day,type=DATE"`
+//		Client string    `bigquery:",nullable"`
+//	}
+func InferSchema(st interface{}) (*bigquery.TableSchema, error) {
+	t := reflect.TypeOf(st)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t == timeType || t == ratType {
+		return nil, fmt.Errorf("bigqueryutil: InferSchema needs a struct, got %T", st)
+	}
+	fields, err := inferFields(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, fmt.Errorf("bigqueryutil: %v", err)
+	}
+	return &bigquery.TableSchema{Fields: fields}, nil
+}
+
+// inferFields returns the columns for struct type t. seen holds the
+// enclosing struct types, to reject recursive types.
+func inferFields(t reflect.Type, seen map[reflect.Type]bool) ([]*bigquery.TableFieldSchema, error) {
+	if seen[t] {
+		return nil, fmt.Errorf("recursive type %v", t)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	var cols []*bigquery.TableFieldSchema
+	for _, f := range structFields(t) {
+		col, err := inferField(f, seen)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", f.name, err)
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("struct %v has no exported fields", t)
+	}
+	return cols, nil
+}
+
+func inferField(f field, seen map[reflect.Type]bool) (*bigquery.TableFieldSchema, error) {
+	col := &bigquery.TableFieldSchema{Name: f.name, Description: f.description, Mode: modeRequired}
+	t := f.typ
+	switch {
+	case t.Kind() == reflect.Ptr:
+		col.Mode = modeNullable
+		t = t.Elem()
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8:
+		col.Mode = modeRepeated
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+			return nil, errors.New("nested repeated fields are not supported")
+		}
+	}
+	if f.nullable && f.required {
+		return nil, errors.New(`both "nullable" and "required" given`)
+	}
+	if col.Mode != modeRepeated {
+		if f.nullable {
+			col.Mode = modeNullable
+		}
+		if f.required {
+			col.Mode = modeRequired
+		}
+	}
+
+	typ, err := columnType(t)
+	if err != nil {
+		return nil, err
+	}
+	if f.colType != "" {
+		if !validOverride(typ, f.colType) {
+			return nil, fmt.Errorf("cannot store %s in a field of type %v", f.colType, t)
+		}
+		typ = f.colType
+	}
+	col.Type = legacyType(typ)
+	if typ == typeStruct {
+		col.Fields, err = inferFields(t, seen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return col, nil
+}
+
+// columnType returns the column type for values of Go type t.
+func columnType(t reflect.Type) (string, error) {
+	switch t {
+	case timeType:
+		return typeTimestamp, nil
+	case ratType:
+		return typeNumeric, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return typeBool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return typeInt64, nil
+	case reflect.Float32, reflect.Float64:
+		return typeFloat64, nil
+	case reflect.String:
+		return typeString, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return typeBytes, nil
+		}
+	case reflect.Struct:
+		return typeStruct, nil
+	}
+	return "", fmt.Errorf("unsupported type %v", t)
+}
+
+// validOverride reports whether a value whose inferred type is inferred can
+// be stored in a column of type override.
+func validOverride(inferred, override string) bool {
+	if inferred == override {
+		return true
+	}
+	switch override {
+	case typeDate, typeDateTime:
+		return inferred == typeString || inferred == typeTimestamp
+	case typeTime, typeGeography, typeNumeric:
+		return inferred == typeString
+	case typeBigNumeric:
+		return inferred == typeString || inferred == typeNumeric
+	}
+	return false
+}
+
+// A SchemaChange describes how an existing table schema must change to hold
+// rows of a desired schema, as computed by CompareSchemas.
+type SchemaChange struct {
+	// Added lists the columns that are new, by their dotted paths (such as
+	// "owner.email" for a column in a RECORD).
+	Added []string
+
+	// Relaxed lists the REQUIRED columns that must become NULLABLE.
+	Relaxed []string
+
+	// Schema is the updated schema: the existing schema with relaxed modes
+	// and the new columns appended.
+	Schema *bigquery.TableSchema
+}
+
+// Empty reports whether the existing schema needs no change.
+func (c *SchemaChange) Empty() bool {
+	return len(c.Added) == 0 && len(c.Relaxed) == 0
+}
+
+// Patch returns the table resource to pass to Tables.Patch to apply the
+// change. To make sure the table has not changed since it was read, set the
+// If-Match header of the call to the table's Etag.
+func (c *SchemaChange) Patch() *bigquery.Table {
+	return &bigquery.Table{Schema: c.Schema}
+}
+
+// CompareSchemas compares the schema of an existing table with a desired
+// schema, such as one returned by InferSchema, and returns the change that
+// makes the table accept rows of the desired schema.
+//
+// Only compatible changes are proposed: adding columns, including to
+// RECORDs, and relaxing REQUIRED columns to NULLABLE. New columns are added
+// as NULLABLE even if the desired schema makes them REQUIRED, since existing
+// rows have no value for them. Columns of the existing schema missing from
+// the desired schema are kept. If the schemas cannot be reconciled this way,
+// because a column changes type or changes to or from REPEATED, the error
+// describes every such problem.
+func CompareSchemas(existing, desired *bigquery.TableSchema) (*SchemaChange, error) {
+	c := &SchemaChange{}
+	var problems []string
+	fields := mergeFields(existing.Fields, desired.Fields, "", c, &problems)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("bigqueryutil: incompatible schemas: %s", strings.Join(problems, "; "))
+	}
+	c.Schema = &bigquery.TableSchema{Fields: fields}
+	return c, nil
+}
+
+// mergeFields returns a copy of existing with the changes needed to accept
+// values of desired, recording them in c, or any incompatibilities in
+// problems.
+func mergeFields(existing, desired []*bigquery.TableFieldSchema, prefix string, c *SchemaChange, problems *[]string) []*bigquery.TableFieldSchema {
+	merged := make([]*bigquery.TableFieldSchema, len(existing))
+	for i, ef := range existing {
+		cp := *ef
+		merged[i] = &cp
+	}
+	for _, df := range desired {
+		path := prefix + df.Name
+		var mf *bigquery.TableFieldSchema
+		for _, f := range merged {
+			if strings.EqualFold(f.Name, df.Name) {
+				mf = f
+				break
+			}
+		}
+		if mf == nil {
+			merged = append(merged, addedField(df))
+			c.Added = append(c.Added, path)
+			continue
+		}
+		et, dt := normalizeType(mf.Type), normalizeType(df.Type)
+		if et != dt {
+			*problems = append(*problems, fmt.Sprintf("column %s has type %s, want %s", path, mf.Type, df.Type))
+			continue
+		}
+		em, dm := mode(mf), mode(df)
+		switch {
+		case em == dm, em == modeNullable && dm == modeRequired:
+		case em == modeRequired && dm == modeNullable:
+			mf.Mode = modeNullable
+			c.Relaxed = append(c.Relaxed, path)
+		default:
+			*problems = append(*problems, fmt.Sprintf("column %s has mode %s, want %s", path, em, dm))
+			continue
+		}
+		if et == typeStruct {
+			mf.Fields = mergeFields(mf.Fields, df.Fields, path+".", c, problems)
+		}
+	}
+	return merged
+}
+
+// addedField returns a copy of f, a column added to a table, in which f and
+// its nested fields are not REQUIRED: existing rows have no values for
+// them.
+func addedField(f *bigquery.TableFieldSchema) *bigquery.TableFieldSchema {
+	nf := *f
+	if mode(f) == modeRequired {
+		nf.Mode = modeNullable
+	}
+	if f.Fields != nil {
+		nf.Fields = make([]*bigquery.TableFieldSchema, len(f.Fields))
+		for i, sf := range f.Fields {
+			nf.Fields[i] = addedField(sf)
+		}
+	}
+	return &nf
+}
+
+// mode returns the mode of f, which defaults to NULLABLE.
+func mode(f *bigquery.TableFieldSchema) string {
+	if f.Mode == "" {
+		return modeNullable
+	}
+	return strings.ToUpper(f.Mode)
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bigqueryutil
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+type address struct {
+	Street string
+	Zip    *string `bigquery:"zip"`
+}
+
+type customer struct {
+	ID         int64     `bigquery:"id" description:"Unique customer ID"`
+	Name       string    `bigquery:"name,nullable"`
+	Balance    *big.Rat  `bigquery:"balance"`
+	Score      float32   `bigquery:"score"`
+	Active     bool      `bigquery:"active"`
+	Photo      []byte    `bigquery:"photo"`
+	Joined     time.Time `bigquery:"joined"`
+	Birthday   time.Time `bigquery:"birthday,type=DATE"`
+	Location   string    `bigquery:"location,type=GEOGRAPHY"`
+	Tags       []string  `bigquery:"tags"`
+	Home       address   `bigquery:"home"`
+	Previous   []*address
+	Referrer   *int   `bigquery:",required"`
+	Ignored    string `bigquery:"-"`
+	unexported int
+}
+
+func TestInferSchema(t *testing.T) {
+	got, err := InferSchema(&customer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addressFields := []*bigquery.TableFieldSchema{
+		{Name: "Street", Type: "STRING", Mode: "REQUIRED"},
+		{Name: "zip", Type: "STRING", Mode: "NULLABLE"},
+	}
+	want := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER", Mode: "REQUIRED", Description: "Unique customer ID"},
+		{Name: "name", Type: "STRING", Mode: "NULLABLE"},
+		{Name: "balance", Type: "NUMERIC", Mode: "NULLABLE"},
+		{Name: "score", Type: "FLOAT", Mode: "REQUIRED"},
+		{Name: "active", Type: "BOOLEAN", Mode: "REQUIRED"},
+		{Name: "photo", Type: "BYTES", Mode: "REQUIRED"},
+		{Name: "joined", Type: "TIMESTAMP", Mode: "REQUIRED"},
+		{Name: "birthday", Type: "DATE", Mode: "REQUIRED"},
+		{Name: "location", Type: "GEOGRAPHY", Mode: "REQUIRED"},
+		{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+		{Name: "home", Type: "RECORD", Mode: "REQUIRED", Fields: addressFields},
+		{Name: "Previous", Type: "RECORD", Mode: "REPEATED", Fields: addressFields},
+		{Name: "Referrer", Type: "INTEGER", Mode: "REQUIRED"},
+	}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("-got +want\n%s", diff)
+	}
+}
+
+func TestInferSchemaErrors(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	for _, v := range []interface{}{
+		nil,
+		3,
+		time.Time{},
+		struct{ M map[string]int }{},
+		struct{ S [][]int }{},
+		struct{}{},
+		node{},
+		struct {
+			D int `bigquery:",type=DATE"`
+		}{},
+		struct {
+			N *int `bigquery:",nullable,required"`
+		}{},
+	} {
+		if s, err := InferSchema(v); err == nil {
+			t.Errorf("%T: got %v, want error", v, s)
+		}
+	}
+}
+
+func TestCompareSchemas(t *testing.T) {
+	existing := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER", Mode: "REQUIRED"},
+		{Name: "name", Type: "STRING", Mode: "REQUIRED"},
+		{Name: "legacy", Type: "STRING"},
+		{Name: "home", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{
+			{Name: "street", Type: "STRING"},
+		}},
+	}}
+	type home struct {
+		Street string `bigquery:"street,nullable"`
+		Zip    string `bigquery:"zip"`
+	}
+	type row struct {
+		ID    int64    `bigquery:"ID"`
+		Name  *string  `bigquery:"name"`
+		Email string   `bigquery:"email"`
+		Tags  []string `bigquery:"tags"`
+		Home  *home    `bigquery:"home"`
+	}
+	desired, err := InferSchema(row{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := CompareSchemas(existing, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Empty() {
+		t.Fatal("got empty change")
+	}
+	if want := []string{"email", "tags", "home.zip"}; !cmp.Equal(c.Added, want) {
+		t.Errorf("Added: got %v, want %v", c.Added, want)
+	}
+	if want := []string{"name"}; !cmp.Equal(c.Relaxed, want) {
+		t.Errorf("Relaxed: got %v, want %v", c.Relaxed, want)
+	}
+	want := &bigquery.Table{Schema: &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER", Mode: "REQUIRED"},
+		{Name: "name", Type: "STRING", Mode: "NULLABLE"},
+		{Name: "legacy", Type: "STRING"},
+		{Name: "home", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{
+			{Name: "street", Type: "STRING"},
+			{Name: "zip", Type: "STRING", Mode: "NULLABLE"},
+		}},
+		{Name: "email", Type: "STRING", Mode: "NULLABLE"},
+		{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+	}}}
+	if diff := cmp.Diff(c.Patch(), want); diff != "" {
+		t.Errorf("Patch: -got +want\n%s", diff)
+	}
+	// The existing schema is not modified.
+	if existing.Fields[1].Mode != "REQUIRED" || len(existing.Fields[3].Fields) != 1 {
+		t.Errorf("existing schema modified: %+v", existing.Fields)
+	}
+
+	// Comparing the result with the desired schema finds nothing to do.
+	c, err = CompareSchemas(c.Schema, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Empty() {
+		t.Errorf("second comparison: got %+v, want empty", c)
+	}
+}
+
+func TestCompareSchemasAddedRecord(t *testing.T) {
+	existing := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER", Mode: "REQUIRED"},
+	}}
+	desired := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER", Mode: "REQUIRED"},
+		{Name: "home", Type: "RECORD", Mode: "REQUIRED", Fields: []*bigquery.TableFieldSchema{
+			{Name: "street", Type: "STRING", Mode: "REQUIRED"},
+			{Name: "geo", Type: "RECORD", Mode: "REQUIRED", Fields: []*bigquery.TableFieldSchema{
+				{Name: "lat", Type: "FLOAT", Mode: "REQUIRED"},
+				{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+			}},
+		}},
+	}}
+	c, err := CompareSchemas(existing, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Existing rows have no values for the fields of the new column.
+	want := []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER", Mode: "REQUIRED"},
+		{Name: "home", Type: "RECORD", Mode: "NULLABLE", Fields: []*bigquery.TableFieldSchema{
+			{Name: "street", Type: "STRING", Mode: "NULLABLE"},
+			{Name: "geo", Type: "RECORD", Mode: "NULLABLE", Fields: []*bigquery.TableFieldSchema{
+				{Name: "lat", Type: "FLOAT", Mode: "NULLABLE"},
+				{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+			}},
+		}},
+	}
+	if diff := cmp.Diff(want, c.Schema.Fields); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	// The desired schema is not modified.
+	if desired.Fields[1].Fields[0].Mode != "REQUIRED" {
+		t.Errorf("desired schema modified: %+v", desired.Fields[1].Fields[0])
+	}
+}
+
+func TestCompareSchemasErrors(t *testing.T) {
+	existing := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "a", Type: "INTEGER"},
+		{Name: "b", Type: "STRING", Mode: "REPEATED"},
+		{Name: "c", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{{Name: "d", Type: "BOOL"}}},
+	}}
+	desired := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "a", Type: "STRING"},
+		{Name: "b", Type: "STRING"},
+		{Name: "c", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{{Name: "d", Type: "INT64"}}},
+	}}
+	_, err := CompareSchemas(existing, desired)
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	for _, want := range []string{"column a", "column b", "column c.d"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
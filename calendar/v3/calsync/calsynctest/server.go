@@ -0,0 +1,256 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package calsynctest provides a fake of the Events.List method of the
+// Calendar API, with sync tokens, for testing code that syncs calendars
+// with package calsync.
+//
+// A Server is an http.Handler; the calendar.Service of the code under test
+// is pointed at it with options:
+//
+//	srv := calsynctest.NewServer()
+//	ts := httptest.NewServer(srv)
+//	defer ts.Close()
+//	svc, err := calendar.NewService(ctx, option.WithEndpoint(ts.URL+"/"), option.WithHTTPClient(ts.Client()))
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	srv.Put("primary", &calendar.Event{Summary: "Standup"})
+//
+// This package is experimental and subject to change without notice.
+package calsynctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	calendar "google.golang.org/api/calendar/v3"
+)
+
+// DefaultMaxResults is the number of events a Server lists per page if the
+// request does not say.
+const DefaultMaxResults = 250
+
+// A Server serves the events of calendars, and the changes to them, as
+// Events.List does. It does not expand recurring events: the events it
+// holds are listed as they are whether or not singleEvents is set, so tests
+// of expanded listings put the instances themselves.
+//
+// Changes made while a listing is paged may be listed again by the next
+// sync, as the real server may do.
+type Server struct {
+	// Now returns the time of the server, used for the creation and update
+	// times of events and the Date header of responses. The default is
+	// time.Now. It is only safe to set before the Server is used.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	calendars map[string]map[string]*entry
+	seq       int64 // the number of the last change
+	expired   int64 // the number of the last change of expired sync tokens
+	ids       int
+}
+
+// An entry is an event and the number of the change that last changed it.
+type entry struct {
+	event *calendar.Event
+	seq   int64
+}
+
+// NewServer returns a Server with no events.
+func NewServer() *Server {
+	return &Server{
+		Now:       time.Now,
+		calendars: make(map[string]map[string]*entry),
+		expired:   -1,
+	}
+}
+
+// Put adds e to the calendar with the given ID, replacing the event with
+// the same ID, and returns the event as stored: it gets an ID if it has
+// none, and its creation time, update time and etag are set.
+func (s *Server) Put(calendarID string, e *calendar.Event) *calendar.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.calendars[calendarID]
+	if events == nil {
+		events = make(map[string]*entry)
+		s.calendars[calendarID] = events
+	}
+	c := *e
+	if c.Id == "" {
+		s.ids++
+		c.Id = "event" + strconv.Itoa(s.ids)
+	}
+	now := s.Now().UTC().Format(time.RFC3339Nano)
+	c.Created = now
+	if old, ok := events[c.Id]; ok && old.event.Status != "cancelled" {
+		c.Created = old.event.Created
+	}
+	c.Updated = now
+	if c.Status == "" {
+		c.Status = "confirmed"
+	}
+	s.seq++
+	c.Etag = strconv.Quote(strconv.FormatInt(s.seq, 10))
+	events[c.Id] = &entry{event: &c, seq: s.seq}
+	r := c
+	return &r
+}
+
+// Cancel deletes the event with the given ID from the calendar, leaving a
+// cancelled event in its place as the real server does. It reports whether
+// there was such an event.
+func (s *Server) Cancel(calendarID, eventID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	en, ok := s.calendars[calendarID][eventID]
+	if !ok || en.event.Status == "cancelled" {
+		return false
+	}
+	s.seq++
+	en.seq = s.seq
+	en.event = &calendar.Event{
+		Id:                en.event.Id,
+		Status:            "cancelled",
+		RecurringEventId:  en.event.RecurringEventId,
+		OriginalStartTime: en.event.OriginalStartTime,
+	}
+	return true
+}
+
+// ExpireSyncTokens makes the sync tokens issued so far expire: listings
+// with them fail with status 410, as on the real server.
+func (s *Server) ExpireSyncTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expired = s.seq
+	// Tokens issued from now on are for later changes.
+	s.seq++
+}
+
+// The parameters that cannot be used with a sync token.
+var syncTokenConflicts = []string{"iCalUID", "orderBy", "privateExtendedProperty", "q", "sharedExtendedProperty", "timeMin", "timeMax", "updatedMin"}
+
+// ServeHTTP serves the requests of Events.List.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Date", s.Now().UTC().Format(http.TimeFormat))
+	i := strings.Index(r.URL.Path, "/calendars/")
+	if r.Method != "GET" || i < 0 || !strings.HasSuffix(r.URL.Path, "/events") {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+	calendarID := strings.TrimSuffix(r.URL.Path[i+len("/calendars/"):], "/events")
+	events, ok := s.calendars[calendarID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "Not Found")
+		return
+	}
+	q := r.URL.Query()
+
+	// Listing starts after the change with number since, for the state
+	// after the change with number until, and resumes after the event
+	// with ID after; page tokens hold all three.
+	since := int64(-1)
+	until := s.seq
+	var after string
+	if tok := q.Get("syncToken"); tok != "" {
+		for _, p := range syncTokenConflicts {
+			if q.Get(p) != "" {
+				writeError(w, http.StatusBadRequest, "invalidParameter", "Parameter "+p+" cannot be used with syncToken.")
+				return
+			}
+		}
+		if q.Get("showDeleted") == "false" {
+			writeError(w, http.StatusBadRequest, "invalidParameter", "showDeleted cannot be false with syncToken.")
+			return
+		}
+		n, err := strconv.ParseInt(strings.TrimPrefix(tok, "sync"), 10, 64)
+		if err != nil || !strings.HasPrefix(tok, "sync") || n > s.seq {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid sync token value.")
+			return
+		}
+		since = n
+	}
+	if tok := q.Get("pageToken"); tok != "" {
+		parts := strings.SplitN(tok, ":", 3)
+		var err1, err2 error
+		if len(parts) == 3 {
+			since, err1 = strconv.ParseInt(parts[0], 10, 64)
+			until, err2 = strconv.ParseInt(parts[1], 10, 64)
+			after = parts[2]
+		}
+		if len(parts) != 3 || err1 != nil || err2 != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid page token value.")
+			return
+		}
+	}
+	if since >= 0 && since <= s.expired {
+		writeError(w, http.StatusGone, "fullSyncRequired", "Sync token is no longer valid, a full sync is required.")
+		return
+	}
+	max := DefaultMaxResults
+	if v := q.Get("maxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid value for maxResults.")
+			return
+		}
+		max = n
+	}
+
+	var ids []string
+	for id, en := range events {
+		if id <= after {
+			continue
+		}
+		if since >= 0 && en.seq <= since {
+			continue
+		}
+		if since < 0 && en.event.Status == "cancelled" && q.Get("showDeleted") != "true" {
+			// Like the real server, a full listing includes cancelled
+			// instances of recurring events unless it expands them.
+			if en.event.RecurringEventId == "" || q.Get("singleEvents") == "true" {
+				continue
+			}
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	res := &calendar.Events{Kind: "calendar#events", Items: []*calendar.Event{}}
+	if len(ids) > max {
+		ids = ids[:max]
+		res.NextPageToken = fmt.Sprintf("%d:%d:%s", since, until, ids[max-1])
+	} else {
+		res.NextSyncToken = "sync" + strconv.FormatInt(until, 10)
+	}
+	for _, id := range ids {
+		res.Items = append(res.Items, events[id].event)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// writeError writes an error response in the format of the Calendar API.
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors": []map[string]string{
+				{"domain": "calendar", "reason": reason, "message": message},
+			},
+		},
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calsynctest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/testserver"
+)
+
+// list lists the events of the calendar "primary" in pages of two events,
+// and returns their IDs and the sync token.
+func list(ctx context.Context, svc *calendar.Service, syncToken string) ([]string, string, error) {
+	call := svc.Events.List("primary").MaxResults(2)
+	if syncToken != "" {
+		call.SyncToken(syncToken)
+	}
+	var ids []string
+	var next string
+	err := call.Pages(ctx, func(res *calendar.Events) error {
+		for _, e := range res.Items {
+			ids = append(ids, e.Id+" "+e.Status)
+		}
+		next = res.NextSyncToken
+		return nil
+	})
+	return ids, next, err
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer()
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	srv.Now = func() time.Time { return now }
+	s, stop := testserver.NewService(t, srv, calendar.NewService)
+	defer stop()
+	svc := s.(*calendar.Service)
+
+	e := srv.Put("primary", &calendar.Event{Summary: "A"})
+	want := &calendar.Event{
+		Id:      "event1",
+		Summary: "A",
+		Status:  "confirmed",
+		Created: "2020-06-01T10:00:00Z",
+		Updated: "2020-06-01T10:00:00Z",
+		Etag:    `"1"`,
+	}
+	if diff := cmp.Diff(want, e); diff != "" {
+		t.Errorf("Put mismatch (-want +got):\n%s", diff)
+	}
+	srv.Put("primary", &calendar.Event{Summary: "B"})
+	srv.Put("primary", &calendar.Event{Summary: "C"})
+	srv.Cancel("primary", "event3")
+
+	ids, tok1, err := list(ctx, svc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"event1 confirmed", "event2 confirmed"}, ids); diff != "" {
+		t.Errorf("full listing mismatch (-want +got):\n%s", diff)
+	}
+
+	now = now.Add(time.Hour)
+	e = srv.Put("primary", &calendar.Event{Id: "event1", Summary: "A, renamed"})
+	if e.Created != "2020-06-01T10:00:00Z" || e.Updated != "2020-06-01T11:00:00Z" {
+		t.Errorf("updated event created %s and updated %s", e.Created, e.Updated)
+	}
+	srv.Cancel("primary", "event2")
+	ids, tok2, err := list(ctx, svc, tok1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"event1 confirmed", "event2 cancelled"}, ids); diff != "" {
+		t.Errorf("incremental listing mismatch (-want +got):\n%s", diff)
+	}
+
+	srv.ExpireSyncTokens()
+	for _, tok := range []string{tok1, tok2} {
+		_, _, err = list(ctx, svc, tok)
+		if e, ok := err.(*googleapi.Error); !ok || e.Code != 410 {
+			t.Errorf("listing with expired token %q: got %v, want status 410", tok, err)
+		}
+	}
+	_, tok3, err := list(ctx, svc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := list(ctx, svc, tok3); err != nil {
+		t.Errorf("listing with new token: %v", err)
+	}
+
+	for _, call := range []*calendar.EventsListCall{
+		svc.Events.List("primary").SyncToken(tok3).Q("standup"),
+		svc.Events.List("primary").SyncToken(tok3).ShowDeleted(false),
+		svc.Events.List("primary").SyncToken("bogus"),
+		svc.Events.List("primary").PageToken("bogus"),
+	} {
+		_, err := call.Do()
+		if e, ok := err.(*googleapi.Error); !ok || e.Code != 400 {
+			t.Errorf("got %v, want status 400", err)
+		}
+	}
+	if _, err := svc.Events.List("other").Do(); err == nil {
+		t.Error("listing unknown calendar: got nil error")
+	}
+}
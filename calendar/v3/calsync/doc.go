@@ -0,0 +1,35 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package calsync keeps a copy of the events of Google calendars in sync
+// with the Calendar API (google.golang.org/api/calendar/v3), using the
+// sync tokens of Events.List.
+//
+// A Syncer reports the events created, updated and cancelled since the last
+// sync of a calendar, paging through the changes and keeping the sync token
+// of the calendar in a TokenStore: a MemoryStore, a FileStore, or any other
+// implementation. The first sync of a calendar lists all its events, and so
+// does a sync after the sync token has expired, which the server tells with
+// status 410. For example:
+//
+//	s := calsync.NewSyncer(svc, calsync.NewFileStore("tokens.json"))
+//	res, err := s.Sync(ctx, "primary", func(c *calsync.Change) error {
+//		switch c.Type {
+//		case calsync.Cancelled:
+//			return deleteLocal(c.Event.Id)
+//		default:
+//			return saveLocal(c.Event)
+//		}
+//	})
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	if res.Full {
+//		// TODO: Delete the local events that were not reported.
+//	}
+//
+// Package calsynctest provides a fake server to test such code with.
+//
+// This package is experimental and subject to change without notice.
+package calsync
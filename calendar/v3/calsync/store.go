@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Token is what a Syncer keeps of a sync of a calendar for the next one.
+type Token struct {
+	// SyncToken is the sync token the sync ended with.
+	SyncToken string
+
+	// Time is the time of the server when the sync started. Events created
+	// since then are reported as created by the next sync.
+	Time time.Time
+}
+
+// A TokenStore saves the tokens of a Syncer between syncs.
+//
+// The keys of the tokens are the IDs of the calendars synced, followed by
+// "?singleEvents=true" for Syncers that expand recurring events, since
+// their sync tokens cannot be used for listings of the other kind.
+type TokenStore interface {
+	// Load returns the token saved for key, or nil if there is none.
+	Load(ctx context.Context, key string) (*Token, error)
+
+	// Save saves t for key, replacing the token saved before.
+	Save(ctx context.Context, key string, t *Token) error
+}
+
+// A MemoryStore is a TokenStore that keeps tokens in memory, for programs
+// that sync calendars while they run, and for tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]Token)}
+}
+
+// Load implements TokenStore.Load.
+func (m *MemoryStore) Load(ctx context.Context, key string) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// Save implements TokenStore.Save.
+func (m *MemoryStore) Save(ctx context.Context, key string, t *Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[key] = *t
+	return nil
+}
+
+// A FileStore is a TokenStore that keeps tokens in a JSON file. A FileStore
+// may be used by several goroutines, but not by several programs, at the
+// same time.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore returns a FileStore that keeps tokens in the file with the
+// given path. The file is created by the first Save.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load implements TokenStore.Load.
+func (fs *FileStore) Load(ctx context.Context, key string) (*Token, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	tokens, err := fs.read()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// Save implements TokenStore.Save. It replaces the file only once the new
+// file is fully written.
+func (fs *FileStore) Save(ctx context.Context, key string, t *Token) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	tokens, err := fs.read()
+	if err != nil {
+		return err
+	}
+	tokens[key] = t
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("calsync: saving tokens: %v", err)
+	}
+	tmp := fs.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err == nil {
+		err = os.Rename(tmp, fs.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("calsync: saving tokens: %v", err)
+	}
+	return nil
+}
+
+// read returns the tokens in the file, or none if there is no file.
+func (fs *FileStore) read() (map[string]*Token, error) {
+	tokens := make(map[string]*Token)
+	data, err := ioutil.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("calsync: loading tokens: %v", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("calsync: loading tokens from %s: %v", fs.path, err)
+	}
+	return tokens, nil
+}
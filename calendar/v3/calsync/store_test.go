@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calsync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testStore tests the loading and saving of tokens of an empty store.
+func testStore(t *testing.T, store TokenStore) {
+	ctx := context.Background()
+	t1 := &Token{SyncToken: "t1", Time: time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)}
+	t2 := &Token{SyncToken: "t2", Time: time.Date(2020, 6, 2, 10, 0, 0, 0, time.UTC)}
+	for _, save := range []struct {
+		key string
+		tok *Token
+	}{
+		{"primary", t1},
+		{"primary?singleEvents=true", t1},
+		{"primary", t2},
+	} {
+		if err := store.Save(ctx, save.key, save.tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, want := range map[string]*Token{
+		"primary":                   t2,
+		"primary?singleEvents=true": t1,
+		"other":                     nil,
+	} {
+		got, err := store.Load(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Load(%q) mismatch (-want +got):\n%s", key, diff)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tokens.json")
+	testStore(t, NewFileStore(path))
+
+	// The tokens outlive the store.
+	got, err := NewFileStore(path).Load(context.Background(), "primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.SyncToken != "t2" {
+		t.Errorf("got %+v, want token t2", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path).Load(context.Background(), "primary"); err == nil {
+		t.Error("got nil error loading a corrupted file")
+	}
+}
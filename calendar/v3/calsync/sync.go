@@ -0,0 +1,245 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calsync
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/retry"
+)
+
+const (
+	// DefaultPageSize is the default number of events a Syncer reads per
+	// request.
+	DefaultPageSize = 250
+
+	// DefaultMaxAttempts is the default number of times a Syncer tries a
+	// request.
+	DefaultMaxAttempts = retry.DefaultMaxAttempts
+)
+
+// A ChangeType is a kind of change to an event.
+type ChangeType int
+
+// The types of changes.
+const (
+	// Created is the type of the changes of events that are new to the
+	// caller.
+	Created ChangeType = iota + 1
+
+	// Updated is the type of the changes of events the caller was told
+	// about by an earlier sync.
+	Updated
+
+	// Cancelled is the type of the changes of events that were deleted or
+	// cancelled, and of cancelled instances of recurring events.
+	Cancelled
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Created:
+		return "created"
+	case Updated:
+		return "updated"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "ChangeType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// A Change is a change to an event of a calendar.
+type Change struct {
+	Type ChangeType
+
+	// Event is the event as listed. The event of a Cancelled change may
+	// have only its ID and status, and, if it is an instance of a recurring
+	// event, its RecurringEventId and OriginalStartTime.
+	Event *calendar.Event
+}
+
+// A Result describes a sync.
+type Result struct {
+	// Full reports whether all the events of the calendar were listed,
+	// because it had not been synced before or its sync token had expired.
+	// The caller should then forget the events it was not told about.
+	Full bool
+
+	// Created, Updated and Cancelled are the numbers of changes of each
+	// type.
+	Created, Updated, Cancelled int
+}
+
+// A Syncer reads the changes to the events of calendars with Events.List,
+// keeping the sync tokens of the calendars in a TokenStore.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Sync.
+type Syncer struct {
+	// SingleEvents reports whether recurring events are expanded into their
+	// instances. If so, the changes of a recurring event are reported as
+	// changes of each of its instances. If not, a recurring event is
+	// reported once, with its recurrence rules, and its exceptions as
+	// events with a RecurringEventId; a cancelled instance of a recurring
+	// event is then a Cancelled change of an exception, which does not
+	// cancel the recurring event.
+	SingleEvents bool
+
+	// PageSize is the number of events read per request. The default is
+	// DefaultPageSize.
+	PageSize int64
+
+	// MaxAttempts is the number of times a request that fails with a
+	// transient error or an exceeded rate limit is tried. The default is
+	// DefaultMaxAttempts.
+	MaxAttempts int
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	svc   *calendar.Service
+	store TokenStore
+}
+
+// NewSyncer returns a Syncer that keeps its sync tokens in store.
+func NewSyncer(svc *calendar.Service, store TokenStore) *Syncer {
+	return &Syncer{
+		PageSize:    DefaultPageSize,
+		MaxAttempts: DefaultMaxAttempts,
+		svc:         svc,
+		store:       store,
+	}
+}
+
+// Sync calls f with each change to the events of the calendar with the
+// given ID since the last sync of the calendar, and saves the sync token
+// for the next one. If the calendar has not been synced, or its sync token
+// has expired, Sync lists all its events instead, as Created changes, and
+// the Full field of the result is set; it then leaves out events deleted
+// before the sync, except for cancelled instances of recurring events if
+// SingleEvents is not set.
+//
+// Events created since the previous sync started are reported as Created,
+// and others as Updated, as told by their creation time and the time of
+// the server. An event created at about the time the previous sync started
+// may be reported as Created twice.
+//
+// If f returns an error, Sync stops and returns it. The token is saved
+// only once f has been called with every change, so the changes of a sync
+// that fails are reported again by the next one.
+func (s *Syncer) Sync(ctx context.Context, calendarID string, f func(*Change) error) (*Result, error) {
+	key := calendarID
+	if s.SingleEvents {
+		key += "?singleEvents=true"
+	}
+	prev, err := s.store.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && prev.SyncToken == "" {
+		prev = nil
+	}
+	res, next, err := s.list(ctx, calendarID, prev, f)
+	if prev != nil && isExpiredSyncToken(err) {
+		res, next, err = s.list(ctx, calendarID, nil, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Save(ctx, key, next); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// list calls f with each change since the sync that returned prev, or with
+// every event if prev is nil, and returns the token for the next sync.
+func (s *Syncer) list(ctx context.Context, calendarID string, prev *Token, f func(*Change) error) (*Result, *Token, error) {
+	size := s.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	call := s.svc.Events.List(calendarID).MaxResults(size)
+	if s.SingleEvents {
+		call.SingleEvents(true)
+	}
+	if prev != nil {
+		call.SyncToken(prev.SyncToken)
+	}
+	res := &Result{Full: prev == nil}
+	next := &Token{}
+	for {
+		var page *calendar.Events
+		err := retry.Do(ctx, s.Backoff, s.MaxAttempts, func() error {
+			var err error
+			page, err = call.Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if next.Time.IsZero() {
+			next.Time = serverTime(page.Header)
+		}
+		for _, e := range page.Items {
+			c := &Change{Type: changeType(e, prev), Event: e}
+			if err := f(c); err != nil {
+				return nil, nil, err
+			}
+			switch c.Type {
+			case Created:
+				res.Created++
+			case Updated:
+				res.Updated++
+			case Cancelled:
+				res.Cancelled++
+			}
+		}
+		if page.NextPageToken == "" {
+			next.SyncToken = page.NextSyncToken
+			return res, next, nil
+		}
+		call.PageToken(page.NextPageToken)
+	}
+}
+
+// changeType returns the type of the change of e since the sync that
+// returned prev, or in a full sync if prev is nil.
+func changeType(e *calendar.Event, prev *Token) ChangeType {
+	if e.Status == "cancelled" {
+		return Cancelled
+	}
+	if prev == nil {
+		return Created
+	}
+	created, err := time.Parse(time.RFC3339, e.Created)
+	if err != nil || created.Before(prev.Time) {
+		return Updated
+	}
+	return Created
+}
+
+// serverTime returns the time of the Date header of a response, or the
+// time of the local clock if there is none. The header is rounded down to
+// the second, which errs toward reporting events as created.
+func serverTime(h http.Header) time.Time {
+	if t, err := http.ParseTime(h.Get("Date")); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// isExpiredSyncToken reports whether err is the error of a sync token that
+// is too old, after which a full sync is required.
+func isExpiredSyncToken(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == 410
+}
@@ -0,0 +1,257 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package calsync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/calendar/v3/calsync/calsynctest"
+	"google.golang.org/api/internal/testserver"
+)
+
+// A clock is the clock of a fake server, moved by tests.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// flaky fails the first n requests with status 503, and serves the others
+// with h.
+type flaky struct {
+	mu sync.Mutex
+	n  int
+	h  http.Handler
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	fail := f.n > 0
+	f.n--
+	f.mu.Unlock()
+	if fail {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	f.h.ServeHTTP(w, r)
+}
+
+// newTestServer returns a fake server with a calendar "primary" that holds
+// two single events, a recurring event and an exception of it, created a
+// minute ago.
+func newTestServer() (*calsynctest.Server, *clock) {
+	clk := &clock{t: time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)}
+	srv := calsynctest.NewServer()
+	srv.Now = clk.now
+	srv.Put("primary", &calendar.Event{Id: "a", Summary: "A"})
+	srv.Put("primary", &calendar.Event{Id: "b", Summary: "B"})
+	srv.Put("primary", &calendar.Event{Id: "r", Summary: "Weekly", Recurrence: []string{"RRULE:FREQ=WEEKLY"}})
+	srv.Put("primary", &calendar.Event{
+		Id:                "r_20200608T100000Z",
+		Summary:           "Weekly, later",
+		RecurringEventId:  "r",
+		OriginalStartTime: &calendar.EventDateTime{DateTime: "2020-06-08T10:00:00Z"},
+	})
+	clk.advance(time.Minute)
+	return srv, clk
+}
+
+// syncPrimary syncs the calendar "primary", and returns the result and the
+// changes reported, as types and IDs.
+func syncPrimary(t *testing.T, s *Syncer) (*Result, []string) {
+	t.Helper()
+	var changes []string
+	res, err := s.Sync(context.Background(), "primary", func(c *Change) error {
+		changes = append(changes, c.Type.String()+" "+c.Event.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, changes
+}
+
+func TestSync(t *testing.T) {
+	srv, clk := newTestServer()
+	svc, done := testserver.NewService(t, &flaky{n: 1, h: srv}, calendar.NewService)
+	defer done()
+	s := NewSyncer(svc.(*calendar.Service), NewMemoryStore())
+	s.PageSize = 2
+	s.Backoff = gax.Backoff{Initial: time.Millisecond}
+
+	for _, test := range []struct {
+		name        string
+		change      func()
+		wantResult  *Result
+		wantChanges []string
+	}{
+		{
+			name:       "first",
+			change:     func() {},
+			wantResult: &Result{Full: true, Created: 4},
+			wantChanges: []string{
+				"created a",
+				"created b",
+				"created r",
+				"created r_20200608T100000Z",
+			},
+		},
+		{
+			name: "changes",
+			change: func() {
+				clk.advance(time.Hour)
+				srv.Put("primary", &calendar.Event{Id: "a", Summary: "A, renamed"})
+				srv.Put("primary", &calendar.Event{Id: "c", Summary: "C"})
+				srv.Cancel("primary", "b")
+				srv.Cancel("primary", "r_20200608T100000Z")
+			},
+			wantResult: &Result{Created: 1, Updated: 1, Cancelled: 2},
+			wantChanges: []string{
+				"updated a",
+				"cancelled b",
+				"created c",
+				"cancelled r_20200608T100000Z",
+			},
+		},
+		{
+			name:       "no changes",
+			change:     func() {},
+			wantResult: &Result{},
+		},
+		{
+			name: "expired",
+			change: func() {
+				clk.advance(time.Hour)
+				srv.ExpireSyncTokens()
+				srv.Put("primary", &calendar.Event{Id: "d", Summary: "D"})
+			},
+			wantResult: &Result{Full: true, Created: 4, Cancelled: 1},
+			wantChanges: []string{
+				"created a",
+				"created c",
+				"created d",
+				"created r",
+				"cancelled r_20200608T100000Z",
+			},
+		},
+		{
+			name: "after expired",
+			change: func() {
+				clk.advance(time.Hour)
+				srv.Put("primary", &calendar.Event{Id: "c", Summary: "C, renamed"})
+			},
+			wantResult:  &Result{Updated: 1},
+			wantChanges: []string{"updated c"},
+		},
+	} {
+		test.change()
+		res, changes := syncPrimary(t, s)
+		if diff := cmp.Diff(test.wantResult, res); diff != "" {
+			t.Errorf("%s: result mismatch (-want +got):\n%s", test.name, diff)
+		}
+		if diff := cmp.Diff(test.wantChanges, changes); diff != "" {
+			t.Errorf("%s: changes mismatch (-want +got):\n%s", test.name, diff)
+		}
+	}
+}
+
+func TestSyncError(t *testing.T) {
+	srv, clk := newTestServer()
+	store := NewMemoryStore()
+	svc, done := testserver.NewService(t, srv, calendar.NewService)
+	defer done()
+	s := NewSyncer(svc.(*calendar.Service), store)
+	s.PageSize = 2
+	s.Backoff = gax.Backoff{Initial: time.Millisecond}
+	syncPrimary(t, s)
+
+	clk.advance(time.Hour)
+	srv.Put("primary", &calendar.Event{Id: "a", Summary: "A, renamed"})
+	srv.Put("primary", &calendar.Event{Id: "c", Summary: "C"})
+	errFailed := errors.New("failed")
+	_, err := s.Sync(context.Background(), "primary", func(c *Change) error {
+		if c.Event.Id == "c" {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Fatalf("got %v, want %v", err, errFailed)
+	}
+
+	// The changes are reported again.
+	_, changes := syncPrimary(t, s)
+	if diff := cmp.Diff([]string{"updated a", "created c"}, changes); diff != "" {
+		t.Errorf("changes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSyncSingleEvents(t *testing.T) {
+	srv, _ := newTestServer()
+	srv.Cancel("primary", "r_20200608T100000Z")
+	store := NewMemoryStore()
+	svc, done := testserver.NewService(t, srv, calendar.NewService)
+	defer done()
+	s := NewSyncer(svc.(*calendar.Service), store)
+	s.PageSize = 2
+	s.Backoff = gax.Backoff{Initial: time.Millisecond}
+	syncPrimary(t, s)
+
+	// The sync tokens of expanded listings are kept apart.
+	s.SingleEvents = true
+	res, changes := syncPrimary(t, s)
+	if !res.Full {
+		t.Error("first sync of single events is not full")
+	}
+	// Cancelled instances are left out of full expanded listings.
+	if diff := cmp.Diff([]string{"created a", "created b", "created r"}, changes); diff != "" {
+		t.Errorf("changes mismatch (-want +got):\n%s", diff)
+	}
+	for _, key := range []string{"primary", "primary?singleEvents=true"} {
+		if tok, err := store.Load(context.Background(), key); err != nil || tok == nil {
+			t.Errorf("Load(%q) = %v, %v, want a token", key, tok, err)
+		}
+	}
+}
+
+func TestChangeType(t *testing.T) {
+	prev := &Token{SyncToken: "t", Time: time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)}
+	for _, test := range []struct {
+		event *calendar.Event
+		prev  *Token
+		want  ChangeType
+	}{
+		{&calendar.Event{Status: "cancelled"}, prev, Cancelled},
+		{&calendar.Event{Status: "cancelled"}, nil, Cancelled},
+		{&calendar.Event{Status: "confirmed", Created: "2020-01-01T00:00:00Z"}, nil, Created},
+		{&calendar.Event{Status: "confirmed", Created: "2020-06-01T09:59:59.999Z"}, prev, Updated},
+		{&calendar.Event{Status: "confirmed", Created: "2020-06-01T10:00:00Z"}, prev, Created},
+		{&calendar.Event{Status: "tentative", Created: "2020-06-01T12:00:00+02:00"}, prev, Created},
+		{&calendar.Event{Status: "confirmed"}, prev, Updated},
+	} {
+		if got := changeType(test.event, test.prev); got != test.want {
+			t.Errorf("changeType(%+v, %v) = %v, want %v", test.event, test.prev, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ical converts Calendar API events (google.golang.org/api/calendar/v3)
+// to and from iCalendar (RFC 5545) files, and imports them into a calendar.
+//
+// Parse reads the VEVENTs of an iCalendar file, with their times and time
+// zones, recurrence rules and exceptions, attendees and alarms, and
+// Calendar.Write writes events as VEVENTs with a VTIMEZONE for each time
+// zone. Time zones are resolved from IANA and Windows names, as written by
+// Exchange and Outlook, or else from their VTIMEZONE definitions.
+//
+// For example, to import a file exported from another calendar system:
+//
+//	cal, err := ical.Parse(f)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	results, err := ical.NewImporter(svc, "primary").Import(ctx, cal.Events)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	for _, r := range results {
+//		if r.Err != nil {
+//			log.Printf("%s: %v", r.Event.ICalUID, r.Err)
+//		}
+//	}
+//
+// This package is experimental and subject to change without notice.
+package ical
@@ -0,0 +1,731 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	calendar "google.golang.org/api/calendar/v3"
+)
+
+// DefaultProdID is the PRODID of the calendars Write writes if they have
+// none.
+const DefaultProdID = "-//Google LLC//Calendar API Go Client//EN"
+
+// A Calendar is an iCalendar object of events.
+type Calendar struct {
+	// ProdID identifies the product that wrote the calendar.
+	ProdID string
+
+	// Method is the iTIP method of the calendar, such as PUBLISH, if any.
+	Method string
+
+	// Name is the name of the calendar, from its X-WR-CALNAME property.
+	Name string
+
+	// TimeZone is the IANA name of the time zone of the calendar, from its
+	// X-WR-TIMEZONE property. Times with no time zone, other than dates,
+	// are in this time zone, or else in UTC.
+	TimeZone string
+
+	// Events are the events of the calendar. An exception to a recurring
+	// event has the iCalUID of the recurring event and an
+	// OriginalStartTime. Parse cannot know the ID of the recurring event,
+	// so it leaves RecurringEventId empty; the Importer fills it in.
+	Events []*calendar.Event
+}
+
+// Parse reads an iCalendar object (RFC 5545) and returns its events. The
+// events of several calendars in r are returned as one calendar, with the
+// properties of the first.
+//
+// Times with a TZID parameter have the IANA name of the time zone as their
+// TimeZone, when it can be told from the TZID or from the VTIMEZONE of the
+// TZID; otherwise, their DateTime has the UTC offset given by the rules of
+// the VTIMEZONE and they have no TimeZone. The TZIDs of the RDATE and
+// EXDATE rules of an event are changed in the same way, or to UTC.
+//
+// Alarms that are relative to the start of an event become reminders. An
+// event with alarms has reminders that override the defaults of the
+// calendar; an event with none uses the defaults.
+func Parse(r io.Reader) (*Calendar, error) {
+	comps, err := parseComponents(r)
+	if err != nil {
+		return nil, err
+	}
+	var cal *Calendar
+	for _, c := range comps {
+		if c.name != "VCALENDAR" {
+			return nil, fmt.Errorf("ical: line %d: got %s, want VCALENDAR", c.line, c.name)
+		}
+		if cal == nil {
+			cal = &Calendar{
+				ProdID:   c.text("PRODID"),
+				Method:   c.text("METHOD"),
+				Name:     c.text("X-WR-CALNAME"),
+				TimeZone: c.text("X-WR-TIMEZONE"),
+			}
+		}
+		d := &decoder{
+			vtimezones: make(map[string]*component),
+			zones:      make(map[string]*zone),
+		}
+		if tz := c.text("X-WR-TIMEZONE"); tz != "" {
+			d.floating, _ = resolveZone(tz, nil)
+		}
+		for _, sub := range c.comps {
+			if sub.name == "VTIMEZONE" {
+				d.vtimezones[sub.text("TZID")] = sub
+			}
+		}
+		for _, sub := range c.comps {
+			if sub.name != "VEVENT" {
+				continue
+			}
+			e, err := d.event(sub)
+			if err != nil {
+				return nil, fmt.Errorf("ical: %v", err)
+			}
+			cal.Events = append(cal.Events, e)
+		}
+	}
+	if cal == nil {
+		return nil, errors.New("ical: no VCALENDAR")
+	}
+	return cal, nil
+}
+
+// A decoder converts the events of a VCALENDAR.
+type decoder struct {
+	vtimezones map[string]*component
+	zones      map[string]*zone
+	floating   *zone // the zone of floating times, or nil for UTC
+}
+
+// zone returns the zone of a TZID.
+func (d *decoder) zone(tzid string) (*zone, error) {
+	if z, ok := d.zones[tzid]; ok {
+		return z, nil
+	}
+	z, err := resolveZone(tzid, d.vtimezones[tzid])
+	if err != nil {
+		return nil, err
+	}
+	d.zones[tzid] = z
+	return z, nil
+}
+
+var (
+	statuses = map[string]string{
+		"CONFIRMED": "confirmed",
+		"TENTATIVE": "tentative",
+		"CANCELLED": "cancelled",
+	}
+	transparencies = map[string]string{
+		"OPAQUE":      "opaque",
+		"TRANSPARENT": "transparent",
+	}
+	visibilities = map[string]string{
+		"PUBLIC":       "public",
+		"PRIVATE":      "private",
+		"CONFIDENTIAL": "confidential",
+	}
+	partStats = map[string]string{
+		"NEEDS-ACTION": "needsAction",
+		"ACCEPTED":     "accepted",
+		"DECLINED":     "declined",
+		"TENTATIVE":    "tentative",
+	}
+	partStatNames = map[string]string{
+		"needsAction": "NEEDS-ACTION",
+		"accepted":    "ACCEPTED",
+		"declined":    "DECLINED",
+		"tentative":   "TENTATIVE",
+	}
+)
+
+// event returns the event of a VEVENT.
+func (d *decoder) event(c *component) (*calendar.Event, error) {
+	e := &calendar.Event{
+		ICalUID:      c.text("UID"),
+		Summary:      c.text("SUMMARY"),
+		Description:  c.text("DESCRIPTION"),
+		Location:     c.text("LOCATION"),
+		Status:       statuses[strings.ToUpper(c.text("STATUS"))],
+		Transparency: transparencies[strings.ToUpper(c.text("TRANSP"))],
+		Visibility:   visibilities[strings.ToUpper(c.text("CLASS"))],
+	}
+	if p := c.prop("SEQUENCE"); p != nil {
+		n, err := strconv.ParseInt(strings.TrimSpace(p.value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad SEQUENCE %q", p.line, p.value)
+		}
+		e.Sequence = n
+	}
+	recurs := false
+	for _, p := range c.props {
+		switch p.name {
+		case "RRULE", "RDATE":
+			recurs = true
+			fallthrough
+		case "EXRULE", "EXDATE":
+			r, err := d.recurrence(p)
+			if err != nil {
+				return nil, err
+			}
+			e.Recurrence = append(e.Recurrence, r)
+		}
+	}
+
+	p := c.prop("DTSTART")
+	if p == nil {
+		return nil, fmt.Errorf("line %d: VEVENT with no DTSTART", c.line)
+	}
+	start, err := d.timeValue(p)
+	if err != nil {
+		return nil, err
+	}
+	e.Start = start.eventDateTime(duration{}, recurs)
+	switch {
+	case c.prop("DTEND") != nil:
+		p := c.prop("DTEND")
+		end, err := d.timeValue(p)
+		if err != nil {
+			return nil, err
+		}
+		e.End = end.eventDateTime(duration{}, recurs)
+	case c.prop("DURATION") != nil:
+		p := c.prop("DURATION")
+		dur, err := parseDuration(p.value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad DURATION %q", p.line, p.value)
+		}
+		e.End = start.eventDateTime(dur, recurs)
+	case start.date:
+		e.End = start.eventDateTime(duration{days: 1}, recurs)
+	default:
+		e.End = start.eventDateTime(duration{}, recurs)
+	}
+	if p := c.prop("RECURRENCE-ID"); p != nil {
+		orig, err := d.timeValue(p)
+		if err != nil {
+			return nil, err
+		}
+		e.OriginalStartTime = orig.eventDateTime(duration{}, true)
+	}
+
+	if p := c.prop("ORGANIZER"); p != nil {
+		e.Organizer = &calendar.EventOrganizer{
+			Email:       mailto(p.value),
+			DisplayName: p.param("CN"),
+		}
+	}
+	for _, p := range c.props {
+		if p.name != "ATTENDEE" {
+			continue
+		}
+		a := &calendar.EventAttendee{
+			Email:          mailto(p.value),
+			DisplayName:    p.param("CN"),
+			ResponseStatus: partStats[strings.ToUpper(p.param("PARTSTAT"))],
+		}
+		if a.Email == "" {
+			continue
+		}
+		if a.ResponseStatus == "" {
+			a.ResponseStatus = "needsAction"
+		}
+		switch strings.ToUpper(p.param("ROLE")) {
+		case "OPT-PARTICIPANT", "NON-PARTICIPANT":
+			a.Optional = true
+		}
+		switch strings.ToUpper(p.param("CUTYPE")) {
+		case "RESOURCE", "ROOM":
+			a.Resource = true
+		}
+		e.Attendees = append(e.Attendees, a)
+	}
+	e.Reminders = reminders(c)
+	return e, nil
+}
+
+// recurrence returns the line of a recurrence property of an event, with
+// the TZID of an RDATE or EXDATE changed to an IANA name, or the times
+// changed to UTC.
+func (d *decoder) recurrence(p *property) (string, error) {
+	q := &property{name: p.name, value: p.value}
+	if p.name == "RRULE" || p.name == "EXRULE" {
+		return q.format(), nil
+	}
+	q.params = append(q.params, p.params...)
+	tzid := p.param("TZID")
+	if strings.EqualFold(p.param("VALUE"), "DATE") {
+		return q.format(), nil
+	}
+	var z *zone
+	if tzid != "" {
+		var err error
+		if z, err = d.zone(tzid); err != nil {
+			return "", fmt.Errorf("line %d: %v", p.line, err)
+		}
+	} else if !strings.HasSuffix(p.value, "Z") {
+		z = d.floating
+	}
+	switch {
+	case z == nil:
+	case z.name != "":
+		q.setParam("TZID", z.name)
+	default:
+		q.deleteParam("TZID")
+		vs := splitValue(p.value)
+		for i, v := range vs {
+			// The times of a PERIOD change, not its duration.
+			parts := strings.Split(v, "/")
+			for j, s := range parts {
+				if t, utc, err := parseDateTime(s); err == nil && !utc {
+					parts[j] = z.in(t).UTC().Format(dateTimeLayout) + "Z"
+				}
+			}
+			vs[i] = strings.Join(parts, "/")
+		}
+		q.value = strings.Join(vs, ",")
+	}
+	return q.format(), nil
+}
+
+// mailto returns the email address of a CAL-ADDRESS value.
+func mailto(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(strings.ToLower(v), "mailto:") {
+		v = v[len("mailto:"):]
+	}
+	return v
+}
+
+// reminders returns the reminders of the alarms of a VEVENT, or nil if it
+// has none.
+func reminders(c *component) *calendar.EventReminders {
+	var rs *calendar.EventReminders
+	type key struct {
+		method  string
+		minutes int64
+	}
+	seen := make(map[key]bool)
+	for _, a := range c.comps {
+		if a.name != "VALARM" {
+			continue
+		}
+		if rs == nil {
+			rs = &calendar.EventReminders{ForceSendFields: []string{"UseDefault"}}
+		}
+		var method string
+		switch strings.ToUpper(a.text("ACTION")) {
+		case "DISPLAY", "AUDIO":
+			method = "popup"
+		case "EMAIL":
+			method = "email"
+		default:
+			continue
+		}
+		p := a.prop("TRIGGER")
+		if p == nil || strings.EqualFold(p.param("VALUE"), "DATE-TIME") || strings.EqualFold(p.param("RELATED"), "END") {
+			continue
+		}
+		dur, err := parseDuration(p.value)
+		if err != nil {
+			continue
+		}
+		minutes := -(int64(dur.days)*24*60 + int64(dur.clock/time.Minute))
+		if minutes < 0 {
+			// Reminders come before the event.
+			continue
+		}
+		if k := (key{method, minutes}); !seen[k] {
+			seen[k] = true
+			rs.Overrides = append(rs.Overrides, &calendar.EventReminder{
+				Method:  method,
+				Minutes: minutes,
+				// Reminders at the start of the event have 0 minutes.
+				ForceSendFields: []string{"Minutes"},
+			})
+		}
+	}
+	return rs
+}
+
+// A timeValue is the value of a DATE or DATE-TIME property.
+type timeValue struct {
+	date bool
+	wall time.Time // the wall clock, in UTC
+	zone *zone     // nil for UTC
+}
+
+// timeValue returns the value of a DATE or DATE-TIME property.
+func (d *decoder) timeValue(p *property) (timeValue, error) {
+	v := strings.TrimSpace(p.value)
+	if strings.EqualFold(p.param("VALUE"), "DATE") || len(v) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return timeValue{}, fmt.Errorf("line %d: bad %s %q", p.line, p.name, p.value)
+		}
+		return timeValue{date: true, wall: t}, nil
+	}
+	t, utc, err := parseDateTime(v)
+	if err != nil {
+		return timeValue{}, fmt.Errorf("line %d: bad %s %q", p.line, p.name, p.value)
+	}
+	tv := timeValue{wall: t}
+	switch tzid := p.param("TZID"); {
+	case utc:
+	case tzid != "":
+		if tv.zone, err = d.zone(tzid); err != nil {
+			return timeValue{}, fmt.Errorf("line %d: %v", p.line, err)
+		}
+	default:
+		tv.zone = d.floating
+	}
+	return tv, nil
+}
+
+// eventDateTime returns the EventDateTime of the time dur after v. A time
+// in UTC has the time zone UTC only in a recurring event, which needs a
+// time zone.
+func (v timeValue) eventDateTime(dur duration, recurs bool) *calendar.EventDateTime {
+	wall := v.wall.AddDate(0, 0, dur.days)
+	if v.date {
+		return &calendar.EventDateTime{Date: wall.Format("2006-01-02")}
+	}
+	edt := &calendar.EventDateTime{}
+	t := wall
+	if v.zone != nil {
+		t = v.zone.in(wall)
+		edt.TimeZone = v.zone.name
+	} else if recurs {
+		edt.TimeZone = "UTC"
+	}
+	edt.DateTime = t.Add(dur.clock).Format(time.RFC3339)
+	return edt
+}
+
+// A duration is the value of a DURATION property: a number of nominal
+// days and an exact duration.
+type duration struct {
+	days  int
+	clock time.Duration
+}
+
+// parseDuration parses a DURATION value, as in -PT15M or P1DT12H.
+func parseDuration(s string) (duration, error) {
+	var d duration
+	orig := s
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return d, fmt.Errorf("bad duration %q", orig)
+	}
+	s = s[1:]
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime, s = true, s[1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return d, fmt.Errorf("bad duration %q", orig)
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return d, fmt.Errorf("bad duration %q", orig)
+		}
+		switch unit := s[i]; {
+		case !inTime && unit == 'W':
+			d.days += 7 * n
+		case !inTime && unit == 'D':
+			d.days += n
+		case inTime && unit == 'H':
+			d.clock += time.Duration(n) * time.Hour
+		case inTime && unit == 'M':
+			d.clock += time.Duration(n) * time.Minute
+		case inTime && unit == 'S':
+			d.clock += time.Duration(n) * time.Second
+		default:
+			return d, fmt.Errorf("bad duration %q", orig)
+		}
+		s = s[i+1:]
+	}
+	if neg {
+		d.days, d.clock = -d.days, -d.clock
+	}
+	return d, nil
+}
+
+// now returns the current time. Tests replace it.
+var now = time.Now
+
+// Write writes c as an iCalendar object, with a VTIMEZONE for each time
+// zone of its events. The iCalUID of an event is its UID, or if it has
+// none, its ID, as in Google Calendar.
+//
+// Reminders with the popup and email methods become alarms; the reminders
+// of events that use the defaults of their calendar are left out.
+func (c *Calendar) Write(w io.Writer) error {
+	enc := &encoder{zones: make(map[string]*time.Location)}
+	var events []*component
+	for _, e := range c.Events {
+		ev, err := enc.event(e)
+		if err != nil {
+			return fmt.Errorf("ical: %v", err)
+		}
+		events = append(events, ev)
+	}
+	cal := &component{name: "VCALENDAR"}
+	prodID := c.ProdID
+	if prodID == "" {
+		prodID = DefaultProdID
+	}
+	cal.addText("PRODID", prodID)
+	cal.add("VERSION", "2.0")
+	cal.add("CALSCALE", "GREGORIAN")
+	cal.addText("METHOD", c.Method)
+	cal.addText("X-WR-CALNAME", c.Name)
+	cal.addText("X-WR-TIMEZONE", c.TimeZone)
+	var names []string
+	for name := range enc.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cal.comps = append(cal.comps, vtimezone(name, enc.zones[name], enc.y0, enc.y1))
+	}
+	cal.comps = append(cal.comps, events...)
+	return cal.write(w)
+}
+
+// An encoder converts events to VEVENTs, and records the time zones and
+// years of their times.
+type encoder struct {
+	zones  map[string]*time.Location
+	y0, y1 int
+}
+
+// event returns the VEVENT of e.
+func (enc *encoder) event(e *calendar.Event) (*component, error) {
+	uid := e.ICalUID
+	if uid == "" {
+		id := e.Id
+		if e.RecurringEventId != "" {
+			id = e.RecurringEventId
+		}
+		if id == "" {
+			return nil, errors.New("event with no iCalUID or ID")
+		}
+		uid = id + "@google.com"
+	}
+	c := &component{name: "VEVENT"}
+	c.add("UID", escape(uid))
+	stamp := now()
+	if t, err := time.Parse(time.RFC3339, e.Updated); err == nil {
+		stamp = t
+	}
+	c.add("DTSTAMP", stamp.UTC().Format(dateTimeLayout)+"Z")
+	start := e.Start
+	if start == nil {
+		// Cancelled instances of recurring events have only their
+		// original start.
+		start = e.OriginalStartTime
+	}
+	if start == nil {
+		return nil, fmt.Errorf("event %s with no start", uid)
+	}
+	for _, t := range []struct {
+		name string
+		edt  *calendar.EventDateTime
+	}{
+		{"DTSTART", start},
+		{"DTEND", e.End},
+		{"RECURRENCE-ID", e.OriginalStartTime},
+	} {
+		if t.edt == nil || (t.name == "DTEND" && e.EndTimeUnspecified) {
+			continue
+		}
+		p, err := enc.timeProperty(t.name, t.edt)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %v", uid, err)
+		}
+		c.props = append(c.props, p)
+	}
+	for _, r := range e.Recurrence {
+		p, err := parseProperty(r)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: bad recurrence %q: %v", uid, r, err)
+		}
+		if tzid := p.param("TZID"); tzid != "" {
+			enc.zone(tzid)
+		}
+		c.props = append(c.props, p)
+	}
+	c.addText("SUMMARY", e.Summary)
+	c.addText("DESCRIPTION", e.Description)
+	c.addText("LOCATION", e.Location)
+	c.addText("STATUS", strings.ToUpper(e.Status))
+	c.addText("TRANSP", strings.ToUpper(e.Transparency))
+	if e.Visibility != "default" {
+		c.addText("CLASS", strings.ToUpper(e.Visibility))
+	}
+	if e.Sequence != 0 {
+		c.add("SEQUENCE", strconv.FormatInt(e.Sequence, 10))
+	}
+	for _, p := range []struct {
+		name, value string
+	}{
+		{"CREATED", e.Created},
+		{"LAST-MODIFIED", e.Updated},
+	} {
+		if t, err := time.Parse(time.RFC3339, p.value); err == nil {
+			c.add(p.name, t.UTC().Format(dateTimeLayout)+"Z")
+		}
+	}
+	if o := e.Organizer; o != nil && o.Email != "" {
+		p := c.add("ORGANIZER", "mailto:"+o.Email)
+		if o.DisplayName != "" {
+			p.setParam("CN", o.DisplayName)
+		}
+	}
+	for _, a := range e.Attendees {
+		if a.Email == "" {
+			continue
+		}
+		p := c.add("ATTENDEE", "mailto:"+a.Email)
+		if a.DisplayName != "" {
+			p.setParam("CN", a.DisplayName)
+		}
+		if a.Resource {
+			p.setParam("CUTYPE", "RESOURCE")
+		}
+		role := "REQ-PARTICIPANT"
+		if a.Optional {
+			role = "OPT-PARTICIPANT"
+		}
+		p.setParam("ROLE", role)
+		if ps, ok := partStatNames[a.ResponseStatus]; ok {
+			p.setParam("PARTSTAT", ps)
+		}
+	}
+	if rs := e.Reminders; rs != nil && !rs.UseDefault {
+		for _, r := range rs.Overrides {
+			if a := alarm(e, r); a != nil {
+				c.comps = append(c.comps, a)
+			}
+		}
+	}
+	return c, nil
+}
+
+// alarm returns the VALARM of a reminder of e, or nil if the reminder has
+// no alarm.
+func alarm(e *calendar.Event, r *calendar.EventReminder) *component {
+	a := &component{name: "VALARM"}
+	desc := e.Summary
+	if desc == "" {
+		desc = "Reminder"
+	}
+	switch r.Method {
+	case "popup":
+		a.add("ACTION", "DISPLAY")
+		a.addText("DESCRIPTION", desc)
+	case "email":
+		a.add("ACTION", "EMAIL")
+		a.addText("SUMMARY", desc)
+		a.addText("DESCRIPTION", desc)
+		if o := e.Organizer; o != nil && o.Email != "" {
+			a.add("ATTENDEE", "mailto:"+o.Email)
+		}
+	default:
+		return nil
+	}
+	a.add("TRIGGER", formatTrigger(r.Minutes))
+	return a
+}
+
+// formatTrigger formats the TRIGGER of an alarm the given number of
+// minutes before the start of an event.
+func formatTrigger(minutes int64) string {
+	switch {
+	case minutes == 0:
+		return "PT0S"
+	case minutes%(24*60) == 0:
+		return fmt.Sprintf("-P%dD", minutes/(24*60))
+	case minutes%60 == 0:
+		return fmt.Sprintf("-PT%dH", minutes/60)
+	}
+	return fmt.Sprintf("-PT%dM", minutes)
+}
+
+// timeProperty returns a DATE or DATE-TIME property for edt. A time with
+// a time zone other than UTC is written in that time zone.
+func (enc *encoder) timeProperty(name string, edt *calendar.EventDateTime) (*property, error) {
+	p := &property{name: name}
+	if edt.Date != "" {
+		t, err := time.Parse("2006-01-02", edt.Date)
+		if err != nil {
+			return nil, fmt.Errorf("bad date %q", edt.Date)
+		}
+		enc.year(t.Year())
+		p.setParam("VALUE", "DATE")
+		p.value = t.Format(dateLayout)
+		return p, nil
+	}
+	t, err := time.Parse(time.RFC3339, edt.DateTime)
+	if err != nil {
+		return nil, fmt.Errorf("bad date-time %q", edt.DateTime)
+	}
+	enc.year(t.Year())
+	if loc := enc.zone(edt.TimeZone); loc != nil {
+		p.setParam("TZID", edt.TimeZone)
+		p.value = t.In(loc).Format(dateTimeLayout)
+		return p, nil
+	}
+	p.value = t.UTC().Format(dateTimeLayout) + "Z"
+	return p, nil
+}
+
+// zone returns the location of the time zone with the given IANA name,
+// and records that the calendar needs its VTIMEZONE. It returns nil if the
+// name is empty, UTC or unknown.
+func (enc *encoder) zone(name string) *time.Location {
+	switch name {
+	case "", "UTC", "Etc/UTC", "GMT", "Etc/GMT":
+		return nil
+	}
+	if loc, ok := enc.zones[name]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	enc.zones[name] = loc
+	return loc
+}
+
+// year records that the calendar has a time in year y.
+func (enc *encoder) year(y int) {
+	if enc.y0 == 0 || y < enc.y0 {
+		enc.y0 = y
+	}
+	if y > enc.y1 {
+		enc.y1 = y
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	calendar "google.golang.org/api/calendar/v3"
+)
+
+const testICS = `BEGIN:VCALENDAR
+PRODID:-//Microsoft Corporation//Outlook 16.0 MIMEDIR//EN
+VERSION:2.0
+METHOD:PUBLISH
+X-WR-CALNAME:Team
+BEGIN:VTIMEZONE
+TZID:Eastern Standard Time
+BEGIN:STANDARD
+DTSTART:16011104T020000
+RRULE:FREQ=YEARLY;BYDAY=1SU;BYMONTH=11
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010311T020000
+RRULE:FREQ=YEARLY;BYDAY=2SU;BYMONTH=3
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+END:DAYLIGHT
+END:VTIMEZONE
+` + customZone + `BEGIN:VEVENT
+UID:weekly-1
+DTSTART;TZID=Eastern Standard Time:20200106T100000
+DTEND;TZID=Eastern Standard Time:20200106T103000
+RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=10
+EXDATE;TZID=Eastern Standard Time:20200113T100000
+SUMMARY:Standup
+ORGANIZER;CN=Alice:mailto:alice@example.com
+ATTENDEE;CN=Bob;PARTSTAT=ACCEPTED;ROLE=REQ-PARTICIPANT:mailto:bob@example.com
+ATTENDEE;CN=Room 1;CUTYPE=RESOURCE;ROLE=NON-PARTICIPANT:MAILTO:room1@example.com
+SEQUENCE:2
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:Reminder
+TRIGGER:-PT15M
+END:VALARM
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER;RELATED=END:PT0S
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly-1
+RECURRENCE-ID;TZID=Eastern Standard Time:20200120T100000
+DTSTART;TZID=Eastern Standard Time:20200120T110000
+DURATION:PT1H
+SUMMARY:Standup (moved)
+END:VEVENT
+BEGIN:VEVENT
+UID:holiday-1
+DTSTART;VALUE=DATE:20200101
+SUMMARY:New Year
+TRANSP:TRANSPARENT
+CLASS:PRIVATE
+END:VEVENT
+BEGIN:VEVENT
+UID:custom-1
+DTSTART;TZID=Customized Time Zone:20200701T090000
+DTEND;TZID=Customized Time Zone:20200701T100000
+RRULE:FREQ=DAILY;COUNT=3
+EXDATE;TZID=Customized Time Zone:20200702T090000
+END:VEVENT
+BEGIN:VEVENT
+UID:utc-1
+DTSTART:20200301T150000Z
+DTEND:20200301T160000Z
+DESCRIPTION:Line 1\nLine 2\, with a comma
+STATUS:TENTATIVE
+END:VEVENT
+BEGIN:VTODO
+UID:todo-1
+END:VTODO
+END:VCALENDAR
+`
+
+func testEvents() []*calendar.Event {
+	return []*calendar.Event{
+		{
+			ICalUID:    "weekly-1",
+			Summary:    "Standup",
+			Start:      &calendar.EventDateTime{DateTime: "2020-01-06T10:00:00-05:00", TimeZone: "America/New_York"},
+			End:        &calendar.EventDateTime{DateTime: "2020-01-06T10:30:00-05:00", TimeZone: "America/New_York"},
+			Recurrence: []string{"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=10", "EXDATE;TZID=America/New_York:20200113T100000"},
+			Organizer:  &calendar.EventOrganizer{Email: "alice@example.com", DisplayName: "Alice"},
+			Attendees: []*calendar.EventAttendee{
+				{Email: "bob@example.com", DisplayName: "Bob", ResponseStatus: "accepted"},
+				{Email: "room1@example.com", DisplayName: "Room 1", ResponseStatus: "needsAction", Optional: true, Resource: true},
+			},
+			Sequence: 2,
+			Reminders: &calendar.EventReminders{
+				Overrides:       []*calendar.EventReminder{{Method: "popup", Minutes: 15, ForceSendFields: []string{"Minutes"}}},
+				ForceSendFields: []string{"UseDefault"},
+			},
+		},
+		{
+			ICalUID:           "weekly-1",
+			Summary:           "Standup (moved)",
+			Start:             &calendar.EventDateTime{DateTime: "2020-01-20T11:00:00-05:00", TimeZone: "America/New_York"},
+			End:               &calendar.EventDateTime{DateTime: "2020-01-20T12:00:00-05:00", TimeZone: "America/New_York"},
+			OriginalStartTime: &calendar.EventDateTime{DateTime: "2020-01-20T10:00:00-05:00", TimeZone: "America/New_York"},
+		},
+		{
+			ICalUID:      "holiday-1",
+			Summary:      "New Year",
+			Start:        &calendar.EventDateTime{Date: "2020-01-01"},
+			End:          &calendar.EventDateTime{Date: "2020-01-02"},
+			Transparency: "transparent",
+			Visibility:   "private",
+		},
+		{
+			ICalUID:    "custom-1",
+			Start:      &calendar.EventDateTime{DateTime: "2020-07-01T09:00:00-04:00"},
+			End:        &calendar.EventDateTime{DateTime: "2020-07-01T10:00:00-04:00"},
+			Recurrence: []string{"RRULE:FREQ=DAILY;COUNT=3", "EXDATE:20200702T130000Z"},
+		},
+		{
+			ICalUID:     "utc-1",
+			Description: "Line 1\nLine 2, with a comma",
+			Status:      "tentative",
+			Start:       &calendar.EventDateTime{DateTime: "2020-03-01T15:00:00Z"},
+			End:         &calendar.EventDateTime{DateTime: "2020-03-01T16:00:00Z"},
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	cal, err := Parse(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Calendar{
+		ProdID: "-//Microsoft Corporation//Outlook 16.0 MIMEDIR//EN",
+		Method: "PUBLISH",
+		Name:   "Team",
+		Events: testEvents(),
+	}
+	if diff := cmp.Diff(want, cal); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseFloating(t *testing.T) {
+	in := "BEGIN:VCALENDAR\nX-WR-TIMEZONE:Europe/Berlin\nBEGIN:VEVENT\nUID:a\nDTSTART:20200701T090000\nDURATION:P1DT1H\nRRULE:FREQ=DAILY\nEXDATE:20200702T090000\nEND:VEVENT\nEND:VCALENDAR\n"
+	cal, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*calendar.Event{{
+		ICalUID:    "a",
+		Start:      &calendar.EventDateTime{DateTime: "2020-07-01T09:00:00+02:00", TimeZone: "Europe/Berlin"},
+		End:        &calendar.EventDateTime{DateTime: "2020-07-02T10:00:00+02:00", TimeZone: "Europe/Berlin"},
+		Recurrence: []string{"RRULE:FREQ=DAILY", "EXDATE;TZID=Europe/Berlin:20200702T090000"},
+	}}
+	if diff := cmp.Diff(want, cal.Events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"", "ical: no VCALENDAR"},
+		{"BEGIN:VEVENT\nEND:VEVENT\n", "ical: line 1: got VEVENT, want VCALENDAR"},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:a\nEND:VEVENT\nEND:VCALENDAR\n", "ical: line 2: VEVENT with no DTSTART"},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:2020\nEND:VEVENT\nEND:VCALENDAR\n", `ical: line 3: bad DTSTART "2020"`},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;TZID=Nowhere:20200101T100000\nEND:VEVENT\nEND:VCALENDAR\n", `ical: line 3: unknown time zone "Nowhere"`},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20200101\nDURATION:1D\nEND:VEVENT\nEND:VCALENDAR\n", `ical: line 4: bad DURATION "1D"`},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20200101\nSEQUENCE:x\nEND:VEVENT\nEND:VCALENDAR\n", `ical: line 4: bad SEQUENCE "x"`},
+	} {
+		_, err := Parse(strings.NewReader(test.in))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got error %v, want %q", test.in, err, test.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC) }
+	cal := &Calendar{
+		Name: "Team",
+		Events: []*calendar.Event{
+			{
+				Id:         "abc",
+				Summary:    "Standup",
+				Start:      &calendar.EventDateTime{DateTime: "2020-01-06T15:00:00Z", TimeZone: "America/New_York"},
+				End:        &calendar.EventDateTime{DateTime: "2020-01-06T10:30:00-05:00", TimeZone: "America/New_York"},
+				Recurrence: []string{"RRULE:FREQ=WEEKLY;BYDAY=MO"},
+				Organizer:  &calendar.EventOrganizer{Email: "alice@example.com", DisplayName: "Doe, Alice"},
+				Attendees: []*calendar.EventAttendee{
+					{Email: "bob@example.com", ResponseStatus: "declined", Optional: true},
+				},
+				Reminders: &calendar.EventReminders{Overrides: []*calendar.EventReminder{
+					{Method: "email", Minutes: 1440},
+					{Method: "popup", Minutes: 0},
+					{Method: "sms", Minutes: 5},
+				}},
+				Updated:    "2020-04-01T10:00:00.000Z",
+				Visibility: "default",
+			},
+			{
+				Id:                "abc_20200113T150000Z",
+				RecurringEventId:  "abc",
+				Status:            "cancelled",
+				OriginalStartTime: &calendar.EventDateTime{DateTime: "2020-01-13T10:00:00-05:00", TimeZone: "America/New_York"},
+			},
+			{
+				ICalUID:   "holiday-1",
+				Summary:   "New Year",
+				Start:     &calendar.EventDateTime{Date: "2020-01-01"},
+				End:       &calendar.EventDateTime{Date: "2020-01-02"},
+				Reminders: &calendar.EventReminders{UseDefault: true},
+			},
+		},
+	}
+	var b strings.Builder
+	if err := cal.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	want := []string{
+		"BEGIN:VCALENDAR",
+		"PRODID:" + DefaultProdID,
+		"VERSION:2.0",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Team",
+		"BEGIN:VTIMEZONE",
+		"TZID:America/New_York",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20200308T020000",
+		"TZOFFSETFROM:-0500",
+		"TZOFFSETTO:-0400",
+		"TZNAME:EDT",
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU",
+		"END:DAYLIGHT",
+		"BEGIN:STANDARD",
+		"DTSTART:20201101T020000",
+		"TZOFFSETFROM:-0400",
+		"TZOFFSETTO:-0500",
+		"TZNAME:EST",
+		"RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:abc@google.com",
+		"DTSTAMP:20200401T100000Z",
+		"DTSTART;TZID=America/New_York:20200106T100000",
+		"DTEND;TZID=America/New_York:20200106T103000",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO",
+		"SUMMARY:Standup",
+		"LAST-MODIFIED:20200401T100000Z",
+		`ORGANIZER;CN="Doe, Alice":mailto:alice@example.com`,
+		"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=DECLINED:mailto:bob@example.com",
+		"BEGIN:VALARM",
+		"ACTION:EMAIL",
+		"SUMMARY:Standup",
+		"DESCRIPTION:Standup",
+		"ATTENDEE:mailto:alice@example.com",
+		"TRIGGER:-P1D",
+		"END:VALARM",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"DESCRIPTION:Standup",
+		"TRIGGER:PT0S",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:abc@google.com",
+		"DTSTAMP:20200501T120000Z",
+		"DTSTART;TZID=America/New_York:20200113T100000",
+		"RECURRENCE-ID;TZID=America/New_York:20200113T100000",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday-1",
+		"DTSTAMP:20200501T120000Z",
+		"DTSTART;VALUE=DATE:20200101",
+		"DTEND;VALUE=DATE:20200102",
+		"SUMMARY:New Year",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	for _, e := range []*calendar.Event{
+		{Start: &calendar.EventDateTime{Date: "2020-01-01"}},
+		{ICalUID: "a"},
+		{ICalUID: "a", Start: &calendar.EventDateTime{DateTime: "tomorrow"}},
+		{ICalUID: "a", Start: &calendar.EventDateTime{Date: "2020-01-01"}, Recurrence: []string{"RRULE"}},
+	} {
+		cal := &Calendar{Events: []*calendar.Event{e}}
+		if err := cal.Write(&strings.Builder{}); err == nil {
+			t.Errorf("%+v: got no error", e)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var events []*calendar.Event
+	for _, e := range testEvents() {
+		// Times in zones known only by their rules are written in UTC.
+		if e.ICalUID != "custom-1" {
+			events = append(events, e)
+		}
+	}
+	var b strings.Builder
+	if err := (&Calendar{Events: events}).Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(events, cal.Events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want duration
+	}{
+		{"PT15M", duration{clock: 15 * time.Minute}},
+		{"-PT1H30M", duration{clock: -90 * time.Minute}},
+		{"P1DT12H", duration{days: 1, clock: 12 * time.Hour}},
+		{"+P2W", duration{days: 14}},
+		{"PT0S", duration{}},
+	} {
+		got, err := parseDuration(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("parseDuration(%q) = %+v, %v, want %+v", test.s, got, err, test.want)
+		}
+	}
+	for _, s := range []string{"", "P", "PT", "P1H", "PT1D", "P1", "15M"} {
+		if _, err := parseDuration(s); err == nil {
+			t.Errorf("parseDuration(%q): got no error", s)
+		}
+	}
+}
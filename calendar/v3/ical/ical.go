@@ -0,0 +1,386 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineLen is the length in octets at which lines are folded.
+const maxLineLen = 75
+
+// A param is a parameter of a property.
+type param struct {
+	name   string // in upper case
+	values []string
+}
+
+// A property is a content line of an iCalendar object.
+type property struct {
+	name   string // in upper case
+	params []param
+	value  string // as in the content line, with escapes
+	line   int    // the line number of the content line, if it was read
+}
+
+// param returns the first value of the parameter of p with the given name,
+// or the empty string if p has no such parameter.
+func (p *property) param(name string) string {
+	for _, pa := range p.params {
+		if pa.name == name && len(pa.values) > 0 {
+			return pa.values[0]
+		}
+	}
+	return ""
+}
+
+// setParam sets the values of the parameter of p with the given name,
+// adding the parameter if p has none.
+func (p *property) setParam(name string, values ...string) {
+	for i := range p.params {
+		if p.params[i].name == name {
+			p.params[i].values = values
+			return
+		}
+	}
+	p.params = append(p.params, param{name: name, values: values})
+}
+
+// deleteParam removes the parameters of p with the given name.
+func (p *property) deleteParam(name string) {
+	params := p.params[:0]
+	for _, pa := range p.params {
+		if pa.name != name {
+			params = append(params, pa)
+		}
+	}
+	p.params = params
+}
+
+// A component is a component of an iCalendar object, such as a VEVENT.
+type component struct {
+	name  string // in upper case
+	props []*property
+	comps []*component
+	line  int // the line number of the BEGIN line, if it was read
+}
+
+// prop returns the first property of c with the given name, or nil if c
+// has none.
+func (c *component) prop(name string) *property {
+	for _, p := range c.props {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// text returns the unescaped value of the first property of c with the
+// given name, or the empty string if c has none.
+func (c *component) text(name string) string {
+	if p := c.prop(name); p != nil {
+		return unescape(p.value)
+	}
+	return ""
+}
+
+// add adds a property to c and returns it.
+func (c *component) add(name, value string, params ...param) *property {
+	p := &property{name: name, params: params, value: value}
+	c.props = append(c.props, p)
+	return p
+}
+
+// addText adds a property with a text value to c, unless the text is
+// empty.
+func (c *component) addText(name, text string) {
+	if text != "" {
+		c.add(name, escape(text))
+	}
+}
+
+// parseComponents reads the components of an iCalendar stream.
+func parseComponents(r io.Reader) ([]*component, error) {
+	lr := &lineReader{r: bufio.NewReader(r)}
+	var top []*component
+	var stack []*component
+	for {
+		s, err := lr.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p, err := parseProperty(s)
+		if err != nil {
+			return nil, fmt.Errorf("ical: line %d: %v", lr.line, err)
+		}
+		p.line = lr.line
+		switch p.name {
+		case "BEGIN":
+			c := &component{name: strings.ToUpper(p.value), line: lr.line}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.comps = append(parent.comps, c)
+			} else {
+				top = append(top, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ical: line %d: END:%s with no BEGIN", lr.line, p.value)
+			}
+			c := stack[len(stack)-1]
+			if !strings.EqualFold(p.value, c.name) {
+				return nil, fmt.Errorf("ical: line %d: got END:%s, want END:%s", lr.line, p.value, c.name)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ical: line %d: property %s outside a component", lr.line, p.name)
+			}
+			c := stack[len(stack)-1]
+			c.props = append(c.props, p)
+		}
+	}
+	if len(stack) > 0 {
+		c := stack[len(stack)-1]
+		return nil, fmt.Errorf("ical: line %d: %s with no END", c.line, c.name)
+	}
+	return top, nil
+}
+
+// write writes c and its subcomponents to w.
+func (c *component) write(w io.Writer) error {
+	if err := writeLine(w, "BEGIN:"+c.name); err != nil {
+		return err
+	}
+	for _, p := range c.props {
+		if err := writeLine(w, p.format()); err != nil {
+			return err
+		}
+	}
+	for _, sub := range c.comps {
+		if err := sub.write(w); err != nil {
+			return err
+		}
+	}
+	return writeLine(w, "END:"+c.name)
+}
+
+// A lineReader reads the unfolded content lines of an iCalendar stream.
+type lineReader struct {
+	r      *bufio.Reader
+	peeked string
+	ok     bool // whether peeked holds the next physical line
+	n      int  // the number of physical lines read
+	line   int  // the number of the first physical line of the last content line
+}
+
+// readLine returns the next content line that is not blank, or io.EOF.
+func (lr *lineReader) readLine() (string, error) {
+	for {
+		s, err := lr.physical()
+		if err != nil {
+			return "", err
+		}
+		lr.line = lr.n
+		for {
+			next, err := lr.peek()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if next == "" || (next[0] != ' ' && next[0] != '\t') {
+				break
+			}
+			lr.physical()
+			s += next[1:]
+		}
+		if strings.TrimSpace(s) != "" {
+			return s, nil
+		}
+	}
+}
+
+// physical returns the next physical line, without its line ending.
+func (lr *lineReader) physical() (string, error) {
+	s, err := lr.peek()
+	lr.ok = false
+	if err == nil {
+		lr.n++
+	}
+	return s, err
+}
+
+// peek returns the next physical line without consuming it.
+func (lr *lineReader) peek() (string, error) {
+	if lr.ok {
+		return lr.peeked, nil
+	}
+	s, err := lr.r.ReadString('\n')
+	if err == io.EOF && s == "" {
+		return "", io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+	if lr.n == 0 {
+		s = strings.TrimPrefix(s, "\ufeff")
+	}
+	lr.peeked, lr.ok = s, true
+	return s, nil
+}
+
+// parseProperty parses a content line.
+func parseProperty(s string) (*property, error) {
+	p := &property{}
+	i := strings.IndexAny(s, ":;")
+	if i <= 0 {
+		return nil, errors.New("missing property name")
+	}
+	p.name = strings.ToUpper(strings.TrimSpace(s[:i]))
+	s = s[i:]
+	for s[0] == ';' {
+		s = s[1:]
+		j := strings.IndexByte(s, '=')
+		if j <= 0 {
+			return nil, errors.New("missing parameter name")
+		}
+		pa := param{name: strings.ToUpper(strings.TrimSpace(s[:j]))}
+		s = s[j+1:]
+		for {
+			var v string
+			if strings.HasPrefix(s, `"`) {
+				k := strings.IndexByte(s[1:], '"')
+				if k < 0 {
+					return nil, errors.New("unterminated quoted parameter value")
+				}
+				v, s = s[1:k+1], s[k+2:]
+			} else {
+				k := strings.IndexAny(s, ",;:")
+				if k < 0 {
+					return nil, errors.New("missing value")
+				}
+				v, s = s[:k], s[k:]
+			}
+			pa.values = append(pa.values, v)
+			if s == "" || s[0] != ',' {
+				break
+			}
+			s = s[1:]
+		}
+		p.params = append(p.params, pa)
+		if s == "" {
+			return nil, errors.New("missing value")
+		}
+	}
+	if s[0] != ':' {
+		return nil, fmt.Errorf("unexpected %q after parameters", s[0])
+	}
+	p.value = s[1:]
+	return p, nil
+}
+
+// format returns the content line of p.
+func (p *property) format() string {
+	var b strings.Builder
+	b.WriteString(p.name)
+	for _, pa := range p.params {
+		b.WriteByte(';')
+		b.WriteString(pa.name)
+		b.WriteByte('=')
+		for i, v := range pa.values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			v = strings.Replace(v, `"`, "", -1)
+			if strings.ContainsAny(v, ",;:") {
+				v = `"` + v + `"`
+			}
+			b.WriteString(v)
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(p.value)
+	return b.String()
+}
+
+// splitValue splits a value at the commas that are not escaped, without
+// unescaping the parts.
+func splitValue(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape returns the text of an escaped value.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+// escape escapes text for a value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeLine writes a content line to w, folded to maxLineLen octets, with
+// CRLF line endings.
+func writeLine(w io.Writer, s string) error {
+	var b strings.Builder
+	limit := maxLineLen
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+		// The leading space counts.
+		limit = maxLineLen - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
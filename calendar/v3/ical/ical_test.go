@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseComponents(t *testing.T) {
+	in := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"SUMMARY:Long\r\n" +
+		"  summary\r\n" +
+		"ATTENDEE;CN=\"Doe, Jane\";ROLE=REQ-PARTICIPANT:mailto:jane@example.com\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"TRIGGER:-PT15M\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	comps, err := parseComponents(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*component{{
+		name: "VCALENDAR",
+		line: 1,
+		props: []*property{
+			{name: "VERSION", value: "2.0", line: 2},
+		},
+		comps: []*component{{
+			name: "VEVENT",
+			line: 3,
+			props: []*property{
+				{name: "SUMMARY", value: "Long summary", line: 4},
+				{name: "ATTENDEE", params: []param{
+					{name: "CN", values: []string{"Doe, Jane"}},
+					{name: "ROLE", values: []string{"REQ-PARTICIPANT"}},
+				}, value: "mailto:jane@example.com", line: 6},
+			},
+			comps: []*component{{
+				name:  "VALARM",
+				line:  7,
+				props: []*property{{name: "TRIGGER", value: "-PT15M", line: 8}},
+			}},
+		}},
+	}}
+	if diff := cmp.Diff(want, comps, cmp.AllowUnexported(component{}, property{}, param{})); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var b strings.Builder
+	if err := comps[0].write(&b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseComponents(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignoreLines := cmp.FilterPath(func(p cmp.Path) bool {
+		sf, ok := p.Last().(cmp.StructField)
+		return ok && sf.Name() == "line"
+	}, cmp.Ignore())
+	if diff := cmp.Diff(comps, got, cmp.AllowUnexported(component{}, property{}, param{}), ignoreLines); diff != "" {
+		t.Errorf("written and read again: mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseComponentsErrors(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"VERSION:2.0\n", "ical: line 1: property VERSION outside a component"},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n", "ical: line 3: got END:VCALENDAR, want END:VEVENT"},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VEVENT\n", "ical: line 1: VCALENDAR with no END"},
+		{"END:VCALENDAR\n", "ical: line 1: END:VCALENDAR with no BEGIN"},
+		{"BEGIN:VCALENDAR\nSUMMARY;CN=\"x:y\n", "ical: line 2: unterminated quoted parameter value"},
+		{"BEGIN:VCALENDAR\nSUMMARY;X:y\n", "ical: line 2: missing parameter name"},
+	} {
+		_, err := parseComponents(strings.NewReader(test.in))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got error %v, want %q", test.in, err, test.want)
+		}
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	long := "DESCRIPTION:" + strings.Repeat("日本語", 20)
+	var b strings.Builder
+	if err := writeLine(&b, long); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	var unfolded string
+	for i, l := range lines {
+		if len(l) > maxLineLen {
+			t.Errorf("line %d has %d octets, want at most %d", i, len(l), maxLineLen)
+		}
+		if i > 0 {
+			l = strings.TrimPrefix(l, " ")
+		}
+		unfolded += l
+	}
+	if unfolded != long {
+		t.Errorf("unfolded = %q, want %q", unfolded, long)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, s := range []string{"", "plain", `a,b;c\d`, "line 1\nline 2"} {
+		if got := unescape(escape(s)); got != s {
+			t.Errorf("unescape(escape(%q)) = %q", s, got)
+		}
+	}
+	if got, want := splitValue(`a\,b,c,`), []string{`a\,b`, "c", ""}; !cmp.Equal(got, want) {
+		t.Errorf("splitValue = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/semaphore"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/internal/retry"
+)
+
+const (
+	// DefaultConcurrency is the default number of recurring or single
+	// events an Importer imports at the same time.
+	DefaultConcurrency = 5
+
+	// DefaultMaxAttempts is the default number of times an Importer tries
+	// a request.
+	DefaultMaxAttempts = retry.DefaultMaxAttempts
+)
+
+var (
+	// ErrNoICalUID is the error of the events Import does not import
+	// because they have no iCalUID.
+	ErrNoICalUID = errors.New("ical: event has no iCalUID")
+
+	// ErrOutdated is the error of the events Import does not import
+	// because the calendar has a copy of the event with a greater
+	// sequence number.
+	ErrOutdated = errors.New("ical: calendar has a later version of the event")
+
+	// ErrNoRecurringEvent is the error of the exceptions Import does not
+	// import because their recurring event is neither in the calendar nor
+	// imported.
+	ErrNoRecurringEvent = errors.New("ical: recurring event of exception not found")
+)
+
+// An Importer imports events into a calendar with Events.Import.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Import.
+type Importer struct {
+	// Concurrency is the number of recurring or single events imported at
+	// the same time. The default is DefaultConcurrency.
+	Concurrency int
+
+	// MaxAttempts is the number of times a request that fails with a
+	// transient error or an exceeded rate limit is tried. The default is
+	// DefaultMaxAttempts.
+	MaxAttempts int
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	svc        *calendar.Service
+	calendarID string
+}
+
+// NewImporter returns an Importer that imports events into the calendar
+// with the given ID.
+func NewImporter(svc *calendar.Service, calendarID string) *Importer {
+	return &Importer{
+		Concurrency: DefaultConcurrency,
+		MaxAttempts: DefaultMaxAttempts,
+		svc:         svc,
+		calendarID:  calendarID,
+	}
+}
+
+// A Result is the result of importing an event.
+type Result struct {
+	// Event is the event that was imported.
+	Event *calendar.Event
+
+	// Imported is the event in the calendar, or nil if Err is not nil.
+	Imported *calendar.Event
+
+	// Err is the last error of importing the event, or nil if it was
+	// imported.
+	Err error
+}
+
+// Import imports events, as returned by Parse, and returns their results in
+// the order of events.
+//
+// Events are identified by their iCalUID, and exceptions to recurring
+// events by their iCalUID and original start time, so importing events
+// again updates them instead of copying them. An event is not imported if
+// the calendar has a copy of it with a greater sequence number. Recurring
+// events are imported before their exceptions, which get the ID of their
+// recurring event in the calendar as their RecurringEventId.
+//
+// Import returns an error only if ctx is done before all events are tried.
+// The results of the events not tried then have the error of ctx.
+func (im *Importer) Import(ctx context.Context, events []*calendar.Event) ([]*Result, error) {
+	results := make([]*Result, len(events))
+	series := make(map[string][]*Result)
+	var uids []string
+	for i, e := range events {
+		r := &Result{Event: e}
+		results[i] = r
+		if e.ICalUID == "" {
+			r.Err = ErrNoICalUID
+			continue
+		}
+		if _, ok := series[e.ICalUID]; !ok {
+			uids = append(uids, e.ICalUID)
+		}
+		series[e.ICalUID] = append(series[e.ICalUID], r)
+	}
+	n := im.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	sem := semaphore.NewWeighted(int64(n))
+	var wg sync.WaitGroup
+	for i, uid := range uids {
+		// The fast path of Acquire ignores a done ctx.
+		err := ctx.Err()
+		if err == nil {
+			err = sem.Acquire(ctx, 1)
+		}
+		if err != nil {
+			for _, uid := range uids[i:] {
+				for _, r := range series[uid] {
+					r.Err = err
+				}
+			}
+			wg.Wait()
+			return results, err
+		}
+		wg.Add(1)
+		go func(rs []*Result) {
+			defer wg.Done()
+			defer sem.Release(1)
+			im.importSeries(ctx, rs)
+		}(series[uid])
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// importSeries imports the events with the same iCalUID: a single event,
+// or a recurring event and its exceptions.
+func (im *Importer) importSeries(ctx context.Context, rs []*Result) {
+	uid := rs[0].Event.ICalUID
+	existing := make(map[string]*calendar.Event)
+	err := retry.Do(ctx, im.Backoff, im.MaxAttempts, func() error {
+		return im.svc.Events.List(im.calendarID).ICalUID(uid).ShowDeleted(true).Pages(ctx, func(res *calendar.Events) error {
+			for _, e := range res.Items {
+				existing[instanceKey(e)] = e
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		for _, r := range rs {
+			r.Err = err
+		}
+		return
+	}
+	var recurringID string
+	if e := existing[""]; e != nil {
+		recurringID = e.Id
+	}
+	rs = append([]*Result(nil), rs...)
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Event.OriginalStartTime == nil && rs[j].Event.OriginalStartTime != nil
+	})
+	for _, r := range rs {
+		key := instanceKey(r.Event)
+		if cur := existing[key]; cur != nil && cur.Sequence > r.Event.Sequence {
+			r.Err = ErrOutdated
+			continue
+		}
+		e := *r.Event
+		e.Id, e.Etag = "", ""
+		if key != "" {
+			if recurringID == "" {
+				r.Err = ErrNoRecurringEvent
+				continue
+			}
+			e.RecurringEventId = recurringID
+		}
+		r.Err = retry.Do(ctx, im.Backoff, im.MaxAttempts, func() error {
+			var err error
+			r.Imported, err = im.svc.Events.Import(im.calendarID, &e).Context(ctx).Do()
+			return err
+		})
+		if r.Err == nil && key == "" {
+			recurringID = r.Imported.Id
+		}
+	}
+}
+
+// instanceKey returns the original start time of e as a string that is the
+// same for the same time, or the empty string if e is not an exception.
+func instanceKey(e *calendar.Event) string {
+	o := e.OriginalStartTime
+	if o == nil {
+		return ""
+	}
+	if o.Date != "" {
+		return o.Date
+	}
+	t, err := time.Parse(time.RFC3339, o.DateTime)
+	if err != nil {
+		return o.DateTime
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeEvents serves the events of calendar "primary", and imports events
+// into it. The first import of an event with the iCalUID "flaky" fails
+// with status 503.
+type fakeEvents struct {
+	mu      sync.Mutex
+	events  []*calendar.Event
+	imports []*calendar.Event
+	failed  bool
+}
+
+func (f *fakeEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/calendars/primary/events":
+		q := r.URL.Query()
+		if q.Get("showDeleted") != "true" {
+			http.Error(w, "bad query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		res := &calendar.Events{}
+		for _, e := range f.events {
+			if e.ICalUID == q.Get("iCalUID") {
+				res.Items = append(res.Items, e)
+			}
+		}
+		json.NewEncoder(w).Encode(res)
+	case r.Method == "POST" && r.URL.Path == "/calendars/primary/events/import":
+		var e calendar.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.ICalUID == "flaky" && !f.failed {
+			f.failed = true
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		f.imports = append(f.imports, &e)
+		imported := e
+		imported.Id = "id-" + e.ICalUID
+		if e.OriginalStartTime != nil {
+			imported.Id += "_" + instanceKey(&e)
+		}
+		json.NewEncoder(w).Encode(&imported)
+	default:
+		http.Error(w, "bad request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+func TestImport(t *testing.T) {
+	f := &fakeEvents{events: []*calendar.Event{
+		{Id: "old", ICalUID: "outdated", Sequence: 5},
+		{Id: "master-e", ICalUID: "e"},
+	}}
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	im := NewImporter(svc.(*calendar.Service), "primary")
+	im.Backoff = gax.Backoff{Initial: time.Millisecond}
+
+	orig := &calendar.EventDateTime{DateTime: "2020-01-13T10:00:00-05:00", TimeZone: "America/New_York"}
+	events := []*calendar.Event{
+		{ICalUID: "a", Summary: "moved", OriginalStartTime: orig},
+		{ICalUID: "a", Summary: "weekly", Id: "from-elsewhere", Recurrence: []string{"RRULE:FREQ=WEEKLY"}},
+		{ICalUID: "flaky", Summary: "single"},
+		{Summary: "no uid"},
+		{ICalUID: "outdated", Sequence: 1},
+		{ICalUID: "d", OriginalStartTime: orig},
+		{ICalUID: "e", OriginalStartTime: orig},
+	}
+	results, err := im.Import(context.Background(), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		Imported string
+		Err      error
+	}
+	var got []result
+	for i, r := range results {
+		if r.Event != events[i] {
+			t.Errorf("result %d is for another event", i)
+		}
+		var res result
+		if r.Imported != nil {
+			res.Imported = r.Imported.Id
+		}
+		res.Err = r.Err
+		got = append(got, res)
+	}
+	want := []result{
+		{Imported: "id-a_2020-01-13T15:00:00Z"},
+		{Imported: "id-a"},
+		{Imported: "id-flaky"},
+		{Err: ErrNoICalUID},
+		{Err: ErrOutdated},
+		{Err: ErrNoRecurringEvent},
+		{Imported: "id-e_2020-01-13T15:00:00Z"},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b error) bool { return a == b })); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+
+	imports := make(map[string]*calendar.Event)
+	for _, e := range f.imports {
+		imports[e.ICalUID+" "+instanceKey(e)] = e
+	}
+	if e := imports["a "]; e == nil || e.Id != "" {
+		t.Errorf("recurring event a imported as %+v, want it with no ID", e)
+	}
+	if e := imports["a 2020-01-13T15:00:00Z"]; e == nil || e.RecurringEventId != "id-a" {
+		t.Errorf("exception of a imported as %+v, want RecurringEventId id-a", e)
+	}
+	if e := imports["e 2020-01-13T15:00:00Z"]; e == nil || e.RecurringEventId != "master-e" {
+		t.Errorf("exception of e imported as %+v, want RecurringEventId master-e", e)
+	}
+	if events[0].RecurringEventId != "" || events[1].Id != "from-elsewhere" {
+		t.Error("Import modified its events")
+	}
+}
+
+func TestImportCanceled(t *testing.T) {
+	f := &fakeEvents{}
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	im := NewImporter(svc.(*calendar.Service), "primary")
+	im.Backoff = gax.Backoff{Initial: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := im.Import(ctx, []*calendar.Event{{ICalUID: "a"}, {ICalUID: "b"}})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	for _, r := range results {
+		if r.Err != context.Canceled {
+			t.Errorf("%s: got error %v, want context.Canceled", r.Event.ICalUID, r.Err)
+		}
+	}
+	if len(f.imports) != 0 {
+		t.Errorf("got %d imports, want none", len(f.imports))
+	}
+}
@@ -0,0 +1,528 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of DATE and DATE-TIME values.
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+)
+
+// A zone is the time zone of a TZID parameter.
+type zone struct {
+	// name is the IANA name of the zone, or the empty string if the zone
+	// is known only by the rules of its VTIMEZONE.
+	name string
+	loc  *time.Location
+	obs  []*observance
+}
+
+// in returns the time in z with the wall clock of t, which is in UTC.
+func (z *zone) in(t time.Time) time.Time {
+	loc := z.loc
+	if loc == nil {
+		loc = time.FixedZone("", offsetAt(z.obs, t))
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+// resolveZone returns the zone of the TZID parameter tzid, which may have
+// the VTIMEZONE vtz. A TZID that is an IANA name, a Windows name or a path
+// that ends in an IANA name, as written by Outlook and older versions of
+// Thunderbird, is resolved to the IANA zone; otherwise the rules of vtz
+// are used.
+func resolveZone(tzid string, vtz *component) (*zone, error) {
+	if name := ianaName(tzid); name != "" {
+		loc, _ := time.LoadLocation(name)
+		return &zone{name: name, loc: loc}, nil
+	}
+	if vtz != nil {
+		if name := ianaName(vtz.text("X-LIC-LOCATION")); name != "" {
+			loc, _ := time.LoadLocation(name)
+			return &zone{name: name, loc: loc}, nil
+		}
+		obs, err := parseObservances(vtz)
+		if err != nil {
+			return nil, err
+		}
+		if len(obs) > 0 {
+			return &zone{obs: obs}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown time zone %q", tzid)
+}
+
+// ianaName returns the IANA name of the time zone with the given TZID, or
+// the empty string if it has none.
+func ianaName(tzid string) string {
+	tzid = strings.TrimSpace(tzid)
+	if name, ok := windowsZones[tzid]; ok {
+		return name
+	}
+	if loadable(tzid) {
+		return tzid
+	}
+	parts := strings.Split(tzid, "/")
+	for n := 2; n <= 3 && n < len(parts); n++ {
+		if name := strings.Join(parts[len(parts)-n:], "/"); loadable(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func loadable(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// windowsZones maps the Windows names of common time zones, which Exchange
+// and Outlook use as TZIDs, to IANA names, as in the CLDR.
+var windowsZones = map[string]string{
+	"Alaskan Standard Time":           "America/Anchorage",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Argentina Standard Time":         "America/Buenos_Aires",
+	"Atlantic Standard Time":          "America/Halifax",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"Cen. Australia Standard Time":    "Australia/Adelaide",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"Central Standard Time (Mexico)":  "America/Mexico_City",
+	"Central Standard Time":           "America/Chicago",
+	"China Standard Time":             "Asia/Shanghai",
+	"Coordinated Universal Time":      "UTC",
+	"E. Australia Standard Time":      "Australia/Brisbane",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"Eastern Standard Time":           "America/New_York",
+	"FLE Standard Time":               "Europe/Kiev",
+	"GMT Standard Time":               "Europe/London",
+	"Greenwich Standard Time":         "Atlantic/Reykjavik",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"India Standard Time":             "Asia/Calcutta",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"Korea Standard Time":             "Asia/Seoul",
+	"Mountain Standard Time (Mexico)": "America/Chihuahua",
+	"Mountain Standard Time":          "America/Denver",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"Newfoundland Standard Time":      "America/St_Johns",
+	"Pacific Standard Time (Mexico)":  "America/Tijuana",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"Romance Standard Time":           "Europe/Paris",
+	"Russian Standard Time":           "Europe/Moscow",
+	"SA Pacific Standard Time":        "America/Bogota",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"UTC":                             "UTC",
+	"W. Australia Standard Time":      "Australia/Perth",
+	"W. Europe Standard Time":         "Europe/Berlin",
+}
+
+// An observance is a STANDARD or DAYLIGHT subcomponent of a VTIMEZONE.
+type observance struct {
+	start    time.Time // the wall clock of the first onset, in UTC
+	from, to int       // offsets from UTC in seconds
+	rule     *yearlyRule
+	rdates   []time.Time // wall clocks, in UTC
+}
+
+// A yearlyRule is a yearly RRULE of an observance, such as the second
+// Sunday of March.
+type yearlyRule struct {
+	month    time.Month
+	week     int // of a BYDAY, from 1 to 5 or -1 to -5; 0 if the rule has a BYMONTHDAY
+	weekday  time.Weekday
+	monthDay int
+	until    time.Time
+}
+
+// parseObservances returns the observances of a VTIMEZONE. Observances
+// with rules other than yearly rules on a month are taken to start only
+// once.
+func parseObservances(vtz *component) ([]*observance, error) {
+	var obs []*observance
+	for _, c := range vtz.comps {
+		if c.name != "STANDARD" && c.name != "DAYLIGHT" {
+			continue
+		}
+		o := &observance{}
+		var err error
+		p := c.prop("DTSTART")
+		if p == nil {
+			return nil, fmt.Errorf("line %d: %s with no DTSTART", c.line, c.name)
+		}
+		if o.start, _, err = parseDateTime(p.value); err != nil {
+			return nil, fmt.Errorf("line %d: bad DTSTART %q", p.line, p.value)
+		}
+		if o.from, err = parseOffset(c.text("TZOFFSETFROM")); err != nil {
+			return nil, fmt.Errorf("line %d: %s: bad TZOFFSETFROM: %v", c.line, c.name, err)
+		}
+		if o.to, err = parseOffset(c.text("TZOFFSETTO")); err != nil {
+			return nil, fmt.Errorf("line %d: %s: bad TZOFFSETTO: %v", c.line, c.name, err)
+		}
+		if p := c.prop("RRULE"); p != nil {
+			o.rule = parseYearlyRule(p.value)
+		}
+		for _, p := range c.props {
+			if p.name != "RDATE" {
+				continue
+			}
+			for _, v := range splitValue(p.value) {
+				if t, _, err := parseDateTime(v); err == nil {
+					o.rdates = append(o.rdates, t)
+				}
+			}
+		}
+		obs = append(obs, o)
+	}
+	return obs, nil
+}
+
+// parseYearlyRule parses an RRULE of an observance, or returns nil if it
+// is not a supported yearly rule.
+func parseYearlyRule(s string) *yearlyRule {
+	r := &yearlyRule{}
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil
+		}
+		k, v := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch k {
+		case "FREQ":
+			if v != "YEARLY" {
+				return nil
+			}
+		case "BYMONTH":
+			m, err := strconv.Atoi(v)
+			if err != nil || m < 1 || m > 12 {
+				return nil
+			}
+			r.month = time.Month(m)
+		case "BYDAY":
+			// Only days with an ordinal, as in 2SU, are supported.
+			if len(v) < 3 {
+				return nil
+			}
+			wd, ok := weekdays[v[len(v)-2:]]
+			if !ok {
+				return nil
+			}
+			w, err := strconv.Atoi(strings.TrimPrefix(v[:len(v)-2], "+"))
+			if err != nil || w == 0 || w < -5 || w > 5 {
+				return nil
+			}
+			r.week, r.weekday = w, wd
+		case "BYMONTHDAY":
+			d, err := strconv.Atoi(v)
+			if err != nil || d < 1 || d > 31 {
+				return nil
+			}
+			r.monthDay = d
+		case "UNTIL":
+			t, _, err := parseDateTime(v)
+			if err != nil {
+				return nil
+			}
+			r.until = t
+		case "INTERVAL":
+			if v != "1" {
+				return nil
+			}
+		case "WKST":
+		default:
+			return nil
+		}
+	}
+	if r.month == 0 || (r.week == 0 && r.monthDay == 0) {
+		return nil
+	}
+	return r
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// onset returns the wall clock of the onset of r in the given year, with
+// the time of day of start.
+func (r *yearlyRule) onset(year int, start time.Time) (time.Time, bool) {
+	h, m, s := start.Clock()
+	var t time.Time
+	switch {
+	case r.week == 0:
+		t = time.Date(year, r.month, r.monthDay, h, m, s, 0, time.UTC)
+	case r.week > 0:
+		first := time.Date(year, r.month, 1, h, m, s, 0, time.UTC)
+		d := (int(r.weekday) - int(first.Weekday()) + 7) % 7
+		t = first.AddDate(0, 0, d+7*(r.week-1))
+	default:
+		last := time.Date(year, r.month+1, 0, h, m, s, 0, time.UTC)
+		d := (int(last.Weekday()) - int(r.weekday) + 7) % 7
+		t = last.AddDate(0, 0, -d-7*(-r.week-1))
+	}
+	return t, t.Month() == r.month
+}
+
+// latest returns the wall clock of the latest onset of o at or before the
+// wall clock t.
+func (o *observance) latest(t time.Time) (time.Time, bool) {
+	var best time.Time
+	found := false
+	consider := func(on time.Time) {
+		if !on.After(t) && (!found || on.After(best)) {
+			best, found = on, true
+		}
+	}
+	consider(o.start)
+	for _, d := range o.rdates {
+		consider(d)
+	}
+	if r := o.rule; r != nil {
+		y := t.Year()
+		if !r.until.IsZero() && r.until.Year() < y {
+			y = r.until.Year()
+		}
+		for n := 0; n < 2 && y > o.start.Year(); y, n = y-1, n+1 {
+			on, ok := r.onset(y, o.start)
+			// UNTIL is in UTC.
+			if ok && (r.until.IsZero() || !on.Add(-time.Duration(o.from)*time.Second).After(r.until)) {
+				consider(on)
+			}
+		}
+	}
+	return best, found
+}
+
+// offsetAt returns the offset from UTC in seconds at the wall clock t of
+// the zone with the given observances: the offset of the observance with
+// the latest onset, or before all onsets, the offset the first observance
+// changes from.
+func offsetAt(obs []*observance, t time.Time) int {
+	var best time.Time
+	off, found := 0, false
+	for _, o := range obs {
+		if on, ok := o.latest(t); ok && (!found || on.After(best)) {
+			best, off, found = on, o.to, true
+		}
+	}
+	if found {
+		return off
+	}
+	first := obs[0]
+	for _, o := range obs[1:] {
+		if o.start.Before(first.start) {
+			first = o
+		}
+	}
+	return first.from
+}
+
+// parseOffset parses a UTC offset, as in -0500, into seconds.
+func parseOffset(s string) (int, error) {
+	if (len(s) != 5 && len(s) != 7) || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("bad UTC offset %q", s)
+	}
+	n := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+		v, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("bad UTC offset %q", s)
+		}
+		n += v * unit
+	}
+	if s[0] == '-' {
+		n = -n
+	}
+	return n, nil
+}
+
+// formatOffset formats a UTC offset in seconds.
+func formatOffset(n int) string {
+	sign := '+'
+	if n < 0 {
+		sign, n = '-', -n
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, n/3600, n/60%60)
+	if n%60 != 0 {
+		s += fmt.Sprintf("%02d", n%60)
+	}
+	return s
+}
+
+// parseDateTime parses a DATE-TIME value into its wall clock, in UTC, and
+// reports whether it is in UTC.
+func parseDateTime(s string) (time.Time, bool, error) {
+	utc := strings.HasSuffix(s, "Z")
+	t, err := time.Parse(dateTimeLayout, strings.TrimSuffix(s, "Z"))
+	if err != nil {
+		return time.Time{}, false, errors.New("bad DATE-TIME")
+	}
+	return t, utc, nil
+}
+
+// A transition is a change of the offset from UTC of a time zone.
+type transition struct {
+	at       time.Time
+	from, to int
+	abbr     string
+}
+
+// transitions returns the transitions of loc in the years from y0 to y1.
+func transitions(loc *time.Location, y0, y1 int) []transition {
+	var ts []transition
+	t := time.Date(y0, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	end := time.Date(y1+1, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	offset := func(sec int64) int {
+		_, off := time.Unix(sec, 0).In(loc).Zone()
+		return off
+	}
+	off := offset(t)
+	const step = 12 * 3600
+	for ; t < end; t += step {
+		next := offset(t + step)
+		if next == off {
+			continue
+		}
+		// Find the first second with the new offset.
+		lo, hi := t, t+step
+		for hi-lo > 1 {
+			if mid := lo + (hi-lo)/2; offset(mid) == off {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		at := time.Unix(hi, 0).In(loc)
+		abbr, _ := at.Zone()
+		ts = append(ts, transition{at: at.UTC(), from: off, to: next, abbr: abbr})
+		off = next
+	}
+	return ts
+}
+
+// vtimezone returns a VTIMEZONE for loc, with the name tzid, that is
+// correct at least in the years from y0 to y1. If loc changes offsets by
+// the same yearly rules in those years, the VTIMEZONE has these rules;
+// otherwise it lists each transition.
+func vtimezone(tzid string, loc *time.Location, y0, y1 int) *component {
+	if y1 < y0+2 {
+		// Two or more years tell rules.
+		y1 = y0 + 2
+	}
+	c := &component{name: "VTIMEZONE"}
+	c.add("TZID", tzid)
+	ts := transitions(loc, y0, y1)
+	if len(ts) == 0 {
+		_, off := time.Date(y0, 1, 1, 0, 0, 0, 0, loc).Zone()
+		abbr, _ := time.Date(y0, 1, 1, 0, 0, 0, 0, loc).Zone()
+		c.comps = append(c.comps, observanceComponent(transition{
+			at:   time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(off) * time.Second),
+			from: off,
+			to:   off,
+			abbr: abbr,
+		}, ""))
+		return c
+	}
+	if rules := yearlyRules(ts, y0, y1); rules != nil {
+		for i, r := range rules {
+			c.comps = append(c.comps, observanceComponent(ts[i], r))
+		}
+		return c
+	}
+	for _, t := range ts {
+		c.comps = append(c.comps, observanceComponent(t, ""))
+	}
+	return c
+}
+
+// yearlyRules returns the RRULEs of the first two transitions of ts, if
+// the transitions in each year from y0 to y1 are two that follow the same
+// rules, such as the second Sunday of March and the first of November.
+func yearlyRules(ts []transition, y0, y1 int) []string {
+	if len(ts) != 2*(y1-y0+1) {
+		return nil
+	}
+	var rules []string
+	for i := 0; i < 2; i++ {
+		first := ts[i]
+		wall := func(t transition) time.Time {
+			return t.at.Add(time.Duration(t.from) * time.Second)
+		}
+		w0 := wall(first)
+		allLast, sameWeek := true, true
+		for j := i; j < len(ts); j += 2 {
+			t := ts[j]
+			w := wall(t)
+			if w.Year() != y0+j/2 || t.from != first.from || t.to != first.to || w.Month() != w0.Month() || w.Weekday() != w0.Weekday() {
+				return nil
+			}
+			if h, m, s := w.Clock(); h*3600+m*60+s != w0.Hour()*3600+w0.Minute()*60+w0.Second() {
+				return nil
+			}
+			if w.AddDate(0, 0, 7).Month() == w.Month() {
+				allLast = false
+			}
+			if (w.Day()-1)/7 != (w0.Day()-1)/7 {
+				sameWeek = false
+			}
+		}
+		day := strings.ToUpper(w0.Weekday().String()[:2])
+		var week int
+		switch {
+		case allLast:
+			week = -1
+		case sameWeek:
+			week = (w0.Day()-1)/7 + 1
+		default:
+			return nil
+		}
+		rules = append(rules, fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", w0.Month(), week, day))
+	}
+	return rules
+}
+
+// observanceComponent returns the STANDARD or DAYLIGHT subcomponent of a
+// VTIMEZONE for t, with the given RRULE.
+func observanceComponent(t transition, rule string) *component {
+	name := "STANDARD"
+	if t.to > t.from {
+		name = "DAYLIGHT"
+	}
+	c := &component{name: name}
+	c.add("DTSTART", t.at.Add(time.Duration(t.from)*time.Second).Format(dateTimeLayout))
+	c.add("TZOFFSETFROM", formatOffset(t.from))
+	c.add("TZOFFSETTO", formatOffset(t.to))
+	if t.abbr != "" {
+		c.add("TZNAME", escape(t.abbr))
+	}
+	if rule != "" {
+		c.add("RRULE", rule)
+	}
+	return c
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIANAName(t *testing.T) {
+	for _, test := range []struct {
+		tzid, want string
+	}{
+		{"America/New_York", "America/New_York"},
+		{"Eastern Standard Time", "America/New_York"},
+		{"/mozilla.org/20050126_1/Europe/Berlin", "Europe/Berlin"},
+		{"/citadel.org/20190914_1/America/Argentina/Buenos_Aires", "America/Argentina/Buenos_Aires"},
+		{"Customized Time Zone", ""},
+		{"Local", ""},
+		{"", ""},
+	} {
+		if got := ianaName(test.tzid); got != test.want {
+			t.Errorf("ianaName(%q) = %q, want %q", test.tzid, got, test.want)
+		}
+	}
+}
+
+// customZone is a VTIMEZONE with a TZID that is not an IANA name, with the
+// rules of US Eastern time since 2007.
+const customZone = `BEGIN:VTIMEZONE
+TZID:Customized Time Zone
+BEGIN:STANDARD
+DTSTART:16010101T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=1SU;BYMONTH=11
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=2SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+`
+
+func parseVTimezone(t *testing.T, s string) *component {
+	comps, err := parseComponents(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comps[0]
+}
+
+func TestResolveZoneRules(t *testing.T) {
+	z, err := resolveZone("Customized Time Zone", parseVTimezone(t, customZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.name != "" {
+		t.Fatalf("got zone %q, want a zone with no name", z.name)
+	}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"20200101T120000",
+		"20200308T015959",
+		"20200308T030000",
+		"20200701T120000",
+		"20201101T005959",
+		"20201101T020000",
+		"20211231T235959",
+	} {
+		wall, _, err := parseDateTime(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := z.in(wall)
+		want := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, ny)
+		if !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestResolveZoneErrors(t *testing.T) {
+	if _, err := resolveZone("Nowhere", nil); err == nil {
+		t.Error("unknown TZID with no VTIMEZONE: got no error")
+	}
+	bad := strings.Replace(customZone, "TZOFFSETTO:-0500", "TZOFFSETTO:EST", 1)
+	if _, err := resolveZone("Customized Time Zone", parseVTimezone(t, bad)); err == nil {
+		t.Error("bad TZOFFSETTO: got no error")
+	}
+}
+
+func TestVTimezone(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		y0, y1 int
+		rules  bool
+	}{
+		{"America/New_York", 2020, 2020, true},
+		{"Europe/Berlin", 2019, 2021, true},
+		{"Australia/Sydney", 2020, 2020, true},
+		{"Asia/Tokyo", 2020, 2020, false},
+		// The United States changed its rules in 2007.
+		{"America/Los_Angeles", 2005, 2008, false},
+	} {
+		loc, err := time.LoadLocation(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := vtimezone(test.name, loc, test.y0, test.y1)
+		if got := c.prop("TZID").value; got != test.name {
+			t.Errorf("%s: TZID = %q", test.name, got)
+		}
+		hasRules := false
+		for _, sub := range c.comps {
+			if sub.prop("RRULE") != nil {
+				hasRules = true
+			}
+		}
+		if hasRules != test.rules {
+			t.Errorf("%s: has rules = %t, want %t", test.name, hasRules, test.rules)
+		}
+		obs, err := parseObservances(c)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		// The VTIMEZONE agrees with loc every hour of the years, except in
+		// the hours skipped or repeated by transitions.
+		end := time.Date(test.y1+1, 1, 1, 0, 0, 0, 0, time.UTC)
+		for u := time.Date(test.y0, 1, 1, 0, 0, 0, 0, time.UTC); u.Before(end); u = u.Add(time.Hour) {
+			want := u.In(loc)
+			wall := time.Date(want.Year(), want.Month(), want.Day(), want.Hour(), want.Minute(), want.Second(), 0, time.UTC)
+			_, offBefore := want.Add(-2 * time.Hour).Zone()
+			_, offAfter := want.Add(2 * time.Hour).Zone()
+			if offBefore != offAfter {
+				continue
+			}
+			_, off := want.Zone()
+			if got := offsetAt(obs, wall); got != off {
+				t.Errorf("%s: offset at %v = %d, want %d", test.name, want, got, off)
+				break
+			}
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	for _, test := range []struct {
+		s string
+		n int
+	}{
+		{"+0000", 0},
+		{"-0500", -5 * 3600},
+		{"+0530", 5*3600 + 30*60},
+		{"+013045", 3600 + 30*60 + 45},
+	} {
+		n, err := parseOffset(test.s)
+		if err != nil || n != test.n {
+			t.Errorf("parseOffset(%q) = %d, %v, want %d", test.s, n, err, test.n)
+		}
+		if s := formatOffset(test.n); s != test.s {
+			t.Errorf("formatOffset(%d) = %q, want %q", test.n, s, test.s)
+		}
+	}
+	for _, s := range []string{"", "0500", "+5", "+05:00"} {
+		if _, err := parseOffset(s); err == nil {
+			t.Errorf("parseOffset(%q): got no error", s)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scheduling finds times to meet with the free/busy queries of the
+// Calendar API (google.golang.org/api/calendar/v3).
+//
+// A Finder queries the busy times of any number of calendars, split into
+// queries of at most 50 calendars, and finds the slots in which the
+// required attendees of a meeting are free and in their working hours, in
+// their own time zones, with a buffer between meetings. Calendars that
+// cannot be read, such as calendars that do not exist or are not shared
+// with the caller, are reported one by one.
+//
+// For example, to find a half hour to meet next week:
+//
+//	ny, _ := time.LoadLocation("America/New_York")
+//	res, err := scheduling.NewFinder(svc).Find(ctx, &scheduling.Request{
+//		Attendees: []*scheduling.Attendee{
+//			{CalendarID: "alice@example.com", WorkingHours: scheduling.WeekdayHours(ny, 9*time.Hour, 17*time.Hour)},
+//			{CalendarID: "bob@example.com", Optional: true},
+//		},
+//		Window:   scheduling.Interval{Start: monday, End: monday.AddDate(0, 0, 5)},
+//		Duration: 30 * time.Minute,
+//		Buffer:   5 * time.Minute,
+//	})
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	for id, err := range res.Errors {
+//		log.Printf("%s: %v", id, err)
+//	}
+//	for _, s := range res.Slots {
+//		fmt.Println(s.Start, s.Unavailable)
+//	}
+//
+// This package is experimental and subject to change without notice.
+package scheduling
@@ -0,0 +1,177 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultStep is the default time between the possible starts of
+	// slots.
+	DefaultStep = 15 * time.Minute
+
+	// DefaultMaxSlots is the default number of slots Find returns.
+	DefaultMaxSlots = 10
+)
+
+// An Attendee is a participant of a meeting.
+type Attendee struct {
+	// CalendarID is the ID of the calendar of the attendee, usually their
+	// email address.
+	CalendarID string
+
+	// Optional attendees need not be free in a slot, but slots they are
+	// free in rank higher.
+	Optional bool
+
+	// WorkingHours are the times the attendee can meet. Nil means any
+	// time.
+	WorkingHours *WorkingHours
+}
+
+// A Request describes a meeting to find slots for.
+type Request struct {
+	Attendees []*Attendee
+
+	// Window is the interval to find slots in.
+	Window Interval
+
+	// Duration is the length of the meeting.
+	Duration time.Duration
+
+	// Buffer is the free time an attendee needs between the meeting and
+	// their other events.
+	Buffer time.Duration
+
+	// Step is the time between the possible starts of slots, which are
+	// multiples of Step since the zero time, in UTC. The default is
+	// DefaultStep.
+	Step time.Duration
+
+	// MaxSlots is the maximum number of slots returned. The default is
+	// DefaultMaxSlots.
+	MaxSlots int
+}
+
+// A Slot is a time the required attendees of a meeting can meet.
+type Slot struct {
+	Interval
+
+	// Unavailable are the calendar IDs of the optional attendees that
+	// are busy or not working in the slot.
+	Unavailable []string
+}
+
+// A Result is the result of a Find.
+type Result struct {
+	// Slots are the slots found, best first.
+	Slots []*Slot
+
+	// Errors are the errors of the calendars whose free/busy information
+	// could not be read, by calendar ID. Their attendees are taken to be
+	// free at all times in their working hours.
+	Errors map[string]error
+}
+
+// Find returns the slots in which the required attendees of req are free
+// and working, with Buffer to spare before and after.
+//
+// Slots are ranked by the number of optional attendees that cannot attend,
+// and then by their start, and do not overlap each other.
+func (f *Finder) Find(ctx context.Context, req *Request) (*Result, error) {
+	if req.Duration <= 0 {
+		return nil, errors.New("scheduling: duration must be positive")
+	}
+	if req.Window.End.Sub(req.Window.Start) < req.Duration {
+		return nil, errors.New("scheduling: window is shorter than the duration")
+	}
+	if len(req.Attendees) == 0 {
+		return nil, errors.New("scheduling: no attendees")
+	}
+	step := req.Step
+	if step <= 0 {
+		step = DefaultStep
+	}
+	maxSlots := req.MaxSlots
+	if maxSlots <= 0 {
+		maxSlots = DefaultMaxSlots
+	}
+
+	var ids []string
+	for _, a := range req.Attendees {
+		ids = append(ids, a.CalendarID)
+	}
+	w := req.Window
+	query := Interval{w.Start.Add(-req.Buffer), w.End.Add(req.Buffer)}
+	busy, errs, err := f.Busy(ctx, ids, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// The times each attendee can meet, and the times all required
+	// attendees can.
+	all := []Interval{w}
+	free := make([][]Interval, len(req.Attendees))
+	for i, a := range req.Attendees {
+		ivs := []Interval{w}
+		if a.WorkingHours != nil {
+			ivs = a.WorkingHours.intervals(w)
+		}
+		free[i] = subtract(ivs, grow(busy[a.CalendarID], req.Buffer))
+		if !a.Optional {
+			all = intersect(all, free[i])
+		}
+	}
+
+	type candidate struct {
+		slot  *Slot
+		score int
+	}
+	var cands []candidate
+	for _, iv := range all {
+		start := iv.Start.Truncate(step)
+		if start.Before(iv.Start) {
+			start = start.Add(step)
+		}
+		for ; !start.Add(req.Duration).After(iv.End); start = start.Add(step) {
+			s := &Slot{Interval: Interval{start, start.Add(req.Duration)}}
+			for i, a := range req.Attendees {
+				if a.Optional && !covers(free[i], s.Interval) {
+					s.Unavailable = append(s.Unavailable, a.CalendarID)
+				}
+			}
+			cands = append(cands, candidate{s, len(s.Unavailable)})
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].score < cands[j].score })
+
+	res := &Result{Errors: errs}
+	var taken []Interval
+	for _, c := range cands {
+		if len(res.Slots) == maxSlots {
+			break
+		}
+		if overlaps(taken, c.slot.Interval) {
+			continue
+		}
+		res.Slots = append(res.Slots, c.slot)
+		taken = append(taken, c.slot.Interval)
+	}
+	return res, nil
+}
+
+// overlaps reports whether x overlaps one of ivs.
+func overlaps(ivs []Interval, x Interval) bool {
+	for _, iv := range ivs {
+		if iv.Start.Before(x.End) && x.Start.Before(iv.End) {
+			return true
+		}
+	}
+	return false
+}
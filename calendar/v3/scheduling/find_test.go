@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/internal/testserver"
+)
+
+func TestFind(t *testing.T) {
+	f := &fakeFreeBusy{failed: true, busy: map[string][]*calendar.TimePeriod{
+		"alice": {period(hours(9, 10)), period(hours(12, 13))},
+		"bob":   {period(hours(10.5, 11))},
+		"carol": {period(hours(14, 17))},
+	}}
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	fi := NewFinder(svc.(*calendar.Service))
+	fi.Backoff = gax.Backoff{Initial: time.Millisecond}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := fi.Find(context.Background(), &Request{
+		Attendees: []*Attendee{
+			{CalendarID: "alice", WorkingHours: WeekdayHours(time.UTC, 9*time.Hour, 17*time.Hour)},
+			// 8:00 to 16:00 UTC.
+			{CalendarID: "bob", WorkingHours: WeekdayHours(berlin, 9*time.Hour, 17*time.Hour)},
+			{CalendarID: "carol", Optional: true},
+			{CalendarID: "dave", Optional: true},
+		},
+		Window:   hours(0, 24),
+		Duration: time.Hour,
+		Buffer:   15 * time.Minute,
+		Step:     30 * time.Minute,
+		MaxSlots: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Alice and Bob are free from 11:15 to 11:45, and from 13:15 to 16:00.
+	want := []*Slot{
+		{Interval: hours(13.5, 14.5), Unavailable: []string{"carol"}},
+		{Interval: hours(14.5, 15.5), Unavailable: []string{"carol"}},
+	}
+	// Dave's calendar is not found, so he is taken to be free.
+	if diff := cmp.Diff(want, res.Slots); diff != "" {
+		t.Errorf("slots mismatch (-want +got):\n%s", diff)
+	}
+	if len(res.Errors) != 1 || res.Errors["dave"] == nil {
+		t.Errorf("got errors %v, want an error for dave", res.Errors)
+	}
+}
+
+func TestFindRanking(t *testing.T) {
+	f := &fakeFreeBusy{failed: true, busy: map[string][]*calendar.TimePeriod{
+		"alice": {period(hours(0, 9)), period(hours(12, 24))},
+		"bob":   {period(hours(9, 10))},
+	}}
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	fi := NewFinder(svc.(*calendar.Service))
+	fi.Backoff = gax.Backoff{Initial: time.Millisecond}
+	res, err := fi.Find(context.Background(), &Request{
+		Attendees: []*Attendee{
+			{CalendarID: "alice"},
+			{CalendarID: "bob", Optional: true},
+		},
+		Window:   hours(0, 24),
+		Duration: 45 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Interval
+	for _, s := range res.Slots {
+		got = append(got, s.Interval)
+	}
+	// Slots Bob can attend first, then the others, without overlaps.
+	want := []Interval{
+		hours(10, 10.75),
+		hours(10.75, 11.5),
+		hours(9, 9.75),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("slots mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFindErrors(t *testing.T) {
+	svc, done := testserver.NewService(t, &fakeFreeBusy{}, calendar.NewService)
+	defer done()
+	fi := NewFinder(svc.(*calendar.Service))
+	fi.Backoff = gax.Backoff{Initial: time.Millisecond}
+	for _, req := range []*Request{
+		{Attendees: []*Attendee{{CalendarID: "a"}}, Window: hours(9, 10)},
+		{Attendees: []*Attendee{{CalendarID: "a"}}, Window: hours(9, 10), Duration: 2 * time.Hour},
+		{Window: hours(9, 10), Duration: time.Hour},
+	} {
+		if _, err := fi.Find(context.Background(), req); err == nil {
+			t.Errorf("%+v: got no error", req)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/semaphore"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/internal/retry"
+)
+
+const (
+	// MaxCalendarsPerQuery is the number of calendars the Calendar API
+	// allows in one free/busy query.
+	MaxCalendarsPerQuery = 50
+
+	// DefaultConcurrency is the default number of free/busy queries a
+	// Finder makes at the same time.
+	DefaultConcurrency = 4
+
+	// DefaultMaxAttempts is the default number of times a Finder tries a
+	// query.
+	DefaultMaxAttempts = retry.DefaultMaxAttempts
+)
+
+// A CalendarError is the error of a calendar whose free/busy information
+// could not be read, such as a calendar that does not exist or that the
+// caller has no access to.
+type CalendarError struct {
+	CalendarID string
+
+	// Reasons are the reasons of the errors the Calendar API reported for
+	// the calendar, such as notFound.
+	Reasons []string
+
+	// Err is the error of the query for the calendar, if the whole query
+	// failed.
+	Err error
+}
+
+func (e *CalendarError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("scheduling: calendar %s: %v", e.CalendarID, e.Err)
+	case len(e.Reasons) > 0:
+		return fmt.Sprintf("scheduling: calendar %s: %s", e.CalendarID, strings.Join(e.Reasons, ", "))
+	}
+	return fmt.Sprintf("scheduling: calendar %s: no free/busy information", e.CalendarID)
+}
+
+// A Finder queries the free/busy information of calendars and finds times
+// to meet.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Busy or Find.
+type Finder struct {
+	// Concurrency is the number of queries made at the same time. The
+	// default is DefaultConcurrency.
+	Concurrency int
+
+	// MaxAttempts is the number of times a query that fails with a
+	// transient error or an exceeded rate limit is tried. The default is
+	// DefaultMaxAttempts.
+	MaxAttempts int
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	svc *calendar.Service
+}
+
+// NewFinder returns a Finder that uses svc.
+func NewFinder(svc *calendar.Service) *Finder {
+	return &Finder{
+		Concurrency: DefaultConcurrency,
+		MaxAttempts: DefaultMaxAttempts,
+		svc:         svc,
+	}
+}
+
+// Busy returns the merged busy intervals of the calendars with the given
+// IDs in the interval w. The calendars are queried MaxCalendarsPerQuery at
+// a time.
+//
+// The calendars whose information could not be read are not in busy, and
+// have a *CalendarError in errs. Busy returns an error only if ctx is done
+// before all calendars are queried.
+func (f *Finder) Busy(ctx context.Context, calendarIDs []string, w Interval) (busy map[string][]Interval, errs map[string]error, err error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range calendarIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	busy = make(map[string][]Interval)
+	errs = make(map[string]error)
+	var mu sync.Mutex
+	n := f.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	sem := semaphore.NewWeighted(int64(n))
+	var wg sync.WaitGroup
+	for len(ids) > 0 {
+		chunk := ids
+		if len(chunk) > MaxCalendarsPerQuery {
+			chunk = chunk[:MaxCalendarsPerQuery]
+		}
+		ids = ids[len(chunk):]
+		// The fast path of Acquire ignores a done ctx.
+		if err = ctx.Err(); err == nil {
+			err = sem.Acquire(ctx, 1)
+		}
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(chunk []string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			b, e := f.query(ctx, chunk, w)
+			mu.Lock()
+			defer mu.Unlock()
+			for id, ivs := range b {
+				busy[id] = ivs
+			}
+			for id, err := range e {
+				errs[id] = err
+			}
+		}(chunk)
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+	return busy, errs, nil
+}
+
+// query queries the free/busy information of at most MaxCalendarsPerQuery
+// calendars.
+func (f *Finder) query(ctx context.Context, ids []string, w Interval) (map[string][]Interval, map[string]error) {
+	req := &calendar.FreeBusyRequest{
+		TimeMin:  w.Start.UTC().Format(time.RFC3339),
+		TimeMax:  w.End.UTC().Format(time.RFC3339),
+		TimeZone: "UTC",
+	}
+	for _, id := range ids {
+		req.Items = append(req.Items, &calendar.FreeBusyRequestItem{Id: id})
+	}
+	var res *calendar.FreeBusyResponse
+	err := retry.Do(ctx, f.Backoff, f.MaxAttempts, func() error {
+		var err error
+		res, err = f.svc.Freebusy.Query(req).Context(ctx).Do()
+		return err
+	})
+	busy := make(map[string][]Interval)
+	errs := make(map[string]error)
+	for _, id := range ids {
+		if err != nil {
+			errs[id] = &CalendarError{CalendarID: id, Err: err}
+			continue
+		}
+		c, ok := res.Calendars[id]
+		if !ok || len(c.Errors) > 0 {
+			e := &CalendarError{CalendarID: id}
+			for _, ce := range c.Errors {
+				e.Reasons = append(e.Reasons, ce.Reason)
+			}
+			errs[id] = e
+			continue
+		}
+		ivs, err := parsePeriods(c.Busy)
+		if err != nil {
+			errs[id] = &CalendarError{CalendarID: id, Err: err}
+			continue
+		}
+		busy[id] = ivs
+	}
+	return busy, errs
+}
+
+// parsePeriods returns the merged intervals of periods.
+func parsePeriods(periods []*calendar.TimePeriod) ([]Interval, error) {
+	var ivs []Interval
+	for _, p := range periods {
+		start, err := time.Parse(time.RFC3339, p.Start)
+		if err != nil {
+			return nil, fmt.Errorf("bad busy period start %q", p.Start)
+		}
+		end, err := time.Parse(time.RFC3339, p.End)
+		if err != nil {
+			return nil, fmt.Errorf("bad busy period end %q", p.End)
+		}
+		ivs = append(ivs, Interval{start, end})
+	}
+	return Merge(ivs), nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeFreeBusy answers free/busy queries with the busy periods in busy.
+// Calendars not in busy are not found, and queries for calendar "broken"
+// fail. The first query fails with status 503.
+type fakeFreeBusy struct {
+	busy map[string][]*calendar.TimePeriod
+
+	mu      sync.Mutex
+	queries [][]string
+	failed  bool
+}
+
+func (f *fakeFreeBusy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.URL.Path != "/freeBusy" {
+		http.Error(w, "bad request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req calendar.FreeBusyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.failed {
+		f.failed = true
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	var ids []string
+	res := &calendar.FreeBusyResponse{Calendars: make(map[string]calendar.FreeBusyCalendar)}
+	for _, it := range req.Items {
+		ids = append(ids, it.Id)
+		if it.Id == "broken" {
+			http.Error(w, "bad calendar", http.StatusBadRequest)
+			return
+		}
+		if b, ok := f.busy[it.Id]; ok {
+			res.Calendars[it.Id] = calendar.FreeBusyCalendar{Busy: b}
+		} else {
+			res.Calendars[it.Id] = calendar.FreeBusyCalendar{Errors: []*calendar.Error{{Domain: "global", Reason: "notFound"}}}
+		}
+	}
+	f.queries = append(f.queries, ids)
+	json.NewEncoder(w).Encode(res)
+}
+
+func period(iv Interval) *calendar.TimePeriod {
+	return &calendar.TimePeriod{Start: iv.Start.Format(time.RFC3339), End: iv.End.Format(time.RFC3339)}
+}
+
+func TestBusy(t *testing.T) {
+	f := &fakeFreeBusy{busy: make(map[string][]*calendar.TimePeriod)}
+	var ids []string
+	for i := 0; i < 120; i++ {
+		id := fmt.Sprintf("user%d@example.com", i)
+		ids = append(ids, id)
+		if i != 7 {
+			f.busy[id] = []*calendar.TimePeriod{period(hours(10, 11)), period(hours(9, 10))}
+		}
+	}
+	// A duplicate.
+	ids = append(ids, ids[0])
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	fi := NewFinder(svc.(*calendar.Service))
+	fi.Backoff = gax.Backoff{Initial: time.Millisecond}
+	busy, errs, err := fi.Busy(context.Background(), ids, hours(0, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.queries) != 3 {
+		t.Errorf("got %d queries, want 3", len(f.queries))
+	}
+	for _, q := range f.queries {
+		if len(q) > MaxCalendarsPerQuery {
+			t.Errorf("query with %d calendars", len(q))
+		}
+	}
+	if len(busy) != 119 {
+		t.Errorf("got busy times of %d calendars, want 119", len(busy))
+	}
+	if got, want := busy["user0@example.com"], []Interval{hours(9, 11)}; !cmp.Equal(got, want) {
+		t.Errorf("busy times of user0 = %v, want %v", got, want)
+	}
+	want := map[string]error{
+		"user7@example.com": &CalendarError{CalendarID: "user7@example.com", Reasons: []string{"notFound"}},
+	}
+	if diff := cmp.Diff(want, errs); diff != "" {
+		t.Errorf("errors mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := errs["user7@example.com"].Error(), "scheduling: calendar user7@example.com: notFound"; got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+}
+
+func TestBusyFailedQuery(t *testing.T) {
+	f := &fakeFreeBusy{failed: true, busy: map[string][]*calendar.TimePeriod{"a": nil}}
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	fi := NewFinder(svc.(*calendar.Service))
+	fi.Backoff = gax.Backoff{Initial: time.Millisecond}
+	busy, errs, err := fi.Busy(context.Background(), []string{"a", "broken"}, hours(0, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busy) != 0 || len(errs) != 2 {
+		t.Fatalf("got %d busy and %d errors, want 0 and 2", len(busy), len(errs))
+	}
+	if got := errs["a"].Error(); !strings.HasPrefix(got, "scheduling: calendar a: googleapi: got HTTP response code 400") {
+		t.Errorf("got error %q", got)
+	}
+}
+
+func TestBusyCanceled(t *testing.T) {
+	f := &fakeFreeBusy{}
+	svc, done := testserver.NewService(t, f, calendar.NewService)
+	defer done()
+	fi := NewFinder(svc.(*calendar.Service))
+	fi.Backoff = gax.Backoff{Initial: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := fi.Busy(ctx, []string{"a"}, hours(0, 24)); err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
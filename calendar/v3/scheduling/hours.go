@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import "time"
+
+// A TimeRange is a range of times of day, as durations since midnight.
+// An End of 24 hours is midnight at the end of the day.
+type TimeRange struct {
+	Start, End time.Duration
+}
+
+// WorkingHours are the times of the week an attendee can meet.
+type WorkingHours struct {
+	// Location is the time zone of the hours. Nil means UTC.
+	Location *time.Location
+
+	// Days are the ranges of times of each day of the week, indexed by
+	// time.Weekday. A day with no ranges is a day off.
+	Days [7][]TimeRange
+}
+
+// WeekdayHours returns working hours from start to end, as durations since
+// midnight, Monday to Friday in loc.
+func WeekdayHours(loc *time.Location, start, end time.Duration) *WorkingHours {
+	h := &WorkingHours{Location: loc}
+	for d := time.Monday; d <= time.Friday; d++ {
+		h.Days[d] = []TimeRange{{start, end}}
+	}
+	return h
+}
+
+// intervals returns the working hours in the interval w, merged.
+func (h *WorkingHours) intervals(w Interval) []Interval {
+	loc := h.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var ivs []Interval
+	// Start a day early, for ranges that end after midnight.
+	s := w.Start.In(loc).AddDate(0, 0, -1)
+	for day := time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, loc); day.Before(w.End); day = day.AddDate(0, 0, 1) {
+		for _, r := range h.Days[day.Weekday()] {
+			iv := Interval{at(day, r.Start), at(day, r.End)}
+			ivs = append(ivs, intersect([]Interval{iv}, []Interval{w})...)
+		}
+	}
+	return Merge(ivs)
+}
+
+// at returns the time d after midnight on the day of midnight, by the wall
+// clock, so that days with changes to daylight saving time keep their
+// hours.
+func at(midnight time.Time, d time.Duration) time.Time {
+	y, m, day := midnight.Date()
+	days := int(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	return time.Date(y, m, day+days, int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second), 0, midnight.Location())
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWorkingHours(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := WeekdayHours(ny, 9*time.Hour, 17*time.Hour)
+	// A night shift on Sunday, past midnight.
+	h.Days[time.Sunday] = []TimeRange{{22 * time.Hour, 26 * time.Hour}}
+	// The week of the change to daylight saving time, on Sunday, March 8.
+	w := Interval{time.Date(2020, 3, 6, 0, 0, 0, 0, time.UTC), time.Date(2020, 3, 10, 0, 0, 0, 0, time.UTC)}
+	got := h.intervals(w)
+	local := func(d, h int) time.Time { return time.Date(2020, 3, d, h, 0, 0, 0, ny) }
+	want := []Interval{
+		{local(6, 9), local(6, 17)},
+		{local(8, 22), local(9, 2)},
+		// The window ends at 20:00 on Monday in New York, before the night
+		// shift.
+		{local(9, 9), local(9, 17)},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(time.Time.Equal)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got[0].End.Sub(got[0].Start) != 8*time.Hour || got[2].End.Sub(got[2].Start) != 8*time.Hour {
+		t.Errorf("working days are not 8 hours long: %v", got)
+	}
+}
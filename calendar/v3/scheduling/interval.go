@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"sort"
+	"time"
+)
+
+// An Interval is the time from Start, inclusive, to End, exclusive.
+type Interval struct {
+	Start, End time.Time
+}
+
+func (iv Interval) String() string {
+	return iv.Start.Format(time.RFC3339) + "/" + iv.End.Format(time.RFC3339)
+}
+
+// Empty reports whether iv contains no time.
+func (iv Interval) Empty() bool {
+	return !iv.End.After(iv.Start)
+}
+
+// contains reports whether iv contains x.
+func (iv Interval) contains(x Interval) bool {
+	return !x.Start.Before(iv.Start) && !x.End.After(iv.End)
+}
+
+// Merge returns the union of ivs as intervals that are sorted, not empty
+// and neither overlap nor touch.
+func Merge(ivs []Interval) []Interval {
+	var s []Interval
+	for _, iv := range ivs {
+		if !iv.Empty() {
+			s = append(s, iv)
+		}
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Start.Before(s[j].Start) })
+	var out []Interval
+	for _, iv := range s {
+		if n := len(out); n > 0 && !iv.Start.After(out[n-1].End) {
+			if iv.End.After(out[n-1].End) {
+				out[n-1].End = iv.End
+			}
+			continue
+		}
+		out = append(out, iv)
+	}
+	return out
+}
+
+// subtract returns the times of free, which is merged, that are not in
+// busy, which is merged.
+func subtract(free, busy []Interval) []Interval {
+	var out []Interval
+	j := 0
+	for _, iv := range free {
+		for j < len(busy) && !busy[j].End.After(iv.Start) {
+			j++
+		}
+		for k := j; k < len(busy) && busy[k].Start.Before(iv.End); k++ {
+			if busy[k].Start.After(iv.Start) {
+				out = append(out, Interval{iv.Start, busy[k].Start})
+			}
+			if busy[k].End.After(iv.Start) {
+				iv.Start = busy[k].End
+			}
+		}
+		if !iv.Empty() {
+			out = append(out, iv)
+		}
+	}
+	return out
+}
+
+// intersect returns the times in both a and b, which are merged.
+func intersect(a, b []Interval) []Interval {
+	var out []Interval
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		iv := Interval{latest(a[i].Start, b[j].Start), earliest(a[i].End, b[j].End)}
+		if !iv.Empty() {
+			out = append(out, iv)
+		}
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// grow returns ivs, which are merged, with d more time before and after
+// each interval.
+func grow(ivs []Interval, d time.Duration) []Interval {
+	if d == 0 {
+		return ivs
+	}
+	out := make([]Interval, len(ivs))
+	for i, iv := range ivs {
+		out[i] = Interval{iv.Start.Add(-d), iv.End.Add(d)}
+	}
+	return Merge(out)
+}
+
+// covers reports whether one of ivs, which are merged, contains x.
+func covers(ivs []Interval, x Interval) bool {
+	i := sort.Search(len(ivs), func(i int) bool { return ivs[i].End.After(x.Start) })
+	return i < len(ivs) && ivs[i].contains(x)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
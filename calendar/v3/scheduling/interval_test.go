@@ -0,0 +1,74 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var day = time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+
+// hours returns the interval from hour a to hour b of day.
+func hours(a, b float64) Interval {
+	h := func(x float64) time.Time { return day.Add(time.Duration(x * float64(time.Hour))) }
+	return Interval{h(a), h(b)}
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge([]Interval{hours(5, 6), hours(1, 2), hours(2, 3), hours(4, 4), hours(5.5, 7), hours(9, 10), hours(1.5, 1.75)})
+	want := []Interval{hours(1, 3), hours(5, 7), hours(9, 10)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	free := []Interval{hours(9, 12), hours(13, 17)}
+	busy := []Interval{hours(8, 9.5), hours(10, 10.5), hours(11.5, 13.5), hours(16, 18)}
+	got := subtract(free, busy)
+	want := []Interval{hours(9.5, 10), hours(10.5, 11.5), hours(13.5, 16)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got := subtract(free, nil); !cmp.Equal(got, free) {
+		t.Errorf("subtract(free, nil) = %v, want %v", got, free)
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	a := []Interval{hours(9, 12), hours(13, 17)}
+	b := []Interval{hours(8, 9.5), hours(11, 14), hours(16, 18)}
+	got := intersect(a, b)
+	want := []Interval{hours(9, 9.5), hours(11, 12), hours(13, 14), hours(16, 17)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGrowAndCovers(t *testing.T) {
+	ivs := grow([]Interval{hours(9, 10), hours(10.25, 11)}, 10*time.Minute)
+	if want := []Interval{hours(9-1.0/6, 11+1.0/6)}; !cmp.Equal(ivs, want) {
+		t.Errorf("grow = %v, want %v", ivs, want)
+	}
+	ivs = []Interval{hours(9, 10), hours(11, 12)}
+	for _, test := range []struct {
+		x    Interval
+		want bool
+	}{
+		{hours(9, 10), true},
+		{hours(9.5, 9.75), true},
+		{hours(9.5, 10.5), false},
+		{hours(10, 11), false},
+		{hours(11.5, 12), true},
+		{hours(12, 13), false},
+	} {
+		if got := covers(ivs, test.x); got != test.want {
+			t.Errorf("covers(%v) = %t, want %t", test.x, got, test.want)
+		}
+	}
+}
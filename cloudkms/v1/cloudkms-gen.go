@@ -998,11 +998,47 @@ type DecryptRequest struct {
 	// EncryptRequest.additional_authenticated_data.
 	AdditionalAuthenticatedData string `json:"additionalAuthenticatedData,omitempty"`
 
+	// AdditionalAuthenticatedDataCrc32c: Optional. An optional CRC32C
+	// checksum of the DecryptRequest.additional_authenticated_data.
+	// If
+	// specified, KeyManagementService will verify the integrity of
+	// the
+	// received DecryptRequest.additional_authenticated_data using this
+	// checksum.
+	// KeyManagementService will report an error if the checksum
+	// verification
+	// fails. If you receive a checksum error, your client should verify
+	// that
+	// DecryptRequest.additional_authenticated_data_crc32c is equal to
+	// CRC32C(DecryptRequest.additional_authenticated_data), and if so,
+	// perform
+	// a limited number of retries. A persistent mismatch may indicate an
+	// issue in
+	// your computation of the CRC32C checksum.
+	AdditionalAuthenticatedDataCrc32c int64 `json:"additionalAuthenticatedDataCrc32c,omitempty,string"`
+
 	// Ciphertext: Required. The encrypted data originally returned
 	// in
 	// EncryptResponse.ciphertext.
 	Ciphertext string `json:"ciphertext,omitempty"`
 
+	// CiphertextCrc32c: Optional. An optional CRC32C checksum of the
+	// DecryptRequest.ciphertext. If
+	// specified, KeyManagementService will verify the integrity of
+	// the
+	// received DecryptRequest.ciphertext using this
+	// checksum.
+	// KeyManagementService will report an error if the checksum
+	// verification
+	// fails. If you receive a checksum error, your client should verify
+	// that
+	// DecryptRequest.ciphertext_crc32c is equal to
+	// CRC32C(DecryptRequest.ciphertext), and if so, perform
+	// a limited number of retries. A persistent mismatch may indicate an
+	// issue in
+	// your computation of the CRC32C checksum.
+	CiphertextCrc32c int64 `json:"ciphertextCrc32c,omitempty,string"`
+
 	// ForceSendFields is a list of field names (e.g.
 	// "AdditionalAuthenticatedData") to unconditionally include in API
 	// requests. By default, fields with empty values are omitted from API
@@ -1034,6 +1070,21 @@ type DecryptResponse struct {
 	// EncryptRequest.plaintext.
 	Plaintext string `json:"plaintext,omitempty"`
 
+	// PlaintextCrc32c: Integrity verification field. A CRC32C checksum of
+	// the returned
+	// DecryptResponse.plaintext. An integrity check of
+	// DecryptResponse.plaintext can be
+	// performed by computing the CRC32C checksum of
+	// DecryptResponse.plaintext
+	// and comparing your results to this field. Discard the response in
+	// case of
+	// non-matching checksum values, and perform a limited number of
+	// retries. A
+	// persistent mismatch may indicate an issue in your computation of the
+	// CRC32C
+	// checksum.
+	PlaintextCrc32c int64 `json:"plaintextCrc32c,omitempty,string"`
+
 	// ServerResponse contains the HTTP response code and headers from the
 	// server.
 	googleapi.ServerResponse `json:"-"`
@@ -1115,6 +1166,25 @@ type EncryptRequest struct {
 	// 8KiB.
 	AdditionalAuthenticatedData string `json:"additionalAuthenticatedData,omitempty"`
 
+	// AdditionalAuthenticatedDataCrc32c: Optional. An optional CRC32C
+	// checksum of the EncryptRequest.additional_authenticated_data.
+	// If
+	// specified, KeyManagementService will verify the integrity of
+	// the
+	// received EncryptRequest.additional_authenticated_data using this
+	// checksum.
+	// KeyManagementService will report an error if the checksum
+	// verification
+	// fails. If you receive a checksum error, your client should verify
+	// that
+	// EncryptRequest.additional_authenticated_data_crc32c is equal to
+	// CRC32C(EncryptRequest.additional_authenticated_data), and if so,
+	// perform
+	// a limited number of retries. A persistent mismatch may indicate an
+	// issue in
+	// your computation of the CRC32C checksum.
+	AdditionalAuthenticatedDataCrc32c int64 `json:"additionalAuthenticatedDataCrc32c,omitempty,string"`
+
 	// Plaintext: Required. The data to encrypt. Must be no larger than
 	// 64KiB.
 	//
@@ -1127,6 +1197,23 @@ type EncryptRequest struct {
 	// 8KiB.
 	Plaintext string `json:"plaintext,omitempty"`
 
+	// PlaintextCrc32c: Optional. An optional CRC32C checksum of the
+	// EncryptRequest.plaintext. If
+	// specified, KeyManagementService will verify the integrity of
+	// the
+	// received EncryptRequest.plaintext using this
+	// checksum.
+	// KeyManagementService will report an error if the checksum
+	// verification
+	// fails. If you receive a checksum error, your client should verify
+	// that
+	// EncryptRequest.plaintext_crc32c is equal to
+	// CRC32C(EncryptRequest.plaintext), and if so, perform
+	// a limited number of retries. A persistent mismatch may indicate an
+	// issue in
+	// your computation of the CRC32C checksum.
+	PlaintextCrc32c int64 `json:"plaintextCrc32c,omitempty,string"`
+
 	// ForceSendFields is a list of field names (e.g.
 	// "AdditionalAuthenticatedData") to unconditionally include in API
 	// requests. By default, fields with empty values are omitted from API
@@ -1157,12 +1244,61 @@ type EncryptResponse struct {
 	// Ciphertext: The encrypted data.
 	Ciphertext string `json:"ciphertext,omitempty"`
 
+	// CiphertextCrc32c: Integrity verification field. A CRC32C checksum of
+	// the returned
+	// EncryptResponse.ciphertext. An integrity check of
+	// EncryptResponse.ciphertext can be
+	// performed by computing the CRC32C checksum of
+	// EncryptResponse.ciphertext
+	// and comparing your results to this field. Discard the response in
+	// case of
+	// non-matching checksum values, and perform a limited number of
+	// retries. A
+	// persistent mismatch may indicate an issue in your computation of the
+	// CRC32C
+	// checksum.
+	CiphertextCrc32c int64 `json:"ciphertextCrc32c,omitempty,string"`
+
 	// Name: The resource name of the CryptoKeyVersion used in encryption.
 	// Check
 	// this field to verify that the intended resource was used for
 	// encryption.
 	Name string `json:"name,omitempty"`
 
+	// VerifiedAdditionalAuthenticatedDataCrc32c: Integrity verification
+	// field. A flag indicating
+	// whether
+	// EncryptRequest.additional_authenticated_data_crc32c was received
+	// by
+	// KeyManagementService and used for the integrity verification of
+	// the
+	// EncryptRequest.additional_authenticated_data. A false value of this
+	// field
+	// indicates either that
+	// EncryptRequest.additional_authenticated_data_crc32c was left unset
+	// or
+	// that it was not delivered to KeyManagementService. If you've
+	// set
+	// EncryptRequest.additional_authenticated_data_crc32c but this field is
+	// still false, discard
+	// the response and perform a limited number of retries.
+	VerifiedAdditionalAuthenticatedDataCrc32c bool `json:"verifiedAdditionalAuthenticatedDataCrc32c,omitempty"`
+
+	// VerifiedPlaintextCrc32c: Integrity verification field. A flag
+	// indicating whether
+	// EncryptRequest.plaintext_crc32c was received by
+	// KeyManagementService and used for the integrity verification of
+	// the
+	// EncryptRequest.plaintext. A false value of this field
+	// indicates either that EncryptRequest.plaintext_crc32c was left unset
+	// or
+	// that it was not delivered to KeyManagementService. If you've
+	// set
+	// EncryptRequest.plaintext_crc32c but this field is still false,
+	// discard
+	// the response and perform a limited number of retries.
+	VerifiedPlaintextCrc32c bool `json:"verifiedPlaintextCrc32c,omitempty"`
+
 	// ServerResponse contains the HTTP response code and headers from the
 	// server.
 	googleapi.ServerResponse `json:"-"`
@@ -0,0 +1,43 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package envelope implements envelope encryption with Cloud KMS, using the
+// Cloud KMS REST API (google.golang.org/api/cloudkms/v1).
+//
+// Data is encrypted with a fresh AES-256-GCM data key, and the data key is
+// encrypted ("wrapped") with a Cloud KMS CryptoKey. The wrapped key is
+// stored with the ciphertext, so only principals allowed to decrypt with
+// the CryptoKey can decrypt the data:
+//
+//	c := envelope.NewClient(svc, "projects/p/locations/global/keyRings/r/cryptoKeys/k")
+//	ciphertext, err := c.Encrypt(ctx, plaintext, []byte("user:alice"))
+//	...
+//	plaintext, err = c.Decrypt(ctx, ciphertext, []byte("user:alice"))
+//
+// NewWriter and NewReader encrypt and decrypt streams in chunks, for data
+// too large to hold in memory. Encrypt and NewWriter produce the same
+// format, so either of Decrypt and NewReader can decrypt it.
+//
+// Version 1 of the ciphertext format is a header followed by chunks:
+//
+//	magic        "GKMSENV" and the version byte 1
+//	key name     uint16 length and the CryptoKey resource name
+//	wrapped key  uint32 length and the ciphertext returned by Encrypt
+//	chunk size   uint32 size of the plaintext of each chunk but the last
+//	nonce prefix 7 random bytes
+//	chunks       AES-256-GCM ciphertexts, each followed by its 16-byte tag
+//
+// Integers are big-endian. The nonce of chunk i is the nonce prefix, i as
+// a big-endian uint32, and a byte set to 1 for the last chunk and 0 for the
+// others, so chunks cannot be reordered, dropped or truncated without
+// detection. The associated data of each chunk is the header followed by
+// the associated data given by the caller. The last chunk may be empty.
+//
+// Calls to Cloud KMS carry the CRC32C checksums of the data sent, which
+// Cloud KMS verifies, and the checksums of the data returned are verified,
+// to detect corruption in transit. Encrypt responses are also checked to
+// name a version of the requested CryptoKey.
+//
+// This package is experimental and subject to change without notice.
+package envelope
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"time"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+const (
+	// DataKeySize is the size of data keys, for AES-256.
+	DataKeySize = 32
+
+	// DefaultChunkSize is the default size of the plaintext of a chunk.
+	DefaultChunkSize = 64 * 1024
+
+	// DefaultCacheTTL is the default time unwrapped data keys are cached.
+	DefaultCacheTTL = 5 * time.Minute
+
+	// DefaultMaxCachedKeys is the default maximum number of cached data
+	// keys.
+	DefaultMaxCachedKeys = 1000
+)
+
+// A Client encrypts data with data keys wrapped by a Cloud KMS CryptoKey.
+//
+// The exported fields are only safe to modify prior to the first call to a
+// method.
+type Client struct {
+	// ChunkSize is the size of the plaintext of each chunk of the
+	// ciphertexts written by Encrypt and NewWriter. The default is
+	// DefaultChunkSize.
+	ChunkSize int
+
+	// CacheTTL is how long data keys unwrapped by Decrypt and NewReader are
+	// kept, to decrypt other ciphertexts with the same wrapped key without
+	// calling Cloud KMS. Zero disables the cache. The default is
+	// DefaultCacheTTL.
+	CacheTTL time.Duration
+
+	// MaxCachedKeys is the maximum number of data keys in the cache. The
+	// default is DefaultMaxCachedKeys.
+	MaxCachedKeys int
+
+	svc     *cloudkms.Service
+	keyName string
+
+	mu    sync.Mutex
+	cache map[string]cachedKey // by wrapped key
+}
+
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+// NewClient returns a Client that wraps data keys with the CryptoKey with
+// the given resource name, as in
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k".
+func NewClient(svc *cloudkms.Service, keyName string) *Client {
+	return &Client{
+		ChunkSize:     DefaultChunkSize,
+		CacheTTL:      DefaultCacheTTL,
+		MaxCachedKeys: DefaultMaxCachedKeys,
+		svc:           svc,
+		keyName:       keyName,
+		cache:         map[string]cachedKey{},
+	}
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// crc32c returns the CRC32C checksum of b, as in the checksum fields of the
+// Cloud KMS API.
+func crc32c(b []byte) int64 {
+	return int64(crc32.Checksum(b, crc32cTable))
+}
+
+// GenerateDataKey returns a new random AES-256 key.
+func GenerateDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("envelope: generating data key: %v", err)
+	}
+	return key, nil
+}
+
+// WrapKey encrypts a data key with the CryptoKey of c. The CRC32C checksums
+// of the key sent and of the wrapped key received are verified.
+func (c *Client) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	req := &cloudkms.EncryptRequest{
+		Plaintext:       base64.StdEncoding.EncodeToString(key),
+		PlaintextCrc32c: crc32c(key),
+		ForceSendFields: []string{"PlaintextCrc32c"},
+	}
+	resp, err := c.svc.Projects.Locations.KeyRings.CryptoKeys.Encrypt(c.keyName, req).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("envelope: wrapping data key: %v", err)
+	}
+	if !resp.VerifiedPlaintextCrc32c {
+		return nil, errors.New("envelope: Cloud KMS did not verify the checksum of the data key")
+	}
+	// The response names the key version used, which must belong to the
+	// requested key.
+	if !strings.HasPrefix(resp.Name, c.keyName+"/cryptoKeyVersions/") {
+		return nil, fmt.Errorf("envelope: key was wrapped with %q, not a version of %q", resp.Name, c.keyName)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: bad wrapped key: %v", err)
+	}
+	if crc32c(wrapped) != resp.CiphertextCrc32c {
+		return nil, errors.New("envelope: wrapped key does not match its checksum")
+	}
+	return wrapped, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey, using the cache. The
+// CRC32C checksums of the wrapped key sent and of the key received are
+// verified.
+func (c *Client) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if key := c.cachedKey(wrapped); key != nil {
+		return key, nil
+	}
+	req := &cloudkms.DecryptRequest{
+		Ciphertext:       base64.StdEncoding.EncodeToString(wrapped),
+		CiphertextCrc32c: crc32c(wrapped),
+		ForceSendFields:  []string{"CiphertextCrc32c"},
+	}
+	resp, err := c.svc.Projects.Locations.KeyRings.CryptoKeys.Decrypt(c.keyName, req).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("envelope: unwrapping data key: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: bad unwrapped key: %v", err)
+	}
+	if crc32c(key) != resp.PlaintextCrc32c {
+		return nil, errors.New("envelope: unwrapped key does not match its checksum")
+	}
+	if len(key) != DataKeySize {
+		return nil, fmt.Errorf("envelope: unwrapped key has %d bytes, want %d", len(key), DataKeySize)
+	}
+	c.cacheKey(wrapped, key)
+	return key, nil
+}
+
+func (c *Client) cachedKey(wrapped []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.cache[string(wrapped)]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(e.expires) {
+		delete(c.cache, string(wrapped))
+		return nil
+	}
+	return e.key
+}
+
+func (c *Client) cacheKey(wrapped, key []byte) {
+	if c.CacheTTL <= 0 || c.MaxCachedKeys <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= c.MaxCachedKeys {
+		// Drop expired keys, or else the key that expires first.
+		var oldest string
+		for w, e := range c.cache {
+			if !now.Before(e.expires) {
+				delete(c.cache, w)
+			} else if oldest == "" || e.expires.Before(c.cache[oldest].expires) {
+				oldest = w
+			}
+		}
+		if len(c.cache) >= c.MaxCachedKeys {
+			delete(c.cache, oldest)
+		}
+	}
+	c.cache[string(wrapped)] = cachedKey{key: key, expires: now.Add(c.CacheTTL)}
+}
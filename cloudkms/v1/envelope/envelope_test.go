@@ -0,0 +1,225 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/internal/testserver"
+)
+
+const testKey = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+// fakeKMS is a stand-in for the Encrypt and Decrypt methods of Cloud KMS,
+// encrypting with a fixed AES-GCM key and a zero nonce. Like Cloud KMS, it
+// verifies the checksums of requests and sets those of responses.
+type fakeKMS struct {
+	aead cipher.AEAD
+
+	mu       sync.Mutex
+	encrypts int
+	decrypts int
+	name     string // overrides the key version name returned by Encrypt
+	corrupt  bool   // return wrong checksums, as if responses were corrupted
+}
+
+func newFakeKMS() *fakeKMS {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &fakeKMS{aead: aead}
+}
+
+func (f *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nonce := make([]byte, f.aead.NonceSize())
+	var resp interface{}
+	switch r.URL.Path {
+	case "/v1/" + testKey + ":encrypt":
+		f.encrypts++
+		var req cloudkms.EncryptRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		pt, _ := base64.StdEncoding.DecodeString(req.Plaintext)
+		if req.PlaintextCrc32c != crc32c(pt) {
+			http.Error(w, "checksum mismatch", http.StatusBadRequest)
+			return
+		}
+		name := f.name
+		if name == "" {
+			name = testKey + "/cryptoKeyVersions/1"
+		}
+		ct := f.aead.Seal(nil, nonce, pt, nil)
+		resp = &cloudkms.EncryptResponse{
+			Name:                    name,
+			Ciphertext:              base64.StdEncoding.EncodeToString(ct),
+			CiphertextCrc32c:        f.checksum(ct),
+			VerifiedPlaintextCrc32c: true,
+		}
+	case "/v1/" + testKey + ":decrypt":
+		f.decrypts++
+		var req cloudkms.DecryptRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		ct, _ := base64.StdEncoding.DecodeString(req.Ciphertext)
+		if req.CiphertextCrc32c != crc32c(ct) {
+			http.Error(w, "checksum mismatch", http.StatusBadRequest)
+			return
+		}
+		pt, err := f.aead.Open(nil, nonce, ct, nil)
+		if err != nil {
+			http.Error(w, "bad ciphertext", http.StatusBadRequest)
+			return
+		}
+		resp = &cloudkms.DecryptResponse{
+			Plaintext:       base64.StdEncoding.EncodeToString(pt),
+			PlaintextCrc32c: f.checksum(pt),
+		}
+	default:
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeKMS) checksum(b []byte) int64 {
+	if f.corrupt {
+		return crc32c(b) + 1
+	}
+	return crc32c(b)
+}
+
+func (f *fakeKMS) counts() (encrypts, decrypts int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.encrypts, f.decrypts
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	ctx := context.Background()
+	key, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := c.WrapKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		got, err := c.UnwrapKey(ctx, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, key) {
+			t.Fatalf("got key %x, want %x", got, key)
+		}
+	}
+	if _, decrypts := f.counts(); decrypts != 1 {
+		t.Errorf("got %d Decrypt calls, want 1", decrypts)
+	}
+
+	f.mu.Lock()
+	f.name = "projects/p/locations/global/keyRings/r/cryptoKeys/other/cryptoKeyVersions/1"
+	f.mu.Unlock()
+	if _, err := c.WrapKey(ctx, key); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("wrong key version: got %v, want error", err)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	ctx := context.Background()
+	key, _ := GenerateDataKey()
+	wrapped, err := c.WrapKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.corrupt = true
+	f.mu.Unlock()
+	if _, err := c.WrapKey(ctx, key); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("WrapKey: got %v, want checksum error", err)
+	}
+	if _, err := c.UnwrapKey(ctx, wrapped); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("UnwrapKey: got %v, want checksum error", err)
+	}
+	if c.cachedKey(wrapped) != nil {
+		t.Error("key with a bad checksum was cached")
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	c.MaxCachedKeys = 2
+	ctx := context.Background()
+	var wrapped [][]byte
+	for i := 0; i < 3; i++ {
+		key, _ := GenerateDataKey()
+		w, err := c.WrapKey(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapped = append(wrapped, w)
+		if _, err := c.UnwrapKey(ctx, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.cache) != 2 {
+		t.Errorf("got %d cached keys, want 2", len(c.cache))
+	}
+	// The first key was evicted.
+	if c.cachedKey(wrapped[0]) != nil || c.cachedKey(wrapped[2]) == nil {
+		t.Error("wrong key evicted")
+	}
+
+	// Expired keys are unwrapped again.
+	c.mu.Lock()
+	for w, e := range c.cache {
+		e.expires = time.Now().Add(-time.Second)
+		c.cache[w] = e
+	}
+	c.mu.Unlock()
+	_, before := f.counts()
+	if _, err := c.UnwrapKey(ctx, wrapped[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, after := f.counts(); after != before+1 {
+		t.Errorf("got %d Decrypt calls, want %d", after, before+1)
+	}
+
+	c.CacheTTL = 0
+	c.cache = map[string]cachedKey{}
+	if _, err := c.UnwrapKey(ctx, wrapped[1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.cache) != 0 {
+		t.Error("key cached with zero CacheTTL")
+	}
+}
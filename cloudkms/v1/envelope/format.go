@@ -0,0 +1,357 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+const (
+	magic           = "GKMSENV"
+	formatVersion   = 1
+	noncePrefixSize = 7
+	tagSize         = 16
+
+	// maxChunkSize and maxWrappedKeySize bound the allocations made for
+	// a header read from an untrusted ciphertext.
+	maxChunkSize      = 64 << 20
+	maxWrappedKeySize = 64 << 10
+)
+
+var errCorrupted = errors.New("envelope: ciphertext is corrupted, or associated data does not match")
+
+// A header is the header of a ciphertext.
+type header struct {
+	keyName     string
+	wrappedKey  []byte
+	chunkSize   int
+	noncePrefix []byte
+}
+
+func (h *header) marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString(magic)
+	b.WriteByte(formatVersion)
+	binary.Write(&b, binary.BigEndian, uint16(len(h.keyName)))
+	b.WriteString(h.keyName)
+	binary.Write(&b, binary.BigEndian, uint32(len(h.wrappedKey)))
+	b.Write(h.wrappedKey)
+	binary.Write(&b, binary.BigEndian, uint32(h.chunkSize))
+	b.Write(h.noncePrefix)
+	return b.Bytes()
+}
+
+func readHeader(r io.Reader) (*header, error) {
+	bad := func(err error) (*header, error) {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errors.New("envelope: ciphertext is truncated")
+		}
+		return nil, err
+	}
+	start := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, start); err != nil {
+		return bad(err)
+	}
+	if string(start[:len(magic)]) != magic {
+		return nil, errors.New("envelope: not an envelope ciphertext")
+	}
+	if v := start[len(magic)]; v != formatVersion {
+		return nil, fmt.Errorf("envelope: unsupported format version %d", v)
+	}
+	h := &header{}
+	var n16 uint16
+	if err := binary.Read(r, binary.BigEndian, &n16); err != nil {
+		return bad(err)
+	}
+	name := make([]byte, n16)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return bad(err)
+	}
+	h.keyName = string(name)
+	var n32 uint32
+	if err := binary.Read(r, binary.BigEndian, &n32); err != nil {
+		return bad(err)
+	}
+	if n32 > maxWrappedKeySize {
+		return nil, fmt.Errorf("envelope: wrapped key of %d bytes is too large", n32)
+	}
+	h.wrappedKey = make([]byte, n32)
+	if _, err := io.ReadFull(r, h.wrappedKey); err != nil {
+		return bad(err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &n32); err != nil {
+		return bad(err)
+	}
+	if n32 == 0 || n32 > maxChunkSize {
+		return nil, fmt.Errorf("envelope: bad chunk size %d", n32)
+	}
+	h.chunkSize = int(n32)
+	h.noncePrefix = make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(r, h.noncePrefix); err != nil {
+		return bad(err)
+	}
+	return h, nil
+}
+
+// chunkNonce returns the nonce of the chunk with index i.
+func chunkNonce(prefix []byte, i uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], i)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("envelope: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts plaintext with a new data key, binding it to
+// associatedData, which must be passed to Decrypt too. It calls Cloud KMS
+// once, to wrap the data key.
+func (c *Client) Encrypt(ctx context.Context, plaintext, associatedData []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := c.NewWriter(ctx, &b, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Decrypt decrypts a ciphertext written by Encrypt or NewWriter. It calls
+// Cloud KMS to unwrap the data key, unless the key is cached.
+func (c *Client) Decrypt(ctx context.Context, ciphertext, associatedData []byte) ([]byte, error) {
+	r, err := c.NewReader(ctx, bytes.NewReader(ciphertext), associatedData)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// A writer encrypts a stream in chunks.
+type writer struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	ad          []byte // the header followed by the caller's associated data
+	chunkSize   int
+	buf         []byte
+	counter     uint32
+	closed      bool
+	err         error
+}
+
+// NewWriter returns a writer that encrypts the data written to it with a
+// new data key, and writes the ciphertext to w. The data is encrypted in
+// chunks of ChunkSize bytes, so it need not fit in memory. The writer must
+// be closed to write the last chunk; closing it does not close w.
+func (c *Client) NewWriter(ctx context.Context, w io.Writer, associatedData []byte) (io.WriteCloser, error) {
+	if c.ChunkSize <= 0 || c.ChunkSize > maxChunkSize {
+		return nil, fmt.Errorf("envelope: bad chunk size %d", c.ChunkSize)
+	}
+	key, err := GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := c.WrapKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	h := &header{
+		keyName:     c.keyName,
+		wrappedKey:  wrapped,
+		chunkSize:   c.ChunkSize,
+		noncePrefix: make([]byte, noncePrefixSize),
+	}
+	if _, err := rand.Read(h.noncePrefix); err != nil {
+		return nil, fmt.Errorf("envelope: %v", err)
+	}
+	raw := h.marshal()
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	return &writer{
+		w:           w,
+		aead:        aead,
+		noncePrefix: h.noncePrefix,
+		ad:          append(raw, associatedData...),
+		chunkSize:   h.chunkSize,
+		buf:         make([]byte, 0, h.chunkSize),
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("envelope: write to closed writer")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if w.err != nil {
+			return n - len(p), w.err
+		}
+		// A full chunk is only sealed once more data comes, since the last
+		// chunk is sealed differently.
+		if len(w.buf) == w.chunkSize {
+			w.err = w.seal(false)
+			continue
+		}
+		m := w.chunkSize - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (w *writer) seal(last bool) error {
+	if !last && w.counter == math.MaxUint32 {
+		return errors.New("envelope: too many chunks")
+	}
+	ct := w.aead.Seal(nil, chunkNonce(w.noncePrefix, w.counter, last), w.buf, w.ad)
+	if _, err := w.w.Write(ct); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the last chunk.
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	return w.seal(true)
+}
+
+// A reader decrypts a stream written by a writer.
+type reader struct {
+	r           *bufio.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	ad          []byte
+	buf         []byte // ciphertext of a chunk
+	out         []byte // plaintext of a chunk
+	plain       []byte // unread part of out
+	counter     uint32
+	done        bool
+	err         error
+}
+
+// NewReader returns a reader that decrypts a ciphertext written by Encrypt
+// or NewWriter and read from r. It reads the header and unwraps the data key
+// before returning. Reads fail if the ciphertext was modified, truncated or
+// encrypted with different associated data; data returned by earlier reads
+// must then be discarded.
+func (c *Client) NewReader(ctx context.Context, r io.Reader, associatedData []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if h.keyName != c.keyName {
+		return nil, fmt.Errorf("envelope: ciphertext was encrypted with key %q, not %q", h.keyName, c.keyName)
+	}
+	key, err := c.UnwrapKey(ctx, h.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{
+		r:           br,
+		aead:        aead,
+		noncePrefix: h.noncePrefix,
+		ad:          append(h.marshal(), associatedData...),
+		buf:         make([]byte, h.chunkSize+tagSize),
+	}, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk.
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.r, r.buf)
+	last := false
+	switch err {
+	case nil:
+		// The chunk is the last one if nothing follows it.
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return errCorrupted
+	default:
+		return err
+	}
+	if n < tagSize || !last && r.counter == math.MaxUint32 {
+		return errCorrupted
+	}
+	out, err := r.aead.Open(r.out[:0], chunkNonce(r.noncePrefix, r.counter, last), r.buf[:n], r.ad)
+	if err != nil {
+		return errCorrupted
+	}
+	r.out = out
+	r.plain = out
+	r.counter++
+	r.done = last
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/internal/testserver"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	c.ChunkSize = 16
+	ctx := context.Background()
+	ad := []byte("context")
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 33, 1000} {
+		pt := make([]byte, size)
+		rand.Read(pt)
+		ct, err := c.Encrypt(ctx, pt, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Decrypt(ctx, ct, ad)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, pt) {
+			t.Errorf("size %d: got %x, want %x", size, got, pt)
+		}
+		if _, err := c.Decrypt(ctx, ct, []byte("other")); err != errCorrupted {
+			t.Errorf("size %d, wrong associated data: got %v, want errCorrupted", size, err)
+		}
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	c.ChunkSize = 100
+	ctx := context.Background()
+	pt := make([]byte, 12345)
+	rand.Read(pt)
+
+	var ct bytes.Buffer
+	w, err := c.NewWriter(ctx, &ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in pieces that do not line up with chunks.
+	for p := pt; len(p) > 0; {
+		n := 7
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.NewReader(ctx, bytes.NewReader(ct.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pt) {
+		t.Error("streamed plaintext mismatch")
+	}
+	// Decrypt reads what NewWriter wrote.
+	got, err = c.Decrypt(ctx, ct.Bytes(), nil)
+	if err != nil || !bytes.Equal(got, pt) {
+		t.Errorf("Decrypt: got %d bytes, %v", len(got), err)
+	}
+	if encrypts, _ := f.counts(); encrypts != 1 {
+		t.Errorf("got %d Encrypt calls, want 1", encrypts)
+	}
+}
+
+func TestTampering(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	c.ChunkSize = 10
+	ctx := context.Background()
+	pt := bytes.Repeat([]byte("0123456789"), 3)
+	ct, err := c.Encrypt(ctx, pt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerSize := len(ct) - 3*(10+tagSize) - tagSize
+	chunk := func(i int) []byte {
+		start := headerSize + i*(10+tagSize)
+		return ct[start : start+10+tagSize]
+	}
+	cat := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	header := ct[:headerSize]
+
+	for _, test := range []struct {
+		name string
+		ct   []byte
+	}{
+		{"empty", nil},
+		{"bad magic", cat([]byte("X"), ct[1:])},
+		{"header only", header},
+		{"truncated header", header[:headerSize-1]},
+		{"dropped last chunk", ct[:len(ct)-tagSize]},
+		{"truncated chunk", ct[:len(ct)-1]},
+		{"reordered chunks", cat(header, chunk(1), chunk(0), chunk(2), ct[len(ct)-tagSize:])},
+		{"flipped bit", cat(ct[:len(ct)-20], []byte{ct[len(ct)-20] ^ 1}, ct[len(ct)-19:])},
+		{"changed chunk size", cat(header[:headerSize-noncePrefixSize-1], []byte{11}, header[headerSize-noncePrefixSize:], ct[headerSize:])},
+		{"appended data", cat(ct, []byte{0})},
+	} {
+		got, err := c.Decrypt(ctx, test.ct, nil)
+		if err == nil {
+			t.Errorf("%s: got %q, want error", test.name, got)
+		}
+	}
+}
+
+func TestWrongKeyName(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	ctx := context.Background()
+	ct, err := c.Encrypt(ctx, []byte("x"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewClient(c.svc, testKey+"2")
+	if _, err := other.Decrypt(ctx, ct, nil); err == nil {
+		t.Error("got nil, want error")
+	}
+}
+
+func TestReaderReadError(t *testing.T) {
+	f := newFakeKMS()
+	svc, done := testserver.NewService(t, f, cloudkms.NewService)
+	defer done()
+	c := NewClient(svc.(*cloudkms.Service), testKey)
+	ctx := context.Background()
+	ct, err := c.Encrypt(ctx, []byte("hello"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewReader(ctx, io.MultiReader(bytes.NewReader(ct[:len(ct)-5]), errReader{}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != io.ErrClosedPipe {
+		t.Errorf("got %v, want io.ErrClosedPipe", err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, io.ErrClosedPipe }
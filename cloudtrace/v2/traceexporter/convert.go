@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceexporter
+
+import (
+	"go.opencensus.io/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/cloudtrace/v2/traceexporter/internal/spanconv"
+)
+
+// spanKinds maps OpenCensus span kinds to Cloud Trace span kinds.
+var spanKinds = map[int]string{
+	trace.SpanKindServer: "SERVER",
+	trace.SpanKindClient: "CLIENT",
+}
+
+// convertSpan converts an OpenCensus span of project, as in
+// "projects/my-project", to a Cloud Trace span.
+func convertSpan(project string, sd *trace.SpanData) *cloudtrace.Span {
+	s := &cloudtrace.Span{
+		Name:           spanconv.SpanName(project, sd.TraceID.String(), sd.SpanID.String()),
+		SpanId:         sd.SpanID.String(),
+		DisplayName:    spanconv.Truncate(sd.Name, spanconv.MaxDisplayNameBytes),
+		StartTime:      spanconv.FormatTime(sd.StartTime),
+		EndTime:        spanconv.FormatTime(sd.EndTime),
+		ChildSpanCount: int64(sd.ChildSpanCount),
+		SpanKind:       spanKinds[sd.SpanKind],
+	}
+	if sd.ParentSpanID != (trace.SpanID{}) {
+		s.ParentSpanId = sd.ParentSpanID.String()
+		s.SameProcessAsParentSpan = !sd.HasRemoteParent
+		s.ForceSendFields = append(s.ForceSendFields, "SameProcessAsParentSpan")
+	}
+	if sd.Code != 0 || sd.Message != "" {
+		s.Status = &cloudtrace.Status{Code: int64(sd.Code), Message: sd.Message}
+	}
+
+	attrs := sd.Attributes
+	if st, ok := attrs[StackTraceAttribute].(string); ok {
+		s.StackTrace = spanconv.ParseStackTrace(st)
+		attrs = make(map[string]interface{}, len(sd.Attributes))
+		for k, v := range sd.Attributes {
+			if k != StackTraceAttribute {
+				attrs[k] = v
+			}
+		}
+	}
+	s.Attributes = spanconv.Attributes(attrs, sd.DroppedAttributeCount)
+
+	te := &cloudtrace.TimeEvents{
+		DroppedAnnotationsCount:   int64(sd.DroppedAnnotationCount),
+		DroppedMessageEventsCount: int64(sd.DroppedMessageEventCount),
+	}
+	for i, a := range sd.Annotations {
+		if i == spanconv.MaxAnnotations {
+			te.DroppedAnnotationsCount += int64(len(sd.Annotations) - i)
+			break
+		}
+		te.TimeEvent = append(te.TimeEvent, &cloudtrace.TimeEvent{
+			Time: spanconv.FormatTime(a.Time),
+			Annotation: &cloudtrace.Annotation{
+				Description: spanconv.Truncate(a.Message, spanconv.MaxAnnotationBytes),
+				Attributes:  spanconv.Attributes(a.Attributes, 0),
+			},
+		})
+	}
+	for i, m := range sd.MessageEvents {
+		if i == spanconv.MaxMessageEvents {
+			te.DroppedMessageEventsCount += int64(len(sd.MessageEvents) - i)
+			break
+		}
+		te.TimeEvent = append(te.TimeEvent, &cloudtrace.TimeEvent{
+			Time: spanconv.FormatTime(m.Time),
+			MessageEvent: &cloudtrace.MessageEvent{
+				Type:                  messageEventType(m.EventType),
+				Id:                    m.MessageID,
+				UncompressedSizeBytes: m.UncompressedByteSize,
+				CompressedSizeBytes:   m.CompressedByteSize,
+			},
+		})
+	}
+	if len(te.TimeEvent) > 0 || te.DroppedAnnotationsCount > 0 || te.DroppedMessageEventsCount > 0 {
+		s.TimeEvents = te
+	}
+
+	if len(sd.Links) > 0 || sd.DroppedLinkCount > 0 {
+		ls := &cloudtrace.Links{DroppedLinksCount: int64(sd.DroppedLinkCount)}
+		for i, l := range sd.Links {
+			if i == spanconv.MaxLinks {
+				ls.DroppedLinksCount += int64(len(sd.Links) - i)
+				break
+			}
+			ls.Link = append(ls.Link, &cloudtrace.Link{
+				TraceId:    l.TraceID.String(),
+				SpanId:     l.SpanID.String(),
+				Type:       linkType(l.Type),
+				Attributes: spanconv.Attributes(l.Attributes, 0),
+			})
+		}
+		s.Links = ls
+	}
+	return s
+}
+
+func messageEventType(t trace.MessageEventType) string {
+	switch t {
+	case trace.MessageEventTypeSent:
+		return "SENT"
+	case trace.MessageEventTypeRecv:
+		return "RECEIVED"
+	}
+	return "TYPE_UNSPECIFIED"
+}
+
+func linkType(t trace.LinkType) string {
+	switch t {
+	case trace.LinkTypeChild:
+		return "CHILD_LINKED_SPAN"
+	case trace.LinkTypeParent:
+		return "PARENT_LINKED_SPAN"
+	}
+	return "TYPE_UNSPECIFIED"
+}
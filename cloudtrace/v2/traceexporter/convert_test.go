@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+)
+
+var (
+	testTraceID = trace.TraceID{0x01, 0x02, 15: 0xff}
+	testSpanID  = trace.SpanID{0xaa, 7: 0x01}
+	testParent  = trace.SpanID{0xbb, 7: 0x02}
+	testStart   = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+)
+
+const testTraceHex = "010200000000000000000000000000ff"
+
+func TestConvertSpan(t *testing.T) {
+	sd := &trace.SpanData{
+		SpanContext:  trace.SpanContext{TraceID: testTraceID, SpanID: testSpanID},
+		ParentSpanID: testParent,
+		SpanKind:     trace.SpanKindClient,
+		Name:         "/api/get",
+		StartTime:    testStart,
+		EndTime:      testStart.Add(1500 * time.Millisecond),
+		Attributes: map[string]interface{}{
+			"ok":   true,
+			"size": int64(0),
+			"path": "/x",
+		},
+		Annotations: []trace.Annotation{{
+			Time:       testStart.Add(time.Millisecond),
+			Message:    "retrying",
+			Attributes: map[string]interface{}{"attempt": int64(2)},
+		}},
+		MessageEvents: []trace.MessageEvent{{
+			Time:                 testStart.Add(2 * time.Millisecond),
+			EventType:            trace.MessageEventTypeSent,
+			MessageID:            1,
+			UncompressedByteSize: 100,
+		}},
+		Status: trace.Status{Code: 5, Message: "not found"},
+		Links: []trace.Link{{
+			TraceID: testTraceID,
+			SpanID:  testParent,
+			Type:    trace.LinkTypeParent,
+		}},
+		HasRemoteParent:        true,
+		DroppedAnnotationCount: 1,
+		ChildSpanCount:         3,
+	}
+	got := convertSpan("projects/p", sd)
+	want := &cloudtrace.Span{
+		Name:                    "projects/p/traces/" + testTraceHex + "/spans/aa00000000000001",
+		SpanId:                  "aa00000000000001",
+		ParentSpanId:            "bb00000000000002",
+		SameProcessAsParentSpan: false,
+		ForceSendFields:         []string{"SameProcessAsParentSpan"},
+		DisplayName:             &cloudtrace.TruncatableString{Value: "/api/get"},
+		StartTime:               "2020-01-02T03:04:05Z",
+		EndTime:                 "2020-01-02T03:04:06.5Z",
+		SpanKind:                "CLIENT",
+		ChildSpanCount:          3,
+		Status:                  &cloudtrace.Status{Code: 5, Message: "not found"},
+		Attributes: &cloudtrace.Attributes{AttributeMap: map[string]cloudtrace.AttributeValue{
+			"ok":   {BoolValue: true, ForceSendFields: []string{"BoolValue"}},
+			"size": {IntValue: 0, ForceSendFields: []string{"IntValue"}},
+			"path": {StringValue: &cloudtrace.TruncatableString{Value: "/x"}},
+		}},
+		TimeEvents: &cloudtrace.TimeEvents{
+			DroppedAnnotationsCount: 1,
+			TimeEvent: []*cloudtrace.TimeEvent{
+				{
+					Time: "2020-01-02T03:04:05.001Z",
+					Annotation: &cloudtrace.Annotation{
+						Description: &cloudtrace.TruncatableString{Value: "retrying"},
+						Attributes: &cloudtrace.Attributes{AttributeMap: map[string]cloudtrace.AttributeValue{
+							"attempt": {IntValue: 2, ForceSendFields: []string{"IntValue"}},
+						}},
+					},
+				},
+				{
+					Time:         "2020-01-02T03:04:05.002Z",
+					MessageEvent: &cloudtrace.MessageEvent{Type: "SENT", Id: 1, UncompressedSizeBytes: 100},
+				},
+			},
+		},
+		Links: &cloudtrace.Links{Link: []*cloudtrace.Link{{
+			TraceId: testTraceHex,
+			SpanId:  "bb00000000000002",
+			Type:    "PARENT_LINKED_SPAN",
+		}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Zero values of attributes are sent.
+	b, err := json.Marshal(got.Attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"size":{"intValue":"0"}`) {
+		t.Errorf("zero attribute not sent: %s", b)
+	}
+}
+
+func TestConvertLimits(t *testing.T) {
+	sd := &trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: testTraceID, SpanID: testSpanID},
+		Name:        strings.Repeat("n", 200),
+		Attributes:  map[string]interface{}{},
+	}
+	for i := 0; i < 40; i++ {
+		sd.Attributes[fmt.Sprintf("k%02d", i)] = strings.Repeat("é", 200)
+	}
+	sd.Attributes[strings.Repeat("k", 200)] = "long key"
+	for i := 0; i < 35; i++ {
+		sd.Annotations = append(sd.Annotations, trace.Annotation{Message: "a"})
+	}
+	for i := 0; i < 130; i++ {
+		sd.Links = append(sd.Links, trace.Link{})
+	}
+	s := convertSpan("projects/p", sd)
+
+	if got := s.DisplayName; len(got.Value) != 128 || got.TruncatedByteCount != 72 {
+		t.Errorf("display name: got %d bytes, %d truncated", len(got.Value), got.TruncatedByteCount)
+	}
+	if n, d := len(s.Attributes.AttributeMap), s.Attributes.DroppedAttributesCount; n != 32 || d != 9 {
+		t.Errorf("got %d attributes, %d dropped; want 32, 9", n, d)
+	}
+	v := s.Attributes.AttributeMap["k00"].StringValue
+	if len(v.Value) != 256 || v.TruncatedByteCount != 144 {
+		t.Errorf("attribute value: got %d bytes, %d truncated; want 256, 144", len(v.Value), v.TruncatedByteCount)
+	}
+	if n, d := len(s.TimeEvents.TimeEvent), s.TimeEvents.DroppedAnnotationsCount; n != 32 || d != 3 {
+		t.Errorf("got %d annotations, %d dropped; want 32, 3", n, d)
+	}
+	if n, d := len(s.Links.Link), s.Links.DroppedLinksCount; n != 128 || d != 2 {
+		t.Errorf("got %d links, %d dropped; want 128, 2", n, d)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package traceexporter exports OpenCensus spans to Cloud Trace with the
+// REST API (google.golang.org/api/cloudtrace/v2).
+//
+// An Exporter converts spans, with their attributes, annotations, message
+// events, links and status, to Cloud Trace spans, applying the limits of
+// Cloud Trace, and writes them in batches:
+//
+//	e := traceexporter.NewExporter(svc, "projects/my-project")
+//	trace.RegisterExporter(e)
+//	defer e.Flush()
+//
+// Strings longer than the limits are truncated, and attributes, annotations,
+// message events and links beyond them are dropped and counted. OpenCensus
+// spans carry no stack traces; AddStackTrace stores one in an attribute,
+// which the Exporter turns into the stack trace of the Cloud Trace span.
+//
+// The exporter for OpenTelemetry is in package
+// google.golang.org/api/cloudtrace/v2/traceexporter/otelexporter.
+//
+// This package is experimental and subject to change without notice.
+package traceexporter
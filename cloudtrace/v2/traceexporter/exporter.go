@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceexporter
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/support/bundler"
+)
+
+const (
+	// DefaultBundleDelayThreshold is the default time spans wait for more
+	// spans to be batched with.
+	DefaultBundleDelayThreshold = 2 * time.Second
+
+	// DefaultBundleCountThreshold is the default number of spans sent in
+	// one BatchWriteSpans request.
+	DefaultBundleCountThreshold = 50
+
+	// DefaultBufferedByteLimit is the default size of the spans that may
+	// wait to be written. Spans exported beyond it are dropped.
+	DefaultBufferedByteLimit = 8 << 20
+
+	// DefaultTimeout is the default timeout of BatchWriteSpans requests.
+	DefaultTimeout = 5 * time.Second
+)
+
+// An Exporter is an OpenCensus trace exporter that writes spans to Cloud
+// Trace with Projects.Traces.BatchWrite. Register it with
+// trace.RegisterExporter.
+//
+// The exported fields are only safe to modify prior to the first call to
+// ExportSpan.
+type Exporter struct {
+	// Starting from the time that the first span is added to a batch, once
+	// this delay has passed, write the batch. The default is
+	// DefaultBundleDelayThreshold.
+	BundleDelayThreshold time.Duration
+
+	// Once a batch has this many spans, write it. The default is
+	// DefaultBundleCountThreshold.
+	BundleCountThreshold int
+
+	// The maximum size of the spans waiting to be written. Spans exported
+	// when it is reached are dropped, with an error. The default is
+	// DefaultBufferedByteLimit.
+	BufferedByteLimit int
+
+	// Timeout is the timeout of BatchWriteSpans requests. The default is
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// OnError, if non-nil, is called with the errors of writing spans. It
+	// must not block.
+	OnError func(err error)
+
+	svc     *cloudtrace.Service
+	project string
+
+	initOnce sync.Once
+	bundler  *bundler.Bundler
+}
+
+// NewExporter returns an Exporter writing spans to the traces of project,
+// as in "projects/my-project".
+func NewExporter(svc *cloudtrace.Service, project string) *Exporter {
+	return &Exporter{
+		BundleDelayThreshold: DefaultBundleDelayThreshold,
+		BundleCountThreshold: DefaultBundleCountThreshold,
+		BufferedByteLimit:    DefaultBufferedByteLimit,
+		Timeout:              DefaultTimeout,
+		svc:                  svc,
+		project:              project,
+	}
+}
+
+func (e *Exporter) init() {
+	e.initOnce.Do(func() {
+		b := bundler.NewBundler((*cloudtrace.Span)(nil), func(items interface{}) {
+			e.write(items.([]*cloudtrace.Span))
+		})
+		b.DelayThreshold = e.BundleDelayThreshold
+		b.BundleCountThreshold = e.BundleCountThreshold
+		b.BufferedByteLimit = e.BufferedByteLimit
+		e.bundler = b
+	})
+}
+
+// ExportSpan converts sd to a Cloud Trace span and adds it to a batch to be
+// written in the background. It implements trace.Exporter.
+func (e *Exporter) ExportSpan(sd *trace.SpanData) {
+	e.init()
+	s := convertSpan(e.project, sd)
+	b, err := json.Marshal(s)
+	if err == nil {
+		err = e.bundler.Add(s, len(b))
+	}
+	if err != nil {
+		e.fail(err)
+	}
+}
+
+// Flush waits until all spans exported so far have been written or
+// failed. Call it before the program exits.
+func (e *Exporter) Flush() {
+	e.init()
+	e.bundler.Flush()
+}
+
+func (e *Exporter) write(spans []*cloudtrace.Span) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+	req := &cloudtrace.BatchWriteSpansRequest{Spans: spans}
+	if _, err := e.svc.Projects.Traces.BatchWrite(e.project, req).Context(ctx).Do(); err != nil {
+		e.fail(err)
+	}
+}
+
+func (e *Exporter) fail(err error) {
+	if e.OnError != nil {
+		e.OnError(err)
+	}
+}
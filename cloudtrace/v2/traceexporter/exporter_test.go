@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceexporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeTrace serves BatchWriteSpans for project "p", recording the
+// requests.
+type fakeTrace struct {
+	mu     sync.Mutex
+	writes [][]*cloudtrace.Span
+	status int
+}
+
+func (f *fakeTrace) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v2/projects/p/traces:batchWrite" {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req cloudtrace.BatchWriteSpansRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes = append(f.writes, req.Spans)
+	if f.status != 0 {
+		http.Error(w, http.StatusText(f.status), f.status)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func testSpanData(i int) *trace.SpanData {
+	return &trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: testTraceID, SpanID: trace.SpanID{7: byte(i)}},
+		Name:        "span",
+		StartTime:   testStart,
+		EndTime:     testStart.Add(time.Second),
+	}
+}
+
+func TestExporterBatches(t *testing.T) {
+	f := &fakeTrace{}
+	svc, done := testserver.NewService(t, f, cloudtrace.NewService)
+	defer done()
+	e := NewExporter(svc.(*cloudtrace.Service), "projects/p")
+	e.BundleCountThreshold = 2
+	var _ trace.Exporter = e
+	for i := 1; i <= 5; i++ {
+		e.ExportSpan(testSpanData(i))
+	}
+	e.Flush()
+	total := 0
+	for _, spans := range f.writes {
+		if len(spans) > 2 {
+			t.Errorf("got batch of %d spans, want at most 2", len(spans))
+		}
+		total += len(spans)
+	}
+	if total != 5 {
+		t.Errorf("got %d spans, want 5", total)
+	}
+	if got, want := f.writes[0][0].Name, "projects/p/traces/"+testTraceHex+"/spans/0000000000000001"; got != want {
+		t.Errorf("got name %q, want %q", got, want)
+	}
+}
+
+func TestExporterErrors(t *testing.T) {
+	f := &fakeTrace{status: http.StatusForbidden}
+	svc, done := testserver.NewService(t, f, cloudtrace.NewService)
+	defer done()
+	e := NewExporter(svc.(*cloudtrace.Service), "projects/p")
+	var mu sync.Mutex
+	var errs []error
+	e.OnError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+	e.ExportSpan(testSpanData(1))
+	e.Flush()
+	if len(errs) != 1 {
+		t.Errorf("got %d errors, want 1", len(errs))
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package spanconv holds the parts of the conversion of spans to Cloud
+// Trace spans that do not depend on the tracing library, shared by the
+// OpenCensus and OpenTelemetry exporters.
+package spanconv
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+)
+
+// Limits of Cloud Trace. Longer strings are truncated, and items beyond the
+// count limits are dropped and counted.
+const (
+	MaxDisplayNameBytes    = 128
+	MaxAttributes          = 32
+	MaxAttributeKeyBytes   = 128
+	MaxAttributeValueBytes = 256
+	MaxAnnotations         = 32
+	MaxAnnotationBytes     = 256
+	MaxMessageEvents       = 128
+	MaxLinks               = 128
+	MaxStackFrames         = 128
+	MaxFunctionNameBytes   = 1024
+	MaxFileNameBytes       = 256
+)
+
+// SpanName returns the resource name of a span of project, as in
+// "projects/my-project", given its trace and span IDs in hex.
+func SpanName(project, traceID, spanID string) string {
+	return fmt.Sprintf("%s/traces/%s/spans/%s", project, traceID, spanID)
+}
+
+// Attributes converts attributes, keeping at most MaxAttributes of them in
+// order of their keys. dropped is the number of attributes the tracing
+// library already dropped. Values other than bools, int64s and strings are
+// converted to strings.
+func Attributes(attrs map[string]interface{}, dropped int) *cloudtrace.Attributes {
+	if len(attrs) == 0 && dropped == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	a := &cloudtrace.Attributes{
+		AttributeMap:           map[string]cloudtrace.AttributeValue{},
+		DroppedAttributesCount: int64(dropped),
+	}
+	for _, k := range keys {
+		if len(a.AttributeMap) == MaxAttributes || len(k) > MaxAttributeKeyBytes {
+			a.DroppedAttributesCount++
+			continue
+		}
+		var v cloudtrace.AttributeValue
+		switch x := attrs[k].(type) {
+		case bool:
+			v = cloudtrace.AttributeValue{BoolValue: x, ForceSendFields: []string{"BoolValue"}}
+		case int64:
+			v = cloudtrace.AttributeValue{IntValue: x, ForceSendFields: []string{"IntValue"}}
+		case string:
+			v = cloudtrace.AttributeValue{StringValue: Truncate(x, MaxAttributeValueBytes)}
+		case float64:
+			v = cloudtrace.AttributeValue{StringValue: Truncate(strconv.FormatFloat(x, 'g', -1, 64), MaxAttributeValueBytes)}
+		default:
+			v = cloudtrace.AttributeValue{StringValue: Truncate(fmt.Sprint(x), MaxAttributeValueBytes)}
+		}
+		a.AttributeMap[k] = v
+	}
+	return a
+}
+
+// Truncate returns s as a TruncatableString of at most n bytes, cut at a
+// rune boundary.
+func Truncate(s string, n int) *cloudtrace.TruncatableString {
+	if len(s) <= n {
+		return &cloudtrace.TruncatableString{Value: s}
+	}
+	i := n
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return &cloudtrace.TruncatableString{Value: s[:i], TruncatedByteCount: int64(len(s) - i)}
+}
+
+// FormatTime formats t as a timestamp of the API.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
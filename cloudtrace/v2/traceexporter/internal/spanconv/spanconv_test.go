@@ -0,0 +1,54 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spanconv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"abc", 3, "abc"},
+		{"abcd", 3, "abc"},
+		{"aé", 2, "a"},
+		{"日本", 4, "日"},
+	} {
+		got := Truncate(test.in, test.n)
+		if got.Value != test.want || got.TruncatedByteCount != int64(len(test.in)-len(test.want)) {
+			t.Errorf("Truncate(%q, %d) = %+v, want %q", test.in, test.n, got, test.want)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	attrs := map[string]interface{}{
+		"b":                      true,
+		"f":                      1.5,
+		"i":                      int64(0),
+		"s":                      "x",
+		"z":                      []string{"a", "b"},
+		strings.Repeat("k", 200): "long key",
+	}
+	a := Attributes(attrs, 2)
+	if a.DroppedAttributesCount != 3 {
+		t.Errorf("got %d dropped, want 3", a.DroppedAttributesCount)
+	}
+	m := a.AttributeMap
+	if !m["b"].BoolValue || m["f"].StringValue.Value != "1.5" || m["s"].StringValue.Value != "x" || m["z"].StringValue.Value != "[a b]" {
+		t.Errorf("bad attributes %+v", m)
+	}
+	// Zero values are sent.
+	if v := m["i"]; v.IntValue != 0 || len(v.ForceSendFields) != 1 {
+		t.Errorf("got %+v, want forced zero int", v)
+	}
+	if Attributes(nil, 0) != nil {
+		t.Error("no attributes: got non-nil")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spanconv
+
+import (
+	"strconv"
+	"strings"
+
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+)
+
+// ParseStackTrace parses a stack trace of lines with a function name
+// followed by lines with a tab, file name and line number, as written by
+// runtime/debug.Stack. It returns nil if s has no frames.
+func ParseStackTrace(s string) *cloudtrace.StackTrace {
+	frames := &cloudtrace.StackFrames{}
+	var f *cloudtrace.StackFrame
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			if f == nil {
+				continue
+			}
+			loc := strings.TrimPrefix(line, "\t")
+			if i := strings.LastIndex(loc, " +0x"); i >= 0 {
+				loc = loc[:i]
+			}
+			if i := strings.LastIndexByte(loc, ':'); i >= 0 {
+				if n, err := strconv.ParseInt(loc[i+1:], 10, 64); err == nil {
+					f.LineNumber = n
+					loc = loc[:i]
+				}
+			}
+			f.FileName = Truncate(loc, MaxFileNameBytes)
+			f = nil
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		if len(frames.Frame) == MaxStackFrames {
+			frames.DroppedFramesCount++
+			continue
+		}
+		// debug.Stack writes the arguments after the function name.
+		if strings.HasSuffix(line, ")") {
+			if i := strings.LastIndexByte(line, '('); i > 0 {
+				line = line[:i]
+			}
+		}
+		f = &cloudtrace.StackFrame{FunctionName: Truncate(line, MaxFunctionNameBytes)}
+		frames.Frame = append(frames.Frame, f)
+	}
+	if len(frames.Frame) == 0 {
+		return nil
+	}
+	return &cloudtrace.StackTrace{StackFrames: frames}
+}
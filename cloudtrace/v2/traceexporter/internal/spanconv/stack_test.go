@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package spanconv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+)
+
+func TestParseStackTrace(t *testing.T) {
+	const stack = `goroutine 1 [running]:
+main.handle(0xc000010000, 0x3)
+	/src/main.go:12 +0x25
+main.main()
+	/src/main.go:5 +0x1f
+`
+	got := ParseStackTrace(stack)
+	want := &cloudtrace.StackTrace{StackFrames: &cloudtrace.StackFrames{Frame: []*cloudtrace.StackFrame{
+		{
+			FunctionName: &cloudtrace.TruncatableString{Value: "main.handle"},
+			FileName:     &cloudtrace.TruncatableString{Value: "/src/main.go"},
+			LineNumber:   12,
+		},
+		{
+			FunctionName: &cloudtrace.TruncatableString{Value: "main.main"},
+			FileName:     &cloudtrace.TruncatableString{Value: "/src/main.go"},
+			LineNumber:   5,
+		},
+	}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got := ParseStackTrace("garbage\n"); got == nil || len(got.StackFrames.Frame) != 1 || got.StackFrames.Frame[0].FileName != nil {
+		t.Errorf("garbage: got %+v, want one frame without file", got)
+	}
+	if got := ParseStackTrace(""); got != nil {
+		t.Errorf("empty: got %+v, want nil", got)
+	}
+}
+
+func TestStackTraceLimit(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < MaxStackFrames+5; i++ {
+		b.WriteString("f\n\tf.go:1\n")
+	}
+	st := ParseStackTrace(b.String())
+	if n, d := len(st.StackFrames.Frame), st.StackFrames.DroppedFramesCount; n != MaxStackFrames || d != 5 {
+		t.Errorf("got %d frames, %d dropped; want %d, 5", n, d, MaxStackFrames)
+	}
+}
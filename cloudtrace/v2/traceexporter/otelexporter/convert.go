@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelexporter
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/cloudtrace/v2/traceexporter/internal/spanconv"
+)
+
+// Attributes of exception events, as in the semantic conventions of
+// OpenTelemetry.
+const (
+	exceptionEvent      = "exception"
+	exceptionStackTrace = "exception.stacktrace"
+)
+
+// spanKinds maps OpenTelemetry span kinds to Cloud Trace span kinds.
+var spanKinds = map[trace.SpanKind]string{
+	trace.SpanKindInternal: "INTERNAL",
+	trace.SpanKindServer:   "SERVER",
+	trace.SpanKindClient:   "CLIENT",
+	trace.SpanKindProducer: "PRODUCER",
+	trace.SpanKindConsumer: "CONSUMER",
+}
+
+// unknownCode is the google.rpc.Code of spans with an error status.
+const unknownCode = 2
+
+// convertSpan converts an OpenTelemetry span of project, as in
+// "projects/my-project", to a Cloud Trace span.
+func convertSpan(project string, ro sdktrace.ReadOnlySpan) *cloudtrace.Span {
+	sc := ro.SpanContext()
+	s := &cloudtrace.Span{
+		Name:           spanconv.SpanName(project, sc.TraceID().String(), sc.SpanID().String()),
+		SpanId:         sc.SpanID().String(),
+		DisplayName:    spanconv.Truncate(ro.Name(), spanconv.MaxDisplayNameBytes),
+		StartTime:      spanconv.FormatTime(ro.StartTime()),
+		EndTime:        spanconv.FormatTime(ro.EndTime()),
+		ChildSpanCount: int64(ro.ChildSpanCount()),
+		SpanKind:       spanKinds[ro.SpanKind()],
+		Attributes:     spanconv.Attributes(attributes(ro.Attributes()), ro.DroppedAttributes()),
+	}
+	if p := ro.Parent(); p.SpanID().IsValid() {
+		s.ParentSpanId = p.SpanID().String()
+		s.SameProcessAsParentSpan = !p.IsRemote()
+		s.ForceSendFields = append(s.ForceSendFields, "SameProcessAsParentSpan")
+	}
+	if st := ro.Status(); st.Code == codes.Error {
+		s.Status = &cloudtrace.Status{Code: unknownCode, Message: st.Description}
+	}
+
+	te := &cloudtrace.TimeEvents{DroppedAnnotationsCount: int64(ro.DroppedEvents())}
+	events := ro.Events()
+	for i, ev := range events {
+		attrs := ev.Attributes
+		if ev.Name == exceptionEvent {
+			attrs = nil
+			for _, kv := range ev.Attributes {
+				if kv.Key != exceptionStackTrace {
+					attrs = append(attrs, kv)
+				} else if s.StackTrace == nil {
+					s.StackTrace = spanconv.ParseStackTrace(kv.Value.AsString())
+				}
+			}
+		}
+		if i >= spanconv.MaxAnnotations {
+			te.DroppedAnnotationsCount++
+			continue
+		}
+		te.TimeEvent = append(te.TimeEvent, &cloudtrace.TimeEvent{
+			Time: spanconv.FormatTime(ev.Time),
+			Annotation: &cloudtrace.Annotation{
+				Description: spanconv.Truncate(ev.Name, spanconv.MaxAnnotationBytes),
+				Attributes:  spanconv.Attributes(attributes(attrs), ev.DroppedAttributeCount),
+			},
+		})
+	}
+	if len(te.TimeEvent) > 0 || te.DroppedAnnotationsCount > 0 {
+		s.TimeEvents = te
+	}
+
+	links := ro.Links()
+	if len(links) > 0 || ro.DroppedLinks() > 0 {
+		ls := &cloudtrace.Links{DroppedLinksCount: int64(ro.DroppedLinks())}
+		for i, l := range links {
+			if i == spanconv.MaxLinks {
+				ls.DroppedLinksCount += int64(len(links) - i)
+				break
+			}
+			ls.Link = append(ls.Link, &cloudtrace.Link{
+				TraceId:    l.SpanContext.TraceID().String(),
+				SpanId:     l.SpanContext.SpanID().String(),
+				Type:       "TYPE_UNSPECIFIED",
+				Attributes: spanconv.Attributes(attributes(l.Attributes), l.DroppedAttributeCount),
+			})
+		}
+		s.Links = ls
+	}
+	return s
+}
+
+// attributes returns OpenTelemetry attributes as a map of bools, int64s,
+// float64s and strings. Slices are formatted as strings.
+func attributes(kvs []attribute.KeyValue) map[string]interface{} {
+	if len(kvs) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			m[string(kv.Key)] = kv.Value.AsBool()
+		case attribute.INT64:
+			m[string(kv.Key)] = kv.Value.AsInt64()
+		case attribute.FLOAT64:
+			m[string(kv.Key)] = kv.Value.AsFloat64()
+		default:
+			m[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+	return m
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelexporter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+)
+
+var (
+	testTraceID = trace.TraceID{0x01, 0x02, 15: 0xff}
+	testSpanID  = trace.SpanID{0xaa, 7: 0x01}
+	testParent  = trace.SpanID{0xbb, 7: 0x02}
+	testStart   = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+)
+
+const testTraceHex = "010200000000000000000000000000ff"
+
+func testSpanContext(id trace.SpanID, remote bool) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    testTraceID,
+		SpanID:     id,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     remote,
+	})
+}
+
+func TestConvertSpan(t *testing.T) {
+	stub := tracetest.SpanStub{
+		Name:        "/api/get",
+		SpanContext: testSpanContext(testSpanID, false),
+		Parent:      testSpanContext(testParent, true),
+		SpanKind:    trace.SpanKindClient,
+		StartTime:   testStart,
+		EndTime:     testStart.Add(1500 * time.Millisecond),
+		Attributes: []attribute.KeyValue{
+			attribute.Bool("ok", true),
+			attribute.Int64("size", 0),
+			attribute.String("path", "/x"),
+			attribute.StringSlice("tags", []string{"a", "b"}),
+		},
+		Events: []sdktrace.Event{{
+			Name:       "retrying",
+			Time:       testStart.Add(time.Millisecond),
+			Attributes: []attribute.KeyValue{attribute.Int64("attempt", 2)},
+		}},
+		Links: []sdktrace.Link{{
+			SpanContext: testSpanContext(testParent, true),
+			Attributes:  []attribute.KeyValue{attribute.String("why", "retry")},
+		}},
+		Status:            sdktrace.Status{Code: codes.Error, Description: "not found"},
+		DroppedAttributes: 1,
+		DroppedEvents:     2,
+		ChildSpanCount:    3,
+	}
+	got := convertSpan("projects/p", stub.Snapshot())
+	want := &cloudtrace.Span{
+		Name:                    "projects/p/traces/" + testTraceHex + "/spans/aa00000000000001",
+		SpanId:                  "aa00000000000001",
+		ParentSpanId:            "bb00000000000002",
+		SameProcessAsParentSpan: false,
+		ForceSendFields:         []string{"SameProcessAsParentSpan"},
+		DisplayName:             &cloudtrace.TruncatableString{Value: "/api/get"},
+		StartTime:               "2020-01-02T03:04:05Z",
+		EndTime:                 "2020-01-02T03:04:06.5Z",
+		SpanKind:                "CLIENT",
+		ChildSpanCount:          3,
+		Status:                  &cloudtrace.Status{Code: 2, Message: "not found"},
+		Attributes: &cloudtrace.Attributes{
+			AttributeMap: map[string]cloudtrace.AttributeValue{
+				"ok":   {BoolValue: true, ForceSendFields: []string{"BoolValue"}},
+				"size": {IntValue: 0, ForceSendFields: []string{"IntValue"}},
+				"path": {StringValue: &cloudtrace.TruncatableString{Value: "/x"}},
+				"tags": {StringValue: &cloudtrace.TruncatableString{Value: "[a b]"}},
+			},
+			DroppedAttributesCount: 1,
+		},
+		TimeEvents: &cloudtrace.TimeEvents{
+			TimeEvent: []*cloudtrace.TimeEvent{{
+				Time: "2020-01-02T03:04:05.001Z",
+				Annotation: &cloudtrace.Annotation{
+					Description: &cloudtrace.TruncatableString{Value: "retrying"},
+					Attributes: &cloudtrace.Attributes{AttributeMap: map[string]cloudtrace.AttributeValue{
+						"attempt": {IntValue: 2, ForceSendFields: []string{"IntValue"}},
+					}},
+				},
+			}},
+			DroppedAnnotationsCount: 2,
+		},
+		Links: &cloudtrace.Links{Link: []*cloudtrace.Link{{
+			TraceId: testTraceHex,
+			SpanId:  "bb00000000000002",
+			Type:    "TYPE_UNSPECIFIED",
+			Attributes: &cloudtrace.Attributes{AttributeMap: map[string]cloudtrace.AttributeValue{
+				"why": {StringValue: &cloudtrace.TruncatableString{Value: "retry"}},
+			}},
+		}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestConvertSpanRoot(t *testing.T) {
+	stub := tracetest.SpanStub{
+		Name:        "root",
+		SpanContext: testSpanContext(testSpanID, false),
+		SpanKind:    trace.SpanKindServer,
+		StartTime:   testStart,
+		EndTime:     testStart,
+		Status:      sdktrace.Status{Code: codes.Ok},
+	}
+	got := convertSpan("projects/p", stub.Snapshot())
+	if got.ParentSpanId != "" || len(got.ForceSendFields) != 0 {
+		t.Errorf("got parent %q, ForceSendFields %v; want none", got.ParentSpanId, got.ForceSendFields)
+	}
+	if got.SpanKind != "SERVER" {
+		t.Errorf("got SpanKind %q, want SERVER", got.SpanKind)
+	}
+	if got.Status != nil || got.Attributes != nil || got.TimeEvents != nil || got.Links != nil {
+		t.Errorf("got %+v, want no status, attributes, time events or links", got)
+	}
+}
+
+func TestConvertSpanLocalParent(t *testing.T) {
+	stub := tracetest.SpanStub{
+		SpanContext: testSpanContext(testSpanID, false),
+		Parent:      testSpanContext(testParent, false),
+	}
+	got := convertSpan("projects/p", stub.Snapshot())
+	if !got.SameProcessAsParentSpan {
+		t.Error("got SameProcessAsParentSpan false, want true")
+	}
+}
+
+func TestConvertSpanException(t *testing.T) {
+	stack := "goroutine 1 [running]:\nmain.f(0x1)\n\t/src/main.go:10 +0x20\nmain.main()\n\t/src/main.go:5 +0x10\n"
+	stub := tracetest.SpanStub{
+		SpanContext: testSpanContext(testSpanID, false),
+		Events: []sdktrace.Event{{
+			Name: "exception",
+			Time: testStart,
+			Attributes: []attribute.KeyValue{
+				attribute.String("exception.type", "*errors.errorString"),
+				attribute.String("exception.message", "boom"),
+				attribute.String("exception.stacktrace", stack),
+			},
+		}},
+	}
+	got := convertSpan("projects/p", stub.Snapshot())
+	if got.StackTrace == nil || len(got.StackTrace.StackFrames.Frame) != 2 {
+		t.Fatalf("got stack trace %+v, want 2 frames", got.StackTrace)
+	}
+	if f := got.StackTrace.StackFrames.Frame[0]; f.FunctionName.Value != "main.f" || f.LineNumber != 10 {
+		t.Errorf("got first frame %s:%d, want main.f:10", f.FunctionName.Value, f.LineNumber)
+	}
+	am := got.TimeEvents.TimeEvent[0].Annotation.Attributes.AttributeMap
+	if _, ok := am["exception.stacktrace"]; ok {
+		t.Error("stack trace kept in annotation attributes")
+	}
+	if v := am["exception.message"].StringValue; v == nil || v.Value != "boom" {
+		t.Errorf("got exception.message %+v, want boom", v)
+	}
+}
+
+func TestConvertSpanLimits(t *testing.T) {
+	stub := tracetest.SpanStub{
+		Name:        strings.Repeat("x", 200),
+		SpanContext: testSpanContext(testSpanID, false),
+	}
+	for i := 0; i < 40; i++ {
+		stub.Events = append(stub.Events, sdktrace.Event{Name: "e", Time: testStart})
+	}
+	for i := 0; i < 130; i++ {
+		stub.Links = append(stub.Links, sdktrace.Link{SpanContext: testSpanContext(testParent, true)})
+	}
+	got := convertSpan("projects/p", stub.Snapshot())
+	if n := len(got.DisplayName.Value); n != 128 || got.DisplayName.TruncatedByteCount != 72 {
+		t.Errorf("got display name of %d bytes, %d truncated; want 128, 72", n, got.DisplayName.TruncatedByteCount)
+	}
+	if n, d := len(got.TimeEvents.TimeEvent), got.TimeEvents.DroppedAnnotationsCount; n != 32 || d != 8 {
+		t.Errorf("got %d annotations, %d dropped; want 32, 8", n, d)
+	}
+	if n, d := len(got.Links.Link), got.Links.DroppedLinksCount; n != 128 || d != 2 {
+		t.Errorf("got %d links, %d dropped; want 128, 2", n, d)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otelexporter exports OpenTelemetry spans to Cloud Trace with the
+// REST API (google.golang.org/api/cloudtrace/v2).
+//
+// An Exporter is a span exporter of the OpenTelemetry SDK. It converts
+// spans, with their attributes, events, links and status, to Cloud Trace
+// spans, applying the limits of Cloud Trace, and writes each batch it is
+// given with one request. Use it with a batching span processor:
+//
+//	e := otelexporter.NewExporter(svc, "projects/my-project")
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(e))
+//	defer tp.Shutdown(ctx)
+//	otel.SetTracerProvider(tp)
+//
+// Events become annotations. The stack trace of the first exception event
+// with one, as recorded by Span.RecordError with trace.WithStackTrace,
+// becomes the stack trace of the Cloud Trace span. Resources and
+// instrumentation scopes are not exported.
+//
+// The exporter for OpenCensus is in package
+// google.golang.org/api/cloudtrace/v2/traceexporter. Unlike the rest of this
+// module, this package needs Go 1.20 or later, as OpenTelemetry does.
+//
+// This package is experimental and subject to change without notice.
+package otelexporter
@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelexporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+)
+
+var errShutdown = errors.New("otelexporter: Exporter is shut down")
+
+// An Exporter is an OpenTelemetry span exporter that writes spans to Cloud
+// Trace with Projects.Traces.BatchWrite. It does not batch spans itself;
+// use it with sdktrace.WithBatcher.
+type Exporter struct {
+	svc     *cloudtrace.Service
+	project string
+
+	mu       sync.Mutex
+	shutdown bool
+}
+
+var _ sdktrace.SpanExporter = (*Exporter)(nil)
+
+// NewExporter returns an Exporter writing spans to the traces of project,
+// as in "projects/my-project".
+func NewExporter(svc *cloudtrace.Service, project string) *Exporter {
+	return &Exporter{svc: svc, project: project}
+}
+
+// ExportSpans converts spans to Cloud Trace spans and writes them with one
+// request. It implements sdktrace.SpanExporter.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	shutdown := e.shutdown
+	e.mu.Unlock()
+	if shutdown {
+		return errShutdown
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	req := &cloudtrace.BatchWriteSpansRequest{}
+	for _, s := range spans {
+		req.Spans = append(req.Spans, convertSpan(e.project, s))
+	}
+	_, err := e.svc.Projects.Traces.BatchWrite(e.project, req).Context(ctx).Do()
+	return err
+}
+
+// Shutdown makes later calls to ExportSpans fail. Spans are written by
+// ExportSpans, so there is nothing to flush. It implements
+// sdktrace.SpanExporter.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	e.shutdown = true
+	e.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelexporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	cloudtrace "google.golang.org/api/cloudtrace/v2"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeTrace serves BatchWriteSpans for project "p", recording the
+// requests.
+type fakeTrace struct {
+	mu     sync.Mutex
+	writes [][]*cloudtrace.Span
+	status int
+}
+
+func (f *fakeTrace) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v2/projects/p/traces:batchWrite" {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req cloudtrace.BatchWriteSpansRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes = append(f.writes, req.Spans)
+	if f.status != 0 {
+		http.Error(w, http.StatusText(f.status), f.status)
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func testSpans(n int) []sdktrace.ReadOnlySpan {
+	var stubs tracetest.SpanStubs
+	for i := 0; i < n; i++ {
+		stubs = append(stubs, tracetest.SpanStub{
+			Name:        "span",
+			SpanContext: testSpanContext(trace.SpanID{7: byte(i + 1)}, false),
+			StartTime:   testStart,
+			EndTime:     testStart,
+		})
+	}
+	return stubs.Snapshots()
+}
+
+func TestExportSpans(t *testing.T) {
+	f := &fakeTrace{}
+	svc, stop := testserver.NewService(t, f, cloudtrace.NewService)
+	defer stop()
+	e := NewExporter(svc.(*cloudtrace.Service), "projects/p")
+	ctx := context.Background()
+	if err := e.ExportSpans(ctx, testSpans(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportSpans(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.writes) != 1 || len(f.writes[0]) != 3 {
+		t.Fatalf("got writes %v, want one of 3 spans", f.writes)
+	}
+	if got, want := f.writes[0][2].SpanId, "0000000000000003"; got != want {
+		t.Errorf("got span ID %q, want %q", got, want)
+	}
+}
+
+func TestExportSpansError(t *testing.T) {
+	f := &fakeTrace{status: http.StatusForbidden}
+	svc, stop := testserver.NewService(t, f, cloudtrace.NewService)
+	defer stop()
+	e := NewExporter(svc.(*cloudtrace.Service), "projects/p")
+	if err := e.ExportSpans(context.Background(), testSpans(1)); err == nil {
+		t.Error("got nil error, want 403")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	f := &fakeTrace{}
+	svc, stop := testserver.NewService(t, f, cloudtrace.NewService)
+	defer stop()
+	e := NewExporter(svc.(*cloudtrace.Service), "projects/p")
+	ctx := context.Background()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ExportSpans(ctx, testSpans(1)); err != errShutdown {
+		t.Errorf("got %v, want %v", err, errShutdown)
+	}
+	if len(f.writes) != 0 {
+		t.Errorf("got %d writes after Shutdown, want 0", len(f.writes))
+	}
+}
+
+func TestTracerProvider(t *testing.T) {
+	f := &fakeTrace{}
+	svc, stop := testserver.NewService(t, f, cloudtrace.NewService)
+	defer stop()
+	e := NewExporter(svc.(*cloudtrace.Service), "projects/p")
+	ctx := context.Background()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(e))
+	_, span := tp.Tracer("test").Start(ctx, "op")
+	span.End()
+	if err := tp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.writes) != 1 || len(f.writes[0]) != 1 || f.writes[0][0].DisplayName.Value != "op" {
+		t.Errorf("got writes %v, want one span named op", f.writes)
+	}
+}
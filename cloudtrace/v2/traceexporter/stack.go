@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceexporter
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"go.opencensus.io/trace"
+)
+
+// StackTraceAttribute is the key of the span attribute that holds the
+// stack trace added by AddStackTrace. The Exporter turns it into the stack
+// trace of the Cloud Trace span instead of an attribute. Stack traces in
+// the format of runtime/debug.Stack are accepted too.
+const StackTraceAttribute = "stacktrace"
+
+// maxCapturedFrames is the number of frames AddStackTrace captures, so
+// that frames beyond the limit of Cloud Trace are counted as dropped.
+const maxCapturedFrames = 256
+
+// AddStackTrace adds the stack trace of its caller to s.
+func AddStackTrace(s *trace.Span) {
+	s.AddAttributes(trace.StringAttribute(StackTraceAttribute, callerStack(3)))
+}
+
+// callerStack returns the stack trace of the goroutine, skipping skip
+// frames as runtime.Callers does.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, maxCapturedFrames)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
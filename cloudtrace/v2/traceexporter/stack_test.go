@@ -0,0 +1,34 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package traceexporter
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudtrace/v2/traceexporter/internal/spanconv"
+)
+
+func TestCallerStack(t *testing.T) {
+	for _, s := range []string{callerStack(1), string(debug.Stack())} {
+		st := spanconv.ParseStackTrace(s)
+		if st == nil {
+			t.Fatalf("no frames in %q", s)
+		}
+		found := false
+		for _, f := range st.StackFrames.Frame {
+			if strings.HasSuffix(f.FunctionName.Value, "TestCallerStack") {
+				found = true
+				if !strings.HasSuffix(f.FileName.Value, "stack_test.go") || f.LineNumber == 0 {
+					t.Errorf("bad frame %+v", f)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("TestCallerStack not found in %q", s)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"sort"
+
+	dns "google.golang.org/api/dns/v1"
+)
+
+// Diff returns the change that turns the record sets current, as listed by
+// Cloud DNS, into desired. A set in both that differs in TTL or data is
+// deleted and added again; the deletions are the sets of current as they
+// are, as Cloud DNS requires. The data of records are compared in the form
+// Parse returns, so that, for example, the case of domain names does not
+// matter.
+func Diff(current, desired []*dns.ResourceRecordSet) *dns.Change {
+	cur := map[string]*dns.ResourceRecordSet{}
+	for _, rs := range current {
+		cur[key(rs.Name, rs.Type)] = rs
+	}
+	ch := &dns.Change{}
+	seen := map[string]bool{}
+	for _, rs := range desired {
+		k := key(rs.Name, rs.Type)
+		seen[k] = true
+		old := cur[k]
+		if old != nil && equal(old, rs) {
+			continue
+		}
+		if old != nil {
+			ch.Deletions = append(ch.Deletions, old)
+		}
+		ch.Additions = append(ch.Additions, rs)
+	}
+	for _, rs := range current {
+		if !seen[key(rs.Name, rs.Type)] {
+			ch.Deletions = append(ch.Deletions, rs)
+		}
+	}
+	ch.Additions = sorted(ch.Additions)
+	ch.Deletions = sorted(ch.Deletions)
+	return ch
+}
+
+// equal reports whether a and b, of the same name and type, have the same
+// TTL and data.
+func equal(a, b *dns.ResourceRecordSet) bool {
+	if a.Ttl != b.Ttl || len(a.Rrdatas) != len(b.Rrdatas) {
+		return false
+	}
+	da, db := canonical(a), canonical(b)
+	for i := range da {
+		if da[i] != db[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// canonical returns the data of rs in canonical form, sorted.
+func canonical(rs *dns.ResourceRecordSet) []string {
+	ds := make([]string, len(rs.Rrdatas))
+	for i, d := range rs.Rrdatas {
+		ds[i] = canonicalRdata(rs.Type, d)
+	}
+	sort.Strings(ds)
+	return ds
+}
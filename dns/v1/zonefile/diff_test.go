@@ -0,0 +1,39 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	dns "google.golang.org/api/dns/v1"
+)
+
+func TestDiff(t *testing.T) {
+	current := []*dns.ResourceRecordSet{
+		{Kind: "dns#resourceRecordSet", Name: "example.com.", Type: "MX", Ttl: 300, Rrdatas: []string{"20 Mail2.example.com.", "10 mail.example.com."}},
+		{Kind: "dns#resourceRecordSet", Name: "www.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.1"}},
+		{Kind: "dns#resourceRecordSet", Name: "old.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.9"}},
+		{Kind: "dns#resourceRecordSet", Name: "ttl.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.5"}},
+	}
+	desired := []*dns.ResourceRecordSet{
+		{Name: "example.com.", Type: "MX", Ttl: 300, Rrdatas: []string{"10 mail.example.com.", "20 mail2.example.com."}},
+		{Name: "www.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.2"}},
+		{Name: "ttl.example.com.", Type: "A", Ttl: 60, Rrdatas: []string{"192.0.2.5"}},
+		{Name: "new.example.com.", Type: "CNAME", Ttl: 300, Rrdatas: []string{"www.example.com."}},
+	}
+	got := Diff(current, desired)
+	want := &dns.Change{
+		Additions: []*dns.ResourceRecordSet{desired[3], desired[2], desired[1]},
+		Deletions: []*dns.ResourceRecordSet{current[2], current[3], current[1]},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := Diff(current, current); len(got.Additions)+len(got.Deletions) != 0 {
+		t.Errorf("same records: got change %+v, want none", got)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zonefile imports and exports the records of Cloud DNS managed
+// zones as zone files, with the REST API (google.golang.org/api/dns/v1).
+//
+// Parse reads a zone file in the format of RFC 1035, with $ORIGIN and $TTL
+// directives, relative names, parentheses and comments, into resource
+// record sets, and Write writes record sets as a zone file. Diff computes
+// the change between two lists of record sets.
+//
+// A Zone combines them to import a zone file into a managed zone:
+//
+//	z := zonefile.NewZone(svc, "my-project", "my-zone")
+//	f, err := os.Open("example.com.zone")
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	defer f.Close()
+//	ch, err := z.Plan(ctx, f)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	if dryRun {
+//		zonefile.WriteChange(os.Stdout, ch)
+//		return
+//	}
+//	if _, err := z.Apply(ctx, ch); err != nil {
+//		// TODO: Handle error.
+//	}
+//
+// This package is experimental and subject to change without notice.
+package zonefile
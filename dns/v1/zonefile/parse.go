@@ -0,0 +1,475 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	dns "google.golang.org/api/dns/v1"
+)
+
+// A token is a field of a zone file: a word or a quoted string, with its
+// escapes kept as written.
+type token struct {
+	s      string
+	quoted bool
+}
+
+// A line is a logical line of a zone file, with the lines inside
+// parentheses joined.
+type line struct {
+	num      int  // number of the line it starts on
+	indented bool // starts with white space, so has no owner name
+	toks     []token
+}
+
+// lex splits src into logical lines of tokens, dropping comments and blank
+// lines.
+func lex(src string) ([]line, error) {
+	var lines []line
+	num := 1
+	cur := line{num: num}
+	depth := 0
+	lineStart := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			num++
+			i++
+			lineStart = true
+			if depth == 0 {
+				if len(cur.toks) > 0 {
+					lines = append(lines, cur)
+				}
+				cur = line{num: num}
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			if lineStart && depth == 0 && len(cur.toks) == 0 {
+				cur.indented = true
+			}
+			i++
+		case c == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("zonefile: line %d: unbalanced parentheses", num)
+			}
+			depth--
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' {
+					j++
+				} else if src[j] == '\n' {
+					break
+				}
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("zonefile: line %d: unterminated quoted string", num)
+			}
+			cur.toks = append(cur.toks, token{s: src[i+1 : j], quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(src) && !strings.ContainsRune(" \t\r\n;()\"", rune(src[j])); j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+			}
+			cur.toks = append(cur.toks, token{s: src[i:j]})
+			i = j
+		}
+		lineStart = false
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("zonefile: line %d: unbalanced parentheses", cur.num)
+	}
+	if len(cur.toks) > 0 {
+		lines = append(lines, cur)
+	}
+	return lines, nil
+}
+
+// Parse parses a zone file in the format of RFC 1035, section 5, and
+// returns its records as resource record sets, in the order their first
+// records appear.
+//
+// origin is the initial origin, as in "example.com.", which relative names
+// and "@" are qualified with; $ORIGIN directives change it. A record
+// without a TTL has the TTL of the last $TTL directive or, failing that,
+// of the previous record. All records of a set must have the same TTL.
+//
+// Names are converted to lower case, and the data of the records to the
+// form Cloud DNS uses: domain names are fully qualified, and the strings of
+// TXT records and the value of CAA records are quoted. Only the IN class is
+// supported, and $INCLUDE directives are not.
+func Parse(r io.Reader, origin string) ([]*dns.ResourceRecordSet, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := lex(string(src))
+	if err != nil {
+		return nil, err
+	}
+	if origin != "" && !strings.HasSuffix(origin, ".") {
+		return nil, fmt.Errorf("zonefile: origin %q is not fully qualified", origin)
+	}
+	p := &parser{
+		origin:     strings.ToLower(origin),
+		defaultTTL: -1,
+		lastTTL:    -1,
+		sets:       map[string]*dns.ResourceRecordSet{},
+	}
+	for _, l := range lines {
+		if err := p.parseLine(l); err != nil {
+			return nil, fmt.Errorf("zonefile: line %d: %v", l.num, err)
+		}
+	}
+	return p.rrsets, nil
+}
+
+type parser struct {
+	origin     string
+	defaultTTL int64 // from $TTL, or -1
+	lastTTL    int64 // of the previous record, or -1
+	lastOwner  string
+	rrsets     []*dns.ResourceRecordSet
+	sets       map[string]*dns.ResourceRecordSet // by key
+}
+
+func (p *parser) parseLine(l line) error {
+	toks := l.toks
+	if !l.indented && !toks[0].quoted && strings.HasPrefix(toks[0].s, "$") {
+		return p.parseDirective(toks)
+	}
+	owner := p.lastOwner
+	if l.indented {
+		if owner == "" {
+			return errors.New("record without owner name")
+		}
+	} else {
+		var err error
+		if owner, err = qualify(toks[0], p.origin); err != nil {
+			return err
+		}
+		toks = toks[1:]
+	}
+	p.lastOwner = owner
+
+	ttl := int64(-1)
+	for n := 0; n < 2 && len(toks) > 0 && !toks[0].quoted; n++ {
+		s := toks[0].s
+		if s[0] >= '0' && s[0] <= '9' {
+			t, err := parseTTL(s)
+			if err != nil {
+				return err
+			}
+			ttl = t
+		} else if isClass(s) {
+			if !strings.EqualFold(s, "IN") {
+				return fmt.Errorf("unsupported class %s", s)
+			}
+		} else {
+			break
+		}
+		toks = toks[1:]
+	}
+	if len(toks) == 0 {
+		return errors.New("missing record type")
+	}
+	typ := strings.ToUpper(toks[0].s)
+	if toks[0].quoted || !isType(typ) {
+		return fmt.Errorf("bad record type %q", toks[0].s)
+	}
+	rdata, err := formatRdata(typ, toks[1:], p.origin)
+	if err != nil {
+		return fmt.Errorf("%s record: %v", typ, err)
+	}
+
+	switch {
+	case ttl >= 0:
+		p.lastTTL = ttl
+	case p.defaultTTL >= 0:
+		ttl = p.defaultTTL
+	case p.lastTTL >= 0:
+		ttl = p.lastTTL
+	default:
+		return errors.New("record without TTL")
+	}
+
+	k := key(owner, typ)
+	rs := p.sets[k]
+	if rs == nil {
+		rs = &dns.ResourceRecordSet{Name: owner, Type: typ, Ttl: ttl}
+		p.sets[k] = rs
+		p.rrsets = append(p.rrsets, rs)
+	} else if rs.Ttl != ttl {
+		return fmt.Errorf("TTL %d differs from TTL %d of earlier %s %s record", ttl, rs.Ttl, owner, typ)
+	}
+	for _, d := range rs.Rrdatas {
+		if d == rdata {
+			return nil
+		}
+	}
+	rs.Rrdatas = append(rs.Rrdatas, rdata)
+	return nil
+}
+
+func (p *parser) parseDirective(toks []token) error {
+	d := strings.ToUpper(toks[0].s)
+	switch d {
+	case "$ORIGIN", "$TTL":
+	case "$INCLUDE":
+		return errors.New("$INCLUDE is not supported")
+	default:
+		return fmt.Errorf("unknown directive %s", toks[0].s)
+	}
+	if len(toks) != 2 {
+		return fmt.Errorf("%s takes one argument", d)
+	}
+	if d == "$TTL" {
+		ttl, err := parseTTL(toks[1].s)
+		if err != nil {
+			return err
+		}
+		p.defaultTTL = ttl
+		return nil
+	}
+	origin, err := qualify(toks[1], p.origin)
+	if err != nil {
+		return err
+	}
+	p.origin = origin
+	return nil
+}
+
+// key returns the key of the set of records of the given name and type.
+func key(name, typ string) string {
+	return strings.ToLower(name) + " " + strings.ToUpper(typ)
+}
+
+// qualify returns the fully qualified, lower case form of the domain name
+// t, relative to origin.
+func qualify(t token, origin string) (string, error) {
+	s := t.s
+	switch {
+	case t.quoted || s == "":
+		return "", fmt.Errorf("bad domain name %q", s)
+	case s == "@":
+		s = origin
+	case strings.HasSuffix(s, ".") && !strings.HasSuffix(s, `\.`):
+	case origin == "":
+		return "", fmt.Errorf("relative name %q without origin", s)
+	case origin == ".":
+		s += "."
+	default:
+		s += "." + origin
+	}
+	if s == "" {
+		return "", errors.New("@ without origin")
+	}
+	return strings.ToLower(s), nil
+}
+
+// parseTTL parses a TTL in seconds, or with the units of BIND, as in
+// "1h30m".
+func parseTTL(s string) (int64, error) {
+	var total, n int64
+	digits, units := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			n = n*10 + int64(c-'0')
+			if n > math.MaxInt32 {
+				return 0, fmt.Errorf("TTL %q out of range", s)
+			}
+			digits = true
+			continue
+		}
+		var unit int64
+		switch c | 0x20 {
+		case 's':
+			unit = 1
+		case 'm':
+			unit = 60
+		case 'h':
+			unit = 3600
+		case 'd':
+			unit = 86400
+		case 'w':
+			unit = 7 * 86400
+		}
+		if unit == 0 || !digits {
+			return 0, fmt.Errorf("bad TTL %q", s)
+		}
+		total += n * unit
+		n, digits, units = 0, false, true
+	}
+	if digits && units {
+		return 0, fmt.Errorf("bad TTL %q", s)
+	}
+	total += n
+	if s == "" || total > math.MaxInt32 {
+		return 0, fmt.Errorf("bad TTL %q", s)
+	}
+	return total, nil
+}
+
+func isClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "IN", "CH", "CS", "HS":
+		return true
+	}
+	return false
+}
+
+func isType(s string) bool {
+	if s == "" || s[0] < 'A' || s[0] > 'Z' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= 'A' && s[i] <= 'Z' || s[i] >= '0' && s[i] <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatRdata returns the data of a record of type typ with the given
+// fields, in the form Cloud DNS uses.
+func formatRdata(typ string, fields []token, origin string) (string, error) {
+	// layout gives the fields of the types with domain names or numbers
+	// to check: 'n' is a name, 'u' an unsigned 16-bit number, 'U' an
+	// unsigned 32-bit number and 't' a TTL.
+	layout := map[string]string{
+		"CNAME": "n",
+		"DNAME": "n",
+		"NS":    "n",
+		"PTR":   "n",
+		"MX":    "un",
+		"SRV":   "uuun",
+		"SOA":   "nnUtttt",
+	}[typ]
+	switch typ {
+	case "A", "AAAA":
+		if len(fields) != 1 || fields[0].quoted {
+			return "", errors.New("want one address")
+		}
+		ip := net.ParseIP(fields[0].s)
+		if ip == nil || (ip.To4() != nil) != (typ == "A") {
+			return "", fmt.Errorf("bad address %q", fields[0].s)
+		}
+		return ip.String(), nil
+	case "TXT", "SPF":
+		if len(fields) == 0 {
+			return "", errors.New("want at least one string")
+		}
+		parts := make([]string, len(fields))
+		for i, f := range fields {
+			parts[i] = quote(f.s)
+		}
+		return strings.Join(parts, " "), nil
+	case "CAA":
+		if len(fields) != 3 {
+			return "", errors.New("want flags, tag and value")
+		}
+		flags, err := strconv.ParseUint(fields[0].s, 10, 8)
+		if err != nil || fields[0].quoted {
+			return "", fmt.Errorf("bad flags %q", fields[0].s)
+		}
+		tag := strings.ToLower(fields[1].s)
+		if fields[1].quoted || !isAlnum(tag) {
+			return "", fmt.Errorf("bad tag %q", fields[1].s)
+		}
+		return fmt.Sprintf("%d %s %s", flags, tag, quote(fields[2].s)), nil
+	}
+	if layout == "" {
+		parts := make([]string, len(fields))
+		for i, f := range fields {
+			parts[i] = f.s
+			if f.quoted {
+				parts[i] = quote(f.s)
+			}
+		}
+		return strings.Join(parts, " "), nil
+	}
+	if len(fields) != len(layout) {
+		return "", fmt.Errorf("got %d fields, want %d", len(fields), len(layout))
+	}
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		var err error
+		switch layout[i] {
+		case 'n':
+			parts[i], err = qualify(f, origin)
+		case 'u', 'U':
+			bits := 16
+			if layout[i] == 'U' {
+				bits = 32
+			}
+			var n uint64
+			if n, err = strconv.ParseUint(f.s, 10, bits); err != nil || f.quoted {
+				err = fmt.Errorf("bad number %q", f.s)
+			}
+			parts[i] = strconv.FormatUint(n, 10)
+		case 't':
+			var n int64
+			n, err = parseTTL(f.s)
+			parts[i] = strconv.FormatInt(n, 10)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// quote returns s, with its escapes, as a quoted string.
+func quote(s string) string {
+	return `"` + s + `"`
+}
+
+func isAlnum(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= 'a' && s[i] <= 'z' || s[i] >= '0' && s[i] <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalRdata returns the data of a record of type typ, as returned by
+// Cloud DNS, in the form Parse returns, so that records can be compared.
+// It returns rdata as it is if it cannot be parsed.
+func canonicalRdata(typ, rdata string) string {
+	lines, err := lex(rdata)
+	if err != nil || len(lines) != 1 {
+		return rdata
+	}
+	s, err := formatRdata(typ, lines[0].toks, ".")
+	if err != nil {
+		return rdata
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	dns "google.golang.org/api/dns/v1"
+)
+
+const testZone = `; example.com
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2020010201 ; serial
+		2h 15m 1w 5m )
+	IN	NS	ns1
+	IN	NS	ns2.example.net.
+	IN	MX	10 Mail
+	IN	MX	20 mail.example.net.
+	300	TXT	"v=spf1 include:_spf.example.net ~all"
+	CAA	0 issue "letsencrypt.org"
+ns1	A	192.0.2.1
+www	IN	600	AAAA	2001:DB8::0:1
+	A	192.0.2.2
+	A	192.0.2.2
+dkim._domainkey	TXT	( "v=DKIM1; k=rsa; "
+		"p=MIGf" ) ; split
+_sip._tcp	SRV	0 5 5060 sip
+$ORIGIN sub
+host	CNAME	@
+$ORIGIN example.org.
+alias	PTR	www.example.com.
+	TXT	unquoted "with \"escape\""
+`
+
+func TestParse(t *testing.T) {
+	got, err := Parse(strings.NewReader(testZone), "Example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*dns.ResourceRecordSet{
+		{Name: "example.com.", Type: "SOA", Ttl: 3600, Rrdatas: []string{"ns1.example.com. hostmaster.example.com. 2020010201 7200 900 604800 300"}},
+		{Name: "example.com.", Type: "NS", Ttl: 3600, Rrdatas: []string{"ns1.example.com.", "ns2.example.net."}},
+		{Name: "example.com.", Type: "MX", Ttl: 3600, Rrdatas: []string{"10 mail.example.com.", "20 mail.example.net."}},
+		{Name: "example.com.", Type: "TXT", Ttl: 300, Rrdatas: []string{`"v=spf1 include:_spf.example.net ~all"`}},
+		{Name: "example.com.", Type: "CAA", Ttl: 3600, Rrdatas: []string{`0 issue "letsencrypt.org"`}},
+		{Name: "ns1.example.com.", Type: "A", Ttl: 3600, Rrdatas: []string{"192.0.2.1"}},
+		{Name: "www.example.com.", Type: "AAAA", Ttl: 600, Rrdatas: []string{"2001:db8::1"}},
+		{Name: "www.example.com.", Type: "A", Ttl: 3600, Rrdatas: []string{"192.0.2.2"}},
+		{Name: "dkim._domainkey.example.com.", Type: "TXT", Ttl: 3600, Rrdatas: []string{`"v=DKIM1; k=rsa; " "p=MIGf"`}},
+		{Name: "_sip._tcp.example.com.", Type: "SRV", Ttl: 3600, Rrdatas: []string{"0 5 5060 sip.example.com."}},
+		{Name: "host.sub.example.com.", Type: "CNAME", Ttl: 3600, Rrdatas: []string{"sub.example.com."}},
+		{Name: "alias.example.org.", Type: "PTR", Ttl: 3600, Rrdatas: []string{"www.example.com."}},
+		{Name: "alias.example.org.", Type: "TXT", Ttl: 3600, Rrdatas: []string{`"unquoted" "with \"escape\""`}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseLastTTL(t *testing.T) {
+	got, err := Parse(strings.NewReader("a 60 A 192.0.2.1\nb A 192.0.2.2\n"), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[1].Ttl != 60 {
+		t.Errorf("got TTL %d, want 60", got[1].Ttl)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		src, origin, want string
+	}{
+		{"a A 192.0.2.1", "example.com.", "line 1: record without TTL"},
+		{"$TTL 60\na A 300.0.0.1", "example.com.", "line 2: A record: bad address"},
+		{"$TTL 60\na AAAA 192.0.2.1", "example.com.", "bad address"},
+		{"$TTL 60\na A 192.0.2.1\na 30 A 192.0.2.2", "example.com.", "line 3: TTL 30 differs"},
+		{"$TTL 60\n A 192.0.2.1", "example.com.", "record without owner name"},
+		{"$TTL 60\na CH A 192.0.2.1", "example.com.", "unsupported class CH"},
+		{"$TTL 60\na A (192.0.2.1", "example.com.", "unbalanced parentheses"},
+		{"$TTL 60\na TXT \"open", "example.com.", "unterminated quoted string"},
+		{"$INCLUDE other.zone", "example.com.", "$INCLUDE is not supported"},
+		{"$TTL 1x", "example.com.", `bad TTL "1x"`},
+		{"$TTL 60\na MX mail", "example.com.", "MX record: got 1 fields, want 2"},
+		{"$TTL 60\na MX 70000 mail", "example.com.", `bad number "70000"`},
+		{"$TTL 60\na. CNAME b", "", `relative name "b" without origin`},
+		{"$TTL 60\na CAA 0 issue", "example.com.", "want flags, tag and value"},
+		{"$TTL 60\na X-Y b", "example.com.", `bad record type "X-Y"`},
+		{"a", "example.com", "not fully qualified"},
+	} {
+		_, err := Parse(strings.NewReader(test.src), test.origin)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"3600", 3600, true},
+		{"1h30m", 5400, true},
+		{"1W2d", 777600, true},
+		{"2147483647", 2147483647, true},
+		{"2147483648", 0, false},
+		{"1h30", 0, false},
+		{"h", 0, false},
+		{"", 0, false},
+	} {
+		got, err := parseTTL(test.in)
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("parseTTL(%q) = %d, %v; want %d, ok %t", test.in, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestCanonicalRdata(t *testing.T) {
+	for _, test := range []struct {
+		typ, in, want string
+	}{
+		{"MX", "10 Mail.Example.COM.", "10 mail.example.com."},
+		{"AAAA", "2001:0db8::0001", "2001:db8::1"},
+		{"TXT", `"a"   "b"`, `"a" "b"`},
+		{"TXT", `"a;b"`, `"a;b"`},
+		{"MX", "bad", "bad"},
+		{"DS", "2371 13 2 1F987CC6", "2371 13 2 1F987CC6"},
+	} {
+		if got := canonicalRdata(test.typ, test.in); got != test.want {
+			t.Errorf("canonicalRdata(%q, %q) = %q, want %q", test.typ, test.in, got, test.want)
+		}
+	}
+}
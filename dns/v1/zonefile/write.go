@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	dns "google.golang.org/api/dns/v1"
+)
+
+// Write writes rrsets to w as a zone file with the given origin, as in
+// "example.com.". Owner names within the origin are written relative to
+// it. The records are sorted by name, with the SOA and NS records of a name
+// first, so the output of the same records is always the same.
+func Write(w io.Writer, origin string, rrsets []*dns.ResourceRecordSet) error {
+	origin = strings.ToLower(origin)
+	bw := bufio.NewWriter(w)
+	if origin != "" {
+		fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	}
+	for _, rs := range sorted(rrsets) {
+		name := relativize(strings.ToLower(rs.Name), origin)
+		for _, d := range rs.Rrdatas {
+			fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", name, rs.Ttl, rs.Type, d)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteChange writes the deletions of ch, prefixed by "-", and additions,
+// prefixed by "+", to w, one record per line with fully qualified names.
+// It is meant to show a change without applying it.
+func WriteChange(w io.Writer, ch *dns.Change) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range []struct {
+		prefix string
+		rrsets []*dns.ResourceRecordSet
+	}{{"-", ch.Deletions}, {"+", ch.Additions}} {
+		for _, rs := range sorted(c.rrsets) {
+			for _, d := range rs.Rrdatas {
+				fmt.Fprintf(bw, "%s %s\t%d\tIN\t%s\t%s\n", c.prefix, rs.Name, rs.Ttl, rs.Type, d)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// relativize returns name relative to origin, or name if it is not within
+// origin.
+func relativize(name, origin string) string {
+	switch {
+	case origin == "":
+		return name
+	case name == origin:
+		return "@"
+	case origin == ".":
+		return strings.TrimSuffix(name, ".")
+	case strings.HasSuffix(name, "."+origin):
+		return strings.TrimSuffix(name, "."+origin)
+	}
+	return name
+}
+
+// sorted returns a copy of rrsets in canonical order: by name, compared
+// label by label from the right, then with SOA and NS first and other types
+// in alphabetical order.
+func sorted(rrsets []*dns.ResourceRecordSet) []*dns.ResourceRecordSet {
+	s := append([]*dns.ResourceRecordSet(nil), rrsets...)
+	sort.SliceStable(s, func(i, j int) bool {
+		if c := compareNames(s[i].Name, s[j].Name); c != 0 {
+			return c < 0
+		}
+		ri, rj := typeRank(s[i].Type), typeRank(s[j].Type)
+		if ri != rj {
+			return ri < rj
+		}
+		return s[i].Type < s[j].Type
+	})
+	return s
+}
+
+func typeRank(typ string) int {
+	switch typ {
+	case "SOA":
+		return 0
+	case "NS":
+		return 1
+	}
+	return 2
+}
+
+// compareNames compares domain names label by label from the right, so
+// that the names of a subdomain follow it.
+func compareNames(a, b string) int {
+	la := strings.Split(strings.TrimSuffix(strings.ToLower(a), "."), ".")
+	lb := strings.Split(strings.TrimSuffix(strings.ToLower(b), "."), ".")
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	dns "google.golang.org/api/dns/v1"
+)
+
+func TestWrite(t *testing.T) {
+	rrsets := []*dns.ResourceRecordSet{
+		{Name: "www.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.1", "192.0.2.2"}},
+		{Name: "example.com.", Type: "TXT", Ttl: 300, Rrdatas: []string{`"a" "b"`}},
+		{Name: "a.www.example.com.", Type: "CNAME", Ttl: 60, Rrdatas: []string{"www.example.com."}},
+		{Name: "example.com.", Type: "NS", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com."}},
+		{Name: "example.com.", Type: "SOA", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com. cloud-dns-hostmaster.google.com. 1 21600 3600 259200 300"}},
+		{Name: "other.example.net.", Type: "A", Ttl: 60, Rrdatas: []string{"192.0.2.3"}},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, "example.com.", rrsets); err != nil {
+		t.Fatal(err)
+	}
+	want := `$ORIGIN example.com.
+@	21600	IN	SOA	ns-cloud-a1.googledomains.com. cloud-dns-hostmaster.google.com. 1 21600 3600 259200 300
+@	21600	IN	NS	ns-cloud-a1.googledomains.com.
+@	300	IN	TXT	"a" "b"
+www	300	IN	A	192.0.2.1
+www	300	IN	A	192.0.2.2
+a.www	60	IN	CNAME	www.example.com.
+other.example.net.	60	IN	A	192.0.2.3
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// The output parses back to the same records.
+	got, err := Parse(&b, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sorted(rrsets), sorted(got)); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteChange(t *testing.T) {
+	ch := &dns.Change{
+		Additions: []*dns.ResourceRecordSet{{Name: "www.example.com.", Type: "A", Ttl: 60, Rrdatas: []string{"192.0.2.2"}}},
+		Deletions: []*dns.ResourceRecordSet{{Name: "www.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.1"}}},
+	}
+	var b strings.Builder
+	if err := WriteChange(&b, ch); err != nil {
+		t.Fatal(err)
+	}
+	want := "- www.example.com.\t300\tIN\tA\t192.0.2.1\n+ www.example.com.\t60\tIN\tA\t192.0.2.2\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRelativize(t *testing.T) {
+	for _, test := range []struct {
+		name, origin, want string
+	}{
+		{"example.com.", "example.com.", "@"},
+		{"www.example.com.", "example.com.", "www"},
+		{"wwwexample.com.", "example.com.", "wwwexample.com."},
+		{"www.example.com.", ".", "www.example.com"},
+		{"www.example.com.", "", "www.example.com."},
+	} {
+		if got := relativize(test.name, test.origin); got != test.want {
+			t.Errorf("relativize(%q, %q) = %q, want %q", test.name, test.origin, got, test.want)
+		}
+	}
+}
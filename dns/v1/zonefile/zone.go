@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	dns "google.golang.org/api/dns/v1"
+)
+
+// DefaultPollInterval is the default time between polls of the status of
+// a change.
+const DefaultPollInterval = time.Second
+
+// A Zone imports and exports the records of a Cloud DNS managed zone.
+//
+// The exported fields are only safe to modify prior to the first call to a
+// method.
+type Zone struct {
+	// PollInterval is the time between polls of the status of a change
+	// made by Apply. The default is DefaultPollInterval.
+	PollInterval time.Duration
+
+	// ReplaceOriginNS makes Plan replace the NS records of the origin of
+	// the zone with those of the zone file. By default they are left as
+	// they are, since Cloud DNS assigns them.
+	ReplaceOriginNS bool
+
+	svc     *dns.Service
+	project string
+	zone    string
+	origin  string // DNS name of the zone, once known
+}
+
+// NewZone returns a Zone for the managed zone with the given name or ID in
+// project.
+func NewZone(svc *dns.Service, project, managedZone string) *Zone {
+	return &Zone{
+		PollInterval: DefaultPollInterval,
+		svc:          svc,
+		project:      project,
+		zone:         managedZone,
+	}
+}
+
+// Origin returns the DNS name of the zone, as in "example.com.".
+func (z *Zone) Origin(ctx context.Context) (string, error) {
+	if z.origin == "" {
+		mz, err := z.svc.ManagedZones.Get(z.project, z.zone).Context(ctx).Do()
+		if err != nil {
+			return "", err
+		}
+		z.origin = strings.ToLower(mz.DnsName)
+	}
+	return z.origin, nil
+}
+
+// Records returns the record sets of the zone.
+func (z *Zone) Records(ctx context.Context) ([]*dns.ResourceRecordSet, error) {
+	var rrsets []*dns.ResourceRecordSet
+	err := z.svc.ResourceRecordSets.List(z.project, z.zone).Pages(ctx, func(resp *dns.ResourceRecordSetsListResponse) error {
+		rrsets = append(rrsets, resp.Rrsets...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rrsets, nil
+}
+
+// Export writes the records of the zone to w as a zone file.
+func (z *Zone) Export(ctx context.Context, w io.Writer) error {
+	origin, err := z.Origin(ctx)
+	if err != nil {
+		return err
+	}
+	rrsets, err := z.Records(ctx)
+	if err != nil {
+		return err
+	}
+	return Write(w, origin, rrsets)
+}
+
+// Plan parses the zone file r, with the DNS name of the zone as its
+// initial origin, and returns the change that makes the records of the
+// zone those of the file. The SOA record, which Cloud DNS manages, is left
+// out, as are the NS records of the origin unless ReplaceOriginNS is set.
+//
+// To show the change without making it, as a dry run, pass it to
+// WriteChange instead of Apply.
+func (z *Zone) Plan(ctx context.Context, r io.Reader) (*dns.Change, error) {
+	origin, err := z.Origin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := Parse(r, origin)
+	if err != nil {
+		return nil, err
+	}
+	for _, rs := range desired {
+		if origin != "." && rs.Name != origin && !strings.HasSuffix(rs.Name, "."+origin) {
+			return nil, fmt.Errorf("zonefile: name %s is not within zone %s", rs.Name, origin)
+		}
+	}
+	current, err := z.Records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(z.managed(origin, current), z.managed(origin, desired)), nil
+}
+
+// managed returns the record sets of rrsets that Plan changes.
+func (z *Zone) managed(origin string, rrsets []*dns.ResourceRecordSet) []*dns.ResourceRecordSet {
+	var rs []*dns.ResourceRecordSet
+	for _, r := range rrsets {
+		if r.Type == "SOA" || (r.Type == "NS" && strings.EqualFold(r.Name, origin) && !z.ReplaceOriginNS) {
+			continue
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// Apply makes the change ch to the zone and waits until Cloud DNS has
+// applied it, returning the change as Cloud DNS reports it. A change
+// without additions or deletions is returned as it is.
+func (z *Zone) Apply(ctx context.Context, ch *dns.Change) (*dns.Change, error) {
+	if len(ch.Additions) == 0 && len(ch.Deletions) == 0 {
+		return ch, nil
+	}
+	ch, err := z.svc.Changes.Create(z.project, z.zone, ch).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	for ch.Status != "done" {
+		if err := gax.Sleep(ctx, z.PollInterval); err != nil {
+			return nil, err
+		}
+		if ch, err = z.svc.Changes.Get(z.project, z.zone, ch.Id).Context(ctx).Do(); err != nil {
+			return nil, err
+		}
+	}
+	return ch, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zonefile
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	dns "google.golang.org/api/dns/v1"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeDNS serves managed zone "z" of project "p", with DNS name
+// "example.com.". It lists its records one per page and applies changes
+// after one poll.
+type fakeDNS struct {
+	mu      sync.Mutex
+	rrsets  []*dns.ResourceRecordSet
+	changes []*dns.Change
+	polls   int
+}
+
+func (f *fakeDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp interface{}
+	switch p := r.URL.Path; {
+	case p == "/p/managedZones/z" && r.Method == "GET":
+		resp = &dns.ManagedZone{Name: "z", DnsName: "Example.com."}
+	case p == "/p/managedZones/z/rrsets" && r.Method == "GET":
+		i := 0
+		if tok := r.URL.Query().Get("pageToken"); tok != "" {
+			i = len(tok)
+		}
+		lr := &dns.ResourceRecordSetsListResponse{}
+		if i < len(f.rrsets) {
+			lr.Rrsets = f.rrsets[i : i+1]
+		}
+		if i+1 < len(f.rrsets) {
+			lr.NextPageToken = strings.Repeat("x", i+1)
+		}
+		resp = lr
+	case p == "/p/managedZones/z/changes" && r.Method == "POST":
+		var ch dns.Change
+		if err := json.NewDecoder(r.Body).Decode(&ch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ch.Id, ch.Status = "1", "pending"
+		f.changes = append(f.changes, &ch)
+		resp = &ch
+	case p == "/p/managedZones/z/changes/1" && r.Method == "GET":
+		f.polls++
+		ch := *f.changes[0]
+		ch.Status = "done"
+		resp = &ch
+	default:
+		http.Error(w, "bad request "+r.Method+" "+p, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func testRecords() []*dns.ResourceRecordSet {
+	return []*dns.ResourceRecordSet{
+		{Name: "example.com.", Type: "SOA", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com. cloud-dns-hostmaster.google.com. 1 21600 3600 259200 300"}},
+		{Name: "example.com.", Type: "NS", Ttl: 21600, Rrdatas: []string{"ns-cloud-a1.googledomains.com."}},
+		{Name: "www.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.1"}},
+		{Name: "old.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.9"}},
+	}
+}
+
+const testImport = `$TTL 300
+@	SOA	ns1 hostmaster 5 1h 1h 1w 1h
+	NS	ns1
+www	A	192.0.2.1
+mail	A	192.0.2.2
+`
+
+func TestPlanApply(t *testing.T) {
+	f := &fakeDNS{rrsets: testRecords()}
+	svc, done := testserver.NewService(t, f, dns.NewService)
+	defer done()
+	z := NewZone(svc.(*dns.Service), "p", "z")
+	z.PollInterval = time.Millisecond
+	ctx := context.Background()
+
+	ch, err := z.Plan(ctx, strings.NewReader(testImport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &dns.Change{
+		Additions: []*dns.ResourceRecordSet{{Name: "mail.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.2"}}},
+		Deletions: []*dns.ResourceRecordSet{{Name: "old.example.com.", Type: "A", Ttl: 300, Rrdatas: []string{"192.0.2.9"}}},
+	}
+	if diff := cmp.Diff(want, ch); diff != "" {
+		t.Errorf("Plan mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := z.Apply(ctx, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "done" || f.polls != 1 || len(f.changes) != 1 {
+		t.Errorf("got status %q after %d polls of %d changes, want done after 1 poll of 1", got.Status, f.polls, len(f.changes))
+	}
+	if diff := cmp.Diff(want.Additions, f.changes[0].Additions); diff != "" {
+		t.Errorf("sent additions mismatch (-want +got):\n%s", diff)
+	}
+
+	// An empty change is not sent.
+	if _, err := z.Apply(ctx, &dns.Change{}); err != nil || len(f.changes) != 1 {
+		t.Errorf("empty change: got error %v, %d changes; want nil, 1", err, len(f.changes))
+	}
+}
+
+func TestPlanReplaceOriginNS(t *testing.T) {
+	f := &fakeDNS{rrsets: testRecords()}
+	svc, done := testserver.NewService(t, f, dns.NewService)
+	defer done()
+	z := NewZone(svc.(*dns.Service), "p", "z")
+	z.PollInterval = time.Millisecond
+	z.ReplaceOriginNS = true
+	ch, err := z.Plan(context.Background(), strings.NewReader(testImport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, rs := range ch.Additions {
+		types = append(types, rs.Name+" "+rs.Type)
+	}
+	if diff := cmp.Diff([]string{"example.com. NS", "mail.example.com. A"}, types); diff != "" {
+		t.Errorf("additions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanOutsideZone(t *testing.T) {
+	f := &fakeDNS{rrsets: testRecords()}
+	svc, done := testserver.NewService(t, f, dns.NewService)
+	defer done()
+	z := NewZone(svc.(*dns.Service), "p", "z")
+	z.PollInterval = time.Millisecond
+	_, err := z.Plan(context.Background(), strings.NewReader("$TTL 60\nwww.example.org. A 192.0.2.1\n"))
+	if err == nil || !strings.Contains(err.Error(), "not within zone") {
+		t.Errorf("got error %v, want name not within zone", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	f := &fakeDNS{rrsets: testRecords()}
+	svc, done := testserver.NewService(t, f, dns.NewService)
+	defer done()
+	z := NewZone(svc.(*dns.Service), "p", "z")
+	z.PollInterval = time.Millisecond
+	var b strings.Builder
+	if err := z.Export(context.Background(), &b); err != nil {
+		t.Fatal(err)
+	}
+	want := `$ORIGIN example.com.
+@	21600	IN	SOA	ns-cloud-a1.googledomains.com. cloud-dns-hostmaster.google.com. 1 21600 3600 259200 300
+@	21600	IN	NS	ns-cloud-a1.googledomains.com.
+old	300	IN	A	192.0.2.9
+www	300	IN	A	192.0.2.1
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,908 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docconv
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	docs "google.golang.org/api/docs/v1"
+)
+
+// DefaultCodeFonts are the default font families of text that is rendered
+// as code.
+var DefaultCodeFonts = []string{
+	"Consolas",
+	"Courier",
+	"Courier New",
+	"Cousine",
+	"Fira Code",
+	"Fira Mono",
+	"IBM Plex Mono",
+	"Inconsolata",
+	"JetBrains Mono",
+	"Menlo",
+	"Monaco",
+	"PT Mono",
+	"Roboto Mono",
+	"Source Code Pro",
+	"Space Mono",
+	"Ubuntu Mono",
+}
+
+// A SuggestionsMode is a way of rendering the suggested changes of a
+// document, after the suggestions view modes of Documents.Get. A document
+// gotten with a preview mode has no suggested changes, so it is rendered
+// the same in every mode.
+type SuggestionsMode int
+
+const (
+	// SuggestionsInline renders suggested insertions and deletions marked
+	// as such. Markdown has no mark for insertions, so there they are
+	// plain text, and deletions are struck through. Suggested changes of
+	// styles are not rendered.
+	SuggestionsInline SuggestionsMode = iota
+
+	// PreviewSuggestionsAccepted renders the document as if all its
+	// suggested changes were accepted.
+	PreviewSuggestionsAccepted
+
+	// PreviewWithoutSuggestions renders the document as if all its
+	// suggested changes were rejected.
+	PreviewWithoutSuggestions
+)
+
+// A Converter converts documents of the Docs API to Markdown and HTML.
+type Converter struct {
+	// Suggestions is the way suggested changes are rendered.
+	Suggestions SuggestionsMode
+
+	// CodeFonts are the font families of text rendered as code. The
+	// default is DefaultCodeFonts.
+	CodeFonts []string
+
+	// ImageURL, if non-nil, returns the URL an inline image is rendered
+	// with, given its object ID and the embedded object of the image. If
+	// it returns the empty string, the image is left out. If ImageURL is
+	// nil, the ContentUri of the image is used; it is valid for only 30
+	// minutes after the document was gotten, so programs that keep the
+	// output should copy the images and return the URLs of the copies.
+	ImageURL func(objectID string, o *docs.EmbeddedObject) (string, error)
+}
+
+// NewConverter returns a Converter with the default settings.
+func NewConverter() *Converter {
+	return &Converter{CodeFonts: DefaultCodeFonts}
+}
+
+// The converted form of a document is a tree of blocks and spans, which
+// the Markdown and HTML writers render.
+
+// A document is a converted document.
+type document struct {
+	blocks    []*block
+	footnotes []*footnote
+}
+
+// A footnote is a converted footnote, with its number in the order of the
+// references to footnotes.
+type footnote struct {
+	id     string
+	number int
+	blocks []*block
+}
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	codeBlock
+	listBlock
+	tableBlock
+	ruleBlock
+)
+
+// A block is a block of text: a paragraph, a heading, a code block, a
+// list, a table or a horizontal rule.
+type block struct {
+	kind  blockKind
+	level int      // of a heading, from 1 to 6
+	id    string   // the anchor of a heading
+	spans []*span  // of a paragraph or a heading
+	lines []string // of a code block
+	list  *list
+	rows  [][]*cell // of a table
+}
+
+// A list is a bulleted or numbered list.
+type list struct {
+	ordered bool
+	glyph   string // the GlyphType of an ordered list
+	items   []*item
+}
+
+// An item is an item of a list, with the list of the items nested in it.
+type item struct {
+	number int // in an ordered list
+	spans  []*span
+	sub    *list
+}
+
+// A cell is a cell of a table.
+type cell struct {
+	blocks           []*block
+	colspan, rowspan int
+}
+
+type spanKind int
+
+const (
+	textSpan spanKind = iota
+	breakSpan
+	imageSpan
+	footnoteSpan
+)
+
+// A span is a run of text with the same style, a line break, an image or
+// a reference to a footnote.
+type span struct {
+	kind  spanKind
+	text  string // or the alternative text of an image
+	style style
+
+	// Of an image.
+	url           string
+	title         string
+	width, height int // in pixels, or 0 if unknown
+
+	footnote int // the number of the footnote of a reference
+}
+
+// A style is the style of a span.
+type style struct {
+	bold, italic, strike, underline, code bool
+	sup, sub                              bool
+	ins, del                              bool // suggested insertion or deletion
+	link                                  string
+}
+
+// headingLevels are the heading levels of the named styles of headings.
+var headingLevels = map[string]int{
+	"TITLE":     1,
+	"SUBTITLE":  2,
+	"HEADING_1": 1,
+	"HEADING_2": 2,
+	"HEADING_3": 3,
+	"HEADING_4": 4,
+	"HEADING_5": 5,
+	"HEADING_6": 6,
+}
+
+// orderedGlyphs are the glyph types of numbered lists.
+var orderedGlyphs = map[string]bool{
+	"DECIMAL":      true,
+	"ZERO_DECIMAL": true,
+	"ALPHA":        true,
+	"UPPER_ALPHA":  true,
+	"ROMAN":        true,
+	"UPPER_ROMAN":  true,
+}
+
+// maxNestingLevel is the greatest nesting level of lists.
+const maxNestingLevel = 8
+
+// A converter converts one document.
+type converter struct {
+	c   *Converter
+	doc *docs.Document
+
+	headings  map[*docs.Paragraph]string // the anchors of headings
+	anchors   map[string]string          // the anchors of headings by heading ID
+	footnotes map[string]*footnote
+	order     []*footnote // in the order of their references
+	counters  map[string][]int
+}
+
+// convert converts d.
+func (c *Converter) convert(d *docs.Document) (*document, error) {
+	cv := &converter{
+		c:         c,
+		doc:       d,
+		headings:  make(map[*docs.Paragraph]string),
+		anchors:   make(map[string]string),
+		footnotes: make(map[string]*footnote),
+		counters:  make(map[string][]int),
+	}
+	var content []*docs.StructuralElement
+	if d.Body != nil {
+		content = d.Body.Content
+	}
+	cv.addAnchors(content, make(map[string]bool))
+	blocks, err := cv.blocks(content)
+	if err != nil {
+		return nil, err
+	}
+	doc := &document{blocks: blocks}
+	// Footnotes are converted after the body, which numbers them.
+	for _, f := range cv.order {
+		if fn, ok := d.Footnotes[f.id]; ok {
+			if f.blocks, err = cv.blocks(fn.Content); err != nil {
+				return nil, err
+			}
+			// Footnotes start with a space after their numbers.
+			if len(f.blocks) > 0 && len(f.blocks[0].spans) > 0 {
+				if s := f.blocks[0].spans[0]; s.kind == textSpan {
+					s.text = strings.TrimLeft(s.text, " ")
+				}
+			}
+		}
+		doc.footnotes = append(doc.footnotes, f)
+	}
+	return doc, nil
+}
+
+// addAnchors adds the anchors of the headings of content, which are unique
+// among used. Headings get anchors before they are converted, so that links
+// to later headings can refer to them.
+func (cv *converter) addAnchors(content []*docs.StructuralElement, used map[string]bool) {
+	for _, se := range content {
+		switch {
+		case se.Paragraph != nil:
+			ps := cv.paragraphStyle(se.Paragraph)
+			if ps == nil || headingLevels[ps.NamedStyleType] == 0 {
+				continue
+			}
+			text := cv.plainText(se.Paragraph)
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			a := slug(text)
+			if a == "" {
+				a = "heading"
+			}
+			for i, base := 1, a; used[a]; i++ {
+				a = base + "-" + strconv.Itoa(i)
+			}
+			used[a] = true
+			cv.headings[se.Paragraph] = a
+			if ps.HeadingId != "" {
+				cv.anchors[ps.HeadingId] = a
+			}
+		case se.Table != nil:
+			for _, r := range se.Table.TableRows {
+				for _, c := range r.TableCells {
+					cv.addAnchors(c.Content, used)
+				}
+			}
+		}
+	}
+}
+
+// slug returns the anchor of a heading with the given text, made as
+// GitHub does: in lower case, with spaces replaced by hyphens and
+// punctuation removed.
+func slug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// plainText returns the text of p, without styles.
+func (cv *converter) plainText(p *docs.Paragraph) string {
+	var b strings.Builder
+	for _, el := range p.Elements {
+		if r := el.TextRun; r != nil && !cv.skip(r.SuggestedInsertionIds, r.SuggestedDeletionIds) {
+			b.WriteString(strings.Replace(strings.TrimSuffix(r.Content, "\n"), "\v", " ", -1))
+		}
+	}
+	return b.String()
+}
+
+// skip reports whether content with the given suggested insertions and
+// deletions is left out.
+func (cv *converter) skip(ins, del []string) bool {
+	switch cv.c.Suggestions {
+	case PreviewSuggestionsAccepted:
+		return len(del) > 0
+	case PreviewWithoutSuggestions:
+		return len(ins) > 0
+	}
+	return false
+}
+
+// accepted reports whether suggested changes of styles are applied.
+func (cv *converter) accepted() bool {
+	return cv.c.Suggestions == PreviewSuggestionsAccepted
+}
+
+// blocks converts content.
+func (cv *converter) blocks(content []*docs.StructuralElement) ([]*block, error) {
+	var out []*block
+	var lb *listBuilder // of the list the last paragraph is an item of
+	for _, se := range content {
+		switch {
+		case se.Paragraph != nil:
+			p := se.Paragraph
+			spans, err := cv.spans(p)
+			if err != nil {
+				return nil, err
+			}
+			if bu := cv.bullet(p); bu != nil {
+				if len(spans) == 0 {
+					continue
+				}
+				if lb == nil || lb.id != bu.ListId {
+					lb = &listBuilder{id: bu.ListId}
+					lb.levels = []*list{cv.newList(bu.ListId, 0)}
+					out = append(out, &block{kind: listBlock, list: lb.levels[0]})
+				}
+				cv.addItem(lb, int(bu.NestingLevel), spans)
+				continue
+			}
+			lb = nil
+			var last *block
+			if len(out) > 0 {
+				last = out[len(out)-1]
+			}
+			code := cv.isCode(p, spans)
+			switch {
+			case len(spans) == 0:
+				// Blank lines are kept only in code.
+				if code && last != nil && last.kind == codeBlock {
+					last.lines = append(last.lines, "")
+				}
+			case headingLevels[cv.namedStyle(p)] > 0:
+				out = append(out, &block{kind: headingBlock, level: headingLevels[cv.namedStyle(p)], id: cv.headings[p], spans: spans})
+			case code:
+				var text strings.Builder
+				for _, s := range spans {
+					if s.kind == breakSpan {
+						text.WriteByte('\n')
+					} else {
+						text.WriteString(s.text)
+					}
+				}
+				lines := strings.Split(text.String(), "\n")
+				if last != nil && last.kind == codeBlock {
+					last.lines = append(last.lines, lines...)
+				} else {
+					out = append(out, &block{kind: codeBlock, lines: lines})
+				}
+			default:
+				out = append(out, &block{kind: paragraphBlock, spans: spans})
+			}
+			if cv.hasRule(p) {
+				out = append(out, &block{kind: ruleBlock})
+			}
+		case se.Table != nil:
+			lb = nil
+			if b, err := cv.table(se.Table); err != nil {
+				return nil, err
+			} else if b != nil {
+				out = append(out, b)
+			}
+		case se.TableOfContents != nil:
+			lb = nil
+			toc := se.TableOfContents
+			if cv.skip(toc.SuggestedInsertionIds, toc.SuggestedDeletionIds) {
+				continue
+			}
+			bs, err := cv.blocks(toc.Content)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bs...)
+		}
+	}
+	// Code blocks do not end with blank lines.
+	for _, b := range out {
+		for b.kind == codeBlock && len(b.lines) > 1 && strings.TrimSpace(b.lines[len(b.lines)-1]) == "" {
+			b.lines = b.lines[:len(b.lines)-1]
+		}
+	}
+	return out, nil
+}
+
+// paragraphStyle returns the style of p, with the suggested changes of its
+// named style and heading ID applied in the order of their suggestion IDs
+// if they are accepted.
+func (cv *converter) paragraphStyle(p *docs.Paragraph) *docs.ParagraphStyle {
+	ps := p.ParagraphStyle
+	if !cv.accepted() || len(p.SuggestedParagraphStyleChanges) == 0 {
+		return ps
+	}
+	var s docs.ParagraphStyle
+	if ps != nil {
+		s = *ps
+	}
+	var ids []string
+	for id := range p.SuggestedParagraphStyleChanges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ch := p.SuggestedParagraphStyleChanges[id]
+		st, cs := ch.ParagraphStyleSuggestionState, ch.ParagraphStyle
+		if st == nil || cs == nil {
+			continue
+		}
+		if st.NamedStyleTypeSuggested {
+			s.NamedStyleType = cs.NamedStyleType
+		}
+		if st.HeadingIdSuggested {
+			s.HeadingId = cs.HeadingId
+		}
+	}
+	return &s
+}
+
+// namedStyle returns the named style type of p.
+func (cv *converter) namedStyle(p *docs.Paragraph) string {
+	if ps := cv.paragraphStyle(p); ps != nil {
+		return ps.NamedStyleType
+	}
+	return ""
+}
+
+// bullet returns the bullet of p, or nil if p is not a list item, with its
+// suggested changes if they are accepted.
+func (cv *converter) bullet(p *docs.Paragraph) *docs.Bullet {
+	bu := p.Bullet
+	if !cv.accepted() || len(p.SuggestedBulletChanges) == 0 {
+		return bu
+	}
+	var b docs.Bullet
+	if bu != nil {
+		b = *bu
+	}
+	var ids []string
+	for id := range p.SuggestedBulletChanges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ch := p.SuggestedBulletChanges[id]
+		st := ch.BulletSuggestionState
+		if st == nil {
+			continue
+		}
+		var cb docs.Bullet
+		if ch.Bullet != nil {
+			cb = *ch.Bullet
+		}
+		if st.ListIdSuggested {
+			b.ListId = cb.ListId
+		}
+		if st.NestingLevelSuggested {
+			b.NestingLevel = cb.NestingLevel
+		}
+	}
+	if b.ListId == "" {
+		return nil
+	}
+	return &b
+}
+
+// isCode reports whether p, with the given spans, is a line of code: all
+// its text is in code fonts, and it has no images or footnotes.
+func (cv *converter) isCode(p *docs.Paragraph, spans []*span) bool {
+	if len(spans) == 0 {
+		// A blank line is code if its line break is.
+		if n := len(p.Elements); n > 0 {
+			if r := p.Elements[n-1].TextRun; r != nil {
+				return cv.style(r.TextStyle, r.SuggestedTextStyleChanges).code
+			}
+		}
+		return false
+	}
+	text := false
+	for _, s := range spans {
+		switch s.kind {
+		case imageSpan, footnoteSpan:
+			return false
+		case textSpan:
+			if strings.TrimSpace(s.text) != "" {
+				if !s.style.code {
+					return false
+				}
+				text = true
+			}
+		}
+	}
+	return text
+}
+
+// hasRule reports whether p has a horizontal rule.
+func (cv *converter) hasRule(p *docs.Paragraph) bool {
+	for _, el := range p.Elements {
+		if hr := el.HorizontalRule; hr != nil && !cv.skip(hr.SuggestedInsertionIds, hr.SuggestedDeletionIds) {
+			return true
+		}
+	}
+	return false
+}
+
+// spans returns the spans of the text, images and footnote references of
+// p, without its final line break.
+func (cv *converter) spans(p *docs.Paragraph) ([]*span, error) {
+	var spans []*span
+	add := func(s *span) {
+		if n := len(spans); n > 0 && s.kind == textSpan && spans[n-1].kind == textSpan && spans[n-1].style == s.style {
+			spans[n-1].text += s.text
+			return
+		}
+		spans = append(spans, s)
+	}
+	for _, el := range p.Elements {
+		switch {
+		case el.TextRun != nil:
+			r := el.TextRun
+			if cv.skip(r.SuggestedInsertionIds, r.SuggestedDeletionIds) {
+				continue
+			}
+			st := cv.style(r.TextStyle, r.SuggestedTextStyleChanges)
+			st.ins, st.del = cv.marks(r.SuggestedInsertionIds, r.SuggestedDeletionIds)
+			for i, line := range strings.Split(strings.TrimSuffix(r.Content, "\n"), "\v") {
+				if i > 0 {
+					add(&span{kind: breakSpan, style: st})
+				}
+				if line != "" {
+					add(&span{kind: textSpan, text: line, style: st})
+				}
+			}
+		case el.InlineObjectElement != nil:
+			e := el.InlineObjectElement
+			if cv.skip(e.SuggestedInsertionIds, e.SuggestedDeletionIds) {
+				continue
+			}
+			s, err := cv.image(e.InlineObjectId)
+			if err != nil {
+				return nil, err
+			}
+			if s != nil {
+				s.style = cv.style(e.TextStyle, e.SuggestedTextStyleChanges)
+				s.style.ins, s.style.del = cv.marks(e.SuggestedInsertionIds, e.SuggestedDeletionIds)
+				add(s)
+			}
+		case el.FootnoteReference != nil:
+			r := el.FootnoteReference
+			if cv.skip(r.SuggestedInsertionIds, r.SuggestedDeletionIds) {
+				continue
+			}
+			f, ok := cv.footnotes[r.FootnoteId]
+			if !ok {
+				f = &footnote{id: r.FootnoteId, number: len(cv.order) + 1}
+				cv.footnotes[r.FootnoteId] = f
+				cv.order = append(cv.order, f)
+			}
+			s := &span{kind: footnoteSpan, footnote: f.number}
+			s.style.ins, s.style.del = cv.marks(r.SuggestedInsertionIds, r.SuggestedDeletionIds)
+			add(s)
+		}
+	}
+	// Line breaks at the end of paragraphs are dropped.
+	for len(spans) > 0 && spans[len(spans)-1].kind == breakSpan {
+		spans = spans[:len(spans)-1]
+	}
+	return spans, nil
+}
+
+// marks returns whether content with the given suggested insertions and
+// deletions is marked as inserted or deleted.
+func (cv *converter) marks(ins, del []string) (bool, bool) {
+	if cv.c.Suggestions != SuggestionsInline {
+		return false, false
+	}
+	return len(ins) > 0, len(del) > 0
+}
+
+// style returns the style of text with the text style ts and the suggested
+// changes to it.
+func (cv *converter) style(ts *docs.TextStyle, changes map[string]docs.SuggestedTextStyle) style {
+	if cv.accepted() && len(changes) > 0 {
+		ts = applyTextStyleChanges(ts, changes)
+	}
+	var s style
+	if ts == nil {
+		return s
+	}
+	s.bold = ts.Bold
+	s.italic = ts.Italic
+	s.strike = ts.Strikethrough
+	s.underline = ts.Underline
+	switch ts.BaselineOffset {
+	case "SUPERSCRIPT":
+		s.sup = true
+	case "SUBSCRIPT":
+		s.sub = true
+	}
+	if f := ts.WeightedFontFamily; f != nil {
+		fonts := cv.c.CodeFonts
+		if fonts == nil {
+			fonts = DefaultCodeFonts
+		}
+		for _, name := range fonts {
+			if strings.EqualFold(f.FontFamily, name) {
+				s.code = true
+				break
+			}
+		}
+	}
+	if l := ts.Link; l != nil {
+		switch {
+		case l.Url != "":
+			s.link = l.Url
+		case l.HeadingId != "" && cv.anchors[l.HeadingId] != "":
+			s.link = "#" + cv.anchors[l.HeadingId]
+		}
+		// Links are underlined by default.
+		s.underline = false
+	}
+	return s
+}
+
+// applyTextStyleChanges returns ts with the changes applied, in the order
+// of their suggestion IDs.
+func applyTextStyleChanges(ts *docs.TextStyle, changes map[string]docs.SuggestedTextStyle) *docs.TextStyle {
+	var s docs.TextStyle
+	if ts != nil {
+		s = *ts
+	}
+	var ids []string
+	for id := range changes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		st, cs := changes[id].TextStyleSuggestionState, changes[id].TextStyle
+		if st == nil {
+			continue
+		}
+		if cs == nil {
+			cs = &docs.TextStyle{}
+		}
+		if st.BoldSuggested {
+			s.Bold = cs.Bold
+		}
+		if st.ItalicSuggested {
+			s.Italic = cs.Italic
+		}
+		if st.StrikethroughSuggested {
+			s.Strikethrough = cs.Strikethrough
+		}
+		if st.UnderlineSuggested {
+			s.Underline = cs.Underline
+		}
+		if st.BaselineOffsetSuggested {
+			s.BaselineOffset = cs.BaselineOffset
+		}
+		if st.WeightedFontFamilySuggested {
+			s.WeightedFontFamily = cs.WeightedFontFamily
+		}
+		if st.LinkSuggested {
+			s.Link = cs.Link
+		}
+	}
+	return &s
+}
+
+// image returns the span of the inline object with the given ID, or nil if
+// it is not an image or has no URL.
+func (cv *converter) image(id string) (*span, error) {
+	obj, ok := cv.doc.InlineObjects[id]
+	if !ok || obj.InlineObjectProperties == nil {
+		return nil, nil
+	}
+	eo := obj.InlineObjectProperties.EmbeddedObject
+	if eo == nil || eo.ImageProperties == nil {
+		return nil, nil
+	}
+	var url string
+	if cv.c.ImageURL != nil {
+		var err error
+		if url, err = cv.c.ImageURL(id, eo); err != nil {
+			return nil, err
+		}
+	} else {
+		url = eo.ImageProperties.ContentUri
+	}
+	if url == "" {
+		return nil, nil
+	}
+	s := &span{kind: imageSpan, text: eo.Description, url: url}
+	if s.text == "" {
+		s.text = eo.Title
+	} else {
+		s.title = eo.Title
+	}
+	if sz := eo.Size; sz != nil {
+		s.width, s.height = pixels(sz.Width), pixels(sz.Height)
+	}
+	return s, nil
+}
+
+// pixels returns a dimension in CSS pixels, or 0 if it is unknown.
+func pixels(d *docs.Dimension) int {
+	if d == nil || d.Unit != "PT" {
+		return 0
+	}
+	return int(math.Round(d.Magnitude * 4 / 3))
+}
+
+// A listBuilder builds a list from the paragraphs of its items.
+type listBuilder struct {
+	id     string
+	levels []*list // the lists of the last item and the items it is nested in
+}
+
+// newList returns an empty list of the nesting level of the list with the
+// given ID.
+func (cv *converter) newList(id string, level int) *list {
+	l := &list{}
+	if nl := cv.nestingLevel(id, level); nl != nil && orderedGlyphs[nl.GlyphType] {
+		l.ordered = true
+		l.glyph = nl.GlyphType
+	}
+	return l
+}
+
+// nestingLevel returns the properties of a nesting level of the list with
+// the given ID, or nil if there are none.
+func (cv *converter) nestingLevel(id string, level int) *docs.NestingLevel {
+	l, ok := cv.doc.Lists[id]
+	if !ok || l.ListProperties == nil || level >= len(l.ListProperties.NestingLevels) {
+		return nil
+	}
+	return l.ListProperties.NestingLevels[level]
+}
+
+// addItem adds an item with the given spans to the list of lb at the given
+// nesting level.
+func (cv *converter) addItem(lb *listBuilder, level int, spans []*span) {
+	if level < 0 {
+		level = 0
+	}
+	if level > maxNestingLevel {
+		level = maxNestingLevel
+	}
+	if len(lb.levels) > level+1 {
+		lb.levels = lb.levels[:level+1]
+	}
+	for len(lb.levels) <= level {
+		parent := lb.levels[len(lb.levels)-1]
+		if len(parent.items) == 0 {
+			// The first item of the list is nested.
+			parent.items = append(parent.items, &item{})
+		}
+		last := parent.items[len(parent.items)-1]
+		if last.sub == nil {
+			last.sub = cv.newList(lb.id, len(lb.levels))
+		}
+		lb.levels = append(lb.levels, last.sub)
+	}
+	l := lb.levels[level]
+	l.items = append(l.items, &item{number: cv.number(lb.id, level), spans: spans})
+	// Items added for nested first items are numbered as the items before
+	// the first numbered one.
+	for i := len(l.items) - 2; i >= 0 && l.items[i].spans == nil && l.items[i].number == 0; i-- {
+		l.items[i].number = l.items[i+1].number - 1
+	}
+}
+
+// number returns the number of the next item of the list with the given ID
+// at the given nesting level. Numbering goes on after paragraphs that are
+// not in the list, and starts over at a nesting level after an item of a
+// lower one.
+func (cv *converter) number(id string, level int) int {
+	c := cv.counters[id]
+	if c == nil {
+		c = make([]int, maxNestingLevel+1)
+		cv.counters[id] = c
+	}
+	c[level]++
+	for i := level + 1; i < len(c); i++ {
+		c[i] = 0
+	}
+	start := 1
+	if nl := cv.nestingLevel(id, level); nl != nil && nl.StartNumber > 0 {
+		start = int(nl.StartNumber)
+	}
+	return start + c[level] - 1
+}
+
+// table converts t, or returns nil if it is left out.
+func (cv *converter) table(t *docs.Table) (*block, error) {
+	if cv.skip(t.SuggestedInsertionIds, t.SuggestedDeletionIds) {
+		return nil, nil
+	}
+	b := &block{kind: tableBlock}
+	for _, r := range t.TableRows {
+		if cv.skip(r.SuggestedInsertionIds, r.SuggestedDeletionIds) {
+			continue
+		}
+		var row []*cell
+		for _, c := range r.TableCells {
+			if cv.skip(c.SuggestedInsertionIds, c.SuggestedDeletionIds) {
+				continue
+			}
+			blocks, err := cv.blocks(c.Content)
+			if err != nil {
+				return nil, err
+			}
+			cl := &cell{blocks: blocks, colspan: 1, rowspan: 1}
+			if st := c.TableCellStyle; st != nil {
+				if st.ColumnSpan > 1 {
+					cl.colspan = int(st.ColumnSpan)
+				}
+				if st.RowSpan > 1 {
+					cl.rowspan = int(st.RowSpan)
+				}
+			}
+			row = append(row, cl)
+		}
+		b.rows = append(b.rows, row)
+	}
+	if len(b.rows) == 0 {
+		return nil, nil
+	}
+	return b, nil
+}
+
+type markerKind int
+
+const (
+	linkMarker markerKind = iota
+	insMarker
+	delMarker
+	strikeMarker
+	boldMarker
+	italicMarker
+	underlineMarker
+	supMarker
+	subMarker
+)
+
+// A marker is a style that is rendered by marking where it starts and
+// ends, as with the tags of HTML.
+type marker struct {
+	kind markerKind
+	link string
+}
+
+// transition returns how the markers of text are changed from open to
+// want: the number of the last markers of open to close, and the markers
+// of want to open after them, outermost first.
+func transition(open, want []marker) (int, []marker) {
+	in := func(m marker, ms []marker) bool {
+		for _, n := range ms {
+			if n == m {
+				return true
+			}
+		}
+		return false
+	}
+	i := 0
+	for i < len(open) && in(open[i], want) {
+		i++
+	}
+	var opens []marker
+	for _, m := range want {
+		if !in(m, open[:i]) {
+			opens = append(opens, m)
+		}
+	}
+	return len(open) - i, opens
+}
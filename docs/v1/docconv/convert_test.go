@@ -0,0 +1,330 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docconv
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	docs "google.golang.org/api/docs/v1"
+)
+
+func run(s string, ts *docs.TextStyle) *docs.ParagraphElement {
+	return &docs.ParagraphElement{TextRun: &docs.TextRun{Content: s, TextStyle: ts}}
+}
+
+func para(namedStyle string, els ...*docs.ParagraphElement) *docs.StructuralElement {
+	return &docs.StructuralElement{Paragraph: &docs.Paragraph{
+		Elements:       els,
+		ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: namedStyle},
+	}}
+}
+
+func heading(namedStyle, headingID string, els ...*docs.ParagraphElement) *docs.StructuralElement {
+	se := para(namedStyle, els...)
+	se.Paragraph.ParagraphStyle.HeadingId = headingID
+	return se
+}
+
+func listItem(listID string, level int64, els ...*docs.ParagraphElement) *docs.StructuralElement {
+	se := para("NORMAL_TEXT", els...)
+	se.Paragraph.Bullet = &docs.Bullet{ListId: listID, NestingLevel: level}
+	return se
+}
+
+func tableOf(rows ...[]*docs.StructuralElement) *docs.StructuralElement {
+	t := &docs.Table{Rows: int64(len(rows))}
+	for _, r := range rows {
+		tr := &docs.TableRow{}
+		for _, c := range r {
+			tr.TableCells = append(tr.TableCells, &docs.TableCell{Content: []*docs.StructuralElement{c}})
+		}
+		t.TableRows = append(t.TableRows, tr)
+	}
+	return &docs.StructuralElement{Table: t}
+}
+
+var (
+	bold   = &docs.TextStyle{Bold: true}
+	italic = &docs.TextStyle{Italic: true}
+	mono   = &docs.TextStyle{WeightedFontFamily: &docs.WeightedFontFamily{FontFamily: "Courier New", Weight: 400}}
+)
+
+func link(url string) *docs.TextStyle {
+	return &docs.TextStyle{Link: &docs.Link{Url: url}, Underline: true}
+}
+
+// testDocument returns a document with every kind of content converted.
+func testDocument() *docs.Document {
+	return &docs.Document{
+		Title: "Design",
+		Body: &docs.Body{Content: []*docs.StructuralElement{
+			{SectionBreak: &docs.SectionBreak{}},
+			heading("TITLE", "h.title", run("Design: Sync\n", nil)),
+			para("NORMAL_TEXT",
+				run("See ", nil),
+				run("details", &docs.TextStyle{Link: &docs.Link{HeadingId: "h.details"}}),
+				run(" and the ", nil),
+				run("site", link("https://example.com/a b")),
+				run(", ", nil),
+				run("now", bold),
+				run(" ", nil),
+				run("bold italic", &docs.TextStyle{Bold: true, Italic: true}),
+				run(" or ", nil),
+				run("struck", &docs.TextStyle{Strikethrough: true}),
+				run(".", nil),
+				&docs.ParagraphElement{FootnoteReference: &docs.FootnoteReference{FootnoteId: "fn.1", FootnoteNumber: "1"}},
+				run("\n", nil),
+			),
+			para("NORMAL_TEXT", run("\n", nil)),
+			heading("HEADING_1", "h.details", run("Details\n", nil)),
+			listItem("bul", 0, run("One\n", nil)),
+			listItem("bul", 1, run("One ", nil), run("a", italic), run("\n", nil)),
+			listItem("bul", 0, run("Two\n", nil)),
+			listItem("num", 0, run("First\n", nil)),
+			listItem("num", 1, run("Sub\n", nil)),
+			listItem("num", 1, run("Sub 2\n", nil)),
+			listItem("num", 0, run("Second\n", nil)),
+			para("NORMAL_TEXT", run("Between\u000bthe lists\n", nil)),
+			listItem("num", 0, run("Third\n", nil)),
+			listItem("num", 1, run("Sub 3\n", nil)),
+			para("NORMAL_TEXT", run("func main() {\n", mono)),
+			para("NORMAL_TEXT", run("\n", mono)),
+			para("NORMAL_TEXT", run("\tfmt.Println(\"*hi*\")\n", mono)),
+			para("NORMAL_TEXT", run("}\n", mono)),
+			para("NORMAL_TEXT", run("\n", mono)),
+			para("NORMAL_TEXT", run("Call ", nil), run("Sync()", mono), run(" first.\n", nil)),
+			tableOf(
+				[]*docs.StructuralElement{para("NORMAL_TEXT", run("Name\n", bold)), para("NORMAL_TEXT", run("Value\n", bold))},
+				[]*docs.StructuralElement{para("NORMAL_TEXT", run("a|b\n", nil)), para("NORMAL_TEXT", run("1\n", nil))},
+			),
+			para("NORMAL_TEXT",
+				&docs.ParagraphElement{InlineObjectElement: &docs.InlineObjectElement{InlineObjectId: "kix.img"}},
+				run("\n", nil),
+			),
+			para("NORMAL_TEXT", &docs.ParagraphElement{HorizontalRule: &docs.HorizontalRule{}}, run("\n", nil)),
+			para("NORMAL_TEXT", run("1. not_a list *or* # heading\n", nil)),
+		}},
+		Footnotes: map[string]docs.Footnote{
+			"fn.1": {FootnoteId: "fn.1", Content: []*docs.StructuralElement{
+				para("NORMAL_TEXT", run(" A note.\n", nil)),
+			}},
+		},
+		InlineObjects: map[string]docs.InlineObject{
+			"kix.img": {ObjectId: "kix.img", InlineObjectProperties: &docs.InlineObjectProperties{
+				EmbeddedObject: &docs.EmbeddedObject{
+					Description:     "Diagram",
+					ImageProperties: &docs.ImageProperties{ContentUri: "https://lh3.example.com/img"},
+					Size: &docs.Size{
+						Width:  &docs.Dimension{Magnitude: 150, Unit: "PT"},
+						Height: &docs.Dimension{Magnitude: 75, Unit: "PT"},
+					},
+				},
+			}},
+		},
+		Lists: map[string]docs.List{
+			"bul": {ListProperties: &docs.ListProperties{NestingLevels: []*docs.NestingLevel{
+				{GlyphSymbol: "●"},
+				{GlyphSymbol: "○"},
+			}}},
+			"num": {ListProperties: &docs.ListProperties{NestingLevels: []*docs.NestingLevel{
+				{GlyphType: "DECIMAL", GlyphFormat: "%0."},
+				{GlyphType: "ALPHA", GlyphFormat: "%1."},
+			}}},
+		},
+	}
+}
+
+func TestSlug(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"Details", "details"},
+		{"Design: Sync", "design-sync"},
+		{" Über  Straße ", "über--straße"},
+		{"a_b-c (d)", "a_b-c-d"},
+	} {
+		if got := slug(test.in); got != test.want {
+			t.Errorf("slug(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	d := &docs.Document{Body: &docs.Body{Content: []*docs.StructuralElement{
+		heading("HEADING_1", "h.1", run("Intro\n", nil)),
+		heading("HEADING_2", "", run("Intro\n", nil)),
+		heading("HEADING_2", "h.3", run("\n", nil)),
+		heading("HEADING_2", "h.4", run("Intro\n", nil)),
+		heading("HEADING_3", "h.5", run("?\n", nil)),
+	}}}
+	doc, err := NewConverter().convert(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range doc.blocks {
+		got = append(got, b.id)
+	}
+	want := []string{"intro", "intro-1", "intro-2", "heading"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLists(t *testing.T) {
+	d := &docs.Document{
+		Body: &docs.Body{Content: []*docs.StructuralElement{
+			// Items are added before nested first items, numbered so that
+			// the items after them keep their numbers.
+			listItem("n", 1, run("a\n", nil)),
+			listItem("n", 0, run("b\n", nil)),
+			listItem("n", 2, run("c\n", nil)),
+			listItem("n", 1, run("d\n", nil)),
+			listItem("n", 0, run("e\n", nil)),
+			listItem("n", 1, run("f\n", nil)),
+			listItem("u", 0, run("g\n", nil)),
+		}},
+		Lists: map[string]docs.List{
+			"n": {ListProperties: &docs.ListProperties{NestingLevels: []*docs.NestingLevel{
+				{GlyphType: "DECIMAL", StartNumber: 3},
+				{GlyphType: "ROMAN"},
+				{GlyphType: "ALPHA"},
+			}}},
+		},
+	}
+	var b strings.Builder
+	if err := NewConverter().HTML(&b, d); err != nil {
+		t.Fatal(err)
+	}
+	want := `<ol start="2">
+<li>
+<ol type="i">
+<li>a</li>
+</ol>
+</li>
+<li>b
+<ol type="i" start="0">
+<li>
+<ol type="a">
+<li>c</li>
+</ol>
+</li>
+<li>d</li>
+</ol>
+</li>
+<li>e
+<ol type="i">
+<li>f</li>
+</ol>
+</li>
+</ol>
+<ul>
+<li>g</li>
+</ul>
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// suggestionsDocument returns a document with suggested changes.
+func suggestionsDocument() *docs.Document {
+	ins := func(s string) *docs.ParagraphElement {
+		el := run(s, nil)
+		el.TextRun.SuggestedInsertionIds = []string{"suggest.1"}
+		return el
+	}
+	del := func(s string) *docs.ParagraphElement {
+		el := run(s, nil)
+		el.TextRun.SuggestedDeletionIds = []string{"suggest.2"}
+		return el
+	}
+	emph := run("style", nil)
+	emph.TextRun.SuggestedTextStyleChanges = map[string]docs.SuggestedTextStyle{
+		"suggest.3": {
+			TextStyle:                &docs.TextStyle{Bold: true},
+			TextStyleSuggestionState: &docs.TextStyleSuggestionState{BoldSuggested: true},
+		},
+	}
+	h := para("NORMAL_TEXT", run("Heading\n", nil))
+	h.Paragraph.SuggestedParagraphStyleChanges = map[string]docs.SuggestedParagraphStyle{
+		"suggest.4": {
+			ParagraphStyle:                &docs.ParagraphStyle{NamedStyleType: "HEADING_2"},
+			ParagraphStyleSuggestionState: &docs.ParagraphStyleSuggestionState{NamedStyleTypeSuggested: true},
+		},
+	}
+	return &docs.Document{Body: &docs.Body{Content: []*docs.StructuralElement{
+		h,
+		para("NORMAL_TEXT", run("Keep ", nil), del("old"), ins("new"), run(" ", nil), emph, run(".\n", nil)),
+		para("NORMAL_TEXT", ins("Inserted paragraph.\n")),
+	}}}
+}
+
+func TestSuggestions(t *testing.T) {
+	for _, test := range []struct {
+		mode               SuggestionsMode
+		wantMarkdown, want string
+	}{
+		{
+			mode:         SuggestionsInline,
+			wantMarkdown: "Heading\n\nKeep ~~old~~new style.\n\nInserted paragraph.\n",
+			want:         "<p>Heading</p>\n<p>Keep <del>old</del><ins>new</ins> style.</p>\n<p><ins>Inserted paragraph.</ins></p>\n",
+		},
+		{
+			mode:         PreviewSuggestionsAccepted,
+			wantMarkdown: "## Heading\n\nKeep new **style**.\n\nInserted paragraph.\n",
+			want:         "<h2 id=\"heading\">Heading</h2>\n<p>Keep new <strong>style</strong>.</p>\n<p>Inserted paragraph.</p>\n",
+		},
+		{
+			mode:         PreviewWithoutSuggestions,
+			wantMarkdown: "Heading\n\nKeep old style.\n",
+			want:         "<p>Heading</p>\n<p>Keep old style.</p>\n",
+		},
+	} {
+		c := NewConverter()
+		c.Suggestions = test.mode
+		var md, h strings.Builder
+		if err := c.Markdown(&md, suggestionsDocument()); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.HTML(&h, suggestionsDocument()); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.wantMarkdown, md.String()); diff != "" {
+			t.Errorf("mode %d: Markdown mismatch (-want +got):\n%s", test.mode, diff)
+		}
+		if diff := cmp.Diff(test.want, h.String()); diff != "" {
+			t.Errorf("mode %d: HTML mismatch (-want +got):\n%s", test.mode, diff)
+		}
+	}
+}
+
+func TestImageURL(t *testing.T) {
+	c := NewConverter()
+	var ids []string
+	c.ImageURL = func(id string, o *docs.EmbeddedObject) (string, error) {
+		ids = append(ids, id)
+		return "/images/" + id + ".png", nil
+	}
+	var b strings.Builder
+	if err := c.Markdown(&b, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "![Diagram](/images/kix.img.png)") {
+		t.Errorf("image URL not used in:\n%s", b.String())
+	}
+	if diff := cmp.Diff([]string{"kix.img"}, ids); diff != "" {
+		t.Errorf("object IDs mismatch (-want +got):\n%s", diff)
+	}
+
+	errFailed := errors.New("failed")
+	c.ImageURL = func(string, *docs.EmbeddedObject) (string, error) { return "", errFailed }
+	if err := c.HTML(&b, testDocument()); err != errFailed {
+		t.Errorf("got %v, want %v", err, errFailed)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package docconv converts documents of the Docs API
+// (google.golang.org/api/docs/v1) to Markdown and HTML.
+//
+// A Converter walks the structural elements of a document as returned by
+// Documents.Get. Headings come from the named styles of paragraphs, nested
+// bulleted and numbered lists from the lists of the document, and code from
+// text in monospace fonts. Tables, links, inline images, bold, italic and
+// struck-through text, and footnotes are converted too. Suggested changes
+// are rendered inline, accepted or rejected, after the suggestions view
+// modes of Documents.Get. Headers, footers, positioned objects, drawings
+// and equations are left out.
+//
+// For example, to convert a document to Markdown:
+//
+//	d, err := svc.Documents.Get(documentID).Context(ctx).Do()
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	if err := docconv.NewConverter().Markdown(w, d); err != nil {
+//		// TODO: Handle error.
+//	}
+//
+// This package is experimental and subject to change without notice.
+package docconv
@@ -0,0 +1,221 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docconv
+
+import (
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	docs "google.golang.org/api/docs/v1"
+)
+
+// HTML writes d to w as a fragment of HTML, the content of a body element.
+// Headings have their anchors as IDs, and footnotes are listed in a section
+// of class "footnotes" at the end.
+func (c *Converter) HTML(w io.Writer, d *docs.Document) error {
+	doc, err := c.convert(d)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	htmlBlocks(&b, doc.blocks)
+	if len(doc.footnotes) > 0 {
+		b.WriteString("<section class=\"footnotes\">\n<ol>\n")
+		for _, f := range doc.footnotes {
+			n := strconv.Itoa(f.number)
+			b.WriteString(`<li id="fn` + n + `">` + "\n")
+			htmlBlocks(&b, f.blocks)
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</ol>\n</section>\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// htmlBlocks writes the HTML of bs, each on its own lines.
+func htmlBlocks(b *strings.Builder, bs []*block) {
+	for _, bl := range bs {
+		switch bl.kind {
+		case paragraphBlock:
+			b.WriteString("<p>" + htmlInline(bl.spans) + "</p>\n")
+		case headingBlock:
+			tag := "h" + strconv.Itoa(bl.level)
+			b.WriteString("<" + tag)
+			if bl.id != "" {
+				b.WriteString(` id="` + html.EscapeString(bl.id) + `"`)
+			}
+			b.WriteString(">" + htmlInline(bl.spans) + "</" + tag + ">\n")
+		case codeBlock:
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(bl.lines, "\n")) + "\n</code></pre>\n")
+		case listBlock:
+			htmlList(b, bl.list)
+		case tableBlock:
+			b.WriteString("<table>\n")
+			for _, r := range bl.rows {
+				b.WriteString("<tr>\n")
+				for _, c := range r {
+					b.WriteString("<td")
+					if c.colspan > 1 {
+						b.WriteString(` colspan="` + strconv.Itoa(c.colspan) + `"`)
+					}
+					if c.rowspan > 1 {
+						b.WriteString(` rowspan="` + strconv.Itoa(c.rowspan) + `"`)
+					}
+					b.WriteString(">")
+					// A cell of one paragraph has no paragraph element.
+					if len(c.blocks) == 1 && c.blocks[0].kind == paragraphBlock {
+						b.WriteString(htmlInline(c.blocks[0].spans))
+					} else if len(c.blocks) > 0 {
+						b.WriteString("\n")
+						htmlBlocks(b, c.blocks)
+					}
+					b.WriteString("</td>\n")
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</table>\n")
+		case ruleBlock:
+			b.WriteString("<hr>\n")
+		}
+	}
+}
+
+// glyphTypes are the values of the type attribute of ordered lists with
+// the given glyph types, other than decimal numbers.
+var glyphTypes = map[string]string{
+	"ALPHA":       "a",
+	"UPPER_ALPHA": "A",
+	"ROMAN":       "i",
+	"UPPER_ROMAN": "I",
+}
+
+// htmlList writes the HTML of l.
+func htmlList(b *strings.Builder, l *list) {
+	tag := "ul"
+	if l.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if l.ordered {
+		if t := glyphTypes[l.glyph]; t != "" {
+			b.WriteString(` type="` + t + `"`)
+		}
+		if len(l.items) > 0 && l.items[0].number != 1 {
+			b.WriteString(` start="` + strconv.Itoa(l.items[0].number) + `"`)
+		}
+	}
+	b.WriteString(">\n")
+	for _, it := range l.items {
+		b.WriteString("<li>" + htmlInline(it.spans))
+		if it.sub != nil {
+			b.WriteString("\n")
+			htmlList(b, it.sub)
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+}
+
+// htmlInline returns the HTML of spans.
+func htmlInline(spans []*span) string {
+	var b strings.Builder
+	var open []marker
+	for _, s := range spans {
+		want := htmlMarkers(s.style)
+		if s.kind == footnoteSpan {
+			want = nil
+		}
+		n, opens := transition(open, want)
+		for i := len(open) - 1; i >= len(open)-n; i-- {
+			b.WriteString(htmlClose(open[i]))
+		}
+		open = open[:len(open)-n]
+		for _, m := range opens {
+			b.WriteString(htmlOpen(m))
+			open = append(open, m)
+		}
+		switch s.kind {
+		case textSpan:
+			if s.style.code {
+				b.WriteString("<code>" + html.EscapeString(s.text) + "</code>")
+			} else {
+				b.WriteString(html.EscapeString(s.text))
+			}
+		case breakSpan:
+			b.WriteString("<br>")
+		case imageSpan:
+			b.WriteString(`<img src="` + html.EscapeString(s.url) + `" alt="` + html.EscapeString(s.text) + `"`)
+			if s.title != "" {
+				b.WriteString(` title="` + html.EscapeString(s.title) + `"`)
+			}
+			if s.width > 0 && s.height > 0 {
+				b.WriteString(` width="` + strconv.Itoa(s.width) + `" height="` + strconv.Itoa(s.height) + `"`)
+			}
+			b.WriteString(">")
+		case footnoteSpan:
+			n := strconv.Itoa(s.footnote)
+			b.WriteString(`<sup id="fnref` + n + `"><a href="#fn` + n + `">` + n + `</a></sup>`)
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString(htmlClose(open[i]))
+	}
+	return b.String()
+}
+
+// htmlMarkers returns the markers of text with style s in HTML.
+func htmlMarkers(s style) []marker {
+	var ms []marker
+	if s.link != "" {
+		ms = append(ms, marker{kind: linkMarker, link: s.link})
+	}
+	for _, m := range []struct {
+		set  bool
+		kind markerKind
+	}{
+		{s.ins, insMarker},
+		{s.del, delMarker},
+		{s.strike, strikeMarker},
+		{s.bold, boldMarker},
+		{s.italic, italicMarker},
+		{s.underline, underlineMarker},
+		{s.sup, supMarker},
+		{s.sub, subMarker},
+	} {
+		if m.set {
+			ms = append(ms, marker{kind: m.kind})
+		}
+	}
+	return ms
+}
+
+// htmlTags are the elements of the markers other than links.
+var htmlTags = map[markerKind]string{
+	insMarker:       "ins",
+	delMarker:       "del",
+	strikeMarker:    "s",
+	boldMarker:      "strong",
+	italicMarker:    "em",
+	underlineMarker: "u",
+	supMarker:       "sup",
+	subMarker:       "sub",
+}
+
+func htmlOpen(m marker) string {
+	if m.kind == linkMarker {
+		return `<a href="` + html.EscapeString(m.link) + `">`
+	}
+	return "<" + htmlTags[m.kind] + ">"
+}
+
+func htmlClose(m marker) string {
+	if m.kind == linkMarker {
+		return "</a>"
+	}
+	return "</" + htmlTags[m.kind] + ">"
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docconv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTML(t *testing.T) {
+	const want = `<h1 id="design-sync">Design: Sync</h1>
+<p>See <a href="#details">details</a> and the <a href="https://example.com/a b">site</a>, <strong>now</strong> <strong><em>bold italic</em></strong> or <s>struck</s>.<sup id="fnref1"><a href="#fn1">1</a></sup></p>
+<h1 id="details">Details</h1>
+<ul>
+<li>One
+<ul>
+<li>One <em>a</em></li>
+</ul>
+</li>
+<li>Two</li>
+</ul>
+<ol>
+<li>First
+<ol type="a">
+<li>Sub</li>
+<li>Sub 2</li>
+</ol>
+</li>
+<li>Second</li>
+</ol>
+<p>Between<br>the lists</p>
+<ol start="3">
+<li>Third
+<ol type="a">
+<li>Sub 3</li>
+</ol>
+</li>
+</ol>
+<pre><code>func main() {
+
+	fmt.Println(&#34;*hi*&#34;)
+}
+</code></pre>
+<p>Call <code>Sync()</code> first.</p>
+<table>
+<tr>
+<td><strong>Name</strong></td>
+<td><strong>Value</strong></td>
+</tr>
+<tr>
+<td>a|b</td>
+<td>1</td>
+</tr>
+</table>
+<p><img src="https://lh3.example.com/img" alt="Diagram" width="200" height="100"></p>
+<hr>
+<p>1. not_a list *or* # heading</p>
+<section class="footnotes">
+<ol>
+<li id="fn1">
+<p>A note.</p>
+</li>
+</ol>
+</section>
+`
+	var b strings.Builder
+	if err := NewConverter().HTML(&b, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docconv
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	docs "google.golang.org/api/docs/v1"
+)
+
+// Markdown writes d to w as Markdown: CommonMark with the tables,
+// strikethrough and footnotes of GitHub Flavored Markdown. Underlines,
+// superscripts and subscripts are not rendered, numbered lists are
+// numbered with decimal numbers, and links to headings refer to the
+// anchors GitHub gives headings.
+func (c *Converter) Markdown(w io.Writer, d *docs.Document) error {
+	doc, err := c.convert(d)
+	if err != nil {
+		return err
+	}
+	var parts []string
+	if s := mdBlocks(doc.blocks); s != "" {
+		parts = append(parts, s)
+	}
+	for _, f := range doc.footnotes {
+		s := "[^" + strconv.Itoa(f.number) + "]:"
+		if text := mdBlocks(f.blocks); text != "" {
+			s += " " + indentRest(text, "    ")
+		}
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	_, err = io.WriteString(w, strings.Join(parts, "\n\n")+"\n")
+	return err
+}
+
+// mdBlocks returns the Markdown of bs.
+func mdBlocks(bs []*block) string {
+	var parts []string
+	var prev *list
+	alt := false
+	for _, b := range bs {
+		var s string
+		switch b.kind {
+		case paragraphBlock:
+			s = mdInline(b.spans, "\\\n", false)
+		case headingBlock:
+			s = strings.Repeat("#", b.level) + " " + mdInline(b.spans, " ", false)
+		case codeBlock:
+			text := strings.Join(b.lines, "\n")
+			fence := "```"
+			for strings.Contains(text, fence) {
+				fence += "`"
+			}
+			s = fence + "\n" + text + "\n" + fence
+		case listBlock:
+			// Lists of the same kind one after the other are told apart by
+			// their markers, or they would be one list.
+			alt = prev != nil && prev.ordered == b.list.ordered && !alt
+			s = mdList(b.list, alt)
+		case tableBlock:
+			s = mdTable(b.rows)
+		case ruleBlock:
+			s = "---"
+		}
+		prev = b.list
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// mdList returns the Markdown of l, with the alternative markers if alt is
+// set.
+func mdList(l *list, alt bool) string {
+	var items []string
+	for _, it := range l.items {
+		marker := "-"
+		if alt {
+			marker = "*"
+		}
+		if l.ordered {
+			marker = strconv.Itoa(it.number) + "."
+			if alt {
+				marker = strconv.Itoa(it.number) + ")"
+			}
+		}
+		pad := strings.Repeat(" ", len(marker)+1)
+		s := marker
+		if text := mdInline(it.spans, "\\\n", false); text != "" {
+			s += " " + indentRest(text, pad)
+		}
+		if it.sub != nil {
+			s += "\n" + pad + indentRest(mdList(it.sub, false), pad)
+		}
+		items = append(items, s)
+	}
+	return strings.Join(items, "\n")
+}
+
+// mdTable returns the Markdown of a table with the given rows. The first
+// row is the header, and cells that span columns are followed by empty
+// ones.
+func mdTable(rows [][]*cell) string {
+	var texts [][]string
+	cols := 0
+	for _, r := range rows {
+		var row []string
+		for _, c := range r {
+			row = append(row, mdInline(flatten(c.blocks), "<br>", true))
+			for i := 1; i < c.colspan; i++ {
+				row = append(row, "")
+			}
+		}
+		if len(row) > cols {
+			cols = len(row)
+		}
+		texts = append(texts, row)
+	}
+	if cols == 0 {
+		return ""
+	}
+	var lines []string
+	for i, row := range texts {
+		for len(row) < cols {
+			row = append(row, "")
+		}
+		lines = append(lines, strings.TrimRight("| "+strings.Join(row, " | ")+" |", " "))
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", cols))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flatten returns the spans of bs as lines of one block, for the cells of
+// Markdown tables.
+func flatten(bs []*block) []*span {
+	var out []*span
+	add := func(spans ...*span) {
+		if len(out) > 0 && len(spans) > 0 {
+			out = append(out, &span{kind: breakSpan})
+		}
+		out = append(out, spans...)
+	}
+	var addList func(l *list)
+	addList = func(l *list) {
+		for _, it := range l.items {
+			add(append([]*span{{kind: textSpan, text: "• "}}, it.spans...)...)
+			if it.sub != nil {
+				addList(it.sub)
+			}
+		}
+	}
+	for _, b := range bs {
+		switch b.kind {
+		case paragraphBlock, headingBlock:
+			add(b.spans...)
+		case codeBlock:
+			for _, l := range b.lines {
+				add(&span{kind: textSpan, text: l, style: style{code: true}})
+			}
+		case listBlock:
+			addList(b.list)
+		case tableBlock:
+			for _, r := range b.rows {
+				for _, c := range r {
+					add(flatten(c.blocks)...)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// mdInline returns the Markdown of spans, with line breaks written as brk.
+// In tables, pipes are escaped.
+func mdInline(spans []*span, brk string, table bool) string {
+	w := &mdWriter{table: table}
+	for _, s := range spans {
+		switch s.kind {
+		case textSpan:
+			text := strings.TrimLeftFunc(s.text, unicode.IsSpace)
+			w.pending += s.text[:len(s.text)-len(text)]
+			if text == "" {
+				// Whitespace leaves styles as they are.
+				continue
+			}
+			core := strings.TrimRightFunc(text, unicode.IsSpace)
+			if s.style.code {
+				w.write(mdMarkers(s.style), codeSpan(core, table), false)
+			} else {
+				w.write(mdMarkers(s.style), core, true)
+			}
+			w.pending = text[len(core):]
+		case breakSpan:
+			w.pending = brk
+		case imageSpan:
+			img := "![" + mdEscape(s.text, false, table) + "](" + mdURL(s.url)
+			if s.title != "" {
+				img += ` "` + strings.Replace(mdEscape(s.title, false, table), `"`, `\"`, -1) + `"`
+			}
+			w.write(mdMarkers(s.style), img+")", false)
+		case footnoteSpan:
+			st := s.style
+			st.link = ""
+			w.write(mdMarkers(st), "[^"+strconv.Itoa(s.footnote)+"]", false)
+		}
+	}
+	w.write(nil, "", false)
+	return string(w.buf)
+}
+
+// An mdWriter writes Markdown text with styles.
+type mdWriter struct {
+	buf     []byte
+	open    []marker
+	pending string // whitespace or a line break to write before more text
+	table   bool
+}
+
+// write writes text with the given markers, escaping it if escape is set.
+// Whitespace pending before the text is written outside the markers
+// changed, since emphasis cannot start or end with whitespace.
+func (w *mdWriter) write(want []marker, text string, escape bool) {
+	n, opens := transition(w.open, want)
+	for i := len(w.open) - 1; i >= len(w.open)-n; i-- {
+		w.buf = append(w.buf, mdClose(w.open[i])...)
+	}
+	w.open = w.open[:len(w.open)-n]
+	if text == "" {
+		return
+	}
+	p := w.pending
+	if i := strings.LastIndexByte(p, '\n'); i >= 0 {
+		p = p[:i+1] + strings.TrimLeft(p[i+1:], " \t")
+	}
+	if len(w.buf) > 0 {
+		w.buf = append(w.buf, p...)
+	}
+	w.pending = ""
+	for _, m := range opens {
+		w.buf = append(w.buf, mdOpen(m)...)
+		w.open = append(w.open, m)
+	}
+	if escape {
+		text = mdEscape(text, len(w.buf) == 0 || w.buf[len(w.buf)-1] == '\n', w.table)
+	}
+	w.buf = append(w.buf, text...)
+}
+
+// mdMarkers returns the markers of text with style s in Markdown.
+func mdMarkers(s style) []marker {
+	var ms []marker
+	if s.link != "" {
+		ms = append(ms, marker{kind: linkMarker, link: s.link})
+	}
+	if s.strike || s.del {
+		ms = append(ms, marker{kind: strikeMarker})
+	}
+	if s.bold {
+		ms = append(ms, marker{kind: boldMarker})
+	}
+	if s.italic {
+		ms = append(ms, marker{kind: italicMarker})
+	}
+	return ms
+}
+
+func mdOpen(m marker) string {
+	switch m.kind {
+	case linkMarker:
+		return "["
+	case strikeMarker:
+		return "~~"
+	case boldMarker:
+		return "**"
+	case italicMarker:
+		return "*"
+	}
+	return ""
+}
+
+func mdClose(m marker) string {
+	if m.kind == linkMarker {
+		return "](" + mdURL(m.link) + ")"
+	}
+	return mdOpen(m)
+}
+
+// mdEscape escapes the characters of s that Markdown would take for
+// markup. If lineStart is set, s starts a line.
+func mdEscape(s string, lineStart, table bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '`', '*', '[', ']', '<', '>', '~':
+			b.WriteByte('\\')
+		case '_':
+			// Underscores within words are not emphasis.
+			if i == 0 || i == len(s)-1 || !isAlnum(s[i-1]) || !isAlnum(s[i+1]) {
+				b.WriteByte('\\')
+			}
+		case '|':
+			if table {
+				b.WriteByte('\\')
+			}
+		case '&':
+			if isEntity(s[i:]) {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(c)
+	}
+	e := b.String()
+	if !lineStart || e == "" {
+		return e
+	}
+	// Text at the start of a line must not start a heading, a list item or
+	// a setext heading underline.
+	switch e[0] {
+	case '#', '-', '+', '=':
+		return `\` + e
+	}
+	i := 0
+	for i < len(e) && i < 9 && e[i] >= '0' && e[i] <= '9' {
+		i++
+	}
+	if i > 0 && i < len(e) && (e[i] == '.' || e[i] == ')') {
+		return e[:i] + `\` + e[i:]
+	}
+	return e
+}
+
+// isAlnum reports whether c is an ASCII letter or digit, or a byte of a
+// character that is not ASCII.
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isEntity reports whether s starts with an HTML entity or character
+// reference.
+func isEntity(s string) bool {
+	i := strings.IndexByte(s, ';')
+	if i < 2 {
+		return false
+	}
+	name := strings.TrimPrefix(s[1:i], "#")
+	if name == "" {
+		return false
+	}
+	for j := 0; j < len(name); j++ {
+		if c := name[j]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// codeSpan returns the Markdown code span of s.
+func codeSpan(s string, table bool) string {
+	if table {
+		s = strings.Replace(s, "|", `\|`, -1)
+	}
+	longest, run := 0, 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+var urlEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E")
+
+// mdURL returns url as the destination of a Markdown link or image.
+func mdURL(url string) string {
+	return urlEscaper.Replace(url)
+}
+
+// indentRest indents the lines of s after the first one with pad, except
+// blank lines.
+func indentRest(s, pad string) string {
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = pad + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
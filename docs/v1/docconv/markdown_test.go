@@ -0,0 +1,117 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docconv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	docs "google.golang.org/api/docs/v1"
+)
+
+func TestMarkdown(t *testing.T) {
+	const want = "# Design: Sync\n" +
+		"\n" +
+		"See [details](#details) and the [site](https://example.com/a%20b), **now *bold italic*** or ~~struck~~.[^1]\n" +
+		"\n" +
+		"# Details\n" +
+		"\n" +
+		"- One\n" +
+		"  - One *a*\n" +
+		"- Two\n" +
+		"\n" +
+		"1. First\n" +
+		"   1. Sub\n" +
+		"   2. Sub 2\n" +
+		"2. Second\n" +
+		"\n" +
+		"Between\\\n" +
+		"the lists\n" +
+		"\n" +
+		"3. Third\n" +
+		"   1. Sub 3\n" +
+		"\n" +
+		"```\n" +
+		"func main() {\n" +
+		"\n" +
+		"\tfmt.Println(\"*hi*\")\n" +
+		"}\n" +
+		"```\n" +
+		"\n" +
+		"Call `Sync()` first.\n" +
+		"\n" +
+		"| **Name** | **Value** |\n" +
+		"| --- | --- |\n" +
+		"| a\\|b | 1 |\n" +
+		"\n" +
+		"![Diagram](https://lh3.example.com/img)\n" +
+		"\n" +
+		"---\n" +
+		"\n" +
+		"1\\. not_a list \\*or\\* # heading\n" +
+		"\n" +
+		"[^1]: A note.\n"
+	var b strings.Builder
+	if err := NewConverter().Markdown(&b, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarkdownEmpty(t *testing.T) {
+	var b strings.Builder
+	if err := NewConverter().Markdown(&b, &docs.Document{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
+}
+
+func TestMDEscape(t *testing.T) {
+	for _, test := range []struct {
+		in        string
+		lineStart bool
+		table     bool
+		want      string
+	}{
+		{in: "plain text", want: "plain text"},
+		{in: "a*b_c [d] <e> ~f `g` \\", want: `a\*b_c \[d\] \<e\> \~f \` + "`g\\`" + ` \\`},
+		{in: "_lead snake_case trail_", want: `\_lead snake_case trail\_`},
+		{in: "a|b", want: "a|b"},
+		{in: "a|b", table: true, want: `a\|b`},
+		{in: "&amp; & &#38; &x", want: `\&amp; & \&#38; &x`},
+		{in: "# no heading", want: "# no heading"},
+		{in: "# no heading", lineStart: true, want: `\# no heading`},
+		{in: "- no item", lineStart: true, want: `\- no item`},
+		{in: "12. no item", lineStart: true, want: `12\. no item`},
+		{in: "3) no item", lineStart: true, want: `3\) no item`},
+		{in: "2020 was", lineStart: true, want: "2020 was"},
+	} {
+		if got := mdEscape(test.in, test.lineStart, test.table); got != test.want {
+			t.Errorf("mdEscape(%q, %t, %t) = %q, want %q", test.in, test.lineStart, test.table, got, test.want)
+		}
+	}
+}
+
+func TestCodeSpan(t *testing.T) {
+	for _, test := range []struct {
+		in    string
+		table bool
+		want  string
+	}{
+		{in: "x := 1", want: "`x := 1`"},
+		{in: "a ` b", want: "``a ` b``"},
+		{in: "`quoted`", want: "`` `quoted` ``"},
+		{in: "a || b", table: true, want: "`a \\|\\| b`"},
+	} {
+		if got := codeSpan(test.in, test.table); got != test.want {
+			t.Errorf("codeSpan(%q, %t) = %q, want %q", test.in, test.table, got, test.want)
+		}
+	}
+}
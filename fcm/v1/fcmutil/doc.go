@@ -0,0 +1,30 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fcmutil sends Firebase Cloud Messaging messages to many devices
+// with the FCM v1 REST API (google.golang.org/api/fcm/v1).
+//
+// The v1 API sends a message to one registration token per request. A
+// Sender sends a message template to a list of tokens concurrently,
+// retrying errors that may not recur, and classifies the result of each
+// token:
+//
+//	s := fcmutil.NewSender(svc, "projects/my-project")
+//	results, err := s.Send(ctx, &fcm.Message{
+//		Notification: &fcm.Notification{Title: "Hello"},
+//		Android:      (&fcmutil.Android{Priority: "HIGH", TTL: time.Hour}).Config(),
+//	}, tokens)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	for _, tok := range fcmutil.InvalidTokens(results) {
+//		// TODO: Forget tok.
+//	}
+//
+// The Android, APNS and Webpush types build the platform-specific parts of
+// a message, whose APNs payload and Web Push notification are otherwise
+// untyped JSON.
+//
+// This package is experimental and subject to change without notice.
+package fcmutil
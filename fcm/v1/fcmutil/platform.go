@@ -0,0 +1,281 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fcmutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	fcm "google.golang.org/api/fcm/v1"
+)
+
+// formatDuration formats d as a google.protobuf.Duration in JSON, as in
+// "3.5s".
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// Android holds the Android options of a message.
+type Android struct {
+	// Priority is "NORMAL" or "HIGH".
+	Priority string
+
+	// TTL is how long FCM keeps the message while the device is offline.
+	// Zero means the FCM default, four weeks; use SendNow for messages
+	// that must not be kept at all.
+	TTL     time.Duration
+	SendNow bool
+
+	CollapseKey           string
+	RestrictedPackageName string
+	Data                  map[string]string
+	Notification          *fcm.AndroidNotification
+	AnalyticsLabel        string
+}
+
+// Config returns the AndroidConfig of a.
+func (a *Android) Config() *fcm.AndroidConfig {
+	c := &fcm.AndroidConfig{
+		Priority:              a.Priority,
+		CollapseKey:           a.CollapseKey,
+		RestrictedPackageName: a.RestrictedPackageName,
+		Data:                  a.Data,
+		Notification:          a.Notification,
+	}
+	switch {
+	case a.SendNow:
+		c.Ttl = "0s"
+	case a.TTL > 0:
+		c.Ttl = formatDuration(a.TTL)
+	}
+	if a.AnalyticsLabel != "" {
+		c.FcmOptions = &fcm.AndroidFcmOptions{AnalyticsLabel: a.AnalyticsLabel}
+	}
+	return c
+}
+
+// APNS holds the Apple Push Notification service options of a message.
+type APNS struct {
+	// Priority is the apns-priority header: 10 to send the notification
+	// immediately, 5 to send it at a time that saves power. Zero leaves it
+	// unset.
+	Priority int
+
+	// Expiration is the apns-expiration header. Zero leaves it unset.
+	Expiration time.Time
+
+	// PushType is the apns-push-type header, as in "alert" or
+	// "background".
+	PushType string
+
+	// CollapseID is the apns-collapse-id header.
+	CollapseID string
+
+	// Headers are other APNs headers.
+	Headers map[string]string
+
+	Payload *APNSPayload
+
+	// Image is the URL of an image shown in the notification.
+	Image          string
+	AnalyticsLabel string
+}
+
+// An APNSPayload is the payload of an APNs notification.
+type APNSPayload struct {
+	Aps Aps
+
+	// Custom holds the keys of the payload besides "aps".
+	Custom map[string]interface{}
+}
+
+// Aps is the "aps" dictionary of an APNs payload.
+type Aps struct {
+	// Alert is the alert shown to the user; AlertText is a shorthand for
+	// an alert with only a body.
+	Alert     *ApsAlert
+	AlertText string
+
+	// Badge, if non-nil, is the number shown on the app icon. Zero removes
+	// the badge.
+	Badge *int
+
+	Sound            string
+	ContentAvailable bool
+	MutableContent   bool
+	Category         string
+	ThreadID         string
+}
+
+// An ApsAlert is the alert of an APNs notification.
+type ApsAlert struct {
+	Title        string   `json:"title,omitempty"`
+	Subtitle     string   `json:"subtitle,omitempty"`
+	Body         string   `json:"body,omitempty"`
+	LaunchImage  string   `json:"launch-image,omitempty"`
+	TitleLocKey  string   `json:"title-loc-key,omitempty"`
+	TitleLocArgs []string `json:"title-loc-args,omitempty"`
+	LocKey       string   `json:"loc-key,omitempty"`
+	LocArgs      []string `json:"loc-args,omitempty"`
+}
+
+// MarshalJSON encodes p with the keys of the APNs payload.
+func (p *APNSPayload) MarshalJSON() ([]byte, error) {
+	aps := map[string]interface{}{}
+	switch {
+	case p.Aps.Alert != nil && p.Aps.AlertText != "":
+		return nil, errors.New("fcmutil: both Alert and AlertText are set")
+	case p.Aps.Alert != nil:
+		aps["alert"] = p.Aps.Alert
+	case p.Aps.AlertText != "":
+		aps["alert"] = p.Aps.AlertText
+	}
+	if p.Aps.Badge != nil {
+		aps["badge"] = *p.Aps.Badge
+	}
+	if p.Aps.Sound != "" {
+		aps["sound"] = p.Aps.Sound
+	}
+	if p.Aps.ContentAvailable {
+		aps["content-available"] = 1
+	}
+	if p.Aps.MutableContent {
+		aps["mutable-content"] = 1
+	}
+	if p.Aps.Category != "" {
+		aps["category"] = p.Aps.Category
+	}
+	if p.Aps.ThreadID != "" {
+		aps["thread-id"] = p.Aps.ThreadID
+	}
+	m := map[string]interface{}{"aps": aps}
+	for k, v := range p.Custom {
+		if k == "aps" {
+			return nil, errors.New(`fcmutil: custom payload key "aps"`)
+		}
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// Config returns the ApnsConfig of a.
+func (a *APNS) Config() (*fcm.ApnsConfig, error) {
+	c := &fcm.ApnsConfig{}
+	headers := map[string]string{}
+	for k, v := range a.Headers {
+		headers[k] = v
+	}
+	if a.Priority != 0 {
+		headers["apns-priority"] = strconv.Itoa(a.Priority)
+	}
+	if !a.Expiration.IsZero() {
+		headers["apns-expiration"] = strconv.FormatInt(a.Expiration.Unix(), 10)
+	}
+	if a.PushType != "" {
+		headers["apns-push-type"] = a.PushType
+	}
+	if a.CollapseID != "" {
+		headers["apns-collapse-id"] = a.CollapseID
+	}
+	if len(headers) > 0 {
+		c.Headers = headers
+	}
+	if a.Payload != nil {
+		b, err := json.Marshal(a.Payload)
+		if err != nil {
+			return nil, err
+		}
+		c.Payload = b
+	}
+	if a.Image != "" || a.AnalyticsLabel != "" {
+		c.FcmOptions = &fcm.ApnsFcmOptions{Image: a.Image, AnalyticsLabel: a.AnalyticsLabel}
+	}
+	return c, nil
+}
+
+// Webpush holds the Web Push options of a message.
+type Webpush struct {
+	// TTL is the TTL header: how long the push service keeps the message
+	// while the browser is offline. Zero leaves it unset.
+	TTL time.Duration
+
+	// Urgency is the Urgency header: "very-low", "low", "normal" or
+	// "high".
+	Urgency string
+
+	// Headers are other Web Push headers.
+	Headers map[string]string
+
+	Data         map[string]string
+	Notification *WebpushNotification
+
+	// Link is the URL opened when the user clicks the notification. It
+	// must use HTTPS.
+	Link           string
+	AnalyticsLabel string
+}
+
+// A WebpushNotification holds the options of a Web Notification.
+type WebpushNotification struct {
+	Title              string                 `json:"title,omitempty"`
+	Body               string                 `json:"body,omitempty"`
+	Icon               string                 `json:"icon,omitempty"`
+	Image              string                 `json:"image,omitempty"`
+	Badge              string                 `json:"badge,omitempty"`
+	Tag                string                 `json:"tag,omitempty"`
+	Lang               string                 `json:"lang,omitempty"`
+	Dir                string                 `json:"dir,omitempty"`
+	Renotify           bool                   `json:"renotify,omitempty"`
+	RequireInteraction bool                   `json:"requireInteraction,omitempty"`
+	Silent             bool                   `json:"silent,omitempty"`
+	Timestamp          int64                  `json:"timestamp,omitempty"` // in milliseconds since the epoch
+	Vibrate            []int                  `json:"vibrate,omitempty"`
+	Actions            []*WebpushAction       `json:"actions,omitempty"`
+	Data               map[string]interface{} `json:"data,omitempty"`
+}
+
+// A WebpushAction is an action button of a Web Notification.
+type WebpushAction struct {
+	Action string `json:"action"`
+	Title  string `json:"title"`
+	Icon   string `json:"icon,omitempty"`
+}
+
+// Config returns the WebpushConfig of w.
+func (w *Webpush) Config() (*fcm.WebpushConfig, error) {
+	c := &fcm.WebpushConfig{Data: w.Data}
+	headers := map[string]string{}
+	for k, v := range w.Headers {
+		headers[k] = v
+	}
+	if w.TTL > 0 {
+		headers["TTL"] = strconv.FormatInt(int64(w.TTL/time.Second), 10)
+	}
+	if w.Urgency != "" {
+		switch w.Urgency {
+		case "very-low", "low", "normal", "high":
+		default:
+			return nil, fmt.Errorf("fcmutil: bad Web Push urgency %q", w.Urgency)
+		}
+		headers["Urgency"] = w.Urgency
+	}
+	if len(headers) > 0 {
+		c.Headers = headers
+	}
+	if w.Notification != nil {
+		b, err := json.Marshal(w.Notification)
+		if err != nil {
+			return nil, fmt.Errorf("fcmutil: %v", err)
+		}
+		c.Notification = b
+	}
+	if w.Link != "" || w.AnalyticsLabel != "" {
+		c.FcmOptions = &fcm.WebpushFcmOptions{Link: w.Link, AnalyticsLabel: w.AnalyticsLabel}
+	}
+	return c, nil
+}
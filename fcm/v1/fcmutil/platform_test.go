@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fcmutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	fcm "google.golang.org/api/fcm/v1"
+)
+
+func TestAndroidConfig(t *testing.T) {
+	for _, test := range []struct {
+		in   Android
+		want *fcm.AndroidConfig
+	}{
+		{Android{}, &fcm.AndroidConfig{}},
+		{
+			Android{Priority: "HIGH", TTL: 3500 * time.Millisecond, CollapseKey: "c", AnalyticsLabel: "l"},
+			&fcm.AndroidConfig{Priority: "HIGH", Ttl: "3.5s", CollapseKey: "c", FcmOptions: &fcm.AndroidFcmOptions{AnalyticsLabel: "l"}},
+		},
+		{Android{SendNow: true}, &fcm.AndroidConfig{Ttl: "0s"}},
+	} {
+		if diff := cmp.Diff(test.want, test.in.Config()); diff != "" {
+			t.Errorf("%+v: mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+}
+
+// jsonEqual checks that got and want are equal JSON values.
+func jsonEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(w, g); diff != "" {
+		t.Errorf("JSON mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAPNSConfig(t *testing.T) {
+	badge := 0
+	a := &APNS{
+		Priority:   10,
+		Expiration: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		PushType:   "alert",
+		CollapseID: "c",
+		Headers:    map[string]string{"apns-topic": "com.example.app"},
+		Payload: &APNSPayload{
+			Aps: Aps{
+				Alert:          &ApsAlert{Title: "t", Body: "b", LocArgs: []string{"x"}},
+				Badge:          &badge,
+				Sound:          "default",
+				MutableContent: true,
+				ThreadID:       "th",
+			},
+			Custom: map[string]interface{}{"id": 7},
+		},
+		Image: "https://example.com/i.png",
+	}
+	c, err := a.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeaders := map[string]string{
+		"apns-topic":       "com.example.app",
+		"apns-priority":    "10",
+		"apns-expiration":  "1577934245",
+		"apns-push-type":   "alert",
+		"apns-collapse-id": "c",
+	}
+	if diff := cmp.Diff(wantHeaders, c.Headers); diff != "" {
+		t.Errorf("headers mismatch (-want +got):\n%s", diff)
+	}
+	jsonEqual(t, c.Payload, `{
+		"aps": {
+			"alert": {"title": "t", "body": "b", "loc-args": ["x"]},
+			"badge": 0,
+			"sound": "default",
+			"mutable-content": 1,
+			"thread-id": "th"
+		},
+		"id": 7
+	}`)
+	if got := c.FcmOptions; got == nil || got.Image != a.Image {
+		t.Errorf("got FcmOptions %+v, want image %q", got, a.Image)
+	}
+
+	c, err = (&APNS{Payload: &APNSPayload{Aps: Aps{AlertText: "hi", ContentAvailable: true}}}).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Headers != nil {
+		t.Errorf("got headers %v, want none", c.Headers)
+	}
+	jsonEqual(t, c.Payload, `{"aps": {"alert": "hi", "content-available": 1}}`)
+
+	for _, p := range []*APNSPayload{
+		{Aps: Aps{Alert: &ApsAlert{}, AlertText: "hi"}},
+		{Custom: map[string]interface{}{"aps": 1}},
+	} {
+		if _, err := (&APNS{Payload: p}).Config(); err == nil {
+			t.Errorf("%+v: got nil error", p)
+		}
+	}
+}
+
+func TestWebpushConfig(t *testing.T) {
+	w := &Webpush{
+		TTL:     90 * time.Second,
+		Urgency: "high",
+		Data:    map[string]string{"k": "v"},
+		Notification: &WebpushNotification{
+			Title:   "t",
+			Body:    "b",
+			Vibrate: []int{100, 50},
+			Actions: []*WebpushAction{{Action: "open", Title: "Open"}},
+		},
+		Link: "https://example.com",
+	}
+	c, err := w.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"TTL": "90", "Urgency": "high"}, c.Headers); diff != "" {
+		t.Errorf("headers mismatch (-want +got):\n%s", diff)
+	}
+	jsonEqual(t, c.Notification, `{"title": "t", "body": "b", "vibrate": [100, 50], "actions": [{"action": "open", "title": "Open"}]}`)
+	if got := c.FcmOptions; got == nil || got.Link != w.Link {
+		t.Errorf("got FcmOptions %+v, want link %q", got, w.Link)
+	}
+	if _, err := (&Webpush{Urgency: "urgent"}).Config(); err == nil {
+		t.Error("bad urgency: got nil error")
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fcmutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/semaphore"
+	fcm "google.golang.org/api/fcm/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/retry"
+)
+
+const (
+	// DefaultConcurrency is the default number of messages a Sender sends
+	// at the same time.
+	DefaultConcurrency = 10
+
+	// DefaultMaxAttempts is the default number of times a Sender tries to
+	// send a message that fails with a retryable error.
+	DefaultMaxAttempts = 5
+)
+
+// fcmErrorType is the type of the error details that hold FCM error codes.
+const fcmErrorType = "type.googleapis.com/google.firebase.fcm.v1.FcmError"
+
+// A Class classifies the result of sending a message to a token.
+type Class int
+
+const (
+	// OK means the message was sent.
+	OK Class = iota
+
+	// Retryable means the message was not sent because of an error that
+	// may not recur, such as an exceeded quota or an unavailable server.
+	Retryable
+
+	// InvalidToken means the token is not, or no longer, a valid
+	// registration token for the project. It should not be used again.
+	InvalidToken
+
+	// Permanent means the message was not sent because of an error that
+	// will recur, such as an invalid message.
+	Permanent
+)
+
+func (c Class) String() string {
+	switch c {
+	case OK:
+		return "OK"
+	case Retryable:
+		return "Retryable"
+	case InvalidToken:
+		return "InvalidToken"
+	case Permanent:
+		return "Permanent"
+	}
+	return "Class(" + strconv.Itoa(int(c)) + ")"
+}
+
+// A Result is the result of sending a message to a token.
+type Result struct {
+	Token string
+
+	// Name is the name FCM assigned to the message, as in
+	// "projects/p/messages/0:1500415314455276%31bd1c9631bd1c96". It is
+	// empty if the message was not sent.
+	Name string
+
+	Class Class
+
+	// Err is the last error of sending the message, or nil if it was sent.
+	Err error
+
+	// ErrorCode is the FCM error code of Err, as in "UNREGISTERED", or the
+	// canonical status of the error if FCM gave no code. It is empty if Err
+	// is not an error returned by FCM.
+	ErrorCode string
+}
+
+// A Sender sends a message to many registration tokens with the Send method
+// of the FCM v1 API, which takes one token per request.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Send.
+type Sender struct {
+	// Concurrency is the maximum number of requests in flight. The default
+	// is DefaultConcurrency.
+	Concurrency int
+
+	// MaxAttempts is the number of times a message that fails with a
+	// retryable error is tried before giving up. The default is
+	// DefaultMaxAttempts.
+	MaxAttempts int
+
+	// Backoff controls the pauses between retries. A longer pause asked for
+	// by the Retry-After header of a response is honored.
+	Backoff gax.Backoff
+
+	// ValidateOnly makes FCM validate the messages without delivering
+	// them.
+	ValidateOnly bool
+
+	svc    *fcm.Service
+	parent string
+}
+
+// NewSender returns a Sender for the project with the given name, as in
+// "projects/my-project".
+func NewSender(svc *fcm.Service, project string) *Sender {
+	return &Sender{
+		Concurrency: DefaultConcurrency,
+		MaxAttempts: DefaultMaxAttempts,
+		svc:         svc,
+		parent:      project,
+	}
+}
+
+// Send sends msg to each of tokens, retrying retryable errors, and returns
+// the results in the order of tokens. msg is a template: its Token field is
+// set to each token in turn, and it must not have a topic or condition.
+//
+// Send returns an error only if msg is not a valid template. If ctx is done
+// before all messages are sent, the results of the messages not sent have
+// the error of ctx and are Retryable.
+func (s *Sender) Send(ctx context.Context, msg *fcm.Message, tokens []string) ([]*Result, error) {
+	if msg.Token != "" || msg.Topic != "" || msg.Condition != "" {
+		return nil, errors.New("fcmutil: message template has a token, topic or condition")
+	}
+	results := make([]*Result, len(tokens))
+	n := s.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	sem := semaphore.NewWeighted(int64(n))
+	var wg sync.WaitGroup
+	for i, tok := range tokens {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			for j := i; j < len(tokens); j++ {
+				results[j] = &Result{Token: tokens[j], Class: Retryable, Err: err}
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int, tok string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			results[i] = s.sendOne(ctx, msg, tok)
+		}(i, tok)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// sendOne sends a copy of msg to tok.
+func (s *Sender) sendOne(ctx context.Context, msg *fcm.Message, tok string) *Result {
+	m := *msg
+	m.Token = tok
+	req := &fcm.SendMessageRequest{Message: &m, ValidateOnly: s.ValidateOnly}
+	maxAttempts := s.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	bo := s.Backoff
+	for attempt := 1; ; attempt++ {
+		sent, err := s.svc.Projects.Messages.Send(s.parent, req).Context(ctx).Do()
+		if err == nil {
+			return &Result{Token: tok, Name: sent.Name, Class: OK}
+		}
+		res := &Result{Token: tok, Err: err}
+		res.Class, res.ErrorCode = classify(err)
+		if ctx.Err() != nil {
+			res.Class = Retryable
+			return res
+		}
+		if res.Class != Retryable || attempt >= maxAttempts {
+			return res
+		}
+		pause := bo.Pause()
+		if d, ok := retryAfter(err, time.Now()); ok && d > pause {
+			pause = d
+		}
+		if err := gax.Sleep(ctx, pause); err != nil {
+			return res
+		}
+	}
+}
+
+// InvalidTokens returns the tokens of the results that are InvalidToken,
+// which should be removed from the application's records.
+func InvalidTokens(results []*Result) []string {
+	var toks []string
+	for _, r := range results {
+		if r.Class == InvalidToken {
+			toks = append(toks, r.Token)
+		}
+	}
+	return toks
+}
+
+// errorReply is the body of an error response, with the error details
+// googleapi.Error does not keep.
+type errorReply struct {
+	Error struct {
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// classify returns the class of err and its FCM error code.
+func classify(err error) (Class, string) {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		if retry.Transient(err) {
+			return Retryable, ""
+		}
+		return Permanent, ""
+	}
+	var reply errorReply
+	json.Unmarshal([]byte(e.Body), &reply)
+	code := reply.Error.Status
+	for _, d := range reply.Error.Details {
+		if d.Type == fcmErrorType && d.ErrorCode != "" {
+			code = d.ErrorCode
+			break
+		}
+	}
+	switch code {
+	case "UNREGISTERED", "SENDER_ID_MISMATCH":
+		return InvalidToken, code
+	case "INVALID_ARGUMENT":
+		// FCM reports malformed tokens as invalid arguments, telling them
+		// from other invalid fields only in the message.
+		if strings.Contains(strings.ToLower(e.Message), "registration token") {
+			return InvalidToken, code
+		}
+		return Permanent, code
+	case "QUOTA_EXCEEDED", "UNAVAILABLE", "INTERNAL":
+		return Retryable, code
+	}
+	if retry.Transient(err) {
+		return Retryable, code
+	}
+	return Permanent, code
+}
+
+// retryAfter returns the pause asked for by the Retry-After header of the
+// response of err, in seconds or as an HTTP date.
+func retryAfter(err error, now time.Time) (time.Duration, bool) {
+	e, ok := err.(*googleapi.Error)
+	if !ok || e.Header == nil {
+		return 0, false
+	}
+	v := e.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fcmutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	fcm "google.golang.org/api/fcm/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/testserver"
+)
+
+// fakeFCM serves Send for project "p". The token of a message selects the
+// response:
+//
+//	"unregistered"  UNREGISTERED
+//	"malformed"     INVALID_ARGUMENT about the registration token
+//	"bad-message"   INVALID_ARGUMENT about the message
+//	"quota"         QUOTA_EXCEEDED with Retry-After on the first attempt
+//	"unavailable"   UNAVAILABLE on every attempt
+//
+// and other tokens succeed.
+type fakeFCM struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	inFlight int
+	maxIn    int
+}
+
+func (f *fakeFCM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/projects/p/messages:send" {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req fcm.SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tok := req.Message.Token
+	f.mu.Lock()
+	f.attempts[tok]++
+	attempt := f.attempts[tok]
+	f.inFlight++
+	if f.inFlight > f.maxIn {
+		f.maxIn = f.inFlight
+	}
+	f.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	switch {
+	case tok == "unregistered":
+		writeError(w, 404, "NOT_FOUND", "UNREGISTERED", "Requested entity was not found.")
+	case tok == "malformed":
+		writeError(w, 400, "INVALID_ARGUMENT", "INVALID_ARGUMENT", "The registration token is not a valid FCM registration token")
+	case tok == "bad-message":
+		writeError(w, 400, "INVALID_ARGUMENT", "INVALID_ARGUMENT", "Invalid value at 'message.android.ttl'")
+	case tok == "quota" && attempt == 1:
+		w.Header().Set("Retry-After", "0")
+		writeError(w, 429, "RESOURCE_EXHAUSTED", "QUOTA_EXCEEDED", "Quota exceeded.")
+	case tok == "unavailable":
+		writeError(w, 503, "UNAVAILABLE", "UNAVAILABLE", "The service is currently unavailable.")
+	default:
+		fmt.Fprintf(w, `{"name": "projects/p/messages/%s"}`, tok)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, status, fcmCode, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": %q, "status": %q, "details": [{"@type": %q, "errorCode": %q}]}}`,
+		code, msg, status, fcmErrorType, fcmCode)
+}
+
+func TestSend(t *testing.T) {
+	f := &fakeFCM{attempts: map[string]int{}}
+	svc, done := testserver.NewService(t, f, fcm.NewService)
+	defer done()
+	s := NewSender(svc.(*fcm.Service), "projects/p")
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	s.MaxAttempts = 3
+	tokens := []string{"a", "unregistered", "malformed", "bad-message", "quota", "unavailable", "b"}
+	results, err := s.Send(context.Background(), &fcm.Message{Data: map[string]string{"k": "v"}}, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		Token, Name, Code string
+		Class             Class
+	}
+	var got []summary
+	for _, r := range results {
+		if (r.Err == nil) != (r.Class == OK) {
+			t.Errorf("%s: class %v with error %v", r.Token, r.Class, r.Err)
+		}
+		got = append(got, summary{r.Token, r.Name, r.ErrorCode, r.Class})
+	}
+	want := []summary{
+		{"a", "projects/p/messages/a", "", OK},
+		{"unregistered", "", "UNREGISTERED", InvalidToken},
+		{"malformed", "", "INVALID_ARGUMENT", InvalidToken},
+		{"bad-message", "", "INVALID_ARGUMENT", Permanent},
+		{"quota", "projects/p/messages/quota", "", OK},
+		{"unavailable", "", "UNAVAILABLE", Retryable},
+		{"b", "projects/p/messages/b", "", OK},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	wantAttempts := map[string]int{
+		"a": 1, "unregistered": 1, "malformed": 1, "bad-message": 1,
+		"quota": 2, "unavailable": 3, "b": 1,
+	}
+	if diff := cmp.Diff(wantAttempts, f.attempts); diff != "" {
+		t.Errorf("attempts mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"unregistered", "malformed"}, InvalidTokens(results)); diff != "" {
+		t.Errorf("InvalidTokens mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSendConcurrency(t *testing.T) {
+	f := &fakeFCM{attempts: map[string]int{}}
+	svc, done := testserver.NewService(t, f, fcm.NewService)
+	defer done()
+	s := NewSender(svc.(*fcm.Service), "projects/p")
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	s.Concurrency = 3
+	var tokens []string
+	for i := 0; i < 20; i++ {
+		tokens = append(tokens, fmt.Sprint("t", i))
+	}
+	results, err := s.Send(context.Background(), &fcm.Message{}, tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r.Token != tokens[i] || r.Class != OK {
+			t.Errorf("result %d: got %+v", i, r)
+		}
+	}
+	if f.maxIn > 3 {
+		t.Errorf("got %d requests in flight, want at most 3", f.maxIn)
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	s := NewSender(nil, "projects/p")
+	for _, m := range []*fcm.Message{{Token: "t"}, {Topic: "news"}, {Condition: "'a' in topics"}} {
+		if _, err := s.Send(context.Background(), m, []string{"x"}); err == nil {
+			t.Errorf("%+v: got nil error", m)
+		}
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	f := &fakeFCM{attempts: map[string]int{}}
+	svc, done := testserver.NewService(t, f, fcm.NewService)
+	defer done()
+	s := NewSender(svc.(*fcm.Service), "projects/p")
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := s.Send(ctx, &fcm.Message{}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Class != Retryable || r.Err == nil {
+			t.Errorf("%s: got class %v, error %v; want Retryable with error", r.Token, r.Class, r.Err)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, test := range []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{"Thu, 02 Jan 2020 03:05:05 GMT", time.Minute, true},
+		{"Thu, 02 Jan 2020 03:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	} {
+		err := &googleapi.Error{Code: 429, Header: http.Header{}}
+		if test.header != "" {
+			err.Header.Set("Retry-After", test.header)
+		}
+		got, ok := retryAfter(err, now)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%q: got %v, %t; want %v, %t", test.header, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		wantClass Class
+		wantCode  string
+	}{
+		{&googleapi.Error{Code: 500}, Retryable, ""},
+		{&googleapi.Error{Code: 403, Body: `{"error": {"status": "PERMISSION_DENIED"}}`}, Permanent, "PERMISSION_DENIED"},
+		{&googleapi.Error{Code: 404, Body: `{"error": {"status": "NOT_FOUND", "details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "SENDER_ID_MISMATCH"}]}}`}, InvalidToken, "SENDER_ID_MISMATCH"},
+		{&googleapi.Error{Code: 500, Body: `{"error": {"status": "INTERNAL"}}`}, Retryable, "INTERNAL"},
+		{fmt.Errorf("other"), Permanent, ""},
+	} {
+		class, code := classify(test.err)
+		if class != test.wantClass || code != test.wantCode {
+			t.Errorf("%v: got %v, %q; want %v, %q", test.err, class, code, test.wantClass, test.wantCode)
+		}
+	}
+}
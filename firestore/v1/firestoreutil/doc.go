@@ -0,0 +1,36 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package firestoreutil provides helpers for using the Cloud Firestore REST
+// API (google.golang.org/api/firestore/v1).
+//
+// EncodeFields and DecodeFields convert between Go structs or maps and
+// document fields, and EncodeValue and DecodeValue between Go values and
+// single Values:
+//
+//	type City struct {
+//		Name       string    `firestore:"name"`
+//		Population int64     `firestore:"population,omitempty"`
+//		Updated    time.Time `firestore:"updated,serverTimestamp"`
+//	}
+//
+//	doc, err := svc.Projects.Databases.Documents.Get(name).Do()
+//	...
+//	var c City
+//	err = firestoreutil.DecodeDocument(doc, &c)
+//
+// SetWrites, MergeWrites, UpdateWrites and DeleteWrite build the writes to
+// pass to Commit, including update masks and the field transforms requested
+// by ServerTimestamp, Increment and the other transform values:
+//
+//	writes, err := firestoreutil.UpdateWrites(name,
+//		firestoreutil.Update{Path: "population", Value: firestoreutil.Increment(1)},
+//		firestoreutil.Update{Path: "mayor", Value: firestoreutil.DeleteField})
+//	...
+//	_, err = svc.Projects.Databases.Documents.Commit(db, &firestore.CommitRequest{Writes: writes}).Do()
+//
+// Query builds the StructuredQuery of a RunQuery request.
+//
+// This package is experimental and subject to change without notice.
+package firestoreutil
@@ -0,0 +1,259 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package firestoreutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	firestore "google.golang.org/api/firestore/v1"
+)
+
+// Direction is the sort direction of a query's order.
+type Direction string
+
+// Sort directions.
+const (
+	Asc  Direction = "ASCENDING"
+	Desc Direction = "DESCENDING"
+)
+
+// fieldOps maps the operators accepted by Query.Where to FieldFilter
+// operators.
+var fieldOps = map[string]string{
+	"<":                  "LESS_THAN",
+	"<=":                 "LESS_THAN_OR_EQUAL",
+	">":                  "GREATER_THAN",
+	">=":                 "GREATER_THAN_OR_EQUAL",
+	"==":                 "EQUAL",
+	"array-contains":     "ARRAY_CONTAINS",
+	"in":                 "IN",
+	"array-contains-any": "ARRAY_CONTAINS_ANY",
+}
+
+// A Query builds a StructuredQuery for Documents.RunQuery. Its methods
+// return modified copies, so a Query can be used as the base of several
+// queries:
+//
+//	base := firestoreutil.NewQuery("cities").Where("country", "==", "JP")
+//	q, err := base.OrderBy("population", firestoreutil.Desc).Limit(10).StructuredQuery()
+//
+// The first error found while building the query is returned by
+// StructuredQuery.
+type Query struct {
+	from    []*firestore.CollectionSelector
+	filters []*firestore.Filter
+	orders  []*firestore.Order
+	sel     *firestore.Projection
+	startAt *firestore.Cursor
+	endAt   *firestore.Cursor
+	limit   int64
+	offset  int64
+	err     error
+}
+
+// NewQuery returns a query of the documents of the collections with the
+// given ID that are directly under the parent passed to RunQuery.
+func NewQuery(collectionID string) Query {
+	return Query{from: []*firestore.CollectionSelector{{CollectionId: collectionID}}}
+}
+
+// NewCollectionGroupQuery returns a query of the documents of all
+// collections with the given ID that are under the parent passed to
+// RunQuery, at any depth.
+func NewCollectionGroupQuery(collectionID string) Query {
+	return Query{from: []*firestore.CollectionSelector{{CollectionId: collectionID, AllDescendants: true}}}
+}
+
+// Where returns a query that only matches documents whose field at path, a
+// field path as built by FieldPath, compares to value with op, one of "<",
+// "<=", ">", ">=", "==", "array-contains", "in" and "array-contains-any".
+// Comparing with "==" to nil or NaN matches null and NaN fields.
+// Where conditions are combined with AND.
+func (q Query) Where(path, op string, value interface{}) Query {
+	if q.err != nil {
+		return q
+	}
+	ref, err := fieldRef(path)
+	if err != nil {
+		return q.fail(err)
+	}
+	var f *firestore.Filter
+	if op == "==" && isNullOrNaN(value) {
+		uop := "IS_NULL"
+		if value != nil {
+			uop = "IS_NAN"
+		}
+		f = &firestore.Filter{UnaryFilter: &firestore.UnaryFilter{Field: ref, Op: uop}}
+	} else {
+		fop, ok := fieldOps[op]
+		if !ok {
+			return q.fail(fmt.Errorf("firestoreutil: unknown operator %q", op))
+		}
+		val, err := EncodeValue(value)
+		if err != nil {
+			return q.fail(err)
+		}
+		if (fop == "IN" || fop == "ARRAY_CONTAINS_ANY") && val.ArrayValue == nil {
+			return q.fail(fmt.Errorf("firestoreutil: operator %q needs a slice", op))
+		}
+		f = &firestore.Filter{FieldFilter: &firestore.FieldFilter{Field: ref, Op: fop, Value: val}}
+	}
+	q.filters = append(q.filters[:len(q.filters):len(q.filters)], f)
+	return q
+}
+
+func isNullOrNaN(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case float64:
+		return math.IsNaN(x)
+	case float32:
+		return math.IsNaN(float64(x))
+	}
+	return false
+}
+
+// OrderBy returns a query whose results are also sorted by the field at
+// path.
+func (q Query) OrderBy(path string, dir Direction) Query {
+	if q.err != nil {
+		return q
+	}
+	ref, err := fieldRef(path)
+	if err != nil {
+		return q.fail(err)
+	}
+	if dir != Asc && dir != Desc {
+		return q.fail(fmt.Errorf("firestoreutil: bad direction %q", dir))
+	}
+	q.orders = append(q.orders[:len(q.orders):len(q.orders)], &firestore.Order{Field: ref, Direction: string(dir)})
+	return q
+}
+
+// Select returns a query that only returns the fields at the paths.
+func (q Query) Select(paths ...string) Query {
+	if q.err != nil {
+		return q
+	}
+	p := &firestore.Projection{}
+	for _, path := range paths {
+		ref, err := fieldRef(path)
+		if err != nil {
+			return q.fail(err)
+		}
+		p.Fields = append(p.Fields, ref)
+	}
+	if len(p.Fields) == 0 {
+		// An empty projection returns only the document names.
+		p.Fields = []*firestore.FieldReference{{FieldPath: "__name__"}}
+	}
+	q.sel = p
+	return q
+}
+
+// Limit returns a query that returns at most n documents.
+func (q Query) Limit(n int) Query {
+	q.limit = int64(n)
+	return q
+}
+
+// Offset returns a query that skips the first n documents.
+func (q Query) Offset(n int) Query {
+	q.offset = int64(n)
+	return q
+}
+
+// StartAt returns a query that starts at the document with the given values
+// of the fields it is ordered by.
+func (q Query) StartAt(values ...interface{}) Query {
+	return q.cursor(true, true, values)
+}
+
+// StartAfter returns a query that starts after the document with the given
+// values of the fields it is ordered by.
+func (q Query) StartAfter(values ...interface{}) Query {
+	return q.cursor(true, false, values)
+}
+
+// EndAt returns a query that ends at the document with the given values of
+// the fields it is ordered by.
+func (q Query) EndAt(values ...interface{}) Query {
+	return q.cursor(false, false, values)
+}
+
+// EndBefore returns a query that ends before the document with the given
+// values of the fields it is ordered by.
+func (q Query) EndBefore(values ...interface{}) Query {
+	return q.cursor(false, true, values)
+}
+
+func (q Query) cursor(start, before bool, values []interface{}) Query {
+	if q.err != nil {
+		return q
+	}
+	if len(values) == 0 {
+		return q.fail(errors.New("firestoreutil: cursor needs values"))
+	}
+	cur := &firestore.Cursor{Before: before}
+	for _, v := range values {
+		val, err := EncodeValue(v)
+		if err != nil {
+			return q.fail(err)
+		}
+		cur.Values = append(cur.Values, val)
+	}
+	if start {
+		q.startAt = cur
+	} else {
+		q.endAt = cur
+	}
+	return q
+}
+
+func (q Query) fail(err error) Query {
+	q.err = err
+	return q
+}
+
+// StructuredQuery returns the query to pass in RunQueryRequest, or the
+// first error found while building it.
+func (q Query) StructuredQuery() (*firestore.StructuredQuery, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	for _, c := range []*firestore.Cursor{q.startAt, q.endAt} {
+		if c != nil && len(c.Values) > len(q.orders) {
+			return nil, fmt.Errorf("firestoreutil: cursor has %d values, but query has %d orders", len(c.Values), len(q.orders))
+		}
+	}
+	sq := &firestore.StructuredQuery{
+		From:    q.from,
+		OrderBy: q.orders,
+		Select:  q.sel,
+		StartAt: q.startAt,
+		EndAt:   q.endAt,
+		Limit:   q.limit,
+		Offset:  q.offset,
+	}
+	switch len(q.filters) {
+	case 0:
+	case 1:
+		sq.Where = q.filters[0]
+	default:
+		sq.Where = &firestore.Filter{CompositeFilter: &firestore.CompositeFilter{Op: "AND", Filters: q.filters}}
+	}
+	return sq, nil
+}
+
+func fieldRef(path string) (*firestore.FieldReference, error) {
+	parts, err := ParseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &firestore.FieldReference{FieldPath: FieldPath(parts...)}, nil
+}
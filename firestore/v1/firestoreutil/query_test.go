@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package firestoreutil
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	firestore "google.golang.org/api/firestore/v1"
+)
+
+func ref(path string) *firestore.FieldReference {
+	return &firestore.FieldReference{FieldPath: path}
+}
+
+func TestQuery(t *testing.T) {
+	base := NewQuery("cities").Where("country", "==", "JP")
+	q := base.Where("pop", ">", 1000).
+		Where("deleted", "==", nil).
+		OrderBy("pop", Desc).
+		Select("name", "a b").
+		StartAfter(5000).
+		Limit(10).
+		Offset(2)
+	got, err := q.StructuredQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &firestore.StructuredQuery{
+		From: []*firestore.CollectionSelector{{CollectionId: "cities"}},
+		Where: &firestore.Filter{CompositeFilter: &firestore.CompositeFilter{Op: "AND", Filters: []*firestore.Filter{
+			{FieldFilter: &firestore.FieldFilter{Field: ref("country"), Op: "EQUAL", Value: &firestore.Value{StringValue: "JP", ForceSendFields: []string{"StringValue"}}}},
+			{FieldFilter: &firestore.FieldFilter{Field: ref("pop"), Op: "GREATER_THAN", Value: integer(1000)}},
+			{UnaryFilter: &firestore.UnaryFilter{Field: ref("deleted"), Op: "IS_NULL"}},
+		}}},
+		OrderBy: []*firestore.Order{{Field: ref("pop"), Direction: "DESCENDING"}},
+		Select:  &firestore.Projection{Fields: []*firestore.FieldReference{ref("name"), ref("`a b`")}},
+		StartAt: &firestore.Cursor{Values: []*firestore.Value{integer(5000)}},
+		Limit:   10,
+		Offset:  2,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// The base query is not changed.
+	got, err = base.StructuredQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Where.FieldFilter == nil || got.OrderBy != nil || got.Limit != 0 {
+		t.Errorf("base query changed: %+v", got)
+	}
+}
+
+func TestQueryUnaryAndGroup(t *testing.T) {
+	got, err := NewCollectionGroupQuery("landmarks").Where("score", "==", math.NaN()).StructuredQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &firestore.StructuredQuery{
+		From:  []*firestore.CollectionSelector{{CollectionId: "landmarks", AllDescendants: true}},
+		Where: &firestore.Filter{UnaryFilter: &firestore.UnaryFilter{Field: ref("score"), Op: "IS_NAN"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	q := NewQuery("c")
+	for _, bad := range []Query{
+		q.Where("a", "!=", 1),
+		q.Where("a..b", "==", 1),
+		q.Where("a", "in", 1),
+		q.Where("a", "==", ServerTimestamp),
+		q.OrderBy("a", "sideways"),
+		q.Select("`"),
+		q.StartAt(),
+		q.OrderBy("a", Asc).EndAt(1, 2),
+		q.Where("a", "!=", 1).OrderBy("b", Asc),
+	} {
+		if _, err := bad.StructuredQuery(); err == nil {
+			t.Errorf("%+v: got nil, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,691 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package firestoreutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	firestore "google.golang.org/api/firestore/v1"
+)
+
+// A Reference is the full resource name of a document, as in
+// "projects/p/databases/(default)/documents/users/alice". Values of type
+// Reference are stored as reference values.
+type Reference string
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	latLngType    = reflect.TypeOf(firestore.LatLng{})
+	referenceType = reflect.TypeOf(Reference(""))
+	valueType     = reflect.TypeOf(firestore.Value{})
+	bytesType     = reflect.TypeOf([]byte(nil))
+)
+
+// A field is an exported struct field that maps to a document field.
+type field struct {
+	name            string
+	index           []int
+	omitEmpty       bool
+	serverTimestamp bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the fields of struct type t. Fields are named by a
+// "firestore" tag, or by the Go field name. The tag may also have the
+// options "omitempty" and "serverTimestamp"; a field tagged "-" is ignored.
+func structFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		tag := sf.Tag.Get("firestore")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := field{name: opts[0], index: sf.Index}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, o := range opts[1:] {
+			switch o {
+			case "omitempty":
+				f.omitEmpty = true
+			case "serverTimestamp":
+				f.serverTimestamp = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	fs, _ := fieldCache.LoadOrStore(t, fields)
+	return fs.([]field)
+}
+
+// EncodeValue converts a Go value into a Value:
+//
+//	nil, nil pointers, maps and slices  nullValue
+//	bool                                booleanValue
+//	signed and unsigned integers        integerValue
+//	float32, float64                    doubleValue
+//	string                              stringValue
+//	[]byte                              bytesValue
+//	time.Time                           timestampValue
+//	Reference                           referenceValue
+//	firestore.LatLng, *firestore.LatLng geoPointValue
+//	slices and arrays                   arrayValue
+//	maps with string keys, structs      mapValue
+//	firestore.Value, *firestore.Value   as is
+//
+// Struct fields are encoded as described for EncodeFields. Sentinel values
+// such as ServerTimestamp are not allowed.
+func EncodeValue(v interface{}) (*firestore.Value, error) {
+	e := &encoder{}
+	val, err := e.value(reflect.ValueOf(v), "")
+	if err != nil {
+		return nil, fmt.Errorf("firestoreutil: %v", err)
+	}
+	if len(e.transforms) > 0 || len(e.deletes) > 0 {
+		return nil, errors.New("firestoreutil: sentinel values are only allowed in writes")
+	}
+	return val, nil
+}
+
+// EncodeFields converts a struct, pointer to struct or map with string keys
+// into document fields.
+//
+// Struct fields are named by a "firestore" tag, or by their Go names. A
+// field tagged "-" is ignored, and a field with the "omitempty" option is
+// left out if it has its zero value. A time.Time field with the
+// "serverTimestamp" option is set to the commit time by the server if it is
+// zero; since that needs a field transform, such fields are only allowed in
+// the writes built by this package:
+//
+//	type City struct {
+//		Name       string    `firestore:"name"`
+//		Population int64     `firestore:"population,omitempty"`
+//		Updated    time.Time `firestore:"updated,serverTimestamp"`
+//		Cache      string    `firestore:"-"`
+//	}
+func EncodeFields(v interface{}) (map[string]firestore.Value, error) {
+	e := &encoder{}
+	fields, err := e.fields(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.transforms) > 0 || len(e.deletes) > 0 {
+		return nil, errors.New("firestoreutil: sentinel values are only allowed in writes")
+	}
+	return fields, nil
+}
+
+// An encoder converts Go values to Values, collecting the field transforms
+// and deletes requested by sentinel values on the way.
+type encoder struct {
+	transforms  []*firestore.FieldTransform
+	deletes     []string // field paths of DeleteField values
+	allowDelete bool
+}
+
+func (e *encoder) fields(v interface{}) (map[string]firestore.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !(rv.Kind() == reflect.Struct && rv.Type() != timeType && rv.Type() != latLngType) &&
+		!(rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String) {
+		return nil, fmt.Errorf("firestoreutil: cannot encode %T as document fields", v)
+	}
+	m, err := e.mapFields(rv, "")
+	if err != nil {
+		return nil, fmt.Errorf("firestoreutil: %v", err)
+	}
+	return m, nil
+}
+
+// value converts v, found at field path path, into a Value. It returns nil
+// for sentinels, which are recorded in e instead.
+func (e *encoder) value(v reflect.Value, path string) (*firestore.Value, error) {
+	if !v.IsValid() {
+		return nullValue(), nil
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nullValue(), nil
+		}
+	}
+	if v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case sentinel:
+			return nil, e.sentinel(x, path)
+		case *transform:
+			return nil, e.transform(x, path)
+		case firestore.Value:
+			return &x, nil
+		case *firestore.Value:
+			return x, nil
+		case *firestore.LatLng:
+			return &firestore.Value{GeoPointValue: x}, nil
+		}
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		return e.value(v.Elem(), path)
+	}
+
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		return &firestore.Value{TimestampValue: t.UTC().Format(time.RFC3339Nano)}, nil
+	case latLngType:
+		ll := v.Interface().(firestore.LatLng)
+		return &firestore.Value{GeoPointValue: &ll}, nil
+	case referenceType:
+		return &firestore.Value{ReferenceValue: v.String()}, nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return &firestore.Value{BooleanValue: v.Bool(), ForceSendFields: []string{"BooleanValue"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &firestore.Value{IntegerValue: v.Int(), ForceSendFields: []string{"IntegerValue"}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("%s: %d overflows int64", describe(path), u)
+		}
+		return &firestore.Value{IntegerValue: int64(u), ForceSendFields: []string{"IntegerValue"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &firestore.Value{DoubleValue: v.Float(), ForceSendFields: []string{"DoubleValue"}}, nil
+	case reflect.String:
+		return &firestore.Value{StringValue: v.String(), ForceSendFields: []string{"StringValue"}}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nullValue(), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return &firestore.Value{BytesValue: base64.StdEncoding.EncodeToString(b), ForceSendFields: []string{"BytesValue"}}, nil
+		}
+		av := &firestore.ArrayValue{}
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			ev, err := e.arrayElem(elem, path)
+			if err != nil {
+				return nil, err
+			}
+			av.Values = append(av.Values, ev)
+		}
+		return &firestore.Value{ArrayValue: av}, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s: map keys must be strings, not %v", describe(path), v.Type().Key())
+		}
+		if v.IsNil() {
+			return nullValue(), nil
+		}
+		fallthrough
+	case reflect.Struct:
+		m, err := e.mapFields(v, path)
+		if err != nil {
+			return nil, err
+		}
+		return &firestore.Value{MapValue: &firestore.MapValue{Fields: m}}, nil
+	}
+	return nil, fmt.Errorf("%s: cannot encode type %v", describe(path), v.Type())
+}
+
+// arrayElem encodes an element of an array. Arrays may not hold arrays or
+// sentinels.
+func (e *encoder) arrayElem(v reflect.Value, path string) (*firestore.Value, error) {
+	sub := &encoder{}
+	ev, err := sub.value(v, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(sub.transforms) > 0 || len(sub.deletes) > 0 {
+		return nil, fmt.Errorf("%s: arrays cannot hold sentinel values", describe(path))
+	}
+	if ev.ArrayValue != nil {
+		return nil, fmt.Errorf("%s: arrays cannot hold arrays", describe(path))
+	}
+	return ev, nil
+}
+
+// mapFields encodes the entries of a map or the fields of a struct.
+func (e *encoder) mapFields(v reflect.Value, path string) (map[string]firestore.Value, error) {
+	m := map[string]firestore.Value{}
+	add := func(name string, fv reflect.Value) error {
+		p := joinPath(path, name)
+		val, err := e.value(fv, p)
+		if err != nil {
+			return err
+		}
+		if val != nil {
+			m[name] = *val
+		}
+		return nil
+	}
+	if v.Kind() == reflect.Map {
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if err := add(k.String(), v.MapIndex(k)); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	for _, f := range structFields(v.Type()) {
+		fv := v.FieldByIndex(f.index)
+		if f.serverTimestamp {
+			if fv.Type() != timeType {
+				return nil, fmt.Errorf("%s: serverTimestamp field must be a time.Time", describe(joinPath(path, f.name)))
+			}
+			if fv.Interface().(time.Time).IsZero() {
+				if err := e.sentinel(ServerTimestamp, joinPath(path, f.name)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+		if err := add(f.name, fv); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (e *encoder) sentinel(s sentinel, path string) error {
+	if path == "" {
+		return fmt.Errorf("%v must be a field value", s)
+	}
+	switch s {
+	case ServerTimestamp:
+		e.transforms = append(e.transforms, &firestore.FieldTransform{FieldPath: path, SetToServerValue: "REQUEST_TIME"})
+	case DeleteField:
+		if !e.allowDelete {
+			return fmt.Errorf("%s: DeleteField is only allowed in merges and updates", describe(path))
+		}
+		e.deletes = append(e.deletes, path)
+	}
+	return nil
+}
+
+func (e *encoder) transform(t *transform, path string) error {
+	if path == "" {
+		return errors.New("field transforms must be field values")
+	}
+	ft := &firestore.FieldTransform{FieldPath: path}
+	switch t.kind {
+	case transformIncrement, transformMaximum, transformMinimum:
+		val, err := (&encoder{}).value(reflect.ValueOf(t.values[0]), path)
+		if err != nil {
+			return err
+		}
+		if k := kind(val); k != "integer" && k != "double" {
+			return fmt.Errorf("%s: %s needs a number", describe(path), t.kind)
+		}
+		switch t.kind {
+		case transformIncrement:
+			ft.Increment = val
+		case transformMaximum:
+			ft.Maximum = val
+		case transformMinimum:
+			ft.Minimum = val
+		}
+	case transformArrayUnion, transformArrayRemove:
+		av := &firestore.ArrayValue{}
+		for _, x := range t.values {
+			val, err := e.arrayElem(reflect.ValueOf(x), path)
+			if err != nil {
+				return err
+			}
+			av.Values = append(av.Values, val)
+		}
+		if t.kind == transformArrayUnion {
+			ft.AppendMissingElements = av
+		} else {
+			ft.RemoveAllFromArray = av
+		}
+	}
+	e.transforms = append(e.transforms, ft)
+	return nil
+}
+
+func forced(v *firestore.Value, name string) bool {
+	for _, f := range v.ForceSendFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func nullValue() *firestore.Value {
+	return &firestore.Value{NullValue: "NULL_VALUE"}
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return "field " + path
+}
+
+// DecodeValue stores a Value in the Go value pointed to by dst, which can
+// have any of the types listed for EncodeValue. Integers can also be stored
+// in floats, and references in strings. If dst points to an interface{},
+// the value is stored as a bool, int64, float64, string, []byte, time.Time,
+// Reference, *firestore.LatLng, []interface{} or map[string]interface{}.
+//
+// The generated Value type cannot tell false, 0, 0.0 and "" from each
+// other, since they are all omitted from the JSON. Such values decode into
+// the zero value of typed destinations, and into nil in interface{} ones.
+func DecodeValue(val *firestore.Value, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("firestoreutil: DecodeValue needs a non-nil pointer, got %T", dst)
+	}
+	if err := decodeValue(rv.Elem(), val, ""); err != nil {
+		return fmt.Errorf("firestoreutil: %v", err)
+	}
+	return nil
+}
+
+// DecodeFields stores document fields, as in Document.Fields, in the struct
+// or map pointed to by dst. Fields are matched to struct fields as described
+// for EncodeFields; fields with no match are ignored.
+func DecodeFields(fields map[string]firestore.Value, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("firestoreutil: DecodeFields needs a non-nil pointer, got %T", dst)
+	}
+	val := &firestore.Value{MapValue: &firestore.MapValue{Fields: fields}}
+	if err := decodeValue(rv.Elem(), val, ""); err != nil {
+		return fmt.Errorf("firestoreutil: %v", err)
+	}
+	return nil
+}
+
+// DecodeDocument is like DecodeFields for the fields of doc.
+func DecodeDocument(doc *firestore.Document, dst interface{}) error {
+	return DecodeFields(doc.Fields, dst)
+}
+
+// kind returns the kind of value val holds, or "" if it cannot be told.
+func kind(val *firestore.Value) string {
+	switch {
+	case val.NullValue != "":
+		return "null"
+	case val.ArrayValue != nil:
+		return "array"
+	case val.MapValue != nil:
+		return "map"
+	case val.GeoPointValue != nil:
+		return "geopoint"
+	case val.TimestampValue != "":
+		return "timestamp"
+	case val.ReferenceValue != "":
+		return "reference"
+	case val.BytesValue != "" || forced(val, "BytesValue"):
+		return "bytes"
+	case val.StringValue != "" || forced(val, "StringValue"):
+		return "string"
+	case val.IntegerValue != 0 || forced(val, "IntegerValue"):
+		return "integer"
+	case val.DoubleValue != 0 || forced(val, "DoubleValue"):
+		return "double"
+	case val.BooleanValue || forced(val, "BooleanValue"):
+		return "boolean"
+	}
+	return ""
+}
+
+func decodeValue(dst reflect.Value, val *firestore.Value, path string) error {
+	k := kind(val)
+	if k == "null" || k == "" {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	switch dst.Type() {
+	case valueType:
+		dst.Set(reflect.ValueOf(*val))
+		return nil
+	case timeType:
+		if k != "timestamp" {
+			break
+		}
+		t, err := time.Parse(time.RFC3339Nano, val.TimestampValue)
+		if err != nil {
+			return fmt.Errorf("%s: %v", describe(path), err)
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	case latLngType:
+		if k != "geopoint" {
+			break
+		}
+		dst.Set(reflect.ValueOf(*val.GeoPointValue))
+		return nil
+	case referenceType:
+		if k != "reference" {
+			break
+		}
+		dst.SetString(val.ReferenceValue)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(dst.Elem(), val, path)
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			break
+		}
+		x, err := naturalValue(val, k, path)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Bool:
+		if k == "boolean" {
+			dst.SetBool(val.BooleanValue)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if k == "integer" {
+			if dst.OverflowInt(val.IntegerValue) {
+				return fmt.Errorf("%s: %d overflows %v", describe(path), val.IntegerValue, dst.Type())
+			}
+			dst.SetInt(val.IntegerValue)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if k == "integer" {
+			if val.IntegerValue < 0 || dst.OverflowUint(uint64(val.IntegerValue)) {
+				return fmt.Errorf("%s: %d overflows %v", describe(path), val.IntegerValue, dst.Type())
+			}
+			dst.SetUint(uint64(val.IntegerValue))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch k {
+		case "double":
+			dst.SetFloat(val.DoubleValue)
+			return nil
+		case "integer":
+			dst.SetFloat(float64(val.IntegerValue))
+			return nil
+		}
+	case reflect.String:
+		switch k {
+		case "string":
+			dst.SetString(val.StringValue)
+			return nil
+		case "reference":
+			dst.SetString(val.ReferenceValue)
+			return nil
+		}
+	case reflect.Slice:
+		if dst.Type() == bytesType || dst.Type().Elem().Kind() == reflect.Uint8 {
+			if k != "bytes" {
+				break
+			}
+			b, err := base64.StdEncoding.DecodeString(val.BytesValue)
+			if err != nil {
+				return fmt.Errorf("%s: %v", describe(path), err)
+			}
+			dst.SetBytes(b)
+			return nil
+		}
+		if k != "array" {
+			break
+		}
+		vs := val.ArrayValue.Values
+		s := reflect.MakeSlice(dst.Type(), len(vs), len(vs))
+		for i, ev := range vs {
+			if err := decodeValue(s.Index(i), ev, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+	case reflect.Array:
+		if k != "array" {
+			break
+		}
+		vs := val.ArrayValue.Values
+		for i := 0; i < dst.Len(); i++ {
+			if i < len(vs) {
+				if err := decodeValue(dst.Index(i), vs[i], fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			} else {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+			}
+		}
+		return nil
+	case reflect.Map:
+		if k != "map" || dst.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		for name, fv := range val.MapValue.Fields {
+			fv := fv
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(ev, &fv, joinPath(path, name)); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), ev)
+		}
+		return nil
+	case reflect.Struct:
+		if k != "map" {
+			break
+		}
+		fields := structFields(dst.Type())
+		for name, fv := range val.MapValue.Fields {
+			fv := fv
+			var f *field
+			for i := range fields {
+				if fields[i].name == name {
+					f = &fields[i]
+					break
+				}
+			}
+			if f == nil {
+				continue
+			}
+			if err := decodeValue(dst.FieldByIndex(f.index), &fv, joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: cannot store %s value in %v", describe(path), k, dst.Type())
+}
+
+// naturalValue returns the Go value for val when decoding into an
+// interface{}.
+func naturalValue(val *firestore.Value, k, path string) (interface{}, error) {
+	var t reflect.Type
+	switch k {
+	case "boolean":
+		return val.BooleanValue, nil
+	case "integer":
+		return val.IntegerValue, nil
+	case "double":
+		return val.DoubleValue, nil
+	case "string":
+		return val.StringValue, nil
+	case "reference":
+		return Reference(val.ReferenceValue), nil
+	case "geopoint":
+		return val.GeoPointValue, nil
+	case "timestamp":
+		t = timeType
+	case "bytes":
+		t = bytesType
+	case "array":
+		t = reflect.TypeOf([]interface{}(nil))
+	case "map":
+		t = reflect.TypeOf(map[string]interface{}(nil))
+	default:
+		return nil, nil
+	}
+	v := reflect.New(t).Elem()
+	if err := decodeValue(v, val, path); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
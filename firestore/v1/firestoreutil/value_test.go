@@ -0,0 +1,194 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package firestoreutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	firestore "google.golang.org/api/firestore/v1"
+)
+
+type testCity struct {
+	Name       string            `firestore:"name"`
+	Population int64             `firestore:"population,omitempty"`
+	Capital    bool              `firestore:"capital"`
+	Area       float64           `firestore:"area"`
+	Founded    time.Time         `firestore:"founded"`
+	Tags       []string          `firestore:"tags"`
+	Location   *firestore.LatLng `firestore:"location"`
+	Mayor      Reference         `firestore:"mayor"`
+	Extra      map[string]int    `firestore:"extra"`
+	Skipped    string            `firestore:"-"`
+	Untagged   string
+	unexported string
+}
+
+func TestEncodeFieldsJSON(t *testing.T) {
+	c := testCity{
+		Name:     "Tokyo",
+		Founded:  time.Date(1457, 1, 1, 0, 0, 0, 0, time.UTC),
+		Tags:     []string{"a", ""},
+		Location: &firestore.LatLng{Latitude: 35.7, Longitude: 139.7},
+		Mayor:    "projects/p/databases/(default)/documents/people/m",
+		Extra:    map[string]int{"zero": 0},
+		Skipped:  "x",
+	}
+	fields, err := EncodeFields(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(&firestore.Document{Fields: fields})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Fields map[string]interface{}
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	got := doc.Fields
+	want := map[string]interface{}{
+		"name":    map[string]interface{}{"stringValue": "Tokyo"},
+		"capital": map[string]interface{}{"booleanValue": false},
+		"area":    map[string]interface{}{"doubleValue": 0.0},
+		"founded": map[string]interface{}{"timestampValue": "1457-01-01T00:00:00Z"},
+		"tags": map[string]interface{}{"arrayValue": map[string]interface{}{"values": []interface{}{
+			map[string]interface{}{"stringValue": "a"},
+			map[string]interface{}{"stringValue": ""},
+		}}},
+		"location": map[string]interface{}{"geoPointValue": map[string]interface{}{"latitude": 35.7, "longitude": 139.7}},
+		"mayor":    map[string]interface{}{"referenceValue": "projects/p/databases/(default)/documents/people/m"},
+		"extra": map[string]interface{}{"mapValue": map[string]interface{}{"fields": map[string]interface{}{
+			"zero": map[string]interface{}{"integerValue": "0"},
+		}}},
+		"Untagged": map[string]interface{}{"stringValue": ""},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFieldsRoundTrip(t *testing.T) {
+	want := testCity{
+		Name:       "Tokyo",
+		Population: 14e6,
+		Capital:    true,
+		Area:       2194.07,
+		Founded:    time.Date(1457, 1, 1, 0, 0, 0, 5, time.UTC),
+		Tags:       []string{"a", "b"},
+		Location:   &firestore.LatLng{Latitude: 35.7, Longitude: 139.7},
+		Mayor:      "projects/p/databases/(default)/documents/people/m",
+		Extra:      map[string]int{"one": 1},
+		Untagged:   "u",
+	}
+	fields, err := EncodeFields(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Go through JSON, as the fields would in requests and responses.
+	b, err := json.Marshal(&firestore.Document{Fields: fields})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc firestore.Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var got testCity
+	if err := DecodeDocument(&doc, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(testCity{})); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeInterface(t *testing.T) {
+	val := &firestore.Value{MapValue: &firestore.MapValue{Fields: map[string]firestore.Value{
+		"i":   {IntegerValue: 3},
+		"f":   {DoubleValue: 1.5},
+		"s":   {StringValue: "x"},
+		"b":   {BooleanValue: true},
+		"n":   {NullValue: "NULL_VALUE"},
+		"t":   {TimestampValue: "2020-01-02T03:04:05Z"},
+		"r":   {ReferenceValue: "projects/p/databases/d/documents/c/d"},
+		"by":  {BytesValue: "AQI="},
+		"arr": {ArrayValue: &firestore.ArrayValue{Values: []*firestore.Value{{IntegerValue: 1}, {StringValue: "y"}}}},
+	}}}
+	var got interface{}
+	if err := DecodeValue(val, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"i":   int64(3),
+		"f":   1.5,
+		"s":   "x",
+		"b":   true,
+		"n":   nil,
+		"t":   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		"r":   Reference("projects/p/databases/d/documents/c/d"),
+		"by":  []byte{1, 2},
+		"arr": []interface{}{int64(1), "y"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeConversions(t *testing.T) {
+	var f float64
+	if err := DecodeValue(&firestore.Value{IntegerValue: 7}, &f); err != nil || f != 7 {
+		t.Errorf("integer into float64: got %v, %v", f, err)
+	}
+	var s string
+	if err := DecodeValue(&firestore.Value{ReferenceValue: "ref"}, &s); err != nil || s != "ref" {
+		t.Errorf("reference into string: got %q, %v", s, err)
+	}
+	p := new(int)
+	if err := DecodeValue(&firestore.Value{NullValue: "NULL_VALUE"}, &p); err != nil || p != nil {
+		t.Errorf("null into pointer: got %v, %v", p, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, test := range []struct {
+		val *firestore.Value
+		dst interface{}
+	}{
+		{&firestore.Value{StringValue: "x"}, new(int)},
+		{&firestore.Value{IntegerValue: 300}, new(int8)},
+		{&firestore.Value{IntegerValue: -1}, new(uint)},
+		{&firestore.Value{DoubleValue: 1.5}, new(int)},
+		{&firestore.Value{StringValue: "x"}, new(time.Time)},
+		{&firestore.Value{StringValue: "x"}, 0},
+	} {
+		if err := DecodeValue(test.val, test.dst); err == nil {
+			t.Errorf("DecodeValue(%+v, %T): got nil, want error", test.val, test.dst)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, v := range []interface{}{
+		map[int]string{1: "x"},
+		[][]int{{1}},
+		make(chan int),
+		uint64(1 << 63),
+		ServerTimestamp,
+		map[string]interface{}{"a": ServerTimestamp},
+		map[string]interface{}{"a": []interface{}{Increment(1)}},
+	} {
+		if _, err := EncodeValue(v); err == nil {
+			t.Errorf("EncodeValue(%#v): got nil, want error", v)
+		}
+	}
+	if _, err := EncodeFields([]int{1}); err == nil {
+		t.Error("EncodeFields of a slice: got nil, want error")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package firestoreutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	firestore "google.golang.org/api/firestore/v1"
+)
+
+// A sentinel is a special field value in a write.
+type sentinel int
+
+const (
+	// ServerTimestamp is a field value that the server replaces with the
+	// time it commits the write.
+	ServerTimestamp sentinel = iota
+
+	// DeleteField is a field value that deletes the field, in MergeWrites
+	// and UpdateWrites.
+	DeleteField
+)
+
+func (s sentinel) String() string {
+	switch s {
+	case ServerTimestamp:
+		return "ServerTimestamp"
+	case DeleteField:
+		return "DeleteField"
+	}
+	return "unknown sentinel"
+}
+
+type transformKind string
+
+const (
+	transformIncrement   transformKind = "Increment"
+	transformMaximum     transformKind = "Maximum"
+	transformMinimum     transformKind = "Minimum"
+	transformArrayUnion  transformKind = "ArrayUnion"
+	transformArrayRemove transformKind = "ArrayRemove"
+)
+
+// A transform is a field value that applies a field transform.
+type transform struct {
+	kind   transformKind
+	values []interface{}
+}
+
+// Increment returns a field value that adds n, an integer or float, to the
+// field in a write.
+func Increment(n interface{}) interface{} {
+	return &transform{kind: transformIncrement, values: []interface{}{n}}
+}
+
+// Maximum returns a field value that sets the field to the maximum of its
+// value and n in a write.
+func Maximum(n interface{}) interface{} {
+	return &transform{kind: transformMaximum, values: []interface{}{n}}
+}
+
+// Minimum returns a field value that sets the field to the minimum of its
+// value and n in a write.
+func Minimum(n interface{}) interface{} {
+	return &transform{kind: transformMinimum, values: []interface{}{n}}
+}
+
+// ArrayUnion returns a field value that adds the elements not already in
+// the array field to its end in a write.
+func ArrayUnion(elems ...interface{}) interface{} {
+	return &transform{kind: transformArrayUnion, values: elems}
+}
+
+// ArrayRemove returns a field value that removes all instances of the
+// elements from the array field in a write.
+func ArrayRemove(elems ...interface{}) interface{} {
+	return &transform{kind: transformArrayRemove, values: elems}
+}
+
+// SetWrites returns the writes that create or replace the document with
+// the given name with data, a struct, pointer to struct or map. Fields set
+// to ServerTimestamp, Increment and the other transform values become field
+// transforms, which need a second write; pass all writes to the same
+// Commit.
+func SetWrites(name string, data interface{}) ([]*firestore.Write, error) {
+	e := &encoder{}
+	fields, err := e.fields(data)
+	if err != nil {
+		return nil, err
+	}
+	w := &firestore.Write{Update: &firestore.Document{Name: name, Fields: fields}}
+	return e.writes(name, w), nil
+}
+
+// MergeWrites returns the writes that set the fields present in data, a
+// struct, pointer to struct or map, leaving the other fields of the document
+// as they are. The document is created if it does not exist. Nested maps are
+// merged too: only their leaf fields are written. Fields set to DeleteField
+// are deleted.
+func MergeWrites(name string, data interface{}) ([]*firestore.Write, error) {
+	e := &encoder{allowDelete: true}
+	fields, err := e.fields(data)
+	if err != nil {
+		return nil, err
+	}
+	var mask []string
+	leafPaths("", fields, &mask)
+	mask = append(mask, e.deletes...)
+	sort.Strings(mask)
+	w := &firestore.Write{
+		Update:     &firestore.Document{Name: name, Fields: fields},
+		UpdateMask: &firestore.DocumentMask{FieldPaths: mask},
+	}
+	if len(mask) == 0 && len(e.transforms) > 0 {
+		w = nil
+	}
+	return e.writes(name, w), nil
+}
+
+// An Update sets the field at a field path, as built by FieldPath, to a
+// value, which may also be DeleteField, ServerTimestamp or a transform
+// value.
+type Update struct {
+	Path  string
+	Value interface{}
+}
+
+// UpdateWrites returns the writes that apply updates to an existing
+// document. Unlike MergeWrites, a map value replaces the whole field.
+// The writes fail if the document does not exist.
+func UpdateWrites(name string, updates ...Update) ([]*firestore.Write, error) {
+	if len(updates) == 0 {
+		return nil, errors.New("firestoreutil: no updates")
+	}
+	e := &encoder{allowDelete: true}
+	fields := map[string]firestore.Value{}
+	var mask []string
+	seen := map[string]bool{}
+	for _, u := range updates {
+		parts, err := ParseFieldPath(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		path := FieldPath(parts...)
+		if seen[path] {
+			return nil, fmt.Errorf("firestoreutil: field %s updated twice", path)
+		}
+		seen[path] = true
+		val, err := e.value(reflect.ValueOf(u.Value), path)
+		if err != nil {
+			return nil, fmt.Errorf("firestoreutil: %v", err)
+		}
+		if val == nil {
+			continue // a sentinel
+		}
+		if err := setPath(fields, parts, *val); err != nil {
+			return nil, err
+		}
+		mask = append(mask, path)
+	}
+	for p := range seen {
+		for q := range seen {
+			if strings.HasPrefix(q, p+".") {
+				return nil, fmt.Errorf("firestoreutil: field %s conflicts with %s", p, q)
+			}
+		}
+	}
+	mask = append(mask, e.deletes...)
+	sort.Strings(mask)
+	var w *firestore.Write
+	if len(mask) > 0 {
+		w = &firestore.Write{
+			Update:          &firestore.Document{Name: name, Fields: fields},
+			UpdateMask:      &firestore.DocumentMask{FieldPaths: mask},
+			CurrentDocument: &firestore.Precondition{Exists: true},
+		}
+	}
+	ws := e.writes(name, w)
+	if w == nil {
+		// Transforms alone do not check for the document.
+		ws[0].CurrentDocument = &firestore.Precondition{Exists: true}
+	}
+	return ws, nil
+}
+
+// DeleteWrite returns the write that deletes the document with the given
+// name.
+func DeleteWrite(name string) *firestore.Write {
+	return &firestore.Write{Delete: name}
+}
+
+// writes returns w, if non-nil, followed by the transform write for the
+// transforms collected by e, if any.
+func (e *encoder) writes(name string, w *firestore.Write) []*firestore.Write {
+	var ws []*firestore.Write
+	if w != nil {
+		ws = append(ws, w)
+	}
+	if len(e.transforms) > 0 {
+		ws = append(ws, &firestore.Write{Transform: &firestore.DocumentTransform{
+			Document:        name,
+			FieldTransforms: e.transforms,
+		}})
+	}
+	return ws
+}
+
+// leafPaths appends the paths of the fields that are not maps, and of
+// empty maps, to paths.
+func leafPaths(prefix string, fields map[string]firestore.Value, paths *[]string) {
+	for name, v := range fields {
+		p := joinPath(prefix, name)
+		if v.MapValue != nil && len(v.MapValue.Fields) > 0 {
+			leafPaths(p, v.MapValue.Fields, paths)
+			continue
+		}
+		*paths = append(*paths, p)
+	}
+}
+
+// setPath sets the field at the path parts in fields to v, creating maps
+// on the way.
+func setPath(fields map[string]firestore.Value, parts []string, v firestore.Value) error {
+	for _, p := range parts[:len(parts)-1] {
+		m, ok := fields[p]
+		if !ok {
+			m = firestore.Value{MapValue: &firestore.MapValue{Fields: map[string]firestore.Value{}}}
+			fields[p] = m
+		} else if m.MapValue == nil {
+			return fmt.Errorf("firestoreutil: field %s is not a map", p)
+		}
+		fields = m.MapValue.Fields
+	}
+	fields[parts[len(parts)-1]] = v
+	return nil
+}
+
+// FieldPath returns the field path of the field with the given names of
+// itself and its enclosing maps, quoting names that are not simple
+// identifiers with backquotes.
+func FieldPath(names ...string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = quoteName(n)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// ParseFieldPath returns the field names of a field path. It is the inverse
+// of FieldPath.
+func ParseFieldPath(path string) ([]string, error) {
+	orig := path
+	var names []string
+	for len(path) > 0 {
+		var name string
+		if path[0] == '`' {
+			var b strings.Builder
+			i := 1
+			for ; i < len(path) && path[i] != '`'; i++ {
+				if path[i] == '\\' && i+1 < len(path) {
+					i++
+				}
+				b.WriteByte(path[i])
+			}
+			if i == len(path) {
+				return nil, fmt.Errorf("firestoreutil: unterminated quote in field path %q", orig)
+			}
+			name, path = b.String(), path[i+1:]
+		} else {
+			i := strings.IndexByte(path, '.')
+			if i < 0 {
+				i = len(path)
+			}
+			name, path = path[:i], path[i:]
+			if strings.ContainsAny(name, "`") {
+				return nil, fmt.Errorf("firestoreutil: bad field path %q", orig)
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("firestoreutil: empty field name in field path %q", orig)
+		}
+		names = append(names, name)
+		if len(path) > 0 {
+			if path[0] != '.' || len(path) == 1 {
+				return nil, fmt.Errorf("firestoreutil: bad field path %q", orig)
+			}
+			path = path[1:]
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("firestoreutil: empty field path")
+	}
+	return names, nil
+}
+
+func quoteName(n string) string {
+	simple := n != ""
+	for i, r := range n {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || i > 0 && '0' <= r && r <= '9') {
+			simple = false
+			break
+		}
+	}
+	if simple {
+		return n
+	}
+	n = strings.Replace(n, `\`, `\\`, -1)
+	n = strings.Replace(n, "`", "\\`", -1)
+	return "`" + n + "`"
+}
+
+// joinPath returns the path of the field name in the map at path prefix.
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return quoteName(name)
+	}
+	return prefix + "." + quoteName(name)
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package firestoreutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	firestore "google.golang.org/api/firestore/v1"
+)
+
+const testDoc = "projects/p/databases/(default)/documents/cities/tok"
+
+func str(s string) firestore.Value {
+	return firestore.Value{StringValue: s, ForceSendFields: []string{"StringValue"}}
+}
+
+func integer(i int64) *firestore.Value {
+	return &firestore.Value{IntegerValue: i, ForceSendFields: []string{"IntegerValue"}}
+}
+
+func TestSetWrites(t *testing.T) {
+	type doc struct {
+		Name    string    `firestore:"name"`
+		Updated time.Time `firestore:"updated,serverTimestamp"`
+	}
+	got, err := SetWrites(testDoc, doc{Name: "Tokyo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*firestore.Write{
+		{Update: &firestore.Document{Name: testDoc, Fields: map[string]firestore.Value{"name": str("Tokyo")}}},
+		{Transform: &firestore.DocumentTransform{Document: testDoc, FieldTransforms: []*firestore.FieldTransform{
+			{FieldPath: "updated", SetToServerValue: "REQUEST_TIME"},
+		}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// A set time is written as is.
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	got, err = SetWrites(testDoc, doc{Name: "Tokyo", Updated: ts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Update.Fields["updated"].TimestampValue != "2020-01-01T00:00:00Z" {
+		t.Errorf("got %+v, want one write with the time", got)
+	}
+
+	if _, err := SetWrites(testDoc, map[string]interface{}{"a": DeleteField}); err == nil {
+		t.Error("DeleteField in SetWrites: got nil, want error")
+	}
+}
+
+func TestMergeWrites(t *testing.T) {
+	got, err := MergeWrites(testDoc, map[string]interface{}{
+		"name": "Tokyo",
+		"stats": map[string]interface{}{
+			"pop":    Increment(5),
+			"area":   "big",
+			"old":    DeleteField,
+			"a b":    "quoted",
+			"nested": map[string]interface{}{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*firestore.Write{
+		{
+			Update: &firestore.Document{Name: testDoc, Fields: map[string]firestore.Value{
+				"name": str("Tokyo"),
+				"stats": {MapValue: &firestore.MapValue{Fields: map[string]firestore.Value{
+					"area":   str("big"),
+					"a b":    str("quoted"),
+					"nested": {MapValue: &firestore.MapValue{Fields: map[string]firestore.Value{}}},
+				}}},
+			}},
+			UpdateMask: &firestore.DocumentMask{FieldPaths: []string{"name", "stats.`a b`", "stats.area", "stats.nested", "stats.old"}},
+		},
+		{Transform: &firestore.DocumentTransform{Document: testDoc, FieldTransforms: []*firestore.FieldTransform{
+			{FieldPath: "stats.pop", Increment: integer(5)},
+		}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUpdateWrites(t *testing.T) {
+	got, err := UpdateWrites(testDoc,
+		Update{Path: "a.b", Value: "x"},
+		Update{Path: "c", Value: DeleteField},
+		Update{Path: "tags", Value: ArrayUnion("t1", "t2")},
+		Update{Path: "m", Value: Maximum(2.5)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*firestore.Write{
+		{
+			Update: &firestore.Document{Name: testDoc, Fields: map[string]firestore.Value{
+				"a": {MapValue: &firestore.MapValue{Fields: map[string]firestore.Value{"b": str("x")}}},
+			}},
+			UpdateMask:      &firestore.DocumentMask{FieldPaths: []string{"a.b", "c"}},
+			CurrentDocument: &firestore.Precondition{Exists: true},
+		},
+		{Transform: &firestore.DocumentTransform{Document: testDoc, FieldTransforms: []*firestore.FieldTransform{
+			{FieldPath: "tags", AppendMissingElements: &firestore.ArrayValue{Values: []*firestore.Value{
+				{StringValue: "t1", ForceSendFields: []string{"StringValue"}},
+				{StringValue: "t2", ForceSendFields: []string{"StringValue"}},
+			}}},
+			{FieldPath: "m", Maximum: &firestore.Value{DoubleValue: 2.5, ForceSendFields: []string{"DoubleValue"}}},
+		}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Transforms alone still require the document to exist.
+	got, err = UpdateWrites(testDoc, Update{Path: "n", Value: Increment(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Transform == nil || got[0].CurrentDocument == nil || !got[0].CurrentDocument.Exists {
+		t.Errorf("got %+v, want one transform write with a precondition", got)
+	}
+}
+
+func TestUpdateWritesErrors(t *testing.T) {
+	for _, updates := range [][]Update{
+		nil,
+		{{Path: "a", Value: 1}, {Path: "a", Value: 2}},
+		{{Path: "a", Value: 1}, {Path: "a.b", Value: 2}},
+		{{Path: "a..b", Value: 1}},
+		{{Path: "a", Value: Increment("x")}},
+	} {
+		if _, err := UpdateWrites(testDoc, updates...); err == nil {
+			t.Errorf("UpdateWrites(%v): got nil, want error", updates)
+		}
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	for _, test := range []struct {
+		names []string
+		path  string
+	}{
+		{[]string{"a"}, "a"},
+		{[]string{"a", "b_1"}, "a.b_1"},
+		{[]string{"1a"}, "`1a`"},
+		{[]string{"a.b", "c"}, "`a.b`.c"},
+		{[]string{"x`y", `\`}, "`x\\`y`.`\\\\`"},
+	} {
+		if got := FieldPath(test.names...); got != test.path {
+			t.Errorf("FieldPath(%q) = %q, want %q", test.names, got, test.path)
+		}
+		got, err := ParseFieldPath(test.path)
+		if err != nil {
+			t.Errorf("ParseFieldPath(%q): %v", test.path, err)
+			continue
+		}
+		if !cmp.Equal(got, test.names) {
+			t.Errorf("ParseFieldPath(%q) = %q, want %q", test.path, got, test.names)
+		}
+	}
+	for _, bad := range []string{"", "a.", ".a", "a..b", "`a", "a`b`", "``"} {
+		if _, err := ParseFieldPath(bad); err == nil {
+			t.Errorf("ParseFieldPath(%q): got nil, want error", bad)
+		}
+	}
+}
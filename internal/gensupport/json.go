@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 // MarshalJSON returns a JSON encoding of schema containing only selected fields.
@@ -18,7 +19,7 @@ import (
 //   * its field name is present in nullFields.
 // The JSON key for each selected field is taken from the field's json: struct tag.
 func MarshalJSON(schema interface{}, forceSendFields, nullFields []string) ([]byte, error) {
-	if len(forceSendFields) == 0 && len(nullFields) == 0 {
+	if len(forceSendFields) == 0 && len(nullFields) == 0 && !hasStructMap(reflect.TypeOf(schema)) {
 		return json.Marshal(schema)
 	}
 
@@ -48,6 +49,27 @@ func MarshalJSON(schema interface{}, forceSendFields, nullFields []string) ([]by
 	return json.Marshal(dataMap)
 }
 
+// structMapTypes caches the results of hasStructMap by type.
+var structMapTypes sync.Map // map[reflect.Type]bool
+
+// hasStructMap reports whether struct type t has a map field with struct
+// values. See schemaToMap.
+func hasStructMap(t reflect.Type) bool {
+	if v, ok := structMapTypes.Load(t); ok {
+		return v.(bool)
+	}
+	has := false
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Map && ft.Elem().Kind() == reflect.Struct {
+			has = true
+			break
+		}
+	}
+	structMapTypes.Store(t, has)
+	return has
+}
+
 func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNullMaps map[string]map[string]bool) (map[string]interface{}, error) {
 	m := make(map[string]interface{})
 	s := reflect.ValueOf(schema)
@@ -104,6 +126,20 @@ func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNu
 			continue
 		}
 
+		// Map values are not addressable, so encoding/json would not call
+		// the MarshalJSON methods of struct values, which have pointer
+		// receivers, and their ForceSendFields would be lost.
+		if f.Type.Kind() == reflect.Map && f.Type.Elem().Kind() == reflect.Struct {
+			mi := make(map[string]interface{}, v.Len())
+			for _, k := range v.MapKeys() {
+				e := reflect.New(f.Type.Elem())
+				e.Elem().Set(v.MapIndex(k))
+				mi[k.String()] = e.Interface()
+			}
+			m[tag.apiName] = mi
+			continue
+		}
+
 		// nil slices are treated as empty slices.
 		if f.Type.Kind() == reflect.Slice && v.IsNil() {
 			m[tag.apiName] = []bool{}
@@ -259,6 +259,44 @@ func TestMapField(t *testing.T) {
 	}
 }
 
+type forcedChild struct {
+	B bool `json:"b,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+}
+
+func (c *forcedChild) MarshalJSON() ([]byte, error) {
+	type NoMethod forcedChild
+	return MarshalJSON(NoMethod(*c), c.ForceSendFields, nil)
+}
+
+func TestMapOfStructField(t *testing.T) {
+	type parent struct {
+		M map[string]forcedChild `json:"m,omitempty"`
+	}
+	for _, tc := range []struct {
+		s    parent
+		want string
+	}{
+		{
+			s:    parent{M: map[string]forcedChild{"a": {B: true}, "b": {}}},
+			want: `{"m":{"a":{"b":true},"b":{}}}`,
+		},
+		{
+			s:    parent{M: map[string]forcedChild{"a": {ForceSendFields: []string{"B"}}}},
+			want: `{"m":{"a":{"b":false}}}`,
+		},
+	} {
+		got, err := MarshalJSON(tc.s, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("MarshalJSON(%+v) = %s, want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
 func TestMapToAnyArray(t *testing.T) {
 	for _, tc := range []testCase{
 		{
@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package retry classifies the errors of API calls, and retries the calls,
+// for the helper packages.
+package retry
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultMaxAttempts is the default number of times Do calls a function.
+const DefaultMaxAttempts = 5
+
+// Transient reports whether a failed request may succeed if retried: it
+// failed with a timeout, throttling or server error status, or with a
+// network error other than the cancelation of its context.
+func Transient(err error) bool {
+	switch e := err.(type) {
+	case *googleapi.Error:
+		switch e.Code {
+		case 408, 429, 500, 502, 503, 504:
+			return true
+		}
+		return false
+	case *url.Error:
+		return !(e.Err == context.Canceled || e.Err == context.DeadlineExceeded)
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+// Retryable reports whether a failed request may succeed if retried. It is
+// like Transient, but also holds for the 403 errors with which some APIs,
+// like the Directory, Calendar and YouTube APIs, report exceeded rate
+// limits and quotas.
+func Retryable(err error) bool {
+	if e, ok := err.(*googleapi.Error); ok && e.Code == 403 {
+		for _, item := range e.Errors {
+			switch item.Reason {
+			case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+				return true
+			}
+		}
+	}
+	return Transient(err)
+}
+
+// Do calls f until it succeeds, fails with an error that is not Retryable,
+// or has been called maxAttempts times, pausing between calls as bo says. If
+// maxAttempts is zero or negative, DefaultMaxAttempts is used. Do returns the
+// last error of f, without pausing, once ctx is done.
+func Do(ctx context.Context, bo gax.Backoff, maxAttempts int, f func() error) error {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !Retryable(err) || attempt >= maxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if gax.Sleep(ctx, bo.Pause()) != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestTransient(t *testing.T) {
+	for _, test := range []struct {
+		err                  error
+		transient, retryable bool
+	}{
+		{&googleapi.Error{Code: 500}, true, true},
+		{&googleapi.Error{Code: 503}, true, true},
+		{&googleapi.Error{Code: 429}, true, true},
+		{&googleapi.Error{Code: 400}, false, false},
+		{&googleapi.Error{Code: 404}, false, false},
+		{&googleapi.Error{Code: 403}, false, false},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, false, false},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, false, true},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, false, true},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, false, true},
+		{&url.Error{Op: "Post", URL: "u", Err: errors.New("connection reset")}, true, true},
+		{&url.Error{Op: "Post", URL: "u", Err: context.Canceled}, false, false},
+		{&url.Error{Op: "Post", URL: "u", Err: context.DeadlineExceeded}, false, false},
+		{errors.New("bad"), false, false},
+		{context.Canceled, false, false},
+	} {
+		if got := Transient(test.err); got != test.transient {
+			t.Errorf("Transient(%v) = %t, want %t", test.err, got, test.transient)
+		}
+		if got := Retryable(test.err); got != test.retryable {
+			t.Errorf("Retryable(%v) = %t, want %t", test.err, got, test.retryable)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	unavailable := &googleapi.Error{Code: 503}
+	bad := errors.New("bad")
+	for _, test := range []struct {
+		errs        []error
+		maxAttempts int
+		wantCalls   int
+		wantErr     error
+	}{
+		{nil, 3, 1, nil},
+		{[]error{unavailable, unavailable}, 3, 3, nil},
+		{[]error{unavailable, unavailable, unavailable}, 3, 3, unavailable},
+		{[]error{bad}, 3, 1, bad},
+		{[]error{unavailable, unavailable, unavailable, unavailable, unavailable}, 0, DefaultMaxAttempts, unavailable},
+	} {
+		calls := 0
+		err := Do(context.Background(), gax.Backoff{Initial: time.Millisecond}, test.maxAttempts, func() error {
+			calls++
+			if calls <= len(test.errs) {
+				return test.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != test.wantCalls || err != test.wantErr {
+			t.Errorf("%v: got %d calls, error %v; want %d, %v", test.errs, calls, err, test.wantCalls, test.wantErr)
+		}
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Do(ctx, gax.Backoff{Initial: time.Hour}, 5, func() error {
+		calls++
+		cancel()
+		return &googleapi.Error{Code: 503}
+	})
+	if calls != 1 || err == nil {
+		t.Errorf("got %d calls, error %v; want 1 call and the error", calls, err)
+	}
+}
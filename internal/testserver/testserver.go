@@ -0,0 +1,43 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testserver runs fake API servers for the tests of the helper
+// packages of the API clients.
+package testserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+// NewService starts a server that serves requests with h, and creates a
+// service directed to it with newService, the NewService function of an API
+// client package. It fails t if newService fails. It returns the service and
+// a function that closes the server.
+//
+// For example:
+//
+//	svc, stop := testserver.NewService(t, fake, pubsub.NewService)
+//	defer stop()
+//	p := pubsubutil.NewPublisher(svc.(*pubsub.Service), topic)
+func NewService(t testing.TB, h http.Handler, newService interface{}) (interface{}, func()) {
+	t.Helper()
+	ts := httptest.NewServer(h)
+	args := []reflect.Value{
+		reflect.ValueOf(context.Background()),
+		reflect.ValueOf(option.WithEndpoint(ts.URL + "/")),
+		reflect.ValueOf(option.WithHTTPClient(ts.Client())),
+	}
+	out := reflect.ValueOf(newService).Call(args)
+	if err, _ := out[1].Interface().(error); err != nil {
+		ts.Close()
+		t.Fatalf("testserver: %v", err)
+	}
+	return out[0].Interface(), ts.Close
+}
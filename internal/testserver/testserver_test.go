@@ -0,0 +1,32 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testserver
+
+import (
+	"net/http"
+	"testing"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+func TestNewService(t *testing.T) {
+	var path string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"id": "p:d"}`))
+	})
+	svc, stop := NewService(t, h, bigquery.NewService)
+	defer stop()
+	ds, err := svc.(*bigquery.Service).Datasets.Get("p", "d").Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/projects/p/datasets/d"; path != want {
+		t.Errorf("got path %q, want %q", path, want)
+	}
+	if ds.Id != "p:d" {
+		t.Errorf("got ID %q, want %q", ds.Id, "p:d")
+	}
+}
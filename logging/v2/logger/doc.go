@@ -0,0 +1,31 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package logger writes structured logs to Cloud Logging with the REST API
+// (google.golang.org/api/logging/v2).
+//
+// A Client batches the entries of its Loggers per log and writes them in the
+// background with Entries.Write, each with its monitored resource:
+//
+//	c := logger.NewClient(svc, "projects/my-project")
+//	defer c.Close()
+//	lg := c.Logger("my-service")
+//	lg.Log(logger.Entry{
+//		Severity: logger.Warning,
+//		Payload:  map[string]interface{}{"msg": "slow request", "ms": 1200},
+//	})
+//	lg.Infof("started in %v", d)
+//
+// Strings are written as text payloads, and other values as JSON payloads.
+// Entries can carry an HTTP request and a trace, which TraceFromRequest
+// reads from incoming requests so that logs are correlated with traces.
+//
+// Writer and StandardLogger adapt a Logger to io.Writer and the standard
+// log package. Writes use partial success, so one invalid entry does not
+// fail the others; the failed entries are reported as a *PartialError.
+// Close flushes the entries not yet written, and should be called on
+// shutdown.
+//
+// This package is experimental and subject to change without notice.
+package logger
@@ -0,0 +1,250 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logging "google.golang.org/api/logging/v2"
+)
+
+// Severity is the severity of a log entry. Its values are those of the
+// LogSeverity enum of the API.
+type Severity int
+
+// Severities, in increasing order.
+const (
+	Default   Severity = 0
+	Debug     Severity = 100
+	Info      Severity = 200
+	Notice    Severity = 300
+	Warning   Severity = 400
+	Error     Severity = 500
+	Critical  Severity = 600
+	Alert     Severity = 700
+	Emergency Severity = 800
+)
+
+var severityNames = map[Severity]string{
+	Default:   "DEFAULT",
+	Debug:     "DEBUG",
+	Info:      "INFO",
+	Notice:    "NOTICE",
+	Warning:   "WARNING",
+	Error:     "ERROR",
+	Critical:  "CRITICAL",
+	Alert:     "ALERT",
+	Emergency: "EMERGENCY",
+}
+
+// String returns the name of s in the API, as in "WARNING". Severities that
+// are not one of the constants above are "DEFAULT".
+func (s Severity) String() string {
+	if n, ok := severityNames[s]; ok {
+		return n
+	}
+	return severityNames[Default]
+}
+
+// ParseSeverity returns the severity with the given name, in any case, or
+// Default if there is none.
+func ParseSeverity(name string) Severity {
+	name = strings.ToUpper(name)
+	for s, n := range severityNames {
+		if n == name {
+			return s
+		}
+	}
+	return Default
+}
+
+// An Entry is a log entry to write with a Logger.
+type Entry struct {
+	// Timestamp is the time of the entry. If zero, the time it is passed to
+	// the Logger is used.
+	Timestamp time.Time
+
+	Severity Severity
+
+	// Payload is the content of the entry. A string, []byte or error is
+	// written as a text payload. Other values are marshaled with
+	// encoding/json into a JSON payload; values that do not marshal to a
+	// JSON object are written as the "message" field of one.
+	Payload interface{}
+
+	// Labels are added to the common labels of the Logger.
+	Labels map[string]string
+
+	// InsertID, if non-empty, lets Cloud Logging drop duplicates of the
+	// entry written with the same ID.
+	InsertID string
+
+	// HTTPRequest, if non-nil, is the HTTP request the entry is about.
+	HTTPRequest *HTTPRequest
+
+	// Trace is the full name of the trace of the entry, as in
+	// "projects/my-project/traces/06796866738c859f2f19b7cfb3214824", and
+	// SpanID the hexadecimal ID of its span. See TraceFromRequest.
+	Trace        string
+	SpanID       string
+	TraceSampled bool
+
+	SourceLocation *logging.LogEntrySourceLocation
+	Operation      *logging.LogEntryOperation
+
+	// Resource, if non-nil, replaces the resource of the Logger.
+	Resource *logging.MonitoredResource
+}
+
+// An HTTPRequest describes an HTTP request and its response.
+type HTTPRequest struct {
+	// Request is the request. Its method, URL, user agent, referer,
+	// protocol and remote address are logged.
+	Request *http.Request
+
+	// RequestSize is the size of the request, in bytes, including its
+	// header and body.
+	RequestSize int64
+
+	// Status is the status code of the response.
+	Status int
+
+	// ResponseSize is the size of the response, in bytes, including its
+	// header and body.
+	ResponseSize int64
+
+	// Latency is the time between receiving the request and sending the
+	// response.
+	Latency time.Duration
+
+	// LocalIP is the IP address of the server. RemoteIP, if non-empty,
+	// replaces the remote address of the request, for example when it
+	// went through a proxy.
+	LocalIP  string
+	RemoteIP string
+
+	CacheHit                       bool
+	CacheValidatedWithOriginServer bool
+}
+
+func (r *HTTPRequest) toLogging() *logging.HttpRequest {
+	hr := &logging.HttpRequest{
+		RequestSize:                    r.RequestSize,
+		Status:                         int64(r.Status),
+		ResponseSize:                   r.ResponseSize,
+		ServerIp:                       r.LocalIP,
+		RemoteIp:                       r.RemoteIP,
+		CacheHit:                       r.CacheHit,
+		CacheValidatedWithOriginServer: r.CacheValidatedWithOriginServer,
+	}
+	if r.Latency != 0 {
+		hr.Latency = formatDuration(r.Latency)
+	}
+	if req := r.Request; req != nil {
+		hr.RequestMethod = req.Method
+		if req.URL != nil {
+			hr.RequestUrl = req.URL.String()
+		}
+		hr.UserAgent = req.UserAgent()
+		hr.Referer = req.Referer()
+		hr.Protocol = req.Proto
+		if hr.RemoteIp == "" {
+			hr.RemoteIp = req.RemoteAddr
+		}
+	}
+	return hr
+}
+
+// formatDuration formats d as a google.protobuf.Duration in JSON, as in
+// "1.5s".
+func formatDuration(d time.Duration) string {
+	s := strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	return s + "s"
+}
+
+// TraceFromRequest returns the trace, span ID and sampling decision of an
+// incoming request from its X-Cloud-Trace-Context header, as set by Google
+// Cloud load balancers and serverless platforms, in the form used by
+// Entry. projectID is the ID of the project the trace belongs to. The
+// results are empty if the header is missing or malformed.
+func TraceFromRequest(r *http.Request, projectID string) (trace, spanID string, sampled bool) {
+	// The header is "TRACE_ID/SPAN_ID;o=OPTIONS", with a decimal span ID.
+	h := r.Header.Get("X-Cloud-Trace-Context")
+	if h == "" {
+		return "", "", false
+	}
+	opts := ""
+	if i := strings.IndexByte(h, ';'); i >= 0 {
+		h, opts = h[:i], h[i+1:]
+	}
+	traceID := h
+	if i := strings.IndexByte(h, '/'); i >= 0 {
+		traceID = h[:i]
+		if id, err := strconv.ParseUint(h[i+1:], 10, 64); err == nil && id != 0 {
+			spanID = fmt.Sprintf("%016x", id)
+		}
+	}
+	if traceID == "" {
+		return "", "", false
+	}
+	return "projects/" + projectID + "/traces/" + traceID, spanID, opts == "o=1"
+}
+
+// toLogEntry converts e to a LogEntry without log name and resource.
+// labels are the common labels of the Logger.
+func (e *Entry) toLogEntry(labels map[string]string) (*logging.LogEntry, error) {
+	le := &logging.LogEntry{
+		Timestamp:      e.Timestamp.UTC().Format(time.RFC3339Nano),
+		InsertId:       e.InsertID,
+		Trace:          e.Trace,
+		SpanId:         e.SpanID,
+		TraceSampled:   e.TraceSampled,
+		SourceLocation: e.SourceLocation,
+		Operation:      e.Operation,
+	}
+	if _, ok := severityNames[e.Severity]; ok && e.Severity != Default {
+		le.Severity = e.Severity.String()
+	}
+	if e.HTTPRequest != nil {
+		le.HttpRequest = e.HTTPRequest.toLogging()
+	}
+	if len(labels)+len(e.Labels) > 0 {
+		le.Labels = make(map[string]string, len(labels)+len(e.Labels))
+		for k, v := range labels {
+			le.Labels[k] = v
+		}
+		for k, v := range e.Labels {
+			le.Labels[k] = v
+		}
+	}
+	switch p := e.Payload.(type) {
+	case nil:
+	case string:
+		le.TextPayload = p
+	case []byte:
+		le.TextPayload = string(p)
+	case error:
+		le.TextPayload = p.Error()
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("logger: marshaling payload: %v", err)
+		}
+		if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+			b, err = json.Marshal(map[string]json.RawMessage{"message": b})
+			if err != nil {
+				return nil, fmt.Errorf("logger: marshaling payload: %v", err)
+			}
+		}
+		le.JsonPayload = b
+	}
+	return le, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/googleapi"
+	logging "google.golang.org/api/logging/v2"
+)
+
+func TestSeverity(t *testing.T) {
+	if got := Warning.String(); got != "WARNING" {
+		t.Errorf("got %q, want WARNING", got)
+	}
+	if got := Severity(250).String(); got != "DEFAULT" {
+		t.Errorf("got %q, want DEFAULT", got)
+	}
+	if got := ParseSeverity("error"); got != Error {
+		t.Errorf("got %v, want ERROR", got)
+	}
+	if got := ParseSeverity("bogus"); got != Default {
+		t.Errorf("got %v, want DEFAULT", got)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	for _, test := range []struct {
+		payload  interface{}
+		wantText string
+		wantJSON string
+	}{
+		{payload: "hello", wantText: "hello"},
+		{payload: []byte("bytes"), wantText: "bytes"},
+		{payload: errors.New("failed"), wantText: "failed"},
+		{payload: map[string]int{"n": 1}, wantJSON: `{"n":1}`},
+		{payload: struct {
+			Msg string `json:"msg"`
+		}{"hi"}, wantJSON: `{"msg":"hi"}`},
+		{payload: 42, wantJSON: `{"message":42}`},
+		{payload: []string{"a"}, wantJSON: `{"message":["a"]}`},
+	} {
+		e := &Entry{Payload: test.payload}
+		le, err := e.toLogEntry(nil)
+		if err != nil {
+			t.Errorf("%v: %v", test.payload, err)
+			continue
+		}
+		if le.TextPayload != test.wantText || string(le.JsonPayload) != test.wantJSON {
+			t.Errorf("%v: got text %q, JSON %s; want %q, %s", test.payload, le.TextPayload, le.JsonPayload, test.wantText, test.wantJSON)
+		}
+	}
+}
+
+func TestToLogEntry(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/path?q=1", nil)
+	req.Header.Set("User-Agent", "test")
+	e := &Entry{
+		Timestamp: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Severity:  Notice,
+		Labels:    map[string]string{"b": "entry", "c": "3"},
+		HTTPRequest: &HTTPRequest{
+			Request: req,
+			Status:  200,
+			Latency: 1500 * time.Millisecond,
+		},
+		Trace:  "projects/p/traces/abc",
+		SpanID: "000000000000004a",
+	}
+	got, err := e.toLogEntry(map[string]string{"a": "1", "b": "common"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &logging.LogEntry{
+		Timestamp: "2020-01-02T03:04:05.000000006Z",
+		Severity:  "NOTICE",
+		Labels:    map[string]string{"a": "1", "b": "entry", "c": "3"},
+		HttpRequest: &logging.HttpRequest{
+			RequestMethod: "GET",
+			RequestUrl:    "http://example.com/path?q=1",
+			UserAgent:     "test",
+			Protocol:      "HTTP/1.1",
+			RemoteIp:      "192.0.2.1:1234",
+			Status:        200,
+			Latency:       "1.5s",
+		},
+		Trace:  "projects/p/traces/abc",
+		SpanId: "000000000000004a",
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b googleapi.RawMessage) bool { return string(a) == string(b) })); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTraceFromRequest(t *testing.T) {
+	for _, test := range []struct {
+		header      string
+		wantTrace   string
+		wantSpan    string
+		wantSampled bool
+	}{
+		{"", "", "", false},
+		{"105445aa7843bc8bf206b12000100000/74;o=1", "projects/p/traces/105445aa7843bc8bf206b12000100000", "000000000000004a", true},
+		{"105445aa7843bc8bf206b12000100000/74;o=0", "projects/p/traces/105445aa7843bc8bf206b12000100000", "000000000000004a", false},
+		{"105445aa7843bc8bf206b12000100000", "projects/p/traces/105445aa7843bc8bf206b12000100000", "", false},
+		{"105445aa7843bc8bf206b12000100000/x", "projects/p/traces/105445aa7843bc8bf206b12000100000", "", false},
+		{"/74", "", "", false},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			req.Header.Set("X-Cloud-Trace-Context", test.header)
+		}
+		trace, span, sampled := TraceFromRequest(req, "p")
+		if trace != test.wantTrace || span != test.wantSpan || sampled != test.wantSampled {
+			t.Errorf("%q: got (%q, %q, %t), want (%q, %q, %t)", test.header, trace, span, sampled, test.wantTrace, test.wantSpan, test.wantSampled)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/retry"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/support/bundler"
+)
+
+const (
+	// DefaultEntryCountThreshold is the default number of entries sent in
+	// one write request.
+	DefaultEntryCountThreshold = 1000
+
+	// DefaultEntryByteThreshold is the default size of the entries that
+	// triggers a write request.
+	DefaultEntryByteThreshold = 1 << 20
+
+	// DefaultDelayThreshold is the default time entries wait for more
+	// entries to be batched with.
+	DefaultDelayThreshold = time.Second
+
+	// DefaultBufferedByteLimit is the default size of the entries that may
+	// wait to be written. Entries logged beyond it are dropped.
+	DefaultBufferedByteLimit = 1 << 30
+
+	// DefaultRetryDeadline is the default time a batch of entries is
+	// retried after transient errors.
+	DefaultRetryDeadline = time.Minute
+)
+
+// maxWriteBytes is the size limit of the entries of a write request,
+// leaving room for the request's overhead.
+const maxWriteBytes = 9 << 20
+
+var errClosed = errors.New("logger: Client is closed")
+
+// A Client writes log entries of the loggers it creates to Cloud Logging
+// with Entries.Write. Entries are batched per log, and written in the
+// background.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Logger.
+type Client struct {
+	// Once a batch has this many entries, write it. The default is
+	// DefaultEntryCountThreshold.
+	EntryCountThreshold int
+
+	// Once a batch has this many bytes of entries, write it. The default is
+	// DefaultEntryByteThreshold.
+	EntryByteThreshold int
+
+	// Starting from the time that the first entry is added to a batch, once
+	// this delay has passed, write the batch. The default is
+	// DefaultDelayThreshold.
+	DelayThreshold time.Duration
+
+	// The maximum size of the entries of a log waiting to be written. Entries logged when it is reached are dropped, with an
+	// error. The default is DefaultBufferedByteLimit.
+	BufferedByteLimit int
+
+	// How long to keep retrying a batch that fails with transient errors.
+	// The default is DefaultRetryDeadline.
+	RetryDeadline time.Duration
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	// OnError, if non-nil, is called with the errors of background writes,
+	// including *PartialError. It must not block. Whether or not it is set,
+	// the first such error is also returned by the next call to Flush.
+	OnError func(err error)
+
+	svc    *logging.Service
+	parent string
+
+	mu       sync.Mutex
+	closed   bool
+	err      error                       // first error since the last Flush
+	bundlers map[string]*bundler.Bundler // by log name
+}
+
+// NewClient returns a Client writing logs of parent, as in
+// "projects/my-project".
+func NewClient(svc *logging.Service, parent string) *Client {
+	return &Client{
+		EntryCountThreshold: DefaultEntryCountThreshold,
+		EntryByteThreshold:  DefaultEntryByteThreshold,
+		DelayThreshold:      DefaultDelayThreshold,
+		BufferedByteLimit:   DefaultBufferedByteLimit,
+		RetryDeadline:       DefaultRetryDeadline,
+		svc:                 svc,
+		parent:              parent,
+		bundlers:            map[string]*bundler.Bundler{},
+	}
+}
+
+// Logger returns a Logger writing to the log with the given ID, as in
+// "syslog". The log ID is URL-encoded in the log name.
+func (c *Client) Logger(logID string) *Logger {
+	return &Logger{
+		Resource: &logging.MonitoredResource{Type: "global"},
+		client:   c,
+		logName:  c.parent + "/logs/" + url.PathEscape(logID),
+	}
+}
+
+// A Logger writes entries to one log.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Log.
+type Logger struct {
+	// CommonLabels are added to the labels of every entry.
+	CommonLabels map[string]string
+
+	// Resource is the monitored resource of entries that do not have one.
+	// The default is the "global" resource.
+	Resource *logging.MonitoredResource
+
+	client  *Client
+	logName string
+}
+
+// A pendingEntry is an entry waiting to be written.
+type pendingEntry struct {
+	entry *logging.LogEntry
+}
+
+// Log adds e to a batch to be written in the background. Errors are
+// reported to the Client's OnError and returned by Flush.
+func (l *Logger) Log(e Entry) {
+	le, size, err := l.prepare(e)
+	if err == nil {
+		var b *bundler.Bundler
+		b, err = l.client.bundler(l.logName)
+		if err == nil {
+			err = b.Add(&pendingEntry{entry: le}, size)
+		}
+	}
+	if err != nil {
+		l.client.fail(err)
+	}
+}
+
+// LogSync writes e immediately, and returns when it is written or fails.
+func (l *Logger) LogSync(ctx context.Context, e Entry) error {
+	le, _, err := l.prepare(e)
+	if err != nil {
+		return err
+	}
+	return l.client.write(ctx, l.logName, []*logging.LogEntry{le})
+}
+
+// prepare converts e to a LogEntry with its resource and returns it with
+// its size.
+func (l *Logger) prepare(e Entry) (*logging.LogEntry, int, error) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	le, err := e.toLogEntry(l.CommonLabels)
+	if err != nil {
+		return nil, 0, err
+	}
+	le.Resource = e.Resource
+	if le.Resource == nil {
+		le.Resource = l.Resource
+	}
+	b, err := json.Marshal(le)
+	if err != nil {
+		return nil, 0, fmt.Errorf("logger: %v", err)
+	}
+	return le, len(b), nil
+}
+
+// Logf logs a text entry with severity s, formatted as with fmt.Sprintf.
+func (l *Logger) Logf(s Severity, format string, args ...interface{}) {
+	l.Log(Entry{Severity: s, Payload: fmt.Sprintf(format, args...)})
+}
+
+// Debugf logs a text entry with severity Debug.
+func (l *Logger) Debugf(format string, args ...interface{}) { l.Logf(Debug, format, args...) }
+
+// Infof logs a text entry with severity Info.
+func (l *Logger) Infof(format string, args ...interface{}) { l.Logf(Info, format, args...) }
+
+// Warningf logs a text entry with severity Warning.
+func (l *Logger) Warningf(format string, args ...interface{}) { l.Logf(Warning, format, args...) }
+
+// Errorf logs a text entry with severity Error.
+func (l *Logger) Errorf(format string, args ...interface{}) { l.Logf(Error, format, args...) }
+
+// Criticalf logs a text entry with severity Critical.
+func (l *Logger) Criticalf(format string, args ...interface{}) { l.Logf(Critical, format, args...) }
+
+// Writer returns an io.Writer that logs each write as a text entry with
+// severity s, without its trailing newline.
+func (l *Logger) Writer(s Severity) io.Writer {
+	return &writer{l: l, s: s}
+}
+
+// StandardLogger returns a *log.Logger that logs each message as a text
+// entry with severity s.
+func (l *Logger) StandardLogger(s Severity) *log.Logger {
+	return log.New(l.Writer(s), "", 0)
+}
+
+type writer struct {
+	l *Logger
+	s Severity
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.l.Log(Entry{Severity: w.s, Payload: string(bytes.TrimSuffix(p, []byte("\n")))})
+	return len(p), nil
+}
+
+// bundler returns the bundler for entries of the log, creating it if
+// needed.
+func (c *Client) bundler(logName string) (*bundler.Bundler, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errClosed
+	}
+	if b, ok := c.bundlers[logName]; ok {
+		return b, nil
+	}
+	b := bundler.NewBundler(&pendingEntry{}, func(items interface{}) {
+		var entries []*logging.LogEntry
+		for _, pe := range items.([]*pendingEntry) {
+			entries = append(entries, pe.entry)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.RetryDeadline)
+		defer cancel()
+		if err := c.write(ctx, logName, entries); err != nil {
+			c.fail(err)
+		}
+	})
+	b.DelayThreshold = c.DelayThreshold
+	b.BundleCountThreshold = c.EntryCountThreshold
+	b.BundleByteThreshold = c.EntryByteThreshold
+	b.BundleByteLimit = maxWriteBytes
+	b.BufferedByteLimit = c.BufferedByteLimit
+	c.bundlers[logName] = b
+	return b, nil
+}
+
+// write writes entries to the log, retrying transient errors until ctx is
+// done.
+func (c *Client) write(ctx context.Context, logName string, entries []*logging.LogEntry) error {
+	req := &logging.WriteLogEntriesRequest{
+		LogName:        logName,
+		Entries:        entries,
+		PartialSuccess: true,
+	}
+	bo := c.Backoff
+	for {
+		_, err := c.svc.Entries.Write(req).Context(ctx).Do()
+		if err == nil {
+			return nil
+		}
+		if pe := partialError(err, entries); pe != nil {
+			return pe
+		}
+		if !retry.Transient(err) {
+			return err
+		}
+		if serr := gax.Sleep(ctx, bo.Pause()); serr != nil {
+			return err
+		}
+	}
+}
+
+// fail reports an error of a background write.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// Flush waits until all entries logged so far have been written or
+// failed, and returns the first error of background writes since the
+// previous call to Flush.
+func (c *Client) Flush() error {
+	c.mu.Lock()
+	var bs []*bundler.Bundler
+	for _, b := range c.bundlers {
+		bs = append(bs, b)
+	}
+	c.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, b := range bs {
+		wg.Add(1)
+		go func(b *bundler.Bundler) {
+			defer wg.Done()
+			b.Flush()
+		}(b)
+	}
+	wg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.err
+	c.err = nil
+	return err
+}
+
+// Close flushes the Client, as on shutdown. Entries logged after Close
+// are dropped, with an error.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.Flush()
+}
+
+// A PartialError is the error of a write in which some entries were
+// invalid. The other entries of the write were written.
+type PartialError struct {
+	// Failed holds the entries that were not written.
+	Failed []*FailedEntry
+
+	// Err is the error returned by the API.
+	Err error
+}
+
+// A FailedEntry is an entry that could not be written.
+type FailedEntry struct {
+	Entry *logging.LogEntry
+
+	// Code and Message are those of the google.rpc.Status of the entry.
+	Code    int
+	Message string
+}
+
+func (e *PartialError) Error() string {
+	if len(e.Failed) == 0 {
+		return e.Err.Error()
+	}
+	f := e.Failed[0]
+	return fmt.Sprintf("logger: %d entries not written; first: code %d: %s", len(e.Failed), f.Code, f.Message)
+}
+
+// partialError returns the PartialError for err, the error of writing
+// entries with partial success, or nil if err does not have the details of
+// failed entries.
+func partialError(err error, entries []*logging.LogEntry) *PartialError {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return nil
+	}
+	var body struct {
+		Error struct {
+			Details []struct {
+				Type           string `json:"@type"`
+				LogEntryErrors map[string]struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"logEntryErrors"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(e.Body), &body) != nil {
+		return nil
+	}
+	failed := map[int]*FailedEntry{}
+	for _, d := range body.Error.Details {
+		if d.Type != "type.googleapis.com/google.logging.v2.WriteLogEntriesPartialErrors" {
+			continue
+		}
+		for k, s := range d.LogEntryErrors {
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(entries) {
+				continue
+			}
+			failed[i] = &FailedEntry{Entry: entries[i], Code: s.Code, Message: s.Message}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	pe := &PartialError{Err: err}
+	for i := range entries {
+		if f, ok := failed[i]; ok {
+			pe.Failed = append(pe.Failed, f)
+		}
+	}
+	return pe
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/internal/testserver"
+	logging "google.golang.org/api/logging/v2"
+)
+
+// fakeLogging serves Entries.Write, recording the requests, and fails
+// requests as told by fail.
+type fakeLogging struct {
+	mu   sync.Mutex
+	reqs []*logging.WriteLogEntriesRequest
+	fail func(n int, req *logging.WriteLogEntriesRequest) (code int, body string)
+}
+
+func (f *fakeLogging) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v2/entries:write" {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req logging.WriteLogEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	n := len(f.reqs)
+	f.reqs = append(f.reqs, &req)
+	f.mu.Unlock()
+	if f.fail != nil {
+		if code, body := f.fail(n, &req); code != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			fmt.Fprint(w, body)
+			return
+		}
+	}
+	fmt.Fprint(w, "{}")
+}
+
+func (f *fakeLogging) requests() []*logging.WriteLogEntriesRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*logging.WriteLogEntriesRequest(nil), f.reqs...)
+}
+
+func TestBatchesPerLog(t *testing.T) {
+	f := &fakeLogging{}
+	svc, done := testserver.NewService(t, f, logging.NewService)
+	defer done()
+	c := NewClient(svc.(*logging.Service), "projects/p")
+	c.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	a := c.Logger("a/b")
+	a.CommonLabels = map[string]string{"app": "test"}
+	b := c.Logger("b")
+	gce := &logging.MonitoredResource{Type: "gce_instance", Labels: map[string]string{"instance_id": "1"}}
+	a.Infof("one")
+	b.Log(Entry{Payload: "two"})
+	a.Log(Entry{Payload: "three", Resource: gce})
+	a.Warningf("four")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	for _, req := range f.requests() {
+		if !req.PartialSuccess {
+			t.Error("PartialSuccess not set")
+		}
+		if req.Resource != nil {
+			t.Errorf("request has resource: %+v", req.Resource)
+		}
+		for _, e := range req.Entries {
+			if e.LogName != "" {
+				t.Errorf("entry has log name: %+v", e)
+			}
+			got[req.LogName] = append(got[req.LogName], e.Resource.Type+" "+e.Severity+":"+e.TextPayload)
+		}
+	}
+	want := map[string][]string{
+		"projects/p/logs/a%2Fb": {"global INFO:one", "gce_instance :three", "global WARNING:four"},
+		"projects/p/logs/b":     {"global :two"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	a.Infof("late")
+	if err := c.Flush(); err != errClosed {
+		t.Errorf("got %v, want errClosed", err)
+	}
+}
+
+func TestStandardLogger(t *testing.T) {
+	f := &fakeLogging{}
+	svc, done := testserver.NewService(t, f, logging.NewService)
+	defer done()
+	c := NewClient(svc.(*logging.Service), "projects/p")
+	c.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	lg := c.Logger("std")
+	lg.StandardLogger(Error).Printf("disk %s full", "sda")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reqs := f.requests()
+	if len(reqs) != 1 || len(reqs[0].Entries) != 1 {
+		t.Fatalf("got %d requests, want 1 with 1 entry", len(reqs))
+	}
+	e := reqs[0].Entries[0]
+	if e.Severity != "ERROR" || e.TextPayload != "disk sda full" {
+		t.Errorf("got %s %q, want ERROR %q", e.Severity, e.TextPayload, "disk sda full")
+	}
+}
+
+func TestPartialError(t *testing.T) {
+	f := &fakeLogging{fail: func(int, *logging.WriteLogEntriesRequest) (int, string) {
+		return http.StatusBadRequest, `{"error": {
+			"code": 400,
+			"message": "Log entry with size 300K exceeds maximum size of 256K",
+			"details": [{
+				"@type": "type.googleapis.com/google.logging.v2.WriteLogEntriesPartialErrors",
+				"logEntryErrors": {"2": {"code": 3, "message": "too big"}, "0": {"code": 3, "message": "bad label"}}
+			}]
+		}}`
+	}}
+	svc, done := testserver.NewService(t, f, logging.NewService)
+	defer done()
+	c := NewClient(svc.(*logging.Service), "projects/p")
+	c.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	var onError []error
+	c.OnError = func(err error) { onError = append(onError, err) }
+	lg := c.Logger("l")
+	for _, s := range []string{"a", "b", "c"} {
+		lg.Log(Entry{Payload: s})
+	}
+	err := c.Flush()
+	pe, ok := err.(*PartialError)
+	if !ok {
+		t.Fatalf("got %v, want *PartialError", err)
+	}
+	var got []string
+	for _, fe := range pe.Failed {
+		got = append(got, fe.Entry.TextPayload+":"+fe.Message)
+	}
+	if want := []string{"a:bad label", "c:too big"}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(onError) != 1 || onError[0] != err {
+		t.Errorf("OnError got %v, want [%v]", onError, err)
+	}
+	if len(f.requests()) != 1 {
+		t.Errorf("got %d requests, want 1", len(f.requests()))
+	}
+}
+
+func TestLogSyncRetries(t *testing.T) {
+	f := &fakeLogging{fail: func(n int, _ *logging.WriteLogEntriesRequest) (int, string) {
+		if n < 2 {
+			return http.StatusServiceUnavailable, `{"error": {"code": 503, "message": "unavailable"}}`
+		}
+		return 0, ""
+	}}
+	svc, done := testserver.NewService(t, f, logging.NewService)
+	defer done()
+	c := NewClient(svc.(*logging.Service), "projects/p")
+	c.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	if err := c.Logger("l").LogSync(context.Background(), Entry{Payload: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(f.requests()); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+
+	f.fail = func(int, *logging.WriteLogEntriesRequest) (int, string) {
+		return http.StatusForbidden, `{"error": {"code": 403, "message": "denied"}}`
+	}
+	if err := c.Logger("l").LogSync(context.Background(), Entry{Payload: "x"}); err == nil {
+		t.Error("got nil, want error")
+	}
+}
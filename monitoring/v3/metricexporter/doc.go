@@ -0,0 +1,27 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metricexporter exports custom metrics to Cloud Monitoring with
+// the REST API (google.golang.org/api/monitoring/v3).
+//
+// An Exporter aggregates gauges, counters and distributions in memory, and
+// periodically writes one point of each time series:
+//
+//	e := metricexporter.NewExporter(svc, "projects/my-project")
+//	requests, err := e.Counter(metricexporter.Metric{
+//		Type:   "custom.googleapis.com/http/request_count",
+//		Labels: []string{"code"},
+//	})
+//	...
+//	go e.Run(ctx)
+//	requests.Add(map[string]string{"code": "200"}, 1)
+//
+// The descriptors of metrics are created before their first points are
+// written. Cumulative series start when they are first added to. Points of
+// a series are written at most once every MinSamplePeriod, and at most 200
+// series are written per request, as Cloud Monitoring requires. The errors
+// of individual series are reported to the OnError callback.
+//
+// This package is experimental and subject to change without notice.
+package metricexporter
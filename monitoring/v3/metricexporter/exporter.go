@@ -0,0 +1,353 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metricexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const (
+	// DefaultInterval is the default time between flushes in Run.
+	DefaultInterval = time.Minute
+
+	// DefaultMinSamplePeriod is the default minimum time between two
+	// points of a time series. Cloud Monitoring rejects points of custom
+	// metrics written more often.
+	DefaultMinSamplePeriod = 10 * time.Second
+)
+
+// maxSeriesPerRequest is the maximum number of time series in a
+// TimeSeries.Create request.
+const maxSeriesPerRequest = 200
+
+// A SeriesError is the error of writing a time series.
+type SeriesError struct {
+	// Series is the time series, with the point that was not written.
+	Series *monitoring.TimeSeries
+	Err    error
+}
+
+func (e *SeriesError) Error() string {
+	return fmt.Sprintf("metricexporter: writing %s: %v", e.Series.Metric.Type, e.Err)
+}
+
+// An Exporter aggregates the values of custom metrics in memory and writes
+// them to Cloud Monitoring as time series with TimeSeries.Create.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Flush or Run.
+type Exporter struct {
+	// Resource is the monitored resource of the time series. The default
+	// is the "global" resource of the project.
+	Resource *monitoring.MonitoredResource
+
+	// Interval is the time between flushes in Run. The default is
+	// DefaultInterval, which is also used if Interval is zero.
+	Interval time.Duration
+
+	// MinSamplePeriod is the minimum time between two points of a time
+	// series. Series written less than MinSamplePeriod ago are left for a
+	// later flush. The default is DefaultMinSamplePeriod.
+	MinSamplePeriod time.Duration
+
+	// OnError, if non-nil, is called with the error of each time series
+	// that could not be written, or whose metric descriptor could not be
+	// created.
+	OnError func(err *SeriesError)
+
+	svc     *monitoring.Service
+	project string
+
+	flushMu sync.Mutex // held by Flush
+
+	mu      sync.Mutex
+	metrics map[string]*metric // by type
+	series  map[string]*series // by seriesKey
+	now     func() time.Time
+}
+
+// NewExporter returns an Exporter writing time series of project, as in
+// "projects/my-project".
+func NewExporter(svc *monitoring.Service, project string) *Exporter {
+	return &Exporter{
+		Resource: &monitoring.MonitoredResource{
+			Type:   "global",
+			Labels: map[string]string{"project_id": strings.TrimPrefix(project, "projects/")},
+		},
+		Interval:        DefaultInterval,
+		MinSamplePeriod: DefaultMinSamplePeriod,
+		svc:             svc,
+		project:         project,
+		metrics:         map[string]*metric{},
+		series:          map[string]*series{},
+		now:             time.Now,
+	}
+}
+
+// Gauge returns the gauge of the metric, a DOUBLE GAUGE metric.
+func (e *Exporter) Gauge(m Metric) (*Gauge, error) {
+	mm, err := e.register(m, "GAUGE", "DOUBLE", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Gauge{e: e, m: mm}, nil
+}
+
+// Counter returns the counter of the metric, an INT64 CUMULATIVE metric.
+func (e *Exporter) Counter(m Metric) (*Counter, error) {
+	mm, err := e.register(m, "CUMULATIVE", "INT64", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Counter{e: e, m: mm}, nil
+}
+
+// Distribution returns the distribution of the metric, a DISTRIBUTION
+// CUMULATIVE metric whose values are counted in the buckets of opts, which
+// must have exactly one kind of buckets.
+func (e *Exporter) Distribution(m Metric, opts *monitoring.BucketOptions) (*Distribution, error) {
+	if err := checkBuckets(opts); err != nil {
+		return nil, err
+	}
+	mm, err := e.register(m, "CUMULATIVE", "DISTRIBUTION", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Distribution{e: e, m: mm}, nil
+}
+
+// register registers the metric, or returns it if it was registered with
+// the same kind and value type.
+func (e *Exporter) register(m Metric, kind, valueType string, buckets *monitoring.BucketOptions) (*metric, error) {
+	if m.Type == "" {
+		return nil, errors.New("metricexporter: metric has no type")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if mm, ok := e.metrics[m.Type]; ok {
+		if mm.kind != kind || mm.valueType != valueType {
+			return nil, fmt.Errorf("metricexporter: metric %s registered as %s %s", m.Type, mm.valueType, mm.kind)
+		}
+		return mm, nil
+	}
+	m.Labels = append([]string(nil), m.Labels...)
+	mm := &metric{Metric: m, kind: kind, valueType: valueType, buckets: buckets}
+	e.metrics[m.Type] = mm
+	return mm, nil
+}
+
+// update calls f with the series of m with the labels, creating it if
+// needed.
+func (e *Exporter) update(m *metric, labels map[string]string, f func(*series)) {
+	key := seriesKey(m.Type, labels)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.series[key]
+	if !ok {
+		s = &series{metric: m, labels: copyLabels(labels), start: e.now()}
+		e.series[key] = s
+	}
+	f(s)
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+// A pendingSeries is a time series being written.
+type pendingSeries struct {
+	s   *series
+	ts  *monitoring.TimeSeries
+	end time.Time
+}
+
+// Flush writes a point of every time series that was not written in the
+// last MinSamplePeriod, after creating the descriptors of new metrics. The
+// series are written in order of metric type and labels, in requests of at
+// most 200 series. Errors are reported to OnError; Flush returns the first
+// one.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	end := e.now()
+	e.mu.Lock()
+	var keys []string
+	for k, s := range e.series {
+		if s.lastEnd.IsZero() || end.Sub(s.lastEnd) >= e.MinSamplePeriod {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var pending []*pendingSeries
+	var newMetrics []*metric
+	seen := map[*metric]bool{}
+	for _, k := range keys {
+		s := e.series[k]
+		p := s.point(end)
+		if p == nil {
+			continue
+		}
+		pending = append(pending, &pendingSeries{
+			s: s,
+			ts: &monitoring.TimeSeries{
+				Metric:     &monitoring.Metric{Type: s.metric.Type, Labels: copyLabels(s.labels)},
+				Resource:   e.Resource,
+				MetricKind: s.metric.kind,
+				ValueType:  s.metric.valueType,
+				Points:     []*monitoring.Point{p},
+			},
+			end: end,
+		})
+		if !s.metric.created && !seen[s.metric] {
+			seen[s.metric] = true
+			newMetrics = append(newMetrics, s.metric)
+		}
+	}
+	e.mu.Unlock()
+
+	var firstErr error
+	report := func(ps *pendingSeries, err error) {
+		se := &SeriesError{Series: ps.ts, Err: err}
+		if firstErr == nil {
+			firstErr = se
+		}
+		if e.OnError != nil {
+			e.OnError(se)
+		}
+	}
+
+	failed := map[*metric]error{}
+	for _, m := range newMetrics {
+		if _, err := e.svc.Projects.MetricDescriptors.Create(e.project, m.descriptor(e.project)).Context(ctx).Do(); err != nil {
+			failed[m] = fmt.Errorf("creating metric descriptor: %v", err)
+			continue
+		}
+		e.mu.Lock()
+		m.created = true
+		e.mu.Unlock()
+	}
+	ready := pending[:0]
+	for _, ps := range pending {
+		if err := failed[ps.s.metric]; err != nil {
+			report(ps, err)
+			continue
+		}
+		ready = append(ready, ps)
+	}
+
+	for len(ready) > 0 {
+		n := len(ready)
+		if n > maxSeriesPerRequest {
+			n = maxSeriesPerRequest
+		}
+		batch := ready[:n]
+		ready = ready[n:]
+		req := &monitoring.CreateTimeSeriesRequest{}
+		for _, ps := range batch {
+			req.TimeSeries = append(req.TimeSeries, ps.ts)
+		}
+		_, err := e.svc.Projects.TimeSeries.Create(e.project, req).Context(ctx).Do()
+		var errs map[int]error
+		if err != nil {
+			errs = seriesErrors(err, len(batch))
+		}
+		e.mu.Lock()
+		for i, ps := range batch {
+			if errs[i] == nil {
+				ps.s.lastEnd = ps.end
+			}
+		}
+		e.mu.Unlock()
+		for i, ps := range batch {
+			if errs[i] != nil {
+				report(ps, errs[i])
+			}
+		}
+	}
+	return firstErr
+}
+
+// seriesErrors returns the errors of the n series of a request that failed
+// with err, by index. Cloud Monitoring lists the indexes of the failed
+// series in the error message, as in "One or more TimeSeries could not be
+// written: Field timeSeries[1].points[0].value had an invalid value:
+// timeSeries[1]; Points must be written in order: timeSeries[0,2-3]". If
+// the message has no indexes, all series failed with err.
+func seriesErrors(err error, n int) map[int]error {
+	errs := map[int]error{}
+	if e, ok := err.(*googleapi.Error); ok {
+		msg := e.Message
+		if i := strings.Index(msg, ": "); i >= 0 && strings.HasPrefix(msg, "One or more TimeSeries") {
+			msg = msg[i+2:]
+		}
+		for _, part := range strings.Split(msg, "; ") {
+			i := strings.LastIndex(part, ": timeSeries[")
+			if i < 0 || !strings.HasSuffix(part, "]") {
+				continue
+			}
+			perr := errors.New(part[:i])
+			for _, r := range strings.Split(part[i+len(": timeSeries["):len(part)-1], ",") {
+				lo, hi, ok := parseRange(r)
+				for j := lo; ok && j <= hi && j < n; j++ {
+					errs[j] = perr
+				}
+			}
+		}
+	}
+	if len(errs) == 0 {
+		for i := 0; i < n; i++ {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+// parseRange parses "3" or "2-5".
+func parseRange(s string) (lo, hi int, ok bool) {
+	los, his := s, s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		los, his = s[:i], s[i+1:]
+	}
+	lo, err1 := strconv.Atoi(los)
+	hi, err2 := strconv.Atoi(his)
+	if err1 != nil || err2 != nil || lo < 0 || hi < lo {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// Run calls Flush every Interval until ctx is done. Call Flush after Run
+// returns to write the last values.
+func (e *Exporter) Run(ctx context.Context) error {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			e.Flush(ctx)
+		}
+	}
+}
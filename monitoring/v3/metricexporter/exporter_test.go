@@ -0,0 +1,273 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metricexporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/internal/testserver"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// fakeMonitoring serves MetricDescriptors.Create and TimeSeries.Create
+// for project "p", recording the requests.
+type fakeMonitoring struct {
+	mu          sync.Mutex
+	descriptors []*monitoring.MetricDescriptor
+	requests    []*monitoring.CreateTimeSeriesRequest
+	fail        func(req *monitoring.CreateTimeSeriesRequest) (code int, message string)
+}
+
+func (f *fakeMonitoring) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/v3/projects/p/metricDescriptors":
+		var md monitoring.MetricDescriptor
+		if err := json.NewDecoder(r.Body).Decode(&md); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.descriptors = append(f.descriptors, &md)
+		json.NewEncoder(w).Encode(&md)
+	case "/v3/projects/p/timeSeries":
+		var req monitoring.CreateTimeSeriesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.requests = append(f.requests, &req)
+		if f.fail != nil {
+			if code, msg := f.fail(&req); code != 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(code)
+				fmt.Fprintf(w, `{"error": {"code": %d, "message": %q}}`, code, msg)
+				return
+			}
+		}
+		fmt.Fprint(w, "{}")
+	default:
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// fakeClock is a settable clock.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func TestFlush(t *testing.T) {
+	f := &fakeMonitoring{}
+	svc, done := testserver.NewService(t, f, monitoring.NewService)
+	defer done()
+	e := NewExporter(svc.(*monitoring.Service), "projects/p")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e.now = clock.now
+	ctx := context.Background()
+	g, err := e.Gauge(Metric{Type: "custom.googleapis.com/temp", Labels: []string{"room"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := e.Counter(Metric{Type: "custom.googleapis.com/requests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := e.Distribution(Metric{Type: "custom.googleapis.com/latency"}, &monitoring.BucketOptions{
+		ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{10, 100}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Gauge(Metric{Type: "custom.googleapis.com/requests"}); err == nil {
+		t.Error("registering counter as gauge: got nil, want error")
+	}
+
+	g.Set(map[string]string{"room": "a"}, 20)
+	g.Set(map[string]string{"room": "a"}, 21.5)
+	c.Add(nil, 2)
+	c.Add(nil, 3)
+	for _, v := range []float64{5, 50, 500} {
+		d.Record(nil, v)
+	}
+	clock.advance(time.Second)
+	if err := e.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.descriptors) != 3 || len(f.requests) != 1 {
+		t.Fatalf("got %d descriptors and %d requests, want 3 and 1", len(f.descriptors), len(f.requests))
+	}
+	got := map[string]*monitoring.Point{}
+	for _, ts := range f.requests[0].TimeSeries {
+		if ts.Resource.Type != "global" || ts.Resource.Labels["project_id"] != "p" {
+			t.Errorf("bad resource %+v", ts.Resource)
+		}
+		got[ts.Metric.Type] = ts.Points[0]
+	}
+	start, end := "2020-01-01T00:00:00Z", "2020-01-01T00:00:01Z"
+	v215, v5 := 21.5, int64(5)
+	want := map[string]*monitoring.Point{
+		"custom.googleapis.com/temp": {
+			Interval: &monitoring.TimeInterval{EndTime: end},
+			Value:    &monitoring.TypedValue{DoubleValue: &v215},
+		},
+		"custom.googleapis.com/requests": {
+			Interval: &monitoring.TimeInterval{StartTime: start, EndTime: end},
+			Value:    &monitoring.TypedValue{Int64Value: &v5},
+		},
+		"custom.googleapis.com/latency": {
+			Interval: &monitoring.TimeInterval{StartTime: start, EndTime: end},
+			Value: &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{
+				Count:                 3,
+				Mean:                  185,
+				SumOfSquaredDeviation: 180*180 + 135*135 + 315*315,
+				BucketOptions:         &monitoring.BucketOptions{ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{10, 100}}},
+				BucketCounts:          []int64{1, 1, 1},
+			}},
+		},
+	}
+	approx := cmp.Comparer(func(a, b float64) bool { return math.Abs(a-b) < 1e-6 })
+	if diff := cmp.Diff(want, got, approx); diff != "" {
+		t.Errorf("points mismatch (-want +got):\n%s", diff)
+	}
+
+	// Series are not written again before MinSamplePeriod, and descriptors
+	// are only created once.
+	clock.advance(time.Second)
+	if err := e.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 1 {
+		t.Errorf("got %d requests, want 1", len(f.requests))
+	}
+	clock.advance(DefaultMinSamplePeriod)
+	if err := e.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 2 || len(f.descriptors) != 3 {
+		t.Errorf("got %d requests and %d descriptors, want 2 and 3", len(f.requests), len(f.descriptors))
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	f := &fakeMonitoring{}
+	svc, done := testserver.NewService(t, f, monitoring.NewService)
+	defer done()
+	e := NewExporter(svc.(*monitoring.Service), "projects/p")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e.now = clock.now
+	g, err := e.Gauge(Metric{Type: "custom.googleapis.com/g", Labels: []string{"i"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 450; i++ {
+		g.Set(map[string]string{"i": fmt.Sprintf("%03d", i)}, float64(i))
+	}
+	clock.advance(time.Second)
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	next := 0
+	for _, req := range f.requests {
+		sizes = append(sizes, len(req.TimeSeries))
+		for _, ts := range req.TimeSeries {
+			if got, want := ts.Metric.Labels["i"], fmt.Sprintf("%03d", next); got != want {
+				t.Fatalf("got series %s, want %s", got, want)
+			}
+			next++
+		}
+	}
+	if want := []int{200, 200, 50}; !cmp.Equal(sizes, want) {
+		t.Errorf("got batch sizes %v, want %v", sizes, want)
+	}
+}
+
+func TestSeriesErrors(t *testing.T) {
+	f := &fakeMonitoring{fail: func(req *monitoring.CreateTimeSeriesRequest) (int, string) {
+		return http.StatusBadRequest, "One or more TimeSeries could not be written: " +
+			"Points must be written in order: timeSeries[0,2-3]; Unknown metric: timeSeries[5]"
+	}}
+	svc, done := testserver.NewService(t, f, monitoring.NewService)
+	defer done()
+	e := NewExporter(svc.(*monitoring.Service), "projects/p")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e.now = clock.now
+	var errs []*SeriesError
+	e.OnError = func(err *SeriesError) { errs = append(errs, err) }
+	g, err := e.Gauge(Metric{Type: "custom.googleapis.com/g", Labels: []string{"i"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		g.Set(map[string]string{"i": strconv.Itoa(i)}, 1)
+	}
+	clock.advance(time.Second)
+	if err := e.Flush(context.Background()); err == nil {
+		t.Fatal("got nil, want error")
+	}
+	var got []string
+	for _, se := range errs {
+		got = append(got, se.Series.Metric.Labels["i"]+": "+se.Err.Error())
+	}
+	want := []string{
+		"0: Points must be written in order",
+		"2: Points must be written in order",
+		"3: Points must be written in order",
+		"5: Unknown metric",
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The series that failed are written again at the next flush, the
+	// others after MinSamplePeriod.
+	f.fail = nil
+	clock.advance(time.Second)
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.requests[1].TimeSeries); n != 4 {
+		t.Errorf("got %d series, want 4", n)
+	}
+}
+
+func TestSeriesErrorsWithoutIndexes(t *testing.T) {
+	errs := seriesErrors(fmt.Errorf("network down"), 3)
+	if len(errs) != 3 {
+		t.Errorf("got %d errors, want 3", len(errs))
+	}
+}
+
+func TestRunZeroInterval(t *testing.T) {
+	// A zero Interval means the default.
+	e := &Exporter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.Run(ctx); err != context.Canceled {
+		t.Errorf("Run: got %v, want context.Canceled", err)
+	}
+}
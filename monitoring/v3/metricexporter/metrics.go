@@ -0,0 +1,247 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metricexporter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+// A Metric describes a custom metric.
+type Metric struct {
+	// Type is the type of the metric, as in
+	// "custom.googleapis.com/http/request_count".
+	Type string
+
+	// Labels are the keys of the labels of the metric.
+	Labels []string
+
+	Description string
+	DisplayName string
+
+	// Unit is the unit of the values, as in "By" or "ms".
+	Unit string
+}
+
+// A metric is a registered metric.
+type metric struct {
+	Metric
+	kind      string // GAUGE or CUMULATIVE
+	valueType string // DOUBLE, INT64 or DISTRIBUTION
+	buckets   *monitoring.BucketOptions
+	created   bool // whether its descriptor was created
+}
+
+func (m *metric) descriptor(project string) *monitoring.MetricDescriptor {
+	md := &monitoring.MetricDescriptor{
+		Name:        project + "/metricDescriptors/" + m.Type,
+		Type:        m.Type,
+		MetricKind:  m.kind,
+		ValueType:   m.valueType,
+		Description: m.Description,
+		DisplayName: m.DisplayName,
+		Unit:        m.Unit,
+	}
+	for _, l := range m.Labels {
+		md.Labels = append(md.Labels, &monitoring.LabelDescriptor{Key: l, ValueType: "STRING"})
+	}
+	return md
+}
+
+// A series holds the value of the time series of a metric with one set of
+// label values.
+type series struct {
+	metric  *metric
+	labels  map[string]string
+	start   time.Time // of cumulative series
+	lastEnd time.Time // of the last point written, or zero
+
+	double float64 // gauges
+	int64  int64   // counters
+
+	// Distributions. m2 is the sum of squared deviations from the mean.
+	count   int64
+	mean    float64
+	m2      float64
+	buckets []int64
+}
+
+// point returns the point of s at end, or nil if s has no new point to
+// write.
+func (s *series) point(end time.Time) *monitoring.Point {
+	if !end.After(s.lastEnd) {
+		return nil
+	}
+	iv := &monitoring.TimeInterval{EndTime: formatTime(end)}
+	if s.metric.kind == "CUMULATIVE" {
+		if !end.After(s.start) {
+			return nil
+		}
+		iv.StartTime = formatTime(s.start)
+	}
+	v := &monitoring.TypedValue{}
+	switch s.metric.valueType {
+	case "DOUBLE":
+		d := s.double
+		v.DoubleValue = &d
+	case "INT64":
+		n := s.int64
+		v.Int64Value = &n
+	case "DISTRIBUTION":
+		v.DistributionValue = &monitoring.Distribution{
+			Count:                 s.count,
+			Mean:                  s.mean,
+			SumOfSquaredDeviation: s.m2,
+			BucketOptions:         s.metric.buckets,
+			BucketCounts:          append([]int64(nil), s.buckets...),
+		}
+	}
+	return &monitoring.Point{Interval: iv, Value: v}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// seriesKey returns the key of the series of metric type typ with labels.
+func seriesKey(typ string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(typ)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\x00%s\x00%s", k, labels[k])
+	}
+	return b.String()
+}
+
+// A Gauge is a metric whose value is set to the latest measurement.
+type Gauge struct {
+	e *Exporter
+	m *metric
+}
+
+// Set sets the value of the series with the label values to v.
+func (g *Gauge) Set(labels map[string]string, v float64) {
+	g.e.update(g.m, labels, func(s *series) { s.double = v })
+}
+
+// A Counter is a cumulative metric whose value is the sum of the amounts
+// added since the series was first added to.
+type Counter struct {
+	e *Exporter
+	m *metric
+}
+
+// Add adds n, which should not be negative, to the series with the label
+// values.
+func (c *Counter) Add(labels map[string]string, n int64) {
+	c.e.update(c.m, labels, func(s *series) { s.int64 += n })
+}
+
+// A Distribution is a cumulative metric whose value is the distribution of
+// the values recorded since the series was first recorded to.
+type Distribution struct {
+	e *Exporter
+	m *metric
+}
+
+// Record records v in the series with the label values.
+func (d *Distribution) Record(labels map[string]string, v float64) {
+	d.e.update(d.m, labels, func(s *series) {
+		if s.buckets == nil {
+			s.buckets = make([]int64, numBuckets(d.m.buckets))
+		}
+		s.buckets[bucketIndex(d.m.buckets, v)]++
+		// Welford's algorithm.
+		s.count++
+		delta := v - s.mean
+		s.mean += delta / float64(s.count)
+		s.m2 += delta * (v - s.mean)
+	})
+}
+
+// checkBuckets reports whether exactly one kind of buckets is set in o,
+// with valid parameters.
+func checkBuckets(o *monitoring.BucketOptions) error {
+	if o == nil {
+		return errors.New("metricexporter: no bucket options")
+	}
+	n := 0
+	if b := o.ExplicitBuckets; b != nil {
+		n++
+		if !sort.Float64sAreSorted(b.Bounds) {
+			return errors.New("metricexporter: explicit bounds are not sorted")
+		}
+	}
+	if b := o.LinearBuckets; b != nil {
+		n++
+		if b.NumFiniteBuckets <= 0 || b.Width <= 0 {
+			return errors.New("metricexporter: bad linear buckets")
+		}
+	}
+	if b := o.ExponentialBuckets; b != nil {
+		n++
+		if b.NumFiniteBuckets <= 0 || b.GrowthFactor <= 1 || b.Scale <= 0 {
+			return errors.New("metricexporter: bad exponential buckets")
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("metricexporter: got %d kinds of buckets, want 1", n)
+	}
+	return nil
+}
+
+// numBuckets returns the number of buckets of o, including the underflow
+// and overflow buckets.
+func numBuckets(o *monitoring.BucketOptions) int {
+	switch {
+	case o.ExplicitBuckets != nil:
+		return len(o.ExplicitBuckets.Bounds) + 1
+	case o.LinearBuckets != nil:
+		return int(o.LinearBuckets.NumFiniteBuckets) + 2
+	default:
+		return int(o.ExponentialBuckets.NumFiniteBuckets) + 2
+	}
+}
+
+// bucketIndex returns the index of the bucket of o that v falls into.
+func bucketIndex(o *monitoring.BucketOptions, v float64) int {
+	switch {
+	case o.ExplicitBuckets != nil:
+		b := o.ExplicitBuckets.Bounds
+		return sort.Search(len(b), func(i int) bool { return b[i] > v })
+	case o.LinearBuckets != nil:
+		b := o.LinearBuckets
+		if v < b.Offset {
+			return 0
+		}
+		return clampBucket(math.Floor((v-b.Offset)/b.Width)+1, b.NumFiniteBuckets)
+	default:
+		b := o.ExponentialBuckets
+		if v < b.Scale {
+			return 0
+		}
+		return clampBucket(math.Floor(math.Log(v/b.Scale)/math.Log(b.GrowthFactor))+1, b.NumFiniteBuckets)
+	}
+}
+
+// clampBucket returns i, or the overflow bucket if i is beyond the n
+// finite buckets.
+func clampBucket(i float64, n int64) int {
+	if i > float64(n) {
+		return int(n) + 1
+	}
+	return int(i)
+}
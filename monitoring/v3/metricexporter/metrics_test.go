@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metricexporter
+
+import (
+	"testing"
+
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+func TestBucketIndex(t *testing.T) {
+	explicit := &monitoring.BucketOptions{ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{1, 5, 10}}}
+	linear := &monitoring.BucketOptions{LinearBuckets: &monitoring.Linear{NumFiniteBuckets: 3, Width: 10, Offset: 5}}
+	exponential := &monitoring.BucketOptions{ExponentialBuckets: &monitoring.Exponential{NumFiniteBuckets: 3, GrowthFactor: 2, Scale: 1}}
+	for _, test := range []struct {
+		opts *monitoring.BucketOptions
+		v    float64
+		want int
+	}{
+		{explicit, 0, 0},
+		{explicit, 1, 1},
+		{explicit, 4.9, 1},
+		{explicit, 5, 2},
+		{explicit, 10, 3},
+		{explicit, 100, 3},
+		{linear, 4, 0},
+		{linear, 5, 1},
+		{linear, 14.9, 1},
+		{linear, 15, 2},
+		{linear, 34.9, 3},
+		{linear, 35, 4},
+		{exponential, 0.5, 0},
+		{exponential, 1, 1},
+		{exponential, 1.9, 1},
+		{exponential, 2, 2},
+		{exponential, 7.9, 3},
+		{exponential, 8, 4},
+	} {
+		if got := bucketIndex(test.opts, test.v); got != test.want {
+			t.Errorf("%+v, %v: got %d, want %d", test.opts, test.v, got, test.want)
+		}
+	}
+	if got := numBuckets(explicit); got != 4 {
+		t.Errorf("explicit: got %d buckets, want 4", got)
+	}
+	if got := numBuckets(linear); got != 5 {
+		t.Errorf("linear: got %d buckets, want 5", got)
+	}
+}
+
+func TestCheckBuckets(t *testing.T) {
+	for _, opts := range []*monitoring.BucketOptions{
+		nil,
+		{},
+		{ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{2, 1}}},
+		{LinearBuckets: &monitoring.Linear{NumFiniteBuckets: 1}},
+		{ExponentialBuckets: &monitoring.Exponential{NumFiniteBuckets: 1, GrowthFactor: 1, Scale: 1}},
+		{
+			ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{1}},
+			LinearBuckets:   &monitoring.Linear{NumFiniteBuckets: 1, Width: 1},
+		},
+	} {
+		if err := checkBuckets(opts); err == nil {
+			t.Errorf("%+v: got nil, want error", opts)
+		}
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := seriesKey("m", map[string]string{"x": "1", "y": "2"})
+	b := seriesKey("m", map[string]string{"y": "2", "x": "1"})
+	c := seriesKey("m", map[string]string{"x": "12"})
+	if a != b {
+		t.Errorf("keys differ with label order: %q, %q", a, b)
+	}
+	if a == c {
+		t.Errorf("keys of different labels are equal: %q", a)
+	}
+}
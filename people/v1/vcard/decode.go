@@ -0,0 +1,380 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	people "google.golang.org/api/people/v1"
+)
+
+// A Decoder reads people from a stream of vCards.
+type Decoder struct {
+	lr *lineReader
+}
+
+// NewDecoder returns a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{lr: &lineReader{r: bufio.NewReader(r)}}
+}
+
+// Decode reads the next vCard, of version 3.0 or 4.0, and returns it as a
+// person. It returns io.EOF if there are no more vCards.
+func (d *Decoder) Decode() (*people.Person, error) {
+	s, err := d.lr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(s, "BEGIN:VCARD") {
+		return nil, d.errorf("got %q, want BEGIN:VCARD", s)
+	}
+	begin := d.lr.line
+	var props []*property
+	var version Version
+	for {
+		s, err := d.lr.readLine()
+		if err == io.EOF {
+			return nil, fmt.Errorf("vcard: line %d: vCard with no END", begin)
+		}
+		if err != nil {
+			return nil, err
+		}
+		p, err := parseProperty(s)
+		if err != nil {
+			return nil, d.errorf("%v", err)
+		}
+		if p.name == "END" {
+			if !strings.EqualFold(p.value, "VCARD") {
+				return nil, d.errorf("got END:%s, want END:VCARD", p.value)
+			}
+			break
+		}
+		switch p.name {
+		case "BEGIN":
+			return nil, d.errorf("nested BEGIN:%s", p.value)
+		case "VERSION":
+			version = Version(strings.TrimSpace(p.value))
+			if version != V3 && version != V4 {
+				return nil, d.errorf("unsupported vCard version %q", p.value)
+			}
+		default:
+			props = append(props, p)
+		}
+	}
+	if version == "" {
+		return nil, fmt.Errorf("vcard: line %d: vCard with no VERSION", begin)
+	}
+	return toPerson(props), nil
+}
+
+func (d *Decoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("vcard: line %d: %s", d.lr.line, fmt.Sprintf(format, args...))
+}
+
+// DecodeAll reads all the vCards of r.
+func DecodeAll(r io.Reader) ([]*people.Person, error) {
+	d := NewDecoder(r)
+	var ps []*people.Person
+	for {
+		p, err := d.Decode()
+		if err == io.EOF {
+			return ps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+}
+
+// toPerson returns the person described by the properties of a vCard.
+func toPerson(props []*property) *people.Person {
+	p := &people.Person{}
+	var fn string
+	orgs := make(map[string]*people.Organization)
+	for _, pr := range props {
+		switch pr.name {
+		case "UID":
+			if v := unescape(pr.value); strings.HasPrefix(v, "people/") {
+				p.ResourceName = v
+			}
+		case "FN":
+			if fn == "" {
+				fn = unescape(pr.value)
+			}
+		case "N":
+			if len(p.Names) == 0 {
+				p.Names = []*people.Name{decodeName(pr.value)}
+			}
+		case "EMAIL":
+			p.EmailAddresses = append(p.EmailAddresses, &people.EmailAddress{
+				Value:    unescape(pr.value),
+				Type:     decodeType(pr.types(), emailTypes),
+				Metadata: metadata(pr),
+			})
+		case "TEL":
+			v := unescape(pr.value)
+			if strings.HasPrefix(strings.ToLower(v), "tel:") {
+				v = v[len("tel:"):]
+			}
+			p.PhoneNumbers = append(p.PhoneNumbers, &people.PhoneNumber{
+				Value:    v,
+				Type:     decodePhoneType(pr.types()),
+				Metadata: metadata(pr),
+			})
+		case "ADR":
+			a := decodeAddress(pr.value)
+			a.Type = decodeType(pr.types(), addressTypes)
+			a.Metadata = metadata(pr)
+			p.Addresses = append(p.Addresses, a)
+		case "ORG", "TITLE", "ROLE":
+			o := orgs[pr.group]
+			if o == nil {
+				o = &people.Organization{}
+				orgs[pr.group] = o
+				p.Organizations = append(p.Organizations, o)
+			}
+			switch pr.name {
+			case "ORG":
+				parts := splitValue(pr.value, ';')
+				o.Name = unescape(parts[0])
+				if len(parts) > 1 {
+					o.Department = unescape(parts[1])
+				}
+			case "TITLE":
+				o.Title = unescape(pr.value)
+			case "ROLE":
+				o.JobDescription = unescape(pr.value)
+			}
+		case "BDAY":
+			if len(p.Birthdays) > 0 {
+				break
+			}
+			v := unescape(pr.value)
+			b := &people.Birthday{}
+			if d, ok := parseDate(v); ok && !hasValue(pr, "text") {
+				b.Date = d
+			} else {
+				b.Text = v
+			}
+			p.Birthdays = []*people.Birthday{b}
+		case "PHOTO":
+			if u := decodePhoto(pr); u != "" {
+				p.Photos = append(p.Photos, &people.Photo{Url: u, Metadata: metadata(pr)})
+			}
+		case "CATEGORIES":
+			for _, c := range splitValue(pr.value, ',') {
+				if c = strings.TrimSpace(unescape(c)); c == "" {
+					continue
+				}
+				if !strings.HasPrefix(c, contactGroupPrefix) {
+					c = contactGroupPrefix + c
+				}
+				p.Memberships = append(p.Memberships, &people.Membership{
+					ContactGroupMembership: &people.ContactGroupMembership{ContactGroupResourceName: c},
+				})
+			}
+		}
+	}
+	if len(p.Names) == 0 && fn != "" {
+		p.Names = []*people.Name{{GivenName: fn}}
+	}
+	return p
+}
+
+// contactGroupPrefix is the prefix of the resource names of contact groups.
+const contactGroupPrefix = "contactGroups/"
+
+// decodeName decodes the value of an N property.
+func decodeName(v string) *people.Name {
+	parts := splitValue(v, ';')
+	for len(parts) < 5 {
+		parts = append(parts, "")
+	}
+	// Each component may be a list.
+	c := func(i int) string {
+		var vs []string
+		for _, s := range splitValue(parts[i], ',') {
+			if s = unescape(s); s != "" {
+				vs = append(vs, s)
+			}
+		}
+		return strings.Join(vs, " ")
+	}
+	return &people.Name{
+		FamilyName:      c(0),
+		GivenName:       c(1),
+		MiddleName:      c(2),
+		HonorificPrefix: c(3),
+		HonorificSuffix: c(4),
+	}
+}
+
+// decodeAddress decodes the value of an ADR property.
+func decodeAddress(v string) *people.Address {
+	parts := splitValue(v, ';')
+	for len(parts) < 7 {
+		parts = append(parts, "")
+	}
+	c := func(i int) string {
+		// Lists become lines, as in multi-line street addresses.
+		var vs []string
+		for _, s := range splitValue(parts[i], ',') {
+			if s = unescape(s); s != "" {
+				vs = append(vs, s)
+			}
+		}
+		return strings.Join(vs, "\n")
+	}
+	return &people.Address{
+		PoBox:           c(0),
+		ExtendedAddress: c(1),
+		StreetAddress:   c(2),
+		City:            c(3),
+		Region:          c(4),
+		PostalCode:      c(5),
+		Country:         c(6),
+	}
+}
+
+// decodePhoto returns the URL of the photo of a PHOTO property, as a data
+// URL if the photo is inline.
+func decodePhoto(pr *property) string {
+	v := strings.Join(strings.Fields(unescape(pr.value)), "")
+	for _, enc := range pr.param("ENCODING") {
+		if strings.EqualFold(enc, "b") || strings.EqualFold(enc, "base64") {
+			typ := "jpeg"
+			if ts := pr.types(); len(ts) > 0 {
+				typ = strings.TrimPrefix(ts[0], "image/")
+			}
+			return "data:image/" + typ + ";base64," + v
+		}
+	}
+	return v
+}
+
+// metadata returns the metadata of the field of pr, or nil if there is
+// none.
+func metadata(pr *property) *people.FieldMetadata {
+	for _, t := range pr.types() {
+		if t == "pref" {
+			return &people.FieldMetadata{Primary: true}
+		}
+	}
+	for _, v := range pr.param("PREF") {
+		if n, err := strconv.Atoi(v); err == nil && n == 1 {
+			return &people.FieldMetadata{Primary: true}
+		}
+	}
+	return nil
+}
+
+// hasValue reports whether pr has the value type v.
+func hasValue(pr *property, v string) bool {
+	for _, pv := range pr.param("VALUE") {
+		if strings.EqualFold(pv, v) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	emailTypes   = []string{"home", "work", "other"}
+	addressTypes = []string{"home", "work", "other"}
+	phoneTypes   = []string{"home", "work", "mobile", "homeFax", "workFax", "otherFax", "pager", "workMobile", "workPager", "main", "googleVoice", "other"}
+
+	// ignoredTypes are vCard types that have no People API equivalent.
+	ignoredTypes = map[string]bool{
+		"pref": true, "internet": true, "x400": true, "voice": true, "text": true,
+		"textphone": true, "video": true, "msg": true, "postal": true, "parcel": true,
+		"dom": true, "intl": true,
+	}
+)
+
+// decodeType returns the People API type of a field with the given vCard
+// types: the first of known, or else the first type that is not ignored,
+// as a custom type.
+func decodeType(types []string, known []string) string {
+	for _, t := range types {
+		for _, k := range known {
+			if strings.EqualFold(t, k) {
+				return k
+			}
+		}
+	}
+	for _, t := range types {
+		if !ignoredTypes[t] {
+			return t
+		}
+	}
+	return ""
+}
+
+// decodePhoneType returns the People API type of a phone number with the
+// given vCard types.
+func decodePhoneType(types []string) string {
+	has := make(map[string]bool)
+	for _, t := range types {
+		has[t] = true
+	}
+	switch {
+	case has["fax"] && has["home"]:
+		return "homeFax"
+	case has["fax"] && has["work"]:
+		return "workFax"
+	case has["fax"]:
+		return "otherFax"
+	case has["cell"] && has["work"]:
+		return "workMobile"
+	case has["cell"]:
+		return "mobile"
+	case has["pager"] && has["work"]:
+		return "workPager"
+	}
+	return decodeType(types, phoneTypes)
+}
+
+// parseDate parses a date of a BDAY property: a complete or reduced date
+// of ISO 8601, with or without hyphens, or a date without a year, as in
+// --0412, and ignores a time.
+func parseDate(s string) (*people.Date, bool) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, 'T'); i >= 0 {
+		s = s[:i]
+	}
+	noYear := strings.HasPrefix(s, "--")
+	s = strings.Replace(strings.TrimPrefix(s, "--"), "-", "", -1)
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+	}
+	n := func(i, j int) int64 {
+		v, _ := strconv.Atoi(s[i:j])
+		return int64(v)
+	}
+	d := &people.Date{}
+	switch {
+	case noYear && len(s) == 4:
+		d.Month, d.Day = n(0, 2), n(2, 4)
+	case !noYear && len(s) == 8:
+		d.Year, d.Month, d.Day = n(0, 4), n(4, 6), n(6, 8)
+	case !noYear && len(s) == 6:
+		d.Year, d.Month = n(0, 4), n(4, 6)
+	case !noYear && len(s) == 4:
+		d.Year = n(0, 4)
+	default:
+		return nil, false
+	}
+	if d.Month > 12 || d.Day > 31 || (d.Day > 0 && d.Month == 0) || (d.Year == 0 && d.Month == 0) {
+		return nil, false
+	}
+	return d, true
+}
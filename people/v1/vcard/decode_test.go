@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	people "google.golang.org/api/people/v1"
+)
+
+func TestDecode(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		want *people.Person
+	}{
+		{
+			name: "3.0",
+			in: `BEGIN:VCARD
+VERSION:3.0
+UID:people/c123
+FN:Dr. Jane Q. Doe
+N:Doe;Jane;Quinn;Dr.;
+EMAIL;TYPE=INTERNET,WORK,pref:jane@example.com
+EMAIL;TYPE=INTERNET:jane@example.org
+TEL;TYPE=CELL:+1 555 0100
+TEL;TYPE=WORK,FAX:+1 555 0199
+ADR;TYPE=HOME:;Apt 4;1 Main St,Floor 2;Springfield;IL;62701;USA
+ORG:Example Inc.;Research
+TITLE:Scientist
+item1.ORG:Volunteers
+item1.ROLE:Treasurer
+BDAY:1980-04-12
+PHOTO;ENCODING=b;TYPE=PNG:iVBORw0K
+ Ggo=
+CATEGORIES:friends,contactGroups/family
+NOTE:dropped
+END:VCARD
+`,
+			want: &people.Person{
+				ResourceName: "people/c123",
+				Names: []*people.Name{{
+					FamilyName:      "Doe",
+					GivenName:       "Jane",
+					MiddleName:      "Quinn",
+					HonorificPrefix: "Dr.",
+				}},
+				EmailAddresses: []*people.EmailAddress{
+					{Value: "jane@example.com", Type: "work", Metadata: &people.FieldMetadata{Primary: true}},
+					{Value: "jane@example.org"},
+				},
+				PhoneNumbers: []*people.PhoneNumber{
+					{Value: "+1 555 0100", Type: "mobile"},
+					{Value: "+1 555 0199", Type: "workFax"},
+				},
+				Addresses: []*people.Address{{
+					Type:            "home",
+					ExtendedAddress: "Apt 4",
+					StreetAddress:   "1 Main St\nFloor 2",
+					City:            "Springfield",
+					Region:          "IL",
+					PostalCode:      "62701",
+					Country:         "USA",
+				}},
+				Organizations: []*people.Organization{
+					{Name: "Example Inc.", Department: "Research", Title: "Scientist"},
+					{Name: "Volunteers", JobDescription: "Treasurer"},
+				},
+				Birthdays: []*people.Birthday{{Date: &people.Date{Year: 1980, Month: 4, Day: 12}}},
+				Photos:    []*people.Photo{{Url: "data:image/png;base64,iVBORw0KGgo="}},
+				Memberships: []*people.Membership{
+					{ContactGroupMembership: &people.ContactGroupMembership{ContactGroupResourceName: "contactGroups/friends"}},
+					{ContactGroupMembership: &people.ContactGroupMembership{ContactGroupResourceName: "contactGroups/family"}},
+				},
+			},
+		},
+		{
+			name: "4.0",
+			in: "BEGIN:VCARD\r\n" +
+				"VERSION:4.0\r\n" +
+				"UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1\r\n" +
+				"FN:Pat\r\n" +
+				"EMAIL;TYPE=home;PREF=1:pat@example.com\r\n" +
+				"TEL;VALUE=uri;TYPE=\"voice,work\":tel:+1-555-0100\r\n" +
+				"BDAY:--0412\r\n" +
+				"PHOTO:https://example.com/pat.jpg\r\n" +
+				"END:VCARD\r\n",
+			want: &people.Person{
+				Names: []*people.Name{{GivenName: "Pat"}},
+				EmailAddresses: []*people.EmailAddress{
+					{Value: "pat@example.com", Type: "home", Metadata: &people.FieldMetadata{Primary: true}},
+				},
+				PhoneNumbers: []*people.PhoneNumber{{Value: "+1-555-0100", Type: "work"}},
+				Birthdays:    []*people.Birthday{{Date: &people.Date{Month: 4, Day: 12}}},
+				Photos:       []*people.Photo{{Url: "https://example.com/pat.jpg"}},
+			},
+		},
+		{
+			name: "text birthday",
+			in:   "BEGIN:VCARD\nVERSION:4.0\nFN:A\nBDAY;VALUE=text:circa 1800\nEND:VCARD\n",
+			want: &people.Person{
+				Names:     []*people.Name{{GivenName: "A"}},
+				Birthdays: []*people.Birthday{{Text: "circa 1800"}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDecoder(strings.NewReader(test.in))
+			got, err := d.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if _, err := d.Decode(); err != io.EOF {
+				t.Errorf("second Decode: got %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	in := "BEGIN:VCARD\nVERSION:3.0\nN:A;;;;\nEND:VCARD\n\nBEGIN:VCARD\nVERSION:4.0\nFN:B\nEND:VCARD\n"
+	ps, err := DecodeAll(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range ps {
+		got = append(got, p.Names[0].FamilyName+p.Names[0].GivenName)
+	}
+	if want := []string{"A", "B"}; !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"FN:A\n", "vcard: line 1: got \"FN:A\", want BEGIN:VCARD"},
+		{"BEGIN:VCARD\nVERSION:3.0\nFN:A\n", "vcard: line 1: vCard with no END"},
+		{"BEGIN:VCARD\nFN:A\nEND:VCARD\n", "vcard: line 1: vCard with no VERSION"},
+		{"BEGIN:VCARD\nVERSION:2.1\nEND:VCARD\n", "vcard: line 2: unsupported vCard version \"2.1\""},
+		{"BEGIN:VCARD\nVERSION:3.0\nBEGIN:VCARD\n", "vcard: line 3: nested BEGIN:VCARD"},
+		{"BEGIN:VCARD\nVERSION:3.0\nFN\nEND:VCARD\n", "vcard: line 3: missing property name"},
+	} {
+		_, err := NewDecoder(strings.NewReader(test.in)).Decode()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%q: got error %v, want %q", test.in, err, test.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want *people.Date
+	}{
+		{"19800412", &people.Date{Year: 1980, Month: 4, Day: 12}},
+		{"1980-04-12", &people.Date{Year: 1980, Month: 4, Day: 12}},
+		{"1980-04-12T10:00:00Z", &people.Date{Year: 1980, Month: 4, Day: 12}},
+		{"1980-04", &people.Date{Year: 1980, Month: 4}},
+		{"1980", &people.Date{Year: 1980}},
+		{"--0412", &people.Date{Month: 4, Day: 12}},
+		{"--04-12", &people.Date{Month: 4, Day: 12}},
+		{"19801312", nil},
+		{"April 12", nil},
+		{"--04", nil},
+	} {
+		got, ok := parseDate(test.in)
+		if ok != (test.want != nil) || !cmp.Equal(got, test.want) {
+			t.Errorf("parseDate(%q) = %+v, %t, want %+v", test.in, got, ok, test.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vcard converts contacts of the People API
+// (google.golang.org/api/people/v1) to and from vCards, and keeps a local
+// copy of the contacts of a user in sync.
+//
+// A Decoder reads vCards of version 3.0 (RFC 2426) and 4.0 (RFC 6350) as
+// people, and an Encoder writes people as vCards of either version. The
+// names, email addresses, phone numbers, addresses, organizations,
+// birthdays, photos and contact group memberships of a person are
+// converted; other fields and properties are dropped.
+//
+// A Syncer lists the contacts that changed since its last call, starting
+// over when the sync token has expired, and writes contacts back. For
+// example, to export the changed contacts of a user:
+//
+//	s := vcard.NewSyncer(svc)
+//	enc := vcard.NewEncoder(w, vcard.V4)
+//	token, full, err := s.List(ctx, token, func(p *people.Person) error {
+//		if p.Metadata != nil && p.Metadata.Deleted {
+//			return deleteLocal(p.ResourceName)
+//		}
+//		return enc.Encode(p)
+//	})
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	if full {
+//		// TODO: Delete the local contacts that were not listed.
+//	}
+//
+// This package is experimental and subject to change without notice.
+package vcard
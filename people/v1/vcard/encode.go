@@ -0,0 +1,261 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	people "google.golang.org/api/people/v1"
+)
+
+// An Encoder writes people as vCards.
+type Encoder struct {
+	w io.Writer
+	v Version
+}
+
+// NewEncoder returns an Encoder that writes vCards of version v to w.
+func NewEncoder(w io.Writer, v Version) *Encoder {
+	return &Encoder{w: w, v: v}
+}
+
+// Encode writes p as a vCard. The resource name of p is its UID, and the
+// contact groups it is a member of are its categories. Default photos are
+// left out.
+func (e *Encoder) Encode(p *people.Person) error {
+	if e.v != V3 && e.v != V4 {
+		return fmt.Errorf("vcard: unsupported vCard version %q", e.v)
+	}
+	for _, pr := range e.properties(p) {
+		if err := writeLine(e.w, pr.format()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// properties returns the properties of the vCard of p.
+func (e *Encoder) properties(p *people.Person) []*property {
+	props := []*property{
+		{name: "BEGIN", value: "VCARD"},
+		{name: "VERSION", value: string(e.v)},
+	}
+	add := func(name string, params []param, value string) *property {
+		pr := &property{name: name, params: params, value: value}
+		props = append(props, pr)
+		return pr
+	}
+	if p.ResourceName != "" {
+		add("UID", nil, escape(p.ResourceName))
+	}
+
+	var name *people.Name
+	if len(p.Names) > 0 {
+		name = p.Names[0]
+	}
+	add("FN", nil, escape(formattedName(p, name)))
+	if name != nil {
+		add("N", nil, strings.Join([]string{
+			escape(name.FamilyName),
+			escape(name.GivenName),
+			escape(name.MiddleName),
+			escape(name.HonorificPrefix),
+			escape(name.HonorificSuffix),
+		}, ";"))
+	} else if e.v == V3 {
+		// N is required in vCard 3.0.
+		add("N", nil, ";;;;")
+	}
+
+	for _, a := range p.EmailAddresses {
+		add("EMAIL", e.typeParams(encodeType(a.Type), a.Metadata), escape(a.Value))
+	}
+	for _, n := range p.PhoneNumbers {
+		add("TEL", e.typeParams(encodePhoneType(n.Type), n.Metadata), escape(n.Value))
+	}
+	for _, a := range p.Addresses {
+		add("ADR", e.typeParams(encodeType(a.Type), a.Metadata), strings.Join([]string{
+			escape(a.PoBox),
+			escape(a.ExtendedAddress),
+			escapeLines(a.StreetAddress),
+			escape(a.City),
+			escape(a.Region),
+			escape(a.PostalCode),
+			escape(a.Country),
+		}, ";"))
+	}
+	for i, o := range p.Organizations {
+		var group string
+		if i > 0 {
+			// Properties of the same organization are grouped together.
+			group = "org" + strconv.Itoa(i+1)
+		}
+		if o.Name != "" || o.Department != "" {
+			v := escape(o.Name)
+			if o.Department != "" {
+				v += ";" + escape(o.Department)
+			}
+			add("ORG", nil, v).group = group
+		}
+		if o.Title != "" {
+			add("TITLE", nil, escape(o.Title)).group = group
+		}
+		if o.JobDescription != "" {
+			add("ROLE", nil, escape(o.JobDescription)).group = group
+		}
+	}
+	for _, b := range p.Birthdays {
+		if d := b.Date; d != nil && (d.Year != 0 || (d.Month != 0 && d.Day != 0)) {
+			add("BDAY", nil, e.formatDate(d))
+			break
+		}
+		if b.Text != "" && e.v == V4 {
+			add("BDAY", []param{{name: "VALUE", values: []string{"text"}}}, escape(b.Text))
+			break
+		}
+	}
+	for _, ph := range p.Photos {
+		if ph.Default || ph.Url == "" {
+			continue
+		}
+		params, v := e.encodePhoto(ph.Url)
+		add("PHOTO", params, v)
+	}
+	var cats []string
+	for _, m := range p.Memberships {
+		if g := m.ContactGroupMembership; g != nil {
+			id := g.ContactGroupId
+			if id == "" {
+				id = strings.TrimPrefix(g.ContactGroupResourceName, contactGroupPrefix)
+			}
+			if id != "" {
+				cats = append(cats, escape(id))
+			}
+		}
+	}
+	if len(cats) > 0 {
+		add("CATEGORIES", nil, strings.Join(cats, ","))
+	}
+	return append(props, &property{name: "END", value: "VCARD"})
+}
+
+// formattedName returns the formatted name of p, which has the given name.
+func formattedName(p *people.Person, name *people.Name) string {
+	if name != nil {
+		if name.DisplayName != "" {
+			return name.DisplayName
+		}
+		var parts []string
+		for _, s := range []string{name.HonorificPrefix, name.GivenName, name.MiddleName, name.FamilyName, name.HonorificSuffix} {
+			if s != "" {
+				parts = append(parts, s)
+			}
+		}
+		if len(parts) > 0 {
+			return strings.Join(parts, " ")
+		}
+	}
+	if len(p.Organizations) > 0 && p.Organizations[0].Name != "" {
+		return p.Organizations[0].Name
+	}
+	if len(p.EmailAddresses) > 0 {
+		return p.EmailAddresses[0].Value
+	}
+	return ""
+}
+
+// typeParams returns the parameters of a property with the given types and
+// field metadata.
+func (e *Encoder) typeParams(types []string, md *people.FieldMetadata) []param {
+	var params []param
+	primary := md != nil && md.Primary
+	if primary && e.v == V3 {
+		types = append(types, "pref")
+	}
+	if len(types) > 0 {
+		params = append(params, param{name: "TYPE", values: types})
+	}
+	if primary && e.v == V4 {
+		params = append(params, param{name: "PREF", values: []string{"1"}})
+	}
+	return params
+}
+
+// encodePhoto returns the parameters and value of a PHOTO property for the
+// photo with the given URL.
+func (e *Encoder) encodePhoto(url string) ([]param, string) {
+	if e.v == V4 {
+		return nil, url
+	}
+	const prefix = "data:image/"
+	if strings.HasPrefix(url, prefix) {
+		if i := strings.Index(url, ";base64,"); i > 0 {
+			typ := strings.ToUpper(url[len(prefix):i])
+			return []param{
+				{name: "ENCODING", values: []string{"b"}},
+				{name: "TYPE", values: []string{typ}},
+			}, url[i+len(";base64,"):]
+		}
+	}
+	return []param{{name: "VALUE", values: []string{"uri"}}}, url
+}
+
+// formatDate formats a date for a BDAY property.
+func (e *Encoder) formatDate(d *people.Date) string {
+	sep := ""
+	if e.v == V3 {
+		sep = "-"
+	}
+	switch {
+	case d.Year == 0:
+		return fmt.Sprintf("--%02d%s%02d", d.Month, sep, d.Day)
+	case d.Month == 0:
+		return fmt.Sprintf("%04d", d.Year)
+	case d.Day == 0:
+		return fmt.Sprintf("%04d-%02d", d.Year, d.Month)
+	}
+	return fmt.Sprintf("%04d%s%02d%s%02d", d.Year, sep, d.Month, sep, d.Day)
+}
+
+// encodeType returns the vCard types of a field with a People API type.
+func encodeType(t string) []string {
+	if t == "" {
+		return nil
+	}
+	return []string{strings.ToLower(t)}
+}
+
+// phoneTypeNames are the vCard types of the phone number types of the
+// People API that are not vCard types.
+var phoneTypeNames = map[string][]string{
+	"mobile":     {"cell"},
+	"homeFax":    {"home", "fax"},
+	"workFax":    {"work", "fax"},
+	"otherFax":   {"fax"},
+	"workMobile": {"work", "cell"},
+	"workPager":  {"work", "pager"},
+}
+
+// encodePhoneType returns the vCard types of a phone number with a People
+// API type.
+func encodePhoneType(t string) []string {
+	if ts, ok := phoneTypeNames[t]; ok {
+		return append([]string(nil), ts...)
+	}
+	return encodeType(t)
+}
+
+// escapeLines escapes text with lines for a component of a structured
+// value, where lines are a list.
+func escapeLines(s string) string {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i, l := range lines {
+		lines[i] = escape(l)
+	}
+	return strings.Join(lines, ",")
+}
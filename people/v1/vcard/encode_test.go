@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	people "google.golang.org/api/people/v1"
+)
+
+func testPerson() *people.Person {
+	return &people.Person{
+		ResourceName: "people/c123",
+		Names: []*people.Name{{
+			DisplayName: "Jane Doe",
+			FamilyName:  "Doe",
+			GivenName:   "Jane",
+		}},
+		EmailAddresses: []*people.EmailAddress{
+			{Value: "jane@example.com", Type: "work", Metadata: &people.FieldMetadata{Primary: true}},
+		},
+		PhoneNumbers: []*people.PhoneNumber{
+			{Value: "+1 555 0100", Type: "mobile"},
+		},
+		Addresses: []*people.Address{{
+			Type:          "home",
+			StreetAddress: "1 Main St\nFloor 2",
+			City:          "Springfield",
+			Country:       "USA",
+		}},
+		Organizations: []*people.Organization{
+			{Name: "Example, Inc.", Title: "Scientist"},
+			{Name: "Volunteers", JobDescription: "Treasurer"},
+		},
+		Birthdays: []*people.Birthday{{Date: &people.Date{Year: 1980, Month: 4, Day: 12}}},
+		Photos: []*people.Photo{
+			{Url: "https://example.com/default.jpg", Default: true},
+			{Url: "data:image/jpeg;base64,/9j/4AAQ"},
+		},
+		Memberships: []*people.Membership{
+			{ContactGroupMembership: &people.ContactGroupMembership{ContactGroupId: "friends", ContactGroupResourceName: "contactGroups/friends"}},
+		},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range []struct {
+		v    Version
+		want []string
+	}{
+		{V3, []string{
+			"BEGIN:VCARD",
+			"VERSION:3.0",
+			"UID:people/c123",
+			"FN:Jane Doe",
+			"N:Doe;Jane;;;",
+			"EMAIL;TYPE=work,pref:jane@example.com",
+			"TEL;TYPE=cell:+1 555 0100",
+			`ADR;TYPE=home:;;1 Main St,Floor 2;Springfield;;;USA`,
+			`ORG:Example\, Inc.`,
+			"TITLE:Scientist",
+			"org2.ORG:Volunteers",
+			"org2.ROLE:Treasurer",
+			"BDAY:1980-04-12",
+			"PHOTO;ENCODING=b;TYPE=JPEG:/9j/4AAQ",
+			"CATEGORIES:friends",
+			"END:VCARD",
+		}},
+		{V4, []string{
+			"BEGIN:VCARD",
+			"VERSION:4.0",
+			"UID:people/c123",
+			"FN:Jane Doe",
+			"N:Doe;Jane;;;",
+			"EMAIL;TYPE=work;PREF=1:jane@example.com",
+			"TEL;TYPE=cell:+1 555 0100",
+			`ADR;TYPE=home:;;1 Main St,Floor 2;Springfield;;;USA`,
+			`ORG:Example\, Inc.`,
+			"TITLE:Scientist",
+			"org2.ORG:Volunteers",
+			"org2.ROLE:Treasurer",
+			"BDAY:19800412",
+			"PHOTO:data:image/jpeg;base64,/9j/4AAQ",
+			"CATEGORIES:friends",
+			"END:VCARD",
+		}},
+	} {
+		var b strings.Builder
+		if err := NewEncoder(&b, test.v).Encode(testPerson()); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", test.v, diff)
+		}
+	}
+}
+
+func TestEncodeNoName(t *testing.T) {
+	p := &people.Person{EmailAddresses: []*people.EmailAddress{{Value: "a@example.com"}}}
+	var b strings.Builder
+	if err := NewEncoder(&b, V3).Encode(p); err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:a@example.com\r\nN:;;;;\r\nEMAIL:a@example.com\r\nEND:VCARD\r\n"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := NewEncoder(&b, "2.1").Encode(p); err == nil {
+		t.Error("Encode with version 2.1: got no error")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, v := range []Version{V3, V4} {
+		want := testPerson()
+		var b strings.Builder
+		if err := NewEncoder(&b, v).Encode(want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewDecoder(strings.NewReader(b.String())).Decode()
+		if err != nil {
+			t.Fatalf("%s: %v", v, err)
+		}
+		// Fields that vCards do not keep.
+		want.Names[0].DisplayName = ""
+		want.Photos = want.Photos[1:]
+		want.Memberships[0].ContactGroupMembership.ContactGroupId = ""
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", v, diff)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	people "google.golang.org/api/people/v1"
+)
+
+const (
+	// DefaultPersonFields are the fields a Syncer reads: those this package
+	// converts, and the metadata that tells deleted contacts.
+	DefaultPersonFields = "names,emailAddresses,phoneNumbers,addresses,organizations,birthdays,photos,memberships,metadata"
+
+	// DefaultPageSize is the default number of contacts a Syncer reads per
+	// request.
+	DefaultPageSize = 1000
+)
+
+// updatePersonFields are the fields this package converts that can be
+// updated. Photos are updated separately.
+var updatePersonFields = []string{"names", "emailAddresses", "phoneNumbers", "addresses", "organizations", "birthdays", "memberships"}
+
+// A Syncer reads the changes to the contacts of the authenticated user, and
+// writes contacts back, with the People API.
+//
+// The exported fields are only safe to modify prior to the first call to
+// List.
+type Syncer struct {
+	// PersonFields are the fields of the contacts that List reads. The
+	// default is DefaultPersonFields.
+	PersonFields string
+
+	// PageSize is the number of contacts List reads per request. The
+	// default is DefaultPageSize.
+	PageSize int64
+
+	svc *people.Service
+}
+
+// NewSyncer returns a Syncer that uses svc.
+func NewSyncer(svc *people.Service) *Syncer {
+	return &Syncer{
+		PersonFields: DefaultPersonFields,
+		PageSize:     DefaultPageSize,
+		svc:          svc,
+	}
+}
+
+// List calls f with each contact that changed since the List call that
+// returned syncToken, and returns the sync token for the next call.
+// Contacts deleted since then have Metadata.Deleted set.
+//
+// If syncToken is empty, or has expired, List calls f with every contact
+// and full is true: the caller should forget the contacts it did not see.
+func (s *Syncer) List(ctx context.Context, syncToken string, f func(*people.Person) error) (next string, full bool, err error) {
+	next, err = s.list(ctx, syncToken, f)
+	if syncToken != "" && isExpiredSyncToken(err) {
+		next, err = s.list(ctx, "", f)
+		syncToken = ""
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return next, syncToken == "", nil
+}
+
+func (s *Syncer) list(ctx context.Context, syncToken string, f func(*people.Person) error) (string, error) {
+	fields := s.PersonFields
+	if fields == "" {
+		fields = DefaultPersonFields
+	}
+	size := s.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	call := s.svc.People.Connections.List("people/me").PersonFields(fields).PageSize(size).RequestSyncToken(true)
+	if syncToken != "" {
+		call.SyncToken(syncToken)
+	}
+	var next string
+	err := call.Pages(ctx, func(res *people.ListConnectionsResponse) error {
+		for _, p := range res.Connections {
+			if err := f(p); err != nil {
+				return err
+			}
+		}
+		if res.NextSyncToken != "" {
+			next = res.NextSyncToken
+		}
+		return nil
+	})
+	return next, err
+}
+
+// isExpiredSyncToken reports whether err is the error of a sync token that
+// is too old.
+func isExpiredSyncToken(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	if e.Code == 410 {
+		return true
+	}
+	if e.Code != 400 {
+		return false
+	}
+	if strings.Contains(e.Body, "EXPIRED_SYNC_TOKEN") {
+		return true
+	}
+	msg := strings.ToLower(e.Message)
+	return strings.Contains(msg, "sync token") && strings.Contains(msg, "expired")
+}
+
+// Put writes p to the contacts of the authenticated user, and returns the
+// contact as written. If p has no resource name, Put creates a contact.
+// Otherwise it replaces the fields of the contact this package converts,
+// except memberships if p has none, since a contact must belong to a
+// group.
+//
+// An update is made only if the contact is unchanged since p was read, as
+// told by p.Etag; if p has no etag, as when it is decoded from a vCard, the
+// update overwrites the contact. A photo with a data URL is uploaded after
+// the contact is written; other photos are ignored.
+func (s *Syncer) Put(ctx context.Context, p *people.Person) (*people.Person, error) {
+	q := *p
+	// Photos are output only.
+	q.Photos = nil
+	var res *people.Person
+	var err error
+	if p.ResourceName == "" {
+		res, err = s.svc.People.CreateContact(&q).Context(ctx).Do()
+	} else {
+		if q.Etag == "" {
+			cur, err := s.svc.People.Get(p.ResourceName).PersonFields("metadata").Context(ctx).Do()
+			if err != nil {
+				return nil, err
+			}
+			q.Etag = cur.Etag
+		}
+		fields := updatePersonFields
+		if len(q.Memberships) == 0 {
+			fields = fields[:len(fields)-1]
+		}
+		res, err = s.svc.People.UpdateContact(p.ResourceName, &q).UpdatePersonFields(strings.Join(fields, ",")).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := photoData(p)
+	if err != nil || data == "" {
+		return res, err
+	}
+	fields := s.PersonFields
+	if fields == "" {
+		fields = DefaultPersonFields
+	}
+	ph, err := s.svc.People.UpdateContactPhoto(res.ResourceName, &people.UpdateContactPhotoRequest{
+		PhotoBytes:   data,
+		PersonFields: fields,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return ph.Person, nil
+}
+
+// photoData returns the base64 data of the first photo of p with a data
+// URL, or the empty string if there is none.
+func photoData(p *people.Person) (string, error) {
+	for _, ph := range p.Photos {
+		if !strings.HasPrefix(ph.Url, "data:") {
+			continue
+		}
+		i := strings.Index(ph.Url, ";base64,")
+		if i < 0 {
+			return "", errors.New("vcard: photo data URL is not base64")
+		}
+		return ph.Url[i+len(";base64,"):], nil
+	}
+	return "", nil
+}
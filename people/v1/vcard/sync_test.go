@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/internal/testserver"
+	people "google.golang.org/api/people/v1"
+)
+
+// fakePeople serves two pages of connections, fails requests with the sync
+// token "old" as expired, and records the writes of contacts.
+type fakePeople struct {
+	lists  []string // the sync tokens of list requests
+	writes []string // method, path and query of write requests
+	bodies []map[string]interface{}
+}
+
+func (f *fakePeople) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v1/people/me/connections":
+		if q.Get("requestSyncToken") != "true" || q.Get("personFields") != DefaultPersonFields {
+			http.Error(w, "bad query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		tok := q.Get("syncToken")
+		if q.Get("pageToken") == "" {
+			f.lists = append(f.lists, tok)
+		}
+		switch {
+		case tok == "old":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"code": 400, "message": "Sync token is expired. Clear local cache and retry call without the sync token.", "status": "FAILED_PRECONDITION", "details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "EXPIRED_SYNC_TOKEN"}]}}`))
+		case tok == "t1":
+			json.NewEncoder(w).Encode(&people.ListConnectionsResponse{
+				Connections:   []*people.Person{{ResourceName: "people/c3", Metadata: &people.PersonMetadata{Deleted: true}}},
+				NextSyncToken: "t2",
+			})
+		case q.Get("pageToken") == "":
+			json.NewEncoder(w).Encode(&people.ListConnectionsResponse{
+				Connections:   []*people.Person{{ResourceName: "people/c1"}},
+				NextPageToken: "p2",
+			})
+		default:
+			json.NewEncoder(w).Encode(&people.ListConnectionsResponse{
+				Connections:   []*people.Person{{ResourceName: "people/c2"}},
+				NextSyncToken: "t1",
+			})
+		}
+	case r.Method == "GET" && r.URL.Path == "/v1/people/c1":
+		json.NewEncoder(w).Encode(&people.Person{ResourceName: "people/c1", Etag: "e1"})
+	case r.Method == "POST" || r.Method == "PATCH":
+		f.writes = append(f.writes, r.Method+" "+r.URL.Path+" "+q.Get("updatePersonFields"))
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.bodies = append(f.bodies, body)
+		switch r.URL.Path {
+		case "/v1/people:createContact":
+			json.NewEncoder(w).Encode(&people.Person{ResourceName: "people/c9", Etag: "e9"})
+		case "/v1/people/c9:updateContactPhoto", "/v1/people/c1:updateContactPhoto":
+			json.NewEncoder(w).Encode(&people.UpdateContactPhotoResponse{
+				Person: &people.Person{ResourceName: "people/c9", Etag: "e10"},
+			})
+		default:
+			json.NewEncoder(w).Encode(&people.Person{ResourceName: "people/c1", Etag: "e2"})
+		}
+	default:
+		http.Error(w, "bad request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+func TestList(t *testing.T) {
+	for _, test := range []struct {
+		token     string
+		want      []string
+		wantNext  string
+		wantFull  bool
+		wantLists []string
+	}{
+		{"", []string{"people/c1", "people/c2"}, "t1", true, []string{""}},
+		{"t1", []string{"people/c3 deleted"}, "t2", false, []string{"t1"}},
+		{"old", []string{"people/c1", "people/c2"}, "t1", true, []string{"old", ""}},
+	} {
+		f := &fakePeople{}
+		svc, done := testserver.NewService(t, f, people.NewService)
+		s := NewSyncer(svc.(*people.Service))
+		var got []string
+		next, full, err := s.List(context.Background(), test.token, func(p *people.Person) error {
+			rn := p.ResourceName
+			if p.Metadata != nil && p.Metadata.Deleted {
+				rn += " deleted"
+			}
+			got = append(got, rn)
+			return nil
+		})
+		done()
+		if err != nil {
+			t.Errorf("%q: %v", test.token, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%q: contacts mismatch (-want +got):\n%s", test.token, diff)
+		}
+		if next != test.wantNext || full != test.wantFull {
+			t.Errorf("%q: got %q, %t, want %q, %t", test.token, next, full, test.wantNext, test.wantFull)
+		}
+		if diff := cmp.Diff(test.wantLists, f.lists); diff != "" {
+			t.Errorf("%q: list requests mismatch (-want +got):\n%s", test.token, diff)
+		}
+	}
+}
+
+func TestPutCreate(t *testing.T) {
+	f := &fakePeople{}
+	svc, done := testserver.NewService(t, f, people.NewService)
+	defer done()
+	s := NewSyncer(svc.(*people.Service))
+	p := &people.Person{
+		Names:  []*people.Name{{GivenName: "Jane"}},
+		Photos: []*people.Photo{{Url: "data:image/jpeg;base64,/9j/4AAQ"}},
+	}
+	got, err := s.Put(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ResourceName != "people/c9" || got.Etag != "e10" {
+		t.Errorf("got %s %s, want the person of the photo update", got.ResourceName, got.Etag)
+	}
+	want := []string{"POST /v1/people:createContact ", "PATCH /v1/people/c9:updateContactPhoto "}
+	if diff := cmp.Diff(want, f.writes); diff != "" {
+		t.Errorf("writes mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := f.bodies[0]["photos"]; ok {
+		t.Error("createContact request has photos")
+	}
+	if got := f.bodies[1]["photoBytes"]; got != "/9j/4AAQ" {
+		t.Errorf("photoBytes = %v, want /9j/4AAQ", got)
+	}
+	if len(p.Photos) != 1 {
+		t.Error("Put modified its argument")
+	}
+}
+
+func TestPutUpdate(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		p         *people.Person
+		wantMask  string
+		wantEtag  string
+		wantWrite int
+	}{
+		{
+			name:     "etag",
+			p:        &people.Person{ResourceName: "people/c1", Etag: "e0"},
+			wantMask: "names,emailAddresses,phoneNumbers,addresses,organizations,birthdays",
+			wantEtag: "e0",
+		},
+		{
+			name: "no etag",
+			p: &people.Person{
+				ResourceName: "people/c1",
+				Memberships: []*people.Membership{
+					{ContactGroupMembership: &people.ContactGroupMembership{ContactGroupResourceName: "contactGroups/myContacts"}},
+				},
+			},
+			wantMask: "names,emailAddresses,phoneNumbers,addresses,organizations,birthdays,memberships",
+			wantEtag: "e1",
+		},
+	} {
+		f := &fakePeople{}
+		svc, done := testserver.NewService(t, f, people.NewService)
+		s := NewSyncer(svc.(*people.Service))
+		got, err := s.Put(context.Background(), test.p)
+		done()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got.Etag != "e2" {
+			t.Errorf("%s: got etag %q, want e2", test.name, got.Etag)
+		}
+		want := []string{"PATCH /v1/people/c1:updateContact " + test.wantMask}
+		if diff := cmp.Diff(want, f.writes); diff != "" {
+			t.Errorf("%s: writes mismatch (-want +got):\n%s", test.name, diff)
+		}
+		if got := f.bodies[0]["etag"]; got != test.wantEtag {
+			t.Errorf("%s: etag = %v, want %s", test.name, got, test.wantEtag)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Version is a version of the vCard format.
+type Version string
+
+const (
+	// V3 is vCard 3.0, described in RFC 2426.
+	V3 Version = "3.0"
+
+	// V4 is vCard 4.0, described in RFC 6350.
+	V4 Version = "4.0"
+)
+
+// maxLineLen is the length in octets at which lines are folded.
+const maxLineLen = 75
+
+// A param is a parameter of a property.
+type param struct {
+	name   string // in upper case
+	values []string
+}
+
+// A property is a content line of a vCard.
+type property struct {
+	group  string
+	name   string // in upper case
+	params []param
+	value  string // as in the content line, with escapes
+}
+
+// param returns the values of the parameters of p with the given name.
+func (p *property) param(name string) []string {
+	var vs []string
+	for _, pa := range p.params {
+		if pa.name == name {
+			vs = append(vs, pa.values...)
+		}
+	}
+	return vs
+}
+
+// types returns the values of the TYPE parameters of p in lower case,
+// including the values of comma-separated lists in one value.
+func (p *property) types() []string {
+	var ts []string
+	for _, v := range p.param("TYPE") {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				ts = append(ts, t)
+			}
+		}
+	}
+	return ts
+}
+
+// A lineReader reads the unfolded content lines of a vCard stream.
+type lineReader struct {
+	r      *bufio.Reader
+	peeked string
+	ok     bool // whether peeked holds the next physical line
+	n      int  // the number of physical lines read
+	line   int  // the number of the first physical line of the last content line
+}
+
+// readLine returns the next content line that is not blank, or io.EOF.
+func (lr *lineReader) readLine() (string, error) {
+	for {
+		s, err := lr.physical()
+		if err != nil {
+			return "", err
+		}
+		lr.line = lr.n
+		for {
+			next, err := lr.peek()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if next == "" || (next[0] != ' ' && next[0] != '\t') {
+				break
+			}
+			lr.physical()
+			s += next[1:]
+		}
+		if strings.TrimSpace(s) != "" {
+			return s, nil
+		}
+	}
+}
+
+// physical returns the next physical line, without its line ending.
+func (lr *lineReader) physical() (string, error) {
+	s, err := lr.peek()
+	lr.ok = false
+	if err == nil {
+		lr.n++
+	}
+	return s, err
+}
+
+// peek returns the next physical line without consuming it.
+func (lr *lineReader) peek() (string, error) {
+	if lr.ok {
+		return lr.peeked, nil
+	}
+	s, err := lr.r.ReadString('\n')
+	if err == io.EOF && s == "" {
+		return "", io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+	if lr.n == 0 {
+		s = strings.TrimPrefix(s, "\ufeff")
+	}
+	lr.peeked, lr.ok = s, true
+	return s, nil
+}
+
+// parseProperty parses a content line.
+func parseProperty(s string) (*property, error) {
+	p := &property{}
+	i := strings.IndexAny(s, ":;")
+	if i <= 0 {
+		return nil, errors.New("missing property name")
+	}
+	p.name = strings.ToUpper(s[:i])
+	if j := strings.LastIndex(p.name, "."); j >= 0 {
+		p.group, p.name = p.name[:j], p.name[j+1:]
+	}
+	if p.name == "" {
+		return nil, errors.New("missing property name")
+	}
+	s = s[i:]
+	for s[0] == ';' {
+		s = s[1:]
+		var pa param
+		j := strings.IndexAny(s, "=;:")
+		if j < 0 {
+			return nil, errors.New("missing value")
+		}
+		pa.name = strings.ToUpper(strings.TrimSpace(s[:j]))
+		if s[j] != '=' {
+			// vCard 2.1 types have no parameter name.
+			pa.name, pa.values = "TYPE", []string{s[:j]}
+			p.params = append(p.params, pa)
+			s = s[j:]
+			continue
+		}
+		s = s[j+1:]
+		for {
+			var v string
+			if strings.HasPrefix(s, `"`) {
+				k := strings.IndexByte(s[1:], '"')
+				if k < 0 {
+					return nil, errors.New("unterminated quoted parameter value")
+				}
+				v, s = s[1:k+1], s[k+2:]
+			} else {
+				k := strings.IndexAny(s, ",;:")
+				if k < 0 {
+					return nil, errors.New("missing value")
+				}
+				v, s = s[:k], s[k:]
+			}
+			pa.values = append(pa.values, v)
+			if s == "" || s[0] != ',' {
+				break
+			}
+			s = s[1:]
+		}
+		p.params = append(p.params, pa)
+		if s == "" {
+			return nil, errors.New("missing value")
+		}
+	}
+	if s[0] != ':' {
+		return nil, fmt.Errorf("unexpected %q after parameters", s[0])
+	}
+	p.value = s[1:]
+	return p, nil
+}
+
+// splitValue splits the value of a property at the separators that are not
+// escaped, without unescaping the parts.
+func splitValue(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape returns the text of an escaped value.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+// escape escapes text for a value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// format returns the content line of p.
+func (p *property) format() string {
+	var b strings.Builder
+	if p.group != "" {
+		b.WriteString(p.group)
+		b.WriteByte('.')
+	}
+	b.WriteString(p.name)
+	for _, pa := range p.params {
+		b.WriteByte(';')
+		b.WriteString(pa.name)
+		b.WriteByte('=')
+		for i, v := range pa.values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			v = strings.Replace(v, `"`, "", -1)
+			if strings.ContainsAny(v, ",;:") {
+				v = `"` + v + `"`
+			}
+			b.WriteString(v)
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(p.value)
+	return b.String()
+}
+
+// writeLine writes a content line to w, folded to maxLineLen octets, with
+// CRLF line endings.
+func writeLine(w io.Writer, s string) error {
+	var b strings.Builder
+	limit := maxLineLen
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+		// The leading space counts.
+		limit = maxLineLen - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vcard
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseProperty(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want *property
+	}{
+		{"FN:Jane Doe", &property{name: "FN", value: "Jane Doe"}},
+		{
+			"item1.email;type=INTERNET,work;TYPE=pref:jane@example.com",
+			&property{group: "ITEM1", name: "EMAIL", params: []param{
+				{name: "TYPE", values: []string{"INTERNET", "work"}},
+				{name: "TYPE", values: []string{"pref"}},
+			}, value: "jane@example.com"},
+		},
+		{
+			`ADR;LABEL="1 Main St; Springfield":;;1 Main St;Springfield;;;`,
+			&property{name: "ADR", params: []param{
+				{name: "LABEL", values: []string{"1 Main St; Springfield"}},
+			}, value: ";;1 Main St;Springfield;;;"},
+		},
+		{
+			"TEL;HOME;VOICE:555-1234",
+			&property{name: "TEL", params: []param{
+				{name: "TYPE", values: []string{"HOME"}},
+				{name: "TYPE", values: []string{"VOICE"}},
+			}, value: "555-1234"},
+		},
+		{"NOTE:a:b", &property{name: "NOTE", value: "a:b"}},
+	} {
+		got, err := parseProperty(test.in)
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(property{}, param{})); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+}
+
+func TestParsePropertyErrors(t *testing.T) {
+	for _, in := range []string{
+		":value",
+		"FN",
+		"group.:value",
+		`EMAIL;TYPE="work:a@example.com`,
+		"EMAIL;TYPE=work",
+	} {
+		if _, err := parseProperty(in); err == nil {
+			t.Errorf("%q: got no error", in)
+		}
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	in := "\ufeffBEGIN:VCARD\r\nNOTE:one\r\n  two\r\n\tthree\r\n\r\nFN:x\nEND:VCARD"
+	lr := &lineReader{r: bufio.NewReader(strings.NewReader(in))}
+	type line struct {
+		S    string
+		Line int
+	}
+	var got []line
+	for {
+		s, err := lr.readLine()
+		if err != nil {
+			break
+		}
+		got = append(got, line{s, lr.line})
+	}
+	want := []line{
+		{"BEGIN:VCARD", 1},
+		{"NOTE:one twothree", 2},
+		{"FN:x", 6},
+		{"END:VCARD", 7},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	long := "NOTE:" + strings.Repeat("é", 50)
+	var b strings.Builder
+	if err := writeLine(&b, long); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("got %d lines, want a folded line", len(lines))
+	}
+	var unfolded string
+	for i, l := range lines {
+		if len(l) > maxLineLen {
+			t.Errorf("line %d has %d octets, want at most %d", i, len(l), maxLineLen)
+		}
+		if i > 0 {
+			if l[0] != ' ' {
+				t.Errorf("line %d does not start with a space", i)
+			}
+			l = l[1:]
+		}
+		unfolded += l
+	}
+	if unfolded != long {
+		t.Errorf("unfolded = %q, want %q", unfolded, long)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, s := range []string{"", "plain", `a,b;c\d`, "line 1\nline 2"} {
+		e := escape(s)
+		if got := unescape(e); got != s {
+			t.Errorf("unescape(escape(%q)) = %q", s, got)
+		}
+		if len(splitValue(e, ';')) != 1 || len(splitValue(e, ',')) != 1 {
+			t.Errorf("escape(%q) = %q has separators", s, e)
+		}
+	}
+	if got, want := splitValue(`a\;b;c;`, ';'), []string{`a\;b`, "c", ""}; !cmp.Equal(got, want) {
+		t.Errorf("splitValue = %q, want %q", got, want)
+	}
+}
@@ -1122,6 +1122,19 @@ type PubsubMessage struct {
 	// call.
 	MessageId string `json:"messageId,omitempty"`
 
+	// OrderingKey: If non-empty, identifies related messages for which
+	// publish order should be
+	// respected. If a `Subscription` has `enable_message_ordering` set to
+	// `true`,
+	// messages published with the same non-empty `ordering_key` value will
+	// be
+	// delivered to subscribers in the order in which they are received by
+	// the
+	// Pub/Sub system. All `PubsubMessage`s published in a given
+	// `PublishRequest`
+	// must specify the same `ordering_key` value.
+	OrderingKey string `json:"orderingKey,omitempty"`
+
 	// PublishTime: The time at which the message was published, populated
 	// by the server when
 	// it receives the `Publish` call. It must not be populated by
@@ -0,0 +1,33 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pubsubutil provides helpers for using the Cloud Pub/Sub REST API
+// (google.golang.org/api/pubsub/v1).
+//
+// PushHandler is an http.Handler for the endpoints of push subscriptions. It
+// verifies the OIDC token Pub/Sub sends with each request using a
+// TokenVerifier, decodes the message and acknowledges it if the handler
+// function succeeds:
+//
+//	h := &pubsubutil.PushHandler{
+//		Verifier:            pubsubutil.NewTokenVerifier(pubsubutil.GoogleCertsURL, nil),
+//		Audience:            "https://example.com/push",
+//		ServiceAccountEmail: "push@my-project.iam.gserviceaccount.com",
+//		Handle: func(ctx context.Context, msg *pubsubutil.PushMessage) error {
+//			return process(ctx, msg.Data)
+//		},
+//	}
+//	http.Handle("/push", h)
+//
+// Subscriber receives messages from pull subscriptions with the REST API,
+// where the gRPC streaming API is not available. It runs concurrent pull
+// loops, extends ack deadlines while messages are processed, batches acks
+// and nacks, and limits the number and size of outstanding messages.
+//
+// Publisher batches published messages into Publish requests, keeping the
+// order of messages with the same ordering key. Subscriptions with message
+// ordering enabled receive the messages of a key in that order.
+//
+// This package is experimental and subject to change without notice.
+package pubsubutil
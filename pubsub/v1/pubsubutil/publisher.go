@@ -0,0 +1,406 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/api/internal/retry"
+	pubsub "google.golang.org/api/pubsub/v1"
+	"google.golang.org/api/support/bundler"
+)
+
+const (
+	// DefaultPublishCountThreshold is the default number of messages sent
+	// in one Publish request.
+	DefaultPublishCountThreshold = 100
+
+	// DefaultPublishByteThreshold is the default size of the messages that
+	// triggers a Publish request.
+	DefaultPublishByteThreshold = 1e6
+
+	// DefaultPublishDelayThreshold is the default time messages wait for
+	// more messages to be batched with.
+	DefaultPublishDelayThreshold = 10 * time.Millisecond
+
+	// DefaultPublishRetryDeadline is the default time a Publisher keeps
+	// retrying a batch of messages.
+	DefaultPublishRetryDeadline = time.Minute
+)
+
+const (
+	// maxPublishCount and maxPublishBytes are the limits of a Publish
+	// request. The byte limit leaves room for the request's overhead.
+	maxPublishCount = 1000
+	maxPublishBytes = 9e6
+)
+
+var errPublisherStopped = errors.New("pubsubutil: Publisher is stopped")
+
+// ErrPublishingPaused is the error of messages published with an ordering
+// key after an earlier message with the key failed. Call
+// Publisher.ResumePublish to publish messages with the key again.
+type ErrPublishingPaused struct {
+	OrderingKey string
+}
+
+func (e ErrPublishingPaused) Error() string {
+	return fmt.Sprintf("pubsubutil: publishing for ordering key %q is paused after an error", e.OrderingKey)
+}
+
+// A Message is a message to publish.
+type Message struct {
+	Data       []byte
+	Attributes map[string]string
+
+	// OrderingKey, if non-empty, makes the Publisher send the messages with
+	// the same key in the order they were published: a batch of messages
+	// with the key is only sent once the previous one has been published.
+	// Subscriptions with message ordering enabled receive them in that
+	// order.
+	OrderingKey string
+}
+
+// A PublishResult holds the result of publishing a message.
+type PublishResult struct {
+	ready    chan struct{}
+	serverID string
+	err      error
+}
+
+// Ready returns a channel that is closed when the result is available.
+func (r *PublishResult) Ready() <-chan struct{} { return r.ready }
+
+// Get waits until the message has been published or failed, or ctx is done.
+// It returns the ID the server assigned to the message.
+func (r *PublishResult) Get(ctx context.Context) (serverID string, err error) {
+	select {
+	case <-r.ready:
+		return r.serverID, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (r *PublishResult) set(id string, err error) {
+	r.serverID, r.err = id, err
+	close(r.ready)
+}
+
+// A pendingMessage is a message waiting to be published.
+type pendingMessage struct {
+	msg  *pubsub.PubsubMessage
+	size int
+	res  *PublishResult
+}
+
+// A Publisher publishes messages to a topic in batches with the Publish
+// method of the REST API.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Publish.
+type Publisher struct {
+	// Once a batch has this many messages, send it. The default is
+	// DefaultPublishCountThreshold; the maximum is 1000.
+	CountThreshold int
+
+	// Once a batch has this many bytes of messages, send it. The default is
+	// DefaultPublishByteThreshold.
+	ByteThreshold int
+
+	// Starting from the time that the first message is added to a batch,
+	// once this delay has passed, send the batch. The default is
+	// DefaultPublishDelayThreshold.
+	DelayThreshold time.Duration
+
+	// MaxOutstandingMessages and MaxOutstandingBytes limit the number and
+	// total size of messages that have been passed to Publish but not yet
+	// published. Publish blocks while either limit is reached. Zero means
+	// no limit.
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+
+	// HandlerLimit is the maximum number of concurrent Publish requests for
+	// messages without an ordering key. Messages with an ordering key have
+	// at most one request in flight per key. The default is 10.
+	HandlerLimit int
+
+	// How long to keep retrying a batch that fails with transient errors.
+	// The default is DefaultPublishRetryDeadline.
+	RetryDeadline time.Duration
+
+	// Backoff controls the pauses between retries.
+	Backoff gax.Backoff
+
+	svc   *pubsub.Service
+	topic string
+
+	initOnce sync.Once
+	count    *semaphore.Weighted // nil if unlimited
+	bytes    *semaphore.Weighted // nil if unlimited
+
+	mu       sync.Mutex
+	stopped  bool
+	bundlers map[string]*keyBundler // by ordering key
+	paused   map[string]bool        // ordering keys paused after an error
+}
+
+// A keyBundler batches the messages with an ordering key.
+type keyBundler struct {
+	*bundler.Bundler
+	pending int // messages added and not yet published or failed
+}
+
+// NewPublisher returns a Publisher for the topic with the given full name,
+// as in "projects/p/topics/t".
+func NewPublisher(svc *pubsub.Service, topic string) *Publisher {
+	return &Publisher{
+		CountThreshold: DefaultPublishCountThreshold,
+		ByteThreshold:  DefaultPublishByteThreshold,
+		DelayThreshold: DefaultPublishDelayThreshold,
+		HandlerLimit:   10,
+		RetryDeadline:  DefaultPublishRetryDeadline,
+		svc:            svc,
+		topic:          topic,
+		bundlers:       map[string]*keyBundler{},
+		paused:         map[string]bool{},
+	}
+}
+
+func (p *Publisher) init() {
+	p.initOnce.Do(func() {
+		if p.MaxOutstandingMessages > 0 {
+			p.count = semaphore.NewWeighted(int64(p.MaxOutstandingMessages))
+		}
+		if p.MaxOutstandingBytes > 0 {
+			p.bytes = semaphore.NewWeighted(int64(p.MaxOutstandingBytes))
+		}
+	})
+}
+
+// Publish adds msg to a batch to be published and returns its result. It
+// blocks while the flow control limits are reached, until ctx is done.
+// Publish fails immediately with ErrPublishingPaused if msg has an ordering
+// key whose publishing is paused.
+func (p *Publisher) Publish(ctx context.Context, msg *Message) *PublishResult {
+	p.init()
+	res := &PublishResult{ready: make(chan struct{})}
+	pm := &pendingMessage{
+		msg: &pubsub.PubsubMessage{
+			Data:        base64.StdEncoding.EncodeToString(msg.Data),
+			Attributes:  msg.Attributes,
+			OrderingKey: msg.OrderingKey,
+		},
+		res: res,
+	}
+	pm.size = len(pm.msg.Data) + len(msg.OrderingKey)
+	for k, v := range msg.Attributes {
+		pm.size += len(k) + len(v)
+	}
+	if pm.size > maxPublishBytes {
+		res.set("", fmt.Errorf("pubsubutil: message of %d bytes is too large", pm.size))
+		return res
+	}
+	p.mu.Lock()
+	var err error
+	switch {
+	case p.stopped:
+		err = errPublisherStopped
+	case p.paused[msg.OrderingKey]:
+		err = ErrPublishingPaused{OrderingKey: msg.OrderingKey}
+	}
+	p.mu.Unlock()
+	if err == nil {
+		err = p.acquire(ctx, pm.size)
+	}
+	if err != nil {
+		res.set("", err)
+		return res
+	}
+
+	// If the key is paused from now on, publishBatch fails the message.
+	p.mu.Lock()
+	b := p.bundler(msg.OrderingKey)
+	b.pending++
+	p.mu.Unlock()
+	if err := b.AddWait(ctx, pm, pm.size); err != nil {
+		p.done(msg.OrderingKey, 1)
+		p.release(pm.size)
+		res.set("", err)
+	}
+	return res
+}
+
+func (p *Publisher) acquire(ctx context.Context, size int) error {
+	if p.count != nil {
+		if err := p.count.Acquire(ctx, 1); err != nil {
+			return err
+		}
+	}
+	if p.bytes != nil {
+		if size > p.MaxOutstandingBytes {
+			size = p.MaxOutstandingBytes
+		}
+		if err := p.bytes.Acquire(ctx, int64(size)); err != nil {
+			if p.count != nil {
+				p.count.Release(1)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) release(size int) {
+	if p.count != nil {
+		p.count.Release(1)
+	}
+	if p.bytes != nil {
+		if size > p.MaxOutstandingBytes {
+			size = p.MaxOutstandingBytes
+		}
+		p.bytes.Release(int64(size))
+	}
+}
+
+// bundler returns the bundler for messages with the ordering key, creating
+// it if needed. p.mu must be held.
+func (p *Publisher) bundler(key string) *keyBundler {
+	if kb, ok := p.bundlers[key]; ok {
+		return kb
+	}
+	b := bundler.NewBundler(&pendingMessage{}, func(items interface{}) {
+		p.publishBatch(key, items.([]*pendingMessage))
+	})
+	b.DelayThreshold = p.DelayThreshold
+	b.BundleCountThreshold = p.CountThreshold
+	if b.BundleCountThreshold > maxPublishCount {
+		b.BundleCountThreshold = maxPublishCount
+	}
+	b.BundleByteThreshold = p.ByteThreshold
+	b.BundleByteLimit = maxPublishBytes
+	// Bundles are handled in order, so ordering keys get one request in
+	// flight at a time.
+	b.HandlerLimit = 1
+	if key == "" {
+		b.HandlerLimit = p.HandlerLimit
+	}
+	kb := &keyBundler{Bundler: b}
+	p.bundlers[key] = kb
+	return kb
+}
+
+// done records that n messages with the ordering key were published or
+// failed. It removes the bundler of the key once it has no pending
+// messages, so that a Publisher used with many keys does not keep a bundler
+// for each. Since the last batch of the key has then been handled, a new
+// bundler for the key cannot send messages ahead of it.
+func (p *Publisher) done(key string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kb := p.bundlers[key]
+	kb.pending -= n
+	if kb.pending == 0 && key != "" {
+		delete(p.bundlers, key)
+	}
+}
+
+// publishBatch publishes a batch of messages with the ordering key, and
+// sets their results.
+func (p *Publisher) publishBatch(key string, batch []*pendingMessage) {
+	defer func() {
+		for _, pm := range batch {
+			p.release(pm.size)
+		}
+		p.done(key, len(batch))
+	}()
+	if key != "" {
+		p.mu.Lock()
+		paused := p.paused[key]
+		p.mu.Unlock()
+		if paused {
+			for _, pm := range batch {
+				pm.res.set("", ErrPublishingPaused{OrderingKey: key})
+			}
+			return
+		}
+	}
+
+	req := &pubsub.PublishRequest{}
+	for _, pm := range batch {
+		req.Messages = append(req.Messages, pm.msg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.RetryDeadline)
+	defer cancel()
+	var resp *pubsub.PublishResponse
+	bo := p.Backoff
+	for {
+		var err error
+		resp, err = p.svc.Projects.Topics.Publish(p.topic, req).Context(ctx).Do()
+		if err == nil && len(resp.MessageIds) != len(batch) {
+			err = fmt.Errorf("pubsubutil: got %d message IDs for %d messages", len(resp.MessageIds), len(batch))
+		}
+		if err == nil {
+			break
+		}
+		if !retry.Transient(err) || gax.Sleep(ctx, bo.Pause()) != nil {
+			if key != "" {
+				p.mu.Lock()
+				p.paused[key] = true
+				p.mu.Unlock()
+			}
+			for _, pm := range batch {
+				pm.res.set("", err)
+			}
+			return
+		}
+	}
+	for i, pm := range batch {
+		pm.res.set(resp.MessageIds[i], nil)
+	}
+}
+
+// ResumePublish resumes publishing messages with the ordering key after it
+// was paused by an error.
+func (p *Publisher) ResumePublish(orderingKey string) {
+	p.mu.Lock()
+	delete(p.paused, orderingKey)
+	p.mu.Unlock()
+}
+
+// Flush waits until all messages passed to Publish so far have been
+// published or failed.
+func (p *Publisher) Flush() {
+	p.mu.Lock()
+	var bs []*bundler.Bundler
+	for _, kb := range p.bundlers {
+		bs = append(bs, kb.Bundler)
+	}
+	p.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, b := range bs {
+		wg.Add(1)
+		go func(b *bundler.Bundler) {
+			defer wg.Done()
+			b.Flush()
+		}(b)
+	}
+	wg.Wait()
+}
+
+// Stop flushes the Publisher and makes later calls to Publish fail.
+func (p *Publisher) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.Flush()
+}
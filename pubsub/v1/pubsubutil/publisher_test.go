@@ -0,0 +1,274 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/internal/testserver"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const testTopic = "projects/p/topics/t"
+
+// fakeTopic serves Publish for testTopic. It records the data of the
+// messages in each request, and fails requests as told by fail. It fails
+// requests with messages of different ordering keys, like Pub/Sub.
+type fakeTopic struct {
+	mu       sync.Mutex
+	batches  [][]string
+	keys     []string // ordering key of each request
+	inFlight int
+	maxIn    int // maximum number of concurrent requests
+	nextID   int
+	delay    time.Duration
+	fail     func(n int, data []string) int // returns an HTTP status, or 0
+}
+
+func (f *fakeTopic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/"+testTopic+":publish" {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	var req pubsub.PublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var data []string
+	for _, m := range req.Messages {
+		if m.OrderingKey != req.Messages[0].OrderingKey {
+			http.Error(w, "mixed ordering keys", http.StatusBadRequest)
+			return
+		}
+		b, _ := base64.StdEncoding.DecodeString(m.Data)
+		data = append(data, string(b))
+	}
+
+	f.mu.Lock()
+	n := len(f.batches)
+	f.batches = append(f.batches, data)
+	f.keys = append(f.keys, req.Messages[0].OrderingKey)
+	f.inFlight++
+	if f.inFlight > f.maxIn {
+		f.maxIn = f.inFlight
+	}
+	f.mu.Unlock()
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+
+	if f.fail != nil {
+		if code := f.fail(n, data); code != 0 {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+	}
+	resp := &pubsub.PublishResponse{}
+	for range data {
+		f.nextID++
+		resp.MessageIds = append(resp.MessageIds, strconv.Itoa(f.nextID))
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// published returns the data of all messages received, in order.
+func (f *fakeTopic) published() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var all []string
+	for _, b := range f.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+func TestPublisherBatches(t *testing.T) {
+	f := &fakeTopic{}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	p := NewPublisher(svc.(*pubsub.Service), testTopic)
+	p.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	p.CountThreshold = 3
+	ctx := context.Background()
+	var results []*PublishResult
+	for i := 0; i < 7; i++ {
+		results = append(results, p.Publish(ctx, &Message{Data: []byte(strconv.Itoa(i))}))
+	}
+	p.Stop()
+
+	ids := map[string]bool{}
+	for i, r := range results {
+		id, err := r.Get(ctx)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if id == "" || ids[id] {
+			t.Errorf("message %d: bad ID %q", i, id)
+		}
+		ids[id] = true
+	}
+	for _, b := range f.batches {
+		if len(b) > 3 {
+			t.Errorf("got batch of %d messages, want at most 3", len(b))
+		}
+	}
+	if got := len(f.published()); got != 7 {
+		t.Errorf("got %d messages, want 7", got)
+	}
+	if _, err := p.Publish(ctx, &Message{Data: []byte("late")}).Get(ctx); err == nil {
+		t.Error("Publish after Stop: got nil, want error")
+	}
+}
+
+func TestPublisherOrderingKey(t *testing.T) {
+	f := &fakeTopic{delay: 2 * time.Millisecond}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	p := NewPublisher(svc.(*pubsub.Service), testTopic)
+	p.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	p.CountThreshold = 2
+	p.DelayThreshold = time.Millisecond
+	ctx := context.Background()
+	var want []string
+	for i := 0; i < 20; i++ {
+		d := strconv.Itoa(i)
+		want = append(want, d)
+		p.Publish(ctx, &Message{Data: []byte(d), OrderingKey: "k"})
+	}
+	p.Flush()
+	if got := f.published(); !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if f.maxIn > 1 {
+		t.Errorf("got %d concurrent requests for one key, want 1", f.maxIn)
+	}
+	for _, k := range f.keys {
+		if k != "k" {
+			t.Errorf("got ordering key %q, want %q", k, "k")
+		}
+	}
+}
+
+func TestPublisherRemovesIdleBundlers(t *testing.T) {
+	f := &fakeTopic{}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	p := NewPublisher(svc.(*pubsub.Service), testTopic)
+	p.DelayThreshold = time.Millisecond
+	ctx := context.Background()
+	var results []*PublishResult
+	for i := 0; i < 10; i++ {
+		key := strconv.Itoa(i % 5)
+		results = append(results, p.Publish(ctx, &Message{Data: []byte(key), OrderingKey: key}))
+	}
+	results = append(results, p.Publish(ctx, &Message{Data: []byte("none")}))
+	for _, r := range results {
+		if _, err := r.Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Flush()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Only the bundler of messages without a key remains.
+	if len(p.bundlers) != 1 || p.bundlers[""] == nil {
+		t.Errorf("got %d bundlers, want only the one without a key", len(p.bundlers))
+	}
+}
+
+func TestPublisherPauseResume(t *testing.T) {
+	f := &fakeTopic{fail: func(_ int, data []string) int {
+		if data[0] == "bad" {
+			return http.StatusBadRequest
+		}
+		return 0
+	}}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	p := NewPublisher(svc.(*pubsub.Service), testTopic)
+	p.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	ctx := context.Background()
+	publish := func(data, key string) *PublishResult {
+		r := p.Publish(ctx, &Message{Data: []byte(data), OrderingKey: key})
+		p.Flush()
+		return r
+	}
+
+	if _, err := publish("bad", "k").Get(ctx); err == nil {
+		t.Fatal("got nil, want error")
+	}
+	_, err := publish("next", "k").Get(ctx)
+	if err != (ErrPublishingPaused{OrderingKey: "k"}) {
+		t.Errorf("got %v, want ErrPublishingPaused", err)
+	}
+	// Other keys are not paused.
+	if _, err := publish("other", "k2").Get(ctx); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+	p.ResumePublish("k")
+	if _, err := publish("resumed", "k").Get(ctx); err != nil {
+		t.Errorf("after resume: %v", err)
+	}
+	if got, want := f.published(), []string{"bad", "other", "resumed"}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPublisherRetries(t *testing.T) {
+	f := &fakeTopic{fail: func(n int, _ []string) int {
+		if n < 2 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	p := NewPublisher(svc.(*pubsub.Service), testTopic)
+	p.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	ctx := context.Background()
+	r := p.Publish(ctx, &Message{Data: []byte("x")})
+	if _, err := r.Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.batches) != 3 {
+		t.Errorf("got %d requests, want 3", len(f.batches))
+	}
+}
+
+func TestPublisherFlowControl(t *testing.T) {
+	f := &fakeTopic{delay: 100 * time.Millisecond}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	p := NewPublisher(svc.(*pubsub.Service), testTopic)
+	p.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	p.MaxOutstandingMessages = 1
+	p.DelayThreshold = time.Millisecond
+	ctx := context.Background()
+	first := p.Publish(ctx, &Message{Data: []byte("1")})
+
+	// The second message waits for the first to be published.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Publish(tctx, &Message{Data: []byte("2")}).Get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+	if _, err := first.Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Publish(ctx, &Message{Data: []byte("3")}).Get(ctx); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// maxPushBody limits the size of push request bodies. Messages are at most
+// 10MB, and grow by a third when base64-encoded.
+const maxPushBody = 16 << 20
+
+// A PushMessage is a message delivered to a push endpoint.
+type PushMessage struct {
+	// Message is the message as sent by Pub/Sub. Its Data field is
+	// base64-encoded.
+	Message *pubsub.PubsubMessage
+
+	// Data is the decoded payload of the message.
+	Data []byte
+
+	// Subscription is the name of the subscription the message was
+	// delivered for, as in "projects/p/subscriptions/s".
+	Subscription string
+
+	// Claims are the claims of the verified token of the request, or nil if
+	// the PushHandler has no Verifier.
+	Claims *Claims
+}
+
+// pushRequest is the body of a push request.
+type pushRequest struct {
+	Message      *pubsub.PubsubMessage `json:"message"`
+	Subscription string                `json:"subscription"`
+}
+
+// A StatusError is an error that sets the HTTP status of the response to a
+// push request. By default, an error returned by PushHandler.Handle results
+// in a 500 response, and the message is redelivered. Return a StatusError
+// with a 2xx code to acknowledge a message that can never be processed:
+//
+//	if err := json.Unmarshal(msg.Data, &order); err != nil {
+//		return &pubsubutil.StatusError{Code: http.StatusNoContent, Err: err}
+//	}
+//
+// A Code that is not an HTTP status, or is an informational 1xx status,
+// also results in a 500 response.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v (HTTP status %d)", e.Err, e.Code)
+}
+
+// A PushHandler is an http.Handler for the push endpoint of a Pub/Sub
+// subscription. It decodes the push request, verifies its token and passes
+// the message to Handle. A nil error from Handle acknowledges the message
+// with a 204 response; other errors lead to a non-2xx response, so that
+// Pub/Sub delivers the message again.
+type PushHandler struct {
+	// Handle processes a message. It is called with the context of the
+	// request.
+	Handle func(ctx context.Context, msg *PushMessage) error
+
+	// Verifier, if non-nil, verifies the OIDC token in the Authorization
+	// header of each request. Requests without a valid token are rejected
+	// with a 401 response. Verification should only be disabled when the
+	// endpoint is protected otherwise.
+	Verifier *TokenVerifier
+
+	// Audience is the audience the token must have. It defaults to the URL
+	// of the request, which is the audience Pub/Sub uses if the
+	// subscription does not set one. That only works if the URL is not
+	// rewritten between Pub/Sub and the handler.
+	Audience string
+
+	// ServiceAccountEmail, if set, is the service account the token must
+	// be issued to, as configured in the push subscription.
+	ServiceAccountEmail string
+
+	// ErrorLog, if non-nil, logs errors from Handle and rejected requests.
+	ErrorLog *log.Logger
+}
+
+// ServeHTTP implements http.Handler.
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		h.fail(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	var claims *Claims
+	if h.Verifier != nil {
+		c, err := h.verify(r)
+		if err != nil {
+			h.fail(w, http.StatusUnauthorized, err)
+			return
+		}
+		claims = c
+	}
+	msg, err := decodePush(io.LimitReader(r.Body, maxPushBody))
+	if err != nil {
+		h.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	msg.Claims = claims
+	if err := h.Handle(r.Context(), msg); err != nil {
+		code := http.StatusInternalServerError
+		// Codes that are not final HTTP statuses are treated as failures.
+		if se, ok := err.(*StatusError); ok && se.Code >= 200 && se.Code <= 599 {
+			code = se.Code
+		}
+		h.logf("pubsubutil: handling message %s: %v", msg.Message.MessageId, err)
+		w.WriteHeader(code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PushHandler) verify(r *http.Request) (*Claims, error) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return nil, errors.New("pubsubutil: missing bearer token")
+	}
+	aud := h.Audience
+	if aud == "" {
+		aud = requestURL(r)
+	}
+	c, err := h.Verifier.Verify(r.Context(), auth[len(prefix):], aud)
+	if err != nil {
+		return nil, err
+	}
+	if h.ServiceAccountEmail != "" && (c.Email != h.ServiceAccountEmail || !c.EmailVerified) {
+		return nil, fmt.Errorf("pubsubutil: token issued to %q, want %q", c.Email, h.ServiceAccountEmail)
+	}
+	return c, nil
+}
+
+// requestURL returns the URL Pub/Sub sent r to. Push endpoints must use
+// HTTPS, even if TLS is terminated before the handler.
+func requestURL(r *http.Request) string {
+	return "https://" + r.Host + r.URL.RequestURI()
+}
+
+func (h *PushHandler) fail(w http.ResponseWriter, code int, err error) {
+	h.logf("pubsubutil: rejected push request: %v", err)
+	http.Error(w, http.StatusText(code), code)
+}
+
+func (h *PushHandler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	}
+}
+
+// decodePush decodes the body of a push request.
+func decodePush(r io.Reader) (*PushMessage, error) {
+	var req pushRequest
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return nil, fmt.Errorf("pubsubutil: decoding push request: %v", err)
+	}
+	if req.Message == nil {
+		return nil, errors.New("pubsubutil: push request has no message")
+	}
+	data, err := base64.StdEncoding.DecodeString(req.Message.Data)
+	if err != nil {
+		return nil, fmt.Errorf("pubsubutil: decoding message data: %v", err)
+	}
+	return &PushMessage{Message: req.Message, Data: data, Subscription: req.Subscription}, nil
+}
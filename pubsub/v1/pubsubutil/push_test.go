@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const pushBody = `{
+	"message": {
+		"attributes": {"k": "v"},
+		"data": "aGVsbG8=",
+		"messageId": "136969346945",
+		"publishTime": "2020-03-16T17:44:00.123Z"
+	},
+	"subscription": "projects/p/subscriptions/s"
+}`
+
+func TestPushHandler(t *testing.T) {
+	ks := newKeyServer(t)
+	defer ks.Close()
+	now := time.Now()
+	var got *PushMessage
+	var handleErr error
+	h := &PushHandler{
+		Verifier:            NewTokenVerifier(ks.URL, ks.Client()),
+		ServiceAccountEmail: "push@p.iam.gserviceaccount.com",
+		Handle: func(ctx context.Context, msg *PushMessage) error {
+			got = msg
+			return handleErr
+		},
+	}
+	valid := signToken(t, "k1", validClaims(now))
+	otherAccount := validClaims(now)
+	otherAccount.Email = "someone@p.iam.gserviceaccount.com"
+	otherAudience := validClaims(now)
+	otherAudience.Audience = "https://example.com/other"
+
+	for _, test := range []struct {
+		desc      string
+		method    string
+		token     string
+		body      string
+		handleErr error
+		wantCode  int
+	}{
+		{"ok", "POST", valid, pushBody, nil, http.StatusNoContent},
+		{"handler error", "POST", valid, pushBody, errors.New("busy"), http.StatusInternalServerError},
+		{"status error", "POST", valid, pushBody, &StatusError{Code: http.StatusOK, Err: errors.New("bad data")}, http.StatusOK},
+		{"status error without code", "POST", valid, pushBody, &StatusError{Err: errors.New("bad data")}, http.StatusInternalServerError},
+		{"status error with bad code", "POST", valid, pushBody, &StatusError{Code: 1000, Err: errors.New("bad data")}, http.StatusInternalServerError},
+		{"status error with informational code", "POST", valid, pushBody, &StatusError{Code: http.StatusContinue, Err: errors.New("bad data")}, http.StatusInternalServerError},
+		{"GET", "GET", valid, "", nil, http.StatusMethodNotAllowed},
+		{"no token", "POST", "", pushBody, nil, http.StatusUnauthorized},
+		{"service account", "POST", signToken(t, "k1", otherAccount), pushBody, nil, http.StatusUnauthorized},
+		{"audience", "POST", signToken(t, "k1", otherAudience), pushBody, nil, http.StatusUnauthorized},
+		{"bad body", "POST", valid, `{"message":`, nil, http.StatusBadRequest},
+		{"no message", "POST", valid, `{}`, nil, http.StatusBadRequest},
+		{"bad data", "POST", valid, `{"message": {"data": "%%%"}}`, nil, http.StatusBadRequest},
+	} {
+		got, handleErr = nil, test.handleErr
+		r := httptest.NewRequest(test.method, "https://example.com/push", strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.wantCode {
+			t.Errorf("%s: got status %d, want %d", test.desc, w.Code, test.wantCode)
+		}
+		if (got != nil) != (test.wantCode < 300 || test.handleErr != nil) {
+			t.Errorf("%s: handler called: %t", test.desc, got != nil)
+		}
+	}
+
+	// The handler receives the decoded message.
+	handleErr = nil
+	r := httptest.NewRequest("POST", "https://example.com/push", strings.NewReader(pushBody))
+	r.Header.Set("Authorization", "Bearer "+valid)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got == nil {
+		t.Fatal("handler not called")
+	}
+	if string(got.Data) != "hello" || got.Subscription != "projects/p/subscriptions/s" {
+		t.Errorf("got data %q, subscription %q", got.Data, got.Subscription)
+	}
+	want := &pubsub.PubsubMessage{
+		Attributes:  map[string]string{"k": "v"},
+		Data:        "aGVsbG8=",
+		MessageId:   "136969346945",
+		PublishTime: "2020-03-16T17:44:00.123Z",
+	}
+	if diff := cmp.Diff(got.Message, want); diff != "" {
+		t.Errorf("message: -got +want\n%s", diff)
+	}
+	if got.Claims == nil || got.Claims.Email != "push@p.iam.gserviceaccount.com" {
+		t.Errorf("got claims %+v", got.Claims)
+	}
+}
+
+func TestPushHandlerNoVerifier(t *testing.T) {
+	called := false
+	h := &PushHandler{Handle: func(ctx context.Context, msg *PushMessage) error {
+		called = msg.Claims == nil
+		return nil
+	}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/push", strings.NewReader(pushBody)))
+	if w.Code != http.StatusNoContent || !called {
+		t.Errorf("got status %d, called %t", w.Code, called)
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/api/internal/retry"
+	pubsub "google.golang.org/api/pubsub/v1"
+	"google.golang.org/api/support/bundler"
+)
+
+const (
+	// DefaultNumPullers is the default number of concurrent pull loops of a
+	// Subscriber.
+	DefaultNumPullers = 2
+
+	// DefaultMaxOutstandingMessages is the default number of messages a
+	// Subscriber processes at once.
+	DefaultMaxOutstandingMessages = 1000
+
+	// DefaultMaxOutstandingBytes is the default size of the messages a
+	// Subscriber processes at once.
+	DefaultMaxOutstandingBytes = 1e9
+
+	// DefaultAckDeadline is the default ack deadline a Subscriber keeps
+	// extending while messages are processed.
+	DefaultAckDeadline = time.Minute
+
+	// DefaultMaxExtension is the default time a Subscriber extends the ack
+	// deadline of a message for.
+	DefaultMaxExtension = time.Hour
+)
+
+const (
+	// maxAckIDs is the number of ack IDs sent in one request. Requests
+	// are limited to 512KB, and ack IDs are a few hundred bytes long.
+	maxAckIDs = 1000
+
+	// ackBatchDelay is how long acks and nacks are collected before they
+	// are sent.
+	ackBatchDelay = 100 * time.Millisecond
+
+	// ackTimeout bounds the time spent retrying a batch of acks or nacks.
+	ackTimeout = 30 * time.Second
+)
+
+// A Subscriber receives messages from a subscription with the Pull method of
+// the REST API, for environments where the gRPC streaming API cannot be
+// used.
+//
+// The exported fields are only safe to modify prior to calling Receive.
+type Subscriber struct {
+	// NumPullers is the number of concurrent Pull requests. If zero,
+	// DefaultNumPullers is used.
+	NumPullers int
+
+	// MaxMessages is the maximum number of messages requested by each Pull
+	// call. If zero, MaxOutstandingMessages is used, up to 1000.
+	MaxMessages int
+
+	// MaxOutstandingMessages and MaxOutstandingBytes limit the number and
+	// total size of messages that have been pulled but not yet acked or
+	// nacked. Pulling pauses while either limit is reached. If zero,
+	// DefaultMaxOutstandingMessages and DefaultMaxOutstandingBytes are used.
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+
+	// AckDeadline is the ack deadline set on pulled messages, and extended
+	// while they are processed. It must be between 10 seconds and 10
+	// minutes. If zero, DefaultAckDeadline is used.
+	AckDeadline time.Duration
+
+	// MaxExtension is how long the ack deadline of a message is extended
+	// for. A message still being processed after this time may be
+	// redelivered. If zero, DefaultMaxExtension is used.
+	MaxExtension time.Duration
+
+	// Backoff controls the pauses between retries of failed requests.
+	Backoff gax.Backoff
+
+	// ErrorLog, if non-nil, logs errors of requests that are given up on,
+	// such as acks that could not be sent.
+	ErrorLog *log.Logger
+
+	svc          *pubsub.Service
+	subscription string
+
+	// keepAlivePeriod is how often ack deadlines are extended. If zero,
+	// half of AckDeadline is used.
+	keepAlivePeriod time.Duration
+
+	mu     sync.Mutex
+	leases map[string]time.Time // ack IDs being processed, by receipt time
+}
+
+// NewSubscriber returns a Subscriber for the subscription with the given
+// full name, as in "projects/p/subscriptions/s".
+func NewSubscriber(svc *pubsub.Service, subscription string) *Subscriber {
+	return &Subscriber{
+		NumPullers:             DefaultNumPullers,
+		MaxOutstandingMessages: DefaultMaxOutstandingMessages,
+		MaxOutstandingBytes:    DefaultMaxOutstandingBytes,
+		AckDeadline:            DefaultAckDeadline,
+		MaxExtension:           DefaultMaxExtension,
+		svc:                    svc,
+		subscription:           subscription,
+	}
+}
+
+// Receive pulls messages and calls f for each of them in a new goroutine,
+// until ctx is done or a request fails with a permanent error. A message
+// is acked if f returns nil and nacked otherwise, so that it is redelivered.
+// Its ack deadline is extended while f runs.
+//
+// When ctx is done, Receive stops pulling, waits for the running calls of
+// f to return, sends the outstanding acks and nacks and returns nil. Since
+// the ctx passed to f is done at that point, f should return promptly.
+// Receive should not be called again while it is running.
+func (s *Subscriber) Receive(ctx context.Context, f func(context.Context, *pubsub.PubsubMessage) error) error {
+	if err := s.setDefaults(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	s.leases = map[string]time.Time{}
+	s.mu.Unlock()
+
+	acks := s.newAckBundler(func(ctx context.Context, ids []string) error {
+		_, err := s.svc.Projects.Subscriptions.Acknowledge(s.subscription, &pubsub.AcknowledgeRequest{AckIds: ids}).Context(ctx).Do()
+		return err
+	})
+	nacks := s.newAckBundler(func(ctx context.Context, ids []string) error {
+		return s.modifyAckDeadline(ctx, ids, 0)
+	})
+
+	var (
+		count = semaphore.NewWeighted(int64(s.MaxOutstandingMessages))
+		bytes = semaphore.NewWeighted(int64(s.MaxOutstandingBytes))
+
+		wg       sync.WaitGroup // running calls of f
+		pullerWG sync.WaitGroup
+		errOnce  sync.Once
+		fatal    error
+	)
+	done := func(m *pubsub.ReceivedMessage, size int64, err error) {
+		s.mu.Lock()
+		delete(s.leases, m.AckId)
+		s.mu.Unlock()
+		var berr error
+		if err == nil {
+			berr = acks.Add(m.AckId, len(m.AckId))
+		} else {
+			berr = nacks.Add(m.AckId, len(m.AckId))
+		}
+		if berr != nil {
+			s.logf("pubsubutil: dropping ack for message %s: %v", m.Message.MessageId, berr)
+		}
+		bytes.Release(size)
+		count.Release(1)
+	}
+
+	for i := 0; i < s.NumPullers; i++ {
+		pullerWG.Add(1)
+		go func() {
+			defer pullerWG.Done()
+			err := s.pull(ctx, func(m *pubsub.ReceivedMessage) {
+				size := int64(len(m.Message.Data))
+				if size > int64(s.MaxOutstandingBytes) {
+					size = int64(s.MaxOutstandingBytes)
+				}
+				if count.Acquire(ctx, 1) != nil {
+					s.nack(nacks, m)
+					return
+				}
+				if bytes.Acquire(ctx, size) != nil {
+					count.Release(1)
+					s.nack(nacks, m)
+					return
+				}
+				// Once ctx is done, hand the message back, even if a slot
+				// became free at the same time.
+				if ctx.Err() != nil {
+					bytes.Release(size)
+					count.Release(1)
+					s.nack(nacks, m)
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					done(m, size, f(ctx, m.Message))
+				}()
+			})
+			if err != nil {
+				errOnce.Do(func() {
+					fatal = err
+					cancel()
+				})
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	keepAliveDone := make(chan struct{})
+	go func() {
+		defer close(keepAliveDone)
+		s.keepAlive(stop)
+	}()
+
+	pullerWG.Wait()
+	wg.Wait()
+	close(stop)
+	<-keepAliveDone
+	acks.Flush()
+	nacks.Flush()
+	return fatal
+}
+
+// setDefaults sets the fields of s that are zero or negative to their
+// defaults, and checks AckDeadline.
+func (s *Subscriber) setDefaults() error {
+	if s.NumPullers <= 0 {
+		s.NumPullers = DefaultNumPullers
+	}
+	if s.MaxOutstandingMessages <= 0 {
+		s.MaxOutstandingMessages = DefaultMaxOutstandingMessages
+	}
+	if s.MaxOutstandingBytes <= 0 {
+		s.MaxOutstandingBytes = DefaultMaxOutstandingBytes
+	}
+	if s.AckDeadline <= 0 {
+		s.AckDeadline = DefaultAckDeadline
+	}
+	if s.AckDeadline < 10*time.Second || s.AckDeadline > 10*time.Minute {
+		return fmt.Errorf("pubsubutil: ack deadline %v not between 10s and 10m", s.AckDeadline)
+	}
+	if s.MaxExtension <= 0 {
+		s.MaxExtension = DefaultMaxExtension
+	}
+	return nil
+}
+
+// pull runs a pull loop until ctx is done, passing each message to
+// dispatch. It returns an error if Pull fails permanently.
+func (s *Subscriber) pull(ctx context.Context, dispatch func(*pubsub.ReceivedMessage)) error {
+	max := s.MaxMessages
+	if max <= 0 {
+		max = s.MaxOutstandingMessages
+		if max > 1000 {
+			max = 1000
+		}
+	}
+	bo := s.Backoff
+	for ctx.Err() == nil {
+		resp, err := s.svc.Projects.Subscriptions.Pull(s.subscription, &pubsub.PullRequest{MaxMessages: int64(max)}).Context(ctx).Do()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if !retry.Transient(err) {
+				return err
+			}
+			if gax.Sleep(ctx, bo.Pause()) != nil {
+				return nil
+			}
+			continue
+		}
+		bo = s.Backoff
+
+		// Take over the ack deadline of the new messages right away, since
+		// the subscription's may be shorter than the keep-alive period.
+		now := time.Now()
+		var ids []string
+		s.mu.Lock()
+		for _, m := range resp.ReceivedMessages {
+			s.leases[m.AckId] = now
+			ids = append(ids, m.AckId)
+		}
+		s.mu.Unlock()
+		s.extend(ctx, ids)
+
+		for _, m := range resp.ReceivedMessages {
+			if m.Message == nil {
+				m.Message = &pubsub.PubsubMessage{}
+			}
+			dispatch(m)
+		}
+	}
+	return nil
+}
+
+// keepAlive extends the ack deadlines of the messages being processed
+// until stop is closed.
+func (s *Subscriber) keepAlive(stop <-chan struct{}) {
+	period := s.keepAlivePeriod
+	if period <= 0 {
+		period = s.AckDeadline / 2
+	}
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		var ids []string
+		s.mu.Lock()
+		for id, received := range s.leases {
+			if now.Sub(received) > s.MaxExtension {
+				delete(s.leases, id)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		s.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), period)
+		s.extend(ctx, ids)
+		cancel()
+	}
+}
+
+// extend sets the ack deadline of the messages to s.AckDeadline.
+func (s *Subscriber) extend(ctx context.Context, ids []string) {
+	secs := int64(s.AckDeadline / time.Second)
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxAckIDs {
+			n = maxAckIDs
+		}
+		if err := s.retry(ctx, func() error { return s.modifyAckDeadline(ctx, ids[:n], secs) }); err != nil {
+			s.logf("pubsubutil: extending ack deadlines: %v", err)
+		}
+		ids = ids[n:]
+	}
+}
+
+func (s *Subscriber) modifyAckDeadline(ctx context.Context, ids []string, secs int64) error {
+	req := &pubsub.ModifyAckDeadlineRequest{
+		AckIds:             ids,
+		AckDeadlineSeconds: secs,
+		// A deadline of zero nacks the messages, and must be sent.
+		ForceSendFields: []string{"AckDeadlineSeconds"},
+	}
+	_, err := s.svc.Projects.Subscriptions.ModifyAckDeadline(s.subscription, req).Context(ctx).Do()
+	return err
+}
+
+// nack nacks a message that was not passed to the callback.
+func (s *Subscriber) nack(nacks *bundler.Bundler, m *pubsub.ReceivedMessage) {
+	s.mu.Lock()
+	delete(s.leases, m.AckId)
+	s.mu.Unlock()
+	if err := nacks.Add(m.AckId, len(m.AckId)); err != nil {
+		s.logf("pubsubutil: dropping nack for message %s: %v", m.Message.MessageId, err)
+	}
+}
+
+// newAckBundler returns a bundler of ack IDs that sends them with send.
+func (s *Subscriber) newAckBundler(send func(context.Context, []string) error) *bundler.Bundler {
+	b := bundler.NewBundler("", func(items interface{}) {
+		ids := items.([]string)
+		ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+		defer cancel()
+		if err := s.retry(ctx, func() error { return send(ctx, ids) }); err != nil {
+			s.logf("pubsubutil: sending %d acks or nacks: %v", len(ids), err)
+		}
+	})
+	b.DelayThreshold = ackBatchDelay
+	b.BundleCountThreshold = maxAckIDs
+	b.HandlerLimit = 4
+	return b
+}
+
+// retry calls f until it succeeds, fails with a permanent error, or ctx is
+// done.
+func (s *Subscriber) retry(ctx context.Context, f func() error) error {
+	bo := s.Backoff
+	for {
+		err := f()
+		if err == nil || !retry.Transient(err) {
+			return err
+		}
+		if serr := gax.Sleep(ctx, bo.Pause()); serr != nil {
+			return err
+		}
+	}
+}
+
+func (s *Subscriber) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/internal/testserver"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const testSubscription = "projects/p/subscriptions/s"
+
+// fakeSubscription serves Pull, Acknowledge and ModifyAckDeadline for
+// testSubscription. Nacked messages are delivered again.
+type fakeSubscription struct {
+	mu        sync.Mutex
+	queue     []*pubsub.ReceivedMessage
+	acked     map[string]bool
+	nacks     int
+	modacks   []int64 // deadlines of ModifyAckDeadline calls
+	pullError int     // if non-zero, fail Pull with this code
+	nextAckID int
+}
+
+func newFakeSubscription(data ...string) *fakeSubscription {
+	f := &fakeSubscription{acked: map[string]bool{}}
+	for i, d := range data {
+		f.push(&pubsub.PubsubMessage{MessageId: strconv.Itoa(i), Data: d})
+	}
+	return f
+}
+
+// push queues a message. f.mu must be held, or f not yet shared.
+func (f *fakeSubscription) push(m *pubsub.PubsubMessage) {
+	f.nextAckID++
+	f.queue = append(f.queue, &pubsub.ReceivedMessage{AckId: "ack-" + strconv.Itoa(f.nextAckID), Message: m})
+}
+
+func (f *fakeSubscription) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp interface{} = struct{}{}
+	switch r.URL.Path {
+	case "/v1/" + testSubscription + ":pull":
+		if f.pullError != 0 {
+			http.Error(w, "pull failed", f.pullError)
+			return
+		}
+		var req pubsub.PullRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		n := int(req.MaxMessages)
+		if n > len(f.queue) {
+			n = len(f.queue)
+		}
+		if n == 0 {
+			// Avoid a busy loop while there are no messages.
+			f.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			f.mu.Lock()
+		}
+		resp = &pubsub.PullResponse{ReceivedMessages: f.queue[:n]}
+		f.queue = f.queue[n:]
+	case "/v1/" + testSubscription + ":acknowledge":
+		var req pubsub.AcknowledgeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, id := range req.AckIds {
+			f.acked[id] = true
+		}
+	case "/v1/" + testSubscription + ":modifyAckDeadline":
+		var req struct {
+			AckIds             []string
+			AckDeadlineSeconds *int64
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.AckDeadlineSeconds == nil {
+			http.Error(w, "missing ackDeadlineSeconds", http.StatusBadRequest)
+			return
+		}
+		f.modacks = append(f.modacks, *req.AckDeadlineSeconds)
+		if *req.AckDeadlineSeconds == 0 {
+			f.nacks += len(req.AckIds)
+			// Redeliver with new ack IDs.
+			for _, id := range req.AckIds {
+				f.push(&pubsub.PubsubMessage{MessageId: "redelivered-" + id, Data: id})
+			}
+		}
+	default:
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeSubscription) numAcked() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.acked)
+}
+
+// waitFor polls cond until it is true or the test times out.
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscriberReceive(t *testing.T) {
+	f := newFakeSubscription("a", "b", "fail", "c")
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	s := NewSubscriber(svc.(*pubsub.Service), testSubscription)
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	seen := map[string]int{}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Receive(ctx, func(ctx context.Context, m *pubsub.PubsubMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[m.MessageId]++
+			if m.Data == "fail" {
+				return errors.New("failed")
+			}
+			return nil
+		})
+	}()
+	// The failed message is nacked and redelivered under a new ack ID.
+	waitFor(t, "acks", func() bool { return f.numAcked() == 4 })
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.nacks != 1 {
+		t.Errorf("got %d nacks, want 1", f.nacks)
+	}
+	if f.acked["ack-3"] {
+		t.Error("failed message was acked")
+	}
+	for _, id := range []string{"0", "1", "2", "3", "redelivered-ack-3"} {
+		if seen[id] != 1 {
+			t.Errorf("message %s seen %d times, want 1", id, seen[id])
+		}
+	}
+	// The deadline of each pulled batch is set to AckDeadline on receipt.
+	for _, d := range f.modacks {
+		if d != 0 && d != int64(DefaultAckDeadline/time.Second) {
+			t.Errorf("got ack deadline %d", d)
+		}
+	}
+}
+
+func TestSubscriberFlowControl(t *testing.T) {
+	var data []string
+	for i := 0; i < 20; i++ {
+		data = append(data, "x")
+	}
+	f := newFakeSubscription(data...)
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	s := NewSubscriber(svc.(*pubsub.Service), testSubscription)
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	s.NumPullers = 3
+	s.MaxOutstandingMessages = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Receive(ctx, func(context.Context, *pubsub.PubsubMessage) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(2 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+	}()
+	waitFor(t, "acks", func() bool { return f.numAcked() == 20 })
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning > 2 {
+		t.Errorf("%d messages processed at once, want at most 2", maxRunning)
+	}
+}
+
+func TestSubscriberExtendsDeadlines(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow")
+	}
+	f := newFakeSubscription("slow")
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	s := NewSubscriber(svc.(*pubsub.Service), testSubscription)
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	s.keepAlivePeriod = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Receive(ctx, func(context.Context, *pubsub.PubsubMessage) error {
+			time.Sleep(1500 * time.Millisecond)
+			return nil
+		})
+	}()
+	waitFor(t, "ack", func() bool { return f.numAcked() == 1 })
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// One modack on receipt and one from the keep-alive.
+	if len(f.modacks) < 2 {
+		t.Errorf("got modacks %v, want at least 2", f.modacks)
+	}
+}
+
+func TestSubscriberShutdown(t *testing.T) {
+	f := newFakeSubscription("a", "b", "c")
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	s := NewSubscriber(svc.(*pubsub.Service), testSubscription)
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	s.NumPullers = 1
+	s.MaxMessages = 3
+	s.MaxOutstandingMessages = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		var once sync.Once
+		errc <- s.Receive(ctx, func(ctx context.Context, m *pubsub.PubsubMessage) error {
+			once.Do(func() { close(started) })
+			<-ctx.Done()
+			return nil
+		})
+	}()
+	<-started
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	// The running call is acked once it returns; the messages waiting for
+	// flow control are handed back.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.acked) != 1 {
+		t.Errorf("got %d acks, want 1", len(f.acked))
+	}
+	if f.nacks != 2 {
+		t.Errorf("got %d nacks, want 2", f.nacks)
+	}
+}
+
+func TestSubscriberDefaults(t *testing.T) {
+	f := newFakeSubscription("a", "b")
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	s := NewSubscriber(svc.(*pubsub.Service), testSubscription)
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	// A Subscriber not made by NewSubscriber uses the defaults.
+	s = &Subscriber{svc: s.svc, subscription: s.subscription, Backoff: s.Backoff}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Receive(ctx, func(context.Context, *pubsub.PubsubMessage) error { return nil })
+	}()
+	waitFor(t, "acks", func() bool { return f.numAcked() == 2 })
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if s.NumPullers != DefaultNumPullers || s.AckDeadline != DefaultAckDeadline {
+		t.Errorf("got NumPullers %d, AckDeadline %v; want defaults", s.NumPullers, s.AckDeadline)
+	}
+
+	for _, d := range []time.Duration{5 * time.Second, 11 * time.Minute} {
+		s.AckDeadline = d
+		if err := s.Receive(context.Background(), nil); err == nil {
+			t.Errorf("AckDeadline %v: got nil, want error", d)
+		}
+	}
+}
+
+func TestSubscriberPermanentError(t *testing.T) {
+	f := newFakeSubscription()
+	f.pullError = http.StatusNotFound
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	s := NewSubscriber(svc.(*pubsub.Service), testSubscription)
+	s.Backoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	err := s.Receive(context.Background(), func(context.Context, *pubsub.PubsubMessage) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want 404 error", err)
+	}
+}
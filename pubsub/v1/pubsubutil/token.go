@@ -0,0 +1,267 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleCertsURL is the JWKS URL of the keys Google signs OIDC tokens with.
+const GoogleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+const (
+	// clockSkew is how far the issue and expiry times of a token may be
+	// off from the local clock.
+	clockSkew = time.Minute
+
+	// minKeyRefresh limits how often the keys are fetched again when a
+	// token is signed with an unknown key.
+	minKeyRefresh = time.Minute
+
+	// defaultKeyLifetime is how long keys are cached when the JWKS response
+	// does not say.
+	defaultKeyLifetime = time.Hour
+)
+
+// googleIssuers are the issuers of Google OIDC tokens.
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// Claims are the claims of a verified OIDC token.
+type Claims struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	IssuedAt      int64  `json:"iat"`
+	Expiry        int64  `json:"exp"`
+}
+
+// A TokenVerifier verifies OIDC tokens signed by Google, such as those sent
+// with push requests of subscriptions that have an OIDC token configured.
+// The signing keys are fetched from a JWKS URL and cached. A TokenVerifier
+// is safe for concurrent use.
+type TokenVerifier struct {
+	jwksURL string
+	client  *http.Client
+	now     func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	expiry      time.Time // when keys must be fetched again
+	lastRefresh time.Time
+	refreshing  *keyRefresh // nil if the keys are not being fetched
+}
+
+// A keyRefresh is a fetch of the signing keys, which concurrent callers of
+// TokenVerifier.key wait for instead of fetching the keys themselves.
+type keyRefresh struct {
+	done chan struct{} // closed when the fetch is over
+	err  error
+}
+
+// NewTokenVerifier returns a TokenVerifier that fetches the signing keys
+// from jwksURL with client. Pass GoogleCertsURL to verify tokens issued by
+// Google, or the URL of a local key server in tests. If client is nil,
+// http.DefaultClient is used.
+func NewTokenVerifier(jwksURL string, client *http.Client) *TokenVerifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &TokenVerifier{jwksURL: jwksURL, client: client, now: time.Now}
+}
+
+// Verify checks the signature, issuer, audience and validity period of the
+// RS256-signed token and returns its claims.
+func (v *TokenVerifier) Verify(ctx context.Context, token, audience string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("pubsubutil: malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("pubsubutil: malformed token header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("pubsubutil: unsupported token algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("pubsubutil: malformed token signature: %v", err)
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, errors.New("pubsubutil: invalid token signature")
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("pubsubutil: malformed token claims: %v", err)
+	}
+	validIssuer := false
+	for _, iss := range googleIssuers {
+		if c.Issuer == iss {
+			validIssuer = true
+		}
+	}
+	if !validIssuer {
+		return nil, fmt.Errorf("pubsubutil: token has issuer %q, want Google", c.Issuer)
+	}
+	if c.Audience != audience {
+		return nil, fmt.Errorf("pubsubutil: token has audience %q, want %q", c.Audience, audience)
+	}
+	now := v.now()
+	if now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return nil, errors.New("pubsubutil: token used before issued")
+	}
+	if now.Add(-clockSkew).After(time.Unix(c.Expiry, 0)) {
+		return nil, errors.New("pubsubutil: token expired")
+	}
+	return &c, nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the public key with ID kid, fetching the keys if they have
+// expired or kid is unknown.
+func (v *TokenVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	now := v.now()
+	k, ok := v.keys[kid]
+	fresh := now.Before(v.expiry)
+	if ok && fresh {
+		v.mu.Unlock()
+		return k, nil
+	}
+	// An unknown key may have been added since the keys were fetched, but
+	// tokens with bogus key IDs must not cause a fetch on every request.
+	if fresh && now.Sub(v.lastRefresh) < minKeyRefresh && v.refreshing == nil {
+		v.mu.Unlock()
+		return nil, fmt.Errorf("pubsubutil: unknown signing key %q", kid)
+	}
+	r := v.refreshing
+	if r == nil {
+		// Fetch the keys without holding v.mu, so that tokens signed with
+		// cached keys are verified meanwhile.
+		r = &keyRefresh{done: make(chan struct{})}
+		v.refreshing = r
+		v.lastRefresh = now
+		v.mu.Unlock()
+		keys, lifetime, err := v.fetchKeys(ctx)
+		v.mu.Lock()
+		if err == nil {
+			v.keys = keys
+			v.expiry = now.Add(lifetime)
+		}
+		v.refreshing = nil
+		r.err = err
+		close(r.done)
+	} else {
+		v.mu.Unlock()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		v.mu.Lock()
+	}
+	k, ok = v.keys[kid]
+	v.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("pubsubutil: unknown signing key %q", kid)
+}
+
+// fetchKeys fetches the keys, and returns them with how long they may be
+// cached.
+func (v *TokenVerifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	req, err := http.NewRequest("GET", v.jwksURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("pubsubutil: fetching signing keys: %v", err)
+	}
+	resp, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, fmt.Errorf("pubsubutil: fetching signing keys: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("pubsubutil: fetching signing keys: %s", resp.Status)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, 0, fmt.Errorf("pubsubutil: decoding signing keys: %v", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, 0, fmt.Errorf("pubsubutil: key %q: bad modulus: %v", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 3 {
+			return nil, 0, fmt.Errorf("pubsubutil: key %q: bad exponent", k.Kid)
+		}
+		var exp int
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}
+	}
+	return keys, maxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// maxAge returns the max-age of a Cache-Control header, or
+// defaultKeyLifetime.
+func maxAge(cc string) time.Duration {
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.TrimSpace(d)
+		if strings.HasPrefix(d, "max-age=") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(d, "max-age=")); err == nil && n >= 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return defaultKeyLifetime
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+func signingKey(t *testing.T) *rsa.PrivateKey {
+	testKeyOnce.Do(func() {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testKey = k
+	})
+	return testKey
+}
+
+// keyServer serves a JWKS holding the test key with ID "k1", and counts the
+// requests for it. If block is set, requests wait until it is closed.
+type keyServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests int
+	block    chan struct{}
+}
+
+func newKeyServer(t *testing.T) *keyServer {
+	pub := signingKey(t).PublicKey
+	e := big.NewInt(int64(pub.E)).Bytes()
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "EC", "kid": "ec"},
+			{
+				"kty": "RSA",
+				"kid": "k1",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(e),
+			},
+		},
+	}
+	ks := &keyServer{}
+	ks.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks.mu.Lock()
+		ks.requests++
+		block := ks.block
+		ks.mu.Unlock()
+		if block != nil {
+			<-block
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	return ks
+}
+
+// signToken returns a token with the given claims signed by the test key.
+func signToken(t *testing.T, kid string, claims interface{}) string {
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	s := enc(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(s))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, signingKey(t), crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims(now time.Time) *Claims {
+	return &Claims{
+		Issuer:        "https://accounts.google.com",
+		Audience:      "https://example.com/push",
+		Subject:       "1234",
+		Email:         "push@p.iam.gserviceaccount.com",
+		EmailVerified: true,
+		IssuedAt:      now.Add(-time.Minute).Unix(),
+		Expiry:        now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ks := newKeyServer(t)
+	defer ks.Close()
+	now := time.Now()
+	v := NewTokenVerifier(ks.URL, ks.Client())
+	v.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	want := validClaims(now)
+	got, err := v.Verify(ctx, signToken(t, "k1", want), want.Audience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("-got +want\n%s", diff)
+	}
+
+	expired := validClaims(now.Add(-2 * time.Hour))
+	wrongIssuer := validClaims(now)
+	wrongIssuer.Issuer = "https://evil.example.com"
+	tampered := signToken(t, "k1", want)
+	parts := strings.Split(tampered, ".")
+	c := *want
+	c.Email = "admin@p.iam.gserviceaccount.com"
+	b, _ := json.Marshal(c)
+	parts[1] = base64.RawURLEncoding.EncodeToString(b)
+	tampered = strings.Join(parts, ".")
+
+	for _, test := range []struct {
+		desc, token, aud, wantErr string
+	}{
+		{"garbage", "abc", want.Audience, "malformed"},
+		{"audience", signToken(t, "k1", want), "https://other.example.com", "audience"},
+		{"expired", signToken(t, "k1", expired), want.Audience, "expired"},
+		{"issuer", signToken(t, "k1", wrongIssuer), want.Audience, "issuer"},
+		{"unknown key", signToken(t, "k2", want), want.Audience, "unknown signing key"},
+		{"tampered", tampered, want.Audience, "signature"},
+	} {
+		_, err := v.Verify(ctx, test.token, test.aud)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: got %v, want error containing %q", test.desc, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifyKeyCaching(t *testing.T) {
+	ks := newKeyServer(t)
+	defer ks.Close()
+	now := time.Now()
+	v := NewTokenVerifier(ks.URL, ks.Client())
+	v.now = func() time.Time { return now }
+	ctx := context.Background()
+	claims := validClaims(now)
+	verify := func(kid string) {
+		t.Helper()
+		v.Verify(ctx, signToken(t, kid, claims), claims.Audience)
+	}
+	wantRequests := func(n int) {
+		t.Helper()
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		if ks.requests != n {
+			t.Errorf("got %d key fetches, want %d", ks.requests, n)
+		}
+	}
+
+	verify("k1")
+	verify("k1")
+	wantRequests(1)
+	// Unknown keys are fetched at most once per minKeyRefresh.
+	verify("k2")
+	wantRequests(1)
+	now = now.Add(minKeyRefresh)
+	verify("k2")
+	wantRequests(2)
+	// The keys expire after the max-age of the response.
+	now = now.Add(2 * time.Hour)
+	claims = validClaims(now)
+	verify("k1")
+	wantRequests(3)
+}
+
+func TestVerifyDuringKeyFetch(t *testing.T) {
+	ks := newKeyServer(t)
+	defer ks.Close()
+	now := time.Now()
+	v := NewTokenVerifier(ks.URL, ks.Client())
+	v.now = func() time.Time { return now }
+	ctx := context.Background()
+	claims := validClaims(now)
+	if _, err := v.Verify(ctx, signToken(t, "k1", claims), claims.Audience); err != nil {
+		t.Fatal(err)
+	}
+	numRequests := func() int {
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		return ks.requests
+	}
+
+	// Tokens with an unknown key wait for a single fetch of the keys.
+	now = now.Add(minKeyRefresh)
+	block := make(chan struct{})
+	ks.mu.Lock()
+	ks.block = block
+	ks.mu.Unlock()
+	errc := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := v.Verify(ctx, signToken(t, "k2", claims), claims.Audience)
+			errc <- err
+		}()
+	}
+	waitFor(t, "key fetch", func() bool { return numRequests() == 2 })
+	// Tokens with a cached key are verified meanwhile.
+	if _, err := v.Verify(ctx, signToken(t, "k1", claims), claims.Audience); err != nil {
+		t.Errorf("cached key during fetch: %v", err)
+	}
+	close(block)
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+			t.Errorf("got %v, want unknown key error", err)
+		}
+	}
+	if n := numRequests(); n != 2 {
+		t.Errorf("got %d key fetches, want 2", n)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"public, max-age=22469, must-revalidate, no-transform", 22469 * time.Second},
+		{"max-age=0", 0},
+		{"no-cache", defaultKeyLifetime},
+		{"max-age=x", defaultKeyLifetime},
+	} {
+		if got := maxAge(test.in); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	safebrowsing "google.golang.org/api/safebrowsing/v4"
+)
+
+// DefaultUpdatePeriod is the default time between database updates when
+// the server does not ask for a minimum wait.
+const DefaultUpdatePeriod = 30 * time.Minute
+
+// A ThreatList identifies a Safe Browsing threat list, as in
+// ThreatList{"MALWARE", "ANY_PLATFORM", "URL"}.
+type ThreatList struct {
+	ThreatType      string
+	PlatformType    string
+	ThreatEntryType string
+}
+
+func (l ThreatList) String() string {
+	return l.ThreatType + "/" + l.PlatformType + "/" + l.ThreatEntryType
+}
+
+// A hashList is the local copy of a threat list.
+type hashList struct {
+	state   string   // client state returned by the server
+	hashes  []string // sorted hash prefixes
+	lengths []int    // distinct lengths of the hash prefixes
+}
+
+// newHashList returns the list of the hash prefixes, which must be 4 to 32
+// bytes long.
+func newHashList(state string, hashes []string) (*hashList, error) {
+	l := &hashList{state: state, hashes: hashes}
+	var seen [33]bool
+	for _, h := range hashes {
+		if len(h) < 4 || len(h) > 32 {
+			return nil, fmt.Errorf("safebrowsingutil: bad hash prefix length %d", len(h))
+		}
+		if !seen[len(h)] {
+			seen[len(h)] = true
+			l.lengths = append(l.lengths, len(h))
+		}
+	}
+	sort.Ints(l.lengths)
+	return l, nil
+}
+
+// checksum returns the SHA-256 hash of the sorted hash prefixes.
+func (l *hashList) checksum() []byte {
+	h := sha256.New()
+	for _, p := range l.hashes {
+		h.Write([]byte(p))
+	}
+	return h.Sum(nil)
+}
+
+// match returns the hash prefix in l of the full hash h, or "".
+func (l *hashList) match(h string) string {
+	for _, n := range l.lengths {
+		p := h[:n]
+		if i := sort.SearchStrings(l.hashes, p); i < len(l.hashes) && l.hashes[i] == p {
+			return p
+		}
+	}
+	return ""
+}
+
+// apply returns the list that results from applying an update to l.
+// Removals are indices into l's hashes, and are applied before additions.
+func (l *hashList) apply(resp *safebrowsing.ListUpdateResponse) (*hashList, error) {
+	old := l.hashes
+	if resp.ResponseType == "FULL_UPDATE" {
+		old = nil
+	}
+	kept := old
+	if len(resp.Removals) > 0 {
+		removed := make([]bool, len(old))
+		for _, set := range resp.Removals {
+			indices, err := decodeIndices(set)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range indices {
+				if i < 0 || i >= len(old) {
+					return nil, fmt.Errorf("safebrowsingutil: removal index %d out of range [0, %d)", i, len(old))
+				}
+				removed[i] = true
+			}
+		}
+		kept = make([]string, 0, len(old))
+		for i, h := range old {
+			if !removed[i] {
+				kept = append(kept, h)
+			}
+		}
+	}
+	var added []string
+	for _, set := range resp.Additions {
+		hashes, err := decodeHashes(set)
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, hashes...)
+	}
+	sort.Strings(added)
+
+	// Merge the sorted kept and added prefixes.
+	hashes := make([]string, 0, len(kept)+len(added))
+	i, j := 0, 0
+	for i < len(kept) || j < len(added) {
+		if j == len(added) || i < len(kept) && kept[i] < added[j] {
+			hashes = append(hashes, kept[i])
+			i++
+		} else {
+			hashes = append(hashes, added[j])
+			j++
+		}
+	}
+	nl, err := newHashList(resp.NewClientState, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Checksum != nil {
+		want, err := base64.StdEncoding.DecodeString(resp.Checksum.Sha256)
+		if err != nil {
+			return nil, fmt.Errorf("safebrowsingutil: bad checksum: %v", err)
+		}
+		if !bytes.Equal(nl.checksum(), want) {
+			return nil, errors.New("safebrowsingutil: checksum mismatch after update")
+		}
+	}
+	return nl, nil
+}
+
+// A Database is a local copy of Safe Browsing threat lists, kept up to
+// date with the Update API. URLs are looked up in the local lists, and
+// only the rare URLs whose hash prefixes are in a list are checked with
+// the server.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Update, Run or LookupURLs.
+type Database struct {
+	// ClientID and ClientVersion identify the client in requests.
+	ClientID      string
+	ClientVersion string
+
+	// UpdatePeriod is the time between updates made by Run when the server
+	// does not ask for a minimum wait. The default is DefaultUpdatePeriod.
+	UpdatePeriod time.Duration
+
+	// ErrorLog, if non-nil, logs the errors of the updates made by Run.
+	ErrorLog *log.Logger
+
+	svc   *safebrowsing.Service
+	path  string
+	lists []ThreatList
+
+	updateMu sync.Mutex // serializes updates
+
+	mu         sync.RWMutex
+	hashLists  map[ThreatList]*hashList
+	updated    time.Time // time of the last update
+	nextUpdate time.Time // the server asks not to update before then
+
+	cache fullHashCache
+}
+
+// NewDatabase returns a Database of the threat lists. If path is not
+// empty, the database is loaded from the file at path, if it exists, and
+// saved there after each update.
+//
+// The database is empty until it is loaded or updated: call Run in a
+// goroutine to keep it up to date.
+func NewDatabase(svc *safebrowsing.Service, path string, lists ...ThreatList) (*Database, error) {
+	if len(lists) == 0 {
+		return nil, errors.New("safebrowsingutil: no threat lists")
+	}
+	db := &Database{
+		UpdatePeriod: DefaultUpdatePeriod,
+		svc:          svc,
+		path:         path,
+		lists:        lists,
+		hashLists:    map[ThreatList]*hashList{},
+	}
+	for _, l := range lists {
+		db.hashLists[l] = &hashList{}
+	}
+	if path != "" {
+		if err := db.load(); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// A dbFile is the persisted form of a Database.
+type dbFile struct {
+	Updated    time.Time
+	NextUpdate time.Time
+	Lists      []dbFileList
+}
+
+type dbFileList struct {
+	List   ThreatList
+	State  string
+	Hashes []string
+	SHA256 []byte
+}
+
+func (db *Database) load() error {
+	f, err := os.Open(db.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var df dbFile
+	if err := gob.NewDecoder(f).Decode(&df); err != nil {
+		return fmt.Errorf("safebrowsingutil: loading %s: %v", db.path, err)
+	}
+	for _, fl := range df.Lists {
+		if _, ok := db.hashLists[fl.List]; !ok {
+			continue // no longer wanted
+		}
+		l, err := newHashList(fl.State, fl.Hashes)
+		if err != nil || !sort.StringsAreSorted(l.hashes) || !bytes.Equal(l.checksum(), fl.SHA256) {
+			return fmt.Errorf("safebrowsingutil: loading %s: list %v is corrupted", db.path, fl.List)
+		}
+		db.hashLists[fl.List] = l
+	}
+	db.updated = df.Updated
+	db.nextUpdate = df.NextUpdate
+	return nil
+}
+
+// save writes the database to its file, replacing the file only once the
+// database is fully written.
+func (db *Database) save() error {
+	db.mu.RLock()
+	df := dbFile{Updated: db.updated, NextUpdate: db.nextUpdate}
+	for _, l := range db.lists {
+		hl := db.hashLists[l]
+		df.Lists = append(df.Lists, dbFileList{List: l, State: hl.state, Hashes: hl.hashes, SHA256: hl.checksum()})
+	}
+	db.mu.RUnlock()
+
+	tmp := db.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("safebrowsingutil: saving database: %v", err)
+	}
+	err = gob.NewEncoder(f).Encode(&df)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, db.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("safebrowsingutil: saving database: %v", err)
+	}
+	return nil
+}
+
+func (db *Database) clientInfo() *safebrowsing.ClientInfo {
+	return &safebrowsing.ClientInfo{ClientId: db.ClientID, ClientVersion: db.ClientVersion}
+}
+
+// NextUpdate returns the time of the next update made by Run. The server
+// asks clients not to update before then.
+func (db *Database) NextUpdate() time.Time {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.nextUpdate
+}
+
+// Update fetches the updates of the threat lists, applies them and saves
+// the database. It fails without making a request if called before
+// NextUpdate. If a list does not match its checksum after the update, it
+// is cleared, to be fetched in full by the next update, and an error is
+// returned.
+func (db *Database) Update(ctx context.Context) error {
+	db.updateMu.Lock()
+	defer db.updateMu.Unlock()
+
+	db.mu.RLock()
+	next := db.nextUpdate
+	current := db.hashLists
+	db.mu.RUnlock()
+	if time.Now().Before(next) {
+		return fmt.Errorf("safebrowsingutil: the server asked not to update before %v", next.Format(time.RFC3339))
+	}
+
+	req := &safebrowsing.FetchThreatListUpdatesRequest{Client: db.clientInfo()}
+	for _, l := range db.lists {
+		req.ListUpdateRequests = append(req.ListUpdateRequests, &safebrowsing.ListUpdateRequest{
+			ThreatType:      l.ThreatType,
+			PlatformType:    l.PlatformType,
+			ThreatEntryType: l.ThreatEntryType,
+			State:           current[l].state,
+			Constraints:     &safebrowsing.Constraints{SupportedCompressions: []string{"RAW", "RICE"}},
+		})
+	}
+	resp, err := db.svc.ThreatListUpdates.Fetch(req).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+
+	lists := make(map[ThreatList]*hashList, len(current))
+	for l, hl := range current {
+		lists[l] = hl
+	}
+	var firstErr error
+	for _, lr := range resp.ListUpdateResponses {
+		l := ThreatList{lr.ThreatType, lr.PlatformType, lr.ThreatEntryType}
+		hl, ok := lists[l]
+		if !ok {
+			continue
+		}
+		nl, err := hl.apply(lr)
+		if err != nil {
+			nl = &hashList{}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("safebrowsingutil: updating list %v: %v", l, err)
+			}
+		}
+		lists[l] = nl
+	}
+	now := time.Now()
+	wait := db.UpdatePeriod
+	if resp.MinimumWaitDuration != "" {
+		if wait, err = parseDuration(resp.MinimumWaitDuration); err != nil {
+			wait = db.UpdatePeriod
+		}
+	}
+
+	db.mu.Lock()
+	db.hashLists = lists
+	db.updated = now
+	db.nextUpdate = now.Add(wait)
+	db.mu.Unlock()
+
+	if db.path != "" {
+		if err := db.save(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Run updates the database at the times given by NextUpdate until ctx is
+// done, backing off after failed updates. It returns ctx.Err().
+func (db *Database) Run(ctx context.Context) error {
+	// The backoff recommended by the Update API documentation.
+	newBackoff := func() gax.Backoff {
+		return gax.Backoff{Initial: 15 * time.Minute, Max: 24 * time.Hour, Multiplier: 2}
+	}
+	bo := newBackoff()
+	for {
+		if err := gax.Sleep(ctx, time.Until(db.NextUpdate())); err != nil {
+			return err
+		}
+		err := db.Update(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			bo = newBackoff()
+			continue
+		}
+		if db.ErrorLog != nil {
+			db.ErrorLog.Printf("safebrowsingutil: update failed: %v", err)
+		}
+		retry := time.Now().Add(bo.Pause())
+		db.mu.Lock()
+		if retry.After(db.nextUpdate) {
+			db.nextUpdate = retry
+		}
+		db.mu.Unlock()
+	}
+}
+
+// parseDuration parses a duration in the JSON form of
+// google.protobuf.Duration, as in "300.5s".
+func parseDuration(s string) (time.Duration, error) {
+	if !strings.HasSuffix(s, "s") {
+		return 0, fmt.Errorf("safebrowsingutil: bad duration %q", s)
+	}
+	return time.ParseDuration(s)
+}
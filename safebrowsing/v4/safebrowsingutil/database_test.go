@@ -0,0 +1,300 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/internal/testserver"
+	safebrowsing "google.golang.org/api/safebrowsing/v4"
+)
+
+var testList = ThreatList{"MALWARE", "ANY_PLATFORM", "URL"}
+
+// fakeServer serves the Safe Browsing methods used by Database, answering
+// with the fetch and find functions and recording the requests.
+type fakeServer struct {
+	mu      sync.Mutex
+	fetches []*safebrowsing.FetchThreatListUpdatesRequest
+	finds   []*safebrowsing.FindFullHashesRequest
+	fetch   func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse
+	find    func(*safebrowsing.FindFullHashesRequest) *safebrowsing.FindFullHashesResponse
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp interface{}
+	switch r.URL.Path {
+	case "/v4/threatListUpdates:fetch":
+		var req safebrowsing.FetchThreatListUpdatesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.fetches = append(f.fetches, &req)
+		resp = f.fetch(&req)
+	case "/v4/fullHashes:find":
+		var req safebrowsing.FindFullHashesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.finds = append(f.finds, &req)
+		resp = f.find(&req)
+	default:
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeServer) numFinds() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.finds)
+}
+
+// checksum returns the checksum of a list with the hash prefixes.
+func checksum(hashes ...string) *safebrowsing.Checksum {
+	sorted := append([]string(nil), hashes...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "")))
+	return &safebrowsing.Checksum{Sha256: base64.StdEncoding.EncodeToString(sum[:])}
+}
+
+func rawHashes(hashes ...string) *safebrowsing.ThreatEntrySet {
+	return &safebrowsing.ThreatEntrySet{RawHashes: &safebrowsing.RawHashes{
+		PrefixSize: int64(len(hashes[0])),
+		RawHashes:  base64.StdEncoding.EncodeToString([]byte(strings.Join(hashes, ""))),
+	}}
+}
+
+// listUpdate returns a response to a fetch request with one list update.
+func listUpdate(lu *safebrowsing.ListUpdateResponse) *safebrowsing.FetchThreatListUpdatesResponse {
+	lu.ThreatType, lu.PlatformType, lu.ThreatEntryType = testList.ThreatType, testList.PlatformType, testList.ThreatEntryType
+	return &safebrowsing.FetchThreatListUpdatesResponse{
+		ListUpdateResponses: []*safebrowsing.ListUpdateResponse{lu},
+		MinimumWaitDuration: "0s",
+	}
+}
+
+func (db *Database) testHashes() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.hashLists[testList].hashes
+}
+
+func TestUpdate(t *testing.T) {
+	updates := []*safebrowsing.FetchThreatListUpdatesResponse{
+		listUpdate(&safebrowsing.ListUpdateResponse{
+			ResponseType: "FULL_UPDATE",
+			Additions: []*safebrowsing.ThreatEntrySet{
+				rawHashes("cccc", "aaaa"),
+				rawHashes("bbbbb"),
+				{RiceHashes: encodeRice([]uint32{0x64646464, 0x65656565}, 20)}, // "dddd", "eeee"
+			},
+			NewClientState: "s1",
+			Checksum:       checksum("aaaa", "bbbbb", "cccc", "dddd", "eeee"),
+		}),
+		listUpdate(&safebrowsing.ListUpdateResponse{
+			ResponseType: "PARTIAL_UPDATE",
+			Removals: []*safebrowsing.ThreatEntrySet{
+				{RiceIndices: encodeRice([]uint32{0, 2}, 1)},
+				{RawIndices: &safebrowsing.RawIndices{Indices: []int64{4}}},
+			},
+			Additions:      []*safebrowsing.ThreatEntrySet{rawHashes("ffff", "0000")},
+			NewClientState: "s2",
+			Checksum:       checksum("0000", "bbbbb", "dddd", "ffff"),
+		}),
+		// A checksum mismatch clears the list.
+		listUpdate(&safebrowsing.ListUpdateResponse{
+			ResponseType:   "PARTIAL_UPDATE",
+			Additions:      []*safebrowsing.ThreatEntrySet{rawHashes("gggg")},
+			NewClientState: "s3",
+			Checksum:       checksum("wrong"),
+		}),
+		listUpdate(&safebrowsing.ListUpdateResponse{
+			ResponseType:   "FULL_UPDATE",
+			Additions:      []*safebrowsing.ThreatEntrySet{rawHashes("hhhh")},
+			NewClientState: "s4",
+			Checksum:       checksum("hhhh"),
+		}),
+	}
+	f := &fakeServer{fetch: func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse {
+		resp := updates[0]
+		updates = updates[1:]
+		return resp
+	}}
+	svc, done := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done()
+	db, err := NewDatabase(svc.(*safebrowsing.Service), "", testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ClientID = "test"
+	ctx := context.Background()
+
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := db.testHashes(), []string{"aaaa", "bbbbb", "cccc", "dddd", "eeee"}; !cmp.Equal(got, want) {
+		t.Errorf("after full update: got %q, want %q", got, want)
+	}
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := db.testHashes(), []string{"0000", "bbbbb", "dddd", "ffff"}; !cmp.Equal(got, want) {
+		t.Errorf("after partial update: got %q, want %q", got, want)
+	}
+	if err := db.Update(ctx); err == nil {
+		t.Error("checksum mismatch: got nil, want error")
+	}
+	if got := db.testHashes(); len(got) != 0 {
+		t.Errorf("after checksum mismatch: got %q, want none", got)
+	}
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var states []string
+	for _, req := range f.fetches {
+		lr := req.ListUpdateRequests[0]
+		if req.Client.ClientId != "test" || lr.ThreatType != "MALWARE" || lr.Constraints == nil {
+			t.Errorf("bad request %+v", req)
+		}
+		states = append(states, lr.State)
+	}
+	if want := []string{"", "s1", "s2", ""}; !cmp.Equal(states, want) {
+		t.Errorf("got states %q, want %q", states, want)
+	}
+}
+
+func TestUpdateMinimumWait(t *testing.T) {
+	f := &fakeServer{fetch: func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse {
+		resp := listUpdate(&safebrowsing.ListUpdateResponse{ResponseType: "FULL_UPDATE", Checksum: checksum()})
+		resp.MinimumWaitDuration = "3600.5s"
+		return resp
+	}}
+	svc, done := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done()
+	db, err := NewDatabase(svc.(*safebrowsing.Service), "", testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ClientID = "test"
+	ctx := context.Background()
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(ctx); err == nil {
+		t.Error("early update: got nil, want error")
+	}
+	if len(f.fetches) != 1 {
+		t.Errorf("got %d requests, want 1", len(f.fetches))
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "safebrowsingutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db")
+
+	f := &fakeServer{fetch: func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse {
+		return listUpdate(&safebrowsing.ListUpdateResponse{
+			ResponseType:   "FULL_UPDATE",
+			Additions:      []*safebrowsing.ThreatEntrySet{rawHashes("aaaa", "bbbb")},
+			NewClientState: "s1",
+			Checksum:       checksum("aaaa", "bbbb"),
+		})
+	}}
+	svc, done := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done()
+	db, err := NewDatabase(svc.(*safebrowsing.Service), path, testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ClientID = "test"
+	if err := db.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, done2 := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done2()
+	db2, err := NewDatabase(svc.(*safebrowsing.Service), path, testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db2.ClientID = "test"
+	if got, want := db2.testHashes(), []string{"aaaa", "bbbb"}; !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := db2.hashLists[testList].state; got != "s1" {
+		t.Errorf("got state %q, want s1", got)
+	}
+	if !db2.updated.Equal(db.updated) || !db2.NextUpdate().Equal(db.NextUpdate()) {
+		t.Errorf("got times %v, %v, want %v, %v", db2.updated, db2.NextUpdate(), db.updated, db.NextUpdate())
+	}
+
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDatabase(db.svc, path, testList); err == nil {
+		t.Error("corrupted file: got nil, want error")
+	}
+
+	// A list with a hash prefix longer than a full hash is rejected.
+	long := strings.Repeat("a", 40)
+	fh, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(long))
+	err = gob.NewEncoder(fh).Encode(&dbFile{Lists: []dbFileList{{
+		List:   testList,
+		Hashes: []string{long},
+		SHA256: sum[:],
+	}}})
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDatabase(db.svc, path, testList); err == nil {
+		t.Error("hash prefix of 40 bytes: got nil, want error")
+	}
+}
+
+func TestNewHashList(t *testing.T) {
+	for _, n := range []int{0, 3, 33} {
+		if _, err := newHashList("", []string{strings.Repeat("a", n)}); err == nil {
+			t.Errorf("hash prefix of %d bytes: got nil, want error", n)
+		}
+	}
+	l, err := newHashList("", []string{"aaaa", strings.Repeat("b", 32), "cccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{4, 32}; !cmp.Equal(l.lengths, want) {
+		t.Errorf("got lengths %v, want %v", l.lengths, want)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package safebrowsingutil implements a Safe Browsing Update API client on
+// top of the Safe Browsing REST API (google.golang.org/api/safebrowsing/v4).
+//
+// A Database keeps a local copy of the hash prefixes of threat lists,
+// fetched with ThreatListUpdates.Fetch. It applies raw and Rice-encoded
+// updates, verifies the SHA-256 checksum of each list, and persists the
+// lists to a file. URLs are canonicalized and their host suffix and path
+// prefix expressions hashed as the API requires; only the few URLs whose
+// hash prefixes are in a local list need a FullHashes.Find request, and
+// the full hashes it returns are cached for the durations set by the
+// server:
+//
+//	db, err := safebrowsingutil.NewDatabase(svc, "/var/cache/sb.db",
+//		safebrowsingutil.ThreatList{"MALWARE", "ANY_PLATFORM", "URL"},
+//		safebrowsingutil.ThreatList{"SOCIAL_ENGINEERING", "ANY_PLATFORM", "URL"})
+//	...
+//	go db.Run(ctx)
+//	...
+//	threats, err := db.LookupURLs(ctx, "http://example.com/download")
+//
+// LookupURLs fails until the database has been loaded from its file or
+// updated once.
+//
+// This package is experimental and subject to change without notice.
+package safebrowsingutil
@@ -0,0 +1,268 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	safebrowsing "google.golang.org/api/safebrowsing/v4"
+)
+
+var errNotUpdated = errors.New("safebrowsingutil: database has not been updated")
+
+// A URLThreat is a threat list that matched a URL.
+type URLThreat struct {
+	ThreatList
+
+	// Pattern is the lookup expression of the URL that matched: a host
+	// suffix followed by a path prefix, as in "evil.example.com/downloads/".
+	Pattern string
+}
+
+// A fullHashCache caches the results of full-hash requests.
+type fullHashCache struct {
+	mu        sync.Mutex
+	positive  map[string]map[ThreatList]time.Time // full hash -> list -> expiry
+	negative  map[string]time.Time                // hash prefix -> expiry
+	findAfter time.Time                           // the server asks not to send requests before then
+}
+
+// get returns the lists that the full hash h, whose prefix in a local list
+// is prefix, is known to be in. It reports false if the cache does not
+// know whether h is in any list.
+func (c *fullHashCache) get(h, prefix string, now time.Time) (lists []ThreatList, ok bool) {
+	if entries := c.positive[h]; len(entries) > 0 {
+		for l, exp := range entries {
+			if !now.Before(exp) {
+				return nil, false
+			}
+			lists = append(lists, l)
+		}
+		return lists, true
+	}
+	if exp, found := c.negative[prefix]; found && now.Before(exp) {
+		return nil, true
+	}
+	return nil, false
+}
+
+// put records the response to a full-hash request for the prefixes.
+func (c *fullHashCache) put(prefixes []string, resp *safebrowsing.FindFullHashesResponse, now time.Time) error {
+	if c.positive == nil {
+		c.positive = map[string]map[ThreatList]time.Time{}
+		c.negative = map[string]time.Time{}
+	}
+	// Drop expired entries, and entries replaced by the response.
+	for h, entries := range c.positive {
+		for l, exp := range entries {
+			if !now.Before(exp) {
+				delete(entries, l)
+			}
+		}
+		for _, p := range prefixes {
+			if strings.HasPrefix(h, p) {
+				entries = nil
+				break
+			}
+		}
+		if len(entries) == 0 {
+			delete(c.positive, h)
+		}
+	}
+	for p, exp := range c.negative {
+		if !now.Before(exp) {
+			delete(c.negative, p)
+		}
+	}
+
+	if resp.MinimumWaitDuration != "" {
+		d, err := parseDuration(resp.MinimumWaitDuration)
+		if err != nil {
+			return err
+		}
+		c.findAfter = now.Add(d)
+	}
+	if resp.NegativeCacheDuration != "" {
+		d, err := parseDuration(resp.NegativeCacheDuration)
+		if err != nil {
+			return err
+		}
+		for _, p := range prefixes {
+			c.negative[p] = now.Add(d)
+		}
+	}
+	for _, m := range resp.Matches {
+		if m.Threat == nil {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(m.Threat.Hash)
+		if err != nil {
+			return fmt.Errorf("safebrowsingutil: bad full hash: %v", err)
+		}
+		d, err := parseDuration(m.CacheDuration)
+		if err != nil {
+			return err
+		}
+		h := string(b)
+		if c.positive[h] == nil {
+			c.positive[h] = map[ThreatList]time.Time{}
+		}
+		c.positive[h][ThreatList{m.ThreatType, m.PlatformType, m.ThreatEntryType}] = now.Add(d)
+	}
+	return nil
+}
+
+// A candidate is a lookup expression whose full hash has a prefix in one
+// of the local lists.
+type candidate struct {
+	url    int // index in the looked up URLs
+	expr   string
+	hash   string
+	prefix string
+	lists  []ThreatList // the local lists holding prefix
+}
+
+// LookupURLs looks up URLs in the threat lists with the "URL" threat entry
+// type, and returns the threats that match each URL. A nil slice means the
+// URL is safe.
+//
+// URLs are looked up in the local database. Only URLs whose hash prefixes
+// are found there, and whose full hashes are not cached, are checked with
+// a FullHashes.Find request.
+func (db *Database) LookupURLs(ctx context.Context, urls ...string) ([][]URLThreat, error) {
+	var cands []candidate
+	var states []string
+	var urlLists []ThreatList
+	db.mu.RLock()
+	if db.updated.IsZero() {
+		db.mu.RUnlock()
+		return nil, errNotUpdated
+	}
+	for _, l := range db.lists {
+		states = append(states, db.hashLists[l].state)
+		if l.ThreatEntryType == "URL" {
+			urlLists = append(urlLists, l)
+		}
+	}
+	for i, u := range urls {
+		exprs, err := lookupExpressions(u)
+		if err != nil {
+			db.mu.RUnlock()
+			return nil, err
+		}
+		for _, e := range exprs {
+			h := fullHash(e)
+			var c *candidate
+			for _, l := range urlLists {
+				p := db.hashLists[l].match(h)
+				if p == "" {
+					continue
+				}
+				if c == nil {
+					cands = append(cands, candidate{url: i, expr: e, hash: h, prefix: p})
+					c = &cands[len(cands)-1]
+				} else if len(p) < len(c.prefix) {
+					c.prefix = p
+				}
+				c.lists = append(c.lists, l)
+			}
+		}
+	}
+	db.mu.RUnlock()
+
+	results := make([][]URLThreat, len(urls))
+	if len(cands) == 0 {
+		return results, nil
+	}
+	// The cache is not locked while full hashes are requested, so that
+	// other lookups are not held up by the request.
+	c := &db.cache
+	c.mu.Lock()
+	now := time.Now()
+	var prefixes []string
+	seen := map[string]bool{}
+	for _, cand := range cands {
+		if _, ok := c.get(cand.hash, cand.prefix, now); !ok && !seen[cand.prefix] {
+			seen[cand.prefix] = true
+			prefixes = append(prefixes, cand.prefix)
+		}
+	}
+	findAfter := c.findAfter
+	c.mu.Unlock()
+	var resp *safebrowsing.FindFullHashesResponse
+	if len(prefixes) > 0 {
+		if now.Before(findAfter) {
+			return nil, fmt.Errorf("safebrowsingutil: the server asked not to request full hashes before %v", findAfter.Format(time.RFC3339))
+		}
+		var err error
+		if resp, err = db.findFullHashes(ctx, prefixes, states, urlLists); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now = time.Now()
+	if resp != nil {
+		if err := c.put(prefixes, resp, now); err != nil {
+			return nil, err
+		}
+	}
+	for _, cand := range cands {
+		lists, _ := c.get(cand.hash, cand.prefix, now)
+		for _, l := range lists {
+			for _, ll := range cand.lists {
+				if l == ll {
+					results[cand.url] = append(results[cand.url], URLThreat{ThreatList: l, Pattern: cand.expr})
+					break
+				}
+			}
+		}
+	}
+	for _, r := range results {
+		sort.Slice(r, func(i, j int) bool {
+			if r[i].Pattern != r[j].Pattern {
+				return r[i].Pattern < r[j].Pattern
+			}
+			return r[i].ThreatList.String() < r[j].ThreatList.String()
+		})
+	}
+	return results, nil
+}
+
+// findFullHashes requests the full hashes of the prefixes.
+func (db *Database) findFullHashes(ctx context.Context, prefixes, states []string, lists []ThreatList) (*safebrowsing.FindFullHashesResponse, error) {
+	info := &safebrowsing.ThreatInfo{}
+	for _, l := range lists {
+		info.ThreatTypes = appendUnique(info.ThreatTypes, l.ThreatType)
+		info.PlatformTypes = appendUnique(info.PlatformTypes, l.PlatformType)
+		info.ThreatEntryTypes = appendUnique(info.ThreatEntryTypes, l.ThreatEntryType)
+	}
+	for _, p := range prefixes {
+		info.ThreatEntries = append(info.ThreatEntries, &safebrowsing.ThreatEntry{Hash: base64.StdEncoding.EncodeToString([]byte(p))})
+	}
+	req := &safebrowsing.FindFullHashesRequest{
+		Client:       db.clientInfo(),
+		ClientStates: states,
+		ThreatInfo:   info,
+	}
+	return db.svc.FullHashes.Find(req).Context(ctx).Do()
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, x := range s {
+		if x == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/internal/testserver"
+	safebrowsing "google.golang.org/api/safebrowsing/v4"
+)
+
+func TestLookupURLs(t *testing.T) {
+	evil := fullHash("evil.example.com/")
+	falsePositive := fullHash("example.org/ok.html")
+	f := &fakeServer{
+		fetch: func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse {
+			return listUpdate(&safebrowsing.ListUpdateResponse{
+				ResponseType:   "FULL_UPDATE",
+				Additions:      []*safebrowsing.ThreatEntrySet{rawHashes(evil[:4], falsePositive[:4])},
+				NewClientState: "s1",
+				Checksum:       checksum(evil[:4], falsePositive[:4]),
+			})
+		},
+		find: func(req *safebrowsing.FindFullHashesRequest) *safebrowsing.FindFullHashesResponse {
+			resp := &safebrowsing.FindFullHashesResponse{NegativeCacheDuration: "60s"}
+			for _, e := range req.ThreatInfo.ThreatEntries {
+				if e.Hash == base64.StdEncoding.EncodeToString([]byte(evil[:4])) {
+					resp.Matches = append(resp.Matches, &safebrowsing.ThreatMatch{
+						ThreatType:      "MALWARE",
+						PlatformType:    "ANY_PLATFORM",
+						ThreatEntryType: "URL",
+						Threat:          &safebrowsing.ThreatEntry{Hash: base64.StdEncoding.EncodeToString([]byte(evil))},
+						CacheDuration:   "300s",
+					})
+				}
+			}
+			return resp
+		},
+	}
+	svc, done := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done()
+	db, err := NewDatabase(svc.(*safebrowsing.Service), "", testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ClientID = "test"
+	ctx := context.Background()
+	if _, err := db.LookupURLs(ctx, "http://example.com/"); err != errNotUpdated {
+		t.Errorf("before update: got %v, want errNotUpdated", err)
+	}
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []string{
+		"http://evil.example.com/some/page.html",
+		"http://good.example.com/",
+		"https://a.b.EVIL.example.com:8080/",
+		"http://example.org/ok.html",
+	}
+	threat := URLThreat{ThreatList: testList, Pattern: "evil.example.com/"}
+	want := [][]URLThreat{{threat}, nil, {threat}, nil}
+	for i := 0; i < 2; i++ {
+		got, err := db.LookupURLs(ctx, urls...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("lookup %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+	// The second lookup is answered from the cache.
+	if n := f.numFinds(); n != 1 {
+		t.Fatalf("got %d full-hash requests, want 1", n)
+	}
+	req := f.finds[0]
+	if len(req.ThreatInfo.ThreatEntries) != 2 || !cmp.Equal(req.ClientStates, []string{"s1"}) {
+		t.Errorf("bad request %+v", req)
+	}
+
+	// Expired entries are requested again.
+	db.cache.mu.Lock()
+	for _, entries := range db.cache.positive {
+		for l := range entries {
+			entries[l] = time.Now().Add(-time.Second)
+		}
+	}
+	db.cache.mu.Unlock()
+	if _, err := db.LookupURLs(ctx, urls[0], urls[3]); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.numFinds(); n != 2 {
+		t.Errorf("got %d full-hash requests, want 2", n)
+	}
+	if got := len(f.finds[1].ThreatInfo.ThreatEntries); got != 1 {
+		t.Errorf("got %d prefixes requested, want 1", got)
+	}
+}
+
+func TestLookupURLsMinimumWait(t *testing.T) {
+	h := fullHash("example.com/")
+	f := &fakeServer{
+		fetch: func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse {
+			return listUpdate(&safebrowsing.ListUpdateResponse{
+				ResponseType: "FULL_UPDATE",
+				Additions:    []*safebrowsing.ThreatEntrySet{rawHashes(h[:4])},
+				Checksum:     checksum(h[:4]),
+			})
+		},
+		find: func(*safebrowsing.FindFullHashesRequest) *safebrowsing.FindFullHashesResponse {
+			return &safebrowsing.FindFullHashesResponse{MinimumWaitDuration: "600s"}
+		},
+	}
+	svc, done := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done()
+	db, err := NewDatabase(svc.(*safebrowsing.Service), "", testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ClientID = "test"
+	ctx := context.Background()
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.LookupURLs(ctx, "http://example.com/"); err != nil || got[0] != nil {
+		t.Fatalf("got %v, %v, want no threats", got, err)
+	}
+	if _, err := db.LookupURLs(ctx, "http://example.com/"); err == nil {
+		t.Error("lookup during minimum wait: got nil, want error")
+	}
+}
+
+func TestLookupURLsConcurrent(t *testing.T) {
+	a, b := fullHash("a.example.com/"), fullHash("b.example.com/")
+	finding, release := make(chan struct{}), make(chan struct{})
+	f := &fakeServer{
+		fetch: func(*safebrowsing.FetchThreatListUpdatesRequest) *safebrowsing.FetchThreatListUpdatesResponse {
+			return listUpdate(&safebrowsing.ListUpdateResponse{
+				ResponseType: "FULL_UPDATE",
+				Additions:    []*safebrowsing.ThreatEntrySet{rawHashes(a[:4], b[:4])},
+				Checksum:     checksum(a[:4], b[:4]),
+			})
+		},
+		find: func(req *safebrowsing.FindFullHashesRequest) *safebrowsing.FindFullHashesResponse {
+			if req.ThreatInfo.ThreatEntries[0].Hash == base64.StdEncoding.EncodeToString([]byte(b[:4])) {
+				close(finding)
+				<-release
+			}
+			return &safebrowsing.FindFullHashesResponse{NegativeCacheDuration: "60s"}
+		},
+	}
+	svc, done := testserver.NewService(t, f, safebrowsing.NewService)
+	defer done()
+	db, err := NewDatabase(svc.(*safebrowsing.Service), "", testList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.ClientID = "test"
+	ctx := context.Background()
+	if err := db.Update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LookupURLs(ctx, "http://a.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := db.LookupURLs(ctx, "http://b.example.com/")
+		errc <- err
+	}()
+	<-finding
+	// Cached lookups do not wait for the request of the other one.
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	got := make(chan error, 1)
+	go func() {
+		_, err := db.LookupURLs(tctx, "http://a.example.com/")
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-tctx.Done():
+		t.Error("cached lookup blocked by a full-hash request")
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	safebrowsing "google.golang.org/api/safebrowsing/v4"
+)
+
+// A bitReader reads the bits of a byte slice, least significant bit of
+// each byte first.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	if r.pos >= 8*len(r.data) {
+		return 0, errors.New("safebrowsingutil: Rice-encoded data is too short")
+	}
+	b := uint64(r.data[r.pos/8]>>(uint(r.pos)%8)) & 1
+	r.pos++
+	return b, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v |= b << uint(i)
+	}
+	return v, nil
+}
+
+// decodeRice decodes Rice-Golomb-encoded integers: the first value
+// followed by the deltas between consecutive values, each delta being a
+// unary quotient followed by a remainder of riceParameter bits.
+func decodeRice(enc *safebrowsing.RiceDeltaEncoding) ([]uint32, error) {
+	if enc.FirstValue < 0 || enc.FirstValue > math.MaxUint32 {
+		return nil, fmt.Errorf("safebrowsingutil: bad Rice first value %d", enc.FirstValue)
+	}
+	values := []uint32{uint32(enc.FirstValue)}
+	if enc.NumEntries == 0 {
+		return values, nil
+	}
+	k := int(enc.RiceParameter)
+	if k < 0 || k > 32 {
+		return nil, fmt.Errorf("safebrowsingutil: bad Rice parameter %d", k)
+	}
+	data, err := base64.StdEncoding.DecodeString(enc.EncodedData)
+	if err != nil {
+		return nil, fmt.Errorf("safebrowsingutil: bad Rice-encoded data: %v", err)
+	}
+	r := &bitReader{data: data}
+	v := uint64(enc.FirstValue)
+	for i := int64(0); i < enc.NumEntries; i++ {
+		var q uint64
+		for {
+			b, err := r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if b == 0 {
+				break
+			}
+			q++
+		}
+		rem, err := r.readBits(k)
+		if err != nil {
+			return nil, err
+		}
+		v += q<<uint(k) + rem
+		if v > math.MaxUint32 {
+			return nil, errors.New("safebrowsingutil: Rice-encoded value overflows")
+		}
+		values = append(values, uint32(v))
+	}
+	return values, nil
+}
+
+// decodeHashes returns the hash prefixes of a set of threat entries.
+func decodeHashes(set *safebrowsing.ThreatEntrySet) ([]string, error) {
+	switch {
+	case set.RawHashes != nil:
+		size := int(set.RawHashes.PrefixSize)
+		if size < 4 || size > 32 {
+			return nil, fmt.Errorf("safebrowsingutil: bad hash prefix size %d", size)
+		}
+		b, err := base64.StdEncoding.DecodeString(set.RawHashes.RawHashes)
+		if err != nil {
+			return nil, fmt.Errorf("safebrowsingutil: bad raw hashes: %v", err)
+		}
+		if len(b)%size != 0 {
+			return nil, fmt.Errorf("safebrowsingutil: %d bytes of raw hashes are not a multiple of %d", len(b), size)
+		}
+		hashes := make([]string, 0, len(b)/size)
+		for i := 0; i < len(b); i += size {
+			hashes = append(hashes, string(b[i:i+size]))
+		}
+		return hashes, nil
+	case set.RiceHashes != nil:
+		values, err := decodeRice(set.RiceHashes)
+		if err != nil {
+			return nil, err
+		}
+		// Rice-encoded hashes are 4-byte prefixes, as little-endian integers.
+		hashes := make([]string, len(values))
+		var b [4]byte
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(b[:], v)
+			hashes[i] = string(b[:])
+		}
+		return hashes, nil
+	}
+	return nil, errors.New("safebrowsingutil: threat entry set has no hashes")
+}
+
+// decodeIndices returns the indices of a set of removed threat entries.
+func decodeIndices(set *safebrowsing.ThreatEntrySet) ([]int, error) {
+	switch {
+	case set.RawIndices != nil:
+		indices := make([]int, len(set.RawIndices.Indices))
+		for i, x := range set.RawIndices.Indices {
+			indices[i] = int(x)
+		}
+		return indices, nil
+	case set.RiceIndices != nil:
+		values, err := decodeRice(set.RiceIndices)
+		if err != nil {
+			return nil, err
+		}
+		indices := make([]int, len(values))
+		for i, v := range values {
+			indices[i] = int(v)
+		}
+		return indices, nil
+	}
+	return nil, errors.New("safebrowsingutil: threat entry set has no indices")
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	safebrowsing "google.golang.org/api/safebrowsing/v4"
+)
+
+// encodeRice Rice-encodes sorted values with parameter k.
+func encodeRice(values []uint32, k int) *safebrowsing.RiceDeltaEncoding {
+	var bits []byte
+	for i := 1; i < len(values); i++ {
+		d := values[i] - values[i-1]
+		for q := d >> uint(k); q > 0; q-- {
+			bits = append(bits, 1)
+		}
+		bits = append(bits, 0)
+		for j := 0; j < k; j++ {
+			bits = append(bits, byte(d>>uint(j)&1))
+		}
+	}
+	data := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		data[i/8] |= b << uint(i%8)
+	}
+	return &safebrowsing.RiceDeltaEncoding{
+		FirstValue:    int64(values[0]),
+		NumEntries:    int64(len(values) - 1),
+		RiceParameter: int64(k),
+		EncodedData:   base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+func TestDecodeRice(t *testing.T) {
+	// 5, then deltas 2 (quotient 0, remainder 10) and 6 (quotient 1,
+	// remainder 10), with bits stored least significant first.
+	enc := &safebrowsing.RiceDeltaEncoding{
+		FirstValue:    5,
+		NumEntries:    2,
+		RiceParameter: 2,
+		EncodedData:   base64.StdEncoding.EncodeToString([]byte{0x4c}),
+	}
+	got, err := decodeRice(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint32{5, 7, 13}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, test := range []struct {
+		values []uint32
+		k      int
+	}{
+		{[]uint32{0}, 2},
+		{[]uint32{1, 2, 3, 1000, 1 << 20, 1<<32 - 1}, 10},
+		{[]uint32{7, 7, 8, 100000}, 28},
+		{[]uint32{0, 1, 3, 6, 10}, 0},
+	} {
+		got, err := decodeRice(encodeRice(test.values, test.k))
+		if err != nil {
+			t.Errorf("%v, %d: %v", test.values, test.k, err)
+			continue
+		}
+		if !cmp.Equal(got, test.values) {
+			t.Errorf("got %v, want %v", got, test.values)
+		}
+	}
+}
+
+func TestDecodeRiceErrors(t *testing.T) {
+	short := encodeRice([]uint32{1, 1000, 2000}, 4)
+	short.NumEntries = 3
+	overflow := encodeRice([]uint32{1<<32 - 2, 1<<32 - 1}, 2)
+	overflow.EncodedData = base64.StdEncoding.EncodeToString([]byte{0xff, 0xff})
+	for _, enc := range []*safebrowsing.RiceDeltaEncoding{
+		short,
+		overflow,
+		{FirstValue: -1},
+		{FirstValue: 1, NumEntries: 1, RiceParameter: 40, EncodedData: "AA=="},
+		{FirstValue: 1, NumEntries: 1, RiceParameter: 2, EncodedData: "!"},
+	} {
+		if _, err := decodeRice(enc); err == nil {
+			t.Errorf("decodeRice(%+v): got nil, want error", enc)
+		}
+	}
+}
+
+func TestDecodeHashes(t *testing.T) {
+	raw := &safebrowsing.ThreatEntrySet{RawHashes: &safebrowsing.RawHashes{
+		PrefixSize: 5,
+		RawHashes:  base64.StdEncoding.EncodeToString([]byte("aaaaabbbbb")),
+	}}
+	got, err := decodeHashes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"aaaaa", "bbbbb"}; !cmp.Equal(got, want) {
+		t.Errorf("raw: got %q, want %q", got, want)
+	}
+
+	rice := &safebrowsing.ThreatEntrySet{RiceHashes: encodeRice([]uint32{0x64636261, 0x64636262}, 2)}
+	got, err = decodeHashes(rice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"abcd", "bbcd"}; !cmp.Equal(got, want) {
+		t.Errorf("rice: got %q, want %q", got, want)
+	}
+
+	raw.RawHashes.PrefixSize = 3
+	if _, err := decodeHashes(raw); err == nil {
+		t.Error("prefix size 3: got nil, want error")
+	}
+}
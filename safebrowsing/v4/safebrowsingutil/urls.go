@@ -0,0 +1,291 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safebrowsingutil
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// controlRemover removes the tabs and line breaks of URLs.
+var controlRemover = strings.NewReplacer("\t", "", "\r", "", "\n", "")
+
+// canonicalURL returns the canonical form of a URL, as described in
+// https://developers.google.com/safe-browsing/v4/urls-hashing#canonicalization.
+func canonicalURL(rawURL string) (string, error) {
+	host, path, query, hasQuery, err := splitURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	s := "http://" + escape(host) + escape(path)
+	if hasQuery {
+		s += "?" + escape(query)
+	}
+	return s, nil
+}
+
+// splitURL canonicalizes a URL and returns its unescaped host, path and
+// query. The scheme, user info, port and fragment are dropped.
+func splitURL(rawURL string) (host, path, query string, hasQuery bool, err error) {
+	s := strings.TrimSpace(rawURL)
+	s = controlRemover.Replace(s)
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s = s[:i]
+	}
+	s = unescape(s)
+	if i := schemeEnd(s); i >= 0 {
+		s = s[i:]
+	}
+	i := strings.IndexAny(s, "/?")
+	if i < 0 {
+		i = len(s)
+	}
+	host, rest := s[:i], s[i:]
+	if j := strings.LastIndexByte(host, '@'); j >= 0 {
+		host = host[j+1:]
+	}
+	host, err = canonicalHost(host)
+	if err != nil {
+		return "", "", "", false, err
+	}
+	if j := strings.IndexByte(rest, '?'); j >= 0 {
+		rest, query, hasQuery = rest[:j], rest[j+1:], true
+	}
+	return host, canonicalPath(rest), query, hasQuery, nil
+}
+
+// schemeEnd returns the index after the "://" following the scheme of s, or
+// -1 if s has no scheme.
+func schemeEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		case i > 0 && c == ':':
+			if strings.HasPrefix(s[i:], "://") {
+				return i + 3
+			}
+			return -1
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// unescape percent-unescapes s until it has no more escapes. Percent signs
+// that do not start an escape are left as they are.
+func unescape(s string) string {
+	for {
+		var b []byte
+		for i := 0; i < len(s); i++ {
+			if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+				if b == nil {
+					b = append(make([]byte, 0, len(s)), s[:i]...)
+				}
+				b = append(b, unhex(s[i+1])<<4|unhex(s[i+2]))
+				i += 2
+				continue
+			}
+			if b != nil {
+				b = append(b, s[i])
+			}
+		}
+		if b == nil {
+			return s
+		}
+		s = string(b)
+	}
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// escape percent-escapes control characters, spaces, non-ASCII bytes, '#'
+// and '%'.
+func escape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '#' || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// canonicalHost lowercases a host, removes its port and extra dots, and
+// normalizes IPv4 addresses to dotted decimal form.
+func canonicalHost(host string) (string, error) {
+	if strings.HasPrefix(host, "[") {
+		// An IPv6 address.
+		i := strings.IndexByte(host, ']')
+		if i < 0 {
+			return "", fmt.Errorf("safebrowsingutil: bad host %q", host)
+		}
+		return lowerASCII(host[:i+1]), nil
+	}
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	host = lowerASCII(strings.Trim(host, "."))
+	for strings.Contains(host, "..") {
+		host = strings.Replace(host, "..", ".", -1)
+	}
+	if host == "" {
+		return "", errors.New("safebrowsingutil: URL has no host")
+	}
+	if ip := parseIPv4(host); ip != nil {
+		return ip.String(), nil
+	}
+	return host, nil
+}
+
+// lowerASCII lowercases the ASCII letters of s. Unlike strings.ToLower, it
+// keeps invalid UTF-8 as it is.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// parseIPv4 parses the IPv4 address forms accepted by browsers, such as
+// "3279880203", "0xc3.0177.0.11" and "195.127.11", or returns nil.
+func parseIPv4(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	ip := make(net.IP, 4)
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 0, 32)
+		if err != nil {
+			return nil
+		}
+		if i < len(parts)-1 {
+			if n > 0xff {
+				return nil
+			}
+			ip[i] = byte(n)
+			continue
+		}
+		// The last part fills the remaining bytes.
+		for j := 3; j >= i; j-- {
+			ip[j] = byte(n)
+			n >>= 8
+		}
+		if n != 0 {
+			return nil
+		}
+	}
+	return ip
+}
+
+// canonicalPath resolves "." and ".." segments of a path and collapses
+// runs of slashes.
+func canonicalPath(path string) string {
+	var segs []string
+	parts := strings.Split(path, "/")
+	for _, p := range parts {
+		switch p {
+		case "", ".":
+		case "..":
+			if len(segs) > 0 {
+				segs = segs[:len(segs)-1]
+			}
+		default:
+			segs = append(segs, p)
+		}
+	}
+	s := "/" + strings.Join(segs, "/")
+	if last := parts[len(parts)-1]; len(segs) > 0 && (last == "" || last == "." || last == "..") {
+		s += "/"
+	}
+	return s
+}
+
+// lookupExpressions returns the host suffix and path prefix expressions
+// of a URL that are looked up in threat lists, as described in
+// https://developers.google.com/safe-browsing/v4/urls-hashing#suffixprefix-expressions.
+func lookupExpressions(rawURL string) ([]string, error) {
+	host, path, query, hasQuery, err := splitURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host, path, query = escape(host), escape(path), escape(query)
+
+	hosts := []string{host}
+	if parseIPv4(host) == nil && !strings.HasPrefix(host, "[") {
+		// Up to four hosts formed from the last five components, leaving
+		// out the top-level domain on its own.
+		comps := strings.Split(host, ".")
+		start := len(comps) - 5
+		if start < 1 {
+			start = 1
+		}
+		for i := start; i < len(comps)-1; i++ {
+			hosts = append(hosts, strings.Join(comps[i:], "."))
+		}
+	}
+
+	var paths []string
+	if hasQuery {
+		paths = append(paths, path+"?"+query)
+	}
+	paths = append(paths, path)
+	// Up to four directory prefixes, starting with the root.
+	dirs := strings.Split(path, "/")
+	dirs = dirs[1 : len(dirs)-1]
+	prefix := "/"
+	paths = append(paths, prefix)
+	for i := 0; i < len(dirs) && i < 3; i++ {
+		prefix += dirs[i] + "/"
+		paths = append(paths, prefix)
+	}
+
+	var exprs []string
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		for _, p := range paths {
+			e := h + p
+			if !seen[e] {
+				seen[e] = true
+				exprs = append(exprs, e)
+			}
+		}
+	}
+	return exprs, nil
+}
+
+// fullHash returns the SHA-256 hash of a lookup expression.
+func fullHash(expr string) string {
+	h := sha256.Sum256([]byte(expr))
+	return string(h[:])
+}
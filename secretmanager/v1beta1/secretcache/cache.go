@@ -0,0 +1,343 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secretcache
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "google.golang.org/api/secretmanager/v1beta1"
+)
+
+const (
+	// DefaultTTL is the default time a secret is served from the cache
+	// before it is accessed again.
+	DefaultTTL = 5 * time.Minute
+
+	// DefaultRefreshInterval is the default time between the background
+	// refreshes made by Run.
+	DefaultRefreshInterval = time.Minute
+
+	// DefaultMaxStale is the default time a secret is still served after
+	// its TTL when accessing it fails.
+	DefaultMaxStale = time.Hour
+)
+
+var errClosed = errors.New("secretcache: Cache is closed")
+
+// A Change describes a secret version name that resolves to a new version.
+type Change struct {
+	// Name is the secret version name passed to Get, with "/versions/latest"
+	// appended if it named a secret.
+	Name string
+
+	// OldVersion and NewVersion are the full resource names of the
+	// versions Name resolved to before and after the change.
+	OldVersion string
+	NewVersion string
+}
+
+// An entry is a cached secret version.
+type entry struct {
+	mu      sync.Mutex // held by Get while accessing the secret
+	data    []byte
+	version string    // resolved version name
+	fetched time.Time // zero if data is not valid
+	evicted bool
+}
+
+// A Cache caches secret versions accessed with the Secret Manager API.
+//
+// The exported fields are only safe to modify prior to the first call to a
+// method.
+type Cache struct {
+	// TTL is how long a secret is served from the cache before it is
+	// accessed again. The default is DefaultTTL.
+	TTL time.Duration
+
+	// RefreshInterval is the time between the refreshes of all cached
+	// secrets made by Run. If zero, DefaultRefreshInterval is used.
+	RefreshInterval time.Duration
+
+	// MaxStale is how long after its TTL a secret is still served when
+	// accessing it fails. Zero disables serving stale secrets. The default
+	// is DefaultMaxStale.
+	MaxStale time.Duration
+
+	// OnChange, if non-nil, is called when a name resolves to a new
+	// version, such as when a new version of a secret accessed as "latest"
+	// is added. It is called without locks held, from the goroutine that
+	// noticed the change.
+	OnChange func(Change)
+
+	// ErrorLog, if non-nil, logs the errors of background refreshes and of
+	// accesses that are answered with stale secrets.
+	ErrorLog *log.Logger
+
+	svc *secretmanager.Service
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	closed  bool
+}
+
+// NewCache returns a Cache that accesses secrets with svc.
+func NewCache(svc *secretmanager.Service) *Cache {
+	return &Cache{
+		TTL:             DefaultTTL,
+		RefreshInterval: DefaultRefreshInterval,
+		MaxStale:        DefaultMaxStale,
+		svc:             svc,
+		entries:         map[string]*entry{},
+	}
+}
+
+// versionName returns the version name for name, which may be a secret
+// version name, as in "projects/p/secrets/s/versions/3", or a secret name,
+// which stands for its latest version.
+func versionName(name string) string {
+	if strings.Contains(name, "/versions/") {
+		return name
+	}
+	return name + "/versions/latest"
+}
+
+// Get returns the payload of the secret version with the given name, as in
+// "projects/p/secrets/s/versions/latest". A secret name, as in
+// "projects/p/secrets/s", stands for its latest version.
+//
+// The returned slice is a copy that the caller may modify.
+func (c *Cache) Get(ctx context.Context, name string) ([]byte, error) {
+	name = versionName(name)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errClosed
+	}
+	e, ok := c.entries[name]
+	if !ok {
+		e = &entry{}
+		c.entries[name] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	now := time.Now()
+	if !e.fetched.IsZero() && now.Before(e.fetched.Add(c.TTL)) {
+		data := copyBytes(e.data)
+		e.mu.Unlock()
+		return data, nil
+	}
+	change, err := c.access(ctx, name, e)
+	var data []byte
+	if err == nil {
+		data = copyBytes(e.data)
+	} else if !e.fetched.IsZero() && now.Before(e.fetched.Add(c.TTL+c.MaxStale)) {
+		c.logf("secretcache: serving stale %s: %v", name, err)
+		data, err = copyBytes(e.data), nil
+	}
+	e.mu.Unlock()
+	if err != nil {
+		c.dropUnfetched(name, e)
+	}
+	c.notify(change)
+	return data, err
+}
+
+// dropUnfetched removes e, the entry of name, from the cache if it was never
+// fetched, so that names that fail do not accumulate.
+func (c *Cache) dropUnfetched(name string, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.fetched.IsZero() && c.entries[name] == e {
+		delete(c.entries, name)
+	}
+}
+
+// GetString is like Get, returning the payload as a string.
+func (c *Cache) GetString(ctx context.Context, name string) (string, error) {
+	data, err := c.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	s := string(data)
+	zero(data)
+	return s, nil
+}
+
+// access accesses the secret version and stores it in e, returning the
+// change of the resolved version, if any. e.mu must be held.
+func (c *Cache) access(ctx context.Context, name string, e *entry) (*Change, error) {
+	data, version, err := c.fetch(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return e.set(name, data, version), nil
+}
+
+// fetch accesses the secret version, returning its payload and resolved
+// version name.
+func (c *Cache) fetch(ctx context.Context, name string) (data []byte, version string, err error) {
+	resp, err := c.svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, "", fmt.Errorf("secretcache: accessing %s: %v", name, err)
+	}
+	var payload string
+	if resp.Payload != nil {
+		payload = resp.Payload.Data
+	}
+	data, err = base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("secretcache: bad payload of %s: %v", name, err)
+	}
+	return data, resp.Name, nil
+}
+
+// set stores the payload of a version of the secret version name in e,
+// returning the change of the resolved version, if any. e.mu must be held.
+func (e *entry) set(name string, data []byte, version string) *Change {
+	var change *Change
+	if e.version != "" && version != e.version {
+		change = &Change{Name: name, OldVersion: e.version, NewVersion: version}
+	}
+	zero(e.data)
+	e.data = data
+	e.version = version
+	e.fetched = time.Now()
+	return change
+}
+
+func (c *Cache) notify(change *Change) {
+	if change != nil && c.OnChange != nil {
+		c.OnChange(*change)
+	}
+}
+
+// Run refreshes all cached secrets every RefreshInterval until ctx is done,
+// so that Get rarely waits for an access. Secrets that cannot be refreshed
+// are evicted once they are too stale to be served. Run returns ctx.Err().
+func (c *Cache) Run(ctx context.Context) error {
+	interval := c.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			c.refresh(ctx)
+		}
+	}
+}
+
+// refresh accesses all cached secrets again.
+func (c *Cache) refresh(ctx context.Context) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		c.mu.Lock()
+		e := c.entries[name]
+		c.mu.Unlock()
+		if e == nil {
+			continue // invalidated
+		}
+		// Access the secret without holding e.mu, so that Get serves the
+		// cached payload meanwhile.
+		data, version, err := c.fetch(ctx, name)
+		var change *Change
+		evict := false
+		e.mu.Lock()
+		switch {
+		case e.evicted:
+			zero(data)
+		case err != nil:
+			if ctx.Err() == nil {
+				c.logf("secretcache: refreshing: %v", err)
+				evict = !time.Now().Before(e.fetched.Add(c.TTL + c.MaxStale))
+			}
+		default:
+			change = e.set(name, data, version)
+		}
+		e.mu.Unlock()
+		if evict {
+			c.evict(name, e)
+		}
+		c.notify(change)
+	}
+}
+
+// Invalidate removes the secret version with the given name from the cache,
+// zeroing its payload. The next Get accesses it again.
+func (c *Cache) Invalidate(name string) {
+	name = versionName(name)
+	c.mu.Lock()
+	e := c.entries[name]
+	c.mu.Unlock()
+	if e != nil {
+		c.evict(name, e)
+	}
+}
+
+// evict removes e, the entry of name, from the cache and zeroes its payload.
+func (c *Cache) evict(name string, e *entry) {
+	c.mu.Lock()
+	if c.entries[name] == e {
+		delete(c.entries, name)
+	}
+	c.mu.Unlock()
+	e.mu.Lock()
+	zero(e.data)
+	e.data = nil
+	e.version = ""
+	e.fetched = time.Time{}
+	e.evicted = true
+	e.mu.Unlock()
+}
+
+// Close zeroes and removes all cached secrets. Later calls to Get fail.
+func (c *Cache) Close() {
+	c.mu.Lock()
+	c.closed = true
+	entries := c.entries
+	c.entries = map[string]*entry{}
+	c.mu.Unlock()
+	for name, e := range entries {
+		c.evict(name, e)
+	}
+}
+
+func (c *Cache) logf(format string, args ...interface{}) {
+	if c.ErrorLog != nil {
+		c.ErrorLog.Printf(format, args...)
+	}
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secretcache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/internal/testserver"
+	secretmanager "google.golang.org/api/secretmanager/v1beta1"
+)
+
+// fakeSecrets serves Access for the versions of secrets in a project "p".
+type fakeSecrets struct {
+	mu       sync.Mutex
+	versions map[string][]string // secret ID -> payloads of versions 1, 2, ...
+	accesses int
+	fail     bool
+	block    chan struct{} // if set, accesses wait until it is closed
+	blocked  int           // number of accesses waiting for block
+}
+
+func (f *fakeSecrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	if block := f.block; block != nil {
+		f.blocked++
+		f.mu.Unlock()
+		<-block
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+	f.accesses++
+	if f.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	// /v1beta1/projects/p/secrets/{id}/versions/{v}:access
+	parts := strings.Split(strings.TrimSuffix(r.URL.Path, ":access"), "/")
+	if len(parts) != 8 {
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	payloads := f.versions[parts[5]]
+	v := len(payloads)
+	if parts[7] != "latest" {
+		v, _ = strconv.Atoi(parts[7])
+	}
+	if v < 1 || v > len(payloads) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(&secretmanager.AccessSecretVersionResponse{
+		Name:    "projects/p/secrets/" + parts[5] + "/versions/" + strconv.Itoa(v),
+		Payload: &secretmanager.SecretPayload{Data: base64.StdEncoding.EncodeToString([]byte(payloads[v-1]))},
+	})
+}
+
+func (f *fakeSecrets) addVersion(id, payload string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.versions[id] = append(f.versions[id], payload)
+}
+
+func (f *fakeSecrets) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakeSecrets) numAccesses() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accesses
+}
+
+// expire makes the cached entry of name older than the TTL.
+func (c *Cache) expire(name string, by time.Duration) {
+	c.mu.Lock()
+	e := c.entries[versionName(name)]
+	c.mu.Unlock()
+	e.mu.Lock()
+	e.fetched = e.fetched.Add(-c.TTL - by)
+	e.mu.Unlock()
+}
+
+func TestGetCaches(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw1"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		got, err := c.GetString(ctx, "projects/p/secrets/db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "pw1" {
+			t.Errorf("got %q, want pw1", got)
+		}
+	}
+	if n := f.numAccesses(); n != 1 {
+		t.Errorf("got %d accesses, want 1", n)
+	}
+
+	// The returned slice is a copy.
+	b, _ := c.Get(ctx, "projects/p/secrets/db/versions/latest")
+	b[0] = 'X'
+	if got, _ := c.GetString(ctx, "projects/p/secrets/db"); got != "pw1" {
+		t.Errorf("after modifying result: got %q, want pw1", got)
+	}
+
+	c.expire("projects/p/secrets/db", 0)
+	f.addVersion("db", "pw2")
+	if got, _ := c.GetString(ctx, "projects/p/secrets/db"); got != "pw2" {
+		t.Errorf("after TTL: got %q, want pw2", got)
+	}
+
+	if _, err := c.Get(ctx, "projects/p/secrets/missing"); err == nil {
+		t.Error("missing secret: got nil, want error")
+	}
+	if _, ok := c.entries["projects/p/secrets/missing/versions/latest"]; ok {
+		t.Error("failed secret left in the cache")
+	}
+}
+
+func TestStaleWhileError(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw1"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	ctx := context.Background()
+	const name = "projects/p/secrets/db"
+	if _, err := c.Get(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	f.setFail(true)
+	c.expire(name, time.Minute)
+	if got, err := c.GetString(ctx, name); err != nil || got != "pw1" {
+		t.Errorf("stale: got %q, %v, want pw1", got, err)
+	}
+	c.expire(name, c.MaxStale)
+	if _, err := c.Get(ctx, name); err == nil {
+		t.Error("too stale: got nil, want error")
+	}
+}
+
+func TestRefreshAndOnChange(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw1"}, "key": {"k1"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	var mu sync.Mutex
+	var changes []Change
+	c.OnChange = func(ch Change) {
+		mu.Lock()
+		changes = append(changes, ch)
+		mu.Unlock()
+	}
+	ctx := context.Background()
+	if _, err := c.Get(ctx, "projects/p/secrets/db"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "projects/p/secrets/key/versions/1"); err != nil {
+		t.Fatal(err)
+	}
+	f.addVersion("db", "pw2")
+	f.addVersion("key", "k2")
+	c.refresh(ctx)
+
+	// The refreshed value is served without another access.
+	n := f.numAccesses()
+	if got, _ := c.GetString(ctx, "projects/p/secrets/db"); got != "pw2" {
+		t.Errorf("got %q, want pw2", got)
+	}
+	if f.numAccesses() != n {
+		t.Error("Get after refresh accessed the secret")
+	}
+	want := Change{
+		Name:       "projects/p/secrets/db/versions/latest",
+		OldVersion: "projects/p/secrets/db/versions/1",
+		NewVersion: "projects/p/secrets/db/versions/2",
+	}
+	if len(changes) != 1 || changes[0] != want {
+		t.Errorf("got changes %+v, want [%+v]", changes, want)
+	}
+
+	// Secrets that cannot be refreshed are evicted once too stale.
+	f.setFail(true)
+	c.expire("projects/p/secrets/key/versions/1", c.MaxStale)
+	c.refresh(ctx)
+	if len(c.entries) != 1 {
+		t.Errorf("got %d entries, want 1", len(c.entries))
+	}
+}
+
+func TestGetDuringRefresh(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw1"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	ctx := context.Background()
+	if _, err := c.Get(ctx, "projects/p/secrets/db"); err != nil {
+		t.Fatal(err)
+	}
+	block := make(chan struct{})
+	f.mu.Lock()
+	f.block = block
+	f.mu.Unlock()
+	refreshed := make(chan struct{})
+	go func() {
+		c.refresh(ctx)
+		close(refreshed)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		blocked := f.blocked
+		f.mu.Unlock()
+		if blocked == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh did not access the secret")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The cached payload is served while the refresh waits.
+	got := make(chan string, 1)
+	go func() {
+		s, _ := c.GetString(ctx, "projects/p/secrets/db")
+		got <- s
+	}()
+	select {
+	case s := <-got:
+		if s != "pw1" {
+			t.Errorf("got %q, want pw1", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get blocked by refresh")
+	}
+
+	// A secret invalidated during its refresh stays evicted.
+	e := c.entries["projects/p/secrets/db/versions/latest"]
+	c.Invalidate("projects/p/secrets/db")
+	close(block)
+	<-refreshed
+	if e.data != nil || len(c.entries) != 0 {
+		t.Errorf("got payload %q and %d entries after refresh, want none", e.data, len(c.entries))
+	}
+}
+
+func TestRun(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw1"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	c.RefreshInterval = time.Millisecond
+	changed := make(chan Change, 1)
+	c.OnChange = func(ch Change) { changed <- ch }
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := c.Get(ctx, "projects/p/secrets/db"); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error)
+	go func() { errc <- c.Run(ctx) }()
+	f.addVersion("db", "pw2")
+	select {
+	case ch := <-changed:
+		if ch.NewVersion != "projects/p/secrets/db/versions/2" {
+			t.Errorf("got %+v", ch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notified")
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Run: got %v, want context.Canceled", err)
+	}
+}
+
+func TestRunZeroInterval(t *testing.T) {
+	// A zero RefreshInterval means the default.
+	c := &Cache{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Run(ctx); err != context.Canceled {
+		t.Errorf("Run: got %v, want context.Canceled", err)
+	}
+}
+
+func TestInvalidateAndClose(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw1"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	ctx := context.Background()
+	if _, err := c.Get(ctx, "projects/p/secrets/db"); err != nil {
+		t.Fatal(err)
+	}
+	e := c.entries["projects/p/secrets/db/versions/latest"]
+	data := e.data
+	c.Invalidate("projects/p/secrets/db")
+	if string(data) != "\x00\x00\x00" {
+		t.Errorf("evicted payload not zeroed: %q", data)
+	}
+	if _, err := c.Get(ctx, "projects/p/secrets/db"); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.numAccesses(); n != 2 {
+		t.Errorf("got %d accesses, want 2", n)
+	}
+
+	data = c.entries["projects/p/secrets/db/versions/latest"].data
+	c.Close()
+	if string(data) != "\x00\x00\x00" {
+		t.Errorf("payload not zeroed on Close: %q", data)
+	}
+	if _, err := c.Get(ctx, "projects/p/secrets/db"); err != errClosed {
+		t.Errorf("after Close: got %v, want errClosed", err)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secretcache provides a caching accessor for secrets, using the
+// Secret Manager REST API (google.golang.org/api/secretmanager/v1beta1).
+//
+// A Cache serves secret versions from memory for a TTL, refreshes them in
+// the background when Run is active, and keeps serving a cached value for a
+// while if refreshing it fails. OnChange is called when an alias such as
+// "latest" starts resolving to a new version:
+//
+//	c := secretcache.NewCache(svc)
+//	c.OnChange = func(ch secretcache.Change) {
+//		log.Printf("%s is now %s", ch.Name, ch.NewVersion)
+//	}
+//	go c.Run(ctx)
+//	password, err := c.GetString(ctx, "projects/p/secrets/db-password")
+//
+// Environ and ParseEnv turn secrets into environment-style configuration.
+//
+// This package is experimental and subject to change without notice.
+package secretcache
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secretcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environ returns "NAME=value" strings, as in os.Environ, for the variables
+// in vars, a map from variable names to secret version names. The strings
+// are sorted by variable name, and can be used as exec.Cmd.Env.
+func (c *Cache) Environ(ctx context.Context, vars map[string]string) ([]string, error) {
+	names := make([]string, 0, len(vars))
+	for v := range vars {
+		if v == "" || strings.ContainsAny(v, "=\x00") {
+			return nil, fmt.Errorf("secretcache: bad variable name %q", v)
+		}
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	env := make([]string, 0, len(names))
+	for _, v := range names {
+		value, err := c.GetString(ctx, vars[v])
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, v+"="+value)
+	}
+	return env, nil
+}
+
+// ParseEnv parses a secret payload in the format of a .env file: lines of
+// NAME=value pairs, optionally starting with "export". Blank lines and lines
+// starting with '#' are ignored. Values may be enclosed in single quotes,
+// taken literally, or double quotes, in which \n, \", \\ and other Go
+// escapes are interpreted.
+func ParseEnv(data []byte) (map[string]string, error) {
+	env := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("secretcache: line %d: missing NAME=", n)
+		}
+		name := strings.TrimSpace(line[:i])
+		if strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("secretcache: line %d: bad variable name %q", n, name)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("secretcache: line %d: %s: %v", n, name, err)
+		}
+		env[name] = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("secretcache: %v", err)
+	}
+	return env, nil
+}
+
+// parseEnvValue returns the value v stands for. Its errors do not include v,
+// which is secret.
+func parseEnvValue(v string) (string, error) {
+	if len(v) == 0 {
+		return v, nil
+	}
+	switch v[0] {
+	case '\'':
+		if len(v) < 2 || v[len(v)-1] != '\'' {
+			return "", errors.New("unterminated quote")
+		}
+		return v[1 : len(v)-1], nil
+	case '"':
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return "", errors.New("unterminated quote")
+		}
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", errors.New("bad quoted value")
+		}
+		return s, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secretcache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/internal/testserver"
+	secretmanager "google.golang.org/api/secretmanager/v1beta1"
+)
+
+func TestEnviron(t *testing.T) {
+	f := &fakeSecrets{versions: map[string][]string{"db": {"pw"}, "key": {"k1", "k2"}}}
+	svc, done := testserver.NewService(t, f, secretmanager.NewService)
+	defer done()
+	c := NewCache(svc.(*secretmanager.Service))
+	got, err := c.Environ(context.Background(), map[string]string{
+		"KEY":         "projects/p/secrets/key/versions/1",
+		"DB_PASSWORD": "projects/p/secrets/db",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"DB_PASSWORD=pw", "KEY=k1"}; !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := c.Environ(context.Background(), map[string]string{"A=B": "projects/p/secrets/db"}); err == nil {
+		t.Error("bad variable name: got nil, want error")
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	got, err := ParseEnv([]byte(`
+# Database settings
+DB_HOST=db.internal
+export DB_USER = admin
+DB_PASSWORD='p@ss word'
+GREETING="hello\nworld"
+EMPTY=
+URL=http://x/?a=b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DB_HOST":     "db.internal",
+		"DB_USER":     "admin",
+		"DB_PASSWORD": "p@ss word",
+		"GREETING":    "hello\nworld",
+		"EMPTY":       "",
+		"URL":         "http://x/?a=b",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	for _, bad := range []string{"NOVALUE", "=x", `A="unterminated`, "A='x", "A B=c", `A="bad\q"`} {
+		if _, err := ParseEnv([]byte(bad)); err == nil {
+			t.Errorf("ParseEnv(%q): got nil, want error", bad)
+		}
+	}
+	// Errors do not reveal values.
+	for _, bad := range []string{`A="s3cret`, "A='s3cret", `A="s3cret\q"`} {
+		_, err := ParseEnv([]byte(bad))
+		if err == nil || strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("ParseEnv(%q): got %v, want error without the value", bad, err)
+		}
+	}
+}
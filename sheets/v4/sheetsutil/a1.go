@@ -0,0 +1,478 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sheetsutil provides helpers for working with ranges and values of
+// the Google Sheets API (google.golang.org/api/sheets/v4).
+//
+// Ranges in A1 notation ("Sheet 1!B2:D") and R1C1 notation ("R2C2:R5C4") can
+// be parsed into a Range, converted to and from a sheets.GridRange for use in
+// BatchUpdate requests, and formatted back into a string.
+//
+// Marshal and Unmarshal convert between slices of Go structs and a
+// sheets.ValueRange whose first row is a header naming the columns.
+//
+// This package is experimental and subject to change without notice.
+package sheetsutil
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// A Range is a rectangular region of a sheet.
+//
+// Rows and columns are zero-based, as in sheets.GridRange. Start indexes are
+// inclusive and end indexes are exclusive. An end index of zero means the
+// range is unbounded in that dimension, so the zero Range (with a Sheet)
+// refers to the whole sheet.
+type Range struct {
+	// Sheet is the title of the sheet. It is empty if the range did not name
+	// a sheet, in which case the API uses the first visible sheet.
+	Sheet string
+
+	StartRow    int
+	StartColumn int
+	EndRow      int
+	EndColumn   int
+}
+
+// Cell returns the Range containing only the cell at the given zero-based row
+// and column of sheet.
+func Cell(sheet string, row, col int) Range {
+	return Range{Sheet: sheet, StartRow: row, StartColumn: col, EndRow: row + 1, EndColumn: col + 1}
+}
+
+var errEmptyRange = errors.New("sheetsutil: empty range")
+
+// ParseA1 parses a range in A1 notation, such as "Sheet1!A1:B2",
+// "'My Sheet'!C:C", "Sheet 1!B2:D", "2:5" or "Sheet1".
+//
+// A string without a "!" is treated as a range on the default sheet if it is
+// a valid cell reference, and as a sheet title otherwise.
+func ParseA1(s string) (Range, error) {
+	return parse(s, parseA1Cells)
+}
+
+// ParseR1C1 parses a range in R1C1 notation, such as "Sheet1!R1C1:R2C2",
+// "R2C3", "C2:C4" or "R1:R3".
+//
+// Only absolute references are supported; relative references such as
+// "R[1]C[1]" result in an error.
+func ParseR1C1(s string) (Range, error) {
+	return parse(s, parseR1C1Cells)
+}
+
+func parse(s string, cells func(string) (Range, error)) (Range, error) {
+	if s == "" {
+		return Range{}, errEmptyRange
+	}
+	sheet, ref, hasSheet, err := splitSheet(s)
+	if err != nil {
+		return Range{}, err
+	}
+	if !hasSheet {
+		// A bare string is either a reference on the default sheet or the
+		// title of a sheet.
+		if r, err := cells(s); err == nil {
+			return r, nil
+		}
+		return Range{Sheet: unquoteSheet(s)}, nil
+	}
+	if ref == "" {
+		return Range{}, fmt.Errorf("sheetsutil: missing cell reference after %q", s[:len(s)-1])
+	}
+	r, err := cells(ref)
+	if err != nil {
+		return Range{}, err
+	}
+	r.Sheet = sheet
+	return r, nil
+}
+
+// splitSheet splits s at the "!" separating the sheet title from the cell
+// reference, taking quoted titles into account.
+func splitSheet(s string) (sheet, ref string, ok bool, err error) {
+	if strings.HasPrefix(s, "'") {
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				i++ // escaped quote
+				continue
+			}
+			rest := s[i+1:]
+			if rest == "" {
+				return "", "", false, nil
+			}
+			if rest[0] != '!' {
+				return "", "", false, fmt.Errorf("sheetsutil: unexpected %q after quoted sheet name in %q", rest, s)
+			}
+			return unquoteSheet(s[:i+1]), rest[1:], true, nil
+		}
+		return "", "", false, fmt.Errorf("sheetsutil: unterminated quoted sheet name in %q", s)
+	}
+	i := strings.LastIndex(s, "!")
+	if i < 0 {
+		return "", "", false, nil
+	}
+	return s[:i], s[i+1:], true, nil
+}
+
+func unquoteSheet(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1)
+	}
+	return s
+}
+
+// A cellRef is one endpoint of a range. Either part may be missing, as in
+// "A" or "5".
+type cellRef struct {
+	row, col       int // zero-based
+	hasRow, hasCol bool
+}
+
+// parseA1Cells parses the part of an A1 range after the sheet name.
+func parseA1Cells(s string) (Range, error) {
+	return parseCells(s, parseA1Ref)
+}
+
+func parseR1C1Cells(s string) (Range, error) {
+	return parseCells(s, parseR1C1Ref)
+}
+
+func parseCells(s string, ref func(string) (cellRef, error)) (Range, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 2 {
+		return Range{}, fmt.Errorf("sheetsutil: too many colons in %q", s)
+	}
+	start, err := ref(parts[0])
+	if err != nil {
+		return Range{}, err
+	}
+	if len(parts) == 1 {
+		if !start.hasRow || !start.hasCol {
+			return Range{}, fmt.Errorf("sheetsutil: %q is not a cell reference", s)
+		}
+		return Range{StartRow: start.row, StartColumn: start.col, EndRow: start.row + 1, EndColumn: start.col + 1}, nil
+	}
+	end, err := ref(parts[1])
+	if err != nil {
+		return Range{}, err
+	}
+	var r Range
+	switch {
+	case start.hasRow && start.hasCol:
+		// "B2:D5", "B2:D" and "B2:5".
+		r.StartRow, r.StartColumn = start.row, start.col
+	case start.hasCol && !end.hasRow:
+		// "A:C".
+		r.StartColumn = start.col
+	case start.hasRow && !end.hasCol:
+		// "2:5".
+		r.StartRow = start.row
+	default:
+		return Range{}, fmt.Errorf("sheetsutil: invalid range %q", s)
+	}
+	if end.hasRow {
+		r.EndRow = end.row + 1
+	}
+	if end.hasCol {
+		r.EndColumn = end.col + 1
+	}
+	if (r.EndRow != 0 && r.EndRow <= r.StartRow) || (r.EndColumn != 0 && r.EndColumn <= r.StartColumn) {
+		return Range{}, fmt.Errorf("sheetsutil: range %q ends before it starts", s)
+	}
+	return r, nil
+}
+
+// maxColumnLetters is the length of the name of the last column a sheet may
+// have ("ZZZ"). Longer names are sheet titles, not cell references.
+const maxColumnLetters = 3
+
+// parseA1Ref parses a reference such as "B2", "$B$2", "B" or "2".
+func parseA1Ref(s string) (cellRef, error) {
+	var c cellRef
+	s = strings.TrimPrefix(s, "$")
+	i := 0
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	if i > maxColumnLetters {
+		return cellRef{}, fmt.Errorf("sheetsutil: invalid cell reference %q", s)
+	}
+	if i > 0 {
+		col, err := ColumnIndex(s[:i])
+		if err != nil {
+			return cellRef{}, err
+		}
+		c.col, c.hasCol = col, true
+	}
+	rest := strings.TrimPrefix(s[i:], "$")
+	if rest != "" {
+		row, err := strconv.Atoi(rest)
+		if err != nil || row < 1 || rest[0] == '+' {
+			return cellRef{}, fmt.Errorf("sheetsutil: invalid cell reference %q", s)
+		}
+		c.row, c.hasRow = row-1, true
+	}
+	if !c.hasRow && !c.hasCol {
+		return cellRef{}, fmt.Errorf("sheetsutil: invalid cell reference %q", s)
+	}
+	return c, nil
+}
+
+// parseR1C1Ref parses a reference such as "R2C3", "R2" or "C3".
+func parseR1C1Ref(s string) (cellRef, error) {
+	var c cellRef
+	rest := strings.ToUpper(s)
+	if strings.HasPrefix(rest, "R") {
+		n, tail, err := leadingNumber(rest[1:])
+		if err != nil {
+			return cellRef{}, fmt.Errorf("sheetsutil: invalid R1C1 reference %q", s)
+		}
+		c.row, c.hasRow = n-1, true
+		rest = tail
+	}
+	if strings.HasPrefix(rest, "C") {
+		n, tail, err := leadingNumber(rest[1:])
+		if err != nil {
+			return cellRef{}, fmt.Errorf("sheetsutil: invalid R1C1 reference %q", s)
+		}
+		c.col, c.hasCol = n-1, true
+		rest = tail
+	}
+	if rest != "" || (!c.hasRow && !c.hasCol) {
+		return cellRef{}, fmt.Errorf("sheetsutil: invalid R1C1 reference %q", s)
+	}
+	return c, nil
+}
+
+// leadingNumber parses the positive decimal number at the start of s.
+func leadingNumber(s string) (n int, rest string, err error) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, err = strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, "", err
+	}
+	if n < 1 {
+		return 0, "", errors.New("index must be positive")
+	}
+	return n, s[i:], nil
+}
+
+func isLetter(b byte) bool {
+	return ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z')
+}
+
+// ColumnIndex returns the zero-based index of the column with the given
+// letters, so that "A" is 0, "Z" is 25 and "AA" is 26.
+func ColumnIndex(letters string) (int, error) {
+	if letters == "" {
+		return 0, errors.New("sheetsutil: empty column name")
+	}
+	n := 0
+	for i := 0; i < len(letters); i++ {
+		b := letters[i]
+		if !isLetter(b) {
+			return 0, fmt.Errorf("sheetsutil: invalid column name %q", letters)
+		}
+		if b >= 'a' {
+			b -= 'a' - 'A'
+		}
+		n = n*26 + int(b-'A') + 1
+	}
+	return n - 1, nil
+}
+
+// ColumnName returns the letters naming the column with the given zero-based
+// index. It is the inverse of ColumnIndex.
+func ColumnName(index int) string {
+	var buf []byte
+	for n := index + 1; n > 0; n = (n - 1) / 26 {
+		buf = append(buf, byte('A'+(n-1)%26))
+	}
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
+
+// String returns r in A1 notation. It is equivalent to r.A1().
+func (r Range) String() string {
+	return r.A1()
+}
+
+// A1 returns r in A1 notation, quoting the sheet title if necessary.
+//
+// A1 notation cannot express a range that is unbounded in both dimensions
+// but does not start at A1. For such a range only the sheet is returned.
+func (r Range) A1() string {
+	cells := r.cellsA1()
+	if r.Sheet == "" {
+		return cells
+	}
+	if cells == "" {
+		return QuoteSheet(r.Sheet)
+	}
+	return QuoteSheet(r.Sheet) + "!" + cells
+}
+
+func (r Range) cellsA1() string {
+	row := func(i int) string { return strconv.Itoa(i + 1) }
+	switch {
+	case r.EndRow == 0 && r.EndColumn == 0:
+		return ""
+	case r.EndRow == r.StartRow+1 && r.EndColumn == r.StartColumn+1:
+		return ColumnName(r.StartColumn) + row(r.StartRow)
+	case r.EndRow != 0 && r.EndColumn != 0:
+		return ColumnName(r.StartColumn) + row(r.StartRow) + ":" + ColumnName(r.EndColumn-1) + row(r.EndRow-1)
+	case r.EndColumn != 0:
+		// Rows are unbounded.
+		if r.StartRow == 0 {
+			return ColumnName(r.StartColumn) + ":" + ColumnName(r.EndColumn-1)
+		}
+		return ColumnName(r.StartColumn) + row(r.StartRow) + ":" + ColumnName(r.EndColumn-1)
+	default:
+		// Columns are unbounded.
+		if r.StartColumn == 0 {
+			return row(r.StartRow) + ":" + row(r.EndRow-1)
+		}
+		return ColumnName(r.StartColumn) + row(r.StartRow) + ":" + row(r.EndRow-1)
+	}
+}
+
+// R1C1 returns r in R1C1 notation, quoting the sheet title if necessary.
+func (r Range) R1C1() string {
+	ref := func(row, col int, hasRow, hasCol bool) string {
+		var s string
+		if hasRow {
+			s += "R" + strconv.Itoa(row+1)
+		}
+		if hasCol {
+			s += "C" + strconv.Itoa(col+1)
+		}
+		return s
+	}
+	var cells string
+	switch {
+	case r.EndRow == 0 && r.EndColumn == 0:
+	case r.EndRow == r.StartRow+1 && r.EndColumn == r.StartColumn+1:
+		cells = ref(r.StartRow, r.StartColumn, true, true)
+	default:
+		hasRow, hasCol := r.EndRow != 0, r.EndColumn != 0
+		cells = ref(r.StartRow, r.StartColumn, hasRow || r.StartRow != 0, hasCol || r.StartColumn != 0) +
+			":" + ref(r.EndRow-1, r.EndColumn-1, hasRow, hasCol)
+	}
+	switch {
+	case r.Sheet == "":
+		return cells
+	case cells == "":
+		return QuoteSheet(r.Sheet)
+	default:
+		return QuoteSheet(r.Sheet) + "!" + cells
+	}
+}
+
+// QuoteSheet returns the sheet title quoted for use in a range, if quoting is
+// needed. Titles are quoted unless they consist only of letters, digits and
+// underscores, start with a letter or underscore, and could not be mistaken
+// for a cell reference.
+func QuoteSheet(title string) string {
+	if !needsQuote(title) {
+		return title
+	}
+	return "'" + strings.Replace(title, "'", "''", -1) + "'"
+}
+
+func needsQuote(title string) bool {
+	if title == "" {
+		return true
+	}
+	for i := 0; i < len(title); i++ {
+		b := title[i]
+		switch {
+		case isLetter(b), b == '_':
+		case b >= '0' && b <= '9':
+			if i == 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	if _, err := parseA1Cells(title); err == nil {
+		return true
+	}
+	if _, err := parseR1C1Cells(title); err == nil {
+		return true
+	}
+	return false
+}
+
+// GridRange returns r as a sheets.GridRange on the sheet with the given ID,
+// for use in BatchUpdate requests. The sheet title of r is ignored; use
+// SheetID to look it up.
+func (r Range) GridRange(sheetID int64) *sheets.GridRange {
+	g := &sheets.GridRange{
+		SheetId:          sheetID,
+		StartRowIndex:    int64(r.StartRow),
+		StartColumnIndex: int64(r.StartColumn),
+		EndRowIndex:      int64(r.EndRow),
+		EndColumnIndex:   int64(r.EndColumn),
+	}
+	if sheetID == 0 {
+		// The first sheet of a spreadsheet usually has ID 0, which would
+		// otherwise be omitted.
+		g.ForceSendFields = []string{"SheetId"}
+	}
+	return g
+}
+
+// FromGridRange returns the Range covering g on the sheet with the given
+// title.
+func FromGridRange(sheet string, g *sheets.GridRange) Range {
+	return Range{
+		Sheet:       sheet,
+		StartRow:    int(g.StartRowIndex),
+		StartColumn: int(g.StartColumnIndex),
+		EndRow:      int(g.EndRowIndex),
+		EndColumn:   int(g.EndColumnIndex),
+	}
+}
+
+// SheetID returns the ID of the sheet with the given title in ss. If title is
+// empty, it returns the ID of the first sheet.
+func SheetID(ss *sheets.Spreadsheet, title string) (int64, error) {
+	for _, sh := range ss.Sheets {
+		if sh.Properties == nil {
+			continue
+		}
+		if title == "" || sh.Properties.Title == title {
+			return sh.Properties.SheetId, nil
+		}
+	}
+	if title == "" {
+		return 0, errors.New("sheetsutil: spreadsheet has no sheets")
+	}
+	return 0, fmt.Errorf("sheetsutil: no sheet titled %q", title)
+}
+
+// SheetTitle returns the title of the sheet with the given ID in ss.
+func SheetTitle(ss *sheets.Spreadsheet, sheetID int64) (string, error) {
+	for _, sh := range ss.Sheets {
+		if sh.Properties != nil && sh.Properties.SheetId == sheetID {
+			return sh.Properties.Title, nil
+		}
+	}
+	return "", fmt.Errorf("sheetsutil: no sheet with ID %d", sheetID)
+}
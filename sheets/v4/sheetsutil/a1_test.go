@@ -0,0 +1,170 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sheetsutil
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+func TestParseA1(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Range
+		out  string // formatted result, if different from in
+	}{
+		{"A1", Range{EndRow: 1, EndColumn: 1}, ""},
+		{"Sheet1!A1:B2", Range{Sheet: "Sheet1", EndRow: 2, EndColumn: 2}, ""},
+		{"Sheet 1!B2:D", Range{Sheet: "Sheet 1", StartRow: 1, StartColumn: 1, EndColumn: 4}, "'Sheet 1'!B2:D"},
+		{"'My ''Big'' Sheet'!C:C", Range{Sheet: "My 'Big' Sheet", StartColumn: 2, EndColumn: 3}, ""},
+		{"'A1'!A1", Range{Sheet: "A1", EndRow: 1, EndColumn: 1}, ""},
+		{"2:5", Range{StartRow: 1, EndRow: 5}, ""},
+		{"B2:5", Range{StartRow: 1, StartColumn: 1, EndRow: 5}, ""},
+		{"$A$1:$AA$10", Range{EndRow: 10, EndColumn: 27}, "A1:AA10"},
+		{"a1:b2", Range{EndRow: 2, EndColumn: 2}, "A1:B2"},
+		{"Sheet1", Range{Sheet: "Sheet1"}, ""},
+		{"'Q1 Sales'", Range{Sheet: "Q1 Sales"}, ""},
+		{"Data!ZZZ1", Range{Sheet: "Data", StartColumn: 18277, EndRow: 1, EndColumn: 18278}, ""},
+	} {
+		got, err := ParseA1(test.in)
+		if err != nil {
+			t.Errorf("ParseA1(%q): %v", test.in, err)
+			continue
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("ParseA1(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+		want := test.out
+		if want == "" {
+			want = test.in
+		}
+		if s := got.A1(); s != want {
+			t.Errorf("ParseA1(%q).A1() = %q, want %q", test.in, s, want)
+		}
+	}
+}
+
+func TestParseA1Errors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"Sheet1!",
+		"'Sheet1",
+		"'Sheet1'A1",
+		"Sheet1!A1:B2:C3",
+		"Sheet1!B2:A1",
+		"Sheet1!A0",
+		"Sheet1!AAAA1",
+		"Sheet1!A:5",
+	} {
+		if got, err := ParseA1(in); err == nil {
+			t.Errorf("ParseA1(%q) = %+v, want error", in, got)
+		}
+	}
+}
+
+func TestParseR1C1(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Range
+	}{
+		{"R1C1", Range{EndRow: 1, EndColumn: 1}},
+		{"Sheet1!R1C1:R2C3", Range{Sheet: "Sheet1", EndRow: 2, EndColumn: 3}},
+		{"'My Sheet'!C2:C4", Range{Sheet: "My Sheet", StartColumn: 1, EndColumn: 4}},
+		{"R2:R5", Range{StartRow: 1, EndRow: 5}},
+		{"R2C2:C4", Range{StartRow: 1, StartColumn: 1, EndColumn: 4}},
+	} {
+		got, err := ParseR1C1(test.in)
+		if err != nil {
+			t.Errorf("ParseR1C1(%q): %v", test.in, err)
+			continue
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("ParseR1C1(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+		if s := got.R1C1(); s != test.in {
+			t.Errorf("ParseR1C1(%q).R1C1() = %q", test.in, s)
+		}
+	}
+	if _, err := ParseR1C1("Sheet1!R[1]C[1]"); err == nil {
+		t.Error("relative reference: got nil, want error")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		index int
+	}{
+		{"A", 0}, {"Z", 25}, {"AA", 26}, {"AZ", 51}, {"BA", 52}, {"ZZ", 701}, {"AAA", 702},
+	} {
+		if got := ColumnName(test.index); got != test.name {
+			t.Errorf("ColumnName(%d) = %q, want %q", test.index, got, test.name)
+		}
+		got, err := ColumnIndex(test.name)
+		if err != nil || got != test.index {
+			t.Errorf("ColumnIndex(%q) = %d, %v, want %d", test.name, got, err, test.index)
+		}
+	}
+}
+
+func TestQuoteSheet(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"Sheet1", "Sheet1"},
+		{"_data", "_data"},
+		{"Sheet 1", "'Sheet 1'"},
+		{"1st", "'1st'"},
+		{"B12", "'B12'"},
+		{"R1C1", "'R1C1'"},
+		{"Bob's", "'Bob''s'"},
+		{"", "''"},
+	} {
+		if got := QuoteSheet(test.in); got != test.want {
+			t.Errorf("QuoteSheet(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestGridRange(t *testing.T) {
+	ss := &sheets.Spreadsheet{
+		Sheets: []*sheets.Sheet{
+			{Properties: &sheets.SheetProperties{SheetId: 0, Title: "Summary"}},
+			{Properties: &sheets.SheetProperties{SheetId: 42, Title: "Data"}},
+		},
+	}
+	r, err := ParseA1("Data!B2:D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := SheetID(ss, r.Sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.GridRange(id)
+	want := &sheets.GridRange{SheetId: 42, StartRowIndex: 1, StartColumnIndex: 1, EndColumnIndex: 4}
+	if !cmp.Equal(got, want) {
+		t.Errorf("GridRange: got %+v, want %+v", got, want)
+	}
+	title, err := SheetTitle(ss, got.SheetId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back := FromGridRange(title, got); back != r {
+		t.Errorf("FromGridRange: got %+v, want %+v", back, r)
+	}
+
+	if id, err := SheetID(ss, ""); err != nil || id != 0 {
+		t.Errorf(`SheetID(ss, "") = %d, %v, want 0`, id, err)
+	}
+	if g := Cell("Summary", 0, 0).GridRange(0); len(g.ForceSendFields) != 1 {
+		t.Errorf("sheet ID 0 not forced: %+v", g)
+	}
+	if _, err := SheetID(ss, "Missing"); err == nil {
+		t.Error("SheetID of missing sheet: got nil, want error")
+	}
+}
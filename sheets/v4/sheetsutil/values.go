@@ -0,0 +1,461 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sheetsutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// Marshal returns a ValueRange holding the elements of v, which must be a
+// slice of structs or of pointers to structs. The first row of the result is
+// a header with one column per field, followed by one row per element.
+//
+// The column name of a field is its name, or the name given in a "sheets"
+// struct tag:
+//
+//	type Employee struct {
+//		Name    string    `sheets:"Full Name"`
+//		Started time.Time `sheets:"Start Date"`
+//		Manager *string   `sheets:",omitempty"`
+//		Secret  string    `sheets:"-"`
+//	}
+//
+// Fields tagged "-" and unexported fields are skipped. Strings, booleans,
+// integers, floating-point numbers and pointers to them are written as
+// themselves; a nil pointer is written as an empty cell, as is the zero value
+// of a field with the "omitempty" option. A time.Time is written as a
+// spreadsheet serial number (see TimeToSerial), which the cell's number
+// format displays as a date. Other types are written as given and must
+// marshal to a JSON value the API accepts.
+//
+// The Range of the result is empty. Set it before writing the values with
+// Spreadsheets.Values.Update or Append.
+func Marshal(v interface{}) (*sheets.ValueRange, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("sheetsutil: Marshal of non-slice type %T", v)
+	}
+	st, err := elemStruct(rv.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	fields := cachedFields(st)
+	header := make([]interface{}, len(fields))
+	for i, f := range fields {
+		header[i] = f.name
+	}
+	values := [][]interface{}{header}
+	for i := 0; i < rv.Len(); i++ {
+		ev := reflect.Indirect(rv.Index(i))
+		row := make([]interface{}, len(fields))
+		for j, f := range fields {
+			if !ev.IsValid() {
+				row[j] = ""
+				continue
+			}
+			row[j] = marshalCell(ev.Field(f.index), f.omitEmpty)
+		}
+		values = append(values, row)
+	}
+	return &sheets.ValueRange{MajorDimension: "ROWS", Values: values}, nil
+}
+
+func marshalCell(v reflect.Value, omitEmpty bool) interface{} {
+	if omitEmpty && isEmptyValue(v) {
+		return ""
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return TimeToSerial(t)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	return false
+}
+
+// Unmarshal stores the rows of vr in v, which must be a pointer to a slice of
+// structs or of pointers to structs. The first row of vr is a header naming
+// the columns, which are matched to struct fields as described for Marshal;
+// if no field name matches exactly, a case-insensitive match is used.
+// Columns without a matching field, and fields without a matching column, are
+// ignored. If vr.MajorDimension is "COLUMNS", the values are transposed first.
+//
+// Unmarshal accepts values read with any ValueRenderOption. With
+// UNFORMATTED_VALUE numbers and booleans arrive as such, and are converted to
+// the type of the field. With FORMATTED_VALUE every cell is a string, which
+// is parsed according to the type of the field; thousands separators and
+// percent signs are not understood, so numeric columns should be read
+// unformatted. Empty cells leave fields at their zero value.
+//
+// Dates and times are stored in time.Time fields. A numeric cell is treated
+// as a serial number (DateTimeRenderOption SERIAL_NUMBER, the default) and
+// converted with SerialToTime. A string cell (FORMATTED_STRING) is parsed
+// with the first of these layouts that matches: time.RFC3339,
+// "2006-01-02 15:04:05", "2006-01-02", "1/2/2006 15:04:05" and "1/2/2006".
+func Unmarshal(vr *sheets.ValueRange, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("sheetsutil: Unmarshal needs a non-nil pointer to a slice, got %T", v)
+	}
+	slice := rv.Elem()
+	et := slice.Type().Elem()
+	st, err := elemStruct(et)
+	if err != nil {
+		return err
+	}
+	values := vr.Values
+	if vr.MajorDimension == "COLUMNS" {
+		values = transpose(values)
+	}
+	if len(values) == 0 {
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+		return nil
+	}
+	fields := cachedFields(st)
+	// columns[i] is the index into fields for column i, or -1.
+	columns := make([]int, len(values[0]))
+	for i, h := range values[0] {
+		columns[i] = fieldByName(fields, fmt.Sprint(h))
+	}
+	out := reflect.MakeSlice(slice.Type(), 0, len(values)-1)
+	for r, row := range values[1:] {
+		ev := reflect.New(st).Elem()
+		for c, cell := range row {
+			if c >= len(columns) || columns[c] < 0 {
+				continue
+			}
+			f := fields[columns[c]]
+			if err := unmarshalCell(ev.Field(f.index), cell); err != nil {
+				// Rows are numbered from 1, and the header is row 1.
+				return fmt.Errorf("sheetsutil: row %d, column %q: %v", r+2, f.name, err)
+			}
+		}
+		if et.Kind() == reflect.Ptr {
+			ev = ev.Addr()
+		}
+		out = reflect.Append(out, ev)
+	}
+	slice.Set(out)
+	return nil
+}
+
+func transpose(values [][]interface{}) [][]interface{} {
+	n := 0
+	for _, col := range values {
+		if len(col) > n {
+			n = len(col)
+		}
+	}
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = make([]interface{}, len(values))
+		for j, col := range values {
+			if i < len(col) {
+				rows[i][j] = col[i]
+			} else {
+				rows[i][j] = ""
+			}
+		}
+	}
+	return rows
+}
+
+func unmarshalCell(v reflect.Value, cell interface{}) error {
+	if s, ok := cell.(string); cell == nil || (ok && s == "") {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := unmarshalCell(p.Elem(), cell); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if v.Type() == timeType {
+		t, err := cellTime(cell)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		switch c := cell.(type) {
+		case string:
+			v.SetString(c)
+		case float64:
+			v.SetString(strconv.FormatFloat(c, 'f', -1, 64))
+		default:
+			v.SetString(fmt.Sprint(c))
+		}
+		return nil
+	case reflect.Bool:
+		switch c := cell.(type) {
+		case bool:
+			v.SetBool(c)
+			return nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(c))
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, err := cellFloat(cell)
+		if err != nil {
+			return err
+		}
+		if f != math.Trunc(f) || v.OverflowInt(int64(f)) {
+			return fmt.Errorf("cannot store %v in %v", cell, v.Type())
+		}
+		v.SetInt(int64(f))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, err := cellFloat(cell)
+		if err != nil {
+			return err
+		}
+		if f < 0 || f != math.Trunc(f) || v.OverflowUint(uint64(f)) {
+			return fmt.Errorf("cannot store %v in %v", cell, v.Type())
+		}
+		v.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := cellFloat(cell)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf(cell))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot store %T in %v", cell, v.Type())
+}
+
+func cellFloat(cell interface{}) (float64, error) {
+	switch c := cell.(type) {
+	case float64:
+		return c, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(c), 64)
+	case bool:
+		if c {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	// Values produced by Marshal rather than decoded from JSON.
+	switch v := reflect.ValueOf(cell); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("unexpected cell value %v", cell)
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"1/2/2006 15:04:05",
+	"1/2/2006",
+}
+
+func cellTime(cell interface{}) (time.Time, error) {
+	switch c := cell.(type) {
+	case float64:
+		return SerialToTime(c), nil
+	case string:
+		s := strings.TrimSpace(c)
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a date", c)
+	}
+	return time.Time{}, fmt.Errorf("unexpected cell value %v for a date", cell)
+}
+
+// serialEpoch is day zero of spreadsheet serial numbers.
+var serialEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// SerialToTime converts a spreadsheet serial number, the number of days since
+// December 30, 1899 with the time of day as a fraction, into a time in UTC.
+// Serial numbers carry no time zone; use time.Date to reinterpret the result
+// in the spreadsheet's zone if needed. The result is rounded to the
+// millisecond.
+func SerialToTime(serial float64) time.Time {
+	days := math.Floor(serial)
+	ms := math.Round((serial - days) * 24 * 60 * 60 * 1000)
+	return serialEpoch.AddDate(0, 0, int(days)).Add(time.Duration(ms) * time.Millisecond)
+}
+
+// TimeToSerial converts t into a spreadsheet serial number, using the date
+// and time of day of t in its own location.
+func TimeToSerial(t time.Time) float64 {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	days := math.Round(day.Sub(serialEpoch).Hours() / 24)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+	return days + sinceMidnight.Seconds()/(24*60*60)
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+
+	fieldCache sync.Map // map[reflect.Type][]field
+)
+
+// A field is a struct field mapped to a column.
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func elemStruct(t reflect.Type) (reflect.Type, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil, fmt.Errorf("sheetsutil: element type %v is not a struct", t)
+	}
+	return t, nil
+}
+
+func cachedFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	fs, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return fs.([]field)
+}
+
+func typeFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		tag := sf.Tag.Get("sheets")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := field{name: name, index: i}
+		for _, o := range strings.Split(opts, ",") {
+			if o == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func fieldByName(fields []field, name string) int {
+	name = strings.TrimSpace(name)
+	for i, f := range fields {
+		if f.name == name {
+			return i
+		}
+	}
+	for i, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// errNoHeader is returned by Header when the ValueRange has no rows.
+var errNoHeader = errors.New("sheetsutil: value range has no header row")
+
+// Header returns the column names in the header row of vr.
+func Header(vr *sheets.ValueRange) ([]string, error) {
+	values := vr.Values
+	if vr.MajorDimension == "COLUMNS" {
+		values = transpose(values)
+	}
+	if len(values) == 0 {
+		return nil, errNoHeader
+	}
+	h := make([]string, len(values[0]))
+	for i, v := range values[0] {
+		h[i] = fmt.Sprint(v)
+	}
+	return h, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sheetsutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+type employee struct {
+	Name    string    `sheets:"Full Name"`
+	Age     int       `sheets:"age"`
+	Salary  float64   `sheets:",omitempty"`
+	Active  bool      `sheets:"Active"`
+	Started time.Time `sheets:"Start Date"`
+	Manager *string
+	Secret  string `sheets:"-"`
+	note    string
+}
+
+func TestMarshal(t *testing.T) {
+	boss := "Ada"
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	got, err := Marshal([]*employee{
+		{Name: "Grace", Age: 40, Salary: 100.5, Active: true, Started: start, Manager: &boss, Secret: "x"},
+		{Name: "Alan", Age: 41},
+		nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &sheets.ValueRange{
+		MajorDimension: "ROWS",
+		Values: [][]interface{}{
+			{"Full Name", "age", "Salary", "Active", "Start Date", "Manager"},
+			{"Grace", int64(40), 100.5, true, 43831.5, "Ada"},
+			{"Alan", int64(41), "", false, "", ""},
+			{"", "", "", "", "", ""},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Marshal: -got +want\n%s", diff)
+	}
+
+	if _, err := Marshal(employee{}); err == nil {
+		t.Error("Marshal of non-slice: got nil, want error")
+	}
+	if _, err := Marshal([]int{1}); err == nil {
+		t.Error("Marshal of []int: got nil, want error")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	boss := "Ada"
+	for _, test := range []struct {
+		desc string
+		vr   *sheets.ValueRange
+	}{
+		{
+			"unformatted",
+			&sheets.ValueRange{Values: [][]interface{}{
+				{"Full Name", "AGE", "Salary", "Active", "Start Date", "Manager", "Unknown"},
+				{"Grace", 40.0, 100.5, true, 43831.5, "Ada", "ignored"},
+				{"Alan", 41.0},
+			}},
+		},
+		{
+			"formatted",
+			&sheets.ValueRange{Values: [][]interface{}{
+				{"Full Name", "age", "Salary", "Active", "Start Date", "Manager"},
+				{"Grace", "40", "100.5", "TRUE", "2020-01-01 12:00:00", "Ada"},
+				{"Alan", "41", "", "", "", ""},
+			}},
+		},
+		{
+			"columns",
+			&sheets.ValueRange{MajorDimension: "COLUMNS", Values: [][]interface{}{
+				{"Full Name", "Grace", "Alan"},
+				{"age", 40.0, 41.0},
+				{"Salary", 100.5},
+				{"Active", true, false},
+				{"Start Date", 43831.5},
+				{"Manager", "Ada"},
+			}},
+		},
+	} {
+		var got []employee
+		if err := Unmarshal(test.vr, &got); err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+			continue
+		}
+		want := []employee{
+			{Name: "Grace", Age: 40, Salary: 100.5, Active: true, Started: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), Manager: &boss},
+			{Name: "Alan", Age: 41},
+		}
+		if diff := cmp.Diff(got, want, cmp.AllowUnexported(employee{})); diff != "" {
+			t.Errorf("%s: -got +want\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var es []employee
+	for _, vr := range []*sheets.ValueRange{
+		{Values: [][]interface{}{{"age"}, {"forty"}}},
+		{Values: [][]interface{}{{"age"}, {40.5}}},
+		{Values: [][]interface{}{{"Start Date"}, {"yesterday"}}},
+		{Values: [][]interface{}{{"Active"}, {"maybe"}}},
+	} {
+		if err := Unmarshal(vr, &es); err == nil {
+			t.Errorf("Unmarshal(%v): got nil, want error", vr.Values)
+		}
+	}
+	if err := Unmarshal(&sheets.ValueRange{}, es); err == nil {
+		t.Error("Unmarshal into non-pointer: got nil, want error")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type row struct {
+		ID    uint16
+		Score float32
+		Note  interface{}
+	}
+	in := []row{{1, 0.5, "a"}, {2, 1.25, true}}
+	vr, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []row
+	if err := Unmarshal(vr, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(out, in); diff != "" {
+		t.Errorf("-got +want\n%s", diff)
+	}
+}
+
+func TestSerial(t *testing.T) {
+	for _, test := range []struct {
+		serial float64
+		t      time.Time
+	}{
+		{0, time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)},
+		{1, time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{43831.75, time.Date(2020, 1, 1, 18, 0, 0, 0, time.UTC)},
+		{-1.5, time.Date(1899, 12, 28, 12, 0, 0, 0, time.UTC)},
+	} {
+		if got := SerialToTime(test.serial); !got.Equal(test.t) {
+			t.Errorf("SerialToTime(%v) = %v, want %v", test.serial, got, test.t)
+		}
+		if test.serial >= 0 {
+			if got := TimeToSerial(test.t); got != test.serial {
+				t.Errorf("TimeToSerial(%v) = %v, want %v", test.t, got, test.serial)
+			}
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	got, err := Header(&sheets.ValueRange{Values: [][]interface{}{{"a", "b"}, {1.0, 2.0}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := Header(&sheets.ValueRange{}); err == nil {
+		t.Error("got nil, want error")
+	}
+}
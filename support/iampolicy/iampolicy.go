@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package iampolicy edits the IAM policies of resources of any API with
+// read-modify-write cycles.
+//
+// Changing a policy means reading it with GetIamPolicy, editing its
+// bindings, and writing it back with SetIamPolicy, which fails if the
+// policy was changed since it was read, as told by its etag. Modify runs
+// that cycle, and repeats it after such conflicts. AddMember, RemoveMember
+// and SetCondition are the most common edits.
+//
+// Every API has its own Policy type, so the package works on a Resource,
+// which is usually made with NewResource from two functions calling the
+// API:
+//
+//	r := iampolicy.NewResource(
+//		func(ctx context.Context, version int64) (interface{}, error) {
+//			return svc.Projects.Topics.GetIamPolicy(topic).
+//				OptionsRequestedPolicyVersion(version).Context(ctx).Do()
+//		},
+//		func(ctx context.Context, p interface{}) (interface{}, error) {
+//			req := &pubsub.SetIamPolicyRequest{Policy: p.(*pubsub.Policy)}
+//			return svc.Projects.Topics.SetIamPolicy(topic, req).Context(ctx).Do()
+//		})
+//	err := iampolicy.AddMember(ctx, r, "roles/pubsub.publisher", "user:alice@example.com")
+//
+// Policies are always read with version 3, so conditional bindings are
+// seen, and written with version 3 if they have conditional bindings.
+//
+// This package is experimental and subject to change without notice.
+package iampolicy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// A Resource gets and sets the IAM policy of one resource.
+type Resource interface {
+	// GetPolicy returns the policy of the resource, in the format of
+	// requestedVersion or lower.
+	GetPolicy(ctx context.Context, requestedVersion int64) (*Policy, error)
+
+	// SetPolicy replaces the policy of the resource with p, if its etag is
+	// that of the current policy, and returns the new policy.
+	SetPolicy(ctx context.Context, p *Policy) (*Policy, error)
+}
+
+// NewResource returns a Resource that gets and sets a policy with the
+// Policy type of an API. get returns a pointer to the API's Policy, such
+// as a *pubsub.Policy, and set is passed a pointer of the same type and
+// returns the new policy. SetPolicy fails if GetPolicy was never called.
+func NewResource(
+	get func(ctx context.Context, requestedVersion int64) (interface{}, error),
+	set func(ctx context.Context, policy interface{}) (interface{}, error),
+) Resource {
+	return &funcResource{get: get, set: set}
+}
+
+type funcResource struct {
+	get func(context.Context, int64) (interface{}, error)
+	set func(context.Context, interface{}) (interface{}, error)
+
+	mu  sync.Mutex
+	typ reflect.Type // the API's Policy type, once known
+}
+
+func (r *funcResource) GetPolicy(ctx context.Context, requestedVersion int64) (*Policy, error) {
+	v, err := r.get(ctx, requestedVersion)
+	if err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || reflect.ValueOf(v).IsNil() {
+		return nil, errors.New("iampolicy: get did not return a policy")
+	}
+	r.mu.Lock()
+	r.typ = t.Elem()
+	r.mu.Unlock()
+	return FromAPI(v)
+}
+
+func (r *funcResource) SetPolicy(ctx context.Context, p *Policy) (*Policy, error) {
+	r.mu.Lock()
+	t := r.typ
+	r.mu.Unlock()
+	if t == nil {
+		return nil, errors.New("iampolicy: policy type unknown before GetPolicy")
+	}
+	v := reflect.New(t).Interface()
+	if err := p.ToAPI(v); err != nil {
+		return nil, err
+	}
+	nv, err := r.set(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	return FromAPI(nv)
+}
+
+// maxAttempts is the number of read-modify-write cycles Modify makes
+// before it gives up on conflicts.
+const maxAttempts = 10
+
+// newBackoff returns the backoff between read-modify-write cycles.
+// Tests replace it.
+var newBackoff = func() gax.Backoff {
+	return gax.Backoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second, Multiplier: 2}
+}
+
+// Modify reads the policy of r, passes it to edit, and writes it back,
+// unless edit left its version and bindings as they were. If the write
+// fails with a conflict, because the policy was changed in between, the
+// cycle is repeated with the new policy, so edit may be called several
+// times and must not depend on earlier calls. Modify returns the policy
+// as it is after the edit, or the error returned by edit.
+func Modify(ctx context.Context, r Resource, edit func(*Policy) error) (*Policy, error) {
+	bo := newBackoff()
+	for attempt := 1; ; attempt++ {
+		p, err := r.GetPolicy(ctx, ConditionalVersion)
+		if err != nil {
+			return nil, err
+		}
+		orig := p.clone()
+		if err := edit(p); err != nil {
+			return nil, err
+		}
+		if p.hasConditions() {
+			p.Version = ConditionalVersion
+		}
+		if p.equal(orig) {
+			return p, nil
+		}
+		// The etag of the policy read is what makes the write safe.
+		p.Etag = orig.Etag
+		np, err := r.SetPolicy(ctx, p)
+		if err == nil {
+			return np, nil
+		}
+		if !isConflict(err) || attempt == maxAttempts {
+			return nil, err
+		}
+		if err := gax.Sleep(ctx, bo.Pause()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isConflict reports whether err means that the policy was changed since
+// it was read. Most APIs return 409 Conflict, and some 412 Precondition
+// Failed.
+func isConflict(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	return e.Code == http.StatusConflict || e.Code == http.StatusPreconditionFailed
+}
+
+// AddMember grants role to member unconditionally on the resource r.
+func AddMember(ctx context.Context, r Resource, role, member string) error {
+	_, err := Modify(ctx, r, func(p *Policy) error {
+		p.AddMember(role, member, nil)
+		return nil
+	})
+	return err
+}
+
+// RemoveMember removes the unconditional grant of role to member on the
+// resource r. Grants under conditions are left as they are.
+func RemoveMember(ctx context.Context, r Resource, role, member string) error {
+	_, err := Modify(ctx, r, func(p *Policy) error {
+		p.RemoveMember(role, member, nil)
+		return nil
+	})
+	return err
+}
+
+// SetCondition grants role to member on the resource r under the condition
+// cond only, replacing any other grant of role to member. A nil cond makes
+// the grant unconditional.
+func SetCondition(ctx context.Context, r Resource, role, member string, cond *Condition) error {
+	_, err := Modify(ctx, r, func(p *Policy) error {
+		p.SetCondition(role, member, cond)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iampolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/internal/testserver"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const testTopic = "projects/p/topics/t"
+
+func init() {
+	newBackoff = func() gax.Backoff { return gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond} }
+}
+
+// fakeIAM serves getIamPolicy and setIamPolicy for testTopic, checking
+// etags like the real service.
+type fakeIAM struct {
+	mu        sync.Mutex
+	policy    pubsub.Policy
+	gen       int
+	versions  []int64 // requested versions
+	sets      int
+	conflicts int // number of sets to fail as if the policy changed
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policy.Etag = strconv.Itoa(f.gen)
+	switch r.URL.Path {
+	case "/v1/" + testTopic + ":getIamPolicy":
+		v, _ := strconv.ParseInt(r.URL.Query().Get("options.requestedPolicyVersion"), 10, 64)
+		f.versions = append(f.versions, v)
+		json.NewEncoder(w).Encode(&f.policy)
+	case "/v1/" + testTopic + ":setIamPolicy":
+		var req pubsub.SetIamPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.sets++
+		if f.conflicts > 0 {
+			f.conflicts--
+			f.gen++
+		}
+		if req.Policy.Etag != strconv.Itoa(f.gen) {
+			http.Error(w, "etag mismatch", http.StatusConflict)
+			return
+		}
+		f.gen++
+		f.policy = *req.Policy
+		f.policy.Etag = strconv.Itoa(f.gen)
+		json.NewEncoder(w).Encode(&f.policy)
+	default:
+		http.Error(w, "bad path "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+// topicResource returns the Resource of the IAM policy of testTopic.
+func topicResource(svc *pubsub.Service) Resource {
+	return NewResource(
+		func(ctx context.Context, version int64) (interface{}, error) {
+			return svc.Projects.Topics.GetIamPolicy(testTopic).OptionsRequestedPolicyVersion(version).Context(ctx).Do()
+		},
+		func(ctx context.Context, p interface{}) (interface{}, error) {
+			req := &pubsub.SetIamPolicyRequest{Policy: p.(*pubsub.Policy)}
+			return svc.Projects.Topics.SetIamPolicy(testTopic, req).Context(ctx).Do()
+		})
+}
+
+func TestAddMemberRetriesConflicts(t *testing.T) {
+	f := &fakeIAM{conflicts: 2}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	r := topicResource(svc.(*pubsub.Service))
+	if err := AddMember(context.Background(), r, "roles/viewer", "user:a"); err != nil {
+		t.Fatal(err)
+	}
+	if f.sets != 3 {
+		t.Errorf("got %d sets, want 3", f.sets)
+	}
+	want := []*pubsub.Binding{{Role: "roles/viewer", Members: []string{"user:a"}}}
+	if diff := cmp.Diff(want, f.policy.Bindings); diff != "" {
+		t.Errorf("bindings mismatch (-want +got):\n%s", diff)
+	}
+	for _, v := range f.versions {
+		if v != ConditionalVersion {
+			t.Errorf("requested version %d, want %d", v, ConditionalVersion)
+		}
+	}
+}
+
+func TestModifyGivesUp(t *testing.T) {
+	f := &fakeIAM{conflicts: maxAttempts}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	r := topicResource(svc.(*pubsub.Service))
+	err := AddMember(context.Background(), r, "roles/viewer", "user:a")
+	if !isConflict(err) {
+		t.Errorf("got %v, want conflict", err)
+	}
+	if f.sets != maxAttempts {
+		t.Errorf("got %d sets, want %d", f.sets, maxAttempts)
+	}
+}
+
+func TestSetConditionVersion(t *testing.T) {
+	f := &fakeIAM{policy: pubsub.Policy{
+		Version:  1,
+		Bindings: []*pubsub.Binding{{Role: "roles/viewer", Members: []string{"user:a"}}},
+	}}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	r := topicResource(svc.(*pubsub.Service))
+	ctx := context.Background()
+	cond := &Condition{Title: "weekdays", Expression: "request.time.getDayOfWeek() < 5"}
+	if err := SetCondition(ctx, r, "roles/viewer", "user:a", cond); err != nil {
+		t.Fatal(err)
+	}
+	if f.policy.Version != ConditionalVersion {
+		t.Errorf("got version %d, want %d", f.policy.Version, ConditionalVersion)
+	}
+	want := []*pubsub.Binding{{
+		Role:      "roles/viewer",
+		Members:   []string{"user:a"},
+		Condition: &pubsub.Expr{Title: cond.Title, Expression: cond.Expression},
+	}}
+	if diff := cmp.Diff(want, f.policy.Bindings); diff != "" {
+		t.Errorf("bindings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestModifyNoChange(t *testing.T) {
+	f := &fakeIAM{}
+	svc, done := testserver.NewService(t, f, pubsub.NewService)
+	defer done()
+	r := topicResource(svc.(*pubsub.Service))
+	if err := RemoveMember(context.Background(), r, "roles/viewer", "user:a"); err != nil {
+		t.Fatal(err)
+	}
+	if f.sets != 0 {
+		t.Errorf("got %d sets, want 0", f.sets)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iampolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// A Policy is an IAM policy of any API. It holds the fields that are the
+// same in the Policy types of all APIs; the other fields of a policy, such
+// as its audit configs, are kept as they are when it is converted back with
+// ToAPI.
+type Policy struct {
+	Version  int64      `json:"version,omitempty"`
+	Etag     string     `json:"etag,omitempty"`
+	Bindings []*Binding `json:"bindings,omitempty"`
+
+	// extra holds the JSON of the fields of the API's Policy not above.
+	extra map[string]json.RawMessage
+}
+
+// A Binding grants a role to members, if its condition, if any, is true.
+type Binding struct {
+	Role      string     `json:"role,omitempty"`
+	Members   []string   `json:"members,omitempty"`
+	Condition *Condition `json:"condition,omitempty"`
+}
+
+// A Condition is a Common Expression Language expression that limits when
+// a binding applies. Conditional bindings need policy version 3.
+type Condition struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Expression  string `json:"expression,omitempty"`
+	Location    string `json:"location,omitempty"`
+}
+
+// ConditionalVersion is the policy version needed by policies with
+// conditional bindings.
+const ConditionalVersion = 3
+
+// FromAPI converts v, a pointer to the Policy type of an API, such as
+// *pubsub.Policy, to a Policy.
+func FromAPI(v interface{}) (*Policy, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("iampolicy: %v", err)
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("iampolicy: %v", err)
+	}
+	if err := json.Unmarshal(b, &p.extra); err != nil {
+		return nil, fmt.Errorf("iampolicy: %v", err)
+	}
+	for _, k := range []string{"version", "etag", "bindings"} {
+		delete(p.extra, k)
+	}
+	return p, nil
+}
+
+// ToAPI stores p in dst, a pointer to the Policy type of an API. If p was
+// returned by FromAPI, the fields of the original policy that Policy does
+// not have are stored too.
+func (p *Policy) ToAPI(dst interface{}) error {
+	m := make(map[string]interface{}, len(p.extra)+3)
+	for k, v := range p.extra {
+		m[k] = v
+	}
+	if p.Version != 0 {
+		m["version"] = p.Version
+	}
+	if p.Etag != "" {
+		m["etag"] = p.Etag
+	}
+	if len(p.Bindings) > 0 {
+		m["bindings"] = p.Bindings
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("iampolicy: %v", err)
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		return fmt.Errorf("iampolicy: %v", err)
+	}
+	return nil
+}
+
+// HasMember reports whether member is granted role by the binding with the
+// condition cond. A nil cond stands for the unconditional binding.
+func (p *Policy) HasMember(role, member string, cond *Condition) bool {
+	b := p.binding(role, cond)
+	return b != nil && indexOf(b.Members, member) >= 0
+}
+
+// AddMember grants role to member, by adding it to the binding with the
+// condition cond, which is created if needed. A nil cond stands for the
+// unconditional binding. AddMember reports whether p changed.
+func (p *Policy) AddMember(role, member string, cond *Condition) bool {
+	b := p.binding(role, cond)
+	if b == nil {
+		b = &Binding{Role: role, Condition: copyCondition(cond)}
+		p.Bindings = append(p.Bindings, b)
+	} else if indexOf(b.Members, member) >= 0 {
+		return false
+	}
+	b.Members = append(b.Members, member)
+	return true
+}
+
+// RemoveMember removes member from the binding for role with the
+// condition cond, and removes the binding if it has no members left. A nil
+// cond stands for the unconditional binding; bindings for role with other
+// conditions are left as they are. RemoveMember reports whether p changed.
+func (p *Policy) RemoveMember(role, member string, cond *Condition) bool {
+	changed := false
+	p.filter(func(b *Binding) bool {
+		return b.Role == role && conditionsEqual(b.Condition, cond)
+	}, member, &changed)
+	return changed
+}
+
+// SetCondition grants role to member under the condition cond only: member
+// is removed from all other bindings for role, and added to the one with
+// cond. A nil cond makes the grant unconditional. SetCondition reports
+// whether p changed.
+func (p *Policy) SetCondition(role, member string, cond *Condition) bool {
+	changed := false
+	p.filter(func(b *Binding) bool {
+		return b.Role == role && !conditionsEqual(b.Condition, cond)
+	}, member, &changed)
+	if p.AddMember(role, member, cond) {
+		changed = true
+	}
+	return changed
+}
+
+// filter removes member from the bindings for which match returns true,
+// and removes the bindings that are left empty. It sets *changed if it
+// removed anything.
+func (p *Policy) filter(match func(*Binding) bool, member string, changed *bool) {
+	bs := p.Bindings[:0]
+	for _, b := range p.Bindings {
+		if match(b) {
+			if i := indexOf(b.Members, member); i >= 0 {
+				b.Members = append(b.Members[:i:i], b.Members[i+1:]...)
+				*changed = true
+			}
+			if len(b.Members) == 0 {
+				continue
+			}
+		}
+		bs = append(bs, b)
+	}
+	for i := len(bs); i < len(p.Bindings); i++ {
+		p.Bindings[i] = nil
+	}
+	p.Bindings = bs
+}
+
+// binding returns the binding for role with the condition cond, or nil.
+func (p *Policy) binding(role string, cond *Condition) *Binding {
+	for _, b := range p.Bindings {
+		if b.Role == role && conditionsEqual(b.Condition, cond) {
+			return b
+		}
+	}
+	return nil
+}
+
+// hasConditions reports whether any binding of p has a condition.
+func (p *Policy) hasConditions() bool {
+	for _, b := range p.Bindings {
+		if b.Condition != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a deep copy of p's version and bindings.
+func (p *Policy) clone() *Policy {
+	c := &Policy{Version: p.Version, Etag: p.Etag, extra: p.extra}
+	for _, b := range p.Bindings {
+		c.Bindings = append(c.Bindings, &Binding{
+			Role:      b.Role,
+			Members:   append([]string(nil), b.Members...),
+			Condition: copyCondition(b.Condition),
+		})
+	}
+	return c
+}
+
+// equal reports whether p and q have the same version and bindings.
+func (p *Policy) equal(q *Policy) bool {
+	if p.Version != q.Version || len(p.Bindings) != len(q.Bindings) {
+		return false
+	}
+	for i, b := range p.Bindings {
+		c := q.Bindings[i]
+		if b.Role != c.Role || !conditionsEqual(b.Condition, c.Condition) || !reflect.DeepEqual(b.Members, c.Members) {
+			return false
+		}
+	}
+	return true
+}
+
+func conditionsEqual(a, b *Condition) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func copyCondition(c *Condition) *Condition {
+	if c == nil {
+		return nil
+	}
+	cc := *c
+	return &cc
+}
+
+func indexOf(ss []string, s string) int {
+	for i, x := range ss {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iampolicy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+var (
+	weekdays = &Condition{Title: "weekdays", Expression: "request.time.getDayOfWeek() < 5"}
+	expiry   = &Condition{Title: "expiry", Expression: `request.time < timestamp("2021-01-01T00:00:00Z")`}
+)
+
+func testPolicy() *Policy {
+	return &Policy{
+		Version: 3,
+		Bindings: []*Binding{
+			{Role: "roles/viewer", Members: []string{"user:a", "user:b"}},
+			{Role: "roles/viewer", Members: []string{"user:c"}, Condition: copyCondition(weekdays)},
+			{Role: "roles/editor", Members: []string{"user:a"}},
+		},
+	}
+}
+
+func TestEdits(t *testing.T) {
+	for _, test := range []struct {
+		desc        string
+		edit        func(p *Policy) bool
+		wantChanged bool
+		want        []*Binding
+	}{
+		{
+			desc:        "add to existing binding",
+			edit:        func(p *Policy) bool { return p.AddMember("roles/editor", "user:b", nil) },
+			wantChanged: true,
+			want: []*Binding{
+				{Role: "roles/viewer", Members: []string{"user:a", "user:b"}},
+				{Role: "roles/viewer", Members: []string{"user:c"}, Condition: weekdays},
+				{Role: "roles/editor", Members: []string{"user:a", "user:b"}},
+			},
+		},
+		{
+			desc: "add existing member",
+			edit: func(p *Policy) bool { return p.AddMember("roles/viewer", "user:c", weekdays) },
+			want: testPolicy().Bindings,
+		},
+		{
+			desc:        "add with new condition",
+			edit:        func(p *Policy) bool { return p.AddMember("roles/viewer", "user:a", expiry) },
+			wantChanged: true,
+			want: []*Binding{
+				{Role: "roles/viewer", Members: []string{"user:a", "user:b"}},
+				{Role: "roles/viewer", Members: []string{"user:c"}, Condition: weekdays},
+				{Role: "roles/editor", Members: []string{"user:a"}},
+				{Role: "roles/viewer", Members: []string{"user:a"}, Condition: expiry},
+			},
+		},
+		{
+			desc:        "remove last member",
+			edit:        func(p *Policy) bool { return p.RemoveMember("roles/editor", "user:a", nil) },
+			wantChanged: true,
+			want: []*Binding{
+				{Role: "roles/viewer", Members: []string{"user:a", "user:b"}},
+				{Role: "roles/viewer", Members: []string{"user:c"}, Condition: weekdays},
+			},
+		},
+		{
+			desc: "remove other condition",
+			edit: func(p *Policy) bool { return p.RemoveMember("roles/viewer", "user:c", nil) },
+			want: testPolicy().Bindings,
+		},
+		{
+			desc:        "set condition",
+			edit:        func(p *Policy) bool { return p.SetCondition("roles/viewer", "user:a", weekdays) },
+			wantChanged: true,
+			want: []*Binding{
+				{Role: "roles/viewer", Members: []string{"user:b"}},
+				{Role: "roles/viewer", Members: []string{"user:c", "user:a"}, Condition: weekdays},
+				{Role: "roles/editor", Members: []string{"user:a"}},
+			},
+		},
+		{
+			desc:        "clear condition",
+			edit:        func(p *Policy) bool { return p.SetCondition("roles/viewer", "user:c", nil) },
+			wantChanged: true,
+			want: []*Binding{
+				{Role: "roles/viewer", Members: []string{"user:a", "user:b", "user:c"}},
+				{Role: "roles/editor", Members: []string{"user:a"}},
+			},
+		},
+		{
+			desc: "set same condition",
+			edit: func(p *Policy) bool { return p.SetCondition("roles/viewer", "user:c", weekdays) },
+			want: testPolicy().Bindings,
+		},
+	} {
+		p := testPolicy()
+		if got := test.edit(p); got != test.wantChanged {
+			t.Errorf("%s: changed = %t, want %t", test.desc, got, test.wantChanged)
+		}
+		if diff := cmp.Diff(test.want, p.Bindings); diff != "" {
+			t.Errorf("%s: bindings mismatch (-want +got):\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestHasMember(t *testing.T) {
+	p := testPolicy()
+	if !p.HasMember("roles/viewer", "user:c", weekdays) {
+		t.Error("user:c: got false, want true")
+	}
+	if p.HasMember("roles/viewer", "user:c", nil) {
+		t.Error("user:c without condition: got true, want false")
+	}
+}
+
+func TestCloneEqual(t *testing.T) {
+	p := testPolicy()
+	c := p.clone()
+	if !p.equal(c) {
+		t.Fatal("clone not equal")
+	}
+	p.AddMember("roles/editor", "user:z", nil)
+	if p.equal(c) {
+		t.Error("clone changed with policy")
+	}
+}
+
+func TestAPIRoundTrip(t *testing.T) {
+	in := &pubsub.Policy{
+		Version: 3,
+		Etag:    "BwWKmjvelug=",
+		Bindings: []*pubsub.Binding{{
+			Role:      "roles/viewer",
+			Members:   []string{"user:a"},
+			Condition: &pubsub.Expr{Title: "t", Expression: "true"},
+		}},
+	}
+	p, err := FromAPI(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Policy{
+		Version: 3,
+		Etag:    "BwWKmjvelug=",
+		Bindings: []*Binding{{
+			Role:      "roles/viewer",
+			Members:   []string{"user:a"},
+			Condition: &Condition{Title: "t", Expression: "true"},
+		}},
+	}
+	if diff := cmp.Diff(want, p, cmpopts.IgnoreUnexported(Policy{})); diff != "" {
+		t.Errorf("FromAPI mismatch (-want +got):\n%s", diff)
+	}
+	out := &pubsub.Policy{}
+	if err := p.ToAPI(out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, out); diff != "" {
+		t.Errorf("ToAPI mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// auditedPolicy is a Policy type with a field that Policy does not have.
+type auditedPolicy struct {
+	Version      int64             `json:"version,omitempty"`
+	Bindings     []*pubsub.Binding `json:"bindings,omitempty"`
+	AuditConfigs []json.RawMessage `json:"auditConfigs,omitempty"`
+}
+
+func TestAPIKeepsOtherFields(t *testing.T) {
+	in := &auditedPolicy{AuditConfigs: []json.RawMessage{json.RawMessage(`{"service":"allServices"}`)}}
+	p, err := FromAPI(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddMember("roles/viewer", "user:a", nil)
+	out := &auditedPolicy{}
+	if err := p.ToAPI(out); err != nil {
+		t.Fatal(err)
+	}
+	want := &auditedPolicy{
+		Bindings:     []*pubsub.Binding{{Role: "roles/viewer", Members: []string{"user:a"}}},
+		AuditConfigs: in.AuditConfigs,
+	}
+	if diff := cmp.Diff(want, out); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
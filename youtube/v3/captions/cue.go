@@ -0,0 +1,433 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// A Format is a caption file format. Its value is the tfmt parameter of
+// Captions.Download.
+type Format string
+
+// The supported formats.
+const (
+	SRT    Format = "srt"  // SubRip
+	WebVTT Format = "vtt"  // Web Video Text Tracks
+	SBV    Format = "sbv"  // SubViewer
+	TTML   Format = "ttml" // Timed Text Markup Language
+)
+
+// contentType returns the media type of f.
+func (f Format) contentType() string {
+	switch f {
+	case SRT:
+		return "application/x-subrip"
+	case WebVTT:
+		return "text/vtt"
+	case TTML:
+		return "application/ttml+xml"
+	}
+	return "text/plain"
+}
+
+// A Track is a caption track.
+type Track struct {
+	// Language is the language of the track, as in "en". Only TTML files
+	// record it.
+	Language string
+
+	Cues []*Cue
+}
+
+// A Cue is text shown over a period of a video.
+type Cue struct {
+	// ID identifies the cue. Only WebVTT and TTML files record it.
+	ID string
+
+	Start, End time.Duration
+
+	// Spans are the runs of text of the cue with their styles. Lines are
+	// separated by "\n".
+	Spans []Span
+
+	// Settings are the WebVTT cue settings, as in "align:start line:0".
+	// Only WebVTT files record them.
+	Settings string
+}
+
+// A Span is a run of text with the same style.
+type Span struct {
+	Text  string
+	Style Style
+}
+
+// A Style is the style of a span. Only SRT, WebVTT and TTML files record
+// styles, and only some of them: SBV has none, and WebVTT only has the
+// colors of the classes in webVTTColors.
+type Style struct {
+	Bold, Italic, Underline bool
+
+	// Color is the color of the text, as in "red" or "#ff0000".
+	Color string
+}
+
+// webVTTColors are the color classes of WebVTT's default style sheet.
+var webVTTColors = map[string]bool{
+	"white": true, "lime": true, "cyan": true, "red": true,
+	"yellow": true, "magenta": true, "blue": true, "black": true,
+}
+
+// Text returns the text of c without styles.
+func (c *Cue) Text() string {
+	var b strings.Builder
+	for _, s := range c.Spans {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+// SetText sets the text of c to s, without styles.
+func (c *Cue) SetText(s string) {
+	c.Spans = appendSpan(nil, Span{Text: s})
+}
+
+// Parse parses a caption file in format f.
+func Parse(r io.Reader, f Format) (*Track, error) {
+	switch f {
+	case SRT:
+		return parseSRT(r)
+	case WebVTT:
+		return parseWebVTT(r)
+	case SBV:
+		return parseSBV(r)
+	case TTML:
+		return parseTTML(r)
+	}
+	return nil, fmt.Errorf("captions: unsupported format %q", f)
+}
+
+// Write writes t to w as a caption file in format f. Styles the format
+// cannot represent are dropped.
+func Write(w io.Writer, t *Track, f Format) error {
+	switch f {
+	case SRT:
+		return writeSRT(w, t)
+	case WebVTT:
+		return writeWebVTT(w, t)
+	case SBV:
+		return writeSBV(w, t)
+	case TTML:
+		return writeTTML(w, t)
+	}
+	return fmt.Errorf("captions: unsupported format %q", f)
+}
+
+// appendSpan appends s to spans, merging it with the last span if they
+// have the same style.
+func appendSpan(spans []Span, s Span) []Span {
+	if s.Text == "" {
+		return spans
+	}
+	if n := len(spans); n > 0 && spans[n-1].Style == s.Style {
+		spans[n-1].Text += s.Text
+		return spans
+	}
+	return append(spans, s)
+}
+
+// parseMarkup parses the text of an SRT or WebVTT cue, with its tags for
+// styles. In WebVTT text, unknown tags are dropped and character
+// references are decoded; in SRT text, unknown tags are kept as text.
+func parseMarkup(s string, vtt bool) []Span {
+	var spans []Span
+	var stack []Style
+	var cur Style
+	var text strings.Builder
+	flush := func() {
+		spans = appendSpan(spans, Span{Text: text.String(), Style: cur})
+		text.Reset()
+	}
+	unescape := func(s string) string {
+		if vtt {
+			return html.UnescapeString(s)
+		}
+		return s
+	}
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		j := strings.IndexByte(s[i+1:], '>')
+		if i < 0 || j < 0 {
+			text.WriteString(unescape(s))
+			break
+		}
+		j += i + 1
+		tag := s[i+1 : j]
+		text.WriteString(unescape(s[:i]))
+		next, push, ok := applyTag(tag, cur, vtt)
+		switch {
+		case !ok && vtt:
+		case !ok:
+			text.WriteString(s[i : j+1])
+		case strings.HasPrefix(tag, "/"):
+			flush()
+			if n := len(stack); n > 0 {
+				cur, stack = stack[n-1], stack[:n-1]
+			}
+		case push:
+			flush()
+			stack = append(stack, cur)
+			cur = next
+		}
+		s = s[j+1:]
+	}
+	flush()
+	return spans
+}
+
+// applyTag returns the style after the tag with the given contents, and
+// whether the tag opens an element. It reports whether it knows the tag.
+func applyTag(tag string, cur Style, vtt bool) (next Style, push, ok bool) {
+	if strings.HasPrefix(tag, "/") {
+		name := strings.TrimSpace(tag[1:])
+		switch name {
+		case "b", "i", "u":
+			return cur, false, true
+		case "font":
+			return cur, false, !vtt
+		case "c", "v", "lang", "ruby", "rt":
+			return cur, false, vtt
+		}
+		return cur, false, false
+	}
+	if vtt && tag != "" && tag[0] >= '0' && tag[0] <= '9' {
+		// A timestamp of karaoke-style text.
+		return cur, false, true
+	}
+	name := tag
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	var classes []string
+	if vtt {
+		parts := strings.Split(name, ".")
+		name, classes = parts[0], parts[1:]
+	}
+	next = cur
+	switch name {
+	case "b":
+		next.Bold = true
+	case "i":
+		next.Italic = true
+	case "u":
+		next.Underline = true
+	case "font":
+		if vtt {
+			return cur, false, false
+		}
+		if c := attr(tag, "color"); c != "" {
+			next.Color = c
+		}
+		return next, true, true
+	case "c", "v", "lang", "ruby", "rt":
+		if !vtt {
+			return cur, false, false
+		}
+	default:
+		return cur, false, false
+	}
+	for _, c := range classes {
+		if webVTTColors[c] {
+			next.Color = c
+		}
+	}
+	return next, true, true
+}
+
+// attr returns the value of the attribute with the given name of an SRT
+// font tag, as in `font color="red"`.
+func attr(tag, name string) string {
+	i := strings.Index(tag, name+"=")
+	if i < 0 {
+		return ""
+	}
+	v := tag[i+len(name)+1:]
+	if strings.HasPrefix(v, `"`) || strings.HasPrefix(v, `'`) {
+		if j := strings.IndexByte(v[1:], v[0]); j >= 0 {
+			return v[1 : j+1]
+		}
+		return v[1:]
+	}
+	if j := strings.IndexAny(v, " \t"); j >= 0 {
+		return v[:j]
+	}
+	return v
+}
+
+// formatMarkup returns the text of spans with tags for their styles, for
+// an SRT or WebVTT cue. Blank lines, which would end the cue, are
+// removed.
+func formatMarkup(spans []Span, vtt bool) string {
+	var b strings.Builder
+	for _, s := range spans {
+		text := s.Text
+		if vtt {
+			text = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+		}
+		var opens, closes string
+		tag := func(start, end string) {
+			opens += "<" + start + ">"
+			closes = "</" + end + ">" + closes
+		}
+		if c := s.Style.Color; c != "" {
+			if !vtt {
+				tag(`font color="`+c+`"`, "font")
+			} else if webVTTColors[c] {
+				tag("c."+c, "c")
+			}
+		}
+		if s.Style.Bold {
+			tag("b", "b")
+		}
+		if s.Style.Italic {
+			tag("i", "i")
+		}
+		if s.Style.Underline {
+			tag("u", "u")
+		}
+		// Tags are closed at the end of each line.
+		for i, line := range strings.Split(text, "\n") {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			if line != "" {
+				b.WriteString(opens + line + closes)
+			}
+		}
+	}
+	return removeBlankLines(b.String())
+}
+
+// removeBlankLines removes the blank lines of s, and leading and trailing
+// newlines.
+func removeBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// readLines reads the lines of r, without a byte order mark or carriage
+// returns.
+func readLines(r io.Reader) ([]string, error) {
+	var b strings.Builder
+	if _, err := io.Copy(&b, r); err != nil {
+		return nil, err
+	}
+	s := strings.TrimPrefix(b.String(), "\ufeff")
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+	return strings.Split(s, "\n"), nil
+}
+
+// A block is a run of non-blank lines of a caption file.
+type block struct {
+	num   int // line number of the first line
+	lines []string
+}
+
+// blocks splits lines into blocks separated by blank lines.
+func blocks(lines []string) []block {
+	var bs []block
+	var cur block
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			if len(cur.lines) > 0 {
+				bs = append(bs, cur)
+			}
+			cur = block{}
+			continue
+		}
+		if len(cur.lines) == 0 {
+			cur.num = i + 1
+		}
+		cur.lines = append(cur.lines, strings.TrimRight(l, " \t"))
+	}
+	if len(cur.lines) > 0 {
+		bs = append(bs, cur)
+	}
+	return bs
+}
+
+// parseClock parses a time stamp of the form [h:]mm:ss[.fff], with "," or
+// "." before the fraction.
+func parseClock(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	var d time.Duration
+	for i, p := range parts {
+		var frac string
+		if i == len(parts)-1 {
+			if j := strings.IndexAny(p, ".,"); j >= 0 {
+				p, frac = p[:j], p[j+1:]
+			}
+		}
+		n, ok := atoi(p)
+		if !ok || (i > 0 && n > 59) {
+			return 0, fmt.Errorf("bad time %q", s)
+		}
+		d = d*60 + time.Duration(n)*time.Second
+		if frac != "" {
+			f, ok := atoi(frac)
+			if !ok {
+				return 0, fmt.Errorf("bad time %q", s)
+			}
+			for k := len(frac); k < 9; k++ {
+				f *= 10
+			}
+			for k := len(frac); k > 9; k-- {
+				f /= 10
+			}
+			d += time.Duration(f)
+		}
+	}
+	return d, nil
+}
+
+// atoi parses a non-empty string of decimal digits.
+func atoi(s string) (int64, bool) {
+	if s == "" || len(s) > 18 {
+		return 0, false
+	}
+	var n int64
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(s[i]-'0')
+	}
+	return n, true
+}
+
+// formatClock formats d as h:mm:ss.fff, with sep before the milliseconds
+// and hours of at least hourDigits digits.
+func formatClock(d time.Duration, sep string, hourDigits int) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := int64(d / time.Millisecond)
+	return fmt.Sprintf("%0*d:%02d:%02d%s%03d", hourDigits, ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMarkup(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		vtt  bool
+		want []Span
+	}{
+		{"plain", false, []Span{{Text: "plain"}}},
+		{"<i>a</i> b", false, []Span{{Text: "a", Style: Style{Italic: true}}, {Text: " b"}}},
+		{"<b><i>a</i>b</b>", false, []Span{
+			{Text: "a", Style: Style{Bold: true, Italic: true}},
+			{Text: "b", Style: Style{Bold: true}},
+		}},
+		{`<font color="#ff0000">red</font>`, false, []Span{{Text: "red", Style: Style{Color: "#ff0000"}}}},
+		{"1 < 2 <x> 3 > 2", false, []Span{{Text: "1 < 2 <x> 3 > 2"}}},
+		{"a &amp; b", false, []Span{{Text: "a &amp; b"}}},
+		{"<v Bob>a &amp; <c.yellow.bg_blue>b</c></v>", true, []Span{
+			{Text: "a & "},
+			{Text: "b", Style: Style{Color: "yellow"}},
+		}},
+		{"<u.loud>a</u><00:00:01.000>b<x>c", true, []Span{
+			{Text: "a", Style: Style{Underline: true}},
+			{Text: "bc"},
+		}},
+		{"1 &lt; 2\nline", true, []Span{{Text: "1 < 2\nline"}}},
+	} {
+		got := parseMarkup(test.in, test.vtt)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+}
+
+func TestFormatMarkup(t *testing.T) {
+	spans := []Span{
+		{Text: "a < b\n\n", Style: Style{Bold: true, Italic: true}},
+		{Text: "red", Style: Style{Color: "red"}},
+		{Text: " pink", Style: Style{Color: "#ffc0cb"}},
+	}
+	if got, want := formatMarkup(spans, false), "<b><i>a < b</i></b>\n<font color=\"red\">red</font><font color=\"#ffc0cb\"> pink</font>"; got != want {
+		t.Errorf("SRT: got %q, want %q", got, want)
+	}
+	if got, want := formatMarkup(spans, true), "<b><i>a &lt; b</i></b>\n<c.red>red</c> pink"; got != want {
+		t.Errorf("WebVTT: got %q, want %q", got, want)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"00:00:01,500", 1500 * time.Millisecond, true},
+		{"01:02:03.004", time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond, true},
+		{"02:03.5", 2*time.Minute + 3500*time.Millisecond, true},
+		{"0:00:00.1234567891", 123456789, true},
+		{"100:00:00.000", 100 * time.Hour, true},
+		{"00:60:00.000", 0, false},
+		{"1.5", 0, false},
+		{"00:0x:00", 0, false},
+	} {
+		got, err := parseClock(test.in)
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("parseClock(%q) = %v, %v; want %v, ok %t", test.in, got, err, test.want, test.ok)
+		}
+	}
+	if got, want := formatClock(time.Hour+1500*time.Millisecond, ",", 2), "01:00:01,500"; got != want {
+		t.Errorf("formatClock: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package captions converts YouTube caption tracks between file formats,
+// and downloads and uploads them with the REST API
+// (google.golang.org/api/youtube/v3).
+//
+// Parse reads SubRip (SRT), WebVTT, SubViewer (SBV) and TTML files into a
+// Track of cues, with their timing, text and, where the format has them,
+// bold, italic, underline and color styles. Write writes a Track in any of
+// these formats. The Scenarist (SCC) format of Captions.Download is not
+// supported.
+//
+// For example, to shift a track by two seconds:
+//
+//	t, err := captions.Download(ctx, svc, captionID, captions.WebVTT)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	for _, c := range t.Cues {
+//		c.Start += 2 * time.Second
+//		c.End += 2 * time.Second
+//	}
+//	_, err = captions.Update(ctx, svc, &youtube.Caption{Id: captionID}, t, captions.WebVTT)
+//
+// This package is experimental and subject to change without notice.
+package captions
@@ -0,0 +1,54 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseSBV parses a SubViewer file: blocks of a timing line, as in
+// "0:00:01.000,0:00:02.500", and lines of plain text.
+func parseSBV(r io.Reader) (*Track, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &Track{}
+	for _, b := range blocks(lines) {
+		times := strings.Split(b.lines[0], ",")
+		if len(times) != 2 {
+			return nil, fmt.Errorf("captions: line %d: bad cue timing %q", b.num, b.lines[0])
+		}
+		start, err := parseClock(times[0])
+		if err != nil {
+			return nil, fmt.Errorf("captions: line %d: %v", b.num, err)
+		}
+		end, err := parseClock(times[1])
+		if err != nil {
+			return nil, fmt.Errorf("captions: line %d: %v", b.num, err)
+		}
+		c := &Cue{Start: start, End: end}
+		c.SetText(strings.Join(b.lines[1:], "\n"))
+		t.Cues = append(t.Cues, c)
+	}
+	return t, nil
+}
+
+func writeSBV(w io.Writer, t *Track) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range t.Cues {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "%s,%s\n", formatClock(c.Start, ".", 1), formatClock(c.End, ".", 1))
+		if text := removeBlankLines(c.Text()); text != "" {
+			fmt.Fprintf(bw, "%s\n", text)
+		}
+	}
+	return bw.Flush()
+}
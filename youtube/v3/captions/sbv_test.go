@@ -0,0 +1,42 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSBV(t *testing.T) {
+	const in = "0:00:01.000,0:00:02.500\nHello\nworld\n\n0:00:03.000,0:00:04.000\n<i>not</i> markup\n"
+	got, err := Parse(strings.NewReader(in), SBV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Track{Cues: []*Cue{
+		{Start: time.Second, End: 2500 * time.Millisecond, Spans: []Span{{Text: "Hello\nworld"}}},
+		{Start: 3 * time.Second, End: 4 * time.Second, Spans: []Span{{Text: "<i>not</i> markup"}}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Styles are dropped.
+	got.Cues[0].Spans = []Span{{Text: "Hello\n"}, {Text: "world", Style: Style{Bold: true}}}
+	var b strings.Builder
+	if err := Write(&b, got, SBV); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in, b.String()); diff != "" {
+		t.Errorf("Write mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := Parse(strings.NewReader("0:00:01.000\ntext\n"), SBV); err == nil {
+		t.Error("bad timing: got nil error")
+	}
+}
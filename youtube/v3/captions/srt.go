@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// parseTiming parses a cue timing line of SRT or WebVTT, as in
+// "00:00:01,000 --> 00:00:02,500", returning what follows the end time.
+func parseTiming(line string) (start, end time.Duration, rest string, err error) {
+	i := strings.Index(line, "-->")
+	if i < 0 {
+		return 0, 0, "", fmt.Errorf("bad cue timing %q", line)
+	}
+	if start, err = parseClock(line[:i]); err != nil {
+		return 0, 0, "", err
+	}
+	fields := strings.Fields(line[i+3:])
+	if len(fields) == 0 {
+		return 0, 0, "", fmt.Errorf("bad cue timing %q", line)
+	}
+	if end, err = parseClock(fields[0]); err != nil {
+		return 0, 0, "", err
+	}
+	return start, end, strings.Join(fields[1:], " "), nil
+}
+
+// parseSRT parses a SubRip file: blocks of a sequence number, a timing
+// line and lines of text.
+func parseSRT(r io.Reader) (*Track, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &Track{}
+	for _, b := range blocks(lines) {
+		ls := b.lines
+		if !strings.Contains(ls[0], "-->") {
+			if _, ok := atoi(strings.TrimSpace(ls[0])); !ok || len(ls) < 2 {
+				return nil, fmt.Errorf("captions: line %d: want cue number or timing, got %q", b.num, ls[0])
+			}
+			ls = ls[1:]
+		}
+		start, end, _, err := parseTiming(ls[0])
+		if err != nil {
+			return nil, fmt.Errorf("captions: line %d: %v", b.num, err)
+		}
+		t.Cues = append(t.Cues, &Cue{
+			Start: start,
+			End:   end,
+			Spans: parseMarkup(strings.Join(ls[1:], "\n"), false),
+		})
+	}
+	return t, nil
+}
+
+func writeSRT(w io.Writer, t *Track) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range t.Cues {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n", i+1, formatClock(c.Start, ",", 2), formatClock(c.End, ",", 2))
+		if text := formatMarkup(c.Spans, false); text != "" {
+			fmt.Fprintf(bw, "%s\n", text)
+		}
+	}
+	return bw.Flush()
+}
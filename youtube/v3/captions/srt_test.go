@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testSRT = "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello, <i>world</i>!\r\nSecond line\r\n\r\n" +
+	"2\n00:01:00,000 --> 00:01:02,000 X1:10 X2:20 Y1:5 Y2:15\n<font color=\"yellow\">Warning</font>\n\n\n"
+
+func TestSRT(t *testing.T) {
+	got, err := Parse(strings.NewReader(testSRT), SRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Track{Cues: []*Cue{
+		{
+			Start: time.Second,
+			End:   2500 * time.Millisecond,
+			Spans: []Span{{Text: "Hello, "}, {Text: "world", Style: Style{Italic: true}}, {Text: "!\nSecond line"}},
+		},
+		{
+			Start: time.Minute,
+			End:   time.Minute + 2*time.Second,
+			Spans: []Span{{Text: "Warning", Style: Style{Color: "yellow"}}},
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var b strings.Builder
+	if err := Write(&b, got, SRT); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := "1\n00:00:01,000 --> 00:00:02,500\nHello, <i>world</i>!\nSecond line\n\n" +
+		"2\n00:01:00,000 --> 00:01:02,000\n<font color=\"yellow\">Warning</font>\n"
+	if diff := cmp.Diff(wantOut, b.String()); diff != "" {
+		t.Errorf("Write mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSRTErrors(t *testing.T) {
+	for _, in := range []string{
+		"1\nhello\n",
+		"x\n00:00:01,000 --> 00:00:02,000\n",
+		"1\n00:00:01,000 -> 00:00:02,000\n",
+		"1\n00:00:01,000 -->\n",
+	} {
+		if _, err := Parse(strings.NewReader(in), SRT); err == nil {
+			t.Errorf("%q: got nil error", in)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ttmlClock holds the rates of the time expressions of a TTML document.
+type ttmlClock struct {
+	frameRate float64
+	tickRate  float64
+}
+
+// parseTTML parses a TTML document. Each p element is a cue; its span and
+// br elements, and the style elements it refers to, give the styles and
+// lines of its text. The times of p elements are taken as absolute, not
+// relative to their parents.
+func parseTTML(r io.Reader) (*Track, error) {
+	d := xml.NewDecoder(r)
+	t := &Track{}
+	styles := map[string]Style{}
+	clock := ttmlClock{frameRate: 30, tickRate: 1}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("captions: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "tt":
+			t.Language = attrValue(se, "lang")
+			if v := attrValue(se, "frameRate"); v != "" {
+				if clock.frameRate, err = strconv.ParseFloat(v, 64); err != nil || clock.frameRate <= 0 {
+					return nil, fmt.Errorf("captions: bad frame rate %q", v)
+				}
+			}
+			if v := attrValue(se, "tickRate"); v != "" {
+				if clock.tickRate, err = strconv.ParseFloat(v, 64); err != nil || clock.tickRate <= 0 {
+					return nil, fmt.Errorf("captions: bad tick rate %q", v)
+				}
+			}
+		case "style":
+			if id := attrValue(se, "id"); id != "" {
+				styles[id] = styleOf(se, Style{}, styles)
+			}
+		case "p":
+			c, err := parseParagraph(d, se, styles, clock)
+			if err != nil {
+				return nil, fmt.Errorf("captions: %v", err)
+			}
+			t.Cues = append(t.Cues, c)
+		}
+	}
+	return t, nil
+}
+
+// parseParagraph parses the p element that starts with se.
+func parseParagraph(d *xml.Decoder, se xml.StartElement, styles map[string]Style, clock ttmlClock) (*Cue, error) {
+	c := &Cue{ID: attrValue(se, "id")}
+	var err error
+	if c.Start, err = clock.parse(attrValue(se, "begin")); err != nil {
+		return nil, err
+	}
+	if v := attrValue(se, "end"); v != "" {
+		if c.End, err = clock.parse(v); err != nil {
+			return nil, err
+		}
+	} else if v := attrValue(se, "dur"); v != "" {
+		dur, err := clock.parse(v)
+		if err != nil {
+			return nil, err
+		}
+		c.End = c.Start + dur
+	} else {
+		return nil, fmt.Errorf("p element at %s without end or dur", c.Start)
+	}
+
+	stack := []Style{styleOf(se, Style{}, styles)}
+	for len(stack) > 0 {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "br" {
+				c.Spans = appendSpan(c.Spans, Span{Text: "\n", Style: top})
+			}
+			stack = append(stack, styleOf(tok, top, styles))
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			c.Spans = appendSpan(c.Spans, Span{Text: collapseSpace(string(tok)), Style: top})
+		}
+	}
+	c.Spans = trimSpaces(c.Spans)
+	return c, nil
+}
+
+// collapseSpace replaces the runs of white space in s with single
+// spaces, as TTML does by default.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// trimSpaces removes the spaces at the start and end of the lines of
+// spans, and repeated spaces, across spans, and drops the spans left
+// empty.
+func trimSpaces(spans []Span) []Span {
+	prev := '\n'
+	for i := range spans {
+		var b strings.Builder
+		for _, r := range spans[i].Text {
+			if r == ' ' && (prev == ' ' || prev == '\n') {
+				continue
+			}
+			b.WriteRune(r)
+			prev = r
+		}
+		spans[i].Text = b.String()
+	}
+	next := '\n'
+	for i := len(spans) - 1; i >= 0; i-- {
+		rs := []rune(spans[i].Text)
+		kept := make([]rune, 0, len(rs))
+		for j := len(rs) - 1; j >= 0; j-- {
+			if rs[j] == ' ' && next == '\n' {
+				continue
+			}
+			kept = append(kept, rs[j])
+			next = rs[j]
+		}
+		for l, r := 0, len(kept)-1; l < r; l, r = l+1, r-1 {
+			kept[l], kept[r] = kept[r], kept[l]
+		}
+		spans[i].Text = string(kept)
+	}
+	var out []Span
+	for _, s := range spans {
+		out = appendSpan(out, s)
+	}
+	return out
+}
+
+// attrValue returns the value of the attribute of se with the given local
+// name, in any namespace.
+func attrValue(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// styleOf returns the style of the element se within an element of style
+// parent: parent, changed by the styles se refers to and its styling
+// attributes.
+func styleOf(se xml.StartElement, parent Style, styles map[string]Style) Style {
+	s := parent
+	for _, id := range strings.Fields(attrValue(se, "style")) {
+		if r, ok := styles[id]; ok {
+			s.Bold = s.Bold || r.Bold
+			s.Italic = s.Italic || r.Italic
+			s.Underline = s.Underline || r.Underline
+			if r.Color != "" {
+				s.Color = r.Color
+			}
+		}
+	}
+	switch attrValue(se, "fontWeight") {
+	case "bold":
+		s.Bold = true
+	case "normal":
+		s.Bold = false
+	}
+	switch attrValue(se, "fontStyle") {
+	case "italic", "oblique":
+		s.Italic = true
+	case "normal":
+		s.Italic = false
+	}
+	for _, v := range strings.Fields(attrValue(se, "textDecoration")) {
+		switch v {
+		case "underline":
+			s.Underline = true
+		case "noUnderline", "none":
+			s.Underline = false
+		}
+	}
+	if v := attrValue(se, "color"); v != "" {
+		s.Color = v
+	}
+	return s
+}
+
+// parse parses a TTML time expression: a clock time, as in "00:00:01.500"
+// or "00:00:01:15" with frames, or an offset, as in "1.5s", "1500ms" or
+// "45f".
+func (c ttmlClock) parse(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	switch strings.Count(s, ":") {
+	case 2:
+		return parseClock(s)
+	case 3:
+		i := strings.LastIndexByte(s, ':')
+		d, err := parseClock(s[:i])
+		if err != nil {
+			return 0, err
+		}
+		frames, err := strconv.ParseFloat(s[i+1:], 64)
+		if err != nil || frames < 0 {
+			return 0, fmt.Errorf("bad time %q", s)
+		}
+		return d + time.Duration(math.Round(frames/c.frameRate*float64(time.Second))), nil
+	case 0:
+	default:
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	units := []struct {
+		suffix string
+		unit   float64
+	}{
+		{"ms", float64(time.Millisecond)},
+		{"h", float64(time.Hour)},
+		{"m", float64(time.Minute)},
+		{"s", float64(time.Second)},
+		{"f", float64(time.Second) / c.frameRate},
+		{"t", float64(time.Second) / c.tickRate},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil || v < 0 {
+				break
+			}
+			return time.Duration(math.Round(v * u.unit)), nil
+		}
+	}
+	return 0, fmt.Errorf("bad time %q", s)
+}
+
+func writeTTML(w io.Writer, t *Track) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling"`)
+	if t.Language != "" {
+		fmt.Fprintf(bw, ` xml:lang="%s"`, escapeXML(t.Language))
+	}
+	bw.WriteString(">\n<body>\n<div>\n")
+	for _, c := range t.Cues {
+		bw.WriteString("<p")
+		if isNCName(c.ID) {
+			fmt.Fprintf(bw, ` xml:id="%s"`, c.ID)
+		}
+		fmt.Fprintf(bw, ` begin="%s" end="%s">`, formatClock(c.Start, ".", 2), formatClock(c.End, ".", 2))
+		for _, s := range c.Spans {
+			var attrs string
+			if s.Style.Bold {
+				attrs += ` tts:fontWeight="bold"`
+			}
+			if s.Style.Italic {
+				attrs += ` tts:fontStyle="italic"`
+			}
+			if s.Style.Underline {
+				attrs += ` tts:textDecoration="underline"`
+			}
+			if s.Style.Color != "" {
+				attrs += ` tts:color="` + escapeXML(s.Style.Color) + `"`
+			}
+			if attrs != "" {
+				bw.WriteString("<span" + attrs + ">")
+			}
+			for i, line := range strings.Split(s.Text, "\n") {
+				if i > 0 {
+					bw.WriteString("<br/>")
+				}
+				bw.WriteString(escapeXML(line))
+			}
+			if attrs != "" {
+				bw.WriteString("</span>")
+			}
+		}
+		bw.WriteString("</p>\n")
+	}
+	bw.WriteString("</div>\n</body>\n</tt>\n")
+	return bw.Flush()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// isNCName reports whether s can be an xml:id: a name without colons.
+func isNCName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 0x7f:
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
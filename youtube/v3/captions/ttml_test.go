@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testTTML = `<?xml version="1.0" encoding="utf-8"?>
+<tt xml:lang="fr" xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="25">
+  <head>
+    <styling>
+      <style xml:id="em" tts:fontStyle="italic" tts:color="yellow"/>
+    </styling>
+  </head>
+  <body>
+    <div>
+      <p xml:id="c1" begin="00:00:01.000" end="00:00:02.500">
+        Bonjour,
+        <br/>
+        <span style="em">le   monde</span> !
+      </p>
+      <p begin="3s" dur="1500ms"><span tts:fontWeight="bold">Gras</span></p>
+      <p begin="00:00:05:10" end="150f">Frames</p>
+    </div>
+  </body>
+</tt>
+`
+
+func TestTTML(t *testing.T) {
+	got, err := Parse(strings.NewReader(testTTML), TTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Track{Language: "fr", Cues: []*Cue{
+		{
+			ID:    "c1",
+			Start: time.Second,
+			End:   2500 * time.Millisecond,
+			Spans: []Span{
+				{Text: "Bonjour,\n"},
+				{Text: "le monde", Style: Style{Italic: true, Color: "yellow"}},
+				{Text: " !"},
+			},
+		},
+		{Start: 3 * time.Second, End: 4500 * time.Millisecond, Spans: []Span{{Text: "Gras", Style: Style{Bold: true}}}},
+		{Start: 5400 * time.Millisecond, End: 6 * time.Second, Spans: []Span{{Text: "Frames"}}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var b strings.Builder
+	if err := Write(&b, got, TTML); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := `<?xml version="1.0" encoding="UTF-8"?>
+<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" xml:lang="fr">
+<body>
+<div>
+<p xml:id="c1" begin="00:00:01.000" end="00:00:02.500">Bonjour,<br/><span tts:fontStyle="italic" tts:color="yellow">le monde</span> !</p>
+<p begin="00:00:03.000" end="00:00:04.500"><span tts:fontWeight="bold">Gras</span></p>
+<p begin="00:00:05.400" end="00:00:06.000">Frames</p>
+</div>
+</body>
+</tt>
+`
+	if diff := cmp.Diff(wantOut, b.String()); diff != "" {
+		t.Errorf("Write mismatch (-want +got):\n%s", diff)
+	}
+
+	// The output parses back to the same track.
+	again, err := Parse(strings.NewReader(b.String()), TTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, again); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTTMLErrors(t *testing.T) {
+	for _, in := range []string{
+		`<tt><body><p begin="1s">no end</p></body></tt>`,
+		`<tt><body><p begin="1x" end="2s">bad time</p></body></tt>`,
+		`<tt><body><p begin="1s" end="2s">unclosed</body></tt>`,
+		`<tt ttp:frameRate="0"></tt>`,
+	} {
+		if _, err := Parse(strings.NewReader(in), TTML); err == nil {
+			t.Errorf("%q: got nil error", in)
+		}
+	}
+}
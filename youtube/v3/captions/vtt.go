@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseWebVTT parses a WebVTT file: a header, then blocks of an optional
+// cue identifier, a timing line with optional settings and lines of text.
+// Comments, style sheets and regions are skipped.
+func parseWebVTT(r io.Reader) (*Track, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if h := lines[0]; !(h == "WEBVTT" || strings.HasPrefix(h, "WEBVTT ") || strings.HasPrefix(h, "WEBVTT\t")) {
+		return nil, errors.New("captions: missing WEBVTT header")
+	}
+	t := &Track{}
+	for i, b := range blocks(lines) {
+		ls := b.lines
+		if i == 0 {
+			// The header, with optional metadata lines.
+			continue
+		}
+		if f := strings.Fields(ls[0]); !strings.Contains(ls[0], "-->") && len(f) > 0 && (f[0] == "NOTE" || f[0] == "STYLE" || f[0] == "REGION") {
+			continue
+		}
+		c := &Cue{}
+		if !strings.Contains(ls[0], "-->") {
+			if len(ls) < 2 {
+				return nil, fmt.Errorf("captions: line %d: want cue timing after identifier %q", b.num, ls[0])
+			}
+			c.ID, ls = ls[0], ls[1:]
+		}
+		if c.Start, c.End, c.Settings, err = parseTiming(ls[0]); err != nil {
+			return nil, fmt.Errorf("captions: line %d: %v", b.num, err)
+		}
+		c.Spans = parseMarkup(strings.Join(ls[1:], "\n"), true)
+		t.Cues = append(t.Cues, c)
+	}
+	return t, nil
+}
+
+func writeWebVTT(w io.Writer, t *Track) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n")
+	for _, c := range t.Cues {
+		bw.WriteString("\n")
+		if id := strings.TrimSpace(c.ID); id != "" && !strings.Contains(id, "-->") {
+			fmt.Fprintf(bw, "%s\n", strings.Replace(id, "\n", " ", -1))
+		}
+		fmt.Fprintf(bw, "%s --> %s", formatClock(c.Start, ".", 2), formatClock(c.End, ".", 2))
+		if c.Settings != "" {
+			fmt.Fprintf(bw, " %s", c.Settings)
+		}
+		bw.WriteString("\n")
+		if text := formatMarkup(c.Spans, true); text != "" {
+			fmt.Fprintf(bw, "%s\n", text)
+		}
+	}
+	return bw.Flush()
+}
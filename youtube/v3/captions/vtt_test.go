@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testWebVTT = `WEBVTT - Example
+Kind: captions
+
+STYLE
+::cue { color: white }
+
+NOTE This is a comment
+that spans lines
+
+intro
+00:01.000 --> 00:02.500 align:start line:0
+<v Anna>Hello &amp; <b>welcome</b>
+
+00:00:03.000 --> 00:00:04.000
+Second cue
+`
+
+func TestWebVTT(t *testing.T) {
+	got, err := Parse(strings.NewReader(testWebVTT), WebVTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Track{Cues: []*Cue{
+		{
+			ID:       "intro",
+			Start:    time.Second,
+			End:      2500 * time.Millisecond,
+			Settings: "align:start line:0",
+			Spans:    []Span{{Text: "Hello & "}, {Text: "welcome", Style: Style{Bold: true}}},
+		},
+		{
+			Start: 3 * time.Second,
+			End:   4 * time.Second,
+			Spans: []Span{{Text: "Second cue"}},
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var b strings.Builder
+	if err := Write(&b, got, WebVTT); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := `WEBVTT
+
+intro
+00:00:01.000 --> 00:00:02.500 align:start line:0
+Hello &amp; <b>welcome</b>
+
+00:00:03.000 --> 00:00:04.000
+Second cue
+`
+	if diff := cmp.Diff(wantOut, b.String()); diff != "" {
+		t.Errorf("Write mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWebVTTErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"WEBVTTX\n",
+		"WEBVTT\n\nid\n",
+		"WEBVTT\n\n00:01.000 --> 00:0x.000\ntext\n",
+	} {
+		if _, err := Parse(strings.NewReader(in), WebVTT); err == nil {
+			t.Errorf("%q: got nil error", in)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"bytes"
+	"context"
+
+	"google.golang.org/api/googleapi"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+// Download downloads the caption track with the given ID in format f and
+// parses it.
+func Download(ctx context.Context, svc *youtube.Service, id string, f Format) (*Track, error) {
+	resp, err := svc.Captions.Download(id).Tfmt(string(f)).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return Parse(resp.Body, f)
+}
+
+// Insert uploads t as a new caption track in format f. c holds the snippet
+// of the track, with at least its video ID, language and name.
+func Insert(ctx context.Context, svc *youtube.Service, c *youtube.Caption, t *Track, f Format) (*youtube.Caption, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, t, f); err != nil {
+		return nil, err
+	}
+	return svc.Captions.Insert("snippet", c).Media(&buf, googleapi.ContentType(f.contentType())).Context(ctx).Do()
+}
+
+// Update replaces the contents of the caption track with the ID of c by t,
+// uploaded in format f. If c has a snippet, its draft status is updated
+// too.
+func Update(ctx context.Context, svc *youtube.Service, c *youtube.Caption, t *Track, f Format) (*youtube.Caption, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, t, f); err != nil {
+		return nil, err
+	}
+	part := "id"
+	if c.Snippet != nil {
+		part = "snippet"
+	}
+	return svc.Captions.Update(part, c).Media(&buf, googleapi.ContentType(f.contentType())).Context(ctx).Do()
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package captions
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/internal/testserver"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+// fakeCaptions serves the download of caption "c1" as SRT, and records
+// the uploads of caption tracks.
+type fakeCaptions struct {
+	method    string
+	part      string
+	caption   youtube.Caption
+	mediaType string
+	media     string
+}
+
+func (f *fakeCaptions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/captions/c1":
+		if got := r.URL.Query().Get("tfmt"); got != "srt" {
+			http.Error(w, "bad tfmt "+got, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("1\n00:00:01,000 --> 00:00:02,000\nHi\n"))
+	case r.URL.Path == "/upload/youtube/v3/captions":
+		f.method = r.Method
+		f.part = r.URL.Query().Get("part")
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		p, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(p).Decode(&f.caption); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p, err = mr.NextPart(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := ioutil.ReadAll(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mediaType, f.media = p.Header.Get("Content-Type"), string(b)
+		json.NewEncoder(w).Encode(&youtube.Caption{Id: "c2"})
+	default:
+		http.Error(w, "bad request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	s, done := testserver.NewService(t, &fakeCaptions{}, youtube.NewService)
+	defer done()
+	svc := s.(*youtube.Service)
+	got, err := Download(context.Background(), svc, "c1", SRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Track{Cues: []*Cue{{Start: time.Second, End: 2 * time.Second, Spans: []Span{{Text: "Hi"}}}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	f := &fakeCaptions{}
+	s, done := testserver.NewService(t, f, youtube.NewService)
+	defer done()
+	svc := s.(*youtube.Service)
+	ctx := context.Background()
+	track := &Track{Cues: []*Cue{{Start: time.Second, End: 2 * time.Second, Spans: []Span{{Text: "Hi"}}}}}
+
+	c, err := Insert(ctx, svc, &youtube.Caption{Snippet: &youtube.CaptionSnippet{VideoId: "v", Language: "en", Name: "English"}}, track, WebVTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Id != "c2" || f.method != "POST" || f.part != "snippet" || f.caption.Snippet.VideoId != "v" {
+		t.Errorf("Insert: got caption %q, %s with part %q and snippet %+v", c.Id, f.method, f.part, f.caption.Snippet)
+	}
+	if want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHi\n"; f.media != want || f.mediaType != "text/vtt" {
+		t.Errorf("Insert: got media %q of type %q, want %q of type text/vtt", f.media, f.mediaType, want)
+	}
+
+	if _, err := Update(ctx, svc, &youtube.Caption{Id: "c2"}, track, SBV); err != nil {
+		t.Fatal(err)
+	}
+	if f.method != "PUT" || f.part != "id" || f.caption.Id != "c2" {
+		t.Errorf("Update: got %s with part %q and caption %q", f.method, f.part, f.caption.Id)
+	}
+	if want := "0:00:01.000,0:00:02.000\nHi\n"; f.media != want {
+		t.Errorf("Update: got media %q, want %q", f.media, want)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package livechat reads the messages of YouTube live chats with the REST
+// API (google.golang.org/api/youtube/v3).
+//
+// A Poller polls LiveChatMessages.List, following the page tokens and
+// waiting between requests for the interval the server asks for, and
+// delivers each message once, until the chat ends:
+//
+//	p := livechat.NewPoller(svc, broadcast.Snippet.LiveChatId)
+//	err := p.Receive(ctx, func(m *youtube.LiveChatMessage) {
+//		fmt.Printf("%s: %s\n", m.AuthorDetails.DisplayName, m.Snippet.DisplayMessage)
+//	})
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//
+// Messages delivers the messages on a channel instead.
+//
+// This package is experimental and subject to change without notice.
+package livechat
@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package livechat
+
+import (
+	"context"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/retry"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+const (
+	// DefaultPart is the default part parameter of the requests of a
+	// Poller.
+	DefaultPart = "snippet,authorDetails"
+
+	// DefaultMinInterval is the default minimum time between requests of a
+	// Poller.
+	DefaultMinInterval = time.Second
+
+	// DefaultDedupSize is the default number of message IDs a Poller
+	// remembers to drop duplicate messages.
+	DefaultDedupSize = 10000
+)
+
+// A Poller reads the messages of a live chat by polling the
+// LiveChatMessages.List method, waiting between requests for the interval
+// the server asks for.
+//
+// The exported fields are only safe to modify prior to the first call to
+// Receive or Messages.
+type Poller struct {
+	// Part is the part parameter of the requests. The default is
+	// DefaultPart.
+	Part string
+
+	// MaxResults, ProfileImageSize and Hl, if set, are the parameters of
+	// the same names of the requests.
+	MaxResults       int64
+	ProfileImageSize int64
+	Hl               string
+
+	// MinInterval is the minimum time between requests, used if the
+	// server asks for a shorter one or none. The default is
+	// DefaultMinInterval.
+	MinInterval time.Duration
+
+	// DedupSize is the number of message IDs remembered to drop messages
+	// delivered more than once. The default is DefaultDedupSize.
+	DedupSize int
+
+	// Backoff controls the pauses between retries of failed requests.
+	Backoff gax.Backoff
+
+	// OnError, if non-nil, is called with the errors of requests that are
+	// retried.
+	OnError func(error)
+
+	svc        *youtube.Service
+	liveChatID string
+
+	// sleep is gax.Sleep, replaced in tests.
+	sleep func(context.Context, time.Duration) error
+
+	pageToken string
+	ended     bool
+	ids       map[string]bool
+	idQueue   []string // IDs of ids, oldest first
+}
+
+// NewPoller returns a Poller for the live chat with the given ID, as in
+// the LiveChatId of a broadcast's snippet.
+func NewPoller(svc *youtube.Service, liveChatID string) *Poller {
+	return &Poller{
+		Part:        DefaultPart,
+		MinInterval: DefaultMinInterval,
+		DedupSize:   DefaultDedupSize,
+		Backoff:     gax.Backoff{Initial: time.Second, Max: 5 * time.Minute, Multiplier: 2},
+		svc:         svc,
+		liveChatID:  liveChatID,
+		sleep:       gax.Sleep,
+		ids:         map[string]bool{},
+	}
+}
+
+// Receive polls the chat and calls f with each new message, in order,
+// until ctx is done, the chat ends or a request fails with a permanent
+// error. Failed requests with errors such as exceeded quotas are retried
+// with backoff, resuming from the last page. In the first two cases
+// Receive returns nil; Ended reports which. A later call of Receive
+// resumes where the previous one stopped. Receive should not be called
+// again while it is running.
+func (p *Poller) Receive(ctx context.Context, f func(*youtube.LiveChatMessage)) error {
+	bo := p.Backoff
+	for !p.ended {
+		call := p.svc.LiveChatMessages.List(p.liveChatID, p.Part).Context(ctx)
+		if p.pageToken != "" {
+			call.PageToken(p.pageToken)
+		}
+		if p.MaxResults > 0 {
+			call.MaxResults(p.MaxResults)
+		}
+		if p.ProfileImageSize > 0 {
+			call.ProfileImageSize(p.ProfileImageSize)
+		}
+		if p.Hl != "" {
+			call.Hl(p.Hl)
+		}
+		resp, err := call.Do()
+		if err != nil {
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case hasReason(err, "liveChatEnded"):
+				p.ended = true
+				return nil
+			case !retry.Retryable(err):
+				return err
+			}
+			if p.OnError != nil {
+				p.OnError(err)
+			}
+			if p.sleep(ctx, bo.Pause()) != nil {
+				return nil
+			}
+			continue
+		}
+		bo = p.Backoff
+
+		for _, m := range resp.Items {
+			if p.seen(m.Id) {
+				continue
+			}
+			f(m)
+		}
+		if resp.NextPageToken != "" {
+			p.pageToken = resp.NextPageToken
+		}
+		if resp.OfflineAt != "" {
+			p.ended = true
+			return nil
+		}
+		d := time.Duration(resp.PollingIntervalMillis) * time.Millisecond
+		if d < p.MinInterval {
+			d = p.MinInterval
+		}
+		if p.sleep(ctx, d) != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Messages starts polling the chat as Receive does, until ctx is done,
+// and returns a channel of the new messages, closed when polling stops,
+// and a channel that then receives the result of Receive.
+func (p *Poller) Messages(ctx context.Context) (<-chan *youtube.LiveChatMessage, <-chan error) {
+	msgs := make(chan *youtube.LiveChatMessage)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(msgs)
+		errc <- p.Receive(ctx, func(m *youtube.LiveChatMessage) {
+			select {
+			case msgs <- m:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return msgs, errc
+}
+
+// Ended reports whether the chat has ended, so that Receive will return
+// without polling.
+func (p *Poller) Ended() bool {
+	return p.ended
+}
+
+// seen reports whether a message with the given ID was delivered before,
+// and remembers the ID if not.
+func (p *Poller) seen(id string) bool {
+	if id == "" {
+		return false
+	}
+	if p.ids[id] {
+		return true
+	}
+	p.ids[id] = true
+	p.idQueue = append(p.idQueue, id)
+	if n := p.DedupSize; n > 0 && len(p.idQueue) > n {
+		delete(p.ids, p.idQueue[0])
+		p.idQueue = p.idQueue[1:]
+	}
+	return false
+}
+
+// hasReason reports whether err is an API error with the given reason.
+func hasReason(err error, reason string) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	for _, item := range e.Errors {
+		if item.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
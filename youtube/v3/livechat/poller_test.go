@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package livechat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/testserver"
+	youtube "google.golang.org/api/youtube/v3"
+)
+
+// fakeChat serves LiveChatMessages.List for chat "c" with a response
+// from replies per request, recording the page tokens.
+type fakeChat struct {
+	mu      sync.Mutex
+	replies []reply
+	tokens  []string
+}
+
+type reply struct {
+	status int
+	body   string
+}
+
+func (f *fakeChat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/liveChat/messages" || r.URL.Query().Get("liveChatId") != "c" {
+		http.Error(w, "bad request "+r.URL.String(), http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = append(f.tokens, r.URL.Query().Get("pageToken"))
+	if len(f.replies) == 0 {
+		http.Error(w, "no more replies", http.StatusInternalServerError)
+		return
+	}
+	rep := f.replies[0]
+	f.replies = f.replies[1:]
+	w.Header().Set("Content-Type", "application/json")
+	if rep.status != 0 {
+		w.WriteHeader(rep.status)
+	}
+	fmt.Fprint(w, rep.body)
+}
+
+func apiError(code int, reason string) reply {
+	return reply{code, fmt.Sprintf(`{"error": {"code": %d, "message": "m", "errors": [{"reason": %q}]}}`, code, reason)}
+}
+
+func page(next string, intervalMillis int, offline bool, ids ...string) reply {
+	body := fmt.Sprintf(`{"nextPageToken": %q, "pollingIntervalMillis": %d`, next, intervalMillis)
+	if offline {
+		body += `, "offlineAt": "2020-01-02T03:04:05Z"`
+	}
+	body += `, "items": [`
+	for i, id := range ids {
+		if i > 0 {
+			body += ","
+		}
+		body += fmt.Sprintf(`{"id": %q}`, id)
+	}
+	return reply{0, body + "]}"}
+}
+
+func TestReceive(t *testing.T) {
+	f := &fakeChat{replies: []reply{
+		page("t1", 2000, false, "m1", "m2"),
+		apiError(403, "quotaExceeded"),
+		apiError(503, "backendError"),
+		page("t2", 0, false, "m2", "m3"),
+		page("t3", 2000, true, "m4"),
+	}}
+	svc, done := testserver.NewService(t, f, youtube.NewService)
+	defer done()
+	p := NewPoller(svc.(*youtube.Service), "c")
+	var sleeps []time.Duration
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	var errs []error
+	p.OnError = func(err error) { errs = append(errs, err) }
+
+	var got []string
+	if err := p.Receive(context.Background(), func(m *youtube.LiveChatMessage) {
+		got = append(got, m.Id)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"m1", "m2", "m3", "m4"}, got); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"", "t1", "t1", "t1", "t2"}, f.tokens); diff != "" {
+		t.Errorf("page tokens mismatch (-want +got):\n%s", diff)
+	}
+	if len(sleeps) != 4 || sleeps[0] != 2*time.Second || sleeps[3] != DefaultMinInterval {
+		t.Errorf("got sleeps %v, want 2s, two backoff pauses, %v", sleeps, DefaultMinInterval)
+	}
+	if len(errs) != 2 {
+		t.Errorf("got %d errors, want 2", len(errs))
+	}
+	if !p.Ended() {
+		t.Error("chat not ended")
+	}
+
+	// Receive returns at once after the chat ended.
+	if err := p.Receive(context.Background(), func(*youtube.LiveChatMessage) {}); err != nil || len(f.tokens) != 5 {
+		t.Errorf("after end: got error %v, %d requests; want nil, 5", err, len(f.tokens))
+	}
+}
+
+func TestReceiveErrors(t *testing.T) {
+	for _, test := range []struct {
+		reply     reply
+		wantErr   bool
+		wantEnded bool
+	}{
+		{apiError(403, "liveChatEnded"), false, true},
+		{apiError(404, "liveChatNotFound"), true, false},
+		{apiError(403, "liveChatDisabled"), true, false},
+	} {
+		f := &fakeChat{replies: []reply{test.reply}}
+		svc, done := testserver.NewService(t, f, youtube.NewService)
+		p := NewPoller(svc.(*youtube.Service), "c")
+		p.sleep = func(ctx context.Context, _ time.Duration) error { return ctx.Err() }
+		err := p.Receive(context.Background(), func(*youtube.LiveChatMessage) {})
+		done()
+		if (err != nil) != test.wantErr || p.Ended() != test.wantEnded {
+			t.Errorf("%s: got error %v, ended %t; want error %t, ended %t", test.reply.body, err, p.Ended(), test.wantErr, test.wantEnded)
+		}
+		if err != nil {
+			if _, ok := err.(*googleapi.Error); !ok {
+				t.Errorf("got error of type %T, want *googleapi.Error", err)
+			}
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	f := &fakeChat{replies: []reply{
+		page("t1", 0, false, "m1"),
+		page("t2", 0, false, "m1", "m2"),
+	}}
+	svc, done := testserver.NewService(t, f, youtube.NewService)
+	defer done()
+	p := NewPoller(svc.(*youtube.Service), "c")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		f.mu.Lock()
+		n := len(f.replies)
+		f.mu.Unlock()
+		if n == 0 {
+			cancel()
+		}
+		return ctx.Err()
+	}
+	msgs, errc := p.Messages(ctx)
+	var got []string
+	for m := range msgs {
+		got = append(got, m.Id)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"m1", "m2"}, got); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+	if p.Ended() {
+		t.Error("chat ended, want canceled")
+	}
+}
+
+func TestSeen(t *testing.T) {
+	p := &Poller{DedupSize: 2, ids: map[string]bool{}}
+	var got []bool
+	for _, id := range []string{"a", "b", "a", "c", "a", "", ""} {
+		got = append(got, p.seen(id))
+	}
+	if diff := cmp.Diff([]bool{false, false, true, false, false, false, false}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}